@@ -0,0 +1,89 @@
+package builder
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+)
+
+// BinariesDir holds the path, relative to the charm package
+// directory, of the directory holding the main packages of
+// any executables other than runhook that the charm uses. Each
+// subdirectory that holds a main package is built into the
+// charm's bin directory under the name of the subdirectory.
+const BinariesDir = "src/cmd"
+
+// findBinaries returns the names of the main packages in
+// BinariesDir in the given package directory, in alphabetical
+// order. Subdirectories without any Go files are ignored.
+func findBinaries(ctxt *build.Context, pkgDir string) ([]string, error) {
+	dir := filepath.Join(pkgDir, filepath.FromSlash(BinariesDir))
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var names []string
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		name := info.Name()
+		pkg, err := ctxt.ImportDir(filepath.Join(dir, name), 0)
+		if _, ok := err.(*build.NoGoError); ok {
+			continue
+		}
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot read %s/%s", BinariesDir, name)
+		}
+		if pkg.Name != "main" {
+			return nil, errgo.Newf("%s/%s is package %s, not main", BinariesDir, name, pkg.Name)
+		}
+		if name == "runhook" {
+			return nil, errgo.Newf("%s/runhook clashes with the generated runhook executable", BinariesDir)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// binaryPackage returns the import path of the main package
+// for the named binary in the charm package with the
+// given import path.
+func binaryPackage(charmPackage, name string) string {
+	return path.Join(charmPackage, BinariesDir, name)
+}
+
+// buildBinaries builds the named binaries of the given charm
+// package into binDir.
+func buildBinaries(pkg *build.Package, names []string, binDir string, cfg *BuildConfig) error {
+	for _, name := range names {
+		if err := goBuild(filepath.Join(binDir, name), binaryPackage(pkg.ImportPath, name), true, cfg); err != nil {
+			return errgo.Notef(err, "cannot build %s", name)
+		}
+	}
+	return nil
+}
+
+// checkBinaries checks that all the registered binaries
+// were found by findBinaries.
+func checkBinaries(registered, found []string) error {
+	have := make(map[string]bool)
+	for _, name := range found {
+		have[name] = true
+	}
+	for _, name := range registered {
+		if !have[name] {
+			return errgo.Newf("binary %q is registered but there is no main package in %s/%s", name, BinariesDir, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package builder
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestFindBinaries(c *gc.C) {
+	dir := c.MkDir()
+	names, err := findBinaries(&build.Default, dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(names, gc.HasLen, 0)
+
+	writeFiles(c, dir, map[string]string{
+		"src/cmd/cron/main.go":     "package main\nfunc main() {}\n",
+		"src/cmd/agent/main.go":    "package main\nfunc main() {}\n",
+		"src/cmd/agent/util.go":    "package main\n",
+		"src/cmd/empty/README":     "no Go here",
+		"src/cmd/notadir.go":       "package main\n",
+		"src/runhook/main.go.tmpl": "",
+	})
+	names, err = findBinaries(&build.Default, dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(names, jc.DeepEquals, []string{"agent", "cron"})
+
+	writeFiles(c, dir, map[string]string{
+		"src/cmd/lib/lib.go": "package lib\n",
+	})
+	_, err = findBinaries(&build.Default, dir)
+	c.Assert(err, gc.ErrorMatches, `src/cmd/lib is package lib, not main`)
+
+	dir = c.MkDir()
+	writeFiles(c, dir, map[string]string{
+		"src/cmd/runhook/main.go": "package main\nfunc main() {}\n",
+	})
+	_, err = findBinaries(&build.Default, dir)
+	c.Assert(err, gc.ErrorMatches, `src/cmd/runhook clashes with the generated runhook executable`)
+}
+
+func (suite) TestCheckBinaries(c *gc.C) {
+	c.Assert(checkBinaries(nil, []string{"agent"}), gc.IsNil)
+	c.Assert(checkBinaries([]string{"agent"}, []string{"agent", "cron"}), gc.IsNil)
+	err := checkBinaries([]string{"agent", "cron"}, []string{"agent"})
+	c.Assert(err, gc.ErrorMatches, `binary "cron" is registered but there is no main package in src/cmd/cron`)
+}
+
+func (suite) TestBinaryPackage(c *gc.C) {
+	c.Assert(binaryPackage("example.com/foo", "agent"), gc.Equals, "example.com/foo/src/cmd/agent")
+}
+
+func (suite) TestBuildBinaries(c *gc.C) {
+	gopath := c.MkDir()
+	defer setGOPATH(gopath)()
+	writeFiles(c, filepath.Join(gopath, "src", "example.com", "foo"), map[string]string{
+		"src/cmd/agent/main.go": "package main\nfunc main() {}\n",
+		"src/cmd/cron/main.go":  "package main\nfunc main() {}\n",
+		"src/cmd/bad/main.go":   "package main\nfunc main() { undefined() }\n",
+	})
+	pkg := &build.Package{
+		ImportPath: "example.com/foo",
+	}
+	binDir := filepath.Join(c.MkDir(), "bin")
+	err := buildBinaries(pkg, []string{"agent", "cron"}, binDir, &BuildConfig{})
+	c.Assert(err, gc.IsNil)
+	for _, name := range []string{"agent", "cron"} {
+		info, err := os.Stat(filepath.Join(binDir, name))
+		c.Assert(err, gc.IsNil)
+		c.Assert(info.Mode()&0111, gc.Not(gc.Equals), os.FileMode(0))
+	}
+
+	err = buildBinaries(pkg, []string{"agent", "bad"}, binDir, &BuildConfig{})
+	c.Assert(err, gc.ErrorMatches, `cannot build bad: failed to build: .*`)
+}
+
+func (suite) TestGodepSaveArgs(c *gc.C) {
+	c.Assert(godepSaveArgs("example.com/foo", nil), jc.DeepEquals, []string{"save", "."})
+	c.Assert(godepSaveArgs("example.com/foo", []string{"agent", "cron"}), jc.DeepEquals, []string{
+		"save",
+		".",
+		"example.com/foo/src/cmd/agent",
+		"example.com/foo/src/cmd/cron",
+	})
+}
@@ -0,0 +1,117 @@
+package builder
+
+import (
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// buildEnv holds the environment variables that control how the
+// go tool builds a charm's executables. Empty fields are left
+// unchanged in the environment that the build environment is
+// applied to.
+type buildEnv struct {
+	goos       string
+	goarch     string
+	cgoEnabled string
+	goflags    string
+	gocache    string
+	gopath     string
+}
+
+// newBuildEnv returns the environment for building executables with
+// the given configuration. The remaining variables are taken from
+// the environment read by getenv. If crossCompile is true, the
+// executables are built for linux/amd64 on a host with the given
+// operating system and architecture, with cgo disabled unless
+// cfg.cgo is set, in which case the host must be linux/amd64
+// because cgo cannot cross-compile.
+func newBuildEnv(cfg *BuildConfig, getenv func(string) string, crossCompile bool, goos, goarch string) (*buildEnv, error) {
+	e := &buildEnv{
+		goflags: getenv("GOFLAGS"),
+		gocache: getenv("GOCACHE"),
+		gopath:  getenv("GOPATH"),
+	}
+	if len(cfg.GOPATH) > 0 {
+		e.gopath = cfg.gopath(e.gopath)
+	}
+	if !crossCompile {
+		return e, nil
+	}
+	e.goos = "linux"
+	e.goarch = "amd64"
+	e.cgoEnabled = "0"
+	if cfg.cgo {
+		if goos != "linux" || goarch != "amd64" {
+			return nil, errgo.Newf("cannot build with cgo on %s/%s; the charm must be built on linux/amd64 or with -docker", goos, goarch)
+		}
+		e.cgoEnabled = "1"
+	}
+	return e, nil
+}
+
+// vars returns the variables set in the build environment, in
+// the form "key=value", in a fixed order.
+func (e *buildEnv) vars() []string {
+	var vars []string
+	for _, v := range []struct {
+		name, val string
+	}{
+		{"GOOS", e.goos},
+		{"GOARCH", e.goarch},
+		{"CGO_ENABLED", e.cgoEnabled},
+		{"GOFLAGS", e.goflags},
+		{"GOCACHE", e.gocache},
+		{"GOPATH", e.gopath},
+	} {
+		if v.val != "" {
+			vars = append(vars, v.name+"="+v.val)
+		}
+	}
+	return vars
+}
+
+// apply returns the given environment with the variables
+// in the build environment set.
+func (e *buildEnv) apply(env []string) []string {
+	for _, v := range e.vars() {
+		env = setenv(env, v)
+	}
+	return env
+}
+
+// String returns the variables set in the build
+// environment, separated by spaces.
+func (e *buildEnv) String() string {
+	return strings.Join(e.vars(), " ")
+}
+
+// setenv returns a copy of env with the variable in entry, which
+// must be of the form "key=value", set to its value. The entry
+// replaces the first existing entry for the variable, and any others
+// are removed, so programs see the same value whichever entry they
+// read; if there is none, the entry is appended. The env slice
+// itself is not changed.
+func setenv(env []string, entry string) []string {
+	i := strings.Index(entry, "=")
+	if i == -1 {
+		panic("no = in environment entry")
+	}
+	prefix := entry[0 : i+1]
+	result := make([]string, 0, len(env)+1)
+	found := false
+	for _, e := range env {
+		if !strings.HasPrefix(e, prefix) {
+			result = append(result, e)
+			continue
+		}
+		if !found {
+			result = append(result, entry)
+			found = true
+		}
+	}
+	if !found {
+		result = append(result, entry)
+	}
+	return result
+}
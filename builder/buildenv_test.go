@@ -0,0 +1,92 @@
+package builder
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestSetenv(c *gc.C) {
+	env := []string{"PATH=/bin", "GOOS=darwin", "HOME=/home/user", "GOOS=windows"}
+	got := setenv(env, "GOOS=linux")
+	c.Assert(got, jc.DeepEquals, []string{"PATH=/bin", "GOOS=linux", "HOME=/home/user"})
+	// The original is unchanged.
+	c.Assert(env, jc.DeepEquals, []string{"PATH=/bin", "GOOS=darwin", "HOME=/home/user", "GOOS=windows"})
+
+	// A variable whose name has the same prefix is not replaced.
+	got = setenv([]string{"GOPATHX=/x"}, "GOPATH=/go")
+	c.Assert(got, jc.DeepEquals, []string{"GOPATHX=/x", "GOPATH=/go"})
+
+	// An empty value is still set.
+	got = setenv([]string{"GOFLAGS=-v"}, "GOFLAGS=")
+	c.Assert(got, jc.DeepEquals, []string{"GOFLAGS="})
+}
+
+var newBuildEnvTests = []struct {
+	about        string
+	cfg          *BuildConfig
+	crossCompile bool
+	goos, goarch string
+	expect       string
+	expectError  string
+}{{
+	about:  "native build keeps host variables",
+	cfg:    &BuildConfig{},
+	expect: "GOFLAGS=-tags=netgo GOCACHE=/cache GOPATH=/home/user/go",
+}, {
+	about:  "configured GOPATH entries come first",
+	cfg:    &BuildConfig{GOPATH: []string{"/a"}},
+	expect: "GOFLAGS=-tags=netgo GOCACHE=/cache GOPATH=/a" + listSep + "/home/user/go",
+}, {
+	about:        "cross-compiling disables cgo",
+	cfg:          &BuildConfig{},
+	crossCompile: true,
+	goos:         "darwin",
+	goarch:       "amd64",
+	expect:       "GOOS=linux GOARCH=amd64 CGO_ENABLED=0 GOFLAGS=-tags=netgo GOCACHE=/cache GOPATH=/home/user/go",
+}, {
+	about:        "cgo on a matching host",
+	cfg:          &BuildConfig{cgo: true},
+	crossCompile: true,
+	goos:         "linux",
+	goarch:       "amd64",
+	expect:       "GOOS=linux GOARCH=amd64 CGO_ENABLED=1 GOFLAGS=-tags=netgo GOCACHE=/cache GOPATH=/home/user/go",
+}, {
+	about:        "cgo on another host",
+	cfg:          &BuildConfig{cgo: true},
+	crossCompile: true,
+	goos:         "darwin",
+	goarch:       "arm64",
+	expectError:  `cannot build with cgo on darwin/arm64; the charm must be built on linux/amd64 or with -docker`,
+}}
+
+func (suite) TestNewBuildEnv(c *gc.C) {
+	hostEnv := map[string]string{
+		"GOFLAGS": "-tags=netgo",
+		"GOCACHE": "/cache",
+		"GOPATH":  "/home/user/go",
+		"GOOS":    "windows",
+	}
+	getenv := func(key string) string {
+		return hostEnv[key]
+	}
+	for i, test := range newBuildEnvTests {
+		c.Logf("test %d: %s", i, test.about)
+		e, err := newBuildEnv(test.cfg, getenv, test.crossCompile, test.goos, test.goarch)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(e.String(), gc.Equals, test.expect)
+	}
+}
+
+func (suite) TestBuildEnvApply(c *gc.C) {
+	e := &buildEnv{
+		goos:       "linux",
+		goarch:     "amd64",
+		cgoEnabled: "0",
+	}
+	env := e.apply([]string{"CGO_ENABLED=1", "PATH=/bin"})
+	c.Assert(env, jc.DeepEquals, []string{"CGO_ENABLED=0", "PATH=/bin", "GOOS=linux", "GOARCH=amd64"})
+}
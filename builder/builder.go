@@ -0,0 +1,887 @@
+// Package builder implements the operations used by the gocharm
+// command to build Go charms: finding charm packages, discovering
+// what a charm registers with its hook registry, compiling the
+// runhook executable, writing hook stubs and metadata, and
+// installing the result into a charm repository. It allows other
+// tools and tests to build charms without running gocharm itself.
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/hooks"
+	"gopkg.in/yaml.v1"
+)
+
+// Verbose specifies whether information about
+// the charms being built is logged.
+var Verbose = false
+
+// Stdout and Stderr receive the output of the commands that are
+// run to build a charm, such as go build, and Stderr receives the
+// messages printed by the default Warningf and Infof functions.
+var (
+	Stdout io.Writer = os.Stdout
+	Stderr io.Writer = os.Stderr
+)
+
+// Warningf is used to print warnings about problems
+// that do not prevent a charm from being built.
+var Warningf = func(f string, a ...interface{}) {
+	fmt.Fprintf(Stderr, "gocharm: warning: %s\n", fmt.Sprintf(f, a...))
+}
+
+// warningRecorder records the warnings printed with Warningf.
+type warningRecorder struct {
+	old      func(f string, a ...interface{})
+	warnings []string
+}
+
+// recordWarnings replaces Warningf with a function that
+// records each warning as well as printing it. The caller
+// is responsible for calling restore when done.
+func recordWarnings() *warningRecorder {
+	r := &warningRecorder{
+		old: Warningf,
+	}
+	Warningf = func(f string, a ...interface{}) {
+		r.old(f, a...)
+		r.warnings = append(r.warnings, fmt.Sprintf(f, a...))
+	}
+	return r
+}
+
+// restore restores the Warningf function
+// replaced by recordWarnings.
+func (r *warningRecorder) restore() {
+	Warningf = r.old
+}
+
+// Infof is used to print information about charms
+// that have been built.
+var Infof = func(f string, a ...interface{}) {
+	fmt.Fprintf(Stderr, "gocharm: %s\n", fmt.Sprintf(f, a...))
+}
+
+const (
+	hookPackage    = "github.com/juju/gocharm/hook"
+	autogenMessage = `This file is automatically generated. Do not edit.`
+	godepPath      = `github.com/tools/godep`
+)
+
+var hookMainCode = template.Must(template.New("").Parse(`
+// {{.AutogenMessage}}
+
+package main
+
+import (
+	charm {{.CharmPackage | printf "%q"}}
+	{{.HookPackage | printf "%q"}}
+)
+
+func main() {
+	r := hook.NewRegistry()
+	charm.RegisterHooks(r)
+	hook.RunMain(r)
+}
+`))
+
+// BuildCharmParams holds the parameters for BuildCharm.
+type BuildCharmParams struct {
+	// Pkg specifies the package that the hook will be built from.
+	Pkg *build.Package
+
+	// CharmDir specifies the destination directory to write
+	// the charm files to.
+	CharmDir string
+
+	// TempDir holds a temporary directory to use for
+	// any temporary build artifacts.
+	TempDir string
+
+	// Source specifies whether the source code should
+	// be vendored into the charm.
+	// This also implies that the hooks will have the
+	// capability to recompile.
+	Source bool
+
+	// Dispatch specifies that each hook should be a
+	// symbolic link to the runhook executable rather
+	// than a generated stub script.
+	Dispatch bool
+
+	// Compress specifies that the runhook executable should
+	// be built without debugging information and compressed
+	// with upx if it is available. It cannot be used with
+	// Source.
+	Compress bool
+
+	// Debug specifies that the runhook executable should be
+	// built for debugging with delve, without optimizations or
+	// inlining, and that a bin/debug-hook script should be
+	// written that runs a hook under a headless delve server
+	// from a juju debug-hooks session. It cannot be used with
+	// Source or Compress.
+	Debug bool
+
+	// Docker, if non-empty, holds a Docker image providing the
+	// Go toolchain to build the executables in the charm's bin
+	// directory with. The build runs in a container with no
+	// network access and the GOPATH mounted read-only, so it
+	// does not depend on the toolchain or libraries installed
+	// on the build machine.
+	Docker string
+
+	// Cgo specifies that the charm's executables should be
+	// built with cgo enabled, for charms that need C libraries
+	// such as sqlite. Because cgo cannot cross-compile, this
+	// requires the build machine to be linux/amd64, unless
+	// Docker is set.
+	Cgo bool
+
+	// Checksum specifies that the SHA-256 checksum of the
+	// runhook executable should be written to
+	// bin/runhook.sha256, and that each hook stub should
+	// verify the checksum before running the executable.
+	Checksum bool
+
+	// SignKey, if non-empty, holds the GPG key used to sign
+	// the checksum file. The detached signature is written to
+	// bin/runhook.sha256.asc. It implies Checksum.
+	SignKey string
+
+	// Placeholders specifies that placeholders should be
+	// written for any missing README.md, icon.svg or
+	// copyright files. Otherwise a warning is printed
+	// for each one.
+	Placeholders bool
+
+	// Revision holds the charm revision to record in the
+	// runhook executable, or -1 if it is not known.
+	Revision int
+
+	// Series holds the series that the charm is being built
+	// for, if known. It is recorded in the runhook executable,
+	// it replaces any series declared in the package's
+	// metadata.yaml, and it must be supported by all the
+	// features registered with hook.Registry.RegisterSeries.
+	Series string
+}
+
+type charmBuilder BuildCharmParams
+
+// BuildCharm builds the runhook executable,
+// and all the other charm pieces (hooks, metadata.yaml,
+// config.yaml) in p.CharmDir. The package source
+// is expected to have been copied there already.
+func BuildCharm(p BuildCharmParams) error {
+	b := (*charmBuilder)(&p)
+	if b.SignKey != "" {
+		b.Checksum = true
+	}
+	if b.Compress && b.Source {
+		return errgo.New("cannot compress the runhook executable when including source")
+	}
+	if b.Checksum && (b.Source || b.Dispatch) {
+		return errgo.New("cannot checksum the runhook executable when including source or using dispatch")
+	}
+	if b.Debug && (b.Source || b.Compress) {
+		return errgo.New("cannot build the runhook executable for debugging when including source or compressing")
+	}
+	if b.Docker != "" && b.Source {
+		return errgo.New("cannot build in a Docker container when including source")
+	}
+	cfg, err := ReadBuildConfig(b.Pkg.Dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	// Record details of the build in the runhook executable
+	// so that hook.BuildInfo can report them.
+	stamped := *cfg
+	stamped.LDFlags = strings.TrimSpace(cfg.LDFlags + " " + stampFlags(path.Base(b.Pkg.Dir), b.Revision, vcsCommit(b.Pkg.Dir), b.Series))
+	if b.Debug {
+		stamped.gcflags = debugGCFlags
+	}
+	stamped.docker = b.Docker
+	stamped.cgo = b.Cgo
+	cfg = &stamped
+	code, err := generatePackageMain(b.Pkg)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	binaries, err := findBinaries(cfg.buildContext(), b.Pkg.Dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	binDir := filepath.Join(b.CharmDir, "bin")
+	if b.Source {
+		// Build the executables anyway, just to be sure
+		// that we can, but discard them.
+		binDir = filepath.Join(b.TempDir, "bin")
+	}
+	exe := filepath.Join(binDir, "runhook")
+	goFile := filepath.Join(b.CharmDir, "src", "runhook", "runhook.go")
+	if err := compile(goFile, exe, code, true, cfg); err != nil {
+		return errgo.Notef(err, "cannot build hooks main package")
+	}
+	if _, err := os.Stat(exe); err != nil {
+		return errgo.New("runhook command not built")
+	}
+	if b.Compress {
+		if err := b.compress(goFile, exe, code, cfg); err != nil {
+			return errgo.Notef(err, "cannot compress runhook executable")
+		}
+	}
+	if b.Debug {
+		if err := writeDebugScript(binDir); err != nil {
+			return errgo.Notef(err, "cannot write debug script")
+		}
+	}
+	if b.Checksum {
+		if err := writeChecksum(exe); err != nil {
+			return errgo.Notef(err, "cannot write checksum")
+		}
+	}
+	if b.SignKey != "" {
+		if err := signChecksum(exe, b.SignKey); err != nil {
+			return errgo.Notef(err, "cannot sign checksum")
+		}
+	}
+	if err := buildBinaries(b.Pkg, binaries, binDir, cfg); err != nil {
+		return errgo.Mask(err)
+	}
+	info, err := Inspect(p.Pkg, p.TempDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := checkBinaries(info.Binaries, binaries); err != nil {
+		return errgo.Mask(err)
+	}
+	if b.Series != "" {
+		if err := checkSeries(b.Series, info.Series); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := b.writeHooks(info.Hooks, info.HookStubs); err != nil {
+		return errgo.Notef(err, "cannot write hooks to charm")
+	}
+	if err := b.writeMeta(info.Relations, info.Resources); err != nil {
+		return errgo.Notef(err, "cannot write metadata.yaml")
+	}
+	if err := b.writeConfig(info.Config); err != nil {
+		return errgo.Notef(err, "cannot write config.yaml")
+	}
+	if err := b.writeMetrics(info.Metrics); err != nil {
+		return errgo.Notef(err, "cannot write metrics.yaml")
+	}
+	if err := b.writeLXDProfile(info.LXDProfile); err != nil {
+		return errgo.Notef(err, "cannot write %s", LXDProfileFile)
+	}
+	if err := NewRegistryInfo(b.Pkg.ImportPath, info).write(b.CharmDir); err != nil {
+		return errgo.Notef(err, "cannot write %s", RegistryFile)
+	}
+	// Sanity check that the new config files parse correctly.
+	ch, err := charm.ReadCharmDir(b.CharmDir)
+	if err != nil {
+		return errgo.Notef(err, "charm will not read correctly; we've broken it, sorry")
+	}
+	if err := checkHookNames(info.Hooks, ch.Meta()); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := checkMetrics(info.Hooks, ch.Metrics()); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := checkDocFiles(b.CharmDir, ch.Meta(), b.Placeholders); err != nil {
+		return errgo.Notef(err, "cannot write placeholder")
+	}
+	if b.Source {
+		if err := b.vendorDeps(cfg, binaries); err != nil {
+			return errgo.Notef(err, "cannot get dependencies")
+		}
+		if err := ioutil.WriteFile(filepath.Join(b.CharmDir, "compile"), compileScript(cfg, b.Pkg.ImportPath, binaries), 0755); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// writeHooks ensures that the charm has the given set of hooks,
+// using the given registered stub details for each one.
+// TODO write install and start hooks even if they're not registered,
+// because otherwise it won't be treated as a valid charm.
+func (b *charmBuilder) writeHooks(hooks []string, stubs map[string]HookStub) error {
+	if Verbose {
+		log.Printf("writing hooks in %s", b.CharmDir)
+	}
+	hookDir := filepath.Join(b.CharmDir, "hooks")
+	if err := os.MkdirAll(hookDir, 0777); err != nil {
+		return errgo.Notef(err, "failed to make hooks directory")
+	}
+	infos, err := ioutil.ReadDir(hookDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if Verbose {
+		log.Printf("found %d existing hooks", len(infos))
+	}
+	// Add any new hooks we need to the charm directory.
+	for _, hookName := range hooks {
+		hookPath := filepath.Join(hookDir, hookName)
+		if Verbose {
+			log.Printf("creating hook %s", hookPath)
+		}
+		if b.Dispatch {
+			if !isZeroStub(stubs[hookName]) {
+				return errgo.Newf("hook %q has a customized stub, which cannot be used with -dispatch", hookName)
+			}
+			// The runhook binary infers the hook name
+			// from the name of the link.
+			if err := os.Symlink(filepath.Join("..", "bin", "runhook"), hookPath); err != nil {
+				return errgo.Mask(err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(hookPath, b.hookStub(hookName, stubs[hookName]), 0755); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// isZeroStub reports whether the stub has
+// no customizations.
+func isZeroStub(stub HookStub) bool {
+	return stub.Interpreter == "" && len(stub.Env) == 0 && stub.Dir == "" && len(stub.Setup) == 0
+}
+
+// checkHookNames checks that all the given hook names
+// will actually be invoked by Juju for a charm with the
+// given metadata. Any hook for a relation or storage that the
+// charm does not declare would never fire, which
+// almost certainly indicates a mistake.
+func checkHookNames(hookNames []string, meta *charm.Meta) error {
+	valid := meta.Hooks()
+	// The charm package does not know about update-status
+	// or the leadership hooks, but Juju runs them for all charms.
+	valid["update-status"] = true
+	valid["leader-elected"] = true
+	valid["leader-settings-changed"] = true
+	for name := range meta.Storage {
+		for _, kind := range hooks.StorageHooks() {
+			valid[name+"-"+string(kind)] = true
+		}
+	}
+	var bad []string
+	for _, name := range hookNames {
+		if !valid[name] {
+			bad = append(bad, name)
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	sort.Strings(bad)
+	return errgo.Newf("hooks registered that will never be run: %s", strings.Join(bad, ", "))
+}
+
+// checkMetrics checks that the charm's declared metrics are
+// consistent with its registered hooks. Metrics can only be added
+// from the collect-metrics hook, so it is an error to register
+// that hook without declaring any metrics; declaring metrics
+// without the hook merely produces a warning.
+func checkMetrics(hookNames []string, metrics *charm.Metrics) error {
+	hasHook := false
+	for _, name := range hookNames {
+		if name == string(hooks.CollectMetrics) {
+			hasHook = true
+		}
+	}
+	hasMetrics := metrics != nil && len(metrics.Metrics) > 0
+	switch {
+	case hasHook && !hasMetrics:
+		return errgo.Newf("%s hook registered but no metrics declared", hooks.CollectMetrics)
+	case !hasHook && hasMetrics:
+		Warningf("metrics declared but no %s hook registered", hooks.CollectMetrics)
+	}
+	return nil
+}
+
+// hookStubTemplate holds the template for the generated hook code.
+// The apt-get flags are stolen from github.com/juju/utils/apt
+var hookStubTemplate = template.Must(template.New("").Parse(`#!{{.Interpreter}}
+set -ex
+{{if .Checksum}}if ! (cd "$CHARM_DIR/bin" && sha256sum --check --status runhook.sha256); then
+	echo "$CHARM_DIR/bin/runhook does not match its checksum; the charm may have been corrupted or tampered with" >&2
+	exit 1
+fi
+{{end}}{{range .Env}}export {{.}}
+{{end}}{{range .Setup}}{{.}}
+{{end}}{{if .Source}}
+{{if eq .HookName "install"}}
+apt-get '--option=Dpkg::Options::=--force-confold'  '--option=Dpkg::options::=--force-unsafe-io' --assume-yes --quiet install golang git mercurial
+
+if test -e "$CHARM_DIR/bin/runhook"; then
+	# the binary has been pre-compiled; no need to compile again.
+	exit 0
+fi
+export GOPATH="$CHARM_DIR"
+go get {{.GodepPath}}
+
+"$CHARM_DIR/compile"
+{{else}}
+if test -e "$CHARM_DIR/compile-always"; then
+	"$CHARM_DIR/compile"
+fi
+{{end}}
+{{end}}
+{{if .Dir}}cd {{.Dir}}
+{{end}}$CHARM_DIR/bin/runhook {{.HookName}}
+`))
+
+type hookStubParams struct {
+	Source      bool
+	Checksum    bool
+	HookName    string
+	GodepPath   string
+	Interpreter string
+	Env         []string
+	Dir         string
+	Setup       []string
+}
+
+// hookStub returns the stub for the given hook,
+// customized as specified by stub.
+func (b *charmBuilder) hookStub(hookName string, stub HookStub) []byte {
+	return GenerateHookStub(hookName, stub, StubOptions{
+		Source:   b.Source,
+		Checksum: b.Checksum,
+	})
+}
+
+// shellQuote quotes s so that it is treated as a single
+// word by the shell. Parameter expansion is still
+// performed, so it may refer to environment variables.
+func shellQuote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"', '\\', '`':
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(c)
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// writeMeta writes the charm's metadata.yaml, based on the
+// package's metadata.yaml with the given registered relations
+// and resources added.
+func (b *charmBuilder) writeMeta(relations map[string]charm.Relation, resources map[string]Resource) error {
+	data, err := ioutil.ReadFile(filepath.Join(b.Pkg.Dir, "metadata.yaml"))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	meta, err := readPackageMeta(data)
+	if err != nil {
+		return errgo.Notef(err, "cannot read metadata.yaml from %q", b.Pkg.Dir)
+	}
+	// The charm package does not know about resources,
+	// so we read them separately.
+	var extra struct {
+		Resources map[string]Resource `yaml:"resources"`
+	}
+	if err := yaml.Unmarshal(data, &extra); err != nil {
+		return errgo.Notef(err, "cannot read resources from metadata.yaml in %q", b.Pkg.Dir)
+	}
+	// The metadata name must match the directory name otherwise
+	// juju deploy will ignore the charm.
+	meta.Name = filepath.Base(b.Pkg.Dir)
+	if b.Series != "" {
+		// The package may declare several series, but
+		// the charm is built for only one of them.
+		if series, err := metaSeries(data); err == nil && len(series) > 0 {
+			meta.Series = b.Series
+		}
+	}
+	if err := setRelations(meta, relations); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := checkMeta(meta); err != nil {
+		return errgo.Mask(err)
+	}
+	allResources, err := mergeResources(extra.Resources, resources)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	var metaVal interface{} = meta
+	if len(allResources) > 0 {
+		metaVal, err = withResources(meta, allResources)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := writeYAML(filepath.Join(b.CharmDir, "metadata.yaml"), metaVal); err != nil {
+		return errgo.Notef(err, "cannot write metadata.yaml")
+	}
+	return nil
+}
+
+// readPackageMeta reads charm metadata from the contents of
+// a package's metadata.yaml file. The metadata of a subordinate
+// charm is not valid without a container-scoped relation to its
+// principal, but that relation is usually registered by the charm
+// rather than declared in metadata.yaml, so the check is left
+// until the registered relations have been added (see checkMeta).
+//
+// The charm package allows only a single series, so a list of
+// series is left out of the returned metadata; PackageSeries
+// returns all of them.
+func readPackageMeta(data []byte) (*charm.Meta, error) {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	subordinate, _ := m["subordinate"].(bool)
+	_, seriesList := m["series"].([]interface{})
+	if !subordinate && !seriesList {
+		return charm.ReadMeta(bytes.NewReader(data))
+	}
+	delete(m, "subordinate")
+	if seriesList {
+		delete(m, "series")
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	meta, err := charm.ReadMeta(bytes.NewReader(data))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	meta.Subordinate = subordinate
+	return meta, nil
+}
+
+// checkMeta checks that the metadata, including the
+// registered relations, is valid.
+func checkMeta(meta *charm.Meta) error {
+	if meta.Subordinate {
+		found := false
+		for _, rel := range meta.Requires {
+			if rel.Scope == charm.ScopeContainer {
+				found = true
+			}
+		}
+		if !found {
+			return errgo.New("subordinate charm has no container-scoped requirer relation (register one with hook.Registry.RegisterPrincipalRelation)")
+		}
+	}
+	if err := meta.Check(); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// setRelations replaces the relations in meta with
+// the given registered relations.
+func setRelations(meta *charm.Meta, relations map[string]charm.Relation) error {
+	meta.Provides = make(map[string]charm.Relation)
+	meta.Requires = make(map[string]charm.Relation)
+	meta.Peers = make(map[string]charm.Relation)
+
+	for name, rel := range relations {
+		switch rel.Role {
+		case charm.RoleProvider:
+			meta.Provides[name] = rel
+		case charm.RoleRequirer:
+			meta.Requires[name] = rel
+		case charm.RolePeer:
+			meta.Peers[name] = rel
+		default:
+			return errgo.Newf("unknown role %q in relation", rel.Role)
+		}
+	}
+	return nil
+}
+
+// mergeResources returns the union of the resources declared in
+// metadata.yaml and those registered with the hook registry,
+// checking that they are all valid.
+func mergeResources(declared, registered map[string]Resource) (map[string]Resource, error) {
+	all := make(map[string]Resource)
+	for name, res := range declared {
+		if res.Type == "" {
+			res.Type = "file"
+		}
+		all[name] = res
+	}
+	for name, res := range registered {
+		if old, ok := all[name]; ok && old != res {
+			return nil, errgo.Newf("resource %q is registered with different details from those in metadata.yaml", name)
+		}
+		all[name] = res
+	}
+	for name, res := range all {
+		if res.Type != "file" {
+			return nil, errgo.Newf("resource %q has unsupported type %q", name, res.Type)
+		}
+		if res.Filename == "" {
+			return nil, errgo.Newf("resource %q has no file name", name)
+		}
+	}
+	return all, nil
+}
+
+// withResources returns a value that will marshal as
+// the given metadata with the given resources added.
+func withResources(meta *charm.Meta, resources map[string]Resource) (interface{}, error) {
+	data, err := yaml.Marshal(meta)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	m["resources"] = resources
+	return m, nil
+}
+
+const yamlAutogenComment = "# " + autogenMessage + "\n"
+
+func writeYAML(file string, val interface{}) error {
+	data, err := yaml.Marshal(val)
+	if err != nil {
+		return errgo.Notef(err, "cannot marshal YAML")
+	}
+	data = append([]byte(yamlAutogenComment), data...)
+	if err := ioutil.WriteFile(file, data, 0666); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (b *charmBuilder) writeConfig(config map[string]charm.Option) error {
+	configPath := filepath.Join(b.CharmDir, "config.yaml")
+	if len(config) == 0 {
+		return nil
+	}
+	if err := writeYAML(configPath, &charm.Config{
+		Options: config,
+	}); err != nil {
+		return errgo.Notef(err, "cannot write config.yaml")
+	}
+	return nil
+}
+
+// writeMetrics writes the charm's metrics.yaml, adding the
+// given registered metrics to any found in the package's
+// metrics.yaml file.
+func (b *charmBuilder) writeMetrics(registered map[string]charm.Metric) error {
+	metrics := &charm.Metrics{
+		Metrics: make(map[string]charm.Metric),
+	}
+	metricsFile, err := os.Open(filepath.Join(b.Pkg.Dir, "metrics.yaml"))
+	switch {
+	case err == nil:
+		defer metricsFile.Close()
+		metrics, err = charm.ReadMetrics(metricsFile)
+		if err != nil {
+			return errgo.Notef(err, "cannot read metrics.yaml from %q", b.Pkg.Dir)
+		}
+		if metrics.Metrics == nil {
+			metrics.Metrics = make(map[string]charm.Metric)
+		}
+	case !os.IsNotExist(err):
+		return errgo.Mask(err)
+	}
+	for name, m := range registered {
+		if old, ok := metrics.Metrics[name]; ok && old != m {
+			return errgo.Newf("metric %q is registered with different details from those in metrics.yaml", name)
+		}
+		metrics.Metrics[name] = m
+	}
+	if len(metrics.Metrics) == 0 {
+		return nil
+	}
+	if err := writeYAML(filepath.Join(b.CharmDir, "metrics.yaml"), metrics); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+var listSep = string(filepath.ListSeparator)
+
+// vendorDeps uses godep to save the dependencies of the runhook
+// package and of the named binaries into the charm directory, so
+// that the compile script can build them on the unit.
+func (b *charmBuilder) vendorDeps(cfg *BuildConfig, binaries []string) error {
+	dir := filepath.Join(b.CharmDir, "src", "runhook")
+	// godep save requires the base package to be in a VCS, for
+	// some odd reason, so we create one and then destroy it.
+	gitCmd := runCmd(dir, nil, "git", "init")
+	gitCmd.Stdout = nil // We don't want the chat.
+	if err := gitCmd.Run(); err != nil {
+		return errgo.Notef(err, "cannot git init directory")
+	}
+	defer os.RemoveAll(filepath.Join(dir, ".git"))
+	// We put the existing GOPATH (after any entries from
+	// gocharm.yaml) at the start so that it doesn't matter that
+	// we have already copied the charm's source code into $charmdir/src
+	// and that it doesn't have an associated VCS.
+	env := setenv(os.Environ(), "GOPATH="+cfg.gopath(os.Getenv("GOPATH"))+listSep+b.CharmDir)
+	if err := runCmd(dir, env, "godep", godepSaveArgs(b.Pkg.ImportPath, binaries)...).Run(); err != nil {
+		if isExecNotFound(err) {
+			return errgo.Newf("godep executable not found; get it with: go get %s", godepPath)
+		}
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// godepSaveArgs returns the arguments to godep, run in the
+// runhook package directory, that save the dependencies of
+// runhook and of the named binaries of the given charm package.
+func godepSaveArgs(charmPackage string, binaries []string) []string {
+	args := []string{"save", "."}
+	for _, name := range binaries {
+		args = append(args, binaryPackage(charmPackage, name))
+	}
+	return args
+}
+
+type templateParams struct {
+	AutogenMessage string
+	CharmPackage   string
+	HookPackage    string
+}
+
+func generateCode(tmpl *template.Template, charmPackage string) []byte {
+	return executeTemplate(tmpl, templateParams{
+		CharmPackage:   charmPackage,
+		HookPackage:    hookPackage,
+		AutogenMessage: autogenMessage,
+	})
+}
+
+func compile(goFile, exeFile string, mainCode []byte, crossCompile bool, cfg *BuildConfig) error {
+	if err := os.MkdirAll(filepath.Dir(goFile), 0777); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := ioutil.WriteFile(goFile, mainCode, 0666); err != nil {
+		return errgo.Mask(err)
+	}
+	return goBuild(exeFile, goFile, crossCompile, cfg)
+}
+
+// goBuild runs go build to build the given target, which may be a Go
+// file or an import path, into exeFile. Executables that are
+// cross-compiled for the charm are built in a Docker container
+// if one has been configured.
+func goBuild(exeFile, target string, crossCompile bool, cfg *BuildConfig) error {
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	if cfg.docker != "" {
+		// The container is the build host.
+		goos, goarch = "linux", "amd64"
+	}
+	benv, err := newBuildEnv(cfg, os.Getenv, crossCompile, goos, goarch)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if crossCompile && cfg.docker != "" {
+		return dockerBuild(cfg.docker, exeFile, target, benv, cfg)
+	}
+	goTool, err := cfg.goTool()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if Verbose {
+		log.Printf("build environment: %s", benv)
+	}
+	env := benv.apply(os.Environ())
+	if err := os.MkdirAll(filepath.Dir(exeFile), 0777); err != nil {
+		return errgo.Mask(err)
+	}
+	args := append([]string{"build", "-o", exeFile}, cfg.buildArgs()...)
+	args = append(args, target)
+	if err := runCmd("", env, goTool, args...).Run(); err != nil {
+		return errgo.Notef(err, "failed to build")
+	}
+	return nil
+}
+
+func runCmd(dir string, env []string, cmd string, args ...string) *exec.Cmd {
+	if Verbose {
+		log.Printf("run %s %s", cmd, strings.Join(args, " "))
+	}
+	c := exec.Command(cmd, args...)
+	c.Stdout = Stdout
+	c.Stderr = Stderr
+	c.Env = env
+	c.Dir = dir
+	return c
+}
+
+func isExecNotFound(err error) bool {
+	e, ok := err.(*exec.Error)
+	return ok && e.Err == exec.ErrNotFound
+}
+
+func executeTemplate(t *template.Template, param interface{}) []byte {
+	var w bytes.Buffer
+	if err := t.Execute(&w, param); err != nil {
+		panic(err)
+	}
+	return w.Bytes()
+}
+
+// compileScript returns the script that compiles the runhook
+// executable, and the named binaries of the given charm package, on
+// the unit when the charm includes its source. The GOPATH entries
+// from gocharm.yaml are not used there, because godep save has
+// already copied the packages found in them.
+func compileScript(cfg *BuildConfig, charmPackage string, binaries []string) []byte {
+	var p compileScriptParams
+	for _, arg := range cfg.buildArgs() {
+		p.Args = append(p.Args, shellQuote(arg))
+	}
+	for _, name := range binaries {
+		p.Binaries = append(p.Binaries, shellQuote(binaryPackage(charmPackage, name)))
+	}
+	return executeTemplate(compileScriptTemplate, p)
+}
+
+type compileScriptParams struct {
+	Args     []string
+	Binaries []string
+}
+
+var compileScriptTemplate = template.Must(template.New("").Parse(`#!/bin/sh
+set -e
+if test -z "$CHARM_DIR"; then
+	echo CHARM_DIR not set >&2
+	exit 2
+fi
+export PATH="$CHARM_DIR/bin:$PATH"
+cd "$CHARM_DIR/src/runhook"
+export GOPATH="$CHARM_DIR:$(godep path)"
+go install{{range .Args}} {{.}}{{end}}
+{{if .Binaries}}go install{{range .Args}} {{.}}{{end}}{{range .Binaries}} {{.}}{{end}}
+{{end}}`))
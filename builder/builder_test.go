@@ -0,0 +1,683 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/filetesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/yaml.v1"
+)
+
+type suite struct{}
+
+var _ = gc.Suite(suite{})
+
+var copyContentsTests = []struct {
+	pkg       string
+	cwd       string
+	pkgDir    filetesting.Entries
+	destDir   filetesting.Entries
+	assetFile string
+}{{
+	pkg: "arble.com/foo",
+	pkgDir: filetesting.Entries{
+		filetesting.Dir{"src", 0777},
+		filetesting.Dir{"src/arble.com", 0777},
+		filetesting.Dir{"src/arble.com/foo", 0777},
+		filetesting.File{"src/arble.com/foo/foo.go", "package foo\n", 0666},
+		filetesting.File{"src/arble.com/foo/bar.go", "package foo\n", 0666},
+		filetesting.File{"src/arble.com/foo/README.md", "interesting stuff\n", 0666},
+		filetesting.Dir{"src/arble.com/foo/assets", 0777},
+		filetesting.File{"src/arble.com/foo/assets/file", "assiette", 0666},
+	},
+	destDir: filetesting.Entries{
+		filetesting.Dir{"src", 0777},
+		filetesting.Dir{"src/arble.com", 0777},
+		filetesting.Dir{"src/arble.com/foo", 0777},
+		filetesting.File{"src/arble.com/foo/foo.go", "package foo\n", 0666},
+		filetesting.File{"src/arble.com/foo/bar.go", "package foo\n", 0666},
+		filetesting.File{"src/arble.com/foo/README.md", "interesting stuff\n", 0666},
+		filetesting.Dir{"src/arble.com/foo/assets", 0777},
+		filetesting.File{"src/arble.com/foo/assets/file", "assiette", 0666},
+		filetesting.Symlink{"assets", "src/arble.com/foo/assets"},
+	},
+	assetFile: "assiette",
+}, {
+	pkg: "arble.com/foo",
+	pkgDir: filetesting.Entries{
+		filetesting.Dir{"src", 0777},
+		filetesting.Dir{"src/arble.com", 0777},
+		filetesting.Dir{"src/arble.com/foo", 0777},
+		filetesting.File{"src/arble.com/foo/foo.go", "package foo\n", 0666},
+		filetesting.File{"src/arble.com/foo/bar.go", "package foo\n", 0666},
+	},
+	destDir: filetesting.Entries{
+		filetesting.Dir{"src", 0777},
+		filetesting.Dir{"src/arble.com", 0777},
+		filetesting.Dir{"src/arble.com/foo", 0777},
+		filetesting.File{"src/arble.com/foo/foo.go", "package foo\n", 0666},
+		filetesting.File{"src/arble.com/foo/bar.go", "package foo\n", 0666},
+	},
+}}
+
+func (suite) TestCopyContents(c *gc.C) {
+	oldUmask := syscall.Umask(0)
+	defer syscall.Umask(oldUmask)
+	for i, test := range copyContentsTests {
+		c.Logf("test %d", i)
+		from := c.MkDir()
+		test.pkgDir.Create(c, from)
+		ctxt := build.Default
+		ctxt.GOPATH = from
+		pkg, err := ctxt.Import(test.pkg, test.cwd, 0)
+		c.Assert(err, gc.IsNil)
+
+		to := c.MkDir()
+		err = copyContents(pkg, to)
+		c.Assert(err, gc.IsNil)
+
+		test.destDir.Check(c, to)
+
+		if test.assetFile != "" {
+			data, err := ioutil.ReadFile(filepath.Join(to, "assets", "file"))
+			c.Assert(err, gc.IsNil)
+			c.Assert(string(data), gc.Equals, test.assetFile)
+		}
+	}
+}
+
+var checkHookNamesTests = []struct {
+	about       string
+	hooks       []string
+	expectError string
+}{{
+	about: "all valid",
+	hooks: []string{"install", "start", "config-changed", "db-relation-joined", "peer-relation-departed", "data-storage-attached", "update-status", "leader-elected"},
+}, {
+	about:       "undeclared relation",
+	hooks:       []string{"install", "other-relation-joined"},
+	expectError: `hooks registered that will never be run: other-relation-joined`,
+}, {
+	about:       "several bad hooks",
+	hooks:       []string{"install", "confg-changed", "logs-storage-detached", "action"},
+	expectError: `hooks registered that will never be run: action, confg-changed, logs-storage-detached`,
+}}
+
+func (suite) TestCheckHookNames(c *gc.C) {
+	meta := &charm.Meta{
+		Requires: map[string]charm.Relation{
+			"db": {Name: "db", Role: charm.RoleRequirer, Interface: "mysql"},
+		},
+		Peers: map[string]charm.Relation{
+			"peer": {Name: "peer", Role: charm.RolePeer, Interface: "x"},
+		},
+		Storage: map[string]charm.Storage{
+			"data": {Name: "data", Type: charm.StorageFilesystem},
+		},
+	}
+	for i, test := range checkHookNamesTests {
+		c.Logf("test %d: %s", i, test.about)
+		err := checkHookNames(test.hooks, meta)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+		} else {
+			c.Assert(err, gc.IsNil)
+		}
+	}
+}
+
+func (suite) TestCheckMetrics(c *gc.C) {
+	metrics := &charm.Metrics{
+		Metrics: map[string]charm.Metric{
+			"users": {Type: charm.MetricTypeGauge, Description: "d"},
+		},
+	}
+	err := checkMetrics([]string{"install", "collect-metrics"}, metrics)
+	c.Assert(err, gc.IsNil)
+	err = checkMetrics([]string{"install"}, metrics)
+	c.Assert(err, gc.IsNil)
+	err = checkMetrics([]string{"install"}, nil)
+	c.Assert(err, gc.IsNil)
+	err = checkMetrics([]string{"install", "collect-metrics"}, nil)
+	c.Assert(err, gc.ErrorMatches, `collect-metrics hook registered but no metrics declared`)
+}
+
+func (suite) TestWriteMetrics(c *gc.C) {
+	pkgDir := c.MkDir()
+	b := &charmBuilder{
+		Pkg:      &build.Package{Dir: pkgDir},
+		CharmDir: c.MkDir(),
+	}
+	// With nothing declared, no file is written.
+	err := b.writeMetrics(nil)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(filepath.Join(b.CharmDir, "metrics.yaml"))
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+
+	err = ioutil.WriteFile(filepath.Join(pkgDir, "metrics.yaml"), []byte(`
+metrics:
+  users:
+    type: gauge
+    description: number of users
+`), 0666)
+	c.Assert(err, gc.IsNil)
+	err = b.writeMetrics(map[string]charm.Metric{
+		"requests": {Type: charm.MetricTypeAbsolute, Description: "total requests"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(autogenerated(filepath.Join(b.CharmDir, "metrics.yaml")), gc.Equals, true)
+	f, err := os.Open(filepath.Join(b.CharmDir, "metrics.yaml"))
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	metrics, err := charm.ReadMetrics(f)
+	c.Assert(err, gc.IsNil)
+	c.Assert(metrics.Metrics, jc.DeepEquals, map[string]charm.Metric{
+		"users":    {Type: charm.MetricTypeGauge, Description: "number of users"},
+		"requests": {Type: charm.MetricTypeAbsolute, Description: "total requests"},
+	})
+
+	err = b.writeMetrics(map[string]charm.Metric{
+		"users": {Type: charm.MetricTypeAbsolute, Description: "number of users"},
+	})
+	c.Assert(err, gc.ErrorMatches, `metric "users" is registered with different details from those in metrics.yaml`)
+}
+
+func (suite) TestWriteMetaWithResources(c *gc.C) {
+	pkgDir := filepath.Join(c.MkDir(), "mycharm")
+	filetesting.Entries{
+		filetesting.Dir{"mycharm", 0777},
+		filetesting.File{"mycharm/metadata.yaml", `
+name: foo
+summary: s
+description: d
+resources:
+  payload:
+    type: file
+    filename: payload.tgz
+`, 0666},
+	}.Create(c, filepath.Dir(pkgDir))
+	b := &charmBuilder{
+		Pkg:      &build.Package{Dir: pkgDir},
+		CharmDir: c.MkDir(),
+	}
+	err := b.writeMeta(nil, map[string]Resource{
+		"config": {Type: "file", Filename: "config.json", Description: "extra config"},
+	})
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(b.CharmDir, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	var meta struct {
+		Name      string
+		Resources map[string]Resource
+	}
+	err = yaml.Unmarshal(data, &meta)
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "mycharm")
+	c.Assert(meta.Resources, jc.DeepEquals, map[string]Resource{
+		"payload": {Type: "file", Filename: "payload.tgz"},
+		"config":  {Type: "file", Filename: "config.json", Description: "extra config"},
+	})
+	_, err = charm.ReadMeta(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+
+	err = b.writeMeta(nil, map[string]Resource{
+		"payload": {Type: "file", Filename: "other.tgz"},
+	})
+	c.Assert(err, gc.ErrorMatches, `resource "payload" is registered with different details from those in metadata.yaml`)
+}
+
+func (suite) TestWriteMetaSubordinate(c *gc.C) {
+	pkgDir := filepath.Join(c.MkDir(), "mycharm")
+	filetesting.Entries{
+		filetesting.Dir{"mycharm", 0777},
+		filetesting.File{"mycharm/metadata.yaml", `
+name: foo
+summary: s
+description: d
+subordinate: true
+`, 0666},
+	}.Create(c, filepath.Dir(pkgDir))
+	b := &charmBuilder{
+		Pkg:      &build.Package{Dir: pkgDir},
+		CharmDir: c.MkDir(),
+	}
+	err := b.writeMeta(nil, nil)
+	c.Assert(err, gc.ErrorMatches, `subordinate charm has no container-scoped requirer relation .*`)
+
+	err = b.writeMeta(map[string]charm.Relation{
+		"juju-info": {
+			Name:      "juju-info",
+			Interface: "juju-info",
+			Role:      charm.RoleRequirer,
+			Scope:     charm.ScopeContainer,
+			Limit:     1,
+		},
+	}, nil)
+	c.Assert(err, gc.IsNil)
+	f, err := os.Open(filepath.Join(b.CharmDir, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	meta, err := charm.ReadMeta(f)
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Subordinate, gc.Equals, true)
+	c.Assert(meta.Requires["juju-info"].Scope, gc.Equals, charm.ScopeContainer)
+}
+
+func (suite) TestMergeHooks(c *gc.C) {
+	oldUmask := syscall.Umask(0)
+	defer syscall.Umask(oldUmask)
+
+	// Start with an empty destination; everything
+	// generated should be recorded.
+	dest := c.MkDir()
+	newDir := c.MkDir()
+	filetesting.Entries{
+		filetesting.Dir{"hooks", 0777},
+		filetesting.File{"hooks/install", "install stub\n", 0755},
+		filetesting.File{"hooks/start", "start stub\n", 0755},
+		filetesting.File{"hooks/stop", "stop stub\n", 0755},
+	}.Create(c, newDir)
+	manifest, err := mergeHooks(dest, newDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.Hooks, gc.HasLen, 3)
+	err = manifest.write(dest)
+	c.Assert(err, gc.IsNil)
+
+	// Install the hooks into the destination and then
+	// modify some of them.
+	filetesting.Entries{
+		filetesting.Dir{"hooks", 0777},
+		filetesting.File{"hooks/install", "install stub\n", 0755},
+		filetesting.File{"hooks/start", "start stub\ncustom\n", 0755},
+		filetesting.File{"hooks/stop", "stop stub\nmodified\n", 0755},
+		filetesting.File{"hooks/custom", "custom hook\n", 0700},
+	}.Create(c, dest)
+
+	// Generate a new set of hooks, with stop no
+	// longer registered.
+	newDir = c.MkDir()
+	filetesting.Entries{
+		filetesting.Dir{"hooks", 0777},
+		filetesting.File{"hooks/install", "new install stub\n", 0755},
+		filetesting.File{"hooks/start", "start stub\n", 0755},
+	}.Create(c, newDir)
+	manifest, err = mergeHooks(dest, newDir)
+	c.Assert(err, gc.IsNil)
+
+	// Only the unmodified install hook is updated; all
+	// others are preserved.
+	filetesting.Entries{
+		filetesting.File{"hooks/install", "new install stub\n", 0755},
+		filetesting.File{"hooks/start", "start stub\ncustom\n", 0755},
+		filetesting.File{"hooks/stop", "stop stub\nmodified\n", 0755},
+		filetesting.File{"hooks/custom", "custom hook\n", 0700},
+	}.Check(c, newDir)
+	c.Assert(manifest.Hooks, gc.HasLen, 1)
+	c.Assert(manifest.Hooks["install"], gc.Equals, hashOf([]byte("new install stub\n")))
+}
+
+func (suite) TestRecordWarnings(c *gc.C) {
+	var printed []string
+	defer setWarningf(func(f string, a ...interface{}) {
+		printed = append(printed, fmt.Sprintf(f, a...))
+	})()
+	r := recordWarnings()
+	Warningf("not overwriting modified hook %s", "hooks/start")
+	r.restore()
+	Warningf("after restore")
+	c.Assert(r.warnings, jc.DeepEquals, []string{
+		"not overwriting modified hook hooks/start",
+	})
+	c.Assert(printed, jc.DeepEquals, []string{
+		"not overwriting modified hook hooks/start",
+		"after restore",
+	})
+}
+
+func (suite) TestLineDiff(c *gc.C) {
+	d := lineDiff([]byte("a\nb\nc\n"), []byte("a\nx\nc\nd\n"), "old", "new")
+	c.Assert(d, gc.Equals, `--- old
++++ new
+ a
+-b
++x
+ c
++d
+`)
+}
+
+var inferSeriesTests = []struct {
+	about        string
+	metadata     string
+	flagSeries   string
+	flagSet      bool
+	expectSeries string
+	expectError  string
+}{{
+	about:        "no metadata",
+	flagSeries:   "trusty",
+	expectSeries: "trusty",
+}, {
+	about:        "no series in metadata",
+	metadata:     "name: foo\nsummary: x\ndescription: some charm\n",
+	flagSeries:   "trusty",
+	expectSeries: "trusty",
+}, {
+	about:        "series from metadata",
+	metadata:     "name: foo\nsummary: x\ndescription: some charm\nseries: precise\n",
+	flagSeries:   "trusty",
+	expectSeries: "precise",
+}, {
+	about:        "matching explicit flag",
+	metadata:     "name: foo\nsummary: x\ndescription: some charm\nseries: precise\n",
+	flagSeries:   "precise",
+	flagSet:      true,
+	expectSeries: "precise",
+}, {
+	about:       "conflicting explicit flag",
+	metadata:    "name: foo\nsummary: x\ndescription: some charm\nseries: precise\n",
+	flagSeries:  "trusty",
+	flagSet:     true,
+	expectError: `series "precise" in metadata.yaml does not match -series flag "trusty"`,
+}, {
+	about:        "first of several series",
+	metadata:     "name: foo\nsummary: x\ndescription: some charm\nseries: [xenial, trusty]\n",
+	flagSeries:   "precise",
+	expectSeries: "xenial",
+}, {
+	about:        "explicit flag in series list",
+	metadata:     "name: foo\nsummary: x\ndescription: some charm\nseries: [xenial, trusty]\n",
+	flagSeries:   "trusty",
+	flagSet:      true,
+	expectSeries: "trusty",
+}, {
+	about:       "explicit flag not in series list",
+	metadata:    "name: foo\nsummary: x\ndescription: some charm\nseries: [xenial, trusty]\n",
+	flagSeries:  "precise",
+	flagSet:     true,
+	expectError: `series \["xenial" "trusty"\] in metadata.yaml do not include -series flag "precise"`,
+}, {
+	about:       "invalid series in list",
+	metadata:    "name: foo\nsummary: x\ndescription: some charm\nseries: [xenial, Trusty]\n",
+	flagSeries:  "trusty",
+	expectError: `cannot read metadata.yaml from .*: invalid series "Trusty"`,
+}}
+
+func (suite) TestInferSeries(c *gc.C) {
+	for i, test := range inferSeriesTests {
+		c.Logf("test %d: %s", i, test.about)
+		dir := c.MkDir()
+		if test.metadata != "" {
+			err := ioutil.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte(test.metadata), 0666)
+			c.Assert(err, gc.IsNil)
+		}
+		s, err := InferSeries(dir, test.flagSeries, test.flagSet)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(s, gc.Equals, test.expectSeries)
+	}
+}
+
+func (suite) TestCopyMinimal(c *gc.C) {
+	dir := c.MkDir()
+	filetesting.Entries{
+		filetesting.Dir{"src", 0777},
+		filetesting.Dir{"src/assets", 0777},
+		filetesting.File{"src/assets/logo.png", "png", 0666},
+		filetesting.File{"src/assets/helper.go", "package assets\n", 0666},
+		filetesting.File{"src/assets/helper_test.go", "package assets\n", 0666},
+		filetesting.Dir{"src/assets/.git", 0777},
+		filetesting.File{"src/assets/.git/HEAD", "ref", 0666},
+		filetesting.Dir{"src/assets/static", 0777},
+		filetesting.File{"src/assets/static/index.html", "<html/>", 0666},
+		filetesting.Symlink{"assets", "src/assets"},
+	}.Create(c, dir)
+	dest := c.MkDir()
+	err := copyMinimal(filepath.Join(dir, "assets"), filepath.Join(dest, "assets"))
+	c.Assert(err, gc.IsNil)
+	for _, f := range []string{"logo.png", "helper.go", "static/index.html"} {
+		_, err := os.Stat(filepath.Join(dest, "assets", f))
+		c.Assert(err, gc.IsNil)
+	}
+	for _, f := range []string{"helper_test.go", ".git"} {
+		_, err := os.Lstat(filepath.Join(dest, "assets", f))
+		c.Assert(os.IsNotExist(err), gc.Equals, true, gc.Commentf("%s", f))
+	}
+	info, err := os.Lstat(filepath.Join(dest, "assets"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.IsDir(), gc.Equals, true)
+}
+
+func (suite) TestWriteJujuIgnore(c *gc.C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, ".jujuignore")
+
+	// Without -strip, nothing is written.
+	err := writeJujuIgnore(dir, false)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+
+	err = writeJujuIgnore(dir, true)
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, jujuIgnoreContents)
+
+	// Building again without -strip reverses it.
+	err = writeJujuIgnore(dir, false)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+
+	// A user-written file is left alone.
+	err = ioutil.WriteFile(path, []byte("/docs\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	err = writeJujuIgnore(dir, false)
+	c.Assert(err, gc.IsNil)
+	err = writeJujuIgnore(dir, true)
+	c.Assert(err, gc.ErrorMatches, `non-autogenerated file ".*/.jujuignore"`)
+	data, err = ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "/docs\n")
+}
+
+func (suite) TestHookStubCustomization(c *gc.C) {
+	b := &charmBuilder{}
+	c.Assert(string(b.hookStub("start", HookStub{})), gc.Equals, `#!/bin/sh
+set -ex
+
+$CHARM_DIR/bin/runhook start
+`)
+	stub := HookStub{
+		Interpreter: "/bin/bash",
+		Env: map[string]string{
+			"PATH": "$CHARM_DIR/bin:$PATH",
+			"MSG":  `say "hello"`,
+		},
+		Dir:   "assets",
+		Setup: []string{"ulimit -n 4096"},
+	}
+	c.Assert(string(b.hookStub("start", stub)), gc.Equals, `#!/bin/bash
+set -ex
+export MSG="say \"hello\""
+export PATH="$CHARM_DIR/bin:$PATH"
+ulimit -n 4096
+
+cd "$CHARM_DIR/assets"
+$CHARM_DIR/bin/runhook start
+`)
+}
+
+func (suite) TestHookStubChecksum(c *gc.C) {
+	b := &charmBuilder{
+		Checksum: true,
+	}
+	c.Assert(string(b.hookStub("install", HookStub{})), gc.Equals, `#!/bin/sh
+set -ex
+if ! (cd "$CHARM_DIR/bin" && sha256sum --check --status runhook.sha256); then
+	echo "$CHARM_DIR/bin/runhook does not match its checksum; the charm may have been corrupted or tampered with" >&2
+	exit 1
+fi
+
+$CHARM_DIR/bin/runhook install
+`)
+}
+
+func (suite) TestWriteHooksDispatch(c *gc.C) {
+	b := &charmBuilder{
+		CharmDir: c.MkDir(),
+		Dispatch: true,
+	}
+	err := b.writeHooks([]string{"install", "start"}, nil)
+	c.Assert(err, gc.IsNil)
+	for _, name := range []string{"install", "start"} {
+		target, err := os.Readlink(filepath.Join(b.CharmDir, "hooks", name))
+		c.Assert(err, gc.IsNil)
+		c.Assert(target, gc.Equals, filepath.Join("..", "bin", "runhook"))
+	}
+
+	b.CharmDir = c.MkDir()
+	err = b.writeHooks([]string{"install"}, map[string]HookStub{
+		"install": {Dir: "assets"},
+	})
+	c.Assert(err, gc.ErrorMatches, `hook "install" has a customized stub, which cannot be used with -dispatch`)
+}
+
+func (suite) TestMergeHooksDoesNotWriteThroughLinks(c *gc.C) {
+	dest := c.MkDir()
+	filetesting.Entries{
+		filetesting.Dir{"hooks", 0777},
+		filetesting.File{"hooks/install", "custom install\n", 0755},
+	}.Create(c, dest)
+	// The manifest does not mention install, so it
+	// is treated as user-maintained.
+	err := (&hookManifest{Hooks: map[string]string{}}).write(dest)
+	c.Assert(err, gc.IsNil)
+	newDir := c.MkDir()
+	filetesting.Entries{
+		filetesting.Dir{"bin", 0777},
+		filetesting.File{"bin/runhook", "binary", 0755},
+		filetesting.Dir{"hooks", 0777},
+		filetesting.Symlink{"hooks/install", "../bin/runhook"},
+	}.Create(c, newDir)
+	_, err = mergeHooks(dest, newDir)
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(newDir, "bin", "runhook"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "binary")
+	data, err = ioutil.ReadFile(filepath.Join(newDir, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "custom install\n")
+}
+
+func (suite) TestOutputFiles(c *gc.C) {
+	charmDir := c.MkDir()
+	files, err := builtFiles(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, gc.HasLen, 0)
+	_, err = OutputFiles(charmDir)
+	c.Assert(err, gc.ErrorMatches, `no .gocharm/hooks.json found in .*`)
+
+	filetesting.Entries{
+		filetesting.Dir{"bin", 0777},
+		filetesting.File{"bin/runhook", "binary", 0755},
+		filetesting.File{"bin/runhook.sha256", "sum", 0644},
+		filetesting.File{"bin/runhook.sha256.asc", "signature", 0644},
+		filetesting.File{"bin/agent", "binary", 0755},
+		filetesting.Symlink{"bin/link", "runhook"},
+	}.Create(c, charmDir)
+	files, err = builtFiles(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, jc.DeepEquals, []string{
+		"bin/agent",
+		"bin/runhook",
+		"bin/runhook.sha256",
+		"bin/runhook.sha256.asc",
+	})
+	err = (&hookManifest{Outputs: files}).write(charmDir)
+	c.Assert(err, gc.IsNil)
+	outputs, err := OutputFiles(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(outputs, jc.DeepEquals, files)
+}
+
+func (suite) TestReplaceDir(c *gc.C) {
+	parent := c.MkDir()
+	dest := filepath.Join(parent, "mycharm")
+
+	// Install into a destination that does not exist.
+	staging, err := mkStagingDir(dest)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(staging, "revision"), []byte("1"), 0666)
+	c.Assert(err, gc.IsNil)
+	err = replaceDir(dest, staging)
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dest, "revision"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "1")
+
+	// Replace an existing destination, preserving its hidden files.
+	err = os.Mkdir(filepath.Join(dest, ".git"), 0777)
+	c.Assert(err, gc.IsNil)
+	staging, err = mkStagingDir(dest)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(staging, "revision"), []byte("2"), 0666)
+	c.Assert(err, gc.IsNil)
+	err = copyHidden(dest, staging)
+	c.Assert(err, gc.IsNil)
+	err = replaceDir(dest, staging)
+	c.Assert(err, gc.IsNil)
+	data, err = ioutil.ReadFile(filepath.Join(dest, "revision"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "2")
+	info, err := os.Stat(filepath.Join(dest, ".git"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.IsDir(), gc.Equals, true)
+
+	// Nothing is left behind in the parent directory.
+	infos, err := ioutil.ReadDir(parent)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+	c.Assert(infos[0].Name(), gc.Equals, "mycharm")
+}
+
+func (suite) TestReplaceDirConcurrent(c *gc.C) {
+	parent := c.MkDir()
+	dest := filepath.Join(parent, "mycharm")
+	const n = 10
+	done := make(chan error)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			staging, err := mkStagingDir(dest)
+			if err == nil {
+				err = ioutil.WriteFile(filepath.Join(staging, "revision"), []byte(fmt.Sprint(i)), 0666)
+			}
+			if err == nil {
+				err = replaceDir(dest, staging)
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		c.Assert(<-done, gc.IsNil)
+	}
+	// Whichever installation came last, the charm is complete.
+	data, err := ioutil.ReadFile(filepath.Join(dest, "revision"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, "[0-9]")
+	infos, err := ioutil.ReadDir(parent)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+}
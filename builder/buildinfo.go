@@ -0,0 +1,267 @@
+package builder
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/yaml.v1"
+)
+
+// BuildInfoFile holds the name of the file, in the charm
+// directory, that records how the charm was built. It is
+// a hidden file, so it is kept when the charm is rebuilt
+// and is not treated as part of the charm by Juju.
+const BuildInfoFile = ".build-info.yaml"
+
+// BuildInfo records the provenance of a charm built by Install.
+type BuildInfo struct {
+	// Charm, Package, Revision and Series hold the name of
+	// the charm, the import path of the package it was built
+	// from, its revision (-1 if it has none), and the series
+	// it was built for.
+	Charm    string `yaml:"charm"`
+	Package  string `yaml:"package"`
+	Revision int    `yaml:"revision"`
+	Series   string `yaml:"series,omitempty"`
+
+	// BuildTime holds when the charm was built,
+	// in RFC 3339 format, and Host holds the name
+	// of the machine it was built on.
+	BuildTime string `yaml:"build-time"`
+	Host      string `yaml:"host,omitempty"`
+
+	// GoVersion holds the version of the Go toolchain
+	// that built the charm, for example "1.4.2".
+	GoVersion string `yaml:"go-version,omitempty"`
+
+	// Image holds the Docker image that the charm's
+	// executables were built in, if any. The Go version
+	// is not recorded in that case.
+	Image string `yaml:"image,omitempty"`
+
+	// Gocharm holds the version control commit of the
+	// gocharm source (the hook package) that the
+	// charm was built with.
+	Gocharm string `yaml:"gocharm,omitempty"`
+
+	// Commit holds the version control commit of the
+	// package source, as recorded by hook.BuildInfo.
+	Commit string `yaml:"commit,omitempty"`
+
+	// Tags, LDFlags and GCFlags hold the flags
+	// passed to the go tool, not including those
+	// that gocharm adds to record the build.
+	Tags    []string `yaml:"tags,omitempty"`
+	LDFlags string   `yaml:"ldflags,omitempty"`
+	GCFlags string   `yaml:"gcflags,omitempty"`
+
+	// Options holds the gocharm options that the charm was
+	// built with, such as "dispatch" or "compress", sorted.
+	Options []string `yaml:"options,omitempty"`
+
+	// Source holds the SHA-256 hash of each file in the
+	// package directory, keyed by slash-separated path
+	// relative to that directory. Hidden files and
+	// directories are left out.
+	Source map[string]string `yaml:"source,omitempty"`
+
+	// Dependencies holds the version control commit of each
+	// repository holding a package that the charm imports,
+	// other than the charm's own repository and the standard
+	// library, keyed by the import path of the repository's
+	// root. The commit is empty if it cannot be found.
+	Dependencies map[string]string `yaml:"dependencies,omitempty"`
+}
+
+// ReadBuildInfo reads the build information written
+// to the given charm directory by Install. If there is
+// none, the returned error has a cause that satisfies
+// os.IsNotExist.
+func ReadBuildInfo(charmDir string) (*BuildInfo, error) {
+	data, err := ioutil.ReadFile(filepath.Join(charmDir, BuildInfoFile))
+	if err != nil {
+		return nil, errgo.Mask(err, os.IsNotExist)
+	}
+	var info BuildInfo
+	if err := yaml.Unmarshal(data, &info); err != nil {
+		return nil, errgo.Notef(err, "cannot parse %s", BuildInfoFile)
+	}
+	return &info, nil
+}
+
+// write writes the build information to the given charm directory.
+func (info *BuildInfo) write(charmDir string) error {
+	return writeYAML(filepath.Join(charmDir, BuildInfoFile), info)
+}
+
+// newBuildInfo returns the build information for a charm built
+// from the given package with the given parameters, build
+// configuration and revision.
+func newBuildInfo(p Params, pkg *build.Package, cfg *BuildConfig, rev int) (*BuildInfo, error) {
+	info := &BuildInfo{
+		Charm:     filepath.Base(pkg.Dir),
+		Package:   pkg.ImportPath,
+		Revision:  rev,
+		Series:    p.Series,
+		BuildTime: now().UTC().Format(time.RFC3339),
+		Commit:    vcsCommit(pkg.Dir),
+		Tags:      cfg.Tags,
+		LDFlags:   cfg.LDFlags,
+		Options:   buildOptions(p),
+	}
+	if p.Debug {
+		info.GCFlags = debugGCFlags
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		Warningf("cannot get host name for %s: %v", BuildInfoFile, err)
+	}
+	info.Host = host
+	if p.Docker != "" {
+		info.Image = p.Docker
+	} else {
+		goTool, err := cfg.goTool()
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		if info.GoVersion, err = goVersion(goTool); err != nil {
+			Warningf("cannot record Go version in %s: %v", BuildInfoFile, err)
+		}
+	}
+	ctxt := cfg.buildContext()
+	if hookPkg, err := ctxt.Import(hookPackage, pkg.Dir, build.FindOnly); err == nil {
+		info.Gocharm = vcsCommit(hookPkg.Dir)
+	}
+	source, err := sourceHashes(pkg.Dir)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot hash source")
+	}
+	info.Source = source
+	info.Dependencies = dependencyCommits(ctxt, pkg)
+	return info, nil
+}
+
+// buildOptions returns the names of the options
+// set in p that affect the built charm.
+func buildOptions(p Params) []string {
+	var opts []string
+	for _, opt := range []struct {
+		name string
+		set  bool
+	}{
+		{"checksum", p.Checksum || p.SignKey != ""},
+		{"cgo", p.Cgo},
+		{"compress", p.Compress},
+		{"debug", p.Debug},
+		{"dispatch", p.Dispatch},
+		{"minimal", p.OutputDir != ""},
+		{"source", p.Source},
+		{"strip", p.Strip},
+	} {
+		if opt.set {
+			opts = append(opts, opt.name)
+		}
+	}
+	return opts
+}
+
+// sourceHashes returns the SHA-256 hash of each file
+// under dir, ignoring hidden files and directories.
+func sourceHashes(dir string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return hashes, nil
+}
+
+// dependencyCommits returns the version control commit of each
+// repository holding a non-standard package imported, directly
+// or indirectly, by pkg, keyed by the import path of the
+// repository root. A warning is printed for any dependency
+// that cannot be found.
+func dependencyCommits(ctxt *build.Context, pkg *build.Package) map[string]string {
+	ownRoot := vcsRoot(pkg.Dir, pkg.SrcRoot)
+	roots := make(map[string]string)
+	seen := make(map[string]bool)
+	var visit func(p *build.Package)
+	visit = func(p *build.Package) {
+		for _, path := range p.Imports {
+			if path == "C" || seen[path] {
+				continue
+			}
+			seen[path] = true
+			dep, err := ctxt.Import(path, p.Dir, 0)
+			if err != nil {
+				if _, ok := err.(*build.NoGoError); !ok {
+					Warningf("cannot find revision of dependency %q: %v", path, err)
+				}
+				continue
+			}
+			if dep.Goroot {
+				continue
+			}
+			if root := vcsRoot(dep.Dir, dep.SrcRoot); root != "" && root != ownRoot {
+				if rel, err := filepath.Rel(dep.SrcRoot, root); err == nil {
+					roots[filepath.ToSlash(rel)] = root
+				}
+			}
+			visit(dep)
+		}
+	}
+	visit(pkg)
+	if len(roots) == 0 {
+		return nil
+	}
+	commits := make(map[string]string)
+	for importPath, root := range roots {
+		commits[importPath] = vcsCommit(root)
+	}
+	return commits
+}
+
+// vcsRoot returns the closest directory at or above dir, and
+// below srcRoot, that holds a git or Mercurial repository, or
+// the empty string if there is none.
+func vcsRoot(dir, srcRoot string) string {
+	for dir != srcRoot && strings.HasPrefix(dir, srcRoot) {
+		if exists(filepath.Join(dir, ".git")) || exists(filepath.Join(dir, ".hg")) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+)
+
+func (suite) TestBuildInfoRoundTrip(c *gc.C) {
+	dir := c.MkDir()
+	info := &BuildInfo{
+		Charm:     "mycharm",
+		Package:   "example.com/charms/mycharm",
+		Revision:  4,
+		Series:    "trusty",
+		BuildTime: "2015-04-01T12:00:00Z",
+		Host:      "builder",
+		GoVersion: "1.4.2",
+		Options:   []string{"dispatch"},
+		Source: map[string]string{
+			"charm.go": "abcd",
+		},
+		Dependencies: map[string]string{
+			"github.com/juju/utils": "1234",
+		},
+	}
+	err := info.write(dir)
+	c.Assert(err, gc.IsNil)
+	got, err := ReadBuildInfo(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, jc.DeepEquals, info)
+
+	_, err = ReadBuildInfo(c.MkDir())
+	c.Assert(os.IsNotExist(errgo.Cause(err)), gc.Equals, true)
+}
+
+func (suite) TestSourceHashes(c *gc.C) {
+	dir := c.MkDir()
+	writeFiles(c, dir, map[string]string{
+		"charm.go":           "package charm",
+		"assets/index.html":  "hello",
+		".git/HEAD":          "ref: refs/heads/master",
+		".hidden":            "secret",
+		"src/cmd/agent/a.go": "package main",
+	})
+	hashes, err := sourceHashes(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(hashes, jc.DeepEquals, map[string]string{
+		"charm.go":           "628f8fdf2a15facd796697f05e7537f674a4207f893a6d220565d7146f773532",
+		"assets/index.html":  "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"src/cmd/agent/a.go": "512843855fcc92a51c810b1b58e0731c01eac9a6a23c157bfa02aad71edffbe7",
+	})
+}
+
+func (suite) TestBuildOptions(c *gc.C) {
+	c.Assert(buildOptions(Params{}), gc.HasLen, 0)
+	c.Assert(buildOptions(Params{
+		Dispatch:  true,
+		SignKey:   "key",
+		OutputDir: "/tmp/out",
+	}), jc.DeepEquals, []string{"checksum", "dispatch", "minimal"})
+}
+
+func (suite) TestVCSRoot(c *gc.C) {
+	srcRoot := c.MkDir()
+	writeFiles(c, srcRoot, map[string]string{
+		"github.com/foo/bar/.git/HEAD": "",
+		"github.com/foo/bar/baz/x.go":  "",
+		"example.com/other/y.go":       "",
+	})
+	c.Assert(vcsRoot(filepath.Join(srcRoot, "github.com/foo/bar/baz"), srcRoot), gc.Equals, filepath.Join(srcRoot, "github.com/foo/bar"))
+	c.Assert(vcsRoot(filepath.Join(srcRoot, "example.com/other"), srcRoot), gc.Equals, "")
+}
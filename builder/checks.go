@@ -0,0 +1,143 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// ChecksError is the cause of the error returned by Install when the
+// charm's source fails any of the checks requested in Params, so that
+// callers building several charms can report the failure and carry on
+// with the others.
+type ChecksError struct {
+	// Charm holds the name of the charm.
+	Charm string
+
+	// Problems holds a description of each check that failed.
+	Problems []string
+}
+
+// Error implements error.Error.
+func (e *ChecksError) Error() string {
+	return fmt.Sprintf("charm %s failed %d check(s):\n\t%s", e.Charm, len(e.Problems), strings.Join(e.Problems, "\n\t"))
+}
+
+func isChecksError(err error) bool {
+	_, ok := err.(*ChecksError)
+	return ok
+}
+
+// checkNames returns the names of the checks requested in p.
+func checkNames(p Params) []string {
+	var names []string
+	if p.Fmt {
+		names = append(names, "gofmt")
+	}
+	if p.Vet {
+		names = append(names, "go vet")
+	}
+	if p.Race {
+		names = append(names, "go test -race")
+	}
+	return names
+}
+
+// runChecks runs the checks requested in p on the source of the
+// charm in pkg, with the given build configuration and go tool. All
+// the checks are run even if one fails; the returned error is a
+// *ChecksError if any of them fail.
+func runChecks(pkg *build.Package, cfg *BuildConfig, goTool string, p Params) error {
+	if len(checkNames(p)) == 0 {
+		return nil
+	}
+	charmName := path.Base(pkg.Dir)
+	var problems []string
+	if p.Fmt {
+		files, err := unformattedFiles(pkg.Dir)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if len(files) > 0 {
+			problems = append(problems, "gofmt: not formatted: "+strings.Join(files, ", "))
+		}
+	}
+	if p.Vet {
+		args := append([]string{"vet"}, cfg.buildArgs()...)
+		cmd := runCmd(pkg.Dir, cfg.env(os.Environ()), goTool, append(args, "./...")...)
+		cmd.Stdout, cmd.Stderr = nil, nil
+		if out, err := cmd.CombinedOutput(); err != nil {
+			out = bytes.TrimSpace(out)
+			problems = append(problems, "go vet: "+strings.Replace(string(out), "\n", "\n\t\t", -1))
+		}
+	}
+	if p.Race {
+		if err := Test(TestParams{
+			PkgPath: pkg.ImportPath,
+			Args:    []string{"-race"},
+		}); err != nil {
+			problems = append(problems, "go test -race: "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return &ChecksError{
+			Charm:    charmName,
+			Problems: problems,
+		}
+	}
+	if Verbose {
+		log.Printf("%s: passed checks: %s", charmName, strings.Join(checkNames(p), ", "))
+	}
+	return nil
+}
+
+// unformattedFiles returns the slash-separated paths, relative to
+// dir, of the Go files in the directory tree that are not formatted
+// as gofmt would format them. Hidden directories, testdata and
+// vendored packages are left out, as by go vet ./...
+func unformattedFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		formatted, err := format.Source(data)
+		if err != nil || !bytes.Equal(data, formatted) {
+			// A file that cannot be parsed is reported too;
+			// go vet will say what is wrong with it.
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return files, nil
+}
@@ -0,0 +1,55 @@
+package builder
+
+import (
+	"go/build"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+)
+
+func (suite) TestUnformattedFiles(c *gc.C) {
+	dir := c.MkDir()
+	writeFiles(c, dir, map[string]string{
+		"good.go":             "package mycharm\n\nfunc f() {}\n",
+		"bad.go":              "package mycharm\nfunc  g()  {}\n",
+		"bad_test.go":         "package mycharm\nimport \"testing\"\nfunc TestG(t *testing.T){}\n",
+		"broken.go":           "package mycharm\nfunc {\n",
+		"notgo.txt":           "func  x\n",
+		"sub/bad.go":          "package sub\nvar x=1\n",
+		"sub/good.go":         "package sub\n\nvar y = 1\n",
+		"testdata/bad.go":     "package data\nvar x=1\n",
+		"vendor/example/x.go": "package x\nvar x=1\n",
+		".hidden/bad.go":      "package hidden\nvar x=1\n",
+		"_ignored/bad.go":     "package ignored\nvar x=1\n",
+	})
+	files, err := unformattedFiles(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, jc.DeepEquals, []string{"bad.go", "bad_test.go", "broken.go", "sub/bad.go"})
+}
+
+func (suite) TestRunChecks(c *gc.C) {
+	dir := c.MkDir()
+	writeFiles(c, dir, map[string]string{
+		"mycharm/charm.go": "package mycharm\nvar x=1\n",
+	})
+	pkg := &build.Package{Dir: filepath.Join(dir, "mycharm")}
+	err := runChecks(pkg, &BuildConfig{}, "go", Params{})
+	c.Assert(err, gc.IsNil)
+
+	err = runChecks(pkg, &BuildConfig{}, "go", Params{Fmt: true})
+	c.Assert(err, jc.DeepEquals, &ChecksError{
+		Charm:    "mycharm",
+		Problems: []string{"gofmt: not formatted: charm.go"},
+	})
+	c.Assert(err, gc.ErrorMatches, "charm mycharm failed 1 check\\(s\\):\n\tgofmt: not formatted: charm.go")
+	// The error is preserved by Install.
+	c.Assert(isChecksError(errgo.Cause(errgo.Mask(err, isChecksError))), gc.Equals, true)
+
+	writeFiles(c, dir, map[string]string{
+		"mycharm/charm.go": "package mycharm\n\nvar x = 1\n",
+	})
+	err = runChecks(pkg, &BuildConfig{}, "go", Params{Fmt: true})
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,62 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// checksumSuffix holds the suffix added to the name
+// of the runhook executable to make the name of
+// its checksum file.
+const checksumSuffix = ".sha256"
+
+// writeChecksum writes the SHA-256 checksum of the given
+// executable to a file alongside it, in the format
+// read by "sha256sum --check".
+func writeChecksum(exe string) error {
+	sum, err := fileSHA256(exe)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	data := fmt.Sprintf("%s  %s\n", sum, filepath.Base(exe))
+	return ioutil.WriteFile(exe+checksumSuffix, []byte(data), 0644)
+}
+
+// signChecksum signs the checksum file written by writeChecksum
+// for the given executable with the given GPG key, writing an
+// ASCII-armored detached signature alongside it.
+func signChecksum(exe, key string) error {
+	sumFile := exe + checksumSuffix
+	c := runCmd("", nil, "gpg", "--batch", "--yes", "--armor", "--detach-sign", "--local-user", key, "--output", sumFile+".asc", sumFile)
+	c.Stdout = nil
+	c.Stderr = nil
+	if out, err := c.CombinedOutput(); err != nil {
+		if isExecNotFound(err) {
+			return errgo.New("gpg not found in $PATH")
+		}
+		return errgo.Notef(err, "gpg failed: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256
+// checksum of the contents of the given file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestWriteChecksum(c *gc.C) {
+	exe := filepath.Join(c.MkDir(), "runhook")
+	err := ioutil.WriteFile(exe, []byte("hello\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = writeChecksum(exe)
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(exe + ".sha256")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  runhook\n")
+
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		c.Skip("sha256sum not found")
+	}
+	check := func() error {
+		cmd := exec.Command("sha256sum", "--check", "--status", "runhook.sha256")
+		cmd.Dir = filepath.Dir(exe)
+		return cmd.Run()
+	}
+	c.Assert(check(), gc.IsNil)
+	err = ioutil.WriteFile(exe, []byte("tampered\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	c.Assert(check(), gc.NotNil)
+}
+
+func (suite) TestSignChecksumWithoutGPG(c *gc.C) {
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", c.MkDir())
+	err := signChecksum(filepath.Join(c.MkDir(), "runhook"), "me@example.com")
+	c.Assert(err, gc.ErrorMatches, `gpg not found in \$PATH`)
+}
@@ -0,0 +1,18 @@
+package builder
+
+import (
+	"gopkg.in/errgo.v1"
+)
+
+// runCommands runs each of the given commands in turn with "sh -c"
+// in the given directory and environment, stopping at the first
+// one that fails. The phase names the gocharm.yaml field that the
+// commands came from, and is used in error messages.
+func runCommands(phase, dir string, env []string, cmds []string) error {
+	for _, cmd := range cmds {
+		if err := runCmd(dir, env, "sh", "-c", cmd).Run(); err != nil {
+			return errgo.Notef(err, "%s command %q failed", phase, cmd)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestRunCommands(c *gc.C) {
+	dir := c.MkDir()
+	env := setenv(os.Environ(), "CHARM_DIR=/charm")
+	err := runCommands("postbuild", dir, env, []string{
+		"echo $CHARM_DIR > out",
+		"echo second >> out",
+	})
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "out"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "/charm\nsecond\n")
+
+	err = runCommands("prebuild", dir, env, []string{
+		"exit 3",
+		"touch notrun",
+	})
+	c.Assert(err, gc.ErrorMatches, `prebuild command "exit 3" failed: exit status 3`)
+	_, err = os.Stat(filepath.Join(dir, "notrun"))
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+}
@@ -0,0 +1,81 @@
+package builder
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// stripFlags holds the linker flags that omit the symbol
+// table and DWARF debugging information from the
+// runhook executable.
+const stripFlags = "-s -w"
+
+// compress rebuilds the runhook executable without debugging
+// information and then compresses it with upx if that is
+// available, reporting the size of the executable before
+// and after.
+func (b *charmBuilder) compress(goFile, exe string, code []byte, cfg *BuildConfig) error {
+	before, err := fileSize(exe)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	stripped := *cfg
+	stripped.LDFlags = strings.TrimSpace(cfg.LDFlags + " " + stripFlags)
+	if err := compile(goFile, exe, code, true, &stripped); err != nil {
+		return errgo.Notef(err, "cannot build stripped executable")
+	}
+	if err := runUPX(exe); err != nil {
+		Warningf("cannot compress %s with upx: %v", exe, err)
+	}
+	after, err := fileSize(exe)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	Infof("%s: runhook reduced from %s to %s", path.Base(b.Pkg.Dir), formatSize(before), formatSize(after))
+	return nil
+}
+
+// runUPX compresses the given executable in place with upx.
+// It does nothing if upx is not installed.
+func runUPX(exe string) error {
+	upx, err := exec.LookPath("upx")
+	if err != nil {
+		if Verbose {
+			log.Printf("upx not found; not compressing %s", exe)
+		}
+		return nil
+	}
+	c := runCmd("", nil, upx, "-q", "-q", exe)
+	c.Stdout = nil
+	c.Stderr = nil
+	if out, err := c.CombinedOutput(); err != nil {
+		return errgo.Notef(err, "%s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// formatSize returns a human readable form
+// of the given number of bytes.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,57 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+)
+
+var formatSizeTests = []struct {
+	n      int64
+	expect string
+}{
+	{0, "0B"},
+	{1023, "1023B"},
+	{1536, "1.5KB"},
+	{12 << 20, "12.0MB"},
+}
+
+func (suite) TestFormatSize(c *gc.C) {
+	for i, test := range formatSizeTests {
+		c.Logf("test %d: %d", i, test.n)
+		c.Assert(formatSize(test.n), gc.Equals, test.expect)
+	}
+}
+
+func (suite) TestRunUPX(c *gc.C) {
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	binDir := c.MkDir()
+	os.Setenv("PATH", binDir)
+
+	exe := filepath.Join(c.MkDir(), "runhook")
+	err := ioutil.WriteFile(exe, []byte("a large executable"), 0755)
+	c.Assert(err, gc.IsNil)
+
+	// Without upx, the executable is left alone.
+	err = runUPX(exe)
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(exe)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "a large executable")
+
+	err = ioutil.WriteFile(filepath.Join(binDir, "upx"), []byte("#!/bin/sh\nfor f; do :; done\necho small > $f\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = runUPX(exe)
+	c.Assert(err, gc.IsNil)
+	data, err = ioutil.ReadFile(exe)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "small\n")
+
+	err = ioutil.WriteFile(filepath.Join(binDir, "upx"), []byte("#!/bin/sh\necho NotCompressibleException >&2\nexit 2\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = runUPX(exe)
+	c.Assert(err, gc.ErrorMatches, "NotCompressibleException: exit status 2")
+}
@@ -0,0 +1,259 @@
+package builder
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/yaml.v1"
+)
+
+// BuildConfigFile holds the name of the file in a charm's
+// package directory that configures how the charm is built.
+const BuildConfigFile = "gocharm.yaml"
+
+// BuildConfig holds the build configuration for a charm,
+// as read from its gocharm.yaml file. For example:
+//
+//	gopath:
+//	    - ../third_party
+//	tags: [netgo]
+//	ldflags: -X main.version=1.2
+//	go: "1.4"
+//	prebuild:
+//	    - protoc --go_out=. api.proto
+//	postbuild:
+//	    - make -C web OUT=$CHARM_DIR/assets
+type BuildConfig struct {
+	// GOPATH holds additional GOPATH entries to use when building
+	// the charm. Relative paths are interpreted relative to the
+	// charm's package directory; ReadBuildConfig makes them
+	// absolute. The entries are placed before those in $GOPATH, so
+	// packages found in them take precedence.
+	GOPATH []string `yaml:"gopath"`
+
+	// Tags holds build tags to use when building the charm.
+	Tags []string `yaml:"tags"`
+
+	// LDFlags holds flags to pass to the linker
+	// when building the runhook executable, for example
+	// "-X main.version=1.2".
+	LDFlags string `yaml:"ldflags"`
+
+	// Go holds the version of the Go toolchain to build
+	// the charm with, for example "1.4" or "1.4.2". If an
+	// executable named go$version (as installed by
+	// golang.org/dl) is found in $PATH, it is used; otherwise
+	// the go executable must be of a matching version.
+	Go string `yaml:"go"`
+
+	// PreBuild holds shell commands to run in the charm's
+	// package directory before the charm is built, for example
+	// to generate Go source. See runCommands.
+	PreBuild []string `yaml:"prebuild"`
+
+	// PostBuild holds shell commands to run in the charm's
+	// package directory after the charm has been built but
+	// before it is installed, for example to compile assets.
+	// $CHARM_DIR is set to the directory holding the built
+	// charm; only files that gocharm installs, such as those
+	// in $CHARM_DIR/assets and $CHARM_DIR/bin, are kept.
+	// See runCommands.
+	PostBuild []string `yaml:"postbuild"`
+
+	// gcflags holds flags to pass to the compiler. It
+	// cannot be set in gocharm.yaml; it is used for
+	// debugging builds.
+	gcflags string
+
+	// docker holds the Docker image to build the charm's
+	// executables in. It cannot be set in gocharm.yaml;
+	// see BuildCharmParams.Docker.
+	docker string
+
+	// cgo specifies that cgo should be enabled when
+	// building the charm's executables. It cannot be set
+	// in gocharm.yaml; see BuildCharmParams.Cgo.
+	cgo bool
+}
+
+var buildConfigFields = map[string]bool{
+	"gopath":    true,
+	"tags":      true,
+	"ldflags":   true,
+	"go":        true,
+	"prebuild":  true,
+	"postbuild": true,
+}
+
+var (
+	buildTagPattern  = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+	goVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)?((beta|rc)[0-9]+)?$`)
+)
+
+// ReadBuildConfig reads the build configuration from the
+// gocharm.yaml file in the given package directory and checks
+// that it is valid. If there is no such file, it returns
+// an empty configuration.
+func ReadBuildConfig(pkgDir string) (*BuildConfig, error) {
+	path := filepath.Join(pkgDir, BuildConfigFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &BuildConfig{}, nil
+		}
+		return nil, errgo.Mask(err)
+	}
+	// Check for unknown fields first, because they
+	// are most likely to be misspellings.
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, errgo.Notef(err, "cannot parse %s", path)
+	}
+	var unknown []string
+	for name := range fields {
+		if !buildConfigFields[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, errgo.Newf("unknown field(s) in %s: %s", path, strings.Join(unknown, ", "))
+	}
+	var cfg BuildConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errgo.Notef(err, "cannot parse %s", path)
+	}
+	if err := cfg.validate(pkgDir); err != nil {
+		return nil, errgo.Notef(err, "invalid %s", path)
+	}
+	return &cfg, nil
+}
+
+// validate checks that the configuration is valid,
+// making any relative GOPATH entries absolute.
+func (cfg *BuildConfig) validate(pkgDir string) error {
+	for i, dir := range cfg.GOPATH {
+		if dir == "" {
+			return errgo.New("empty GOPATH entry")
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(pkgDir, dir)
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return errgo.Notef(err, "bad GOPATH entry")
+		}
+		if !info.IsDir() {
+			return errgo.Newf("GOPATH entry %q is not a directory", dir)
+		}
+		cfg.GOPATH[i] = filepath.Clean(dir)
+	}
+	for _, tag := range cfg.Tags {
+		if !buildTagPattern.MatchString(tag) {
+			return errgo.Newf("invalid build tag %q", tag)
+		}
+	}
+	if cfg.Go != "" && !goVersionPattern.MatchString(cfg.Go) {
+		return errgo.Newf("invalid Go version %q", cfg.Go)
+	}
+	for _, cmds := range [][]string{cfg.PreBuild, cfg.PostBuild} {
+		for _, cmd := range cmds {
+			if strings.TrimSpace(cmd) == "" {
+				return errgo.New("empty build command")
+			}
+		}
+	}
+	return nil
+}
+
+// env returns the given environment with $GOPATH
+// changed to include the configured entries.
+func (cfg *BuildConfig) env(env []string) []string {
+	if len(cfg.GOPATH) == 0 {
+		return env
+	}
+	return setenv(env, "GOPATH="+cfg.gopath(os.Getenv("GOPATH")))
+}
+
+// gopath returns the configured GOPATH entries
+// followed by the entries in the given path.
+func (cfg *BuildConfig) gopath(path string) string {
+	entries := append([]string(nil), cfg.GOPATH...)
+	if path != "" {
+		entries = append(entries, path)
+	}
+	return strings.Join(entries, listSep)
+}
+
+// buildArgs returns the arguments to pass to go build
+// or go install to apply the configuration.
+func (cfg *BuildConfig) buildArgs() []string {
+	var args []string
+	if len(cfg.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(cfg.Tags, " "))
+	}
+	if cfg.LDFlags != "" {
+		args = append(args, "-ldflags", cfg.LDFlags)
+	}
+	if cfg.gcflags != "" {
+		args = append(args, "-gcflags", cfg.gcflags)
+	}
+	return args
+}
+
+// buildContext returns the build context to use
+// when importing the charm's packages.
+func (cfg *BuildConfig) buildContext() *build.Context {
+	ctxt := build.Default
+	ctxt.GOPATH = cfg.gopath(ctxt.GOPATH)
+	ctxt.BuildTags = append(ctxt.BuildTags, cfg.Tags...)
+	return &ctxt
+}
+
+// goTool returns the go executable to build
+// the charm with.
+func (cfg *BuildConfig) goTool() (string, error) {
+	if cfg.Go == "" {
+		return "go", nil
+	}
+	if path, err := exec.LookPath("go" + cfg.Go); err == nil {
+		return path, nil
+	}
+	version, err := goVersion("go")
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	if !versionMatches(version, cfg.Go) {
+		return "", errgo.Newf("Go toolchain version %s required but go%s not found in $PATH and go is version %s", cfg.Go, cfg.Go, version)
+	}
+	return "go", nil
+}
+
+// goVersion returns the version of the given go
+// executable, for example "1.4.2".
+func goVersion(goTool string) (string, error) {
+	out, err := exec.Command(goTool, "version").Output()
+	if err != nil {
+		return "", errgo.Notef(err, "cannot get Go version")
+	}
+	// The output looks like "go version go1.4.2 linux/amd64".
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return "", errgo.Newf("unexpected output from go version: %q", out)
+	}
+	return strings.TrimPrefix(fields[2], "go"), nil
+}
+
+// versionMatches reports whether the given Go version
+// satisfies the wanted version. A wanted version
+// without a patch number matches any patch release.
+func versionMatches(version, want string) bool {
+	return version == want || strings.HasPrefix(version, want+".")
+}
@@ -0,0 +1,170 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+var readBuildConfigTests = []struct {
+	about       string
+	config      string
+	expect      *BuildConfig
+	expectError string
+}{{
+	about:  "no config file",
+	expect: &BuildConfig{},
+}, {
+	about: "all fields",
+	config: `
+gopath:
+    - third_party
+    - /
+tags: [netgo, foo_bar]
+ldflags: -X main.version=1.2
+go: "1.4"
+prebuild: [go generate ./...]
+postbuild: [cp -r web $CHARM_DIR]
+`,
+	expect: &BuildConfig{
+		GOPATH:    []string{"$pkgdir/third_party", "/"},
+		Tags:      []string{"netgo", "foo_bar"},
+		LDFlags:   "-X main.version=1.2",
+		Go:        "1.4",
+		PreBuild:  []string{"go generate ./..."},
+		PostBuild: []string{"cp -r web $CHARM_DIR"},
+	},
+}, {
+	about:       "unknown fields",
+	config:      "tag: [x]\nldflag: foo\n",
+	expectError: `unknown field\(s\) in .*/gocharm.yaml: ldflag, tag`,
+}, {
+	about:       "nonexistent GOPATH entry",
+	config:      "gopath: [nowhere]\n",
+	expectError: `invalid .*/gocharm.yaml: bad GOPATH entry: .*`,
+}, {
+	about:       "GOPATH entry that is not a directory",
+	config:      "gopath: [gocharm.yaml]\n",
+	expectError: `invalid .*/gocharm.yaml: GOPATH entry ".*/gocharm.yaml" is not a directory`,
+}, {
+	about:       "invalid build tag",
+	config:      "tags: [\"a b\"]\n",
+	expectError: `invalid .*/gocharm.yaml: invalid build tag "a b"`,
+}, {
+	about:       "invalid Go version",
+	config:      "go: latest\n",
+	expectError: `invalid .*/gocharm.yaml: invalid Go version "latest"`,
+}, {
+	about:       "empty build command",
+	config:      "postbuild: [\"\"]\n",
+	expectError: `invalid .*/gocharm.yaml: empty build command`,
+}}
+
+func (suite) TestReadBuildConfig(c *gc.C) {
+	for i, test := range readBuildConfigTests {
+		c.Logf("test %d: %s", i, test.about)
+		dir := c.MkDir()
+		err := os.Mkdir(filepath.Join(dir, "third_party"), 0777)
+		c.Assert(err, gc.IsNil)
+		if test.config != "" {
+			err := ioutil.WriteFile(filepath.Join(dir, BuildConfigFile), []byte(test.config), 0666)
+			c.Assert(err, gc.IsNil)
+		}
+		cfg, err := ReadBuildConfig(dir)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		for i, p := range test.expect.GOPATH {
+			test.expect.GOPATH[i] = os.Expand(p, func(string) string { return dir })
+		}
+		c.Assert(cfg, jc.DeepEquals, test.expect)
+	}
+}
+
+func (suite) TestBuildConfigEnv(c *gc.C) {
+	restore := setGOPATH("/home/user/go")
+	defer restore()
+	cfg := &BuildConfig{
+		GOPATH: []string{"/a", "/b"},
+	}
+	env := cfg.env([]string{"GOPATH=/home/user/go", "HOME=/home/user"})
+	c.Assert(env, jc.DeepEquals, []string{
+		"GOPATH=/a" + listSep + "/b" + listSep + "/home/user/go",
+		"HOME=/home/user",
+	})
+	env = (&BuildConfig{}).env([]string{"HOME=/home/user"})
+	c.Assert(env, jc.DeepEquals, []string{"HOME=/home/user"})
+}
+
+func (suite) TestBuildArgs(c *gc.C) {
+	cfg := &BuildConfig{
+		Tags:    []string{"netgo", "foo"},
+		LDFlags: "-X main.version=1.2",
+		gcflags: debugGCFlags,
+	}
+	c.Assert(cfg.buildArgs(), jc.DeepEquals, []string{
+		"-tags", "netgo foo",
+		"-ldflags", "-X main.version=1.2",
+		"-gcflags", "all=-N -l",
+	})
+	c.Assert((&BuildConfig{}).buildArgs(), gc.HasLen, 0)
+}
+
+func (suite) TestCompileScript(c *gc.C) {
+	script := string(compileScript(&BuildConfig{
+		Tags:    []string{"netgo"},
+		LDFlags: "-X main.version=1.2",
+	}, "example.com/foo", nil))
+	c.Assert(strings.Contains(script, "\ngo install \"-tags\" \"netgo\" \"-ldflags\" \"-X main.version=1.2\"\n"), jc.IsTrue, gc.Commentf("script %q", script))
+	script = string(compileScript(&BuildConfig{}, "example.com/foo", nil))
+	c.Assert(strings.HasSuffix(script, "\ngo install\n"), jc.IsTrue, gc.Commentf("script %q", script))
+	script = string(compileScript(&BuildConfig{
+		Tags: []string{"netgo"},
+	}, "example.com/foo", []string{"agent", "cron"}))
+	c.Assert(script, gc.Equals, `#!/bin/sh
+set -e
+if test -z "$CHARM_DIR"; then
+	echo CHARM_DIR not set >&2
+	exit 2
+fi
+export PATH="$CHARM_DIR/bin:$PATH"
+cd "$CHARM_DIR/src/runhook"
+export GOPATH="$CHARM_DIR:$(godep path)"
+go install "-tags" "netgo"
+go install "-tags" "netgo" "example.com/foo/src/cmd/agent" "example.com/foo/src/cmd/cron"
+`)
+}
+
+var versionMatchesTests = []struct {
+	version string
+	want    string
+	expect  bool
+}{
+	{"1.4.2", "1.4", true},
+	{"1.4.2", "1.4.2", true},
+	{"1.4", "1.4", true},
+	{"1.4", "1.4.2", false},
+	{"1.5", "1.4", false},
+	{"1.40", "1.4", false},
+}
+
+func (suite) TestVersionMatches(c *gc.C) {
+	for i, test := range versionMatchesTests {
+		c.Logf("test %d: %s %s", i, test.version, test.want)
+		c.Assert(versionMatches(test.version, test.want), gc.Equals, test.expect)
+	}
+}
+
+func setGOPATH(path string) (restore func()) {
+	old := os.Getenv("GOPATH")
+	os.Setenv("GOPATH", path)
+	return func() {
+		os.Setenv("GOPATH", old)
+	}
+}
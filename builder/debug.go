@@ -0,0 +1,54 @@
+package builder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// debugGCFlags holds the compiler flags that disable
+// optimizations and inlining in all packages, so that
+// the runhook executable can be stepped through with
+// a debugger. The "all=" prefix requires Go 1.10 or later.
+const debugGCFlags = "all=-N -l"
+
+// debugScriptName holds the name of the helper script,
+// in the charm's bin directory, that runs a hook under delve.
+const debugScriptName = "debug-hook"
+
+// writeDebugScript writes the debug-hook script to binDir.
+func writeDebugScript(binDir string) error {
+	return ioutil.WriteFile(filepath.Join(binDir, debugScriptName), []byte(debugScript), 0755)
+}
+
+// debugScript is intended to be run from a juju debug-hooks
+// session, where the hook environment is already set up.
+// The delve server listens only on the unit's loopback
+// interface; it can be reached through an ssh tunnel.
+const debugScript = `#!/bin/sh
+# Generated by gocharm. Run this from a juju debug-hooks session
+# to run the current hook under a headless delve server, then
+# connect to it from another terminal with:
+#
+#	juju ssh $unit -N -L 2345:localhost:2345 &
+#	dlv connect localhost:2345
+#
+# The hook name defaults to $JUJU_HOOK_NAME; the port can
+# be changed by setting $DELVE_PORT.
+set -e
+hook="${1:-$JUJU_HOOK_NAME}"
+if test -z "$hook"; then
+	echo "usage: debug-hook hook-name" >&2
+	exit 2
+fi
+if test -z "$CHARM_DIR"; then
+	echo "CHARM_DIR not set; run debug-hook in a juju debug-hooks session" >&2
+	exit 2
+fi
+dlv="$(command -v dlv || true)"
+if test -z "$dlv"; then
+	echo "dlv not found in \$PATH; install delve on the unit first" >&2
+	exit 2
+fi
+echo "delve listening on localhost:${DELVE_PORT:-2345} for hook $hook" >&2
+exec "$dlv" exec --headless --api-version=2 --listen="localhost:${DELVE_PORT:-2345}" "$CHARM_DIR/bin/runhook" -- "$hook"
+`
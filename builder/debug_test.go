@@ -0,0 +1,41 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestDebugScript(c *gc.C) {
+	binDir := c.MkDir()
+	err := writeDebugScript(binDir)
+	c.Assert(err, gc.IsNil)
+	script := filepath.Join(binDir, debugScriptName)
+
+	pathDir := c.MkDir()
+	err = ioutil.WriteFile(filepath.Join(pathDir, "dlv"), []byte("#!/bin/sh\necho \"$@\"\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	run := func(env []string, args ...string) (string, error) {
+		cmd := exec.Command(script, args...)
+		cmd.Env = append([]string{"PATH=" + pathDir + ":" + os.Getenv("PATH")}, env...)
+		out, err := cmd.Output()
+		return string(out), err
+	}
+
+	out, err := run([]string{"CHARM_DIR=/charm", "JUJU_HOOK_NAME=install"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(out, gc.Equals, "exec --headless --api-version=2 --listen=localhost:2345 /charm/bin/runhook -- install\n")
+
+	out, err = run([]string{"CHARM_DIR=/charm", "DELVE_PORT=4000"}, "start")
+	c.Assert(err, gc.IsNil)
+	c.Assert(out, gc.Equals, "exec --headless --api-version=2 --listen=localhost:4000 /charm/bin/runhook -- start\n")
+
+	_, err = run([]string{"CHARM_DIR=/charm"})
+	c.Assert(err, gc.ErrorMatches, "exit status 2")
+
+	_, err = run(nil, "install")
+	c.Assert(err, gc.ErrorMatches, "exit status 2")
+}
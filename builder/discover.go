@@ -0,0 +1,295 @@
+package builder
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// registerHookMethods holds the names of the hook.Registry
+// methods that take a hook name as their first argument.
+var registerHookMethods = map[string]bool{
+	"RegisterHook":             true,
+	"RegisterHookWithPriority": true,
+}
+
+// staticHookNames returns the names of the hooks that the Go
+// package in the given directory registers by calling
+// RegisterHook or RegisterHookWithPriority with a literal hook name.
+// It does not run any code, so it finds hooks that are
+// only registered conditionally, but it cannot find hooks
+// registered with computed names or by other packages.
+func staticHookNames(dir string) ([]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	found := make(map[string]bool)
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || !registerHookMethods[sel.Sel.Name] {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			name, err := strconv.Unquote(lit.Value)
+			if err == nil && name != "*" {
+				found[name] = true
+			}
+			return true
+		})
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// mergeHookNames returns the hooks found by running RegisterHooks
+// combined with those found by staticHookNames.
+func mergeHookNames(registered, static []string) []string {
+	all := make(map[string]bool)
+	for _, name := range registered {
+		all[name] = true
+	}
+	names := append([]string(nil), registered...)
+	for _, name := range static {
+		if all[name] {
+			continue
+		}
+		if Verbose {
+			log.Printf("hook %s was not registered when inspected but is registered conditionally", name)
+		}
+		all[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// IgnoreFile holds the name of a file that lists directories to
+// skip when searching for charms. Each line holds a pattern in
+// the syntax of filepath.Match; blank lines and lines starting with
+// "#" are ignored. A pattern containing a slash is matched against
+// the slash-separated path of a directory relative to the one
+// holding the ignore file; other patterns are matched against the
+// name of any directory below it. A trailing slash is ignored.
+const IgnoreFile = ".gocharmignore"
+
+// DefaultMaxDepth holds the maximum depth, in directories below the
+// root, that FindCharms and List search when no other limit is given.
+const DefaultMaxDepth = 8
+
+// FindCharms returns the directories at or below root that hold Go
+// charms, in lexical order. A directory holds a Go charm if it
+// contains a metadata.yaml file and a Go package that defines a
+// RegisterHooks function. Directories starting with "." or "_",
+// and testdata and vendor directories, are not searched, following
+// the go tool's conventions; nor are directories deeper than
+// maxDepth below root (DefaultMaxDepth if it is zero) or those
+// matched by an ignore file (see IgnoreFile).
+func FindCharms(root string, maxDepth int) ([]string, error) {
+	var dirs []string
+	w := &dirWalker{
+		maxDepth: maxDepth,
+		skip: func(name string) bool {
+			return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor"
+		},
+		visit: func(dir string) error {
+			if _, err := os.Stat(filepath.Join(dir, "metadata.yaml")); err != nil {
+				if !os.IsNotExist(err) {
+					return errgo.Notef(err, "cannot check for metadata.yaml")
+				}
+				return nil
+			}
+			ok, err := HasRegisterHooks(dir)
+			if err != nil {
+				return errgo.Notef(err, "cannot parse %s", dir)
+			}
+			if ok {
+				dirs = append(dirs, dir)
+			}
+			return nil
+		},
+	}
+	if err := w.walk(root); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return dirs, nil
+}
+
+// dirWalker walks a directory tree in lexical order, honouring a
+// depth limit and any ignore files found on the way.
+type dirWalker struct {
+	// maxDepth holds the maximum depth below the root to
+	// search. If it is zero, DefaultMaxDepth is used.
+	maxDepth int
+
+	// skip reports whether a directory with the given
+	// name should not be searched.
+	skip func(name string) bool
+
+	// visit is called for each directory searched. If it returns
+	// filepath.SkipDir, the directory's contents are not searched.
+	visit func(dir string) error
+}
+
+// walk calls w.visit for root and each directory below it that
+// is not skipped.
+func (w *dirWalker) walk(root string) error {
+	if w.maxDepth <= 0 {
+		w.maxDepth = DefaultMaxDepth
+	}
+	return w.walkDir(root, 0, nil)
+}
+
+func (w *dirWalker) walkDir(dir string, depth int, ignores []ignorePattern) error {
+	if err := w.visit(dir); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	patterns, err := readIgnoreFile(dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	// Make sure that appending does not change
+	// the patterns seen by the caller.
+	ignores = append(ignores[:len(ignores):len(ignores)], patterns...)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	for _, info := range infos {
+		if !info.IsDir() || w.skip(info.Name()) {
+			continue
+		}
+		sub := filepath.Join(dir, info.Name())
+		if depth >= w.maxDepth {
+			if Verbose {
+				log.Printf("skipping %s: deeper than %d directories", sub, w.maxDepth)
+			}
+			continue
+		}
+		if p, ok := matchIgnore(ignores, sub); ok {
+			if Verbose {
+				log.Printf("skipping %s: matches %q in %s", sub, p.pattern, filepath.Join(p.dir, IgnoreFile))
+			}
+			continue
+		}
+		if err := w.walkDir(sub, depth+1, ignores); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignorePattern holds a pattern read from an ignore file.
+type ignorePattern struct {
+	// dir holds the directory containing the ignore file.
+	dir string
+
+	// pattern holds the pattern, with any trailing
+	// slash removed.
+	pattern string
+}
+
+// match reports whether the pattern matches the given directory.
+func (p ignorePattern) match(dir string) bool {
+	var name string
+	if strings.Contains(p.pattern, "/") {
+		rel, err := filepath.Rel(p.dir, dir)
+		if err != nil {
+			return false
+		}
+		name = filepath.ToSlash(rel)
+	} else {
+		name = filepath.Base(dir)
+	}
+	ok, _ := path.Match(p.pattern, name)
+	return ok
+}
+
+// matchIgnore returns the first of the given patterns that
+// matches dir, and reports whether there was one.
+func matchIgnore(ignores []ignorePattern, dir string) (ignorePattern, bool) {
+	for _, p := range ignores {
+		if p.match(dir) {
+			return p, true
+		}
+	}
+	return ignorePattern{}, false
+}
+
+// readIgnoreFile reads the patterns from the ignore file
+// in the given directory, if there is one.
+func readIgnoreFile(dir string) ([]ignorePattern, error) {
+	file := filepath.Join(dir, IgnoreFile)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errgo.Mask(err)
+	}
+	var patterns []ignorePattern
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSuffix(line, "/")
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, errgo.Newf("%s:%d: invalid pattern %q", file, i+1, line)
+		}
+		patterns = append(patterns, ignorePattern{
+			dir:     dir,
+			pattern: line,
+		})
+	}
+	return patterns, nil
+}
+
+// HasRegisterHooks reports whether the Go package in the given
+// directory defines a top level RegisterHooks function.
+func HasRegisterHooks(dir string) (bool, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "RegisterHooks" {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,134 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+const discoverSource = `package foo
+
+import (
+	"os"
+
+	"github.com/juju/gocharm/hook"
+)
+
+func RegisterHooks(r *hook.Registry) {
+	r.RegisterHook("install", nil)
+	r.RegisterHook("*", nil)
+	if os.Getenv("FOO") != "" {
+		r.RegisterHookWithPriority("config-changed", 1, nil)
+	}
+	name := "start"
+	r.RegisterHook(name, nil)
+	r.RegisterHook("install", nil)
+}
+`
+
+const discoverTestSource = `package foo
+
+func init() {
+	r.RegisterHook("stop", nil)
+}
+`
+
+func (suite) TestStaticHookNames(c *gc.C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), []byte(discoverSource), 0666)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "foo_test.go"), []byte(discoverTestSource), 0666)
+	c.Assert(err, gc.IsNil)
+	names, err := staticHookNames(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(names, jc.DeepEquals, []string{"config-changed", "install"})
+}
+
+func (suite) TestMergeHookNames(c *gc.C) {
+	names := mergeHookNames([]string{"start", "install"}, []string{"config-changed", "install"})
+	c.Assert(names, jc.DeepEquals, []string{"start", "install", "config-changed"})
+}
+
+func (suite) TestSandboxEnv(c *gc.C) {
+	env := sandboxEnv([]string{
+		"PATH=/usr/bin",
+		"HOME=/home/user",
+		"JUJU_UNIT_NAME=foo/0",
+		"JUJU_AGENT_SOCKET=/var/lib/juju/agent.socket",
+	}, "/tmp/sandbox")
+	c.Assert(env, jc.DeepEquals, []string{
+		"PATH=/usr/bin",
+		"HOME=/tmp/sandbox",
+		"TMPDIR=/tmp/sandbox",
+	})
+}
+
+func (suite) TestFindCharms(c *gc.C) {
+	root := c.MkDir()
+	write := func(path, data string) {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(path, []byte(data), 0666)
+		c.Assert(err, gc.IsNil)
+	}
+	write("a/metadata.yaml", "name: a\n")
+	write("a/a.go", discoverSource)
+	write("a/b/metadata.yaml", "name: b\n")
+	write("a/b/b.go", discoverSource)
+	// No metadata.yaml.
+	write("c/c.go", discoverSource)
+	// No RegisterHooks function.
+	write("d/metadata.yaml", "name: d\n")
+	write("d/d.go", "package d\n")
+	// Directories ignored by the go tool.
+	write("_e/metadata.yaml", "name: e\n")
+	write("_e/e.go", discoverSource)
+	write("a/testdata/metadata.yaml", "name: f\n")
+	write("a/testdata/f.go", discoverSource)
+
+	dirs, err := FindCharms(root, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dirs, jc.DeepEquals, []string{
+		filepath.Join(root, "a"),
+		filepath.Join(root, "a", "b"),
+	})
+}
+
+func (suite) TestFindCharmsIgnoreAndDepth(c *gc.C) {
+	root := c.MkDir()
+	files := map[string]string{
+		".gocharmignore":        "# Large trees holding no charms.\nthird_party/\n\nteam/old*\n",
+		"team/x/.gocharmignore": "broken\n",
+	}
+	for _, dir := range []string{
+		"team/a",
+		"team/x/y/deep",
+		"team/x/y/z/deeper",
+		"team/old-charm",
+		"third_party/c",
+		"vendor/d",
+		"team/x/broken",
+		"other/team/old",
+	} {
+		files[dir+"/metadata.yaml"] = "name: x\n"
+		files[dir+"/charm.go"] = discoverSource
+	}
+	writeFiles(c, root, files)
+
+	dirs, err := FindCharms(root, 4)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dirs, jc.DeepEquals, []string{
+		filepath.Join(root, "other", "team", "old"),
+		filepath.Join(root, "team", "a"),
+		filepath.Join(root, "team", "x", "y", "deep"),
+	})
+
+	err = ioutil.WriteFile(filepath.Join(root, ".gocharmignore"), []byte("[\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	_, err = FindCharms(root, 0)
+	c.Assert(err, gc.ErrorMatches, `.*/.gocharmignore:1: invalid pattern "\["`)
+}
@@ -0,0 +1,84 @@
+package builder
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// containerGoCache holds the directory in the container used
+// for the go tool's build cache, which is discarded with the
+// container.
+const containerGoCache = "/tmp/go-cache"
+
+// dockerBuild runs go build in a new container created from the
+// given Docker image to build target into exeFile with the given
+// build environment. The image provides the Go toolchain, so pinning
+// its tag pins the toolchain. See dockerRunArgs for how the
+// container is set up.
+func dockerBuild(image, exeFile, target string, benv *buildEnv, cfg *BuildConfig) error {
+	if err := os.MkdirAll(filepath.Dir(exeFile), 0777); err != nil {
+		return errgo.Mask(err)
+	}
+	user := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	// The GOPATH must be explicit, because it is mounted into
+	// the container, and the build cache on the host cannot
+	// be used.
+	denv := *benv
+	denv.gopath = strings.Join(filepath.SplitList(cfg.buildContext().GOPATH), ":")
+	denv.gocache = containerGoCache
+	if Verbose {
+		log.Printf("build environment in %s: %s", image, &denv)
+	}
+	args := dockerRunArgs(image, user, exeFile, target, &denv, cfg.buildArgs())
+	if err := runCmd("", nil, "docker", args...).Run(); err != nil {
+		if isExecNotFound(err) {
+			return errgo.New("docker executable not found")
+		}
+		return errgo.Notef(err, "failed to build in Docker image %q", image)
+	}
+	return nil
+}
+
+// dockerRunArgs returns the arguments to docker that run go build,
+// with the given build arguments and environment, in a container
+// created from image as the given user. Each entry in the
+// environment's GOPATH, and the directory holding target if it is a
+// Go file, is mounted read-only at the same path in the container;
+// only the directory holding exeFile is writable. The container has
+// no network access, so everything needed for the build must be in
+// the GOPATH. Because the container is linux/amd64, cgo works
+// whatever the host.
+func dockerRunArgs(image, user, exeFile, target string, env *buildEnv, buildArgs []string) []string {
+	outDir := filepath.Dir(exeFile)
+	args := []string{
+		"run", "--rm", "--net=none",
+		"-u", user,
+	}
+	for _, dir := range strings.Split(env.gopath, ":") {
+		args = append(args, "-v", dir+":"+dir+":ro")
+	}
+	if strings.HasSuffix(target, ".go") {
+		dir := filepath.Dir(target)
+		args = append(args, "-v", dir+":"+dir+":ro")
+	}
+	args = append(args,
+		"-v", outDir+":"+outDir,
+		"-w", outDir,
+	)
+	for _, v := range env.vars() {
+		args = append(args, "-e", v)
+	}
+	args = append(args,
+		"-e", "GO111MODULE=off",
+		"-e", "HOME=/tmp",
+		image,
+		"go", "build", "-o", exeFile,
+	)
+	args = append(args, buildArgs...)
+	return append(args, target)
+}
@@ -0,0 +1,52 @@
+package builder
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestDockerRunArgs(c *gc.C) {
+	args := dockerRunArgs(
+		"golang:1.4.2",
+		"1000:1000",
+		"/tmp/gocharm123/charm/bin/runhook",
+		"/tmp/gocharm123/charm/src/runhook/runhook.go",
+		&buildEnv{
+			goos:       "linux",
+			goarch:     "amd64",
+			cgoEnabled: "1",
+			gocache:    containerGoCache,
+			gopath:     "/home/user/third_party:/home/user/go",
+		},
+		[]string{"-tags", "netgo"},
+	)
+	c.Assert(args, jc.DeepEquals, []string{
+		"run", "--rm", "--net=none",
+		"-u", "1000:1000",
+		"-v", "/home/user/third_party:/home/user/third_party:ro",
+		"-v", "/home/user/go:/home/user/go:ro",
+		"-v", "/tmp/gocharm123/charm/src/runhook:/tmp/gocharm123/charm/src/runhook:ro",
+		"-v", "/tmp/gocharm123/charm/bin:/tmp/gocharm123/charm/bin",
+		"-w", "/tmp/gocharm123/charm/bin",
+		"-e", "GOOS=linux",
+		"-e", "GOARCH=amd64",
+		"-e", "CGO_ENABLED=1",
+		"-e", "GOCACHE=/tmp/go-cache",
+		"-e", "GOPATH=/home/user/third_party:/home/user/go",
+		"-e", "GO111MODULE=off",
+		"-e", "HOME=/tmp",
+		"golang:1.4.2",
+		"go", "build", "-o", "/tmp/gocharm123/charm/bin/runhook", "-tags", "netgo",
+		"/tmp/gocharm123/charm/src/runhook/runhook.go",
+	})
+
+	// An import path is not mounted.
+	args = dockerRunArgs("golang:1.4.2", "0:0", "/out/bin/tool", "example.com/charm/cmd/tool", &buildEnv{gopath: "/go"}, nil)
+	c.Assert(args[len(args)-5:], jc.DeepEquals, []string{
+		"go", "build", "-o", "/out/bin/tool", "example.com/charm/cmd/tool",
+	})
+	c.Assert(args[5:9], jc.DeepEquals, []string{
+		"-v", "/go:/go:ro",
+		"-v", "/out/bin:/out/bin",
+	})
+}
@@ -0,0 +1,312 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// minGoVersion holds the oldest Go version that can build charms.
+// Earlier versions do not support the -X name=value linker
+// flag syntax used to stamp build information.
+const minGoVersion = "1.5"
+
+// Diagnosis describes a problem with the environment
+// found by Doctor.
+type Diagnosis struct {
+	// Check holds a short description of what was checked,
+	// for example "Go toolchain".
+	Check string
+
+	// Problem describes the problem.
+	Problem string
+
+	// Fix holds a suggestion for fixing the problem.
+	Fix string
+}
+
+// String returns the diagnosis formatted for printing.
+func (d Diagnosis) String() string {
+	s := d.Check + ": " + d.Problem
+	if d.Fix != "" {
+		s += "\n\tfix: " + d.Fix
+	}
+	return s
+}
+
+// DoctorParams holds the parameters for Doctor.
+type DoctorParams struct {
+	// GoTool holds the go executable to check.
+	// If it is empty, "go" is used.
+	GoTool string
+
+	// GOPATH holds the value of $GOPATH.
+	GOPATH string
+
+	// Repo holds the charm repository directory
+	// ($JUJU_REPOSITORY). It may be empty.
+	Repo string
+
+	// Dir holds the current directory.
+	Dir string
+}
+
+// Doctor checks that the local environment can be used to build
+// charms, and returns any problems found. It checks that the Go
+// toolchain is present, recent enough, and able to build executables
+// for linux/amd64; that $GOPATH is set to existing, writable directories
+// that hold no packages compiled by an older toolchain; and that the
+// charm repository exists, is writable and has the expected layout.
+func Doctor(p DoctorParams) []Diagnosis {
+	d := &doctor{
+		params: p,
+	}
+	if d.params.GoTool == "" {
+		d.params.GoTool = "go"
+	}
+	if d.checkGo() {
+		d.checkCrossCompile()
+	}
+	d.checkGOPATH()
+	d.checkRepo()
+	return d.problems
+}
+
+type doctor struct {
+	params   DoctorParams
+	problems []Diagnosis
+}
+
+func (d *doctor) addf(check, fix string, f string, a ...interface{}) {
+	d.problems = append(d.problems, Diagnosis{
+		Check:   check,
+		Problem: fmt.Sprintf(f, a...),
+		Fix:     fix,
+	})
+}
+
+// checkGo checks the Go toolchain and reports
+// whether it can be used.
+func (d *doctor) checkGo() bool {
+	const check = "Go toolchain"
+	if _, err := exec.LookPath(d.params.GoTool); err != nil {
+		d.addf(check, "install Go from https://golang.org/dl/ and make sure its bin directory is in $PATH", "%s not found in $PATH", d.params.GoTool)
+		return false
+	}
+	version, err := goVersion(d.params.GoTool)
+	if err != nil {
+		d.addf(check, "check that your Go installation is complete", "%v", err)
+		return false
+	}
+	if strings.HasPrefix(version, "devel") {
+		return true
+	}
+	if !versionAtLeast(version, minGoVersion) {
+		d.addf(check, "install a newer version of Go from https://golang.org/dl/", "Go version %s is too old; at least %s is required", version, minGoVersion)
+		return false
+	}
+	return true
+}
+
+// checkCrossCompile checks that the Go toolchain
+// can build executables for linux/amd64, as
+// required by Juju units.
+func (d *doctor) checkCrossCompile() {
+	const check = "cross-compilation"
+	dir, err := ioutil.TempDir("", "gocharm-doctor")
+	if err != nil {
+		d.addf(check, "", "cannot make temporary directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	goFile := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(goFile, []byte("package main\nfunc main() {}\n"), 0666); err != nil {
+		d.addf(check, "", "cannot write test program: %v", err)
+		return
+	}
+	c := exec.Command(d.params.GoTool, "build", "-o", filepath.Join(dir, "main"), goFile)
+	c.Dir = dir
+	benv := &buildEnv{
+		goos:       "linux",
+		goarch:     "amd64",
+		cgoEnabled: "0",
+	}
+	c.Env = benv.apply(os.Environ())
+	if out, err := c.CombinedOutput(); err != nil {
+		d.addf(check, "make sure that the Go standard library can be built for linux/amd64, for example by installing Go from a binary distribution", "cannot build for linux/amd64: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+}
+
+// checkGOPATH checks that all $GOPATH entries exist
+// and are writable, that the current directory is inside
+// $GOPATH, and that there are no stale compiled packages.
+func (d *doctor) checkGOPATH() {
+	const check = "GOPATH"
+	if d.params.GOPATH == "" {
+		d.addf(check, "set $GOPATH, for example: export GOPATH=$HOME/go", "$GOPATH is not set")
+		return
+	}
+	insideGOPATH := false
+	toolTime, toolTimeErr := goToolTime(d.params.GoTool)
+	for i, entry := range filepath.SplitList(d.params.GOPATH) {
+		if !filepath.IsAbs(entry) {
+			d.addf(check, "use only absolute paths in $GOPATH", "$GOPATH entry %q is not absolute", entry)
+			continue
+		}
+		info, err := os.Stat(entry)
+		if err != nil || !info.IsDir() {
+			d.addf(check, fmt.Sprintf("create it with: mkdir -p %s/src", entry), "$GOPATH entry %q is not a directory", entry)
+			continue
+		}
+		if i == 0 {
+			// The go tool installs packages into the
+			// first GOPATH entry.
+			if err := checkWritable(entry); err != nil {
+				d.addf(check, fmt.Sprintf("make %s writable by you", entry), "cannot write to %s: %v", entry, err)
+			}
+		}
+		if d.params.Dir != "" && isSubdir(d.params.Dir, filepath.Join(entry, "src")) {
+			insideGOPATH = true
+		}
+		if toolTimeErr == nil {
+			if stale := staleArchives(filepath.Join(entry, "pkg"), toolTime); len(stale) > 0 {
+				d.addf(check, fmt.Sprintf("remove the compiled packages with: rm -r %s", filepath.Join(entry, "pkg")), "%d compiled package(s) in %s are older than the Go toolchain, for example %s", len(stale), filepath.Join(entry, "pkg"), stale[0])
+			}
+		}
+	}
+	if d.params.Dir != "" && !insideGOPATH {
+		d.addf(check, "move your charm source under $GOPATH/src or add its workspace to $GOPATH", "current directory %s is not inside a $GOPATH src directory", d.params.Dir)
+	}
+}
+
+// checkRepo checks the charm repository.
+func (d *doctor) checkRepo() {
+	const check = "charm repository"
+	repo := d.params.Repo
+	if repo == "" {
+		d.addf(check, "set $JUJU_REPOSITORY, for example: export JUJU_REPOSITORY=$HOME/charms", "$JUJU_REPOSITORY is not set")
+		return
+	}
+	info, err := os.Stat(repo)
+	if err != nil || !info.IsDir() {
+		d.addf(check, fmt.Sprintf("create it with: mkdir -p %s", repo), "%s is not a directory", repo)
+		return
+	}
+	if err := checkWritable(repo); err != nil {
+		d.addf(check, fmt.Sprintf("make %s writable by you", repo), "cannot write to %s: %v", repo, err)
+	}
+	infos, err := ioutil.ReadDir(repo)
+	if err != nil {
+		d.addf(check, "", "cannot read %s: %v", repo, err)
+		return
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() || name == "bundle" || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(repo, name, "metadata.yaml")); err == nil {
+			d.addf(check, fmt.Sprintf("move it to %s", filepath.Join(repo, "$series", name)), "charm %s is not inside a series directory", filepath.Join(repo, name))
+		}
+	}
+}
+
+// checkWritable checks that a file can be
+// created in the given directory.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".gocharm-doctor")
+	if err != nil {
+		return err
+	}
+	closeErr := f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// isSubdir reports whether dir is inside (or the same as) parent.
+func isSubdir(dir, parent string) bool {
+	rel, err := filepath.Rel(parent, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// goToolTime returns the modification time of the given
+// go executable, which is taken as the time that the
+// toolchain was installed.
+func goToolTime(goTool string) (t int64, err error) {
+	path, err := exec.LookPath(goTool)
+	if err != nil {
+		return 0, err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.ModTime().UnixNano(), nil
+}
+
+// staleArchives returns the compiled package archives under
+// pkgDir that were modified before the given time. Such archives
+// may have been built by an earlier Go version, which causes
+// obscure build failures.
+func staleArchives(pkgDir string, before int64) []string {
+	var stale []string
+	filepath.Walk(pkgDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && path == filepath.Join(pkgDir, "mod") {
+			// The module cache holds source, not archives.
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".a") && info.ModTime().UnixNano() < before {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	return stale
+}
+
+// versionAtLeast reports whether the given Go
+// version is the same as or later than min.
+func versionAtLeast(version, min string) bool {
+	v, m := versionParts(version), versionParts(min)
+	for i := range m {
+		if i >= len(v) {
+			return false
+		}
+		if v[i] != m[i] {
+			return v[i] > m[i]
+		}
+	}
+	return true
+}
+
+// versionParts returns the numeric parts of the given
+// version. Any suffix such as "beta1" is ignored.
+func versionParts(version string) []int {
+	var parts []int
+	for _, s := range strings.Split(version, ".") {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		n, err := strconv.Atoi(s[0:i])
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+		if i < len(s) {
+			break
+		}
+	}
+	return parts
+}
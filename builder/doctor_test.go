@@ -0,0 +1,154 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// fakeGo returns the path of a fake go executable
+// that reports the given version and whose build
+// command exits with the given status.
+func fakeGo(c *gc.C, version string, buildStatus int) string {
+	path := filepath.Join(c.MkDir(), "go")
+	script := `#!/bin/sh
+case $1 in
+version)
+	echo go version go` + version + ` linux/amd64;;
+build)
+	echo build failed >&2
+	exit ` + strconv.Itoa(buildStatus) + `;;
+esac
+`
+	err := ioutil.WriteFile(path, []byte(script), 0755)
+	c.Assert(err, gc.IsNil)
+	return path
+}
+
+// doctorEnv returns parameters for Doctor that
+// describe a healthy environment.
+func doctorEnv(c *gc.C) DoctorParams {
+	gopath := c.MkDir()
+	dir := filepath.Join(gopath, "src", "example.com", "mycharm")
+	err := os.MkdirAll(dir, 0777)
+	c.Assert(err, gc.IsNil)
+	repo := c.MkDir()
+	err = os.MkdirAll(filepath.Join(repo, "trusty", "mycharm"), 0777)
+	c.Assert(err, gc.IsNil)
+	err = os.Mkdir(filepath.Join(repo, "bundle"), 0777)
+	c.Assert(err, gc.IsNil)
+	return DoctorParams{
+		GoTool: fakeGo(c, "1.5.1", 0),
+		GOPATH: gopath,
+		Repo:   repo,
+		Dir:    dir,
+	}
+}
+
+func (suite) TestDoctorOK(c *gc.C) {
+	c.Assert(Doctor(doctorEnv(c)), gc.HasLen, 0)
+}
+
+func (suite) TestDoctorGoProblems(c *gc.C) {
+	p := doctorEnv(c)
+	p.GoTool = filepath.Join(c.MkDir(), "go")
+	problems := Doctor(p)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Check, gc.Equals, "Go toolchain")
+	c.Assert(problems[0].Problem, gc.Matches, ".*/go not found in \\$PATH")
+
+	p.GoTool = fakeGo(c, "1.4.2", 0)
+	problems = Doctor(p)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Problem, gc.Equals, "Go version 1.4.2 is too old; at least 1.5 is required")
+
+	p.GoTool = fakeGo(c, "1.6", 1)
+	problems = Doctor(p)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Check, gc.Equals, "cross-compilation")
+	c.Assert(problems[0].Problem, gc.Equals, "cannot build for linux/amd64: exit status 1: build failed")
+}
+
+func (suite) TestDoctorGOPATHProblems(c *gc.C) {
+	p := doctorEnv(c)
+	gopath := p.GOPATH
+	p.GOPATH = ""
+	problems := Doctor(p)
+	c.Assert(problems, jc.DeepEquals, []Diagnosis{{
+		Check:   "GOPATH",
+		Problem: "$GOPATH is not set",
+		Fix:     "set $GOPATH, for example: export GOPATH=$HOME/go",
+	}})
+
+	p.GOPATH = "relative" + listSep + filepath.Join(gopath, "nowhere")
+	problems = Doctor(p)
+	c.Assert(problems, gc.HasLen, 3)
+	c.Assert(problems[0].Problem, gc.Equals, `$GOPATH entry "relative" is not absolute`)
+	c.Assert(problems[1].Problem, gc.Equals, `$GOPATH entry "`+gopath+`/nowhere" is not a directory`)
+	c.Assert(problems[2].Problem, gc.Equals, "current directory "+p.Dir+" is not inside a $GOPATH src directory")
+
+	// Old archives are reported as stale.
+	p.GOPATH = gopath
+	archive := filepath.Join(gopath, "pkg", "linux_amd64", "example.com", "lib.a")
+	err := os.MkdirAll(filepath.Dir(archive), 0777)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(archive, nil, 0666)
+	c.Assert(err, gc.IsNil)
+	c.Assert(Doctor(p), gc.HasLen, 0)
+	old := time.Now().Add(-time.Hour)
+	err = os.Chtimes(archive, old, old)
+	c.Assert(err, gc.IsNil)
+	problems = Doctor(p)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Problem, gc.Equals, "1 compiled package(s) in "+gopath+"/pkg are older than the Go toolchain, for example "+archive)
+	c.Assert(problems[0].Fix, gc.Equals, "remove the compiled packages with: rm -r "+gopath+"/pkg")
+}
+
+func (suite) TestDoctorRepoProblems(c *gc.C) {
+	p := doctorEnv(c)
+	repo := p.Repo
+	p.Repo = ""
+	problems := Doctor(p)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Problem, gc.Equals, "$JUJU_REPOSITORY is not set")
+
+	p.Repo = filepath.Join(repo, "nowhere")
+	problems = Doctor(p)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].String(), gc.Equals, "charm repository: "+p.Repo+" is not a directory\n\tfix: create it with: mkdir -p "+p.Repo)
+
+	p.Repo = repo
+	err := os.Mkdir(filepath.Join(repo, "mycharm"), 0777)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(repo, "mycharm", "metadata.yaml"), nil, 0666)
+	c.Assert(err, gc.IsNil)
+	problems = Doctor(p)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Problem, gc.Equals, "charm "+repo+"/mycharm is not inside a series directory")
+}
+
+var versionAtLeastTests = []struct {
+	version string
+	min     string
+	expect  bool
+}{
+	{"1.5", "1.5", true},
+	{"1.5.1", "1.5", true},
+	{"1.10", "1.5", true},
+	{"1.4.2", "1.5", false},
+	{"1.5beta1", "1.5", true},
+	{"1", "1.5", false},
+	{"2.0", "1.5", true},
+}
+
+func (suite) TestVersionAtLeast(c *gc.C) {
+	for i, test := range versionAtLeastTests {
+		c.Logf("test %d: %s %s", i, test.version, test.min)
+		c.Assert(versionAtLeast(test.version, test.min), gc.Equals, test.expect)
+	}
+}
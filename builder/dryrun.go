@@ -0,0 +1,133 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+)
+
+// dryRunPlan returns a description of what Install would do to
+// install the charm built in newCharmDir, with its hooks already
+// merged by mergeHooks into the given manifest, into the charm
+// directory dest. The package the charm was built from is in
+// pkgDir, the charm revision found in dest is oldRev, the charm
+// will be given revision newRev, and the
+// charm's executables, other than runhook, are named by binaries.
+// Each line of the plan describes one action.
+func dryRunPlan(dest, newCharmDir, pkgDir string, manifest *hookManifest, oldRev, newRev int, binaries []string, source bool) ([]string, error) {
+	var plan []string
+	add := func(f string, a ...interface{}) {
+		plan = append(plan, fmt.Sprintf(f, a...))
+	}
+	switch {
+	case newRev == -1:
+		add("no revision file; revision would not be bumped")
+	case newRev == oldRev:
+		add("revision %d unchanged", newRev)
+	case newRev == oldRev+1:
+		add("would bump revision from %d to %d", oldRev, newRev)
+	default:
+		add("would set revision to %d", newRev)
+	}
+	newHooks, err := hookNames(filepath.Join(newCharmDir, "hooks"))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	oldHooks, err := hookNames(filepath.Join(dest, "hooks"))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for _, name := range newHooks {
+		if _, ok := manifest.Hooks[name]; !ok {
+			add("would keep modified hook %s", name)
+			continue
+		}
+		newData, err := hookData(filepath.Join(newCharmDir, "hooks", name))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		oldData, err := hookData(filepath.Join(dest, "hooks", name))
+		switch {
+		case os.IsNotExist(err):
+			add("would generate hook %s", name)
+		case err != nil:
+			return nil, errgo.Mask(err)
+		case bytes.Equal(oldData, newData):
+			add("hook %s unchanged", name)
+		default:
+			add("would regenerate hook %s", name)
+		}
+	}
+	for _, name := range oldHooks {
+		if !containsString(newHooks, name) {
+			add("would remove hook %s", name)
+		}
+	}
+	if source {
+		add("would include source to be compiled on the unit")
+		return plan, nil
+	}
+	stale := ""
+	if m, err := readHookManifest(dest); err != nil {
+		return nil, errgo.Mask(err)
+	} else if m != nil && !m.BuildTime.IsZero() {
+		newest, err := newestFile(pkgDir)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		stale = "source unchanged since last build"
+		if newest.After(m.BuildTime) {
+			stale = "source changed since last build"
+		}
+	}
+	for _, name := range append([]string{"runhook"}, binaries...) {
+		switch {
+		case !exists(filepath.Join(dest, "bin", name)):
+			add("would build bin/%s", name)
+		case stale != "":
+			add("would rebuild bin/%s (%s)", name, stale)
+		default:
+			add("would rebuild bin/%s", name)
+		}
+	}
+	return plan, nil
+}
+
+// hookNames returns the sorted names of the entries in
+// the given hooks directory, which need not exist.
+func hookNames(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errgo.Mask(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hookData returns the contents of the given hook or,
+// if it is a symbolic link (as written with Dispatch),
+// a description of its target, so that links can be
+// compared without following them.
+func hookData(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return ioutil.ReadFile(path)
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("-> " + target), nil
+}
@@ -0,0 +1,103 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestDryRunPlan(c *gc.C) {
+	pkgDir := c.MkDir()
+	writeFiles(c, pkgDir, map[string]string{
+		"charm.go": "package charm",
+	})
+	dest := c.MkDir()
+	writeFiles(c, dest, map[string]string{
+		"bin/runhook":          "old runhook",
+		"hooks/install":        "install stub",
+		"hooks/start":          "old start stub",
+		"hooks/stop":           "stop stub",
+		"hooks/config-changed": "edited stub",
+	})
+	buildTime := time.Now().Add(-time.Hour)
+	err := (&hookManifest{
+		Hooks:     map[string]string{},
+		Dir:       pkgDir,
+		BuildTime: buildTime,
+	}).write(dest)
+	c.Assert(err, gc.IsNil)
+	err = os.Chtimes(filepath.Join(pkgDir, "charm.go"), buildTime.Add(-time.Hour), buildTime.Add(-time.Hour))
+	c.Assert(err, gc.IsNil)
+
+	newCharmDir := c.MkDir()
+	writeFiles(c, newCharmDir, map[string]string{
+		"bin/runhook":          "new runhook",
+		"bin/agent":            "agent",
+		"hooks/install":        "install stub",
+		"hooks/start":          "new start stub",
+		"hooks/config-changed": "edited stub",
+		"hooks/upgrade-charm":  "upgrade-charm stub",
+	})
+	// The config-changed hook has been kept by mergeHooks,
+	// so it is not in the manifest.
+	manifest := &hookManifest{
+		Hooks: map[string]string{
+			"install":       "x",
+			"start":         "x",
+			"upgrade-charm": "x",
+		},
+	}
+	plan, err := dryRunPlan(dest, newCharmDir, pkgDir, manifest, 3, 4, []string{"agent"}, false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(plan, jc.DeepEquals, []string{
+		"would bump revision from 3 to 4",
+		"would keep modified hook config-changed",
+		"hook install unchanged",
+		"would regenerate hook start",
+		"would generate hook upgrade-charm",
+		"would remove hook stop",
+		"would rebuild bin/runhook (source unchanged since last build)",
+		"would build bin/agent",
+	})
+
+	// Once the source changes, that is reported.
+	writeFiles(c, pkgDir, map[string]string{
+		"charm.go": "package charm // changed",
+	})
+	plan, err = dryRunPlan(dest, newCharmDir, pkgDir, manifest, -1, -1, nil, false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(plan[0], gc.Equals, "no revision file; revision would not be bumped")
+	c.Assert(plan[len(plan)-1], gc.Equals, "would rebuild bin/runhook (source changed since last build)")
+
+	plan, err = dryRunPlan(dest, newCharmDir, pkgDir, manifest, -1, 7, nil, true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(plan[0], gc.Equals, "would set revision to 7")
+	c.Assert(plan[len(plan)-1], gc.Equals, "would include source to be compiled on the unit")
+}
+
+func (suite) TestDryRunPlanDispatch(c *gc.C) {
+	dest := c.MkDir()
+	newCharmDir := c.MkDir()
+	for _, dir := range []string{dest, newCharmDir} {
+		writeFiles(c, dir, map[string]string{
+			"bin/runhook": dir,
+		})
+		err := os.MkdirAll(filepath.Join(dir, "hooks"), 0777)
+		c.Assert(err, gc.IsNil)
+		err = os.Symlink(filepath.Join("..", "bin", "runhook"), filepath.Join(dir, "hooks", "install"))
+		c.Assert(err, gc.IsNil)
+	}
+	manifest := &hookManifest{
+		Hooks: map[string]string{"install": "x"},
+	}
+	plan, err := dryRunPlan(dest, newCharmDir, c.MkDir(), manifest, -1, -1, nil, false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(plan, jc.DeepEquals, []string{
+		"no revision file; revision would not be bumped",
+		"hook install unchanged",
+		"would rebuild bin/runhook",
+	})
+}
@@ -0,0 +1,210 @@
+package builder
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/errgo.v1"
+)
+
+// StubOptions holds the options that affect the generated
+// hook stubs. They correspond to gocharm's flags of the
+// same names.
+type StubOptions struct {
+	// Source specifies that the charm includes its
+	// source and is compiled on the unit.
+	Source bool
+
+	// Checksum specifies that the stub verifies the
+	// runhook executable's checksum before running it.
+	Checksum bool
+}
+
+// GenerateHookStub returns the contents of the hook stub that
+// gocharm writes to hooks/$hookName, customized as specified by
+// stub. It has no side effects, so it can be used to compare the
+// generated stubs against golden files.
+func GenerateHookStub(hookName string, stub HookStub, opts StubOptions) []byte {
+	p := hookStubParams{
+		Source:      opts.Source,
+		Checksum:    opts.Checksum,
+		HookName:    hookName,
+		GodepPath:   godepPath,
+		Interpreter: stub.Interpreter,
+		Setup:       stub.Setup,
+	}
+	if p.Interpreter == "" {
+		p.Interpreter = "/bin/sh"
+	}
+	for key, val := range stub.Env {
+		p.Env = append(p.Env, key+"="+shellQuote(val))
+	}
+	sort.Strings(p.Env)
+	if stub.Dir != "" {
+		dir := stub.Dir
+		if !filepath.IsAbs(dir) {
+			dir = "$CHARM_DIR/" + dir
+		}
+		p.Dir = shellQuote(dir)
+	}
+	return executeTemplate(hookStubTemplate, p)
+}
+
+// GenerateMain returns the source of the runhook main package
+// that gocharm writes to src/runhook/runhook.go for the charm
+// package with the given import path.
+func GenerateMain(charmPackage string) []byte {
+	return generateCode(hookMainCode, charmPackage)
+}
+
+// MainTemplateFile holds the path, relative to the charm package
+// directory, of the template that can be provided to customize the
+// generated runhook main package. It is executed with the same
+// parameters as the built-in template: .CharmPackage and .HookPackage
+// hold the import paths of the charm package and the hook package,
+// and .AutogenMessage holds a comment saying that the file is
+// generated.
+const MainTemplateFile = "src/runhook/main.go.tmpl"
+
+// requiredMainCalls holds the functions that the main package must
+// call, keyed by which package they are in, so that hooks are
+// registered and dispatched as gocharm expects. Everything else that
+// the runhook executable must do, such as answering "runhook version"
+// and mapping errors to exit statuses, is done by hook.RunMain, so
+// that a template cannot leave it out.
+var requiredMainCalls = []struct {
+	charm bool
+	name  string
+}{
+	{false, "NewRegistry"},
+	{true, "RegisterHooks"},
+	{false, "RunMain"},
+}
+
+// generatePackageMain returns the source of the runhook main package
+// for the given charm package. If the package provides
+// MainTemplateFile, that is used instead of the built-in template,
+// and the result is checked to make sure that it still registers and
+// runs the hooks.
+func generatePackageMain(pkg *build.Package) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(pkg.Dir, filepath.FromSlash(MainTemplateFile)))
+	if os.IsNotExist(err) {
+		return GenerateMain(pkg.ImportPath), nil
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	tmpl, err := template.New(path.Base(MainTemplateFile)).Parse(string(data))
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot parse %s", MainTemplateFile)
+	}
+	var code bytes.Buffer
+	if err := tmpl.Execute(&code, templateParams{
+		CharmPackage:   pkg.ImportPath,
+		HookPackage:    hookPackage,
+		AutogenMessage: autogenMessage,
+	}); err != nil {
+		return nil, errgo.Notef(err, "cannot execute %s", MainTemplateFile)
+	}
+	if err := checkMainCode(code.Bytes(), pkg.ImportPath, pkg.Name); err != nil {
+		return nil, errgo.Notef(err, "invalid %s", MainTemplateFile)
+	}
+	return code.Bytes(), nil
+}
+
+// checkMainCode checks that the given main package source imports
+// the charm package with the given import path and package name and
+// the hook package, and calls all the functions in requiredMainCalls.
+func checkMainCode(code []byte, charmPackage, charmName string) error {
+	f, err := parser.ParseFile(token.NewFileSet(), "runhook.go", code, 0)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if f.Name.Name != "main" {
+		return errgo.Newf("package is %s, not main", f.Name.Name)
+	}
+	var charmId, hookId string
+	for _, imp := range f.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		switch importPath {
+		case charmPackage:
+			if name == "" {
+				name = charmName
+			}
+			charmId = name
+		case hookPackage:
+			if name == "" {
+				name = "hook"
+			}
+			hookId = name
+		}
+	}
+	if charmId == "" {
+		return errgo.Newf("charm package %q is not imported", charmPackage)
+	}
+	if hookId == "" {
+		return errgo.Newf("hook package %q is not imported", hookPackage)
+	}
+	called := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				called[x.Name+"."+sel.Sel.Name] = true
+			}
+		}
+		return true
+	})
+	var missing []string
+	for _, fn := range requiredMainCalls {
+		id := hookId
+		if fn.charm {
+			id = charmId
+		}
+		if !called[id+"."+fn.name] {
+			missing = append(missing, id+"."+fn.name)
+		}
+	}
+	if len(missing) > 0 {
+		return errgo.Newf("no call to %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// GenerateFiles returns the files that gocharm generates from the
+// registered charm information for the given charm package, other
+// than the YAML metadata, keyed by their path relative to the charm
+// directory: a hook stub in hooks/ for each registered hook, and
+// src/runhook/runhook.go, generated from the package's
+// MainTemplateFile if it has one, as BuildCharm does.
+func GenerateFiles(pkg *build.Package, info *CharmInfo, opts StubOptions) (map[string][]byte, error) {
+	code, err := generatePackageMain(pkg)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	files := map[string][]byte{
+		"src/runhook/runhook.go": code,
+	}
+	for _, name := range info.Hooks {
+		files["hooks/"+name] = GenerateHookStub(name, info.HookStubs[name], opts)
+	}
+	return files, nil
+}
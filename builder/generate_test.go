@@ -0,0 +1,106 @@
+package builder
+
+import (
+	"go/build"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+)
+
+const customMain = `
+// {{.AutogenMessage}}
+
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	mycharm {{.CharmPackage | printf "%q"}}
+	{{.HookPackage | printf "%q"}}
+)
+
+func main() {
+	rand.Seed(time.Now().UnixNano())
+	r := hook.NewRegistry()
+	mycharm.RegisterHooks(r)
+	hook.RunMain(r)
+}
+`
+
+var generatePackageMainTests = []struct {
+	about       string
+	template    string
+	expectCode  string
+	expectError string
+}{{
+	about:      "no template",
+	expectCode: string(GenerateMain("example.com/foo")),
+}, {
+	about:      "custom template",
+	template:   customMain,
+	expectCode: strings.Replace(strings.Replace(customMain, `{{.CharmPackage | printf "%q"}}`, `"example.com/foo"`, 1), `{{.HookPackage | printf "%q"}}`, `"github.com/juju/gocharm/hook"`, 1),
+}, {
+	about:       "bad template",
+	template:    "{{.Foo",
+	expectError: `cannot parse src/runhook/main.go.tmpl: .*`,
+}, {
+	about:       "template execution error",
+	template:    "{{.Foo}}",
+	expectError: `cannot execute src/runhook/main.go.tmpl: .*`,
+}, {
+	about:       "invalid Go",
+	template:    "package main\nfunc main() {",
+	expectError: `invalid src/runhook/main.go.tmpl: .*expected '}'.*`,
+}, {
+	about:       "bad package name",
+	template:    strings.Replace(customMain, "package main", "package foo", 1),
+	expectError: `invalid src/runhook/main.go.tmpl: package is foo, not main`,
+}, {
+	about:       "charm package not imported",
+	template:    strings.Replace(customMain, `mycharm {{.CharmPackage | printf "%q"}}`, "", 1),
+	expectError: `invalid src/runhook/main.go.tmpl: charm package "example.com/foo" is not imported`,
+}, {
+	about:       "missing calls",
+	template:    strings.Replace(customMain, "mycharm.RegisterHooks(r)", "", 1),
+	expectError: `invalid src/runhook/main.go.tmpl: no call to mycharm.RegisterHooks`,
+}, {
+	about: "hook.Main called directly",
+	template: strings.Replace(customMain, "hook.RunMain(r)", `hook.RegisterMainHooks(r)
+	ctxt, state, _ := hook.NewContextFromEnvironment(r)
+	hook.Main(r, ctxt, state)`, 1),
+	expectError: `invalid src/runhook/main.go.tmpl: no call to hook.RunMain`,
+}, {
+	about:    "charm package imported without a name",
+	template: strings.Replace(strings.Replace(customMain, "mycharm {{", "{{", 1), "mycharm.", "foo.", 1),
+}}
+
+func (suite) TestGeneratePackageMain(c *gc.C) {
+	for i, test := range generatePackageMainTests {
+		c.Logf("test %d: %s", i, test.about)
+		dir := c.MkDir()
+		if test.template != "" {
+			writeFiles(c, dir, map[string]string{
+				MainTemplateFile: test.template,
+			})
+		}
+		code, err := generatePackageMain(&build.Package{
+			Dir:        dir,
+			Name:       "foo",
+			ImportPath: "example.com/foo",
+		})
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		if test.expectCode != "" {
+			c.Assert(string(code), gc.Equals, strings.Replace(test.expectCode, "{{.AutogenMessage}}", autogenMessage, 1))
+		}
+	}
+}
+
+func (suite) TestDefaultMainPassesCheck(c *gc.C) {
+	err := checkMainCode(GenerateMain("example.com/foo"), "example.com/foo", "foo")
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,161 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/build"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+// Inspect returns the information registered by the
+// RegisterHooks function of the given charm package. It finds it by
+// building and running a small program that calls RegisterHooks;
+// the program is run in a sandbox environment (see sandboxEnv) so
+// that any initialization code in the charm cannot affect the
+// real environment.
+//
+// Some hooks may be registered only under certain conditions, so
+// hooks that are registered with a literal name in the charm
+// package (see staticHookNames) are included even if they were
+// not registered when the program was run.
+func Inspect(pkg *build.Package, tempDir string) (*CharmInfo, error) {
+	cfg, err := ReadBuildConfig(pkg.Dir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	code := generateCode(inspectCode, pkg.ImportPath)
+	inspectExe := filepath.Join(tempDir, "inspect")
+	if err := compile(filepath.Join(tempDir, "inspect.go"), inspectExe, code, false, cfg); err != nil {
+		return nil, errgo.Notef(err, "cannot build hook inspection code")
+	}
+	sandboxDir := filepath.Join(tempDir, "sandbox")
+	if err := os.MkdirAll(sandboxDir, 0777); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	c := exec.Command(inspectExe)
+	var buf bytes.Buffer
+	c.Stdout = &buf
+	c.Stderr = Stderr
+	c.Dir = sandboxDir
+	c.Env = sandboxEnv(os.Environ(), sandboxDir)
+	if err := c.Run(); err != nil {
+		return nil, errgo.Notef(err, "failed to run inspect")
+	}
+	var out CharmInfo
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		return nil, errgo.Notef(err, "cannot unmarshal %q", err)
+	}
+	static, err := staticHookNames(pkg.Dir)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot analyze %s", pkg.ImportPath)
+	}
+	out.Hooks = mergeHookNames(out.Hooks, static)
+	sort.Strings(out.Hooks)
+	if len(out.Hooks) == 0 {
+		return nil, errgo.New("no hooks registered")
+	}
+	if Verbose {
+		log.Printf("registered hooks: %v", out.Hooks)
+		log.Printf("%d registered relations", len(out.Relations))
+		log.Printf("%d registered config options", len(out.Config))
+		log.Printf("%d registered metrics", len(out.Metrics))
+		log.Printf("%d registered resources", len(out.Resources))
+	}
+	return &out, nil
+}
+
+// sandboxEnv returns the environment to run the hook inspection
+// program in. Only $PATH is kept from the given environment, so
+// that, for example, the Juju environment variables cannot be used
+// to reach a real unit agent. $HOME and $TMPDIR are set to dir.
+func sandboxEnv(env []string, dir string) []string {
+	var sandbox []string
+	for _, e := range env {
+		if strings.HasPrefix(e, "PATH=") {
+			sandbox = append(sandbox, e)
+		}
+	}
+	return append(sandbox, "HOME="+dir, "TMPDIR="+dir)
+}
+
+// CharmInfo holds the information we glean
+// from inspecting the hook registry. It is
+// decoded from the JSON encoding of the
+// hook.Description returned by Registry.Describe,
+// so its fields must keep the same names.
+type CharmInfo struct {
+	// Hooks holds the names of the registered
+	// hooks, sorted.
+	Hooks     []string
+	Relations map[string]charm.Relation
+	Config    map[string]charm.Option
+	Metrics   map[string]charm.Metric
+	Resources map[string]Resource
+	HookStubs map[string]HookStub
+
+	// Commands holds the names of the registries
+	// that have registered a command.
+	Commands []string
+
+	// Binaries holds the names of the binaries
+	// registered with RegisterBinary.
+	Binaries []string
+
+	// LXDProfile holds the registered LXD profile
+	// settings, or nil if there are none.
+	LXDProfile *LXDProfile
+
+	// Series holds the series supported by each feature
+	// registered with RegisterSeries, keyed by feature name.
+	Series map[string][]string
+}
+
+// HookStub mirrors hook.HookStub.
+type HookStub struct {
+	Interpreter string
+	Env         map[string]string
+	Dir         string
+	Setup       []string
+}
+
+// Resource mirrors hook.Resource. It is defined
+// here so that we can marshal it to YAML.
+type Resource struct {
+	Type        string `yaml:"type"`
+	Filename    string `yaml:"filename,omitempty"`
+	Description string `yaml:"description,omitempty"`
+}
+
+var inspectCode = template.Must(template.New("").Parse(`
+// {{.AutogenMessage}}
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	inspect {{.CharmPackage | printf "%q"}}
+	{{.HookPackage | printf "%q"}}
+)
+
+func main() {
+	r := hook.NewRegistry()
+	inspect.RegisterHooks(r)
+	hook.RegisterMainHooks(r)
+	data, err := json.Marshal(r.Describe())
+	if err != nil {
+		panic(err)
+	}
+	os.Stdout.Write(data)
+}
+`))
@@ -0,0 +1,701 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/utils/fs"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+// InferSeries returns the series to build the charm in the given
+// package directory for. If the charm's metadata.yaml specifies any
+// series (see PackageSeries), the first one is used, and if the
+// -series flag was explicitly set it must be one of them (flagSeries
+// holds the flag's value and flagSet whether it was set), in which
+// case it is used instead; otherwise flagSeries is used.
+func InferSeries(pkgDir, flagSeries string, flagSet bool) (string, error) {
+	series, err := PackageSeries(pkgDir)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	switch {
+	case len(series) == 0:
+		return flagSeries, nil
+	case !flagSet:
+		return series[0], nil
+	case !containsString(series, flagSeries):
+		if len(series) == 1 {
+			return "", errgo.Newf("series %q in metadata.yaml does not match -series flag %q", series[0], flagSeries)
+		}
+		return "", errgo.Newf("series %q in metadata.yaml do not include -series flag %q", series, flagSeries)
+	}
+	return flagSeries, nil
+}
+
+// Params holds the parameters for Install.
+type Params struct {
+	// PkgPath holds the import path of the charm's
+	// package, or a path to its directory.
+	PkgPath string
+
+	// Repo holds the charm repository directory.
+	// The charm is installed into $Repo/$Series/$name.
+	Repo string
+
+	// Series holds the series to build the charm for.
+	Series string
+
+	// OutputDir, if non-empty, specifies a directory to
+	// write a minimal deployable charm to, instead of the
+	// charm repository. Only the files needed to deploy the
+	// charm are written: the Go source, version control
+	// directories and test files are left out.
+	OutputDir string
+
+	// Source specifies that the source code should be
+	// included in the charm instead of the compiled binary.
+	Source bool
+
+	// Strip specifies that a .jujuignore file should be
+	// written so that the Go source is not uploaded when
+	// the charm is deployed.
+	Strip bool
+
+	// Dispatch specifies that each hook should be a symbolic
+	// link to the runhook executable rather than a stub script.
+	Dispatch bool
+
+	// Compress specifies that the runhook executable should
+	// be stripped of debugging information and compressed
+	// with upx if it is available.
+	Compress bool
+
+	// Debug specifies that the runhook executable should be
+	// built for debugging with delve, and that a
+	// bin/debug-hook script should be included to run
+	// it under delve on the unit.
+	Debug bool
+
+	// Docker, if non-empty, holds a Docker image to build the
+	// charm's executables in, so that the build does not depend
+	// on the Go toolchain installed locally. See
+	// BuildCharmParams.Docker.
+	Docker string
+
+	// Cgo specifies that the charm's executables should be
+	// built with cgo enabled. See BuildCharmParams.Cgo.
+	Cgo bool
+
+	// Checksum specifies that the checksum of the runhook
+	// executable should be written to bin/runhook.sha256
+	// and verified by each hook before it is run.
+	Checksum bool
+
+	// SignKey, if non-empty, holds the GPG key used to sign
+	// bin/runhook.sha256. It implies Checksum.
+	SignKey string
+
+	// Placeholders specifies that placeholder README.md,
+	// icon.svg and copyright files should be generated
+	// if the package does not provide them.
+	Placeholders bool
+
+	// RevisionFrom specifies how the charm's revision is
+	// chosen: RevisionBump (the default, if it is empty),
+	// RevisionFromGit or RevisionFromGitTag. With the git
+	// strategies, the same commit always gives the same
+	// revision, wherever the charm is built.
+	RevisionFrom string
+
+	// Fmt, Vet and Race specify checks to run on the charm's
+	// source before it is built: that its Go files are
+	// formatted as by gofmt, that go vet reports no problems
+	// in its packages, and that its tests pass with the race
+	// detector enabled (see Test). If any check fails, the
+	// charm is not built and the cause of the error returned
+	// by Install is a *ChecksError.
+	Fmt  bool
+	Vet  bool
+	Race bool
+
+	// Strict specifies that any warning printed while
+	// building the charm, such as for a modified hook that
+	// cannot be overwritten, should cause Install to fail
+	// without installing the charm.
+	Strict bool
+
+	// DryRun specifies that nothing should be installed.
+	// Instead, the charm is built in a temporary directory
+	// and the actions that installing it would take are
+	// printed with Infof. Neither the prebuild and postbuild
+	// commands nor go install are run.
+	DryRun bool
+}
+
+// Install builds the charm in the given package and installs it
+// into the charm repository (or the output directory), and returns
+// its URL. The revision of the URL is always -1.
+func Install(p Params) (*charm.URL, error) {
+	if p.Source && (p.OutputDir != "" || p.Strip || p.Dispatch) {
+		return nil, errgo.New("cannot include source with an output directory, stripping or dispatch")
+	}
+	if p.Compress && p.Source {
+		return nil, errgo.New("cannot include source when compressing the runhook executable")
+	}
+	if p.Debug && (p.Source || p.Compress) {
+		return nil, errgo.New("cannot build the runhook executable for debugging when including source or compressing")
+	}
+	if (p.Checksum || p.SignKey != "") && (p.Source || p.Dispatch) {
+		return nil, errgo.New("cannot checksum the runhook executable when including source or using dispatch")
+	}
+	if p.Docker != "" && p.Source {
+		return nil, errgo.New("cannot build in a Docker container when including source")
+	}
+	var warnings *warningRecorder
+	if p.Strict {
+		warnings = recordWarnings()
+		defer warnings.restore()
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot get current directory")
+	}
+	pkg, err := build.Default.Import(p.PkgPath, cwd, build.FindOnly)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot find %q", p.PkgPath)
+	}
+	cfg, err := ReadBuildConfig(pkg.Dir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	goTool, err := cfg.goTool()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if p.DryRun {
+		for _, cmd := range cfg.PreBuild {
+			Infof("%s: would run prebuild command %q", path.Base(pkg.Dir), cmd)
+		}
+		if names := checkNames(p); len(names) > 0 {
+			Infof("%s: would run checks: %s", path.Base(pkg.Dir), strings.Join(names, ", "))
+		}
+	} else {
+		if err := runCommands("prebuild", pkg.Dir, cfg.env(os.Environ()), cfg.PreBuild); err != nil {
+			return nil, errgo.Mask(err)
+		}
+		// Ensure that the package and all its dependencies are
+		// installed before generating anything. This ensures
+		// that we can generate the binary quickly, and that
+		// it will be in sync with any package that have uninstalled
+		// changes.
+		args := append([]string{"install"}, cfg.buildArgs()...)
+		args = append(args, p.PkgPath)
+		if err := runCmd("", cfg.env(os.Environ()), goTool, args...).Run(); err != nil {
+			return nil, errgo.Notef(err, "cannot install %q", p.PkgPath)
+		}
+		if err := runChecks(pkg, cfg, goTool, p); err != nil {
+			return nil, errgo.Mask(err, isChecksError)
+		}
+	}
+	pkg, err = cfg.buildContext().Import(p.PkgPath, cwd, 0)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot import %q", p.PkgPath)
+	}
+	charmName := path.Base(pkg.Dir)
+	dest := filepath.Join(p.Repo, p.Series, charmName)
+	if p.OutputDir != "" {
+		dest = p.OutputDir
+	}
+
+	if _, err := canClean(dest); err != nil {
+		return nil, errgo.Notef(err, "cannot clean destination directory")
+	}
+	rev, err := ReadRevision(dest)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read revision")
+	}
+
+	// We put everything into a directory in /tmp first,
+	// so we have less chance of deleting everything from
+	// the destination without having something to replace
+	// it with.
+	tempDir, err := ioutil.TempDir("", "gocharm")
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot make temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempCharmDir := filepath.Join(tempDir, "charm")
+	if err := copyContents(pkg, tempCharmDir); err != nil {
+		return nil, errgo.Notef(err, "cannot copy package contents")
+	}
+
+	// The local revision number should not matter, but
+	// there is a bug in juju that means that the charm
+	// will not be correctly uploaded if it is not there, so we
+	// preserve the revision found in the destination directory.
+	oldRev := rev
+	rev, err = nextRevision(p.RevisionFrom, pkg.Dir, oldRev)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if err := BuildCharm(BuildCharmParams{
+		Pkg:          pkg,
+		CharmDir:     tempCharmDir,
+		TempDir:      tempDir,
+		Source:       p.Source,
+		Dispatch:     p.Dispatch,
+		Compress:     p.Compress,
+		Debug:        p.Debug,
+		Docker:       p.Docker,
+		Cgo:          p.Cgo,
+		Checksum:     p.Checksum,
+		SignKey:      p.SignKey,
+		Placeholders: p.Placeholders,
+		Revision:     rev,
+		Series:       p.Series,
+		// TODO godeps
+	}); err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	if rev != -1 {
+		if err := WriteRevision(tempCharmDir, rev); err != nil {
+			return nil, errgo.Notef(err, "cannot write revision file")
+		}
+	}
+	if p.DryRun {
+		for _, cmd := range cfg.PostBuild {
+			Infof("%s: would run postbuild command %q", charmName, cmd)
+		}
+	} else {
+		postEnv := setenv(cfg.env(os.Environ()), "CHARM_DIR="+tempCharmDir)
+		if err := runCommands("postbuild", pkg.Dir, postEnv, cfg.PostBuild); err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	manifest, err := mergeHooks(dest, tempCharmDir)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot merge hooks")
+	}
+	manifest.Outputs, err = builtFiles(tempCharmDir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var buildInfo *BuildInfo
+	if !p.DryRun {
+		buildInfo, err = newBuildInfo(p, pkg, cfg, rev)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	if warnings != nil && len(warnings.warnings) > 0 {
+		return nil, errgo.Newf("charm not installed because of %d warning(s) with strict checking enabled", len(warnings.warnings))
+	}
+	if p.DryRun {
+		binaries, err := findBinaries(cfg.buildContext(), pkg.Dir)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		plan, err := dryRunPlan(dest, tempCharmDir, pkg.Dir, manifest, oldRev, rev, binaries, p.Source)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		Infof("%s: would install into %s", charmName, dest)
+		for _, line := range plan {
+			Infof("%s: %s", charmName, line)
+		}
+		return &charm.URL{
+			Schema:   "local",
+			Series:   p.Series,
+			Name:     charmName,
+			Revision: -1,
+		}, nil
+	}
+	// The new charm is assembled in a staging directory next to
+	// the destination and then renamed into place, so that
+	// concurrent gocharm runs (or other tools looking at the
+	// charm) never see a partially written charm.
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	staging, err := mkStagingDir(dest)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot make staging directory")
+	}
+	defer os.RemoveAll(staging)
+	for name := range allowed {
+		from := filepath.Join(tempCharmDir, name)
+		if _, err := os.Stat(from); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, errgo.Mask(err)
+			}
+			continue
+		}
+		to := filepath.Join(staging, name)
+		if p.OutputDir != "" {
+			if minimalExcluded[name] {
+				if Verbose {
+					log.Printf("skipping %s: not needed in a minimal charm", name)
+				}
+				continue
+			}
+			err = copyMinimal(from, to)
+		} else {
+			err = fs.Copy(from, to)
+		}
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot copy to final destination")
+		}
+	}
+	if err := copyHidden(dest, staging); err != nil {
+		return nil, errgo.Notef(err, "cannot copy hidden files from %s", dest)
+	}
+	// The registry description is written again, replacing any
+	// copied from the old charm, so that it lists assets added
+	// by the postbuild commands.
+	registry, err := ReadRegistryInfo(tempCharmDir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if err := registry.write(staging); err != nil {
+		return nil, errgo.Notef(err, "cannot write %s", RegistryFile)
+	}
+	manifest.Package = pkg.ImportPath
+	manifest.Dir = pkg.Dir
+	manifest.BuildTime = now().UTC()
+	if err := manifest.write(staging); err != nil {
+		return nil, errgo.Notef(err, "cannot write hook manifest")
+	}
+	if err := buildInfo.write(staging); err != nil {
+		return nil, errgo.Notef(err, "cannot write %s", BuildInfoFile)
+	}
+	if err := writeJujuIgnore(staging, p.Strip && p.OutputDir == ""); err != nil {
+		return nil, errgo.Notef(err, "cannot write %s", jujuIgnoreFile)
+	}
+	if err := replaceDir(dest, staging); err != nil {
+		return nil, errgo.Notef(err, "cannot install charm")
+	}
+	return &charm.URL{
+		Schema:   "local",
+		Series:   p.Series,
+		Name:     charmName,
+		Revision: -1,
+	}, nil
+}
+
+// jujuIgnoreFile holds the name of the file that lists
+// the files that juju will not upload when deploying a charm.
+const jujuIgnoreFile = ".jujuignore"
+
+// jujuIgnoreContents holds the contents of the .jujuignore
+// file written with the -strip flag. It excludes everything
+// that is not needed to run the compiled runhook binary.
+const jujuIgnoreContents = yamlAutogenComment + `/src
+/pkg
+/Godeps
+/compile
+/dependencies.tsv
+`
+
+// writeJujuIgnore writes a .jujuignore file to the given charm
+// directory if strip is true, so that the Go source is not uploaded
+// when the charm is deployed but remains available locally. If strip
+// is false, any .jujuignore file previously written by gocharm is
+// removed, so that building without -strip reverses the effect. A
+// .jujuignore file not written by gocharm is never changed.
+func writeJujuIgnore(charmDir string, strip bool) error {
+	path := filepath.Join(charmDir, jujuIgnoreFile)
+	_, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if !autogenerated(path) {
+			if strip {
+				return errgo.Newf("non-autogenerated file %q", path)
+			}
+			return nil
+		}
+	case !os.IsNotExist(err):
+		return errgo.Mask(err)
+	}
+	if !strip {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errgo.Mask(err)
+		}
+		return nil
+	}
+	if err := ioutil.WriteFile(path, []byte(jujuIgnoreContents), 0666); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// minimalExcluded holds the charm directory entries
+// that are left out of a charm written with the -o flag.
+var minimalExcluded = map[string]bool{
+	"compile":          true,
+	"dependencies.tsv": true,
+	"pkg":              true,
+	"src":              true,
+}
+
+// vcsDirs holds the names of version control directories.
+var vcsDirs = map[string]bool{
+	".bzr": true,
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+// copyMinimal copies the file or directory from to the path to,
+// leaving out any version control directories and Go test files.
+// Unlike fs.Copy, it follows symbolic links, so that the assets
+// directory, which is a link into the package source, is copied
+// in full.
+func copyMinimal(from, to string) error {
+	info, err := os.Stat(from)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if !info.IsDir() {
+		if strings.HasSuffix(info.Name(), "_test.go") {
+			if Verbose {
+				log.Printf("skipping %s: test file", from)
+			}
+			return nil
+		}
+		return errgo.Mask(fs.Copy(from, to))
+	}
+	if err := os.MkdirAll(to, info.Mode()&os.ModePerm); err != nil {
+		return errgo.Mask(err)
+	}
+	infos, err := ioutil.ReadDir(from)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	for _, info := range infos {
+		if info.IsDir() && vcsDirs[info.Name()] {
+			if Verbose {
+				log.Printf("skipping %s: version control directory", filepath.Join(from, info.Name()))
+			}
+			continue
+		}
+		if err := copyMinimal(filepath.Join(from, info.Name()), filepath.Join(to, info.Name())); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+func copyContents(pkg *build.Package, destDir string) error {
+	destPkgDir := filepath.Join(destDir, "src", filepath.FromSlash(pkg.ImportPath))
+	if err := os.MkdirAll(filepath.Dir(destPkgDir), 0777); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := fs.Copy(pkg.Dir, destPkgDir); err != nil {
+		return errgo.Notef(err, "cannot copy package")
+	}
+	if _, err := os.Stat(filepath.Join(destPkgDir, "assets")); err == nil {
+		// Make relative symlink from assets in charm root directory
+		// to where it lives in the charm package.
+		if err := os.Symlink(filepath.Join("src", filepath.FromSlash(pkg.ImportPath), "assets"), filepath.Join(destDir, "assets")); err != nil {
+			return errgo.Mask(err)
+		}
+	} else if !os.IsNotExist(err) {
+		return errgo.Notef(err, "cannot check for assets")
+	}
+	for _, f := range docFiles {
+		if path := findDocFile(destPkgDir, f); path != "" {
+			if err := fs.Copy(path, filepath.Join(destDir, filepath.Base(path))); err != nil {
+				return errgo.Mask(err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyHidden copies the entries in the charm directory dest whose
+// names start with a dot, such as version control directories and
+// .jujuignore, to the new charm directory staging, so that they are
+// preserved when the charm is replaced.
+func copyHidden(dest, staging string) error {
+	infos, err := ioutil.ReadDir(dest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errgo.Mask(err)
+	}
+	for _, info := range infos {
+		if info.Name()[0] != '.' {
+			continue
+		}
+		if err := fs.Copy(filepath.Join(dest, info.Name()), filepath.Join(staging, info.Name())); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// mkStagingDir makes a new hidden directory next to dest
+// to assemble a charm in before it is moved to dest.
+func mkStagingDir(dest string) (string, error) {
+	for i := 0; ; i++ {
+		dir := filepath.Join(filepath.Dir(dest), fmt.Sprintf(".%s.gocharm-%d-%d", filepath.Base(dest), os.Getpid(), time.Now().UnixNano()))
+		// Unlike ioutil.TempDir, this respects the umask,
+		// so the installed charm has the usual permissions.
+		err := os.Mkdir(dir, 0777)
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsExist(err) || i >= 10000 {
+			return "", errgo.Mask(err)
+		}
+	}
+}
+
+// maxReplaceAttempts holds the number of times that replaceDir
+// tries to rename the new directory into place when another
+// process is doing the same thing.
+const maxReplaceAttempts = 5
+
+// replaceDir replaces the directory dest with the directory
+// staging, which must be in the same parent directory. The only
+// time that dest can be seen in an intermediate state is the
+// instant between the two renames, when it does not exist.
+func replaceDir(dest, staging string) error {
+	old := staging + ".old"
+	for attempt := 1; ; attempt++ {
+		err := os.Rename(dest, old)
+		if err != nil && !os.IsNotExist(err) {
+			return errgo.Mask(err)
+		}
+		moved := err == nil
+		err = os.Rename(staging, dest)
+		if err == nil {
+			if moved {
+				if Verbose {
+					log.Printf("removing %s", old)
+				}
+				return errgo.Mask(os.RemoveAll(old))
+			}
+			return nil
+		}
+		if _, statErr := os.Stat(dest); statErr != nil || attempt == maxReplaceAttempts {
+			// The rename failed for some other reason than
+			// a concurrent installation, so put back the
+			// old directory.
+			if moved {
+				os.Rename(old, dest)
+			}
+			return errgo.Mask(err)
+		}
+		// Another process installed its charm after we moved
+		// the previous one out of the way. Remove the
+		// previous one and try again, moving the other
+		// process's charm out of the way in turn.
+		if moved {
+			if err := os.RemoveAll(old); err != nil {
+				return errgo.Mask(err)
+			}
+		}
+	}
+}
+
+var allowed = map[string]bool{
+	"assets":           true,
+	"bin":              true,
+	"compile":          true,
+	"config.yaml":      true,
+	"copyright":        true,
+	"dependencies.tsv": true,
+	"hooks":            true,
+	"icon.svg":         true,
+	"lxd-profile.yaml": true,
+	"metadata.yaml":    true,
+	"metrics.yaml":     true,
+	"pkg":              true, // This allows us to test the compile scripts in the charm dir.
+	"README":           true,
+	"README.md":        true,
+	"revision":         true,
+	"src":              true,
+}
+
+func canClean(dir string) (needRemove []string, err error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errgo.Mask(err)
+	}
+	var toRemove []string
+	for _, info := range infos {
+		if info.Name()[0] == '.' {
+			continue
+		}
+		if !allowed[info.Name()] {
+			return nil, errgo.Newf("unexpected file %q found in %s", info.Name(), dir)
+		}
+		path := filepath.Join(dir, info.Name())
+		if strings.HasSuffix(path, ".yaml") && !autogenerated(path) {
+			return nil, errgo.Newf("non-autogenerated file %q", path)
+		}
+		toRemove = append(toRemove, path)
+	}
+	return toRemove, nil
+}
+
+func autogenerated(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, len(yamlAutogenComment))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, []byte(yamlAutogenComment))
+}
+
+// ReadRevision returns the revision of the charm in the given
+// directory, or -1 if it has no revision file.
+func ReadRevision(charmDir string) (int, error) {
+	path := revisionPath(charmDir)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		// No revision file, nothing to increment.
+		return -1, nil
+	}
+	if err != nil {
+		return 0, errgo.Mask(err)
+	}
+	rev, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || rev < 0 {
+		return 0, fmt.Errorf("invalid number %q in %s", data, path)
+	}
+	return rev, nil
+}
+
+// WriteRevision writes the given revision to the charm
+// in the given directory.
+func WriteRevision(charmDir string, rev int) error {
+	return ioutil.WriteFile(revisionPath(charmDir), []byte(strconv.Itoa(rev)), 0666)
+}
+
+func revisionPath(charmDir string) string {
+	return filepath.Join(charmDir, "revision")
+}
@@ -0,0 +1,154 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// CharmStatus holds the status of a charm in a charm
+// repository, as returned by List.
+type CharmStatus struct {
+	// Series and Name hold the series directory
+	// and name of the charm. For a charm nested below
+	// the series directory, Name holds its slash-separated
+	// path relative to that directory.
+	Series string
+	Name   string
+
+	// Dir holds the charm's directory.
+	Dir string
+
+	// GoCharm reports whether the charm was built by gocharm.
+	GoCharm bool
+
+	// Revision holds the charm's revision, or -1
+	// if it has no revision file.
+	Revision int
+
+	// Hooks holds the names of the charm's hooks, sorted.
+	Hooks []string
+
+	// Package holds the import path of the package the charm
+	// was built from, and BuildTime holds when it was built.
+	// They are only known for charms built by this version
+	// of gocharm or later.
+	Package   string
+	BuildTime time.Time
+
+	// Stale reports whether any file in the package's source
+	// directory has been modified since the charm was built.
+	Stale bool
+}
+
+// List returns the status of all the charms in the given charm
+// repository, sorted by series and then name. Any directory below a
+// series directory that holds a metadata.yaml file is treated as a
+// charm, and is not searched further. Charms may be nested in
+// subdirectories of the series directory, to at most maxDepth
+// directories below the repository (DefaultMaxDepth if it is zero).
+// Hidden directories and those matched by an ignore file (see
+// IgnoreFile) are not searched.
+func List(repo string, maxDepth int) ([]CharmStatus, error) {
+	var charms []CharmStatus
+	w := &dirWalker{
+		maxDepth: maxDepth,
+		skip: func(name string) bool {
+			return strings.HasPrefix(name, ".")
+		},
+		visit: func(dir string) error {
+			rel, err := filepath.Rel(repo, dir)
+			if err != nil {
+				return errgo.Mask(err)
+			}
+			parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+			if len(parts) < 2 || !exists(filepath.Join(dir, "metadata.yaml")) {
+				return nil
+			}
+			status, err := charmStatus(dir)
+			if err != nil {
+				return errgo.Notef(err, "cannot get status of %s", dir)
+			}
+			status.Series = parts[0]
+			status.Name = parts[1]
+			charms = append(charms, *status)
+			return filepath.SkipDir
+		},
+	}
+	if err := w.walk(repo); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return charms, nil
+}
+
+// charmStatus returns the status of the charm in the given directory.
+func charmStatus(dir string) (*CharmStatus, error) {
+	status := &CharmStatus{
+		Name: filepath.Base(dir),
+		Dir:  dir,
+	}
+	rev, err := ReadRevision(dir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	status.Revision = rev
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "hooks"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errgo.Mask(err)
+	}
+	for _, info := range infos {
+		status.Hooks = append(status.Hooks, info.Name())
+	}
+	sort.Strings(status.Hooks)
+	m, err := readHookManifest(dir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	status.GoCharm = m != nil ||
+		exists(filepath.Join(dir, "bin", "runhook")) ||
+		exists(filepath.Join(dir, "src", "runhook"))
+	if m == nil || m.Dir == "" {
+		return status, nil
+	}
+	status.Package = m.Package
+	status.BuildTime = m.BuildTime
+	if newest, err := newestFile(m.Dir); err == nil {
+		status.Stale = newest.After(m.BuildTime)
+	} else if !os.IsNotExist(err) {
+		return nil, errgo.Mask(err)
+	}
+	return status, nil
+}
+
+// newestFile returns the modification time of the most recently
+// modified file under the given directory, ignoring hidden files
+// and directories.
+func newestFile(dir string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
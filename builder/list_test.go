@@ -0,0 +1,125 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestList(c *gc.C) {
+	repo := c.MkDir()
+	src := c.MkDir()
+	buildTime := time.Now().Add(-time.Hour).UTC().Round(time.Second)
+	writeFiles(c, repo, map[string]string{
+		"trusty/gocharm/metadata.yaml": "name: gocharm\n",
+		"trusty/gocharm/revision":      "4",
+		"trusty/gocharm/hooks/install": "#!/bin/sh\n",
+		"trusty/gocharm/hooks/start":   "#!/bin/sh\n",
+		"trusty/gocharm/bin/runhook":   "binary",
+		"trusty/old/metadata.yaml":     "name: old\n",
+		"trusty/old/bin/runhook":       "binary",
+		"trusty/plain/metadata.yaml":   "name: plain\n",
+		"trusty/plain/hooks/install":   "#!/bin/sh\n",
+		"precise/other/metadata.yaml":  "name: stale\n",
+		"precise/notacharm/README":     "hello",
+		"bundle/bundle.yaml":           "",
+	})
+	for _, name := range []string{"trusty/gocharm", "precise/other"} {
+		m := &hookManifest{
+			Package:   "example.com/" + filepath.Base(name),
+			Dir:       src,
+			BuildTime: buildTime,
+		}
+		err := m.write(filepath.Join(repo, name))
+		c.Assert(err, gc.IsNil)
+	}
+	writeFiles(c, src, map[string]string{
+		"charm.go":    "package charm\n",
+		".git/config": "",
+	})
+	// Only hidden files are newer than the build
+	// of trusty/gocharm.
+	old := buildTime.Add(-time.Minute)
+	err := os.Chtimes(filepath.Join(src, "charm.go"), old, old)
+	c.Assert(err, gc.IsNil)
+
+	charms, err := List(repo, 0)
+	c.Assert(err, gc.IsNil)
+	for i := range charms {
+		charms[i].Dir = ""
+	}
+	c.Assert(charms, jc.DeepEquals, []CharmStatus{{
+		Series:    "precise",
+		Name:      "other",
+		GoCharm:   true,
+		Revision:  -1,
+		Package:   "example.com/other",
+		BuildTime: buildTime,
+	}, {
+		Series:    "trusty",
+		Name:      "gocharm",
+		GoCharm:   true,
+		Revision:  4,
+		Hooks:     []string{"install", "start"},
+		Package:   "example.com/gocharm",
+		BuildTime: buildTime,
+	}, {
+		Series:   "trusty",
+		Name:     "old",
+		GoCharm:  true,
+		Revision: -1,
+	}, {
+		Series:   "trusty",
+		Name:     "plain",
+		Revision: -1,
+		Hooks:    []string{"install"},
+	}})
+
+	// Changing a source file makes the charms stale.
+	err = os.Chtimes(filepath.Join(src, "charm.go"), time.Now(), time.Now())
+	c.Assert(err, gc.IsNil)
+	charms, err = List(repo, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(charms[0].Stale, jc.IsTrue)
+	c.Assert(charms[1].Stale, jc.IsTrue)
+}
+
+func (suite) TestListNested(c *gc.C) {
+	repo := c.MkDir()
+	writeFiles(c, repo, map[string]string{
+		".gocharmignore":                       "trusty/vendor\n",
+		"trusty/top/metadata.yaml":             "name: top\n",
+		"trusty/top/src/inner/metadata.yaml":   "name: inner\n",
+		"trusty/team/nested/metadata.yaml":     "name: nested\n",
+		"trusty/team/a/b/c/deep/metadata.yaml": "name: deep\n",
+		"trusty/vendor/ignored/metadata.yaml":  "name: ignored\n",
+		"trusty/.hidden/charm/metadata.yaml":   "name: hidden\n",
+		"trusty/metadata.yaml":                 "name: series\n",
+	})
+	charms, err := List(repo, 4)
+	c.Assert(err, gc.IsNil)
+	var names []string
+	for _, ch := range charms {
+		names = append(names, ch.Series+"/"+ch.Name)
+	}
+	c.Assert(names, jc.DeepEquals, []string{
+		"trusty/team/nested",
+		"trusty/top",
+	})
+}
+
+// writeFiles writes the given files, keyed by slash-separated
+// path relative to dir, creating directories as needed.
+func writeFiles(c *gc.C, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(path, []byte(data), 0666)
+		c.Assert(err, gc.IsNil)
+	}
+}
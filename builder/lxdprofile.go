@@ -0,0 +1,116 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/yaml.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// LXDProfileFile holds the name of the file that
+// holds the charm's LXD profile.
+const LXDProfileFile = "lxd-profile.yaml"
+
+// LXDProfile mirrors hook.LXDProfile. It is defined
+// here so that we can marshal it to YAML. The description
+// can only be set in the package's lxd-profile.yaml.
+type LXDProfile struct {
+	Description string                       `yaml:"description,omitempty"`
+	Config      map[string]string            `yaml:"config,omitempty"`
+	Devices     map[string]map[string]string `yaml:"devices,omitempty"`
+}
+
+// writeLXDProfile writes the charm's lxd-profile.yaml, adding
+// the given registered settings to any found in the package's
+// lxd-profile.yaml file.
+func (b *charmBuilder) writeLXDProfile(registered *LXDProfile) error {
+	profile, err := packageLXDProfile(b.Pkg.Dir, registered)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if profile == nil {
+		return nil
+	}
+	if err := writeYAML(filepath.Join(b.CharmDir, LXDProfileFile), profile); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// packageLXDProfile returns the LXD profile declared in the
+// package's lxd-profile.yaml merged with the given registered
+// settings, or nil if there is neither. It returns an error if
+// the registered settings conflict with the declared ones or
+// if the profile contains something that Juju does not allow.
+func packageLXDProfile(pkgDir string, registered *LXDProfile) (*LXDProfile, error) {
+	var profile LXDProfile
+	data, err := ioutil.ReadFile(filepath.Join(pkgDir, LXDProfileFile))
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &profile); err != nil {
+			return nil, errgo.Notef(err, "invalid %s", LXDProfileFile)
+		}
+	case os.IsNotExist(err):
+		if registered == nil {
+			return nil, nil
+		}
+	default:
+		return nil, errgo.Mask(err)
+	}
+	if registered != nil {
+		for key, val := range registered.Config {
+			if old, ok := profile.Config[key]; ok && old != val {
+				return nil, errgo.Newf("LXD profile config %q is registered with a different value from that in %s", key, LXDProfileFile)
+			}
+			if profile.Config == nil {
+				profile.Config = make(map[string]string)
+			}
+			profile.Config[key] = val
+		}
+		for name, device := range registered.Devices {
+			if old, ok := profile.Devices[name]; ok && !reflect.DeepEqual(old, device) {
+				return nil, errgo.Newf("LXD profile device %q is registered with different settings from those in %s", name, LXDProfileFile)
+			}
+			if profile.Devices == nil {
+				profile.Devices = make(map[string]map[string]string)
+			}
+			profile.Devices[name] = device
+		}
+	}
+	if err := checkLXDProfile(&profile); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return &profile, nil
+}
+
+// checkLXDProfile checks that the given profile
+// contains only settings that Juju allows.
+func checkLXDProfile(profile *LXDProfile) error {
+	var keys []string
+	for key := range profile.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := hook.ValidateLXDProfileConfig(key); err != nil {
+			return errgo.Notef(err, "invalid %s", LXDProfileFile)
+		}
+	}
+	var names []string
+	for name := range profile.Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := hook.ValidateLXDProfileDevice(name, profile.Devices[name]); err != nil {
+			return errgo.Notef(err, "invalid %s", LXDProfileFile)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package builder
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+)
+
+func (suite) TestWriteLXDProfile(c *gc.C) {
+	pkgDir := c.MkDir()
+	b := &charmBuilder{
+		Pkg:      &build.Package{Dir: pkgDir},
+		CharmDir: c.MkDir(),
+	}
+	// With nothing declared, no file is written.
+	err := b.writeLXDProfile(nil)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(filepath.Join(b.CharmDir, LXDProfileFile))
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+
+	err = ioutil.WriteFile(filepath.Join(pkgDir, LXDProfileFile), []byte(`
+description: profile for a test charm
+config:
+  security.nesting: "true"
+`), 0666)
+	c.Assert(err, gc.IsNil)
+	err = b.writeLXDProfile(&LXDProfile{
+		Config: map[string]string{
+			"security.privileged": "true",
+		},
+		Devices: map[string]map[string]string{
+			"tun": {"type": "unix-char", "path": "/dev/net/tun"},
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(autogenerated(filepath.Join(b.CharmDir, LXDProfileFile)), gc.Equals, true)
+	data, err := ioutil.ReadFile(filepath.Join(b.CharmDir, LXDProfileFile))
+	c.Assert(err, gc.IsNil)
+	var profile LXDProfile
+	err = yaml.Unmarshal(data, &profile)
+	c.Assert(err, gc.IsNil)
+	c.Assert(profile, jc.DeepEquals, LXDProfile{
+		Description: "profile for a test charm",
+		Config: map[string]string{
+			"security.nesting":    "true",
+			"security.privileged": "true",
+		},
+		Devices: map[string]map[string]string{
+			"tun": {"type": "unix-char", "path": "/dev/net/tun"},
+		},
+	})
+
+	err = b.writeLXDProfile(&LXDProfile{
+		Config: map[string]string{
+			"security.nesting": "false",
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, `LXD profile config "security.nesting" is registered with a different value from that in lxd-profile.yaml`)
+}
+
+var packageLXDProfileTests = []struct {
+	about       string
+	file        string
+	registered  *LXDProfile
+	expectError string
+}{{
+	about:       "forbidden config in file",
+	file:        "config:\n  limits.memory: 1GB\n",
+	expectError: `invalid lxd-profile.yaml: LXD profile config "limits.memory" not allowed in a charm`,
+}, {
+	about: "forbidden config registered",
+	registered: &LXDProfile{
+		Config: map[string]string{"boot.autostart": "true"},
+	},
+	expectError: `invalid lxd-profile.yaml: LXD profile config "boot.autostart" not allowed in a charm`,
+}, {
+	about:       "forbidden device type",
+	file:        "devices:\n  eth1:\n    type: nic\n    nictype: bridged\n",
+	expectError: `invalid lxd-profile.yaml: LXD profile device "eth1" has type "nic", which is not allowed in a charm`,
+}, {
+	about:       "device without type",
+	file:        "devices:\n  gpu0:\n    id: \"0\"\n",
+	expectError: `invalid lxd-profile.yaml: no type given for LXD profile device "gpu0"`,
+}, {
+	about:       "bad YAML",
+	file:        "config: [",
+	expectError: `invalid lxd-profile.yaml: .*`,
+}, {
+	about: "conflicting device",
+	file:  "devices:\n  gpu0:\n    type: gpu\n",
+	registered: &LXDProfile{
+		Devices: map[string]map[string]string{
+			"gpu0": {"type": "gpu", "id": "1"},
+		},
+	},
+	expectError: `LXD profile device "gpu0" is registered with different settings from those in lxd-profile.yaml`,
+}}
+
+func (suite) TestPackageLXDProfile(c *gc.C) {
+	for i, test := range packageLXDProfileTests {
+		c.Logf("test %d: %s", i, test.about)
+		dir := c.MkDir()
+		if test.file != "" {
+			writeFiles(c, dir, map[string]string{LXDProfileFile: test.file})
+		}
+		_, err := packageLXDProfile(dir, test.registered)
+		c.Assert(err, gc.ErrorMatches, test.expectError)
+	}
+}
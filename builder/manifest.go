@@ -0,0 +1,277 @@
+package builder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// hookManifestPath holds the path, relative to the charm directory,
+// of the file that records the hook stubs generated by gocharm. It is
+// in a dot directory so that it is left alone when the charm
+// directory is cleaned.
+var hookManifestPath = filepath.Join(".gocharm", "hooks.json")
+
+// hookManifest records the hook stubs that gocharm has generated,
+// so that subsequent runs can tell whether they have been changed.
+type hookManifest struct {
+	// Hooks maps from hook name to the SHA256 hash
+	// of the generated stub, hex-encoded.
+	Hooks map[string]string
+
+	// Outputs holds the slash-separated paths, relative to the
+	// charm directory, of the files that were built into the
+	// charm's bin directory, such as the runhook executable, its
+	// checksum and signature, and the executables built from
+	// src/cmd. See OutputFiles.
+	Outputs []string `json:",omitempty"`
+
+	// Package and Dir hold the import path and directory
+	// of the package that the charm was built from, and
+	// BuildTime holds when it was built. They are used
+	// by List.
+	Package   string    `json:",omitempty"`
+	Dir       string    `json:",omitempty"`
+	BuildTime time.Time `json:",omitempty"`
+}
+
+// readHookManifest reads the hook manifest from the given charm
+// directory. It returns (nil, nil) if there is no manifest.
+func readHookManifest(charmDir string) (*hookManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(charmDir, hookManifestPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var m hookManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errgo.Notef(err, "cannot unmarshal %s", hookManifestPath)
+	}
+	return &m, nil
+}
+
+// OutputFiles returns the slash-separated paths, relative to charmDir,
+// of the files that were built into the bin directory of the charm
+// installed in charmDir, as recorded when it was installed. Hooks are
+// not included. Charms built with -source have no output files,
+// because they are compiled on the unit.
+func OutputFiles(charmDir string) ([]string, error) {
+	m, err := readHookManifest(charmDir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if m == nil {
+		return nil, errgo.Newf("no %s found in %s", hookManifestPath, charmDir)
+	}
+	return m.Outputs, nil
+}
+
+// builtFiles returns the slash-separated paths, relative to charmDir,
+// of the regular files in the bin directory of the newly built charm
+// in charmDir, sorted by name.
+func builtFiles(charmDir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(charmDir, "bin"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var files []string
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			files = append(files, "bin/"+info.Name())
+		}
+	}
+	return files, nil
+}
+
+// write writes the manifest to the given charm directory.
+func (m *hookManifest) write(charmDir string) error {
+	path := filepath.Join(charmDir, hookManifestPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return errgo.Mask(err)
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0666); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// mergeHooks reconciles the hooks freshly generated in newCharmDir
+// with those already present in the destination charm directory
+// dest, and returns a manifest describing the stubs that will be
+// installed.
+//
+// Hooks in dest that gocharm generated and that have not been
+// changed since are replaced (or removed, if no longer registered).
+// Any other hook in dest is treated as user-maintained: it is copied
+// into newCharmDir so that it survives the installation, and a
+// warning is printed if it differs from what gocharm would have
+// generated.
+//
+// If dest has no manifest, all its hooks are assumed to have been
+// generated by an earlier version of gocharm.
+func mergeHooks(dest, newCharmDir string) (*hookManifest, error) {
+	newHookDir := filepath.Join(newCharmDir, "hooks")
+	manifest := &hookManifest{
+		Hooks: make(map[string]string),
+	}
+	generated, err := readHooks(newHookDir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for name, data := range generated {
+		manifest.Hooks[name] = hashOf(data)
+	}
+	oldManifest, err := readHookManifest(dest)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read hook manifest")
+	}
+	if oldManifest == nil {
+		return manifest, nil
+	}
+	existing, err := readHooks(filepath.Join(dest, "hooks"))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for name, data := range existing {
+		if oldHash, ok := oldManifest.Hooks[name]; ok && oldHash == hashOf(data) {
+			// We generated it and it's unchanged, so
+			// it's safe to replace or remove.
+			continue
+		}
+		path := filepath.Join(dest, "hooks", name)
+		if newData, ok := generated[name]; ok {
+			if bytes.Equal(newData, data) {
+				continue
+			}
+			Warningf("not overwriting modified hook %s:\n%s", path, lineDiff(newData, data, "generated", path))
+		} else if _, ok := oldManifest.Hooks[name]; ok {
+			Warningf("not removing modified hook %s; it is no longer registered", path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		if err := os.MkdirAll(newHookDir, 0777); err != nil {
+			return nil, errgo.Mask(err)
+		}
+		// The new hook may be a symbolic link to the
+		// runhook binary, so remove it rather than
+		// writing through it.
+		newPath := filepath.Join(newHookDir, name)
+		if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+			return nil, errgo.Mask(err)
+		}
+		if err := ioutil.WriteFile(newPath, data, info.Mode().Perm()); err != nil {
+			return nil, errgo.Mask(err)
+		}
+		delete(manifest.Hooks, name)
+	}
+	return manifest, nil
+}
+
+// readHooks returns the contents of all the hook files
+// in the given directory, keyed by hook name.
+func readHooks(dir string) (map[string][]byte, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	hooks := make(map[string][]byte)
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			if Verbose {
+				log.Printf("skipping %s: not a regular file", filepath.Join(dir, info.Name()))
+			}
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		hooks[info.Name()] = data
+	}
+	return hooks, nil
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lineDiff returns a unified-diff-style description of the
+// differences between the lines of a and b, which are
+// labelled with the given names.
+func lineDiff(a, b []byte, aName, bName string) string {
+	al := strings.SplitAfter(string(a), "\n")
+	bl := strings.SplitAfter(string(b), "\n")
+	// lcs[i][j] holds the length of the longest common
+	// subsequence of al[i:] and bl[j:].
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			switch {
+			case al[i] == bl[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	line := func(prefix, s string) {
+		if s == "" {
+			return
+		}
+		out.WriteString(prefix + strings.TrimSuffix(s, "\n") + "\n")
+	}
+	i, j := 0, 0
+	for i < len(al) && j < len(bl) {
+		switch {
+		case al[i] == bl[j]:
+			line(" ", al[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line("-", al[i])
+			i++
+		default:
+			line("+", bl[j])
+			j++
+		}
+	}
+	for ; i < len(al); i++ {
+		line("-", al[i])
+	}
+	for ; j < len(bl); j++ {
+		line("+", bl[j])
+	}
+	return out.String()
+}
@@ -0,0 +1,172 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/juju/charm.v5"
+)
+
+// docFile describes a file that the charm store expects
+// to find in the root of a charm.
+type docFile struct {
+	// names holds the acceptable names for the file;
+	// the first is used for a placeholder.
+	names []string
+
+	// placeholder returns the contents of a placeholder
+	// file for the charm with the given metadata.
+	placeholder func(meta *charm.Meta) string
+}
+
+var docFiles = []docFile{{
+	names:       []string{"README.md", "README"},
+	placeholder: readmePlaceholder,
+}, {
+	names:       []string{"icon.svg"},
+	placeholder: iconPlaceholder,
+}, {
+	names:       []string{"copyright"},
+	placeholder: copyrightPlaceholder,
+}}
+
+// placeholderMarker is included in all placeholder
+// files, so that Proof can tell that they have not
+// been replaced.
+const placeholderMarker = "placeholder generated by gocharm"
+
+// missingDocFiles returns the documentation files
+// that are not present in the given directory.
+func missingDocFiles(dir string) []docFile {
+	var missing []docFile
+	for _, f := range docFiles {
+		if findDocFile(dir, f) == "" {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// findDocFile returns the path of the given documentation
+// file in dir, or the empty string if it is not found.
+func findDocFile(dir string, f docFile) string {
+	for _, name := range f.names {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// checkDocFiles checks that the documentation files are all present
+// in the charm directory. If placeholders is true, a placeholder is
+// written for each missing file; otherwise a warning is printed.
+func checkDocFiles(charmDir string, meta *charm.Meta, placeholders bool) error {
+	for _, f := range missingDocFiles(charmDir) {
+		if !placeholders {
+			Warningf("no %s found; the charm store will reject the charm (use -placeholders to generate one)", f.names[0])
+			continue
+		}
+		Warningf("generating placeholder %s; please replace it", f.names[0])
+		if err := ioutil.WriteFile(filepath.Join(charmDir, f.names[0]), []byte(f.placeholder(meta)), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readmePlaceholder(meta *charm.Meta) string {
+	return fmt.Sprintf("<!-- %s -->\n# %s\n\n%s\n\n%s\n", placeholderMarker, meta.Name, meta.Summary, meta.Description)
+}
+
+func iconPlaceholder(meta *charm.Meta) string {
+	initial := "?"
+	if meta.Name != "" {
+		initial = strings.ToUpper(meta.Name[0:1])
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!-- %s -->
+<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96" viewBox="0 0 96 96">
+<circle cx="48" cy="48" r="46" fill="#6a737d"/>
+<text x="48" y="64" font-family="sans-serif" font-size="48" text-anchor="middle" fill="#ffffff">%s</text>
+</svg>
+`, placeholderMarker, initial)
+}
+
+func copyrightPlaceholder(meta *charm.Meta) string {
+	return fmt.Sprintf("# %s\nCopyright %d the authors of the %s charm.\n", placeholderMarker, time.Now().Year(), meta.Name)
+}
+
+// Proof checks the built charm in charmDir for problems that would
+// cause it to be rejected by the charm store, in the manner of the
+// "charm proof" command. It returns the problems found.
+func Proof(charmDir string) []string {
+	var problems []string
+	addf := func(f string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(f, a...))
+	}
+	ch, err := charm.ReadCharmDir(charmDir)
+	if err != nil {
+		addf("cannot read charm: %v", err)
+		return problems
+	}
+	meta := ch.Meta()
+	if name := filepath.Base(charmDir); meta.Name != name {
+		addf("metadata name %q does not match directory name %q", meta.Name, name)
+	}
+	switch {
+	case strings.TrimSpace(meta.Summary) == "":
+		addf("metadata.yaml has no summary")
+	case strings.Contains(strings.TrimSpace(meta.Summary), "\n"):
+		addf("summary in metadata.yaml must be a single line")
+	}
+	if strings.TrimSpace(meta.Description) == "" {
+		addf("metadata.yaml has no description")
+	}
+	for _, f := range docFiles {
+		path := findDocFile(charmDir, f)
+		if path == "" {
+			addf("no %s file", f.names[0])
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			addf("cannot read %s: %v", filepath.Base(path), err)
+			continue
+		}
+		if bytes.Contains(data, []byte(placeholderMarker)) {
+			addf("%s is a placeholder", filepath.Base(path))
+		}
+		if f.names[0] == "icon.svg" && !bytes.Contains(data, []byte("<svg")) {
+			addf("icon.svg is not an SVG file")
+		}
+	}
+	var options []string
+	for name, opt := range ch.Config().Options {
+		if strings.TrimSpace(opt.Description) == "" {
+			options = append(options, name)
+		}
+	}
+	if len(options) > 0 {
+		sort.Strings(options)
+		addf("config options have no description: %s", strings.Join(options, ", "))
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(charmDir, "hooks"))
+	if err != nil {
+		addf("cannot read hooks: %v", err)
+		return problems
+	}
+	for _, info := range infos {
+		if info.Mode().IsRegular() && info.Mode()&0111 == 0 {
+			addf("hook %s is not executable", info.Name())
+		}
+	}
+	return problems
+}
@@ -0,0 +1,177 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+const proofMeta = `
+name: foo
+summary: a charm
+description: a test charm
+`
+
+var proofTests = []struct {
+	about          string
+	files          map[string]string
+	expectProblems []string
+}{{
+	about: "all ok",
+}, {
+	about: "missing documentation files",
+	files: map[string]string{
+		"README.md": "",
+		"icon.svg":  "",
+		"copyright": "",
+	},
+	expectProblems: []string{
+		"no README.md file",
+		"no icon.svg file",
+		"no copyright file",
+	},
+}, {
+	about: "README instead of README.md",
+	files: map[string]string{
+		"README.md": "",
+		"README":    "some docs",
+	},
+}, {
+	about: "placeholders",
+	files: map[string]string{
+		"README.md": readmePlaceholder(&charm.Meta{Name: "foo"}),
+		"icon.svg":  iconPlaceholder(&charm.Meta{Name: "foo"}),
+	},
+	expectProblems: []string{
+		"README.md is a placeholder",
+		"icon.svg is a placeholder",
+	},
+}, {
+	about: "icon not svg",
+	files: map[string]string{
+		"icon.svg": "PNG",
+	},
+	expectProblems: []string{"icon.svg is not an SVG file"},
+}, {
+	about: "bad metadata",
+	files: map[string]string{
+		"metadata.yaml": "name: bar\nsummary: ''\ndescription: ' '\n",
+	},
+	expectProblems: []string{
+		`metadata name "bar" does not match directory name "foo"`,
+		"metadata.yaml has no summary",
+		"metadata.yaml has no description",
+	},
+}, {
+	about: "config without descriptions",
+	files: map[string]string{
+		"config.yaml": "options:\n    port:\n        type: int\n    name:\n        type: string\n    title:\n        type: string\n        description: the title\n",
+	},
+	expectProblems: []string{"config options have no description: name, port"},
+}}
+
+func (suite) TestProof(c *gc.C) {
+	for i, test := range proofTests {
+		c.Logf("test %d: %s", i, test.about)
+		charmDir := proofCharm(c, test.files)
+		c.Assert(Proof(charmDir), jc.DeepEquals, test.expectProblems)
+	}
+}
+
+func (suite) TestProofNonExecutableHook(c *gc.C) {
+	charmDir := proofCharm(c, nil)
+	err := ioutil.WriteFile(filepath.Join(charmDir, "hooks", "start"), []byte("#!/bin/sh\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	c.Assert(Proof(charmDir), jc.DeepEquals, []string{"hook start is not executable"})
+}
+
+func (suite) TestProofNoCharm(c *gc.C) {
+	problems := Proof(c.MkDir())
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0], gc.Matches, "cannot read charm: .*")
+}
+
+func (suite) TestCheckDocFiles(c *gc.C) {
+	var warnings []string
+	defer setWarningf(func(f string, a ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(f, a...))
+	})()
+	meta := &charm.Meta{
+		Name:        "foo",
+		Summary:     "a charm",
+		Description: "a test charm",
+	}
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "copyright"), []byte("mine"), 0666)
+	c.Assert(err, gc.IsNil)
+
+	err = checkDocFiles(dir, meta, false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(warnings, jc.DeepEquals, []string{
+		"no README.md found; the charm store will reject the charm (use -placeholders to generate one)",
+		"no icon.svg found; the charm store will reject the charm (use -placeholders to generate one)",
+	})
+	c.Assert(missingDocFiles(dir), gc.HasLen, 2)
+
+	warnings = nil
+	err = checkDocFiles(dir, meta, true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(warnings, jc.DeepEquals, []string{
+		"generating placeholder README.md; please replace it",
+		"generating placeholder icon.svg; please replace it",
+	})
+	c.Assert(missingDocFiles(dir), gc.HasLen, 0)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "README.md"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, "(?s).*# foo\n\na charm\n\na test charm\n")
+	data, err = ioutil.ReadFile(filepath.Join(dir, "copyright"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "mine")
+}
+
+// proofCharm creates a charm directory named foo that passes
+// Proof, then applies the given files to it. A file
+// with empty contents is left out.
+func proofCharm(c *gc.C, files map[string]string) string {
+	charmDir := filepath.Join(c.MkDir(), "foo")
+	err := os.MkdirAll(filepath.Join(charmDir, "hooks"), 0777)
+	c.Assert(err, gc.IsNil)
+	all := map[string]string{
+		"metadata.yaml": proofMeta,
+		"README.md":     "# foo\n",
+		"icon.svg":      "<svg/>",
+		"copyright":     "Copyright the authors of foo.\n",
+		"hooks/install": "#!/bin/sh\n",
+	}
+	for name, data := range files {
+		all[name] = data
+	}
+	for name, data := range all {
+		if data == "" {
+			continue
+		}
+		mode := os.FileMode(0666)
+		if strings.HasPrefix(name, "hooks/") {
+			mode = 0777
+		}
+		err := ioutil.WriteFile(filepath.Join(charmDir, name), []byte(data), mode)
+		c.Assert(err, gc.IsNil)
+	}
+	return charmDir
+}
+
+// setWarningf sets Warningf to f and returns
+// a function that restores it.
+func setWarningf(f func(string, ...interface{})) func() {
+	old := Warningf
+	Warningf = f
+	return func() {
+		Warningf = old
+	}
+}
@@ -0,0 +1,119 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// RegistryFile holds the path, relative to the charm directory, of
+// the file that describes what the charm registers with its hook
+// registry. It is written as JSON, so that other tools (for example
+// dashboards, documentation generators and validators) can find out
+// what a charm does without running any of its code. Because it is
+// in a hidden directory, it is not treated as part of the charm.
+const RegistryFile = ".gocharm/registry.json"
+
+// RegistryInfo holds the contents of RegistryFile. It holds everything
+// that the charm registered, as described by hook.Registry.Describe,
+// together with the charm's package and assets. All the fields,
+// including those of charm.Relation, charm.Option and charm.Metric,
+// are encoded with their Go field names.
+type RegistryInfo struct {
+	// Package holds the import path of the package
+	// the charm was built from.
+	Package string
+
+	// CharmInfo holds what the charm registered.
+	// Its Hooks are sorted.
+	CharmInfo
+
+	// Assets holds the slash-separated paths, relative to
+	// the charm's assets directory, of the files in it, sorted.
+	Assets []string `json:",omitempty"`
+}
+
+// ReadRegistryInfo reads the registry description from the
+// given charm directory. If there is none, the returned
+// error has a cause that satisfies os.IsNotExist.
+func ReadRegistryInfo(charmDir string) (*RegistryInfo, error) {
+	data, err := ioutil.ReadFile(filepath.Join(charmDir, filepath.FromSlash(RegistryFile)))
+	if err != nil {
+		return nil, errgo.Mask(err, os.IsNotExist)
+	}
+	var r RegistryInfo
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, errgo.Notef(err, "cannot parse %s", RegistryFile)
+	}
+	return &r, nil
+}
+
+// NewRegistryInfo returns the registry description of the charm
+// built from the package with the given import path, as inspected
+// by Inspect. Assets is not set.
+func NewRegistryInfo(pkgPath string, info *CharmInfo) *RegistryInfo {
+	return &RegistryInfo{
+		Package:   pkgPath,
+		CharmInfo: *info,
+	}
+}
+
+// write writes the registry description to the given charm
+// directory, first setting r.Assets from its assets directory.
+func (r *RegistryInfo) write(charmDir string) error {
+	assets, err := assetFiles(filepath.Join(charmDir, "assets"))
+	if err != nil {
+		return errgo.Notef(err, "cannot list assets")
+	}
+	r.Assets = assets
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return errgo.Notef(err, "cannot marshal JSON")
+	}
+	file := filepath.Join(charmDir, filepath.FromSlash(RegistryFile))
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0666); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// assetFiles returns the slash-separated paths of the regular files
+// under dir, relative to it, in lexical order. Hidden files and
+// directories are left out. It returns nothing if dir does not exist.
+func assetFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return files, nil
+}
@@ -0,0 +1,56 @@
+package builder
+
+import (
+	"os"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+func (suite) TestRegistryInfoRoundTrip(c *gc.C) {
+	dir := c.MkDir()
+	_, err := ReadRegistryInfo(dir)
+	c.Assert(os.IsNotExist(errgo.Cause(err)), jc.IsTrue)
+
+	info := &CharmInfo{
+		Hooks: []string{"db-relation-joined", "install", "start"},
+		Relations: map[string]charm.Relation{
+			"db": {
+				Name:      "db",
+				Role:      charm.RoleRequirer,
+				Interface: "mysql",
+				Limit:     1,
+				Scope:     charm.ScopeGlobal,
+			},
+		},
+		Config: map[string]charm.Option{
+			"port": {Type: "int", Description: "the port"},
+		},
+		Commands: []string{"root"},
+		Binaries: []string{"agent"},
+	}
+	writeFiles(c, dir, map[string]string{
+		"assets/web/index.html": "<html/>",
+		"assets/logo.png":       "png",
+		"assets/.hidden":        "x",
+	})
+	r := NewRegistryInfo("example.com/charm", info)
+	err = r.write(dir)
+	c.Assert(err, gc.IsNil)
+
+	got, err := ReadRegistryInfo(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, jc.DeepEquals, &RegistryInfo{
+		Package:   "example.com/charm",
+		CharmInfo: *info,
+		Assets:    []string{"logo.png", "web/index.html"},
+	})
+}
+
+func (suite) TestAssetFilesNoDirectory(c *gc.C) {
+	files, err := assetFiles(c.MkDir() + "/assets")
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, gc.HasLen, 0)
+}
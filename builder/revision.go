@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// Values for Params.RevisionFrom.
+const (
+	// RevisionBump increments the revision found in the
+	// charm repository, if there is one. This is the default.
+	RevisionBump = "bump"
+
+	// RevisionFromGit uses the number of commits in the
+	// history of the package's git repository.
+	RevisionFromGit = "git"
+
+	// RevisionFromGitTag uses the most recent tag reachable
+	// from the current commit of the package's git repository,
+	// which must be a number, optionally prefixed with "v" or "r".
+	RevisionFromGitTag = "git-tag"
+)
+
+// revisionTagPattern matches the tags that can be used
+// with RevisionFromGitTag. The submatch holds the revision.
+var revisionTagPattern = regexp.MustCompile(`^[vr]?([0-9]+)$`)
+
+// nextRevision returns the revision to give the charm built
+// from the package in pkgDir, according to the given strategy
+// (one of the RevisionBump, RevisionFromGit or RevisionFromGitTag
+// constants, or empty for RevisionBump), when the revision in
+// the charm repository is currently oldRev.
+func nextRevision(strategy, pkgDir string, oldRev int) (int, error) {
+	switch strategy {
+	case "", RevisionBump:
+		if oldRev == -1 {
+			return -1, nil
+		}
+		return oldRev + 1, nil
+	case RevisionFromGit, RevisionFromGitTag:
+	default:
+		return 0, errgo.Newf("unknown revision strategy %q", strategy)
+	}
+	if _, ok := vcsOutput(pkgDir, "git", "rev-parse", "HEAD"); !ok {
+		return 0, errgo.Newf("cannot derive revision from git: %s is not in a git repository with any commits", pkgDir)
+	}
+	var rev int
+	if strategy == RevisionFromGit {
+		// A shallow clone has only part of the history,
+		// so its commit count would be wrong.
+		if out, _ := vcsOutput(pkgDir, "git", "rev-parse", "--is-shallow-repository"); strings.TrimSpace(out) == "true" {
+			return 0, errgo.Newf("cannot derive revision from git: %s is in a shallow clone", pkgDir)
+		}
+		out, ok := vcsOutput(pkgDir, "git", "rev-list", "--count", "HEAD")
+		if !ok {
+			return 0, errgo.New("cannot count git commits")
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(out))
+		if err != nil {
+			return 0, errgo.Newf("unexpected output from git rev-list: %q", out)
+		}
+		rev = n
+	} else {
+		out, ok := vcsOutput(pkgDir, "git", "describe", "--tags", "--abbrev=0", "--match", "*[0-9]")
+		if !ok {
+			return 0, errgo.New("cannot derive revision from git: no tag found")
+		}
+		tag := strings.TrimSpace(out)
+		m := revisionTagPattern.FindStringSubmatch(tag)
+		if m == nil {
+			return 0, errgo.Newf("cannot derive revision from git tag %q: not a number", tag)
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, errgo.Newf("cannot derive revision from git tag %q: %v", tag, err)
+		}
+		rev = n
+	}
+	if strings.HasSuffix(vcsCommit(pkgDir), "+") {
+		Warningf("%s has uncommitted changes that are not reflected in revision %d", pkgDir, rev)
+	}
+	return rev, nil
+}
@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"os/exec"
+
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestNextRevisionBump(c *gc.C) {
+	for _, strategy := range []string{"", RevisionBump} {
+		rev, err := nextRevision(strategy, c.MkDir(), 5)
+		c.Assert(err, gc.IsNil)
+		c.Assert(rev, gc.Equals, 6)
+		rev, err = nextRevision(strategy, c.MkDir(), -1)
+		c.Assert(err, gc.IsNil)
+		c.Assert(rev, gc.Equals, -1)
+	}
+	_, err := nextRevision("svn", c.MkDir(), 5)
+	c.Assert(err, gc.ErrorMatches, `unknown revision strategy "svn"`)
+}
+
+func (suite) TestNextRevisionFromGit(c *gc.C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git not found")
+	}
+	dir := c.MkDir()
+	_, err := nextRevision(RevisionFromGit, dir, 5)
+	c.Assert(err, gc.ErrorMatches, `cannot derive revision from git: .* is not in a git repository with any commits`)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		c.Assert(err, gc.IsNil, gc.Commentf("output: %s", out))
+	}
+	git("init", "-q")
+	for i := 0; i < 3; i++ {
+		git("commit", "-q", "--allow-empty", "-m", "commit")
+	}
+	// The revision does not depend on the
+	// revision in the charm repository.
+	for _, oldRev := range []int{-1, 0, 10} {
+		rev, err := nextRevision(RevisionFromGit, dir, oldRev)
+		c.Assert(err, gc.IsNil)
+		c.Assert(rev, gc.Equals, 3)
+	}
+
+	_, err = nextRevision(RevisionFromGitTag, dir, 5)
+	c.Assert(err, gc.ErrorMatches, `cannot derive revision from git: no tag found`)
+
+	git("tag", "v12")
+	git("commit", "-q", "--allow-empty", "-m", "commit")
+	git("tag", "release-candidate")
+	rev, err := nextRevision(RevisionFromGitTag, dir, 5)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rev, gc.Equals, 12)
+
+	git("tag", "beta2")
+	_, err = nextRevision(RevisionFromGitTag, dir, 5)
+	c.Assert(err, gc.ErrorMatches, `cannot derive revision from git tag "beta2": not a number`)
+}
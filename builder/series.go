@@ -0,0 +1,91 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/yaml.v1"
+)
+
+// PackageSeries returns the series declared by the series field of
+// the metadata.yaml file in the given package directory, in the
+// order they are declared, or nil if there are none. The field may
+// hold either a single series or a list of them.
+func PackageSeries(pkgDir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(pkgDir, "metadata.yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errgo.Mask(err)
+	}
+	series, err := metaSeries(data)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read metadata.yaml from %q", pkgDir)
+	}
+	return series, nil
+}
+
+// metaSeries returns the series declared in the
+// given metadata.yaml contents.
+func metaSeries(data []byte) ([]string, error) {
+	var m struct {
+		Series interface{} `yaml:"series"`
+	}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var series []string
+	switch s := m.Series.(type) {
+	case nil:
+	case string:
+		series = []string{s}
+	case []interface{}:
+		for _, v := range s {
+			vs, ok := v.(string)
+			if !ok {
+				return nil, errgo.Newf("invalid series %v", v)
+			}
+			series = append(series, vs)
+		}
+	default:
+		return nil, errgo.Newf("invalid series %v", m.Series)
+	}
+	for _, s := range series {
+		if !charm.IsValidSeries(s) {
+			return nil, errgo.Newf("invalid series %q", s)
+		}
+	}
+	return series, nil
+}
+
+// checkSeries checks that each of the features registered
+// with hook.Registry.RegisterSeries, as given by supported,
+// works on the given series.
+func checkSeries(series string, supported map[string][]string) error {
+	var unsupported []string
+	for feature, ss := range supported {
+		if !containsString(ss, series) {
+			unsupported = append(unsupported, feature)
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+	sort.Strings(unsupported)
+	return errgo.Newf("series %q is not supported by %s", series, strings.Join(unsupported, ", "))
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
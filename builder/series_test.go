@@ -0,0 +1,53 @@
+package builder
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestReadPackageMetaWithSeriesList(c *gc.C) {
+	meta, err := readPackageMeta([]byte("name: foo\nsummary: x\ndescription: some charm\nseries: [xenial, trusty]\nsubordinate: true\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "foo")
+	c.Assert(meta.Series, gc.Equals, "")
+	c.Assert(meta.Subordinate, jc.IsTrue)
+
+	meta, err = readPackageMeta([]byte("name: foo\nsummary: x\ndescription: some charm\nseries: [xenial]\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Subordinate, jc.IsFalse)
+}
+
+func (suite) TestPackageSeries(c *gc.C) {
+	dir := c.MkDir()
+	series, err := PackageSeries(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(series, gc.IsNil)
+
+	writeFiles(c, dir, map[string]string{
+		"metadata.yaml": "name: foo\nsummary: x\ndescription: some charm\nseries: [xenial, trusty]\n",
+	})
+	series, err = PackageSeries(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(series, jc.DeepEquals, []string{"xenial", "trusty"})
+
+	writeFiles(c, dir, map[string]string{
+		"metadata.yaml": "name: foo\nsummary: x\ndescription: some charm\nseries: {a: b}\n",
+	})
+	_, err = PackageSeries(dir)
+	c.Assert(err, gc.ErrorMatches, `cannot read metadata.yaml from .*: invalid series map\[a:b\]`)
+}
+
+func (suite) TestCheckSeries(c *gc.C) {
+	supported := map[string][]string{
+		"upstart service": {"precise", "trusty"},
+		"snap":            {"trusty", "xenial"},
+	}
+	err := checkSeries("trusty", supported)
+	c.Assert(err, gc.IsNil)
+	err = checkSeries("xenial", supported)
+	c.Assert(err, gc.ErrorMatches, `series "xenial" is not supported by upstart service`)
+	err = checkSeries("bionic", supported)
+	c.Assert(err, gc.ErrorMatches, `series "bionic" is not supported by snap, upstart service`)
+	err = checkSeries("bionic", nil)
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,75 @@
+package builder
+
+import (
+	"bytes"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// now is used to find the build time. It is a
+// variable so it can be changed for testing.
+var now = time.Now
+
+// stampFlags returns the linker flags that record details of the
+// build in the runhook executable, where they can be retrieved
+// with hook.BuildInfo.
+func stampFlags(charmName string, revision int, commit, series string) string {
+	rev := ""
+	if revision >= 0 {
+		rev = strconv.Itoa(revision)
+	}
+	vars := []struct {
+		name, val string
+	}{
+		{"buildCharmName", charmName},
+		{"buildRevision", rev},
+		{"buildTime", now().UTC().Format(time.RFC3339)},
+		{"buildCommit", commit},
+		{"buildSeries", series},
+	}
+	var flags []string
+	for _, v := range vars {
+		if v.val == "" {
+			continue
+		}
+		flags = append(flags, "-X", hookPackage+"."+v.name+"="+v.val)
+	}
+	return strings.Join(flags, " ")
+}
+
+// vcsCommit returns the version control commit of the source in the
+// given directory, with a "+" suffix if there are uncommitted
+// changes. Git and Mercurial are supported; it returns the empty
+// string if the commit cannot be found.
+func vcsCommit(dir string) string {
+	if out, ok := vcsOutput(dir, "git", "rev-parse", "HEAD"); ok {
+		commit := strings.TrimSpace(out)
+		if status, ok := vcsOutput(dir, "git", "status", "--porcelain", "."); ok && strings.TrimSpace(status) != "" {
+			commit += "+"
+		}
+		return commit
+	}
+	if out, ok := vcsOutput(dir, "hg", "id", "-i"); ok {
+		// Mercurial already adds a "+" suffix
+		// when there are uncommitted changes.
+		return strings.TrimSpace(out)
+	}
+	return ""
+}
+
+func vcsOutput(dir string, cmd string, args ...string) (string, bool) {
+	c := exec.Command(cmd, args...)
+	c.Dir = dir
+	var buf bytes.Buffer
+	c.Stdout = &buf
+	if err := c.Run(); err != nil {
+		if Verbose {
+			log.Printf("%s %s in %s failed: %v", cmd, strings.Join(args, " "), dir, err)
+		}
+		return "", false
+	}
+	return buf.String(), true
+}
@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestStampFlags(c *gc.C) {
+	restore := setNow(time.Date(2015, 6, 1, 10, 20, 30, 0, time.UTC))
+	defer restore()
+	flags := stampFlags("mycharm", 12, "abcdef", "xenial")
+	c.Assert(flags, gc.Equals, "-X "+hookPackage+".buildCharmName=mycharm"+
+		" -X "+hookPackage+".buildRevision=12"+
+		" -X "+hookPackage+".buildTime=2015-06-01T10:20:30Z"+
+		" -X "+hookPackage+".buildCommit=abcdef"+
+		" -X "+hookPackage+".buildSeries=xenial")
+
+	flags = stampFlags("mycharm", -1, "", "")
+	c.Assert(flags, gc.Equals, "-X "+hookPackage+".buildCharmName=mycharm"+
+		" -X "+hookPackage+".buildTime=2015-06-01T10:20:30Z")
+}
+
+func (suite) TestVCSCommit(c *gc.C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git not found")
+	}
+	dir := c.MkDir()
+	c.Assert(vcsCommit(dir), gc.Equals, "")
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=test",
+			"-c", "user.email=test@example.com",
+		}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		c.Assert(err, gc.IsNil, gc.Commentf("output: %s", out))
+		return string(out)
+	}
+	git("init", "-q")
+	err := ioutil.WriteFile(filepath.Join(dir, "foo.go"), []byte("package foo\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	git("add", "foo.go")
+	git("commit", "-q", "-m", "initial")
+	head := git("rev-parse", "HEAD")
+	head = head[:len(head)-1]
+	c.Assert(vcsCommit(dir), gc.Equals, head)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "foo.go"), []byte("package foo // changed\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	c.Assert(vcsCommit(dir), gc.Equals, head+"+")
+}
+
+func setNow(t time.Time) (restore func()) {
+	old := now
+	now = func() time.Time {
+		return t
+	}
+	return func() {
+		now = old
+	}
+}
@@ -0,0 +1,180 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// TestParams holds the parameters for Test.
+type TestParams struct {
+	// PkgPath holds the import path of the charm's
+	// package, or a path to its directory.
+	PkgPath string
+
+	// Args holds additional arguments to pass to
+	// go test, for example []string{"-run", "TestFoo"}.
+	Args []string
+
+	// CoverProfile, if non-empty, holds the name of a file
+	// to write the coverage profile of all the charm's
+	// packages to.
+	CoverProfile string
+}
+
+// Test runs the tests of the charm package and all the packages
+// under its directory, with the charm's build configuration (see
+// BuildConfig) applied, so that the tests see the same GOPATH and
+// build tags as the charm itself.
+//
+// The tests are run in isolation: the charm's source tree and the
+// packages it and its tests import are copied into a temporary
+// GOPATH, which is the only GOPATH entry when the tests run, and
+// a temporary build cache is used, so the tests cannot depend on
+// anything else that happens to be in the developer's GOPATH
+// or on build results cached from it.
+//
+// If p.CoverProfile is set, each package is tested separately with
+// coverage enabled, their profiles are merged into p.CoverProfile
+// and the total coverage of the charm is printed.
+func Test(p TestParams) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return errgo.Notef(err, "cannot get current directory")
+	}
+	pkg, err := build.Default.Import(p.PkgPath, cwd, build.FindOnly)
+	if err != nil {
+		return errgo.Notef(err, "cannot find %q", p.PkgPath)
+	}
+	cfg, err := ReadBuildConfig(pkg.Dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	goTool, err := cfg.goTool()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	// The import path is needed to place the charm
+	// in the test GOPATH.
+	if build.IsLocalImport(pkg.ImportPath) {
+		return errgo.Newf("%s is not in a GOPATH directory", pkg.Dir)
+	}
+	tempDir, err := ioutil.TempDir("", "gocharm-test")
+	if err != nil {
+		return errgo.Notef(err, "cannot make temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	gopath := filepath.Join(tempDir, "gopath")
+	testDir, err := makeTestGOPATH(cfg.buildContext(), pkg, gopath)
+	if err != nil {
+		return errgo.Notef(err, "cannot make test GOPATH")
+	}
+	env := setenv(os.Environ(), "GOPATH="+gopath)
+	env = setenv(env, "GOCACHE="+filepath.Join(tempDir, "cache"))
+	if Verbose {
+		log.Printf("testing %s in %s", pkg.ImportPath, testDir)
+	}
+	args := append([]string{"test"}, cfg.buildArgs()...)
+	args = append(args, p.Args...)
+	if p.CoverProfile == "" {
+		if err := runCmd(testDir, env, goTool, append(args, "./...")...).Run(); err != nil {
+			return errgo.New("tests failed")
+		}
+		return nil
+	}
+	listCmd := runCmd(testDir, env, goTool, "list", "./...")
+	listCmd.Stdout = nil
+	out, err := listCmd.Output()
+	if err != nil {
+		return errgo.Notef(err, "cannot list packages")
+	}
+	var profiles, failed []string
+	for i, testPkg := range strings.Fields(string(out)) {
+		profile := filepath.Join(tempDir, strconv.Itoa(i)+".out")
+		if err := runCmd(testDir, env, goTool, append(args, "-coverprofile", profile, testPkg)...).Run(); err != nil {
+			failed = append(failed, testPkg)
+		}
+		// No profile is written for packages without tests.
+		if _, err := os.Stat(profile); err == nil {
+			profiles = append(profiles, profile)
+		}
+	}
+	merged, err := mergeCoverProfiles(profiles)
+	if err != nil {
+		return errgo.Notef(err, "cannot merge coverage profiles")
+	}
+	if err := ioutil.WriteFile(p.CoverProfile, merged, 0666); err != nil {
+		return errgo.Mask(err)
+	}
+	covered, total := coverage(merged)
+	if total > 0 {
+		fmt.Fprintf(Stdout, "%s: coverage: %.1f%% of statements\n", filepath.Base(pkg.Dir), 100*float64(covered)/float64(total))
+	}
+	if len(failed) > 0 {
+		return errgo.Newf("tests failed in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// mergeCoverProfiles returns the contents of the given
+// coverage profiles, as written by go test -coverprofile,
+// merged into one profile.
+func mergeCoverProfiles(paths []string) ([]byte, error) {
+	var buf bytes.Buffer
+	mode := ""
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		lines := strings.SplitAfter(string(data), "\n")
+		if len(lines) == 0 || !strings.HasPrefix(lines[0], "mode: ") {
+			return nil, errgo.Newf("%s is not a coverage profile", path)
+		}
+		switch {
+		case mode == "":
+			mode = lines[0]
+			buf.WriteString(mode)
+		case lines[0] != mode:
+			return nil, errgo.Newf("inconsistent coverage modes %q and %q", strings.TrimSpace(mode), strings.TrimSpace(lines[0]))
+		}
+		for _, line := range lines[1:] {
+			buf.WriteString(line)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// coverage returns the number of statements covered
+// and the total number of statements in the given
+// coverage profile.
+func coverage(profile []byte) (covered, total int) {
+	scanner := bufio.NewScanner(bytes.NewReader(profile))
+	for scanner.Scan() {
+		// Each block is recorded as:
+		//	file:startline.col,endline.col numstmts count
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "mode:") {
+			continue
+		}
+		n, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		total += n
+		if count > 0 {
+			covered += n
+		}
+	}
+	return covered, total
+}
@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestMergeCoverProfiles(c *gc.C) {
+	dir := c.MkDir()
+	writeProfile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(data), 0666)
+		c.Assert(err, gc.IsNil)
+		return path
+	}
+	a := writeProfile("a.out", "mode: set\nexample.com/mycharm/a.go:3.10,5.2 2 1\nexample.com/mycharm/a.go:7.10,9.2 1 0\n")
+	b := writeProfile("b.out", "mode: set\nexample.com/mycharm/sub/b.go:3.10,5.2 3 1\n")
+	merged, err := mergeCoverProfiles([]string{a, b})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(merged), gc.Equals, `mode: set
+example.com/mycharm/a.go:3.10,5.2 2 1
+example.com/mycharm/a.go:7.10,9.2 1 0
+example.com/mycharm/sub/b.go:3.10,5.2 3 1
+`)
+	covered, total := coverage(merged)
+	c.Assert(covered, gc.Equals, 5)
+	c.Assert(total, gc.Equals, 6)
+
+	merged, err = mergeCoverProfiles(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(merged, gc.HasLen, 0)
+
+	count := writeProfile("count.out", "mode: count\n")
+	_, err = mergeCoverProfiles([]string{a, count})
+	c.Assert(err, gc.ErrorMatches, `inconsistent coverage modes "mode: set" and "mode: count"`)
+
+	bad := writeProfile("bad.out", "hello\n")
+	_, err = mergeCoverProfiles([]string{bad})
+	c.Assert(err, gc.ErrorMatches, ".*/bad.out is not a coverage profile")
+}
@@ -0,0 +1,150 @@
+package builder
+
+import (
+	"go/build"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/utils/fs"
+	"gopkg.in/errgo.v1"
+)
+
+// makeTestGOPATH populates the GOPATH directory gopath for testing
+// the charm package pkg in isolation, and returns the directory that
+// the charm package is copied to. The whole source tree of the charm
+// is copied, and so is every non-standard package imported, directly
+// or indirectly, by the packages in it or their tests, as found with
+// ctxt. Nothing else is in the GOPATH, so the tests cannot depend on
+// other packages that happen to be in the developer's GOPATH.
+func makeTestGOPATH(ctxt *build.Context, pkg *build.Package, gopath string) (string, error) {
+	destDir := filepath.Join(gopath, "src", filepath.FromSlash(pkg.ImportPath))
+	if err := copyTree(pkg.Dir, destDir); err != nil {
+		return "", errgo.Notef(err, "cannot copy charm source")
+	}
+	charmPkgs, err := packagesUnder(ctxt, pkg)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	inCharm := func(path string) bool {
+		return path == pkg.ImportPath || strings.HasPrefix(path, pkg.ImportPath+"/")
+	}
+	seen := make(map[string]bool)
+	var visit func(paths []string, srcDir string) error
+	visit = func(paths []string, srcDir string) error {
+		for _, path := range paths {
+			if path == "C" {
+				continue
+			}
+			dep, err := ctxt.Import(path, srcDir, 0)
+			if err != nil {
+				// Let go test report the missing package.
+				if Verbose {
+					log.Printf("cannot find test dependency %q: %v", path, err)
+				}
+				continue
+			}
+			// Packages in the charm, including any that it
+			// vendors, have been copied already.
+			if dep.Goroot || inCharm(dep.ImportPath) || seen[dep.ImportPath] {
+				continue
+			}
+			seen[dep.ImportPath] = true
+			if err := copyPackageFiles(dep.Dir, filepath.Join(gopath, "src", filepath.FromSlash(dep.ImportPath))); err != nil {
+				return errgo.Notef(err, "cannot copy %q", dep.ImportPath)
+			}
+			if err := visit(dep.Imports, dep.Dir); err != nil {
+				return errgo.Mask(err)
+			}
+		}
+		return nil
+	}
+	for _, p := range charmPkgs {
+		for _, imports := range [][]string{p.Imports, p.TestImports, p.XTestImports} {
+			if err := visit(imports, p.Dir); err != nil {
+				return "", errgo.Mask(err)
+			}
+		}
+	}
+	return destDir, nil
+}
+
+// packagesUnder returns the Go packages in the directory of pkg
+// and the directories below it, as matched by "go test ./...".
+func packagesUnder(ctxt *build.Context, pkg *build.Package) ([]*build.Package, error) {
+	var pkgs []*build.Package
+	err := filepath.Walk(pkg.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); path != pkg.Dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+			return filepath.SkipDir
+		}
+		p, err := ctxt.ImportDir(path, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				return nil
+			}
+			return errgo.Notef(err, "cannot import %s", path)
+		}
+		pkgs = append(pkgs, p)
+		return nil
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return pkgs, nil
+}
+
+// copyTree copies the directory tree from to the path to, leaving
+// out any version control directories. Symbolic links are copied
+// as links.
+func copyTree(from, to string) error {
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(to, rel)
+		switch {
+		case info.IsDir():
+			if vcsDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(dest, info.Mode()&os.ModePerm|0700)
+		case info.Mode()&os.ModeSymlink != 0 || info.Mode().IsRegular():
+			return fs.Copy(path, dest)
+		}
+		return nil
+	})
+}
+
+// copyPackageFiles copies the regular files in the package directory
+// from, but not its subdirectories, which hold other packages, to
+// the directory to.
+func copyPackageFiles(from, to string) error {
+	infos, err := ioutil.ReadDir(from)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.MkdirAll(to, 0777); err != nil {
+		return errgo.Mask(err)
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if err := fs.Copy(filepath.Join(from, info.Name()), filepath.Join(to, info.Name())); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
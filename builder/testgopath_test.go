@@ -0,0 +1,62 @@
+package builder
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (suite) TestMakeTestGOPATH(c *gc.C) {
+	srcGOPATH := c.MkDir()
+	writeFiles(c, filepath.Join(srcGOPATH, "src"), map[string]string{
+		"example.com/mycharm/charm.go":                         "package mycharm\nimport (\n_ \"example.com/dep\"\n_ \"fmt\"\n_ \"example.com/mycharm/sub\"\n)\n",
+		"example.com/mycharm/charm_test.go":                    "package mycharm_test\nimport _ \"example.com/testdep\"\n",
+		"example.com/mycharm/sub/sub.go":                       "package sub\nimport _ \"example.com/vendored\"\n",
+		"example.com/mycharm/vendor/example.com/vendored/v.go": "package vendored\n",
+		"example.com/mycharm/testdata/data.txt":                "data\n",
+		"example.com/mycharm/.git/HEAD":                        "ref: refs/heads/master\n",
+		"example.com/dep/dep.go":                               "package dep\nimport _ \"example.com/indirect\"\n",
+		"example.com/dep/dep_test.go":                          "package dep\nimport _ \"example.com/unused\"\n",
+		"example.com/dep/sub/sub.go":                           "package sub\n",
+		"example.com/indirect/indirect.go":                     "package indirect\n",
+		"example.com/testdep/testdep.go":                       "package testdep\n",
+		"example.com/unused/unused.go":                         "package unused\n",
+	})
+	ctxt := build.Default
+	ctxt.GOPATH = srcGOPATH
+	pkg, err := ctxt.Import("example.com/mycharm", "", 0)
+	c.Assert(err, gc.IsNil)
+
+	gopath := c.MkDir()
+	dir, err := makeTestGOPATH(&ctxt, pkg, gopath)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, filepath.Join(gopath, "src", "example.com", "mycharm"))
+
+	var files []string
+	err = filepath.Walk(gopath, func(path string, info os.FileInfo, err error) error {
+		c.Assert(err, gc.IsNil)
+		if !info.IsDir() {
+			rel, err := filepath.Rel(gopath, path)
+			c.Assert(err, gc.IsNil)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	sort.Strings(files)
+	c.Assert(files, jc.DeepEquals, []string{
+		"src/example.com/dep/dep.go",
+		"src/example.com/dep/dep_test.go",
+		"src/example.com/indirect/indirect.go",
+		"src/example.com/mycharm/charm.go",
+		"src/example.com/mycharm/charm_test.go",
+		"src/example.com/mycharm/sub/sub.go",
+		"src/example.com/mycharm/testdata/data.txt",
+		"src/example.com/mycharm/vendor/example.com/vendored/v.go",
+		"src/example.com/testdep/testdep.go",
+	})
+}
@@ -0,0 +1,206 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+// Verify checks the charm source in pkgDir with the given
+// registered information, and returns any problems found. Less
+// serious problems are printed as warnings. If charmDir is not
+// empty, it holds the installed charm directory, which is checked
+// for hooks that are out of date.
+func Verify(pkgDir, charmSeries string, info *CharmInfo, charmDir string) []string {
+	var problems []string
+	addf := func(f string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(f, a...))
+	}
+	if !charm.IsValidSeries(charmSeries) {
+		addf("invalid series %q", charmSeries)
+	}
+	// The charm must work on the series it is being verified
+	// for and on all the series that it declares.
+	series, err := PackageSeries(pkgDir)
+	if err != nil {
+		addf("%v", err)
+	}
+	if !containsString(series, charmSeries) {
+		series = append([]string{charmSeries}, series...)
+	}
+	for _, s := range series {
+		if err := checkSeries(s, info.Series); err != nil {
+			addf("%v", err)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(pkgDir, "metadata.yaml"))
+	if err != nil {
+		addf("cannot open metadata.yaml: %v", err)
+		return problems
+	}
+	meta, err := readPackageMeta(data)
+	if err != nil {
+		addf("invalid metadata.yaml: %v", err)
+		return problems
+	}
+	if err := setRelations(meta, info.Relations); err != nil {
+		addf("%v", err)
+	} else if err := checkMeta(meta); err != nil {
+		addf("%v", err)
+	}
+	if err := checkHookNames(info.Hooks, meta); err != nil {
+		addf("%v", err)
+	}
+	metrics, err := packageMetrics(pkgDir, info.Metrics)
+	if err != nil {
+		addf("%v", err)
+	} else if err := checkMetrics(info.Hooks, metrics); err != nil {
+		addf("%v", err)
+	}
+	for _, f := range missingDocFiles(pkgDir) {
+		Warningf("no %s found in %s", f.names[0], pkgDir)
+	}
+	if err := checkConfigFile(pkgDir, info.Config); err != nil {
+		addf("%v", err)
+	}
+	if _, err := packageLXDProfile(pkgDir, info.LXDProfile); err != nil {
+		addf("%v", err)
+	}
+	if binaries, err := findBinaries(&build.Default, pkgDir); err != nil {
+		addf("%v", err)
+	} else if err := checkBinaries(info.Binaries, binaries); err != nil {
+		addf("%v", err)
+	}
+	if charmDir != "" {
+		for _, p := range staleHooks(charmDir, info.Hooks, info.HookStubs) {
+			addf("%s", p)
+		}
+	}
+	return problems
+}
+
+// packageMetrics returns the metrics declared in the package's
+// metrics.yaml merged with the given registered metrics.
+func packageMetrics(pkgDir string, registered map[string]charm.Metric) (*charm.Metrics, error) {
+	metrics := &charm.Metrics{
+		Metrics: make(map[string]charm.Metric),
+	}
+	f, err := os.Open(filepath.Join(pkgDir, "metrics.yaml"))
+	switch {
+	case err == nil:
+		defer f.Close()
+		declared, err := charm.ReadMetrics(f)
+		if err != nil {
+			return nil, errgo.Notef(err, "invalid metrics.yaml")
+		}
+		for name, m := range declared.Metrics {
+			metrics.Metrics[name] = m
+		}
+	case !os.IsNotExist(err):
+		return nil, errgo.Mask(err)
+	}
+	for name, m := range registered {
+		metrics.Metrics[name] = m
+	}
+	return metrics, nil
+}
+
+// checkConfigFile checks any config.yaml file in the package
+// directory. Gocharm generates config.yaml from the registered
+// options, so any option declared there but not registered
+// would never be seen by the charm.
+func checkConfigFile(pkgDir string, registered map[string]charm.Option) error {
+	f, err := os.Open(filepath.Join(pkgDir, "config.yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errgo.Mask(err)
+	}
+	defer f.Close()
+	config, err := charm.ReadConfig(f)
+	if err != nil {
+		return errgo.Notef(err, "invalid config.yaml")
+	}
+	var unused []string
+	for name := range config.Options {
+		if _, ok := registered[name]; !ok {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	sort.Strings(unused)
+	return errgo.Newf("config.yaml declares options that are not registered: %v", unused)
+}
+
+// staleHooks returns a description of each hook in the given charm
+// directory that does not match the given registered hooks and
+// their stub details. Hooks that have been changed by hand are not
+// reported.
+func staleHooks(charmDir string, hookNames []string, stubs map[string]HookStub) []string {
+	if _, err := os.Stat(charmDir); err != nil {
+		// The charm hasn't been built yet, so
+		// nothing can be stale.
+		return nil
+	}
+	manifest, err := readHookManifest(charmDir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	existing, err := readHooks(filepath.Join(charmDir, "hooks"))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var stale []string
+	registered := make(map[string]bool)
+	for _, name := range hookNames {
+		registered[name] = true
+		data, ok := existing[name]
+		if !ok {
+			if info, err := os.Lstat(filepath.Join(charmDir, "hooks", name)); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				// A link to the runhook binary made by -dispatch.
+				continue
+			}
+			stale = append(stale, fmt.Sprintf("hook %q is registered but not present in %s", name, charmDir))
+			continue
+		}
+		if manifest == nil || manifest.Hooks[name] != hashOf(data) {
+			// Not generated by us, or changed by hand.
+			continue
+		}
+		if !isHookStub(name, stubs[name], data) {
+			stale = append(stale, fmt.Sprintf("hook %q in %s is out of date", name, charmDir))
+		}
+	}
+	if manifest != nil {
+		for name, hash := range manifest.Hooks {
+			if data, ok := existing[name]; ok && !registered[name] && hashOf(data) == hash {
+				stale = append(stale, fmt.Sprintf("hook %q in %s is no longer registered", name, charmDir))
+			}
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// isHookStub reports whether data holds the stub that
+// gocharm would currently generate for the given hook,
+// either with or without the -source flag.
+func isHookStub(hookName string, stub HookStub, data []byte) bool {
+	for _, src := range []bool{false, true} {
+		b := &charmBuilder{Source: src}
+		if bytes.Equal(b.hookStub(hookName, stub), data) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+const verifyMeta = `
+name: foo
+summary: a charm
+description: a test charm
+`
+
+var verifyTests = []struct {
+	about          string
+	series         string
+	files          map[string]string
+	info           CharmInfo
+	expectProblems []string
+}{{
+	about:  "all ok",
+	series: "trusty",
+	files: map[string]string{
+		"icon.svg": "<svg/>",
+	},
+	info: CharmInfo{
+		Hooks: []string{"install", "db-relation-changed"},
+		Relations: map[string]charm.Relation{
+			"db": {
+				Name:      "db",
+				Role:      charm.RoleRequirer,
+				Interface: "mysql",
+				Scope:     charm.ScopeGlobal,
+			},
+		},
+	},
+}, {
+	about:  "bad series",
+	series: "Trusty",
+	info: CharmInfo{
+		Hooks: []string{"install"},
+	},
+	expectProblems: []string{`invalid series "Trusty"`},
+}, {
+	about:  "hook for unknown relation",
+	series: "trusty",
+	info: CharmInfo{
+		Hooks: []string{"install", "db-relation-changed"},
+	},
+	expectProblems: []string{`hooks registered that will never be run: db-relation-changed`},
+}, {
+	about:  "collect-metrics without metrics",
+	series: "trusty",
+	info: CharmInfo{
+		Hooks: []string{"install", "collect-metrics"},
+	},
+	expectProblems: []string{`collect-metrics hook registered but no metrics declared`},
+}, {
+	about:  "metrics in metrics.yaml",
+	series: "trusty",
+	files: map[string]string{
+		"metrics.yaml": "metrics:\n    users:\n        type: gauge\n        description: number of users\n",
+	},
+	info: CharmInfo{
+		Hooks: []string{"install", "collect-metrics"},
+	},
+}, {
+	about:  "unused config options",
+	series: "trusty",
+	files: map[string]string{
+		"config.yaml": "options:\n    port:\n        type: int\n        default: 80\n    name:\n        type: string\n        default: foo\n",
+	},
+	info: CharmInfo{
+		Hooks: []string{"install"},
+		Config: map[string]charm.Option{
+			"port": {
+				Type:    "int",
+				Default: 80,
+			},
+		},
+	},
+	expectProblems: []string{`config.yaml declares options that are not registered: \[name\]`},
+}, {
+	about:  "invalid LXD profile",
+	series: "trusty",
+	files: map[string]string{
+		"lxd-profile.yaml": "config:\n    migration.stateful: \"true\"\n",
+	},
+	info: CharmInfo{
+		Hooks: []string{"install"},
+	},
+	expectProblems: []string{`invalid lxd-profile.yaml: LXD profile config "migration.stateful" not allowed in a charm`},
+}, {
+	about:  "declared series not supported by a registered feature",
+	series: "trusty",
+	files: map[string]string{
+		"metadata.yaml": verifyMeta + "series: [trusty, xenial]\n",
+	},
+	info: CharmInfo{
+		Hooks: []string{"install"},
+		Series: map[string][]string{
+			"upstart service": {"precise", "trusty"},
+		},
+	},
+	expectProblems: []string{`series "xenial" is not supported by upstart service`},
+}}
+
+func (suite) TestVerify(c *gc.C) {
+	for i, test := range verifyTests {
+		c.Logf("test %d: %s", i, test.about)
+		dir := c.MkDir()
+		err := ioutil.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte(verifyMeta), 0666)
+		c.Assert(err, gc.IsNil)
+		for name, data := range test.files {
+			err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666)
+			c.Assert(err, gc.IsNil)
+		}
+		problems := Verify(dir, test.series, &test.info, "")
+		c.Assert(problems, gc.HasLen, len(test.expectProblems), gc.Commentf("problems: %q", problems))
+		for j, p := range problems {
+			c.Assert(p, gc.Matches, test.expectProblems[j])
+		}
+	}
+}
+
+func (suite) TestStaleHooks(c *gc.C) {
+	charmDir := c.MkDir()
+	hookDir := filepath.Join(charmDir, "hooks")
+	err := os.MkdirAll(hookDir, 0777)
+	c.Assert(err, gc.IsNil)
+	b := &charmBuilder{}
+	hooks := map[string][]byte{
+		"install": b.hookStub("install", HookStub{}),
+		"start":   []byte("old stub\n"),
+		"stop":    b.hookStub("stop", HookStub{}),
+		"custom":  []byte("hand written\n"),
+	}
+	manifest := &hookManifest{
+		Hooks: make(map[string]string),
+	}
+	for name, data := range hooks {
+		err := ioutil.WriteFile(filepath.Join(hookDir, name), data, 0755)
+		c.Assert(err, gc.IsNil)
+		if name != "custom" {
+			manifest.Hooks[name] = hashOf(data)
+		}
+	}
+	err = manifest.write(charmDir)
+	c.Assert(err, gc.IsNil)
+
+	stale := staleHooks(charmDir, []string{"install", "start", "config-changed", "custom"}, nil)
+	c.Assert(stale, jc.DeepEquals, []string{
+		`hook "config-changed" is registered but not present in ` + charmDir,
+		`hook "start" in ` + charmDir + ` is out of date`,
+		`hook "stop" in ` + charmDir + ` is no longer registered`,
+	})
+
+	// A charm that has not been built has no stale hooks.
+	c.Assert(staleHooks(filepath.Join(charmDir, "nothing"), []string{"install"}, nil), gc.HasLen, 0)
+}
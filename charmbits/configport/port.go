@@ -0,0 +1,115 @@
+// The configport package opens a port chosen by a charm
+// configuration option, closing the previously opened port
+// whenever the option changes.
+//
+// For example, a charm that serves on a configurable port
+// might do:
+//
+//	var port configport.Port
+//	port.Register(r.Clone("port"), "port", "tcp", 8080)
+//	port.RegisterProvider(r.Clone("website"), "website")
+//
+// and then use port.Port() to find out which port to listen on.
+package configport
+
+import (
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/charmbits/httprelation"
+	"github.com/juju/gocharm/hook"
+)
+
+// Port manages a port that is opened according
+// to a charm configuration option.
+type Port struct {
+	ctxt      *hook.Context
+	state     portState
+	configKey string
+	protocol  string
+	sites     []*httprelation.WebsiteProvider
+}
+
+type portState struct {
+	// Port holds the most recently configured
+	// valid port, or 0 if there has been none.
+	Port int
+}
+
+// Register registers the port with the given registry. The port
+// number is read from the int configuration option with the given
+// name, which is registered with the given default, and opened
+// with the given protocol ("tcp" or "udp") using
+// hook.Registry.RegisterPorts.
+//
+// Whenever the option changes, the previously opened port is
+// closed and the new one opened. An invalid port number is
+// logged and otherwise ignored, leaving the current port open.
+func (p *Port) Register(r *hook.Registry, configKey, protocol string, defaultPort int) {
+	p.configKey = r.ConfigName(configKey)
+	p.protocol = protocol
+	r.RegisterConfig(configKey, charm.Option{
+		Type:        "int",
+		Description: "Port to listen on",
+		Default:     defaultPort,
+	})
+	r.RegisterHook("install", p.configChanged)
+	r.RegisterHook("config-changed", p.configChanged)
+	r.RegisterPorts(p.ports)
+	r.RegisterContext(p.setContext, &p.state)
+}
+
+// RegisterProvider registers the provider side of an http relation
+// with the given name, through which the unit's private address and
+// the current port are made available (see
+// httprelation.WebsiteProvider). It must be called after Register.
+func (p *Port) RegisterProvider(r *hook.Registry, relationName string) {
+	site := new(httprelation.WebsiteProvider)
+	site.Register(r, relationName)
+	p.sites = append(p.sites, site)
+}
+
+func (p *Port) setContext(ctxt *hook.Context) error {
+	p.ctxt = ctxt
+	return nil
+}
+
+// Port returns the port that is currently configured.
+// If no valid port has been configured, it returns 0.
+func (p *Port) Port() int {
+	return p.state.Port
+}
+
+// ports implements the function registered with RegisterPorts,
+// which is called after configChanged has read the port.
+func (p *Port) ports() ([]hook.PortRange, error) {
+	if p.state.Port == 0 {
+		return nil, nil
+	}
+	return []hook.PortRange{{
+		FromPort: p.state.Port,
+		ToPort:   p.state.Port,
+		Protocol: p.protocol,
+	}}, nil
+}
+
+func (p *Port) configChanged() error {
+	port, err := p.ctxt.GetConfigInt(p.configKey)
+	if err != nil {
+		return errgo.Notef(err, "cannot get %s", p.configKey)
+	}
+	if port <= 0 || port > 65535 {
+		p.ctxt.Logf("ignoring invalid %s %v", p.configKey, port)
+		return nil
+	}
+	p.state.Port = port
+	for _, site := range p.sites {
+		if site.Port() == p.state.Port {
+			continue
+		}
+		if err := site.SetPort(p.state.Port); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
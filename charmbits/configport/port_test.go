@@ -0,0 +1,119 @@
+package configport_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/charmbits/configport"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&portSuite{})
+
+type portSuite struct{}
+
+func (s *portSuite) TestRegister(c *gc.C) {
+	r := hook.NewRegistry()
+	var p configport.Port
+	p.Register(r, "port", "tcp", 8080)
+	p.RegisterProvider(r.Clone("website"), "website")
+	c.Assert(r.RegisteredConfig(), jc.DeepEquals, map[string]charm.Option{
+		"port": {
+			Type:        "int",
+			Description: "Port to listen on",
+			Default:     8080,
+		},
+	})
+	c.Assert(r.RegisteredRelations(), jc.DeepEquals, map[string]charm.Relation{
+		"website": {
+			Name:      "website",
+			Role:      charm.RoleProvider,
+			Interface: "http",
+			Scope:     charm.ScopeGlobal,
+		},
+	})
+}
+
+func (s *portSuite) TestReconcile(c *gc.C) {
+	var p *configport.Port
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			p = new(configport.Port)
+			p.Register(r.Clone("port"), "port", "tcp", 8080)
+			p.RegisterProvider(r.Clone("website"), "website")
+		},
+		RelationIds: map[string][]hook.RelationId{
+			"website": {"website:0"},
+		},
+		PrivateAddress: "10.0.0.1",
+		Config: map[string]interface{}{
+			"port": 8080,
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Port(), gc.Equals, 8080)
+	c.Assert(runner.LocalSettings, jc.DeepEquals, map[hook.RelationId]map[string]string{
+		"website:0": {"hostname": "10.0.0.1", "port": "8080"},
+	})
+
+	// The port is opened by config-changed, which
+	// always runs after install.
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.OpenedPorts, jc.DeepEquals, map[string]bool{"8080/tcp": true})
+
+	// An unchanged port does nothing.
+	runner.Record = nil
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 0)
+
+	// A new port closes the old one.
+	runner.Config["port"] = 9000
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Port(), gc.Equals, 9000)
+	c.Assert(runner.OpenedPorts, jc.DeepEquals, map[string]bool{"9000/tcp": true})
+	c.Assert(runner.LocalSettings["website:0"]["port"], gc.Equals, "9000")
+
+	// An invalid port is ignored.
+	runner.Record = nil
+	runner.Config["port"] = 70000
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 0)
+	c.Assert(p.Port(), gc.Equals, 9000)
+}
+
+func (s *portSuite) TestNamespace(c *gc.C) {
+	var admin, public configport.Port
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			admin.Register(r.Namespace("admin"), "port", "tcp", 8081)
+			public.Register(r.Namespace("public"), "port", "tcp", 8080)
+		},
+		Config: map[string]interface{}{
+			"admin-port":  9001,
+			"public-port": 80,
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(admin.Port(), gc.Equals, 9001)
+	c.Assert(public.Port(), gc.Equals, 80)
+	c.Assert(runner.OpenedPorts, jc.DeepEquals, map[string]bool{
+		"9001/tcp": true,
+		"80/tcp":   true,
+	})
+}
@@ -0,0 +1,266 @@
+// The cron package runs charm-supplied tasks on a schedule. Each
+// task is installed as an entry in a file in /etc/cron.d that runs
+// the charm's runhook executable with the name of the task, which
+// then calls the task's function.
+package cron
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// CronDir holds the directory that the cron entries are written to.
+// It is defined as a variable so that it can be changed for testing
+// purposes.
+var CronDir = "/etc/cron.d"
+
+// specialSchedules holds the schedule strings understood by cron
+// in place of the usual five time and date fields.
+var specialSchedules = map[string]bool{
+	"@reboot":   true,
+	"@yearly":   true,
+	"@annually": true,
+	"@monthly":  true,
+	"@weekly":   true,
+	"@daily":    true,
+	"@midnight": true,
+	"@hourly":   true,
+}
+
+// Scheduler installs cron entries for scheduled tasks.
+type Scheduler struct {
+	ctxt  *hook.Context
+	state schedulerState
+	tasks map[string]*task
+}
+
+type task struct {
+	spec string
+	run  func() error
+}
+
+type schedulerState struct {
+	// Schedules holds the schedules set with SetSchedule,
+	// keyed by task name. An empty schedule means that the
+	// task is disabled.
+	Schedules map[string]string
+}
+
+// Register registers the scheduler with the given registry. The cron
+// entries are brought up to date in the install, config-changed and
+// upgrade-charm hooks and removed when the unit is torn down (see
+// hook.Registry.RegisterTeardown).
+//
+// Register registers a command with the registry (see
+// hook.Registry.RegisterCommand), so the caller should normally
+// pass a registry of its own, for example r.Clone("cron").
+func (s *Scheduler) Register(r *hook.Registry) {
+	r.RegisterContext(s.setContext, &s.state)
+	r.RegisterCommand(s.runCommand)
+	r.RegisterHook("install", s.reconcile)
+	r.RegisterHook("config-changed", s.reconcile)
+	r.RegisterHook("upgrade-charm", s.reconcile)
+	r.RegisterTeardown(s.remove)
+}
+
+// RegisterScheduledTask registers a task with the given name that
+// runs f according to the given cron schedule, which holds either
+// the five time and date fields of a crontab entry (for example
+// "*/15 * * * *") or one of the special strings such as "@daily".
+// It panics if the name is already registered or the schedule is
+// invalid. It should be called when the charm's hooks are
+// registered.
+//
+// The task runs as root outside any hook, so f cannot use the hook
+// context; anything it needs to know should be saved somewhere it
+// can find it. Its output and any error are logged to syslog with
+// the unit's tag.
+func (s *Scheduler) RegisterScheduledTask(name, spec string, f func() error) {
+	if !validName(name) {
+		panic(errgo.Newf("invalid task name %q", name))
+	}
+	if !validSchedule(spec) {
+		panic(errgo.Newf("invalid schedule %q for task %q", spec, name))
+	}
+	if f == nil {
+		panic(errgo.Newf("nil function passed for task %q", name))
+	}
+	if s.tasks == nil {
+		s.tasks = make(map[string]*task)
+	}
+	if s.tasks[name] != nil {
+		panic(errgo.Newf("task %q registered twice", name))
+	}
+	s.tasks[name] = &task{
+		spec: spec,
+		run:  f,
+	}
+}
+
+// SetSchedule changes the schedule of the named task from the one it
+// was registered with, for example to one taken from the charm's
+// configuration. An empty schedule disables the task. The change
+// is remembered and the cron entries are updated immediately.
+func (s *Scheduler) SetSchedule(name, spec string) error {
+	if s.tasks[name] == nil {
+		return errgo.Newf("task %q not registered", name)
+	}
+	if spec != "" && !validSchedule(spec) {
+		return errgo.Newf("invalid schedule %q for task %q", spec, name)
+	}
+	if s.state.Schedules == nil {
+		s.state.Schedules = make(map[string]string)
+	}
+	s.state.Schedules[name] = spec
+	return s.reconcile()
+}
+
+// Schedule returns the current schedule of the named task,
+// or the empty string if it is disabled or not registered.
+func (s *Scheduler) Schedule(name string) string {
+	t := s.tasks[name]
+	if t == nil {
+		return ""
+	}
+	if spec, ok := s.state.Schedules[name]; ok {
+		return spec
+	}
+	return t.spec
+}
+
+// Run runs the named task. It is called by the command that the
+// cron entry runs, but it may also be called directly, for example
+// to run a task from an action.
+func (s *Scheduler) Run(name string) error {
+	t := s.tasks[name]
+	if t == nil {
+		return errgo.Newf("task %q not registered", name)
+	}
+	if err := t.run(); err != nil {
+		return errgo.Notef(err, "task %q failed", name)
+	}
+	return nil
+}
+
+func (s *Scheduler) setContext(ctxt *hook.Context) error {
+	s.ctxt = ctxt
+	return nil
+}
+
+// runCommand implements the command run by the cron entries.
+func (s *Scheduler) runCommand(args []string) {
+	if len(args) != 1 {
+		fatalf("expected exactly one argument, found %q", args)
+	}
+	if err := s.Run(args[0]); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// cronFile returns the path of the file that
+// holds the scheduler's cron entries.
+func (s *Scheduler) cronFile() string {
+	name := strings.TrimPrefix(s.ctxt.CommandName(), "cmd-")
+	// Cron ignores files in cron.d with dots in their names.
+	name = strings.Replace(s.ctxt.UnitTag()+"-"+name, ".", "-", -1)
+	return filepath.Join(CronDir, "gocharm-"+name)
+}
+
+// reconcile writes the cron entries for all the tasks that are
+// currently enabled, if they have changed.
+func (s *Scheduler) reconcile() error {
+	path := s.cronFile()
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errgo.Mask(err)
+	}
+	entries := s.entries()
+	if entries == string(old) {
+		return nil
+	}
+	if entries == "" {
+		return s.remove()
+	}
+	if err := os.MkdirAll(CronDir, 0755); err != nil {
+		return errgo.Mask(err)
+	}
+	// Write the file atomically so that cron never
+	// sees a partially written file.
+	tmp := filepath.Join(CronDir, "."+filepath.Base(path)+".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(entries), 0644); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// remove removes the scheduler's cron entries.
+func (s *Scheduler) remove() error {
+	if err := os.Remove(s.cronFile()); err != nil && !os.IsNotExist(err) {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// entries returns the contents of the cron file, or the
+// empty string if no tasks are enabled.
+func (s *Scheduler) entries() string {
+	var names []string
+	for name := range s.tasks {
+		if s.Schedule(name) != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	exe := filepath.Join(s.ctxt.CharmDir, "bin", "runhook")
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# generated by gocharm for %s; do not edit\n", s.ctxt.Unit)
+	fmt.Fprintf(&buf, "CHARM_DIR=%s\n", s.ctxt.CharmDir)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s root %s %s %s 2>&1 | logger -t %s-%s\n", s.Schedule(name), exe, s.ctxt.CommandName(), name, s.ctxt.UnitTag(), name)
+	}
+	return buf.String()
+}
+
+// validName reports whether name can be used as a task name.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// validSchedule reports whether spec looks like a valid cron
+// schedule. It checks only the number of fields; cron itself will
+// report anything else that is wrong.
+func validSchedule(spec string) bool {
+	if specialSchedules[spec] {
+		return true
+	}
+	// A % character is special in a crontab entry.
+	return len(strings.Fields(spec)) == 5 && !strings.ContainsAny(spec, "%\n")
+}
+
+func fatalf(f string, a ...interface{}) {
+	fmt.Fprintln(os.Stderr, fmt.Sprintf(f, a...))
+	os.Exit(1)
+}
@@ -0,0 +1,150 @@
+package cron_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/cron"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&cronSuite{})
+
+type cronSuite struct {
+	oldCronDir string
+}
+
+func (s *cronSuite) SetUpTest(c *gc.C) {
+	s.oldCronDir = cron.CronDir
+	cron.CronDir = filepath.Join(c.MkDir(), "cron.d")
+}
+
+func (s *cronSuite) TearDownTest(c *gc.C) {
+	cron.CronDir = s.oldCronDir
+}
+
+func (s *cronSuite) TestScheduler(c *gc.C) {
+	var sched cron.Scheduler
+	var runner *hooktest.Runner
+	runner = &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			sched = cron.Scheduler{}
+			sched.Register(r.Clone("cron"))
+			sched.RegisterScheduledTask("backup", "@daily", func() error { return nil })
+			sched.RegisterScheduledTask("cleanup", "*/15 * * * *", func() error { return nil })
+			r.RegisterHook("config-changed", func() error {
+				return sched.SetSchedule("backup", runner.Config["backup-schedule"].(string))
+			})
+		},
+		Config: map[string]interface{}{
+			"backup-schedule": "0 3 * * *",
+		},
+		Logger: c,
+	}
+	cronFile := filepath.Join(cron.CronDir, "gocharm-unit-someunit-0-root-cron")
+
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(cronFile)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `# generated by gocharm for someunit/0; do not edit
+CHARM_DIR=/nowhere
+@daily root /nowhere/bin/runhook cmd-root.cron backup 2>&1 | logger -t unit-someunit-0-backup
+*/15 * * * * root /nowhere/bin/runhook cmd-root.cron cleanup 2>&1 | logger -t unit-someunit-0-cleanup
+`)
+
+	// The schedule from the configuration is used from now on.
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	data, err = ioutil.ReadFile(cronFile)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, `(?s).*\n0 3 \* \* \* root /nowhere/bin/runhook cmd-root.cron backup .*`)
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(sched.Schedule("backup"), gc.Equals, "0 3 * * *")
+
+	// An empty schedule disables the task.
+	runner.Config["backup-schedule"] = ""
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	data, err = ioutil.ReadFile(cronFile)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Not(gc.Matches), `(?s).*backup.*`)
+
+	// An invalid schedule is an error.
+	runner.Config["backup-schedule"] = "every day"
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.ErrorMatches, `.*: invalid schedule "every day" for task "backup"`)
+
+	err = runner.RunHook("stop", "", "")
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(cronFile)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *cronSuite) TestRun(c *gc.C) {
+	var sched cron.Scheduler
+	ran := 0
+	sched.RegisterScheduledTask("ok", "@hourly", func() error {
+		ran++
+		return nil
+	})
+	sched.RegisterScheduledTask("fail", "@hourly", func() error {
+		return errgo.New("oops")
+	})
+	err := sched.Run("ok")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ran, gc.Equals, 1)
+	err = sched.Run("fail")
+	c.Assert(err, gc.ErrorMatches, `task "fail" failed: oops`)
+	err = sched.Run("other")
+	c.Assert(err, gc.ErrorMatches, `task "other" not registered`)
+}
+
+var registerPanicTests = []struct {
+	name        string
+	spec        string
+	expectPanic string
+}{{
+	name:        "",
+	spec:        "@daily",
+	expectPanic: `invalid task name ""`,
+}, {
+	name:        "a b",
+	spec:        "@daily",
+	expectPanic: `invalid task name "a b"`,
+}, {
+	name:        "x",
+	spec:        "* * * *",
+	expectPanic: `invalid schedule "\* \* \* \*" for task "x"`,
+}, {
+	name:        "x",
+	spec:        "* * * * * date +%s",
+	expectPanic: `invalid schedule .* for task "x"`,
+}, {
+	name:        "dup",
+	spec:        "@daily",
+	expectPanic: `task "dup" registered twice`,
+}}
+
+func (s *cronSuite) TestRegisterScheduledTaskPanics(c *gc.C) {
+	var sched cron.Scheduler
+	sched.RegisterScheduledTask("dup", "@weekly", func() error { return nil })
+	for i, test := range registerPanicTests {
+		c.Logf("test %d: %q %q", i, test.name, test.spec)
+		c.Assert(func() {
+			sched.RegisterScheduledTask(test.name, test.spec, func() error { return nil })
+		}, gc.PanicMatches, test.expectPanic)
+	}
+}
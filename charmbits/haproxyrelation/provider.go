@@ -0,0 +1,167 @@
+// The haproxyrelation package can be used in a charm whose units
+// are to be load balanced by the haproxy charm, through haproxy's
+// "reverseproxy" relation.
+//
+// Although the charm requires a reverse proxy, in Juju terms it
+// is the provider of the "http" interface, which the reverseproxy
+// relation requires. Each unit tells haproxy about the services it
+// serves by setting the "services" relation setting to a YAML list
+// of services; Provider generates that from a list of Backends.
+package haproxyrelation
+
+import (
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/yaml.v1"
+
+	"github.com/juju/gocharm/charmbits/simplerelation"
+	"github.com/juju/gocharm/hook"
+)
+
+// Backend describes a service that haproxy should balance
+// load across the units of the charm for.
+type Backend struct {
+	// Name holds the name of the service. Backends with the
+	// same name provided by different units are combined
+	// into a single haproxy service.
+	Name string
+
+	// Port holds the port that haproxy serves
+	// the service on.
+	Port int
+
+	// Options holds haproxy options for the
+	// service, for example "mode http".
+	Options []string
+
+	// ServerPort holds the port that the local
+	// unit serves the service on.
+	ServerPort int
+
+	// ServerOptions holds haproxy options for the local
+	// unit's server, for example "check inter 2000".
+	ServerOptions []string
+}
+
+// service holds a service in the form expected
+// by the haproxy charm.
+type service struct {
+	Name    string          `yaml:"service_name"`
+	Host    string          `yaml:"service_host"`
+	Port    int             `yaml:"service_port"`
+	Options []string        `yaml:"service_options,omitempty"`
+	Servers [][]interface{} `yaml:"servers"`
+}
+
+// Provider represents the backend side of
+// a relation to haproxy.
+type Provider struct {
+	prov  simplerelation.Provider
+	ctxt  *hook.Context
+	state providerState
+}
+
+type providerState struct {
+	// Backends holds the backends set by SetBackends.
+	Backends []Backend
+
+	// Services holds the services setting
+	// most recently published.
+	Services string
+}
+
+// Register registers everything necessary on r for running the
+// backend side of a relation to haproxy with the given relation
+// name.
+//
+// The services are published on all instances of the relation,
+// and published again if the unit's private address changes.
+func (p *Provider) Register(r *hook.Registry, relationName string) {
+	p.prov.Register(r.Clone("http"), relationName, "http")
+	r.RegisterHook("start", p.publish)
+	r.RegisterHook("config-changed", p.publish)
+	r.RegisterHook("upgrade-charm", p.publish)
+	r.RegisterContext(p.setContext, &p.state)
+}
+
+func (p *Provider) setContext(ctxt *hook.Context) error {
+	p.ctxt = ctxt
+	return nil
+}
+
+// SetBackends sets the services that the local unit serves and
+// publishes them to haproxy. An empty slice withdraws the unit
+// from all services.
+func (p *Provider) SetBackends(backends []Backend) error {
+	for _, b := range backends {
+		if b.Name == "" {
+			return errgo.New("backend has no name")
+		}
+		if b.Port <= 0 || b.ServerPort <= 0 {
+			return errgo.Newf("backend %q has no port", b.Name)
+		}
+	}
+	p.state.Backends = backends
+	return p.publish()
+}
+
+// Backends returns the backends most recently
+// set with SetBackends.
+func (p *Provider) Backends() []Backend {
+	return p.state.Backends
+}
+
+// publish publishes the current backends if
+// they differ from those last published.
+func (p *Provider) publish() error {
+	services := ""
+	if len(p.state.Backends) > 0 {
+		addr, err := p.ctxt.PrivateAddress()
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		data, err := marshalServices(p.state.Backends, serverName(p.ctxt.Unit), addr)
+		if err != nil {
+			return errgo.Notef(err, "cannot marshal services")
+		}
+		services = string(data)
+	}
+	if services == p.state.Services {
+		return nil
+	}
+	if err := p.prov.SetValues(map[string]string{
+		"services": services,
+	}); err != nil {
+		return errgo.Mask(err)
+	}
+	p.state.Services = services
+	return nil
+}
+
+// marshalServices returns the given backends in the form of the
+// haproxy services setting, with the local unit as the only
+// server, with the given server name and address.
+func marshalServices(backends []Backend, name, addr string) ([]byte, error) {
+	services := make([]service, len(backends))
+	for i, b := range backends {
+		server := []interface{}{name, addr, b.ServerPort}
+		if len(b.ServerOptions) > 0 {
+			server = append(server, b.ServerOptions)
+		}
+		services[i] = service{
+			Name:    b.Name,
+			Host:    "0.0.0.0",
+			Port:    b.Port,
+			Options: b.Options,
+			Servers: [][]interface{}{server},
+		}
+	}
+	return yaml.Marshal(services)
+}
+
+// serverName returns the name of the haproxy server for the given
+// unit. Haproxy does not allow "/" in server names.
+func serverName(unit hook.UnitId) string {
+	return strings.Replace(string(unit), "/", "-", -1)
+}
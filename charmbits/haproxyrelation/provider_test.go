@@ -0,0 +1,107 @@
+package haproxyrelation_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"github.com/juju/gocharm/charmbits/haproxyrelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&providerSuite{})
+
+type providerSuite struct{}
+
+func (s *providerSuite) TestSetBackends(c *gc.C) {
+	var p *haproxyrelation.Provider
+	var backends []haproxyrelation.Backend
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			p = new(haproxyrelation.Provider)
+			p.Register(r.Clone("reverseproxy"), "reverseproxy")
+			r.RegisterHook("install", func() error {
+				return p.SetBackends(backends)
+			})
+		},
+		RelationIds: map[string][]hook.RelationId{
+			"reverseproxy": {"reverseproxy:0", "reverseproxy:1"},
+		},
+		PrivateAddress: "10.0.0.1",
+		Logger:         c,
+	}
+	backends = []haproxyrelation.Backend{{
+		Name:          "web",
+		Port:          80,
+		Options:       []string{"mode http", "balance leastconn"},
+		ServerPort:    8080,
+		ServerOptions: []string{"check"},
+	}, {
+		Name:       "api",
+		Port:       8000,
+		ServerPort: 8001,
+	}}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Backends(), jc.DeepEquals, backends)
+	c.Assert(runner.LocalSettings, gc.HasLen, 2)
+	var services []map[string]interface{}
+	err = yaml.Unmarshal([]byte(runner.LocalSettings["reverseproxy:1"]["services"]), &services)
+	c.Assert(err, gc.IsNil)
+	c.Assert(services, jc.DeepEquals, []map[string]interface{}{{
+		"service_name":    "web",
+		"service_host":    "0.0.0.0",
+		"service_port":    80,
+		"service_options": []interface{}{"mode http", "balance leastconn"},
+		"servers": []interface{}{
+			[]interface{}{"someunit-0", "10.0.0.1", 8080, []interface{}{"check"}},
+		},
+	}, {
+		"service_name": "api",
+		"service_host": "0.0.0.0",
+		"service_port": 8000,
+		"servers": []interface{}{
+			[]interface{}{"someunit-0", "10.0.0.1", 8001},
+		},
+	}})
+
+	// Nothing is published when nothing has changed.
+	runner.Record = nil
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 0)
+
+	// A new address is published.
+	runner.PrivateAddress = "10.0.0.2"
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LocalSettings["reverseproxy:0"]["services"], gc.Matches, `(?s).*10\.0\.0\.2.*`)
+
+	// No backends withdraws the unit.
+	backends = nil
+	err = runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LocalSettings["reverseproxy:0"], jc.DeepEquals, map[string]string{})
+}
+
+func (s *providerSuite) TestSetBackendsInvalid(c *gc.C) {
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			var p haproxyrelation.Provider
+			p.Register(r, "reverseproxy")
+			r.RegisterHook("install", func() error {
+				return p.SetBackends([]haproxyrelation.Backend{{Name: "web"}})
+			})
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.ErrorMatches, `.*backend "web" has no port`)
+}
@@ -0,0 +1,85 @@
+// The healthcheck package runs a charm-supplied health check
+// periodically, in the update-status hook, and sets the unit's status
+// according to the result. It can also restart a service that is
+// found not to be running.
+package healthcheck
+
+import (
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// Service represents a service managed by the charm.
+// It is implemented by *service.Service
+// (from github.com/juju/gocharm/charmbits/service).
+type Service interface {
+	// Installed reports whether the service
+	// should be running.
+	Installed() bool
+
+	// Started reports whether the service is running.
+	Started() bool
+
+	// Restart stops the service if necessary
+	// and starts it again.
+	Restart() error
+}
+
+// Checker runs a health check in the update-status hook.
+type Checker struct {
+	ctxt    *hook.Context
+	check   func() error
+	service Service
+}
+
+// Register registers the checker with the given registry, so that an
+// update-status hook is generated for the charm. Each time Juju runs
+// update-status, the checker first restarts the given service if it
+// has been installed but is not running (svc may be nil if there is
+// no service to restart), then calls the check function.
+//
+// If the check function returns nil, the unit's status is set to
+// active. If it returns an error with a *hook.BlockedError cause,
+// the status is set to blocked with the given message; any other
+// error sets the status to blocked with the error's message. The
+// update-status hook itself does not fail.
+//
+// Note that the status is set on every update-status hook, so
+// if any other hook sets the unit's status, the health check
+// should take that into account.
+func (chk *Checker) Register(r *hook.Registry, svc Service, check func() error) {
+	if check == nil {
+		panic("nil check function passed to Checker.Register")
+	}
+	chk.check = check
+	chk.service = svc
+	r.RegisterContext(chk.setContext, nil)
+	r.RegisterHook(string(hook.UpdateStatus), chk.updateStatus)
+}
+
+func (chk *Checker) setContext(ctxt *hook.Context) error {
+	chk.ctxt = ctxt
+	return nil
+}
+
+func (chk *Checker) updateStatus() error {
+	if chk.service != nil && chk.service.Installed() && !chk.service.Started() {
+		chk.ctxt.Logf("service is not running; restarting it")
+		if err := chk.service.Restart(); err != nil {
+			msg := "cannot restart service: " + err.Error()
+			chk.ctxt.Logf("%s", msg)
+			return errgo.Mask(chk.ctxt.SetStatus(hook.StatusBlocked, msg))
+		}
+	}
+	err := chk.check()
+	if err == nil {
+		return errgo.Mask(chk.ctxt.SetStatus(hook.StatusActive, ""))
+	}
+	msg := err.Error()
+	if blocked, ok := errgo.Cause(err).(*hook.BlockedError); ok {
+		msg = blocked.Message
+	}
+	chk.ctxt.Logf("health check failed: %v", err)
+	return errgo.Mask(chk.ctxt.SetStatus(hook.StatusBlocked, msg))
+}
@@ -0,0 +1,125 @@
+package healthcheck_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/healthcheck"
+	"github.com/juju/gocharm/charmbits/service"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&checkerSuite{})
+
+type checkerSuite struct{}
+
+var updateStatusTests = []struct {
+	about       string
+	service     *fakeService
+	checkErr    error
+	expectCalls [][]string
+	expectStart bool
+}{{
+	about: "healthy",
+	expectCalls: [][]string{
+		{"status-set", "active", ""},
+	},
+}, {
+	about:    "unhealthy",
+	checkErr: errgo.New("cannot connect to database"),
+	expectCalls: [][]string{
+		{"status-set", "blocked", "cannot connect to database"},
+	},
+}, {
+	about:    "blocked",
+	checkErr: &hook.BlockedError{Message: "no peers"},
+	expectCalls: [][]string{
+		{"status-set", "blocked", "no peers"},
+	},
+}, {
+	about:   "service stopped",
+	service: &fakeService{installed: true},
+	expectCalls: [][]string{
+		{"status-set", "active", ""},
+	},
+	expectStart: true,
+}, {
+	about:   "service running",
+	service: &fakeService{installed: true, started: true},
+	expectCalls: [][]string{
+		{"status-set", "active", ""},
+	},
+	expectStart: true,
+}, {
+	about:   "service not installed",
+	service: &fakeService{},
+	expectCalls: [][]string{
+		{"status-set", "active", ""},
+	},
+}, {
+	about:   "service restart fails",
+	service: &fakeService{installed: true, restartErr: errgo.New("no upstart")},
+	expectCalls: [][]string{
+		{"status-set", "blocked", "cannot restart service: no upstart"},
+	},
+}}
+
+func (s *checkerSuite) TestUpdateStatus(c *gc.C) {
+	for i, test := range updateStatusTests {
+		c.Logf("test %d: %s", i, test.about)
+		var chk healthcheck.Checker
+		checked := false
+		runner := &hooktest.Runner{
+			RegisterHooks: func(r *hook.Registry) {
+				var svc healthcheck.Service
+				if test.service != nil {
+					svc = test.service
+				}
+				chk.Register(r.Clone("health"), svc, func() error {
+					checked = true
+					return test.checkErr
+				})
+			},
+			Logger: c,
+		}
+		err := runner.RunHook("update-status", "", "")
+		c.Assert(err, gc.IsNil)
+		c.Assert(runner.Record, jc.DeepEquals, test.expectCalls)
+		if test.service != nil {
+			c.Assert(test.service.started, gc.Equals, test.expectStart)
+		}
+		c.Assert(checked, gc.Equals, test.service == nil || test.service.restartErr == nil)
+	}
+}
+
+var _ healthcheck.Service = (*service.Service)(nil)
+
+type fakeService struct {
+	installed  bool
+	started    bool
+	restartErr error
+}
+
+func (svc *fakeService) Installed() bool {
+	return svc.installed
+}
+
+func (svc *fakeService) Started() bool {
+	return svc.started
+}
+
+func (svc *fakeService) Restart() error {
+	if svc.restartErr != nil {
+		return svc.restartErr
+	}
+	svc.started = true
+	return nil
+}
@@ -25,6 +25,13 @@ type Provider struct {
 	state      providerState
 	ctxt       *hook.Context
 	allowHTTPS bool
+
+	// httpPortKey, httpsPortKey and certKey hold the names of
+	// the configuration options as registered, which may be
+	// namespaced (see hook.Registry.Namespace).
+	httpPortKey  string
+	httpsPortKey string
+	certKey      string
 }
 
 // Register registers everything necessary on r for running the provider
@@ -39,6 +46,9 @@ type Provider struct {
 // configuration option.
 func (p *Provider) Register(r *hook.Registry, relationName string, allowHTTPS bool) {
 	p.allowHTTPS = allowHTTPS
+	p.httpPortKey = r.ConfigName("http-port")
+	p.httpsPortKey = r.ConfigName("https-port")
+	p.certKey = r.ConfigName("https-certificate")
 	// TODO provide https relation?
 	p.prov.Register(r.Clone("http"), relationName, "http")
 	r.RegisterConfig("http-port", charm.Option{
@@ -82,13 +92,13 @@ func (p *Provider) HTTPSPort() int {
 // HTTPSPort returns the configured port of the HTTPS server.
 // If the port has not been set, or there is no cert provided, it returns 0.
 func (p *Provider) configChanged() error {
-	if err := p.configurePort(&p.state.OpenedHTTPPort, "http-port"); err != nil {
+	if err := p.configurePort(&p.state.OpenedHTTPPort, p.httpPortKey); err != nil {
 		return errgo.Mask(err)
 	}
 	if p.allowHTTPS {
 		// If the TLSCert is invalid, ignore it.
 		if _, err := p.TLSCertPEM(); err == nil {
-			if err := p.configurePort(&p.state.OpenedHTTPSPort, "https-port"); err != nil {
+			if err := p.configurePort(&p.state.OpenedHTTPSPort, p.httpsPortKey); err != nil {
 				return errgo.Mask(err)
 			}
 		}
@@ -121,7 +131,7 @@ func (p *Provider) TLSCertPEM() (string, error) {
 	if !p.allowHTTPS {
 		return "", ErrHTTPSNotConfigured
 	}
-	certPEM, err := p.ctxt.GetConfigString("https-certificate")
+	certPEM, err := p.ctxt.GetConfigString(p.certKey)
 	if err != nil {
 		return "", errgo.Mask(err)
 	}
@@ -0,0 +1,99 @@
+package httprelation
+
+import (
+	"strconv"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/simplerelation"
+	"github.com/juju/gocharm/hook"
+)
+
+// WebsiteProvider represents the provider of an http relation for a
+// service whose port is chosen by the charm, for example one sitting
+// behind a reverse proxy such as haproxy or apache2. Unlike Provider,
+// it does not register any configuration options or open any ports.
+//
+// A charm need only do:
+//
+//	var site httprelation.WebsiteProvider
+//	site.Register(r.Clone("website"), "website")
+//
+// and call site.SetPort when the service's port is known.
+type WebsiteProvider struct {
+	prov  simplerelation.Provider
+	ctxt  *hook.Context
+	state websiteState
+}
+
+// websiteState holds the persistent state of a WebsiteProvider.
+type websiteState struct {
+	// Port holds the port set by SetPort.
+	Port int
+
+	// Hostname and PublishedPort hold the values
+	// most recently published on the relation.
+	Hostname      string
+	PublishedPort int
+}
+
+// Register registers everything necessary on r for running the
+// provider side of an http relation with the given relation name.
+//
+// The unit's private address is checked in the start, config-changed
+// and upgrade-charm hooks, so if it changes, the new address is
+// published on all instances of the relation.
+func (p *WebsiteProvider) Register(r *hook.Registry, relationName string) {
+	p.prov.Register(r.Clone("http"), relationName, "http")
+	r.RegisterHook("start", p.publish)
+	r.RegisterHook("config-changed", p.publish)
+	r.RegisterHook("upgrade-charm", p.publish)
+	r.RegisterContext(p.setContext, &p.state)
+}
+
+func (p *WebsiteProvider) setContext(ctxt *hook.Context) error {
+	p.ctxt = ctxt
+	return nil
+}
+
+// SetPort sets the port that the service listens on and publishes
+// it, along with the unit's private address, on all instances of
+// the relation. A port of 0 withdraws the service from the relation.
+func (p *WebsiteProvider) SetPort(port int) error {
+	p.state.Port = port
+	return p.publish()
+}
+
+// Port returns the port most recently set with SetPort.
+func (p *WebsiteProvider) Port() int {
+	return p.state.Port
+}
+
+// publish publishes the current address and port
+// if they differ from those last published.
+func (p *WebsiteProvider) publish() error {
+	hostname := ""
+	if p.state.Port != 0 {
+		addr, err := p.ctxt.PrivateAddress()
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		hostname = addr
+	}
+	if hostname == p.state.Hostname && p.state.Port == p.state.PublishedPort {
+		return nil
+	}
+	port := ""
+	if p.state.Port != 0 {
+		port = strconv.Itoa(p.state.Port)
+	}
+	if err := p.prov.SetValues(map[string]string{
+		"hostname": hostname,
+		"port":     port,
+	}); err != nil {
+		return errgo.Mask(err)
+	}
+	p.state.Hostname = hostname
+	p.state.PublishedPort = p.state.Port
+	return nil
+}
@@ -0,0 +1,70 @@
+package httprelation_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/charmbits/httprelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+var _ = gc.Suite(&websiteSuite{})
+
+type websiteSuite struct{}
+
+func (s *websiteSuite) TestPublish(c *gc.C) {
+	var site *httprelation.WebsiteProvider
+	port := 0
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			site = new(httprelation.WebsiteProvider)
+			site.Register(r.Clone("website"), "website")
+			r.RegisterHook("install", func() error {
+				return site.SetPort(port)
+			})
+		},
+		RelationIds: map[string][]hook.RelationId{
+			"website": {"website:0", "website:1"},
+		},
+		PrivateAddress: "10.0.0.1",
+		Logger:         c,
+	}
+	port = 8080
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(site.Port(), gc.Equals, 8080)
+	expect := map[string]string{"hostname": "10.0.0.1", "port": "8080"}
+	c.Assert(runner.LocalSettings, jc.DeepEquals, map[hook.RelationId]map[string]string{
+		"website:0": expect,
+		"website:1": expect,
+	})
+
+	// Nothing is published when nothing has changed.
+	runner.Record = nil
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 0)
+
+	// A new address is published.
+	runner.PrivateAddress = "10.0.0.2"
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LocalSettings["website:0"], jc.DeepEquals, map[string]string{
+		"hostname": "10.0.0.2",
+		"port":     "8080",
+	})
+
+	// A joining unit gets the current values.
+	runner.Record = nil
+	err = runner.RunHook("website-relation-joined", "website:1", "haproxy/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 1)
+	c.Assert(runner.Record[0][0], gc.Equals, "relation-set")
+
+	// A zero port withdraws the service.
+	port = 0
+	err = runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LocalSettings["website:1"], jc.DeepEquals, map[string]string{})
+}
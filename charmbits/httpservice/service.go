@@ -3,6 +3,38 @@
 // interact with the running service - for more control, see
 // the httprelation and service packages, which the httpservice
 // package uses for its implementation.
+//
+// Registering a Service does everything needed to run a Go HTTP
+// handler in a charm: it registers the http-port (and optionally
+// https-port and https-certificate) configuration options, opens and
+// closes ports as the configuration changes, provides an http
+// interface relation (conventionally named "website") so that
+// proxies and load balancers can find the server, and runs the server
+// under the OS service manager so that it is restarted if it fails.
+//
+// A typical charm embeds a Service and starts it from a wildcard hook:
+//
+//	type myCharm struct {
+//		svc httpservice.Service
+//	}
+//
+//	func RegisterHooks(r *hook.Registry) {
+//		var ch myCharm
+//		ch.svc.Register(r.Clone("httpservice"), "", "website", ch.handler)
+//		r.RegisterHook("*", ch.start)
+//	}
+//
+//	func (ch *myCharm) start() error {
+//		return ch.svc.Start(myParams{...})
+//	}
+//
+//	func (ch *myCharm) handler(p myParams) (http.Handler, error) {
+//		...
+//	}
+//
+// See the example-charms/helloworld and
+// example-charms/helloworld-configurable charms for
+// complete examples.
 package httpservice
 
 import (
@@ -24,7 +56,7 @@ import (
 )
 
 // Service represents an HTTP service. It provides an http
-// relation runs a Go HTTP handler as a service.
+// relation and runs a Go HTTP handler as a service.
 type Service struct {
 	ctxt    *hook.Context
 	svc     service.Service
@@ -217,7 +249,7 @@ func (svc *Service) startServer(ctxt *service.Context, args []string) {
 
 func (srv *server) start(ctxt *service.Context, args []string) error {
 	if len(args) != 4 {
-		return errgo.Newf("got %d arguments, expected 2", len(args))
+		return errgo.Newf("got %d arguments, expected 4", len(args))
 	}
 	httpPort, err := strconv.Atoi(args[0])
 	if err != nil {
@@ -0,0 +1,174 @@
+// The leadersecret package implements the common pattern of having
+// the service leader generate a secret, such as a password, once
+// and share it with all the other units of the service through the
+// leader settings.
+//
+// The secrets are only as secret as the leader settings, which
+// can be read by any unit of the service; a charm that needs to
+// pass a secret to another service should publish it on the
+// relation to that service itself.
+package leadersecret
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/juju/utils"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// ErrNotGenerated is returned as the cause of the error from
+// Secrets.GeneratePassword when the local unit is not the leader
+// and the leader has not yet generated the secret.
+var ErrNotGenerated = errgo.New("secret not yet generated")
+
+// Secrets manages secrets shared through the leader settings.
+type Secrets struct {
+	ctxt     *hook.Context
+	state    localState
+	onChange func(key string) error
+}
+
+type localState struct {
+	// Seen holds a hash of the value of each secret as
+	// last seen by the local unit, keyed by leader
+	// settings key.
+	Seen map[string]string
+}
+
+// Register registers the secrets with the given registry.
+// Any function registered with OnChange is called from
+// the leader-settings-changed hook.
+func (s *Secrets) Register(r *hook.Registry) {
+	r.RegisterContext(s.setContext, &s.state)
+	r.RegisterHook("leader-settings-changed", s.leaderSettingsChanged)
+}
+
+// OnChange registers a function to be called when the value
+// of a secret changes after the local unit has read it, for
+// example because it has been rotated with Rotate. The
+// function is called with the key of the secret that has
+// changed.
+func (s *Secrets) OnChange(f func(key string) error) {
+	s.onChange = f
+}
+
+func (s *Secrets) setContext(ctxt *hook.Context) error {
+	s.ctxt = ctxt
+	return nil
+}
+
+// GeneratePassword returns the value of the secret stored in the
+// leader setting with the given key. If there is no such setting
+// and the local unit is the leader, it generates a new random
+// password and stores it there; otherwise it returns an error
+// with an ErrNotGenerated cause, and the caller should try again
+// in a later hook (the leader-settings-changed hook will run when
+// the leader has generated the secret).
+func (s *Secrets) GeneratePassword(key string) (string, error) {
+	val, err := s.ctxt.GetLeaderSetting(key)
+	if err != nil {
+		return "", errgo.Notef(err, "cannot get secret %q", key)
+	}
+	if val != "" {
+		s.record(key, val)
+		return val, nil
+	}
+	leader, err := s.ctxt.IsLeader()
+	if err != nil {
+		return "", errgo.Notef(err, "cannot determine leadership")
+	}
+	if !leader {
+		return "", errgo.WithCausef(nil, ErrNotGenerated, "secret %q not yet generated by the leader", key)
+	}
+	val, err = s.generate(key)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return val, nil
+}
+
+// Rotate replaces the secret with the given key with a newly
+// generated random password and returns it. It may only be
+// called on the leader. The OnChange function will be called for
+// the key on each of the other units that has read the secret.
+func (s *Secrets) Rotate(key string) (string, error) {
+	leader, err := s.ctxt.IsLeader()
+	if err != nil {
+		return "", errgo.Notef(err, "cannot determine leadership")
+	}
+	if !leader {
+		return "", errgo.Newf("cannot rotate secret %q: not the leader", key)
+	}
+	val, err := s.generate(key)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return val, nil
+}
+
+// generate generates a new password and stores it
+// in the leader setting with the given key.
+func (s *Secrets) generate(key string) (string, error) {
+	val, err := utils.RandomPassword()
+	if err != nil {
+		return "", errgo.Notef(err, "cannot generate secret %q", key)
+	}
+	if err := s.ctxt.SetLeaderSettings(key, val); err != nil {
+		return "", errgo.Notef(err, "cannot store secret %q", key)
+	}
+	s.ctxt.Logf("generated secret %q", key)
+	s.record(key, val)
+	return val, nil
+}
+
+// record records that the local unit has seen the
+// given value of the secret with the given key.
+func (s *Secrets) record(key, val string) {
+	if s.state.Seen == nil {
+		s.state.Seen = make(map[string]string)
+	}
+	s.state.Seen[key] = hash(val)
+}
+
+// leaderSettingsChanged calls the OnChange function for
+// each secret whose value has changed since it was
+// last seen.
+func (s *Secrets) leaderSettingsChanged() error {
+	if len(s.state.Seen) == 0 {
+		return nil
+	}
+	settings, err := s.ctxt.GetLeaderSettings()
+	if err != nil {
+		return errgo.Notef(err, "cannot get leader settings")
+	}
+	keys := make([]string, 0, len(s.state.Seen))
+	for key := range s.state.Seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := settings[key]
+		if val == "" || hash(val) == s.state.Seen[key] {
+			continue
+		}
+		s.ctxt.Logf("secret %q has changed", key)
+		if s.onChange != nil {
+			if err := s.onChange(key); err != nil {
+				return errgo.Notef(err, "change callback failed for secret %q", key)
+			}
+		}
+		s.state.Seen[key] = hash(val)
+	}
+	return nil
+}
+
+// hash returns a hash of the given secret value, so that
+// the value itself need not be kept in the local state.
+func hash(val string) string {
+	sum := sha256.Sum256([]byte(val))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package leadersecret_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/leadersecret"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&secretSuite{})
+
+type secretSuite struct{}
+
+// secretCharm is a charm that reads a password
+// in its config-changed hook.
+type secretCharm struct {
+	secrets  leadersecret.Secrets
+	password string
+	waiting  bool
+	changed  []string
+}
+
+func (ch *secretCharm) register(r *hook.Registry) {
+	ch.secrets = leadersecret.Secrets{}
+	ch.secrets.Register(r.Clone("secrets"))
+	ch.secrets.OnChange(func(key string) error {
+		ch.changed = append(ch.changed, key)
+		return nil
+	})
+	r.RegisterHook("config-changed", func() error {
+		password, err := ch.secrets.GeneratePassword("admin-password")
+		if errgo.Cause(err) == leadersecret.ErrNotGenerated {
+			ch.waiting = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ch.password, ch.waiting = password, false
+		return nil
+	})
+}
+
+func (s *secretSuite) TestLeaderGeneratesOnce(c *gc.C) {
+	ch := &secretCharm{}
+	runner := &hooktest.Runner{
+		RegisterHooks: ch.register,
+		Leader:        true,
+		Logger:        c,
+	}
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	password := ch.password
+	c.Assert(password, gc.Not(gc.Equals), "")
+	c.Assert(runner.LeaderSettings, jc.DeepEquals, map[string]string{
+		"admin-password": password,
+	})
+
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.password, gc.Equals, password)
+
+	// Rotating the secret generates a new one.
+	var rotated string
+	runner.RegisterHooks = func(r *hook.Registry) {
+		ch.register(r)
+		r.RegisterHook("upgrade-charm", func() error {
+			var err error
+			rotated, err = ch.secrets.Rotate("admin-password")
+			return err
+		})
+	}
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(rotated, gc.Not(gc.Equals), password)
+	c.Assert(runner.LeaderSettings["admin-password"], gc.Equals, rotated)
+	c.Assert(ch.changed, gc.HasLen, 0)
+}
+
+func (s *secretSuite) TestFollowerWaitsForLeader(c *gc.C) {
+	ch := &secretCharm{}
+	runner := &hooktest.Runner{
+		RegisterHooks: ch.register,
+		Logger:        c,
+	}
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.waiting, jc.IsTrue)
+	c.Assert(runner.LeaderSettings, gc.HasLen, 0)
+
+	runner.LeaderSettings = map[string]string{
+		"admin-password": "secret1",
+	}
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.waiting, jc.IsFalse)
+	c.Assert(ch.password, gc.Equals, "secret1")
+
+	// A leader settings change that does not affect
+	// the secret is ignored.
+	runner.LeaderSettings["other"] = "x"
+	err = runner.RunHook("leader-settings-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.changed, gc.HasLen, 0)
+
+	runner.LeaderSettings["admin-password"] = "secret2"
+	err = runner.RunHook("leader-settings-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.changed, jc.DeepEquals, []string{"admin-password"})
+
+	// The change is only reported once.
+	err = runner.RunHook("leader-settings-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.changed, jc.DeepEquals, []string{"admin-password"})
+
+	// Only the leader can rotate secrets.
+	runner.RegisterHooks = func(r *hook.Registry) {
+		ch.register(r)
+		r.RegisterHook("upgrade-charm", func() error {
+			_, err := ch.secrets.Rotate("admin-password")
+			return err
+		})
+	}
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.ErrorMatches, `.*cannot rotate secret "admin-password": not the leader`)
+}
@@ -3,6 +3,7 @@ package mongodbrelation
 
 import (
 	"net"
+	"sort"
 	"strings"
 
 	"gopkg.in/errgo.v1"
@@ -11,35 +12,125 @@ import (
 	"github.com/juju/gocharm/hook"
 )
 
+// Servers holds the details needed to connect
+// to a MongoDB service.
+type Servers struct {
+	// Addresses holds the host:port addresses of the
+	// mongodb servers, in unit id order.
+	Addresses []string
+
+	// ReplicaSet holds the name of the replica set
+	// that the servers belong to, if any.
+	ReplicaSet string
+}
+
+// URL returns a URL suitable for passing to mgo.Dial.
+// TODO does this work with IPv6?
+func (s *Servers) URL() string {
+	u := "mongodb://" + strings.Join(s.Addresses, ",")
+	if s.ReplicaSet != "" {
+		u += "/?replicaSet=" + s.ReplicaSet
+	}
+	return u
+}
+
 // Requirer represents the requirer side of an mongodb relation.
 type Requirer struct {
-	req simplerelation.Requirer
+	req     simplerelation.Requirer
+	ctxt    *hook.Context
+	state   requirerState
+	changed func(*Servers) error
+}
+
+type requirerState struct {
+	// Servers holds the servers last
+	// passed to the changed function.
+	Servers *Servers
 }
 
 // Register registers an mongodb requirer relation with the given
 // relation name with the given hook registry.
 //
-// To find out when the host addresses change, register
-// a wildcard ("*") hook.
-func (req *Requirer) Register(r *hook.Registry, relationName string) {
-	req.req.Register(r, relationName, "mongodb")
+// If changed is not nil, it will be called whenever the mongodb
+// servers change, including when they first become available.
+// When no servers are available any more (for example because
+// the relation has been removed), it will be called with a nil
+// Servers.
+func (req *Requirer) Register(r *hook.Registry, relationName string, changed func(*Servers) error) {
+	req.changed = changed
+	req.req.Register(r.Clone("relation"), relationName, "mongodb")
+	r.RegisterContext(req.setContext, &req.state)
+	r.RegisterHook("*", req.notify)
+}
+
+func (req *Requirer) setContext(ctxt *hook.Context) error {
+	req.ctxt = ctxt
+	return nil
+}
+
+// Servers returns the current mongodb servers, or nil
+// if none are currently available. If the units disagree
+// about the replica set, the one from the first unit
+// (in unit id order) is used.
+func (req *Requirer) Servers() *Servers {
+	vals := req.req.Values()
+	units := make([]string, 0, len(vals))
+	for unit := range vals {
+		units = append(units, string(unit))
+	}
+	sort.Strings(units)
+	var servers Servers
+	for _, unit := range units {
+		unitVals := vals[hook.UnitId(unit)]
+		addr, err := unitAddress(unitVals)
+		if err != nil {
+			req.ctxt.Logf("unit %s has invalid attributes: %v", unit, err)
+			continue
+		}
+		if addr == "" {
+			continue
+		}
+		servers.Addresses = append(servers.Addresses, addr)
+		if servers.ReplicaSet == "" {
+			servers.ReplicaSet = unitVals["replset"]
+		}
+	}
+	if len(servers.Addresses) == 0 {
+		return nil
+	}
+	return &servers
 }
 
 // Addresses returns the addresses of the current mongodb servers.
 func (req *Requirer) Addresses() []string {
-	return req.req.Strings(unitAddress)
+	if servers := req.Servers(); servers != nil {
+		return servers.Addresses
+	}
+	return nil
 }
 
 // URL returns a URL suitable for passing to mgo.Dial.
 // If there are no current addresses, it returns the
 // empty string.
-// TODO does this work with IPv6?
 func (req *Requirer) URL() string {
-	addrs := req.Addresses()
-	if len(addrs) == 0 {
-		return ""
+	if servers := req.Servers(); servers != nil {
+		return servers.URL()
+	}
+	return ""
+}
+
+func (req *Requirer) notify() error {
+	servers := req.Servers()
+	if equalServers(servers, req.state.Servers) {
+		return nil
+	}
+	if req.changed != nil {
+		if err := req.changed(servers); err != nil {
+			return errgo.Mask(err)
+		}
 	}
-	return "mongodb://" + strings.Join(addrs, ",")
+	req.state.Servers = servers
+	return nil
 }
 
 func unitAddress(vals map[string]string) (string, error) {
@@ -53,3 +144,18 @@ func unitAddress(vals map[string]string) (string, error) {
 	}
 	return net.JoinHostPort(host, port), nil
 }
+
+func equalServers(s0, s1 *Servers) bool {
+	if s0 == nil || s1 == nil {
+		return s0 == s1
+	}
+	if s0.ReplicaSet != s1.ReplicaSet || len(s0.Addresses) != len(s1.Addresses) {
+		return false
+	}
+	for i, addr := range s0.Addresses {
+		if addr != s1.Addresses[i] {
+			return false
+		}
+	}
+	return true
+}
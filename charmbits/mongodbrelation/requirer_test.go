@@ -0,0 +1,86 @@
+package mongodbrelation_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/charmbits/mongodbrelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&requirerSuite{})
+
+type requirerSuite struct{}
+
+func (s *requirerSuite) TestServers(c *gc.C) {
+	var req mongodbrelation.Requirer
+	var notified []*mongodbrelation.Servers
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			req.Register(r.Clone("mongodb"), "db", func(servers *mongodbrelation.Servers) error {
+				notified = append(notified, servers)
+				return nil
+			})
+		},
+		Logger: c,
+	}
+	rel := runner.AddRelation("db", "db:0")
+
+	// A unit with no port is ignored.
+	err := rel.Join("mongodb/1", map[string]string{
+		"hostname": "10.0.0.3",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, gc.HasLen, 0)
+	c.Assert(req.URL(), gc.Equals, "")
+
+	err = rel.Join("mongodb/0", map[string]string{
+		"hostname": "10.0.0.2",
+		"port":     "27017",
+		"replset":  "rs0",
+	})
+	c.Assert(err, gc.IsNil)
+	expect0 := &mongodbrelation.Servers{
+		Addresses:  []string{"10.0.0.2:27017"},
+		ReplicaSet: "rs0",
+	}
+	c.Assert(notified, jc.DeepEquals, []*mongodbrelation.Servers{expect0})
+
+	err = rel.Change("mongodb/1", map[string]string{
+		"port": "27018",
+	})
+	c.Assert(err, gc.IsNil)
+	expect1 := &mongodbrelation.Servers{
+		Addresses:  []string{"10.0.0.2:27017", "10.0.0.3:27018"},
+		ReplicaSet: "rs0",
+	}
+	c.Assert(notified, jc.DeepEquals, []*mongodbrelation.Servers{expect0, expect1})
+	c.Assert(req.Servers(), jc.DeepEquals, expect1)
+	c.Assert(req.Addresses(), jc.DeepEquals, expect1.Addresses)
+	c.Assert(req.URL(), gc.Equals, "mongodb://10.0.0.2:27017,10.0.0.3:27018/?replicaSet=rs0")
+
+	// An unrelated change does not notify.
+	err = rel.Change("mongodb/1", map[string]string{
+		"type": "database",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, gc.HasLen, 2)
+
+	err = rel.Depart("mongodb/0")
+	c.Assert(err, gc.IsNil)
+	err = rel.Depart("mongodb/1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, jc.DeepEquals, []*mongodbrelation.Servers{
+		expect0,
+		expect1,
+		{Addresses: []string{"10.0.0.3:27018"}, ReplicaSet: ""},
+		nil,
+	})
+}
@@ -0,0 +1,137 @@
+// The mysqlrelation package implements the requirer side
+// of a Juju mysql relation.
+package mysqlrelation
+
+import (
+	"net"
+	"sort"
+	"strconv"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/simplerelation"
+	"github.com/juju/gocharm/hook"
+)
+
+// defaultPort holds the port used when the
+// provider does not specify one.
+const defaultPort = 3306
+
+// Credentials holds the details needed to connect
+// to a MySQL database.
+type Credentials struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+}
+
+// DSN returns a data source name for the credentials in the
+// form used by the github.com/go-sql-driver/mysql package.
+func (c *Credentials) DSN() string {
+	return c.User + ":" + c.Password + "@tcp(" + net.JoinHostPort(c.Host, strconv.Itoa(c.Port)) + ")/" + c.Database
+}
+
+// Requirer represents the requirer side of a mysql relation.
+type Requirer struct {
+	req     simplerelation.Requirer
+	ctxt    *hook.Context
+	state   requirerState
+	changed func(*Credentials) error
+}
+
+type requirerState struct {
+	// Credentials holds the credentials last
+	// passed to the changed function.
+	Credentials *Credentials
+}
+
+// Register registers a mysql requirer relation with the given
+// relation name with the given hook registry.
+//
+// If changed is not nil, it will be called whenever the database
+// credentials change, including when they first become available.
+// When the credentials are no longer available (for example because
+// the relation has been removed), it will be called with a nil
+// Credentials.
+func (req *Requirer) Register(r *hook.Registry, relationName string, changed func(*Credentials) error) {
+	req.changed = changed
+	req.req.Register(r.Clone("relation"), relationName, "mysql")
+	r.RegisterContext(req.setContext, &req.state)
+	r.RegisterHook("*", req.notify)
+}
+
+func (req *Requirer) setContext(ctxt *hook.Context) error {
+	req.ctxt = ctxt
+	return nil
+}
+
+// Credentials returns the current credentials for the database,
+// or nil if none are currently available. If there is more than one
+// provider unit, the credentials from the first (in unit id order)
+// with complete credentials are used.
+func (req *Requirer) Credentials() *Credentials {
+	vals := req.req.Values()
+	units := make([]string, 0, len(vals))
+	for unit := range vals {
+		units = append(units, string(unit))
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		creds, err := unitCredentials(vals[hook.UnitId(unit)])
+		if err != nil {
+			req.ctxt.Logf("unit %s has invalid attributes: %v", unit, err)
+			continue
+		}
+		if creds != nil {
+			return creds
+		}
+	}
+	return nil
+}
+
+func (req *Requirer) notify() error {
+	creds := req.Credentials()
+	if equalCredentials(creds, req.state.Credentials) {
+		return nil
+	}
+	if req.changed != nil {
+		if err := req.changed(creds); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	req.state.Credentials = creds
+	return nil
+}
+
+// unitCredentials returns the credentials held in the given
+// relation settings. It returns nil if the provider has not
+// yet provided all of them.
+func unitCredentials(vals map[string]string) (*Credentials, error) {
+	creds := &Credentials{
+		Host:     vals["host"],
+		Port:     defaultPort,
+		User:     vals["user"],
+		Password: vals["password"],
+		Database: vals["database"],
+	}
+	if creds.Host == "" || creds.User == "" || creds.Password == "" || creds.Database == "" {
+		return nil, nil
+	}
+	if port := vals["port"]; port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, errgo.Newf("invalid port %q", port)
+		}
+		creds.Port = p
+	}
+	return creds, nil
+}
+
+func equalCredentials(c0, c1 *Credentials) bool {
+	if c0 == nil || c1 == nil {
+		return c0 == c1
+	}
+	return *c0 == *c1
+}
@@ -0,0 +1,71 @@
+package mysqlrelation_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/charmbits/mysqlrelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&requirerSuite{})
+
+type requirerSuite struct{}
+
+func (s *requirerSuite) TestCredentials(c *gc.C) {
+	var req mysqlrelation.Requirer
+	var notified []*mysqlrelation.Credentials
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			req.Register(r.Clone("mysql"), "db", func(creds *mysqlrelation.Credentials) error {
+				notified = append(notified, creds)
+				return nil
+			})
+		},
+		Logger: c,
+	}
+	rel := runner.AddRelation("db", "db:0")
+
+	// Incomplete credentials are ignored.
+	err := rel.Join("mysql/0", map[string]string{
+		"host": "10.0.0.1",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, gc.HasLen, 0)
+
+	err = rel.Change("mysql/0", map[string]string{
+		"user":     "u",
+		"password": "p",
+		"database": "d",
+	})
+	c.Assert(err, gc.IsNil)
+	expect := &mysqlrelation.Credentials{
+		Host:     "10.0.0.1",
+		Port:     3306,
+		User:     "u",
+		Password: "p",
+		Database: "d",
+	}
+	c.Assert(notified, jc.DeepEquals, []*mysqlrelation.Credentials{expect})
+	c.Assert(req.Credentials(), jc.DeepEquals, expect)
+	c.Assert(expect.DSN(), gc.Equals, "u:p@tcp(10.0.0.1:3306)/d")
+
+	// A change that doesn't affect the credentials
+	// doesn't trigger a notification.
+	err = rel.Change("mysql/0", map[string]string{
+		"slave": "False",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, gc.HasLen, 1)
+
+	err = rel.Break()
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, jc.DeepEquals, []*mysqlrelation.Credentials{expect, nil})
+}
@@ -0,0 +1,197 @@
+// The nrperelation package implements the provider side of the
+// nrpe-external-master and local-monitors relations, which are used
+// by the nrpe subordinate charm to monitor a service with Nagios.
+//
+// The charm registers its checks with SetChecks. When the nrpe
+// charm is related, each check is written as an NRPE command
+// definition in NRPEConfigDir and described in the "monitors"
+// relation setting, so that the Nagios server runs it.
+package nrperelation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/yaml.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+const (
+	externalMasterRelation = "nrpe-external-master"
+	localMonitorsRelation  = "local-monitors"
+)
+
+// NRPEConfigDir holds the directory that NRPE command definitions
+// are written to. It is defined as a variable so that it can be
+// changed for testing purposes.
+var NRPEConfigDir = "/etc/nagios/nrpe.d"
+
+var checkNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Check describes a Nagios check to be run by NRPE.
+type Check struct {
+	// Name holds the name of the check, for example "http".
+	// The NRPE command is named check_$name.
+	Name string
+
+	// Description holds a description of the check.
+	Description string
+
+	// Command holds the command line that runs the check,
+	// for example "/usr/lib/nagios/plugins/check_http -H localhost".
+	Command string
+}
+
+// Provider represents the provider side of the nrpe-external-master
+// and local-monitors relations.
+type Provider struct {
+	ctxt  *hook.Context
+	state providerState
+
+	// externalMaster and localMonitors hold the names of the
+	// relations as registered.
+	externalMaster string
+	localMonitors  string
+}
+
+type providerState struct {
+	// Checks holds the checks set by SetChecks.
+	Checks []Check
+
+	// Written holds the names of the NRPE command
+	// definition files that have been written.
+	Written []string
+}
+
+// Register registers the nrpe-external-master and local-monitors
+// relations and their hooks with the given registry.
+func (p *Provider) Register(r *hook.Registry) {
+	p.externalMaster = r.RelationName(externalMasterRelation)
+	p.localMonitors = r.RelationName(localMonitorsRelation)
+	for _, name := range []string{externalMasterRelation, localMonitorsRelation} {
+		r.RegisterRelation(charm.Relation{
+			Name:      name,
+			Interface: name,
+			Role:      charm.RoleProvider,
+			Scope:     charm.ScopeContainer,
+			Optional:  true,
+		})
+		r.RegisterHook(name+"-relation-joined", p.publish)
+		r.RegisterHook(name+"-relation-changed", p.publish)
+	}
+	r.RegisterHook("upgrade-charm", p.publish)
+	r.RegisterContext(p.setContext, &p.state)
+}
+
+func (p *Provider) setContext(ctxt *hook.Context) error {
+	p.ctxt = ctxt
+	return nil
+}
+
+// SetChecks sets the checks that monitor the service and
+// publishes them to any related nrpe units. Checks that were
+// previously set and are not in checks are removed.
+func (p *Provider) SetChecks(checks []Check) error {
+	seen := make(map[string]bool)
+	for _, check := range checks {
+		if !checkNamePattern.MatchString(check.Name) {
+			return errgo.Newf("invalid check name %q", check.Name)
+		}
+		if seen[check.Name] {
+			return errgo.Newf("duplicate check %q", check.Name)
+		}
+		if check.Command == "" {
+			return errgo.Newf("check %q has no command", check.Name)
+		}
+		seen[check.Name] = true
+	}
+	p.state.Checks = checks
+	return p.publish()
+}
+
+// Checks returns the checks most recently set with SetChecks.
+func (p *Provider) Checks() []Check {
+	return p.state.Checks
+}
+
+func (p *Provider) publish() error {
+	if len(p.ctxt.RelationIds[p.externalMaster]) > 0 {
+		if err := p.writeCommands(); err != nil {
+			return errgo.Notef(err, "cannot write NRPE commands")
+		}
+	}
+	monitors, err := p.monitors()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	for _, name := range []string{p.externalMaster, p.localMonitors} {
+		for _, id := range p.ctxt.RelationIds[name] {
+			if err := p.ctxt.SetRelationWithId(id, "monitors", monitors); err != nil {
+				return errgo.Mask(err)
+			}
+		}
+	}
+	return nil
+}
+
+// monitors returns the value of the monitors
+// relation setting for the current checks.
+func (p *Provider) monitors() (string, error) {
+	if len(p.state.Checks) == 0 {
+		return "", nil
+	}
+	type command struct {
+		Command string `yaml:"command"`
+	}
+	nrpe := make(map[string]command)
+	for _, check := range p.state.Checks {
+		nrpe[check.Name] = command{"check_" + check.Name}
+	}
+	data, err := yaml.Marshal(map[string]interface{}{
+		"monitors": map[string]interface{}{
+			"remote": map[string]interface{}{
+				"nrpe": nrpe,
+			},
+		},
+	})
+	if err != nil {
+		return "", errgo.Notef(err, "cannot marshal monitors")
+	}
+	return string(data), nil
+}
+
+// writeCommands writes an NRPE command definition for each
+// check and removes any previously written definitions that
+// are no longer needed.
+func (p *Provider) writeCommands() error {
+	if err := os.MkdirAll(NRPEConfigDir, 0755); err != nil {
+		return errgo.Mask(err)
+	}
+	var written []string
+	current := make(map[string]bool)
+	for _, check := range p.state.Checks {
+		name := "check_" + check.Name + ".cfg"
+		data := fmt.Sprintf("# %s\n# generated by gocharm for %s; do not edit\ncommand[check_%s]=%s\n", check.Description, p.ctxt.Unit, check.Name, check.Command)
+		if err := ioutil.WriteFile(filepath.Join(NRPEConfigDir, name), []byte(data), 0644); err != nil {
+			return errgo.Mask(err)
+		}
+		written = append(written, name)
+		current[name] = true
+	}
+	for _, name := range p.state.Written {
+		if current[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(NRPEConfigDir, name)); err != nil && !os.IsNotExist(err) {
+			return errgo.Mask(err)
+		}
+	}
+	p.state.Written = written
+	return nil
+}
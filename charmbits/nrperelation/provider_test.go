@@ -0,0 +1,147 @@
+package nrperelation_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/charmbits/nrperelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&providerSuite{})
+
+type providerSuite struct {
+	oldConfigDir string
+}
+
+func (s *providerSuite) SetUpTest(c *gc.C) {
+	s.oldConfigDir = nrperelation.NRPEConfigDir
+	nrperelation.NRPEConfigDir = filepath.Join(c.MkDir(), "nrpe.d")
+}
+
+func (s *providerSuite) TearDownTest(c *gc.C) {
+	nrperelation.NRPEConfigDir = s.oldConfigDir
+}
+
+func (s *providerSuite) TestRegister(c *gc.C) {
+	r := hook.NewRegistry()
+	var p nrperelation.Provider
+	p.Register(r)
+	c.Assert(r.RegisteredRelations(), jc.DeepEquals, map[string]charm.Relation{
+		"nrpe-external-master": {
+			Name:      "nrpe-external-master",
+			Interface: "nrpe-external-master",
+			Role:      charm.RoleProvider,
+			Scope:     charm.ScopeContainer,
+			Optional:  true,
+		},
+		"local-monitors": {
+			Name:      "local-monitors",
+			Interface: "local-monitors",
+			Role:      charm.RoleProvider,
+			Scope:     charm.ScopeContainer,
+			Optional:  true,
+		},
+	})
+}
+
+const expectMonitors = `monitors:
+  remote:
+    nrpe:
+      http:
+        command: check_http
+`
+
+func (s *providerSuite) TestSetChecks(c *gc.C) {
+	var p *nrperelation.Provider
+	var checks []nrperelation.Check
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			p = new(nrperelation.Provider)
+			p.Register(r.Clone("nrpe"))
+			r.RegisterHook("config-changed", func() error {
+				return p.SetChecks(checks)
+			})
+		},
+		Logger: c,
+	}
+	checks = []nrperelation.Check{{
+		Name:        "http",
+		Description: "web server",
+		Command:     "/usr/lib/nagios/plugins/check_http -H localhost",
+	}, {
+		Name:    "disk",
+		Command: "/usr/lib/nagios/plugins/check_disk -w 20%",
+	}}
+	// Without a relation, nothing is written.
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 0)
+	_, err = os.Stat(nrperelation.NRPEConfigDir)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+
+	// When the relation joins, the commands are written
+	// and the monitors published.
+	runner.RelationIds = map[string][]hook.RelationId{
+		"nrpe-external-master": {"nrpe-external-master:1"},
+	}
+	err = runner.RunHook("nrpe-external-master-relation-joined", "nrpe-external-master:1", "nrpe/0")
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(nrperelation.NRPEConfigDir, "check_http.cfg"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "# web server\n# generated by gocharm for someunit/0; do not edit\ncommand[check_http]=/usr/lib/nagios/plugins/check_http -H localhost\n")
+	_, err = os.Stat(filepath.Join(nrperelation.NRPEConfigDir, "check_disk.cfg"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LocalSettings["nrpe-external-master:1"]["monitors"], gc.Matches, `(?s)monitors:\n  remote:\n    nrpe:\n      disk:\n.*`)
+
+	// Removing a check removes its command.
+	checks = checks[0:1]
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LocalSettings["nrpe-external-master:1"]["monitors"], gc.Equals, expectMonitors)
+	_, err = os.Stat(filepath.Join(nrperelation.NRPEConfigDir, "check_disk.cfg"))
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+	c.Assert(p.Checks(), jc.DeepEquals, checks)
+}
+
+func (s *providerSuite) TestSetChecksInvalid(c *gc.C) {
+	tests := []struct {
+		checks      []nrperelation.Check
+		expectError string
+	}{{
+		checks:      []nrperelation.Check{{Name: "Bad Name", Command: "x"}},
+		expectError: `invalid check name "Bad Name"`,
+	}, {
+		checks:      []nrperelation.Check{{Name: "a", Command: "x"}, {Name: "a", Command: "y"}},
+		expectError: `duplicate check "a"`,
+	}, {
+		checks:      []nrperelation.Check{{Name: "a"}},
+		expectError: `check "a" has no command`,
+	}}
+	for i, test := range tests {
+		c.Logf("test %d", i)
+		runner := &hooktest.Runner{
+			RegisterHooks: func(r *hook.Registry) {
+				var p nrperelation.Provider
+				p.Register(r)
+				r.RegisterHook("install", func() error {
+					return p.SetChecks(test.checks)
+				})
+			},
+			Logger: c,
+		}
+		err := runner.RunHook("install", "", "")
+		c.Assert(err, gc.ErrorMatches, ".*"+test.expectError)
+	}
+}
@@ -0,0 +1,249 @@
+// The peerrelation package implements a peer relation that keeps
+// track of the units in the service's cluster and the settings that
+// each of them advertises.
+//
+// Juju's relation-list never includes the local unit, so a unit cannot
+// discover its own advertised settings from the relation itself; this
+// package keeps a copy of them in the unit's local state so that
+// all members, including the local unit, can be treated alike.
+package peerrelation
+
+import (
+	"sort"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// Peer represents a peer relation between the units of a service.
+type Peer struct {
+	ctxt         *hook.Context
+	relationName string
+	state        localState
+	onJoin       func(unit hook.UnitId) error
+	onLeave      func(unit hook.UnitId) error
+}
+
+type localState struct {
+	// Members holds the settings of each remote peer unit
+	// as seen when membership was last updated.
+	Members map[hook.UnitId]map[string]string
+
+	// Settings holds the settings advertised by the local unit.
+	Settings map[string]string
+
+	// Published holds the relation ids that Settings
+	// have been set on.
+	Published map[hook.RelationId]bool
+}
+
+// Register registers a peer relation with the given relation name
+// and interface with the given hook registry.
+//
+// The set of members is updated in every hook of the relation,
+// before any hooks registered after Register are called. To find out
+// when membership or a member's settings change, register a wildcard
+// ("*") hook or use OnJoin and OnLeave.
+func (p *Peer) Register(r *hook.Registry, relationName, interfaceName string) {
+	p.relationName = r.RelationName(relationName)
+	r.RegisterRelation(charm.Relation{
+		Name:      relationName,
+		Interface: interfaceName,
+		Role:      charm.RolePeer,
+		Scope:     charm.ScopeGlobal,
+	})
+	r.RegisterContext(p.setContext, &p.state)
+	r.RegisterHook(relationName+"-relation-joined", p.update)
+	r.RegisterHook(relationName+"-relation-changed", p.update)
+	r.RegisterHook(relationName+"-relation-departed", p.update)
+	r.RegisterHook(relationName+"-relation-broken", p.update)
+}
+
+// OnJoin registers a function to be called when a remote unit
+// joins the cluster. When it is called, the unit's settings
+// are available from Settings.
+func (p *Peer) OnJoin(f func(unit hook.UnitId) error) {
+	p.onJoin = f
+}
+
+// OnLeave registers a function to be called when a remote unit
+// leaves the cluster. When it is called, the unit is no longer
+// returned by Members.
+func (p *Peer) OnLeave(f func(unit hook.UnitId) error) {
+	p.onLeave = f
+}
+
+func (p *Peer) setContext(ctxt *hook.Context) error {
+	p.ctxt = ctxt
+	return nil
+}
+
+// Members returns all the units in the cluster, including the local
+// unit, sorted by unit id.
+func (p *Peer) Members() []hook.UnitId {
+	ids := []string{string(p.ctxt.Unit)}
+	for unit := range p.state.Members {
+		if unit != p.ctxt.Unit {
+			ids = append(ids, string(unit))
+		}
+	}
+	sort.Strings(ids)
+	units := make([]hook.UnitId, len(ids))
+	for i, id := range ids {
+		units[i] = hook.UnitId(id)
+	}
+	return units
+}
+
+// Settings returns the settings advertised by the given member of
+// the cluster, which may be the local unit. It returns nil if the
+// unit is not a member.
+func (p *Peer) Settings(unit hook.UnitId) map[string]string {
+	if unit == p.ctxt.Unit {
+		return copySettings(p.state.Settings)
+	}
+	if settings, ok := p.state.Members[unit]; ok {
+		return copySettings(settings)
+	}
+	return nil
+}
+
+// SetSettings sets the settings advertised by the local unit to the
+// other members of the cluster, replacing any that were previously
+// set. If the peer relation does not exist yet, the settings will be
+// advertised when it is created.
+func (p *Peer) SetSettings(settings map[string]string) error {
+	keyvals := make([]string, 0, 2*(len(settings)+len(p.state.Settings)))
+	for key := range p.state.Settings {
+		if _, ok := settings[key]; !ok {
+			keyvals = append(keyvals, key, "")
+		}
+	}
+	for key, val := range settings {
+		keyvals = append(keyvals, key, val)
+	}
+	for _, id := range p.ctxt.RelationIds[p.relationName] {
+		if !p.state.Published[id] {
+			// The settings will be set in full below.
+			continue
+		}
+		if err := p.ctxt.SetRelationWithId(id, keyvals...); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	p.state.Settings = copySettings(settings)
+	if err := p.publish(); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// publish sets the local unit's settings on any
+// instances of the relation that they have not
+// been set on yet.
+func (p *Peer) publish() error {
+	for _, id := range p.ctxt.RelationIds[p.relationName] {
+		if p.state.Published[id] {
+			continue
+		}
+		keyvals := make([]string, 0, 2*len(p.state.Settings))
+		for key, val := range p.state.Settings {
+			keyvals = append(keyvals, key, val)
+		}
+		if len(keyvals) > 0 {
+			if err := p.ctxt.SetRelationWithId(id, keyvals...); err != nil {
+				return errgo.Mask(err)
+			}
+		}
+		if p.state.Published == nil {
+			p.state.Published = make(map[hook.RelationId]bool)
+		}
+		p.state.Published[id] = true
+	}
+	return nil
+}
+
+// update brings the recorded cluster membership up to date
+// with the current relation, calling the OnJoin and OnLeave
+// functions for any units that have joined or left.
+func (p *Peer) update() error {
+	current := make(map[hook.UnitId]map[string]string)
+	for _, id := range p.ctxt.RelationIds[p.relationName] {
+		if p.ctxt.HookName == p.relationName+"-relation-broken" && id == p.ctxt.RelationId {
+			continue
+		}
+		for unit, settings := range p.ctxt.Relations[id] {
+			current[unit] = copySettings(settings)
+		}
+	}
+	for id := range p.state.Published {
+		if !hasId(p.ctxt.RelationIds[p.relationName], id) || p.ctxt.HookName == p.relationName+"-relation-broken" && id == p.ctxt.RelationId {
+			delete(p.state.Published, id)
+		}
+	}
+	if err := p.publish(); err != nil {
+		return errgo.Notef(err, "cannot publish local settings")
+	}
+	// Record the new membership before calling out, so that
+	// Members and Settings reflect the current state.
+	old := p.state.Members
+	p.state.Members = current
+	for _, unit := range sortedUnits(old) {
+		if _, ok := current[unit]; ok {
+			continue
+		}
+		p.ctxt.Logf("peer %s has left the %s relation", unit, p.relationName)
+		if p.onLeave != nil {
+			if err := p.onLeave(unit); err != nil {
+				return errgo.Notef(err, "leave callback failed for %s", unit)
+			}
+		}
+	}
+	for _, unit := range sortedUnits(current) {
+		if _, ok := old[unit]; ok {
+			continue
+		}
+		p.ctxt.Logf("peer %s has joined the %s relation", unit, p.relationName)
+		if p.onJoin != nil {
+			if err := p.onJoin(unit); err != nil {
+				return errgo.Notef(err, "join callback failed for %s", unit)
+			}
+		}
+	}
+	return nil
+}
+
+func hasId(ids []hook.RelationId, id hook.RelationId) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func copySettings(settings map[string]string) map[string]string {
+	if settings == nil {
+		return nil
+	}
+	m := make(map[string]string)
+	for key, val := range settings {
+		m[key] = val
+	}
+	return m
+}
+
+func sortedUnits(units map[hook.UnitId]map[string]string) []hook.UnitId {
+	ids := make([]string, 0, len(units))
+	for id := range units {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	unitIds := make([]hook.UnitId, len(ids))
+	for i, id := range ids {
+		unitIds[i] = hook.UnitId(id)
+	}
+	return unitIds
+}
@@ -0,0 +1,105 @@
+package peerrelation_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/charmbits/peerrelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&peerSuite{})
+
+type peerSuite struct{}
+
+func (s *peerSuite) TestMembership(c *gc.C) {
+	var p peerrelation.Peer
+	var events []string
+	settings := map[string]string{
+		"addr": "10.0.0.0",
+	}
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			p.Register(r.Clone("peer"), "cluster", "mycluster")
+			p.OnJoin(func(unit hook.UnitId) error {
+				events = append(events, "join "+string(unit)+" "+p.Settings(unit)["addr"])
+				return nil
+			})
+			p.OnLeave(func(unit hook.UnitId) error {
+				events = append(events, "leave "+string(unit))
+				return nil
+			})
+			r.RegisterHook("install", func() error {
+				return p.SetSettings(settings)
+			})
+		},
+		Logger: c,
+	}
+	// The settings are kept until the relation exists.
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 0)
+	c.Assert(p.Members(), jc.DeepEquals, []hook.UnitId{"someunit/0"})
+	c.Assert(p.Settings("someunit/0"), jc.DeepEquals, map[string]string{
+		"addr": "10.0.0.0",
+	})
+
+	rel := runner.AddRelation("cluster", "cluster:0")
+	err = rel.Join("someunit/2", map[string]string{"addr": "10.0.0.2"})
+	c.Assert(err, gc.IsNil)
+	err = rel.Join("someunit/1", map[string]string{"addr": "10.0.0.1"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(events, jc.DeepEquals, []string{
+		"join someunit/2 10.0.0.2",
+		"join someunit/1 10.0.0.1",
+	})
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"addr": "10.0.0.0",
+	})
+	c.Assert(p.Members(), jc.DeepEquals, []hook.UnitId{"someunit/0", "someunit/1", "someunit/2"})
+
+	// Changes are reflected in the member settings
+	// without triggering a join.
+	err = rel.Change("someunit/1", map[string]string{"addr": "10.0.0.11"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(events, gc.HasLen, 2)
+	c.Assert(p.Settings("someunit/1"), jc.DeepEquals, map[string]string{
+		"addr": "10.0.0.11",
+	})
+
+	// Changing local settings sets them on the relation,
+	// removing any that are no longer present.
+	settings = map[string]string{"port": "80"}
+	err = runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"port": "80",
+	})
+
+	err = rel.Depart("someunit/2")
+	c.Assert(err, gc.IsNil)
+	c.Assert(events[2:], jc.DeepEquals, []string{"leave someunit/2"})
+	c.Assert(p.Members(), jc.DeepEquals, []hook.UnitId{"someunit/0", "someunit/1"})
+	c.Assert(p.Settings("someunit/2"), gc.IsNil)
+
+	err = rel.Break()
+	c.Assert(err, gc.IsNil)
+	c.Assert(events[3:], jc.DeepEquals, []string{"leave someunit/1"})
+	c.Assert(p.Members(), jc.DeepEquals, []hook.UnitId{"someunit/0"})
+
+	// The local settings are published again when
+	// a new relation is created.
+	rel = runner.AddRelation("cluster", "cluster:1")
+	err = rel.Join("someunit/3", nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"port": "80",
+	})
+}
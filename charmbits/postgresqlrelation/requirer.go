@@ -0,0 +1,173 @@
+// The postgresqlrelation package implements the requirer side
+// of a Juju pgsql relation, as provided by the postgresql charm.
+package postgresqlrelation
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/simplerelation"
+	"github.com/juju/gocharm/hook"
+)
+
+// defaultPort holds the port used when the
+// provider does not specify one.
+const defaultPort = 5432
+
+// Credentials holds the details needed to connect
+// to a PostgreSQL database.
+type Credentials struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+}
+
+// ConnectionString returns a connection string for the
+// credentials in the form used by the github.com/lib/pq package.
+func (c *Credentials) ConnectionString() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
+		quote(c.Host),
+		c.Port,
+		quote(c.User),
+		quote(c.Password),
+		quote(c.Database),
+	)
+}
+
+// quote quotes a connection string value as described in
+// http://www.postgresql.org/docs/current/static/libpq-connect.html
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, ` '\`) {
+		return s
+	}
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
+
+// Requirer represents the requirer side of a pgsql relation.
+type Requirer struct {
+	req     simplerelation.Requirer
+	ctxt    *hook.Context
+	state   requirerState
+	changed func(*Credentials) error
+}
+
+type requirerState struct {
+	// Credentials holds the credentials last
+	// passed to the changed function.
+	Credentials *Credentials
+}
+
+// Register registers a pgsql requirer relation with the given
+// relation name with the given hook registry.
+//
+// If changed is not nil, it will be called whenever the database
+// credentials change, including when they first become available.
+// When the credentials are no longer available (for example because
+// the relation has been removed), it will be called with a nil
+// Credentials.
+func (req *Requirer) Register(r *hook.Registry, relationName string, changed func(*Credentials) error) {
+	req.changed = changed
+	req.req.Register(r.Clone("relation"), relationName, "pgsql")
+	r.RegisterContext(req.setContext, &req.state)
+	r.RegisterHook("*", req.notify)
+}
+
+func (req *Requirer) setContext(ctxt *hook.Context) error {
+	req.ctxt = ctxt
+	return nil
+}
+
+// Credentials returns the current credentials for the database, or
+// nil if none are currently available. Only the master (or
+// standalone) unit of the postgresql service is used, and only once it
+// has granted access to the local unit.
+func (req *Requirer) Credentials() *Credentials {
+	vals := req.req.Values()
+	units := make([]string, 0, len(vals))
+	for unit := range vals {
+		units = append(units, string(unit))
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		creds, err := unitCredentials(vals[hook.UnitId(unit)], req.ctxt.Unit)
+		if err != nil {
+			req.ctxt.Logf("unit %s has invalid attributes: %v", unit, err)
+			continue
+		}
+		if creds != nil {
+			return creds
+		}
+	}
+	return nil
+}
+
+func (req *Requirer) notify() error {
+	creds := req.Credentials()
+	if equalCredentials(creds, req.state.Credentials) {
+		return nil
+	}
+	if req.changed != nil {
+		if err := req.changed(creds); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	req.state.Credentials = creds
+	return nil
+}
+
+// unitCredentials returns the credentials held in the given
+// relation settings. It returns nil if the provider has not yet
+// provided all of them, is not a master, or has not yet
+// allowed access to the given local unit.
+func unitCredentials(vals map[string]string, localUnit hook.UnitId) (*Credentials, error) {
+	creds := &Credentials{
+		Host:     vals["host"],
+		Port:     defaultPort,
+		User:     vals["user"],
+		Password: vals["password"],
+		Database: vals["database"],
+	}
+	if creds.Host == "" || creds.User == "" || creds.Password == "" || creds.Database == "" {
+		return nil, nil
+	}
+	switch vals["state"] {
+	case "", "master", "standalone":
+	default:
+		return nil, nil
+	}
+	if allowed, ok := vals["allowed-units"]; ok && !contains(strings.Fields(allowed), string(localUnit)) {
+		return nil, nil
+	}
+	if port := vals["port"]; port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, errgo.Newf("invalid port %q", port)
+		}
+		creds.Port = p
+	}
+	return creds, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equalCredentials(c0, c1 *Credentials) bool {
+	if c0 == nil || c1 == nil {
+		return c0 == c1
+	}
+	return *c0 == *c1
+}
@@ -0,0 +1,75 @@
+package postgresqlrelation_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/charmbits/postgresqlrelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&requirerSuite{})
+
+type requirerSuite struct{}
+
+func (s *requirerSuite) TestCredentials(c *gc.C) {
+	var req postgresqlrelation.Requirer
+	var notified []*postgresqlrelation.Credentials
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			req.Register(r.Clone("pgsql"), "db", func(creds *postgresqlrelation.Credentials) error {
+				notified = append(notified, creds)
+				return nil
+			})
+		},
+		Logger: c,
+	}
+	rel := runner.AddRelation("db", "db:0")
+	settings := map[string]string{
+		"host":          "10.0.0.2",
+		"port":          "5433",
+		"user":          "u",
+		"password":      "secret word",
+		"database":      "d",
+		"state":         "hot standby",
+		"allowed-units": "someunit/0",
+	}
+	// A hot standby is never used.
+	err := rel.Join("postgresql/1", settings)
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, gc.HasLen, 0)
+
+	// A master that hasn't allowed the local unit
+	// access is not used either.
+	settings["state"] = "master"
+	settings["allowed-units"] = "otherunit/0"
+	err = rel.Join("postgresql/0", settings)
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, gc.HasLen, 0)
+
+	err = rel.Change("postgresql/0", map[string]string{
+		"allowed-units": "otherunit/0 someunit/0",
+	})
+	c.Assert(err, gc.IsNil)
+	expect := &postgresqlrelation.Credentials{
+		Host:     "10.0.0.2",
+		Port:     5433,
+		User:     "u",
+		Password: "secret word",
+		Database: "d",
+	}
+	c.Assert(notified, jc.DeepEquals, []*postgresqlrelation.Credentials{expect})
+	c.Assert(req.Credentials(), jc.DeepEquals, expect)
+	c.Assert(expect.ConnectionString(), gc.Equals, `host=10.0.0.2 port=5433 user=u password='secret word' dbname=d`)
+
+	err = rel.Depart("postgresql/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(notified, jc.DeepEquals, []*postgresqlrelation.Credentials{expect, nil})
+}
@@ -0,0 +1,89 @@
+// The reboot package allows a charm to reboot the machine it
+// is running on part way through its work and to carry on
+// from where it left off afterwards.
+//
+// For example, an install hook that needs a new kernel might
+// install it, then call RequestReboot("kernel-installed"). When
+// the start hook runs after the reboot, the resume function will
+// be called with "kernel-installed", and can continue
+// the installation from there.
+package reboot
+
+import (
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// Rebooter coordinates reboots requested by a charm.
+type Rebooter struct {
+	ctxt   *hook.Context
+	state  rebootState
+	resume func(point string) error
+}
+
+type rebootState struct {
+	// ResumePoint holds the resume point passed to
+	// RequestReboot.
+	ResumePoint string
+
+	// Pending records whether a reboot has been
+	// requested and not yet resumed from.
+	Pending bool
+}
+
+// Register registers the rebooter with the given registry. The
+// resume function will be called in the start hook that runs after
+// a reboot requested with RequestReboot, with the resume point that
+// was passed to RequestReboot.
+//
+// The resume function may itself call RequestReboot. If it returns
+// an error, the resume point is retained so that it will be tried
+// again the next time the start hook runs.
+func (rb *Rebooter) Register(r *hook.Registry, resume func(point string) error) {
+	rb.resume = resume
+	r.RegisterContext(rb.setContext, &rb.state)
+	r.RegisterHook("start", rb.start)
+}
+
+func (rb *Rebooter) setContext(ctxt *hook.Context) error {
+	rb.ctxt = ctxt
+	return nil
+}
+
+// RequestReboot requests that the machine be rebooted when the
+// current hook has completed, and records the given resume point
+// so that it can be passed to the resume function after the reboot.
+func (rb *Rebooter) RequestReboot(point string) error {
+	if err := rb.ctxt.Reboot(false); err != nil {
+		return errgo.Notef(err, "cannot request reboot")
+	}
+	rb.state.ResumePoint = point
+	rb.state.Pending = true
+	return nil
+}
+
+// RebootPending reports whether a reboot has been requested
+// and the charm has not yet resumed from it.
+func (rb *Rebooter) RebootPending() bool {
+	return rb.state.Pending
+}
+
+func (rb *Rebooter) start() error {
+	if !rb.state.Pending {
+		return nil
+	}
+	point := rb.state.ResumePoint
+	rb.state = rebootState{}
+	rb.ctxt.Logf("resuming after reboot at %q", point)
+	if err := rb.resume(point); err != nil {
+		if !rb.state.Pending {
+			rb.state = rebootState{
+				ResumePoint: point,
+				Pending:     true,
+			}
+		}
+		return errgo.Notef(err, "cannot resume after reboot at %q", point)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package reboot_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/reboot"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&rebootSuite{})
+
+type rebootSuite struct{}
+
+type rebootingCharm struct {
+	rb      reboot.Rebooter
+	resumed []string
+	fail    bool
+}
+
+func (ch *rebootingCharm) register(r *hook.Registry) {
+	ch.rb.Register(r.Clone("reboot"), ch.resume)
+	r.RegisterHook("install", func() error {
+		return ch.rb.RequestReboot("installed")
+	})
+}
+
+func (ch *rebootingCharm) resume(point string) error {
+	ch.resumed = append(ch.resumed, point)
+	if ch.fail {
+		return errgo.New("resume failure")
+	}
+	if point == "installed" {
+		return ch.rb.RequestReboot("configured")
+	}
+	return nil
+}
+
+func (s *rebootSuite) TestResume(c *gc.C) {
+	var ch rebootingCharm
+	runner := &hooktest.Runner{
+		RegisterHooks: ch.register,
+		Logger:        c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, jc.DeepEquals, [][]string{{"juju-reboot"}})
+	c.Assert(ch.rb.RebootPending(), gc.Equals, true)
+
+	// The first start hook resumes and asks
+	// for another reboot.
+	err = runner.RunHook("start", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.resumed, jc.DeepEquals, []string{"installed"})
+	c.Assert(runner.Record, jc.DeepEquals, [][]string{{"juju-reboot"}, {"juju-reboot"}})
+
+	// The second one resumes from the new point.
+	err = runner.RunHook("start", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.resumed, jc.DeepEquals, []string{"installed", "configured"})
+	c.Assert(ch.rb.RebootPending(), gc.Equals, false)
+
+	// Subsequent start hooks do nothing.
+	err = runner.RunHook("start", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.resumed, gc.HasLen, 2)
+}
+
+func (s *rebootSuite) TestResumeFailure(c *gc.C) {
+	ch := rebootingCharm{
+		fail: true,
+	}
+	runner := &hooktest.Runner{
+		RegisterHooks: ch.register,
+		Logger:        c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	err = runner.RunHook("start", "", "")
+	c.Assert(err, gc.ErrorMatches, `hook start \(registry root.reboot\): cannot resume after reboot at "installed": resume failure`)
+
+	// The resume point is retained so that
+	// resuming is retried.
+	ch.fail = false
+	err = runner.RunHook("start", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.resumed, jc.DeepEquals, []string{"installed", "installed"})
+}
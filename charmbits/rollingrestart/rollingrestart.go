@@ -0,0 +1,205 @@
+// The rollingrestart package coordinates restarts across the units
+// of a service so that only one unit restarts at a time, as is
+// usually needed by clustered services such as databases.
+//
+// Each unit that needs to restart asks for a restart slot by
+// advertising a request on a peer relation. The leader grants the
+// slot to one requesting unit at a time by recording it in the
+// leader settings; that unit restarts and advertises that it has
+// done so, at which point the leader grants the slot to the next
+// unit.
+package rollingrestart
+
+import (
+	"strconv"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/peerrelation"
+	"github.com/juju/gocharm/hook"
+)
+
+const (
+	// requestedKey and doneKey hold the peer relation settings
+	// used by each unit to advertise the sequence number of its
+	// latest restart request and of the latest request that it
+	// has completed.
+	requestedKey = "restart-requested"
+	doneKey      = "restart-done"
+)
+
+// RollingRestart coordinates restarts of the units
+// of a service.
+type RollingRestart struct {
+	ctxt         *hook.Context
+	peer         peerrelation.Peer
+	relationName string
+	state        localState
+	restart      func() error
+}
+
+type localState struct {
+	// Requested holds the sequence number of
+	// the latest restart requested by the unit.
+	Requested int
+
+	// Done holds the sequence number of the latest
+	// restart request that has been completed.
+	Done int
+}
+
+// Register registers the rolling restart coordinator with the given
+// registry, using a peer relation with the given relation name and
+// interface to exchange restart requests. The restart function will
+// be called to restart the local unit when it is granted the
+// restart slot.
+//
+// Restart requests are coordinated at the end of every hook, so
+// Register should be called with a registry of its own, for example
+// r.Clone("rollingrestart").
+func (rr *RollingRestart) Register(r *hook.Registry, relationName, interfaceName string, restart func() error) {
+	if restart == nil {
+		panic("nil restart function passed to RollingRestart.Register")
+	}
+	rr.relationName = relationName
+	rr.restart = restart
+	rr.peer.Register(r.Clone("peer"), relationName, interfaceName)
+	r.RegisterContext(rr.setContext, &rr.state)
+	// The leader needs to know when it becomes the leader so that
+	// it can take over granting slots, and the other units need
+	// to know when a slot is granted.
+	r.RegisterHook("leader-elected", nop)
+	r.RegisterHook("leader-settings-changed", nop)
+	r.RegisterHook("*", rr.coordinate)
+}
+
+func (rr *RollingRestart) setContext(ctxt *hook.Context) error {
+	rr.ctxt = ctxt
+	return nil
+}
+
+// RequestRestart asks for the local unit to be restarted when it is
+// its turn. The restart function passed to Register will be called
+// once for any number of requests made before the unit is granted
+// the restart slot. If the local unit is the leader and no other
+// unit holds the slot, the restart may happen at the end of the
+// current hook.
+func (rr *RollingRestart) RequestRestart() error {
+	if rr.RestartPending() {
+		return nil
+	}
+	rr.state.Requested++
+	if err := rr.publish(); err != nil {
+		return errgo.Notef(err, "cannot request restart")
+	}
+	return nil
+}
+
+// RestartPending reports whether a restart has been requested
+// for the local unit and has not yet been performed.
+func (rr *RollingRestart) RestartPending() bool {
+	return rr.state.Requested > rr.state.Done
+}
+
+// slotKey returns the name of the leader setting that
+// holds the unit that is currently allowed to restart.
+func (rr *RollingRestart) slotKey() string {
+	return rr.relationName + "-restart-slot"
+}
+
+// publish advertises the local unit's restart state
+// on the peer relation.
+func (rr *RollingRestart) publish() error {
+	return rr.peer.SetSettings(map[string]string{
+		requestedKey: strconv.Itoa(rr.state.Requested),
+		doneKey:      strconv.Itoa(rr.state.Done),
+	})
+}
+
+// coordinate restarts the local unit if it holds the restart slot
+// and, on the leader, grants the slot to the next unit waiting for
+// it.
+func (rr *RollingRestart) coordinate() error {
+	holder, err := rr.ctxt.GetLeaderSetting(rr.slotKey())
+	if err != nil {
+		return errgo.Notef(err, "cannot get restart slot")
+	}
+	if hook.UnitId(holder) == rr.ctxt.Unit {
+		if err := rr.restartLocal(); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	leader, err := rr.ctxt.IsLeader()
+	if err != nil {
+		return errgo.Notef(err, "cannot determine leadership")
+	}
+	if !leader {
+		return nil
+	}
+	// The leader can restart itself without waiting for another
+	// hook, so keep granting the slot for as long as it is the
+	// holder.
+	for {
+		next := rr.nextHolder(hook.UnitId(holder))
+		if next != hook.UnitId(holder) {
+			rr.ctxt.Logf("granting restart slot to %q", next)
+			if err := rr.ctxt.SetLeaderSettings(rr.slotKey(), string(next)); err != nil {
+				return errgo.Notef(err, "cannot grant restart slot")
+			}
+			holder = string(next)
+		}
+		if next != rr.ctxt.Unit || !rr.RestartPending() {
+			return nil
+		}
+		if err := rr.restartLocal(); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+}
+
+// restartLocal restarts the local unit if it has a pending
+// restart request, and advertises that it has done so.
+func (rr *RollingRestart) restartLocal() error {
+	if !rr.RestartPending() {
+		return nil
+	}
+	rr.ctxt.Logf("restarting in rolling restart slot")
+	if err := rr.restart(); err != nil {
+		return errgo.Notef(err, "cannot restart")
+	}
+	rr.state.Done = rr.state.Requested
+	if err := rr.publish(); err != nil {
+		return errgo.Notef(err, "cannot report restart completion")
+	}
+	return nil
+}
+
+// nextHolder returns the unit that should hold the restart slot,
+// given its current holder: the current holder if it is still
+// waiting to restart, otherwise the first member in unit order that
+// is waiting, or the empty string if no unit is waiting.
+func (rr *RollingRestart) nextHolder(holder hook.UnitId) hook.UnitId {
+	members := rr.peer.Members()
+	waiting := func(unit hook.UnitId) bool {
+		if unit == rr.ctxt.Unit {
+			return rr.RestartPending()
+		}
+		settings := rr.peer.Settings(unit)
+		return settings != nil && settings[requestedKey] != settings[doneKey]
+	}
+	for _, unit := range members {
+		if unit == holder && waiting(unit) {
+			return holder
+		}
+	}
+	for _, unit := range members {
+		if waiting(unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+func nop() error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package rollingrestart_test
+
+import (
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/charmbits/rollingrestart"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&rollingRestartSuite{})
+
+type rollingRestartSuite struct{}
+
+// restartingCharm is a charm that asks for a restart
+// in its config-changed hook.
+type restartingCharm struct {
+	rr       rollingrestart.RollingRestart
+	restarts int
+	fail     bool
+}
+
+func (ch *restartingCharm) register(r *hook.Registry) {
+	ch.rr = rollingrestart.RollingRestart{}
+	ch.rr.Register(r.Clone("rollingrestart"), "restart", "rolling-restart", func() error {
+		if ch.fail {
+			return errgo.New("restart failure")
+		}
+		ch.restarts++
+		return nil
+	})
+	r.RegisterHook("config-changed", func() error {
+		if err := ch.rr.RequestRestart(); err != nil {
+			return err
+		}
+		// A second request in the same hook makes no difference.
+		return ch.rr.RequestRestart()
+	})
+}
+
+func (s *rollingRestartSuite) newRunner(c *gc.C, ch *restartingCharm, leader bool) *hooktest.Runner {
+	return &hooktest.Runner{
+		RegisterHooks: ch.register,
+		Leader:        leader,
+		Logger:        c,
+	}
+}
+
+func (s *rollingRestartSuite) TestLeaderRestartsAlone(c *gc.C) {
+	ch := &restartingCharm{}
+	runner := s.newRunner(c, ch, true)
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.restarts, gc.Equals, 1)
+	c.Assert(ch.rr.RestartPending(), jc.IsFalse)
+	c.Assert(runner.LeaderSettings, gc.HasLen, 0)
+
+	// No restart happens unless one is requested.
+	err = runner.RunHook("leader-elected", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.restarts, gc.Equals, 1)
+}
+
+func (s *rollingRestartSuite) TestLeaderGrantsSlotsInTurn(c *gc.C) {
+	ch := &restartingCharm{}
+	runner := s.newRunner(c, ch, true)
+	rel := runner.AddRelation("restart", "restart:0")
+	err := rel.Join("someunit/1", map[string]string{"restart-requested": "1", "restart-done": "0"})
+	c.Assert(err, gc.IsNil)
+	err = rel.Join("someunit/2", map[string]string{"restart-requested": "1", "restart-done": "0"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LeaderSettings["restart-restart-slot"], gc.Equals, "someunit/1")
+
+	// The local unit waits for its turn.
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.restarts, gc.Equals, 0)
+	c.Assert(ch.rr.RestartPending(), jc.IsTrue)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"restart-requested": "1",
+		"restart-done":      "0",
+	})
+	c.Assert(runner.LeaderSettings["restart-restart-slot"], gc.Equals, "someunit/1")
+
+	// When someunit/1 has restarted, the slot passes to the
+	// local unit, which restarts immediately, and then on to
+	// someunit/2.
+	err = rel.Change("someunit/1", map[string]string{"restart-requested": "1", "restart-done": "1"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.restarts, gc.Equals, 1)
+	c.Assert(ch.rr.RestartPending(), jc.IsFalse)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"restart-requested": "1",
+		"restart-done":      "1",
+	})
+	c.Assert(runner.LeaderSettings["restart-restart-slot"], gc.Equals, "someunit/2")
+
+	// A unit that departs gives up its slot.
+	err = rel.Depart("someunit/2")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LeaderSettings["restart-restart-slot"], gc.Equals, "")
+}
+
+func (s *rollingRestartSuite) TestFollowerRestartsWhenGranted(c *gc.C) {
+	ch := &restartingCharm{}
+	runner := s.newRunner(c, ch, false)
+	rel := runner.AddRelation("restart", "restart:0")
+	err := rel.Join("someunit/1", nil)
+	c.Assert(err, gc.IsNil)
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.restarts, gc.Equals, 0)
+
+	// A failed restart keeps the request pending.
+	runner.LeaderSettings = map[string]string{
+		"restart-restart-slot": "someunit/0",
+	}
+	ch.fail = true
+	err = runner.RunHook("leader-settings-changed", "", "")
+	c.Assert(err, gc.ErrorMatches, `.*cannot restart: restart failure`)
+	c.Assert(ch.rr.RestartPending(), jc.IsTrue)
+
+	ch.fail = false
+	err = runner.RunHook("leader-settings-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.restarts, gc.Equals, 1)
+	c.Assert(ch.rr.RestartPending(), jc.IsFalse)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"restart-requested": "1",
+		"restart-done":      "1",
+	})
+
+	// A follower never changes the leader settings.
+	c.Assert(runner.LeaderSettings, jc.DeepEquals, map[string]string{
+		"restart-restart-slot": "someunit/0",
+	})
+}
@@ -0,0 +1,6 @@
+package service
+
+var (
+	Now            = &now
+	EnsureStateDir = &ensureStateDir
+)
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// restartPriority holds the priority of the wildcard hook function
+// that performs any pending restart, so that it runs after any other
+// wildcard functions with the default priority.
+const restartPriority = 1000
+
+// now returns the current time. Tests replace it to
+// control when deferred restarts fall due.
+var now = time.Now
+
+// restartState holds the persistent state used to
+// coordinate restarts requested with RequestRestart.
+type restartState struct {
+	// Pending records whether a restart has been
+	// requested and not yet performed.
+	Pending bool `json:",omitempty"`
+
+	// RequestedAt holds the time of the most
+	// recent restart request.
+	RequestedAt time.Time `json:",omitempty"`
+}
+
+// RequestRestart marks the service as needing a restart, for example
+// because its configuration file has changed. Rather than restarting
+// the service immediately, the restart is performed once when all the
+// functions for the current hook have run, however many times
+// RequestRestart was called, so that a hook that changes several
+// things does not restart the service several times.
+//
+// If a quiet period has been set with SetRestartQuietPeriod, the
+// restart is deferred until no restart has been requested for that
+// long, which may be several hooks later; this avoids a restart for
+// each of a rapid succession of hooks, such as the relation hooks
+// that run when many units are added at once. The restart request
+// is remembered in the service's local state, and the update-status
+// hook makes sure that it is eventually performed.
+//
+// If the service is not installed when the restart is due, the
+// request is dropped.
+func (svc *Service) RequestRestart() {
+	svc.state.Restart = restartState{
+		Pending:     true,
+		RequestedAt: now(),
+	}
+}
+
+// RestartPending reports whether a restart has been requested
+// with RequestRestart and not yet performed.
+func (svc *Service) RestartPending() bool {
+	return svc.state.Restart.Pending
+}
+
+// SetRestartQuietPeriod sets the time for which restarts requested
+// with RequestRestart are deferred after the last request. A zero
+// duration, the default, makes the restart happen at the end of the
+// hook that requested it. It should be called when the charm's hooks
+// are registered.
+func (svc *Service) SetRestartQuietPeriod(d time.Duration) {
+	svc.quietPeriod = d
+}
+
+// restartIfNeeded performs any pending restart once
+// the quiet period has elapsed.
+func (svc *Service) restartIfNeeded() error {
+	if !svc.state.Restart.Pending {
+		return nil
+	}
+	if !svc.state.Installed {
+		svc.state.Restart = restartState{}
+		return nil
+	}
+	if wait := svc.quietPeriod - now().Sub(svc.state.Restart.RequestedAt); wait > 0 {
+		svc.ctxt.Logf("deferring service restart for %v", wait)
+		return nil
+	}
+	if err := svc.Restart(); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
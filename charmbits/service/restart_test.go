@@ -0,0 +1,200 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/charmbits/service"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&restartSuite{})
+
+type restartSuite struct {
+	oldNewService     func(service.OSServiceParams) service.OSService
+	oldNow            func() time.Time
+	oldEnsureStateDir func(*hook.Context) (string, error)
+
+	// now holds the current time as seen by the service package.
+	now time.Time
+
+	// calls records the calls made to the OS service.
+	calls   []string
+	running bool
+}
+
+func (s *restartSuite) SetUpTest(c *gc.C) {
+	s.oldNewService = service.NewService
+	s.oldNow = *service.Now
+	s.oldEnsureStateDir = *service.EnsureStateDir
+	service.NewService = func(service.OSServiceParams) service.OSService {
+		return fakeOSService{s}
+	}
+	s.now = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	*service.Now = func() time.Time {
+		return s.now
+	}
+	*service.EnsureStateDir = func(*hook.Context) (string, error) {
+		return "", nil
+	}
+	s.calls = nil
+	s.running = false
+}
+
+func (s *restartSuite) TearDownTest(c *gc.C) {
+	service.NewService = s.oldNewService
+	*service.Now = s.oldNow
+	*service.EnsureStateDir = s.oldEnsureStateDir
+}
+
+type restartCharm struct {
+	svc *service.Service
+}
+
+// newRunner returns a runner for a charm that starts the service
+// when installed and requests several restarts when its
+// configuration changes.
+func newRunner(c *gc.C, ch *restartCharm, quietPeriod time.Duration) *hooktest.Runner {
+	return &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			ch.svc = new(service.Service)
+			ch.svc.Register(r.Clone("service"), "", func(*service.Context, []string) {})
+			ch.svc.SetRestartQuietPeriod(quietPeriod)
+			r.RegisterHook("install", func() error {
+				return ch.svc.Start("arg")
+			})
+			r.RegisterHook("config-changed", func() error {
+				for i := 0; i < 3; i++ {
+					ch.svc.RequestRestart()
+				}
+				return nil
+			})
+		},
+		Logger: c,
+	}
+}
+
+func (s *restartSuite) TestRestartCoalesced(c *gc.C) {
+	var ch restartCharm
+	runner := newRunner(c, &ch, 0)
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{"install", "start"})
+
+	s.calls = nil
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{"stop", "install", "start"})
+	c.Assert(ch.svc.RestartPending(), jc.IsFalse)
+
+	// Nothing happens in later hooks.
+	s.calls = nil
+	err = runner.RunHook("update-status", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+}
+
+func (s *restartSuite) TestRestartQuietPeriod(c *gc.C) {
+	var ch restartCharm
+	runner := newRunner(c, &ch, time.Minute)
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+
+	s.calls = nil
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+	c.Assert(ch.svc.RestartPending(), jc.IsTrue)
+
+	// Another request restarts the quiet period.
+	s.now = s.now.Add(30 * time.Second)
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+
+	s.now = s.now.Add(45 * time.Second)
+	err = runner.RunHook("update-status", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+	c.Assert(ch.svc.RestartPending(), jc.IsTrue)
+
+	// The restart happens in the first hook after the
+	// quiet period has elapsed.
+	s.now = s.now.Add(15 * time.Second)
+	err = runner.RunHook("update-status", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{"stop", "install", "start"})
+	c.Assert(ch.svc.RestartPending(), jc.IsFalse)
+}
+
+func (s *restartSuite) TestRestartNotInstalled(c *gc.C) {
+	var ch restartCharm
+	runner := newRunner(c, &ch, 0)
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+	c.Assert(ch.svc.RestartPending(), jc.IsFalse)
+
+	// The dropped request is not performed when
+	// the service is installed later.
+	err = runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{"install", "start"})
+}
+
+func (s *restartSuite) TestUpgradeCharmDefersRestart(c *gc.C) {
+	var ch restartCharm
+	runner := newRunner(c, &ch, time.Minute)
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+
+	s.calls = nil
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+	c.Assert(ch.svc.RestartPending(), jc.IsTrue)
+
+	s.now = s.now.Add(time.Minute)
+	err = runner.RunHook("update-status", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{"stop", "install", "start"})
+}
+
+type fakeOSService struct {
+	s *restartSuite
+}
+
+func (svc fakeOSService) Install() error {
+	svc.s.calls = append(svc.s.calls, "install")
+	return nil
+}
+
+func (svc fakeOSService) StopAndRemove() error {
+	svc.s.calls = append(svc.s.calls, "remove")
+	svc.s.running = false
+	return nil
+}
+
+func (svc fakeOSService) Running() bool {
+	return svc.s.running
+}
+
+func (svc fakeOSService) Stop() error {
+	svc.s.calls = append(svc.s.calls, "stop")
+	svc.s.running = false
+	return nil
+}
+
+func (svc fakeOSService) Start() error {
+	svc.s.calls = append(svc.s.calls, "start")
+	svc.s.running = true
+	return nil
+}
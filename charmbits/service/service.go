@@ -9,7 +9,6 @@ import (
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
-	"os"
 	"path/filepath"
 	"time"
 
@@ -37,16 +36,21 @@ type Service struct {
 	serviceName string
 	state       localState
 	rpcClient   *rpc.Client
+	quietPeriod time.Duration
 }
 
 type localState struct {
 	Installed bool
 	Args      []string
+	Restart   restartState
 }
 
 // Register registers the service with the given registry. If
 // serviceName is non-empty, it specifies the name of the service,
 // otherwise the service will be named after the charm's unit.
+// The service is stopped and removed when the unit is torn
+// down (see hook.Registry.RegisterTeardown), and restarted
+// when the charm is upgraded.
 //
 // When the service is started, the start function will be called
 // with the context for the running service and any arguments
@@ -65,7 +69,17 @@ func (svc *Service) Register(r *hook.Registry, serviceName string, start func(ct
 	r.RegisterContext(svc.setContext, &svc.state)
 	// TODO Perhaps provide some way to do zero-downtime
 	// upgrades?
-	r.RegisterHook("upgrade-charm", svc.Restart)
+	r.RegisterHook("upgrade-charm", func() error {
+		svc.RequestRestart()
+		return nil
+	})
+	// Make sure that deferred restarts happen
+	// even if no other hooks run.
+	r.RegisterHook("update-status", func() error {
+		return nil
+	})
+	r.RegisterHookWithPriority("*", restartPriority, svc.restartIfNeeded)
+	r.RegisterTeardown(svc.StopAndRemove)
 	r.RegisterCommand(func(args []string) {
 		runServer(start, args)
 	})
@@ -76,7 +90,11 @@ func (svc *Service) setContext(ctxt *hook.Context) error {
 	return nil
 }
 
+// Restart stops the service and starts it again with the
+// arguments it was last started with. It also satisfies any
+// restart requested with RequestRestart.
 func (svc *Service) Restart() error {
+	svc.state.Restart = restartState{}
 	if err := svc.Stop(); err != nil {
 		return errgo.Notef(err, "cannot stop service")
 	}
@@ -93,7 +111,7 @@ func (svc *Service) Restart() error {
 // started again with the new arguments.
 func (svc *Service) Start(args ...string) error {
 	// Create the state directory in preparation for the log output.
-	if err := os.MkdirAll(svc.ctxt.StateDir(), 0700); err != nil {
+	if _, err := ensureStateDir(svc.ctxt); err != nil {
 		return errgo.Notef(err, "cannot create state directory")
 	}
 	svc.ctxt.Logf("starting service")
@@ -127,6 +145,12 @@ func (svc *Service) Started() bool {
 	return svc.osService(nil).Running()
 }
 
+// Installed reports whether the service has been installed
+// by Start and not removed by StopAndRemove.
+func (svc *Service) Installed() bool {
+	return svc.state.Installed
+}
+
 // StopAndRemove stops and removes the service completely.
 func (svc *Service) StopAndRemove() error {
 	if !svc.state.Installed {
@@ -139,6 +163,11 @@ func (svc *Service) StopAndRemove() error {
 	return nil
 }
 
+// ensureStateDir creates the state directory for the given
+// context. It is a variable so that tests can avoid creating
+// directories in the unit's real state location.
+var ensureStateDir = (*hook.Context).EnsureStateDir
+
 var shortAttempt = utils.AttemptStrategy{
 	Total: 2 * time.Second,
 	Delay: 5 * time.Millisecond,
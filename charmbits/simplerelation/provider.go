@@ -33,7 +33,7 @@ func (p *Provider) Register(r *hook.Registry, relationName, interfaceName string
 	})
 	r.RegisterHook(relationName+"-relation-joined", p.relationJoined)
 	r.RegisterContext(p.setContext, &p.state)
-	p.relationName = relationName
+	p.relationName = r.RelationName(relationName)
 }
 
 func (p *Provider) setContext(ctxt *hook.Context) error {
@@ -29,7 +29,7 @@ type Requirer struct {
 // a wildcard ("*") hook, which will trigger when any
 // value changes.
 func (req *Requirer) Register(r *hook.Registry, relationName, interfaceName string) {
-	req.relationName = relationName
+	req.relationName = r.RelationName(relationName)
 	r.RegisterContext(req.setContext, nil)
 	r.RegisterRelation(charm.Relation{
 		Name:      relationName,
@@ -40,9 +40,9 @@ func (req *Requirer) Register(r *hook.Registry, relationName, interfaceName stri
 	// but we need them so the hook is actually created
 	// and the user of this package will have a "*" hook
 	// triggered.
-	r.RegisterHook(req.relationName+"-relation-joined", nop)
-	r.RegisterHook(req.relationName+"-relation-changed", nop)
-	r.RegisterHook(req.relationName+"-relation-departed", nop)
+	r.RegisterHook(relationName+"-relation-joined", nop)
+	r.RegisterHook(relationName+"-relation-changed", nop)
+	r.RegisterHook(relationName+"-relation-departed", nop)
 }
 
 func nop() error {
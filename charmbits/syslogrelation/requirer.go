@@ -0,0 +1,166 @@
+// The syslogrelation package implements the requirer side of a
+// relation with interface type "syslog", as provided by the rsyslog
+// charm. It configures the local rsyslog daemon to forward log
+// messages to all the related rsyslog units.
+package syslogrelation
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// defaultPort holds the port used when the
+// provider does not specify one.
+const defaultPort = "514"
+
+// RsyslogConfigDir holds the directory that the forwarding
+// configuration is written to. It is defined as a variable so that
+// it can be changed for testing purposes.
+var RsyslogConfigDir = "/etc/rsyslog.d"
+
+// RestartRsyslog restarts the rsyslog daemon so that it reads the
+// new configuration. It is defined as a variable so that it can be
+// replaced for testing purposes.
+var RestartRsyslog = func() error {
+	out, err := exec.Command("service", "rsyslog", "restart").CombinedOutput()
+	if err != nil {
+		return errgo.Notef(err, "cannot restart rsyslog: %s", bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Requirer represents the requirer side of a syslog relation.
+type Requirer struct {
+	ctxt         *hook.Context
+	state        requirerState
+	relationName string
+}
+
+type requirerState struct {
+	// Tags holds the tags passed to EnableForwarding.
+	Tags []string
+}
+
+// Register registers a syslog requirer relation with the given
+// relation name with the given hook registry.
+func (req *Requirer) Register(r *hook.Registry, relationName string) {
+	req.relationName = r.RelationName(relationName)
+	r.RegisterRelation(charm.Relation{
+		Name:      relationName,
+		Interface: "syslog",
+		Role:      charm.RoleRequirer,
+		Optional:  true,
+	})
+	for _, h := range []string{"joined", "changed", "departed", "broken"} {
+		r.RegisterHook(relationName+"-relation-"+h, req.configure)
+	}
+	r.RegisterContext(req.setContext, &req.state)
+}
+
+func (req *Requirer) setContext(ctxt *hook.Context) error {
+	req.ctxt = ctxt
+	return nil
+}
+
+// EnableForwarding arranges for log messages with the given
+// syslog tag (the program name, as used by logger -t) to be
+// forwarded to the related rsyslog units, now and whenever
+// they change.
+func (req *Requirer) EnableForwarding(tag string) error {
+	if tag == "" || strings.ContainsAny(tag, "\" \t\n") {
+		return errgo.Newf("invalid syslog tag %q", tag)
+	}
+	for _, t := range req.state.Tags {
+		if t == tag {
+			return req.configure()
+		}
+	}
+	req.state.Tags = append(req.state.Tags, tag)
+	return req.configure()
+}
+
+// configFile returns the path of the rsyslog
+// configuration file written by the requirer.
+func (req *Requirer) configFile() string {
+	return filepath.Join(RsyslogConfigDir, "60-gocharm-"+req.ctxt.ServiceName()+".conf")
+}
+
+// configure writes the forwarding configuration, and restarts
+// rsyslog if it has changed.
+func (req *Requirer) configure() error {
+	path := req.configFile()
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errgo.Mask(err)
+	}
+	config := req.config()
+	if config == string(old) {
+		return nil
+	}
+	if config == "" {
+		if err := os.Remove(path); err != nil {
+			return errgo.Mask(err)
+		}
+	} else {
+		if err := os.MkdirAll(RsyslogConfigDir, 0755); err != nil {
+			return errgo.Mask(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := RestartRsyslog(); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// config returns the contents of the rsyslog configuration file,
+// or the empty string if nothing is to be forwarded.
+func (req *Requirer) config() string {
+	addrs := req.addrs()
+	if len(addrs) == 0 || len(req.state.Tags) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# generated by gocharm for %s; do not edit\n", req.ctxt.Unit)
+	for _, tag := range req.state.Tags {
+		for _, addr := range addrs {
+			fmt.Fprintf(&buf, ":programname, isequal, %q @@%s\n", tag, addr)
+		}
+	}
+	return buf.String()
+}
+
+// addrs returns the sorted addresses of all the
+// related rsyslog units.
+func (req *Requirer) addrs() []string {
+	var addrs []string
+	for _, id := range req.ctxt.RelationIds[req.relationName] {
+		for _, settings := range req.ctxt.Relations[id] {
+			host := settings["private-address"]
+			if host == "" {
+				continue
+			}
+			port := settings["port"]
+			if port == "" {
+				port = defaultPort
+			}
+			addrs = append(addrs, net.JoinHostPort(host, port))
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
@@ -0,0 +1,111 @@
+package syslogrelation_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/charmbits/syslogrelation"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&requirerSuite{})
+
+type requirerSuite struct {
+	oldConfigDir string
+	oldRestart   func() error
+	restarts     int
+}
+
+func (s *requirerSuite) SetUpTest(c *gc.C) {
+	s.oldConfigDir = syslogrelation.RsyslogConfigDir
+	s.oldRestart = syslogrelation.RestartRsyslog
+	syslogrelation.RsyslogConfigDir = filepath.Join(c.MkDir(), "rsyslog.d")
+	s.restarts = 0
+	syslogrelation.RestartRsyslog = func() error {
+		s.restarts++
+		return nil
+	}
+}
+
+func (s *requirerSuite) TearDownTest(c *gc.C) {
+	syslogrelation.RsyslogConfigDir = s.oldConfigDir
+	syslogrelation.RestartRsyslog = s.oldRestart
+}
+
+func (s *requirerSuite) TestEnableForwarding(c *gc.C) {
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			var req syslogrelation.Requirer
+			req.Register(r.Clone("syslog"), "logging")
+			r.RegisterHook("install", func() error {
+				return req.EnableForwarding("myservice")
+			})
+		},
+		Logger: c,
+	}
+	configFile := filepath.Join(syslogrelation.RsyslogConfigDir, "60-gocharm-someunit.conf")
+
+	// With no relation, nothing is configured.
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.restarts, gc.Equals, 0)
+	_, err = os.Stat(configFile)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+
+	runner.RelationIds = map[string][]hook.RelationId{
+		"logging": {"logging:0"},
+	}
+	runner.Relations = map[hook.RelationId]map[hook.UnitId]map[string]string{
+		"logging:0": {
+			"rsyslog/0": {"private-address": "10.0.0.5"},
+			"rsyslog/1": {"private-address": "10.0.0.6", "port": "10514"},
+		},
+	}
+	err = runner.RunHook("logging-relation-changed", "logging:0", "rsyslog/1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.restarts, gc.Equals, 1)
+	data, err := ioutil.ReadFile(configFile)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `# generated by gocharm for someunit/0; do not edit
+:programname, isequal, "myservice" @@10.0.0.5:514
+:programname, isequal, "myservice" @@10.0.0.6:10514
+`)
+
+	// Nothing changed, so rsyslog is not restarted.
+	err = runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.restarts, gc.Equals, 1)
+
+	// When the relation goes, so does the configuration.
+	runner.Relations["logging:0"] = nil
+	err = runner.RunHook("logging-relation-broken", "logging:0", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.restarts, gc.Equals, 2)
+	_, err = os.Stat(configFile)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *requirerSuite) TestEnableForwardingInvalidTag(c *gc.C) {
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			var req syslogrelation.Requirer
+			req.Register(r, "logging")
+			r.RegisterHook("install", func() error {
+				return req.EnableForwarding("my service")
+			})
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.ErrorMatches, `.*invalid syslog tag "my service"`)
+}
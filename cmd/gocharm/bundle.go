@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/yaml.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// bundle builds all the Go charms referred to by the given bundle
+// file, writes a copy of the bundle that refers to the newly built
+// charms into $JUJU_REPOSITORY/bundle and returns its path. If
+// *deploy is set, it then deploys the new bundle.
+func bundle(bundlePath string) (string, error) {
+	data, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	bd, err := charm.ReadBundleData(bytes.NewReader(data))
+	if err != nil {
+		return "", errgo.Notef(err, "cannot read %q", bundlePath)
+	}
+	pkgPaths, err := goCharmPackages(&build.Default, bd, filepath.Dir(bundlePath))
+	if err != nil {
+		return "", errgo.Mask(err, isCategorized)
+	}
+	if len(pkgPaths) == 0 {
+		return "", errgo.WithCausef(nil, errNothingToBuild, "no Go charms found in %q", bundlePath)
+	}
+	bundleSeries := bd.Series
+	if bundleSeries == "" {
+		bundleSeries = *series
+	}
+	// Several services may use the same charm, so
+	// make sure we build each one only once.
+	built := make(map[string]string)
+	charmURLs := make(map[string]string)
+	// A charm that fails its checks is reported and the
+	// others are still built, so that all the problems in the
+	// bundle are found at once.
+	failed := make(map[string]bool)
+	for _, svc := range sortedKeys(pkgPaths) {
+		pkgPath := pkgPaths[svc]
+		if url, ok := built[pkgPath]; ok {
+			charmURLs[svc] = url
+			continue
+		}
+		if failed[pkgPath] {
+			continue
+		}
+		var curl *charm.URL
+		err := withCharmOutput(path.Base(pkgPath), func() error {
+			var err error
+			curl, err = install(pkgPath, bundleSeries)
+			return err
+		})
+		if err != nil {
+			if isChecksError(errgo.Cause(err)) {
+				errorf("service %q: %v", svc, err)
+				failed[pkgPath] = true
+				continue
+			}
+			return "", errgo.Notef(err, "cannot build charm for service %q", svc)
+		}
+		rev, err := builder.ReadRevision(filepath.Join(*repo, curl.Series, curl.Name))
+		if err != nil {
+			return "", errgo.Notef(err, "cannot read revision")
+		}
+		curl.Revision = rev
+		built[pkgPath] = curl.String()
+		charmURLs[svc] = curl.String()
+	}
+	if len(failed) > 0 {
+		return "", errgo.WithCausef(nil, errValidation, "%d charm(s) in %q failed checks", len(failed), bundlePath)
+	}
+	newData, err := rewriteBundle(data, charmURLs)
+	if err != nil {
+		return "", errgo.Notef(err, "cannot rewrite bundle")
+	}
+	dest := filepath.Join(*repo, "bundle", filepath.Base(bundlePath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return "", errgo.Mask(err)
+	}
+	if err := ioutil.WriteFile(dest, newData, 0666); err != nil {
+		return "", errgo.Mask(err)
+	}
+	fmt.Println(dest)
+	if !*deploy {
+		return dest, nil
+	}
+	if err := runCmd("", nil, "juju", "deploy", "--repository", *repo, dest).Run(); err != nil {
+		return "", errgo.Notef(err, "cannot deploy bundle")
+	}
+	return dest, nil
+}
+
+// goCharmPackages returns a map from service name to the import path
+// of the Go package, as found with ctxt, for all the services in the
+// given bundle that use Go charms. A service uses a Go charm if its
+// charm is specified as a path (starting with "./", "../" or "/") to a
+// directory holding a Go package, which must be inside $GOPATH.
+// Relative paths are interpreted relative to bundleDir. Other charms
+// are left alone.
+func goCharmPackages(ctxt *build.Context, bd *charm.BundleData, bundleDir string) (map[string]string, error) {
+	pkgPaths := make(map[string]string)
+	for svc, spec := range bd.Services {
+		if !isCharmPath(spec.Charm) {
+			continue
+		}
+		dir := spec.Charm
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(bundleDir, dir)
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		pkg, err := ctxt.ImportDir(dir, 0)
+		if err != nil {
+			return nil, errgo.Notef(err, "service %q does not refer to a Go charm", svc)
+		}
+		if build.IsLocalImport(pkg.ImportPath) || strings.HasPrefix(pkg.ImportPath, "_") {
+			return nil, errgo.WithCausef(nil, errEnvironment, "charm directory %q for service %q is not inside $GOPATH", dir, svc)
+		}
+		pkgPaths[svc] = pkg.ImportPath
+	}
+	return pkgPaths, nil
+}
+
+func isCharmPath(s string) bool {
+	return strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") || strings.HasPrefix(s, "/")
+}
+
+// rewriteBundle returns the given bundle data with each service
+// mentioned in charmURLs changed to use the corresponding charm URL.
+// Everything else in the bundle is left unchanged.
+func rewriteBundle(data []byte, charmURLs map[string]string) ([]byte, error) {
+	var bd map[string]interface{}
+	if err := yaml.Unmarshal(data, &bd); err != nil {
+		return nil, errgo.Notef(err, "cannot unmarshal bundle data")
+	}
+	services, ok := bd["services"].(map[interface{}]interface{})
+	if !ok {
+		return nil, errgo.New("no services found in bundle")
+	}
+	for svc, url := range charmURLs {
+		spec, ok := services[svc].(map[interface{}]interface{})
+		if !ok {
+			return nil, errgo.Newf("service %q not found in bundle", svc)
+		}
+		spec["charm"] = url
+	}
+	newData, err := yaml.Marshal(bd)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot marshal bundle data")
+	}
+	return newData, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
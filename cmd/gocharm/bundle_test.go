@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/yaml.v1"
+)
+
+const testBundle = `
+series: trusty
+services:
+    web:
+        charm: ./charms/web
+        num_units: 2
+        options:
+            port: 8080
+    webtoo:
+        charm: ./charms/web
+    db:
+        charm: cs:trusty/mysql-10
+relations:
+    - [web, db]
+`
+
+func (suite) TestGoCharmPackages(c *gc.C) {
+	gopath := c.MkDir()
+	dir := filepath.Join(gopath, "src", "example.com", "bundle")
+	webDir := filepath.Join(dir, "charms", "web")
+	err := os.MkdirAll(webDir, 0777)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(webDir, "web.go"), []byte("package web\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	ctxt := build.Default
+	ctxt.GOPATH = gopath
+
+	bd, err := charm.ReadBundleData(bytes.NewReader([]byte(testBundle)))
+	c.Assert(err, gc.IsNil)
+	pkgPaths, err := goCharmPackages(&ctxt, bd, dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(pkgPaths, jc.DeepEquals, map[string]string{
+		"web":    "example.com/bundle/charms/web",
+		"webtoo": "example.com/bundle/charms/web",
+	})
+
+	// A bundle directory relative to the current
+	// directory and an absolute charm path work too.
+	cwd, err := os.Getwd()
+	c.Assert(err, gc.IsNil)
+	defer os.Chdir(cwd)
+	err = os.Chdir(filepath.Dir(dir))
+	c.Assert(err, gc.IsNil)
+	bd.Services["webtoo"].Charm = webDir
+	pkgPaths, err = goCharmPackages(&ctxt, bd, "bundle")
+	c.Assert(err, gc.IsNil)
+	c.Assert(pkgPaths, jc.DeepEquals, map[string]string{
+		"web":    "example.com/bundle/charms/web",
+		"webtoo": "example.com/bundle/charms/web",
+	})
+
+	ctxt.GOPATH = c.MkDir()
+	_, err = goCharmPackages(&ctxt, bd, dir)
+	c.Assert(err, gc.ErrorMatches, `charm directory ".*/charms/web" for service "web(too)?" is not inside \$GOPATH`)
+	c.Assert(errgo.Cause(err), gc.Equals, errEnvironment)
+
+	ctxt.GOPATH = gopath
+	bd.Services["db"].Charm = "./charms/db"
+	_, err = goCharmPackages(&ctxt, bd, dir)
+	c.Assert(err, gc.ErrorMatches, `service "db" does not refer to a Go charm: (.|\n)*`)
+}
+
+const testCharmBundle = `
+series: trusty
+services:
+    web:
+        charm: ./charms/web
+    db:
+        charm: cs:trusty/mysql-10
+`
+
+func (suite) TestBundleBuildsCharm(c *gc.C) {
+	if _, err := build.Import("github.com/juju/gocharm/hook", "", build.FindOnly); err != nil {
+		c.Skip("github.com/juju/gocharm not found in $GOPATH")
+	}
+	gopath := c.MkDir()
+	bundleDir := filepath.Join(gopath, "src", "example.com", "bundle")
+	webDir := filepath.Join(bundleDir, "charms", "web")
+	err := os.MkdirAll(webDir, 0777)
+	c.Assert(err, gc.IsNil)
+	for name, content := range map[string]string{
+		"metadata.yaml": "name: web\nsummary: a web server\ndescription: a web server\n",
+		"web.go":        "package web\n\nimport \"github.com/juju/gocharm/hook\"\n\nfunc RegisterHooks(r *hook.Registry) {\n\tr.RegisterHook(\"start\", func() error { return nil })\n}\n",
+	} {
+		err := ioutil.WriteFile(filepath.Join(webDir, name), []byte(content), 0666)
+		c.Assert(err, gc.IsNil)
+	}
+	err = ioutil.WriteFile(filepath.Join(bundleDir, "bundle.yaml"), []byte(testCharmBundle), 0666)
+	c.Assert(err, gc.IsNil)
+
+	// Put the charm in $GOPATH as well as the gocharm packages
+	// that it uses.
+	oldGOPATH := build.Default.GOPATH
+	newGOPATH := gopath + string(filepath.ListSeparator) + oldGOPATH
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", newGOPATH)
+	build.Default.GOPATH = newGOPATH
+	defer func() {
+		build.Default.GOPATH = oldGOPATH
+	}()
+	oldRepo := *repo
+	defer func() {
+		*repo = oldRepo
+	}()
+	*repo = c.MkDir()
+	cwd, err := os.Getwd()
+	c.Assert(err, gc.IsNil)
+	defer os.Chdir(cwd)
+	err = os.Chdir(filepath.Dir(bundleDir))
+	c.Assert(err, gc.IsNil)
+
+	dest, err := bundle(filepath.Join("bundle", "bundle.yaml"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(dest, gc.Equals, filepath.Join(*repo, "bundle", "bundle.yaml"))
+	_, err = os.Stat(filepath.Join(*repo, "trusty", "web", "hooks", "start"))
+	c.Assert(err, gc.IsNil)
+
+	data, err := ioutil.ReadFile(dest)
+	c.Assert(err, gc.IsNil)
+	bd, err := charm.ReadBundleData(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd.Services["web"].Charm, gc.Matches, `local:trusty/web(-[0-9]+)?`)
+	c.Assert(bd.Services["db"].Charm, gc.Equals, "cs:trusty/mysql-10")
+}
+
+func (suite) TestRewriteBundle(c *gc.C) {
+	data, err := rewriteBundle([]byte(testBundle), map[string]string{
+		"web":    "local:trusty/web-3",
+		"webtoo": "local:trusty/web-3",
+	})
+	c.Assert(err, gc.IsNil)
+	bd, err := charm.ReadBundleData(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd.Services["web"].Charm, gc.Equals, "local:trusty/web-3")
+	c.Assert(bd.Services["webtoo"].Charm, gc.Equals, "local:trusty/web-3")
+	c.Assert(bd.Services["db"].Charm, gc.Equals, "cs:trusty/mysql-10")
+
+	// Everything else is preserved.
+	var got, want map[string]interface{}
+	err = yaml.Unmarshal(data, &got)
+	c.Assert(err, gc.IsNil)
+	err = yaml.Unmarshal([]byte(testBundle), &want)
+	c.Assert(err, gc.IsNil)
+	services := want["services"].(map[interface{}]interface{})
+	services["web"].(map[interface{}]interface{})["charm"] = "local:trusty/web-3"
+	services["webtoo"].(map[interface{}]interface{})["charm"] = "local:trusty/web-3"
+	c.Assert(got, jc.DeepEquals, want)
+
+	_, err = rewriteBundle([]byte(testBundle), map[string]string{
+		"other": "local:trusty/other",
+	})
+	c.Assert(err, gc.ErrorMatches, `service "other" not found in bundle`)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// docs prints Markdown documentation for the given built charm or,
+// if ch is empty, for the charm in the current directory, suitable
+// for including in the charm's README.md.
+func docs(ch string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return errgo.Notef(err, "cannot get current directory")
+	}
+	var (
+		name string
+		reg  *builder.RegistryInfo
+		// actionsDir holds the directory that
+		// actions.yaml is read from.
+		actionsDir string
+	)
+	if ch == "" {
+		pkg, err := build.Default.Import(".", cwd, 0)
+		if err != nil {
+			return errgo.Notef(err, "cannot import current directory")
+		}
+		tempDir, err := ioutil.TempDir("", "gocharm")
+		if err != nil {
+			return errgo.Notef(err, "cannot make temporary directory")
+		}
+		defer os.RemoveAll(tempDir)
+		info, err := builder.Inspect(pkg, tempDir)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		name = path.Base(pkg.Dir)
+		reg = builder.NewRegistryInfo(pkg.ImportPath, info)
+		actionsDir = pkg.Dir
+	} else {
+		dir := charmDir(ch)
+		reg, err = builder.ReadRegistryInfo(dir)
+		if err != nil {
+			if os.IsNotExist(errgo.Cause(err)) {
+				return errgo.Newf("no registry description found in %s; rebuild the charm with this version of gocharm", dir)
+			}
+			return errgo.Notef(err, "cannot read registry description from %s", dir)
+		}
+		name = filepath.Base(dir)
+		actionsDir = dir
+	}
+	// The package documentation is optional, because the
+	// source of a built charm may not be available.
+	var pkgDoc string
+	if pkg, err := build.Default.Import(reg.Package, cwd, build.FindOnly); err == nil {
+		pkgDoc, err = packageDoc(pkg.Dir)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		actionsDir = pkg.Dir
+	}
+	actions, err := readActions(actionsDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	os.Stdout.Write(charmDocs(name, pkgDoc, reg, actions))
+	return nil
+}
+
+// readActions reads the actions.yaml file in the given directory.
+// It returns nil if there is no such file.
+func readActions(dir string) (*charm.Actions, error) {
+	f, err := os.Open(filepath.Join(dir, "actions.yaml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer f.Close()
+	actions, err := charm.ReadActionsYaml(f)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read %s", f.Name())
+	}
+	return actions, nil
+}
+
+// packageDoc returns the package documentation comment
+// of the Go package in the given directory, or the empty
+// string if there is none.
+func packageDoc(dir string) (string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return "", errgo.Notef(err, "cannot parse %s", dir)
+	}
+	fileDocs := make(map[string]string)
+	for _, pkg := range pkgs {
+		for file, f := range pkg.Files {
+			if f.Doc != nil {
+				fileDocs[file] = strings.TrimSpace(f.Doc.Text())
+			}
+		}
+	}
+	// Like godoc, use the comments in file name order.
+	var docs []string
+	for _, file := range sortedKeys(fileDocs) {
+		docs = append(docs, fileDocs[file])
+	}
+	return strings.Join(docs, "\n\n"), nil
+}
+
+// charmDocs returns Markdown documentation for the charm with the
+// given name, package documentation, registry description and
+// actions, which may be nil.
+func charmDocs(name, pkgDoc string, reg *builder.RegistryInfo, actions *charm.Actions) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "## %s\n\n", name)
+	if pkgDoc != "" {
+		fmt.Fprintf(&buf, "%s\n\n", pkgDoc)
+	}
+	if len(reg.Config) > 0 {
+		buf.WriteString("### Configuration\n\n")
+		buf.WriteString("| Option | Type | Default | Description |\n")
+		buf.WriteString("|--------|------|---------|-------------|\n")
+		for _, optName := range sortedOptionNames(reg) {
+			opt := reg.Config[optName]
+			def := ""
+			if opt.Default != nil {
+				def = "`" + fmt.Sprint(opt.Default) + "`"
+			}
+			fmt.Fprintf(&buf, "| `%s` | %s | %s | %s |\n", optName, opt.Type, def, markdownCell(opt.Description))
+		}
+		buf.WriteString("\n")
+	}
+	if len(reg.Relations) > 0 {
+		buf.WriteString("### Relations\n\n")
+		buf.WriteString("| Relation | Role | Interface | Scope |\n")
+		buf.WriteString("|----------|------|-----------|-------|\n")
+		for _, relName := range sortedRelationNames(reg) {
+			rel := reg.Relations[relName]
+			fmt.Fprintf(&buf, "| `%s` | %s | `%s` | %s |\n", relName, rel.Role, rel.Interface, rel.Scope)
+		}
+		buf.WriteString("\n")
+	}
+	if actions != nil && len(actions.ActionSpecs) > 0 {
+		buf.WriteString("### Actions\n\n")
+		for _, actionName := range sortedActionNames(actions) {
+			spec := actions.ActionSpecs[actionName]
+			fmt.Fprintf(&buf, "- `%s`: %s\n", actionName, markdownCell(spec.Description))
+			// The parameters are held as a JSON schema.
+			params, _ := spec.Params["properties"].(map[string]interface{})
+			for _, paramName := range sortedParamNames(params) {
+				param, _ := params[paramName].(map[string]interface{})
+				paramType, _ := param["type"].(string)
+				desc, _ := param["description"].(string)
+				fmt.Fprintf(&buf, "  - `%s`", paramName)
+				if paramType != "" {
+					fmt.Fprintf(&buf, " (%s)", paramType)
+				}
+				if desc != "" {
+					fmt.Fprintf(&buf, ": %s", markdownCell(desc))
+				}
+				buf.WriteString("\n")
+			}
+		}
+		buf.WriteString("\n")
+	}
+	if len(reg.Commands) > 0 {
+		buf.WriteString("### Commands\n\n")
+		buf.WriteString("Each command can be run on a unit with `juju run --unit <unit> \"bin/runhook cmd-<name>\"`.\n\n")
+		for _, cmd := range reg.Commands {
+			fmt.Fprintf(&buf, "- `cmd-%s`\n", cmd)
+		}
+		buf.WriteString("\n")
+	}
+	if len(reg.Hooks) > 0 {
+		buf.WriteString("### Hooks\n\n")
+		for _, hook := range reg.Hooks {
+			fmt.Fprintf(&buf, "- `%s`\n", hook)
+		}
+		buf.WriteString("\n")
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// markdownCell returns s formatted to fit in
+// a single cell of a Markdown table.
+func markdownCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+func sortedOptionNames(reg *builder.RegistryInfo) []string {
+	names := make([]string, 0, len(reg.Config))
+	for name := range reg.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedRelationNames(reg *builder.RegistryInfo) []string {
+	names := make([]string, 0, len(reg.Relations))
+	for name := range reg.Relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedActionNames(actions *charm.Actions) []string {
+	names := make([]string, 0, len(actions.ActionSpecs))
+	for name := range actions.ActionSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedParamNames(params map[string]interface{}) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/builder"
+)
+
+type docsSuite struct{}
+
+var _ = gc.Suite(&docsSuite{})
+
+func (*docsSuite) TestCharmDocs(c *gc.C) {
+	reg := &builder.RegistryInfo{
+		Package: "example.com/charms/web",
+		CharmInfo: builder.CharmInfo{
+			Hooks: []string{"config-changed", "install", "website-relation-joined"},
+			Config: map[string]charm.Option{
+				"port": {
+					Type:        "int",
+					Default:     8080,
+					Description: "The port to listen on.\nIt must be free.",
+				},
+				"motd": {
+					Type:        "string",
+					Description: "A | separated list.",
+				},
+			},
+			Relations: map[string]charm.Relation{
+				"website": {
+					Name:      "website",
+					Role:      charm.RoleProvider,
+					Interface: "http",
+					Scope:     charm.ScopeGlobal,
+				},
+			},
+			Commands: []string{"root"},
+		},
+	}
+	actions, err := charm.ReadActionsYaml(strings.NewReader(`
+backup:
+  description: Back up the site.
+  params:
+    target:
+      type: string
+      description: Where to put the backup.
+    compress:
+      type: boolean
+restart:
+  description: Restart the server.
+`))
+	c.Assert(err, gc.IsNil)
+	docs := charmDocs("web", "Package web implements a web server charm.", reg, actions)
+	c.Assert(string(docs), gc.Equals, "## web\n"+`
+Package web implements a web server charm.
+
+### Configuration
+
+| Option | Type | Default | Description |
+|--------|------|---------|-------------|
+| `+"`motd`"+` | string |  | A \| separated list. |
+| `+"`port`"+` | int | `+"`8080`"+` | The port to listen on. It must be free. |
+
+### Relations
+
+| Relation | Role | Interface | Scope |
+|----------|------|-----------|-------|
+| `+"`website`"+` | provider | `+"`http`"+` | global |
+
+### Actions
+
+- `+"`backup`"+`: Back up the site.
+  - `+"`compress`"+` (boolean)
+  - `+"`target`"+` (string): Where to put the backup.
+- `+"`restart`"+`: Restart the server.
+
+### Commands
+
+Each command can be run on a unit with `+"`juju run --unit <unit> \"bin/runhook cmd-<name>\"`"+`.
+
+- `+"`cmd-root`"+`
+
+### Hooks
+
+- `+"`config-changed`"+`
+- `+"`install`"+`
+- `+"`website-relation-joined`"+`
+`)
+}
+
+func (*docsSuite) TestPackageDoc(c *gc.C) {
+	dir := c.MkDir()
+	for name, data := range map[string]string{
+		"b.go":      "// Package web implements\n// a web server.\npackage web\n",
+		"a.go":      "// More details.\npackage web\n",
+		"c.go":      "package web\n",
+		"a_test.go": "// Test documentation.\npackage web\n",
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666)
+		c.Assert(err, gc.IsNil)
+	}
+	doc, err := packageDoc(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc, gc.Equals, "More details.\n\nPackage web implements\na web server.")
+}
+
+func (*docsSuite) TestReadActions(c *gc.C) {
+	dir := c.MkDir()
+	actions, err := readActions(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(actions, gc.IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "actions.yaml"), []byte("backup:\n  description: Back up the site.\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	actions, err = readActions(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(actions.ActionSpecs["backup"].Description, gc.Equals, "Back up the site.")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "actions.yaml"), []byte("Bad_Name:\n  description: x\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	_, err = readActions(dir)
+	c.Assert(err, gc.ErrorMatches, `cannot read .*/actions.yaml: bad action name Bad_Name`)
+}
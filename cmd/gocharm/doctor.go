@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// doctor checks the local environment for problems that would
+// prevent charms from being built, printing each problem with a
+// suggested fix. An error is returned if there were any.
+func doctor() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return errgo.Notef(err, "cannot get current directory")
+	}
+	problems := builder.Doctor(builder.DoctorParams{
+		GOPATH: os.Getenv("GOPATH"),
+		Repo:   *repo,
+		Dir:    cwd,
+	})
+	for _, p := range problems {
+		errorf("%s", p)
+	}
+	if len(problems) > 0 {
+		return errgo.WithCausef(nil, errEnvironment, "%d problem(s) found", len(problems))
+	}
+	fmt.Println("ok")
+	return nil
+}
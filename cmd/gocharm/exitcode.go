@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+
+	"gopkg.in/errgo.v1"
+)
+
+// The exit statuses of gocharm. They are documented in the
+// package documentation and printed by flag.Usage, so that
+// wrapper scripts can react to each kind of failure.
+const (
+	exitBuildError       = 1
+	exitUsageError       = 2
+	exitValidationError  = 3
+	exitEnvironmentError = 4
+	exitNothingToBuild   = 5
+)
+
+// exitCodesUsage describes the exit statuses for flag.Usage.
+const exitCodesUsage = `exit status:
+  0: success
+  1: a charm could not be built
+  2: invalid command line
+  3: a charm failed verification or checks
+  4: the environment is not set up to build charms
+  5: nothing to build (no Go charms were found)
+`
+
+// These errors are used as the causes of errors
+// to choose the exit status; see exitCodeOf.
+var (
+	errValidation     = errgo.New("validation failed")
+	errEnvironment    = errgo.New("environment error")
+	errNothingToBuild = errgo.New("nothing to build")
+)
+
+// exitCodeOf returns the exit status that gocharm
+// should exit with after failing with the given error.
+func exitCodeOf(err error) int {
+	cause := errgo.Cause(err)
+	switch {
+	case cause == errNothingToBuild:
+		return exitNothingToBuild
+	case cause == errValidation || isChecksError(cause):
+		return exitValidationError
+	case cause == errEnvironment:
+		return exitEnvironmentError
+	}
+	return exitBuildError
+}
+
+// isCategorized reports whether err is one of the
+// errors that select the exit status of gocharm, so
+// that it can be preserved with errgo.Mask.
+func isCategorized(err error) bool {
+	return err == errNothingToBuild || err == errValidation || err == errEnvironment || isChecksError(err)
+}
+
+// fatal prints the given error and exits
+// with the exit status chosen by exitCodeOf.
+func fatal(err error) {
+	errorf("%v", err)
+	os.Exit(exitCodeOf(err))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+type exitCodeSuite struct{}
+
+var _ = gc.Suite(&exitCodeSuite{})
+
+var exitCodeOfTests = []struct {
+	about  string
+	err    error
+	expect int
+}{{
+	about:  "plain error",
+	err:    errgo.New("cannot build"),
+	expect: exitBuildError,
+}, {
+	about:  "nothing to build",
+	err:    errgo.WithCausef(nil, errNothingToBuild, "no Go charms found"),
+	expect: exitNothingToBuild,
+}, {
+	about:  "validation error",
+	err:    errgo.WithCausef(nil, errValidation, "1 problem(s) found"),
+	expect: exitValidationError,
+}, {
+	about:  "environment error",
+	err:    errgo.WithCausef(nil, errEnvironment, "not inside $GOPATH"),
+	expect: exitEnvironmentError,
+}, {
+	about:  "checks error",
+	err:    &builder.ChecksError{Charm: "mycharm", Problems: []string{"gofmt"}},
+	expect: exitValidationError,
+}, {
+	about:  "masked environment error",
+	err:    errgo.Mask(errgo.WithCausef(nil, errEnvironment, "not inside $GOPATH"), isCategorized),
+	expect: exitEnvironmentError,
+}, {
+	about:  "masked checks error",
+	err:    errgo.Mask(&builder.ChecksError{Charm: "mycharm"}, isCategorized),
+	expect: exitValidationError,
+}, {
+	about:  "cause hidden by Notef",
+	err:    errgo.Notef(errgo.WithCausef(nil, errValidation, "1 problem(s) found"), "cannot build"),
+	expect: exitBuildError,
+}, {
+	about:  "cause kept by NoteMask",
+	err:    errgo.NoteMask(errgo.WithCausef(nil, errValidation, "1 problem(s) found"), `cannot build for series "trusty"`, isCategorized),
+	expect: exitValidationError,
+}}
+
+func (*exitCodeSuite) TestExitCodeOf(c *gc.C) {
+	for i, test := range exitCodeOfTests {
+		c.Logf("test %d: %s", i, test.about)
+		c.Assert(exitCodeOf(test.err), gc.Equals, test.expect)
+	}
+}
+
+func (*exitCodeSuite) TestImportCharmPackage(c *gc.C) {
+	gopath := c.MkDir()
+	dir := filepath.Join(gopath, "src", "example.com", "notacharm")
+	err := os.MkdirAll(dir, 0777)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "lib.go"), []byte("package notacharm\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	ctxt := build.Default
+	ctxt.GOPATH = gopath
+
+	_, err = importCharmPackage(&ctxt, "example.com/notacharm")
+	c.Assert(err, gc.ErrorMatches, `no RegisterHooks function found in "example.com/notacharm"`)
+	c.Assert(exitCodeOf(err), gc.Equals, exitNothingToBuild)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "lib.go"), []byte("package notacharm\nimport \"github.com/juju/gocharm/hook\"\nfunc RegisterHooks(r *hook.Registry) {}\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	pkg, err := importCharmPackage(&ctxt, "example.com/notacharm")
+	c.Assert(err, gc.IsNil)
+	c.Assert(pkg.Dir, gc.Equals, dir)
+}
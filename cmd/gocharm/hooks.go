@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// hookSet holds what a charm registers, as printed by the hooks
+// subcommand. Everything is sorted so that the output of two
+// revisions of a charm can be usefully compared with diff.
+type hookSet struct {
+	Package   string
+	Hooks     []string
+	Relations []relationHooks
+	Config    []configOption
+	Commands  []string
+}
+
+// relationHooks holds a relation and the hooks
+// registered for it.
+type relationHooks struct {
+	Name      string
+	Role      charm.RelationRole
+	Interface string
+	Scope     charm.RelationScope
+	Hooks     []string
+}
+
+// configOption holds a registered configuration option.
+type configOption struct {
+	Name        string
+	Type        string
+	Default     interface{} `json:",omitempty"`
+	Description string      `json:",omitempty"`
+}
+
+// hooks prints the hooks, relations, configuration options and
+// commands registered by the charm in the given package. Like
+// verify, it runs the charm's RegisterHooks function but does not
+// build the charm.
+func hooks(pkgPath string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return errgo.Notef(err, "cannot get current directory")
+	}
+	pkg, err := build.Default.Import(pkgPath, cwd, 0)
+	if err != nil {
+		return errgo.Notef(err, "cannot import %q", pkgPath)
+	}
+	tempDir, err := ioutil.TempDir("", "gocharm")
+	if err != nil {
+		return errgo.Notef(err, "cannot make temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	info, err := builder.Inspect(pkg, tempDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	set := newHookSet(pkg.ImportPath, info)
+	if *jsonOutput {
+		data, err := json.MarshalIndent(set, "", "\t")
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+	printHookSet(set)
+	return nil
+}
+
+// newHookSet returns the hook set for the package with the
+// given import path from the information found by Inspect.
+func newHookSet(pkgPath string, info *builder.CharmInfo) *hookSet {
+	set := &hookSet{
+		Package:  pkgPath,
+		Hooks:    info.Hooks,
+		Commands: []string{},
+	}
+	relHooks := make(map[string][]string)
+	for _, name := range set.Hooks {
+		if i := strings.Index(name, "-relation-"); i > 0 {
+			relHooks[name[0:i]] = append(relHooks[name[0:i]], name)
+		}
+	}
+	for name, rel := range info.Relations {
+		hooks := relHooks[name]
+		if hooks == nil {
+			hooks = []string{}
+		}
+		set.Relations = append(set.Relations, relationHooks{
+			Name:      name,
+			Role:      rel.Role,
+			Interface: rel.Interface,
+			Scope:     rel.Scope,
+			Hooks:     hooks,
+		})
+	}
+	sort.Sort(relationsByName(set.Relations))
+	for name, opt := range info.Config {
+		set.Config = append(set.Config, configOption{
+			Name:        name,
+			Type:        opt.Type,
+			Default:     opt.Default,
+			Description: opt.Description,
+		})
+	}
+	sort.Sort(configByName(set.Config))
+	for _, name := range info.Commands {
+		set.Commands = append(set.Commands, "cmd-"+name)
+	}
+	return set
+}
+
+// printHookSet prints the given hook set in human readable form.
+func printHookSet(set *hookSet) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "%s\n", set.Package)
+	fmt.Fprintf(w, "\nhooks:\n")
+	for _, name := range set.Hooks {
+		fmt.Fprintf(w, "\t%s\n", name)
+	}
+	if len(set.Relations) > 0 {
+		fmt.Fprintf(w, "\nrelations:\n")
+		for _, rel := range set.Relations {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\n", rel.Name, rel.Role, rel.Interface, rel.Scope, strings.Join(rel.Hooks, " "))
+		}
+	}
+	if len(set.Config) > 0 {
+		fmt.Fprintf(w, "\nconfig:\n")
+		for _, opt := range set.Config {
+			def := ""
+			if opt.Default != nil {
+				def = fmt.Sprintf("default %v", opt.Default)
+			}
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\n", opt.Name, opt.Type, def, opt.Description)
+		}
+	}
+	if len(set.Commands) > 0 {
+		fmt.Fprintf(w, "\ncommands:\n")
+		for _, name := range set.Commands {
+			fmt.Fprintf(w, "\t%s\n", name)
+		}
+	}
+}
+
+type relationsByName []relationHooks
+
+func (r relationsByName) Len() int           { return len(r) }
+func (r relationsByName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r relationsByName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+
+type configByName []configOption
+
+func (c configByName) Len() int           { return len(c) }
+func (c configByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c configByName) Less(i, j int) bool { return c[i].Name < c[j].Name }
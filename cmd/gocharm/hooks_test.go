@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/builder"
+)
+
+type hooksSuite struct{}
+
+var _ = gc.Suite(&hooksSuite{})
+
+func (*hooksSuite) TestNewHookSet(c *gc.C) {
+	info := &builder.CharmInfo{
+		Hooks: []string{
+			"config-changed",
+			"db-relation-changed",
+			"db-relation-joined",
+			"install",
+			"website-relation-joined",
+		},
+		Relations: map[string]charm.Relation{
+			"website": {
+				Name:      "website",
+				Role:      charm.RoleProvider,
+				Interface: "http",
+				Scope:     charm.ScopeGlobal,
+			},
+			"db": {
+				Name:      "db",
+				Role:      charm.RoleRequirer,
+				Interface: "mysql",
+				Scope:     charm.ScopeGlobal,
+			},
+			"peer": {
+				Name:      "peer",
+				Role:      charm.RolePeer,
+				Interface: "web-peer",
+				Scope:     charm.ScopeGlobal,
+			},
+		},
+		Config: map[string]charm.Option{
+			"port": {
+				Type:        "int",
+				Default:     8080,
+				Description: "The port to listen on.",
+			},
+			"motd": {
+				Type: "string",
+			},
+		},
+		Commands: []string{"root"},
+	}
+	set := newHookSet("example.com/charms/web", info)
+	data, err := json.MarshalIndent(set, "", "\t")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{
+	"Package": "example.com/charms/web",
+	"Hooks": [
+		"config-changed",
+		"db-relation-changed",
+		"db-relation-joined",
+		"install",
+		"website-relation-joined"
+	],
+	"Relations": [
+		{
+			"Name": "db",
+			"Role": "requirer",
+			"Interface": "mysql",
+			"Scope": "global",
+			"Hooks": [
+				"db-relation-changed",
+				"db-relation-joined"
+			]
+		},
+		{
+			"Name": "peer",
+			"Role": "peer",
+			"Interface": "web-peer",
+			"Scope": "global",
+			"Hooks": []
+		},
+		{
+			"Name": "website",
+			"Role": "provider",
+			"Interface": "http",
+			"Scope": "global",
+			"Hooks": [
+				"website-relation-joined"
+			]
+		}
+	],
+	"Config": [
+		{
+			"Name": "motd",
+			"Type": "string"
+		},
+		{
+			"Name": "port",
+			"Type": "int",
+			"Default": 8080,
+			"Description": "The port to listen on."
+		}
+	],
+	"Commands": [
+		"cmd-root"
+	]
+}`)
+}
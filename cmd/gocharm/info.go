@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// info prints the build information of the given built charm or,
+// if two charms are given, the differences between their builds.
+func info(charms ...string) error {
+	infos := make([]*builder.BuildInfo, len(charms))
+	for i, ch := range charms {
+		dir := charmDir(ch)
+		info, err := builder.ReadBuildInfo(dir)
+		if err != nil {
+			if os.IsNotExist(errgo.Cause(err)) {
+				return errgo.Newf("no build information found in %s; rebuild the charm with this version of gocharm", dir)
+			}
+			return errgo.Notef(err, "cannot read build information from %s", dir)
+		}
+		infos[i] = info
+	}
+	if len(infos) == 1 {
+		printBuildInfo(os.Stdout, infos[0])
+		return nil
+	}
+	diffs := diffBuildInfo(infos[0], infos[1])
+	if len(diffs) == 0 {
+		fmt.Println("builds are identical")
+		return nil
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	return nil
+}
+
+// charmDir returns the directory of the charm with the given name,
+// which may be a path to the charm's directory or its path within
+// the charm repository, such as "trusty/mycharm".
+func charmDir(name string) string {
+	if _, err := os.Stat(name); err == nil || *repo == "" {
+		return name
+	}
+	return filepath.Join(*repo, filepath.FromSlash(name))
+}
+
+// printBuildInfo prints the given build information
+// in human readable form.
+func printBuildInfo(w io.Writer, info *builder.BuildInfo) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	for _, f := range buildInfoFields(info) {
+		if f.val != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", f.name, f.val)
+		}
+	}
+	if len(info.Dependencies) > 0 {
+		fmt.Fprintf(tw, "\ndependencies:\n")
+		for _, path := range sortedKeys(info.Dependencies) {
+			fmt.Fprintf(tw, "\t%s\t%s\n", path, orUnknown(info.Dependencies[path]))
+		}
+	}
+	if len(info.Source) > 0 {
+		fmt.Fprintf(tw, "\nsource:\n")
+		for _, path := range sortedKeys(info.Source) {
+			fmt.Fprintf(tw, "\t%s\t%s\n", path, info.Source[path])
+		}
+	}
+}
+
+// diffBuildInfo returns a description of each difference
+// between the builds described by a and b.
+func diffBuildInfo(a, b *builder.BuildInfo) []string {
+	var diffs []string
+	bFields := buildInfoFields(b)
+	for i, f := range buildInfoFields(a) {
+		if f.val != bFields[i].val {
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", f.name, orNone(f.val), orNone(bFields[i].val)))
+		}
+	}
+	diffs = append(diffs, diffMap("dependency", a.Dependencies, b.Dependencies)...)
+	diffs = append(diffs, diffMap("source", a.Source, b.Source)...)
+	return diffs
+}
+
+// diffMap returns a description of each difference between
+// the entries of a and b, using the given kind of entry.
+func diffMap(kind string, a, b map[string]string) []string {
+	keys := make(map[string]string)
+	for k := range a {
+		keys[k] = ""
+	}
+	for k := range b {
+		keys[k] = ""
+	}
+	var diffs []string
+	for _, k := range sortedKeys(keys) {
+		av, aok := a[k]
+		bv, bok := b[k]
+		switch {
+		case !aok:
+			diffs = append(diffs, fmt.Sprintf("%s %s: added", kind, k))
+		case !bok:
+			diffs = append(diffs, fmt.Sprintf("%s %s: removed", kind, k))
+		case av != bv && kind == "source":
+			diffs = append(diffs, fmt.Sprintf("%s %s: changed", kind, k))
+		case av != bv:
+			diffs = append(diffs, fmt.Sprintf("%s %s: %s -> %s", kind, k, orUnknown(av), orUnknown(bv)))
+		}
+	}
+	return diffs
+}
+
+type buildInfoField struct {
+	name, val string
+}
+
+// buildInfoFields returns the scalar fields of the
+// given build information, formatted as strings.
+func buildInfoFields(info *builder.BuildInfo) []buildInfoField {
+	rev := ""
+	if info.Revision >= 0 {
+		rev = strconv.Itoa(info.Revision)
+	}
+	return []buildInfoField{
+		{"charm", info.Charm},
+		{"package", info.Package},
+		{"revision", rev},
+		{"series", info.Series},
+		{"commit", info.Commit},
+		{"built", info.BuildTime},
+		{"host", info.Host},
+		{"go", info.GoVersion},
+		{"image", info.Image},
+		{"gocharm", info.Gocharm},
+		{"options", strings.Join(info.Options, " ")},
+		{"tags", strings.Join(info.Tags, " ")},
+		{"ldflags", info.LDFlags},
+		{"gcflags", info.GCFlags},
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "(unknown)"
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+type infoSuite struct{}
+
+var _ = gc.Suite(&infoSuite{})
+
+func (*infoSuite) TestDiffBuildInfo(c *gc.C) {
+	a := &builder.BuildInfo{
+		Charm:     "mycharm",
+		Revision:  3,
+		GoVersion: "1.4.2",
+		Source: map[string]string{
+			"charm.go": "aaaa",
+			"old.go":   "bbbb",
+			"same.go":  "cccc",
+		},
+		Dependencies: map[string]string{
+			"github.com/juju/utils": "1234",
+		},
+	}
+	c.Assert(diffBuildInfo(a, a), gc.HasLen, 0)
+	b := &builder.BuildInfo{
+		Charm:     "mycharm",
+		Revision:  -1,
+		GoVersion: "1.5",
+		Options:   []string{"dispatch"},
+		Source: map[string]string{
+			"charm.go": "dddd",
+			"new.go":   "eeee",
+			"same.go":  "cccc",
+		},
+		Dependencies: map[string]string{
+			"github.com/juju/utils": "5678",
+			"gopkg.in/errgo.v1":     "",
+		},
+	}
+	c.Assert(diffBuildInfo(a, b), jc.DeepEquals, []string{
+		"revision: 3 -> (none)",
+		"go: 1.4.2 -> 1.5",
+		"options: (none) -> dispatch",
+		"dependency github.com/juju/utils: 1234 -> 5678",
+		"dependency gopkg.in/errgo.v1: added",
+		"source charm.go: changed",
+		"source new.go: added",
+		"source old.go: removed",
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// list prints the status of every charm in the charm repository.
+func list() error {
+	charms, err := builder.List(*repo, *maxDepth)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CHARM\tREVISION\tBUILT\tSTATUS\tHOOKS")
+	for _, ch := range charms {
+		rev := "-"
+		if ch.Revision >= 0 {
+			rev = strconv.Itoa(ch.Revision)
+		}
+		built := "-"
+		if !ch.BuildTime.IsZero() {
+			built = ch.BuildTime.Local().Format("2006-01-02 15:04")
+		}
+		var status string
+		switch {
+		case !ch.GoCharm:
+			status = "not a Go charm"
+		case ch.Package == "":
+			status = "unknown"
+		case ch.Stale:
+			status = "source changed"
+		default:
+			status = "up to date"
+		}
+		fmt.Fprintf(w, "%s/%s\t%s\t%s\t%s\t%s\n", ch.Series, ch.Name, rev, built, status, strings.Join(ch.Hooks, ","))
+	}
+	return w.Flush()
+}
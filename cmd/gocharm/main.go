@@ -2,18 +2,260 @@
 // Juju charm. It should be invoked as follows:
 //
 //	gocharm [flags] [package]
+//	gocharm upgrade [flags] service
+//	gocharm bundle [flags] bundle.yaml
+//	gocharm verify [flags] [package]
+//	gocharm doctor [flags]
+//	gocharm proof [flags] [package]
+//	gocharm test [flags] [package]
+//	gocharm list [flags]
+//	gocharm hooks [flags] [package]
+//	gocharm sync [flags] unit
+//	gocharm run-hook [flags] unit hook
+//	gocharm info [flags] charm [charm]
+//	gocharm docs [flags] [charm]
 //
 // The following flags are supported:
 //
 //	  -repo="": charm repo directory (defaults to $JUJU_REPOSITORY)
 //	  -series="trusty": select the os version to deploy the charm as
+//	  -all-series=false: build the charm for each series declared in metadata.yaml
 //	  -source=false: include source code instead of binary executable
+//	  -deploy=false: with bundle, deploy the bundle after building it
+//	  -dispatch=false: make each hook a symbolic link to the runhook executable instead of a stub script
+//	  -compress=false: strip debugging information from the runhook executable and compress it with upx if available
+//	  -depth=8: with list, the maximum depth of directories to search for charms
+//	  -debug=false: build the runhook executable for debugging with delve and add bin/debug-hook
+//	  -cgo=false: build the charm's executables with cgo enabled (needs a linux/amd64 host or -docker)
+//	  -docker="": build the charm's executables in a container created from this Docker image
+//	  -count=0: with test, run each test this many times
+//	  -coverprofile="": with test, write the charm's coverage profile to this file
+//	  -cover=false: with test, print the coverage of each package
+//	  -race=false: run the charm's tests with the race detector before building it (with test, enable the race detector)
+//	  -vet=false: run go vet on the charm's source before building it
+//	  -fmt=false: check that the charm's Go files are formatted with gofmt before building it
+//	  -checksum=false: write bin/runhook.sha256 and verify it in each hook before running the executable
+//	  -sign="": sign bin/runhook.sha256 with this GPG key (implies -checksum)
+//	  -hook="": with sync, run this hook on the unit after syncing
+//	  -json=false: with hooks, print the information as JSON
+//	  -n=false: print what would be done to install each charm without installing it
+//	  -o="": write a minimal deployable charm to this directory instead of the charm repository
+//	  -no-build=false: with test, do not build the charm after the tests pass
+//	  -placeholders=false: generate placeholder README.md, icon.svg and copyright files if they are missing
+//	  -revision-from="bump": how to choose the charm revision: bump, git or git-tag
+//	  -run="": with test, run only the tests matching this regular expression
+//	  -strict=false: treat warnings as errors and do not install the charm
+//	  -strip=false: exclude the Go source from the charm when it is deployed
+//	  -no-color=false: do not color warnings and errors
 //	  -v=false: print information about charms being built
+//	  -w=false: with upgrade, show the service's log until upgrade-charm completes
+//
+// The upgrade subcommand builds the charm in the current directory
+// and then runs juju upgrade-charm --switch to upgrade the given
+// deployed service to the newly built charm. This makes it quick to
+// iterate on a charm that is already deployed. If the -w flag is
+// given, it shows the juju debug-log output for the service's units
+// until every unit listed by juju status has finished running the
+// upgrade-charm hook, giving up after 10 minutes.
+//
+// The bundle subcommand builds all the Go charms used by the
+// services in the given bundle file. A service uses a Go charm when
+// its charm is given as a path to the charm's package directory,
+// relative to the bundle file, for example:
+//
+//	services:
+//	    web:
+//	        charm: ./charms/web
+//	        num_units: 2
+//
+// Each such charm is built for the bundle's series (or the -series
+// flag if the bundle does not specify one), and a copy of the bundle
+// that refers to the newly built local charms is written to
+// $JUJU_REPOSITORY/bundle. Other charms are left unchanged. If the
+// -deploy flag is given, the new bundle is then deployed.
+//
+// When the bundle subcommand or the -all-series flag builds more than
+// one charm, each line of output from building a charm, including
+// the output of go build and of the prebuild and postbuild commands,
+// is prefixed with the charm's name (and series, with -all-series),
+// and lines are never interleaved. Warnings and errors are colored
+// when the standard error is a terminal, unless the -no-color flag is
+// given or $NO_COLOR is set.
+//
+// The verify subcommand checks a charm package for problems without
+// building the charm. It runs the charm's RegisterHooks function
+// (this requires compiling a small inspection program, but not the
+// charm binary itself) and reports registered hooks that would never
+// run, an invalid metadata.yaml or series, inconsistent metrics,
+// options in a package config.yaml that are not registered, a missing
+// icon.svg, and generated hooks in the charm repository that are out
+// of date. It exits with a non-zero status if any problems are found,
+// which makes it suitable for use in CI.
+//
+// The doctor subcommand checks that the local environment can be
+// used to build charms: that the Go toolchain is present, at least
+// version 1.5 and able to build for linux/amd64; that each $GOPATH
+// entry exists, the first is writable, none holds compiled packages
+// older than the toolchain, and the current directory is inside one;
+// and that the charm repository exists, is writable and keeps its
+// charms in series directories. Each problem is printed with a
+// suggested fix.
+//
+// The proof subcommand checks the charm built from the package in
+// the charm repository for problems that would cause the charm
+// store to reject it, as the "charm proof" command does: invalid or
+// incomplete metadata, a missing or placeholder README, icon.svg or
+// copyright file, configuration options without descriptions, and
+// hooks that are not executable.
+//
+// The test subcommand runs the tests of the charm package and all
+// the packages under its directory with "go test", using the GOPATH,
+// tags and ldflags from the charm's gocharm.yaml, and then builds the
+// charm as gocharm does without a subcommand, unless the -no-build
+// flag is given or the tests fail. The -run, -count, -cover, -race and
+// -v flags are passed through to go test. The tests run with a
+// temporary GOPATH holding only the charm's source and the packages
+// that it and its tests import, and with a temporary build cache,
+// so they cannot depend on anything else in the developer's GOPATH.
+// If the -coverprofile flag is given, each package is tested with
+// coverage enabled, the coverage profiles of all the charm's packages
+// are merged into the given file (which can be viewed with "go tool
+// cover -html") and the total coverage of the charm is printed.
+//
+// The list subcommand prints every charm in the charm repository:
+// its revision, when it was last built by gocharm, its hooks, and
+// whether any file in the package it was built from has changed
+// since then (in which case it probably needs rebuilding). Charms
+// that were not built by gocharm are listed as such, and charms
+// built by earlier versions of gocharm have an unknown status.
+// Charms may be nested in directories below the series directory,
+// for example $JUJU_REPOSITORY/trusty/team/mycharm, to at most the
+// depth given by the -depth flag. Hidden directories are not
+// searched, and nor are directories matched by a pattern in a
+// .gocharmignore file in the repository or any directory below it.
+// Each line of the file holds a pattern, as understood by
+// filepath.Match, matched against each directory's name or, if
+// the pattern contains a slash, its path relative to the directory
+// holding the file. This can be used to skip large directories,
+// such as vendored source trees, that hold no charms.
+//
+// The hooks subcommand runs the charm's RegisterHooks function, as
+// verify does, and prints the hooks it registers, the relations they
+// belong to, the configuration options and the commands (invoked
+// with "runhook cmd-name"). With the -json flag the same information
+// is printed as JSON. The output is sorted, so it can be kept with
+// the charm's documentation or compared between revisions with diff.
+//
+// The sync subcommand builds the charm in the current directory, as
+// upgrade does, and then copies the files built into its bin
+// directory (the runhook executable, its checksum and signature if
+// any, and the executables built from src/cmd), and any generated
+// hook stubs, that differ from those on the unit straight into the
+// charm directory of the given deployed unit with juju scp and juju
+// ssh, so that changes to hook code can be tried without a full
+// upgrade-charm cycle. If the -hook flag is given, that hook
+// is then run on the unit, as run-hook does. Only existing files are
+// replaced: hooks that are newly registered, and changes to
+// metadata, configuration or assets, still need an upgrade. Juju
+// does not know about the synced files, so the next upgrade-charm
+// or deployment of another unit uses the charm as last uploaded.
+//
+// The run-hook subcommand runs the given hook on the given deployed
+// unit using juju run, which executes the unit's runhook executable
+// with the hook name inside a hook context and prints its output,
+// so a single hook can be tried again while debugging without
+// waiting for juju resolved --retry. The hook stub is bypassed, and
+// juju run provides no relation, so relation hooks cannot be run
+// this way.
+//
+// By default, the revision of a charm that has a revision file in the
+// charm repository is incremented each time it is built. If the
+// -revision-from flag is "git", the revision is instead the number of
+// commits in the history of the package's git repository (which must
+// not be a shallow clone); if it is "git-tag", it is the most recent
+// tag reachable from the current commit that is a number, optionally
+// prefixed with "v" or "r" (for example "v42"). Either way, the same
+// commit always gives the same revision, whichever machine the charm
+// is built on, so revisions built by different developers do not
+// diverge. A warning is printed if there are uncommitted changes,
+// because they are not reflected in the revision.
+//
+// If the -n flag is specified, each charm is built in a temporary
+// directory, but nothing is installed. Instead, gocharm prints what
+// installing it would do: the hooks that would be generated,
+// regenerated or removed, modified hooks that would be kept, whether
+// the revision would be bumped, the executables in bin that would be
+// rebuilt (and whether their source has changed since the charm was
+// last built), and the prebuild and postbuild commands that would be
+// run. Those commands are not run, so a charm whose build depends on
+// them may fail to build. The -n flag cannot be used with the
+// upgrade, bundle or sync subcommands.
+//
+// If the -strict flag is specified, any warning printed while
+// building a charm, such as for a modified hook that cannot be
+// overwritten, causes the build to fail without installing the
+// charm. This is useful in continuous integration, where warnings
+// would otherwise go unnoticed. The -v flag prints the paths that
+// are skipped when building, and why.
+//
+// The -fmt, -vet and -race flags check the charm's source before it
+// is built: -fmt reports Go files that are not formatted as by
+// gofmt, -vet runs go vet on the charm's packages and -race runs the
+// charm's tests with the race detector enabled, as the test
+// subcommand does. All the requested checks are run and every
+// failure is reported. A charm that fails any of them is not built;
+// the bundle subcommand still builds its other charms, so that the
+// problems in all of them are reported together, but does not write
+// the bundle.
+//
+// Each built charm records how it was built in $charmdir/.build-info.yaml:
+// the machine, Go version and gocharm commit it was built with, the
+// version control commit and SHA-256 hash of each file of the package
+// source, the commit of each repository holding a package that the
+// charm imports, and the build flags and options. The info subcommand
+// prints this information for the given charm, which may be a
+// directory or a path within the charm repository such as
+// trusty/mycharm. If two charms are given, it prints the differences
+// between their builds instead, which helps when working out why two
+// builds of the same charm behave differently.
+//
+// Each built charm also describes what it registers in
+// $charmdir/.gocharm/registry.json: its hooks, relations,
+// configuration options, metrics, resources, commands, binaries,
+// series and LXD profile, and the files in its assets directory. Other
+// tools, such as dashboards, documentation generators and validators,
+// can read it (see builder.RegistryInfo) without running any of the
+// charm's code.
+//
+// The docs subcommand prints Markdown documentation for the given
+// built charm, which may be a directory or a path within the charm
+// repository, or, if no charm is given, for the charm in the current
+// directory. It is generated from the charm's registry description and
+// the Go package documentation of the charm package, and lists the
+// charm's configuration options (with their types, defaults and
+// descriptions), relations, actions (read from the actions.yaml file in
+// the charm package directory), commands and hooks. The output is
+// intended to be included as a section of the charm's README.md.
 //
 // If the -source flag is specified, all source dependencies are installed
 // in the destination charm directory, otherwise just the package
 // source itself and the compiled binary.
 //
+// If the -o flag is specified, the charm is written to the given
+// directory instead of the charm repository, and $JUJU_REPOSITORY
+// need not be set. The charm written there holds only what is
+// needed to deploy it: metadata, configuration, hooks, assets and
+// the compiled binary in bin. The Go source (src and pkg), version
+// control directories and test files are left out.
+//
+// If the -strip flag is specified, the charm is installed into the
+// charm repository as usual, but a $charmdir/.jujuignore file is
+// written that tells juju not to upload the Go source (src, pkg and
+// Godeps) when deploying, so units do not download source they will
+// never compile. The source is still present locally; building again
+// without -strip removes the .jujuignore file. The -strip flag cannot
+// be used with -source.
+//
 // In order to qualify as a charm, a Go package must implement
 // a RegisterHooks function with the following signature:
 //
@@ -24,11 +266,38 @@
 // options. See the hook package (github.com/juju/gocharm/hook)
 // for an explanation of the hook registry.
 //
+// To find out what the charm registers, gocharm builds and runs a
+// small program that calls RegisterHooks. The program runs in a
+// temporary directory with an environment containing only $PATH,
+// so that initialization code cannot affect the real environment.
+// Hooks registered conditionally may not be registered when the
+// program runs, so any hook registered with a literal name in a call
+// to RegisterHook or RegisterHookWithPriority in the charm's package
+// is included too.
+//
+// The package may be given as an import path or as a path to its
+// directory (for example "gocharm ./mycharm"), so the charm source
+// can live anywhere in $GOPATH rather than in the charm repository.
+//
 // The hook is installed into the $JUJU_REPOSITORY/$series/$name
-// directory for each series specified on the command line (the
-// current series by default); $name is the last element of the
-// package path (it can be overridden with the -name flag).
+// directory, where $series is taken from the series field in
+// the package's metadata.yaml if present, or from the -series flag
+// otherwise; $name is the last element of the package path. The
+// series field may hold a single series or a list of them, in which
+// case the first is used unless the -series flag selects another
+// (it is an error for the flag to name a series that is not
+// declared). If the -all-series flag is given, the charm is built
+// and installed separately for each declared series; the written
+// metadata.yaml names only the series that each charm was built for,
+// which the charm can also find with hook.BuildInfo, so that
+// behaviour that differs between series can be chosen when the
+// charm is built. A charm that uses a feature registered with
+// hook.Registry.RegisterSeries cannot be built for a series that
+// the feature does not support.
 // This directory is referred to as $charmdir below.
+// The charm is built in a temporary directory and then moved
+// into place in a single step, so concurrent gocharm runs never
+// see (or leave behind) a partially written $charmdir.
 //
 // For a package $pkg, the package source and all its subdirectories
 // will be stored in $charmdir/src/$pkg.
@@ -37,41 +306,223 @@
 //
 //	metadata.yaml
 //
-// metadata.yaml will have registered relations added, and is
-// installed in $charmdir/metadata.yaml .
+// metadata.yaml will have registered relations and resources added,
+// and is installed in $charmdir/metadata.yaml . A subordinate charm
+// (with "subordinate: true" in metadata.yaml) need not declare its
+// container-scoped relation there; it may register it with
+// hook.Registry.RegisterPrincipalRelation instead.
 //
 //	assets
 //
 // If there is a directory named "assets", a symbolic link to it will
 // be created in $charmdir.
 //
-// If there is a file named README.md, a copy of it will be
-// created in $charmdir.
+// If there is a file named README.md (or README), icon.svg or
+// copyright, a copy of it will be created in $charmdir. The charm
+// store rejects charms without these files, so a warning is printed
+// for each one that is missing; if the -placeholders flag is given,
+// a placeholder is generated in $charmdir instead, which should be
+// replaced before the charm is published.
+//
+//	src/runhook/main.go.tmpl
+//
+// The runhook executable is built from a generated main package
+// that registers the charm's hooks and runs the one Juju invoked. If
+// this file exists, it is used as a text/template for that package
+// instead, so that a charm can do its own setup first (for example
+// configure logging, load a .env file or seed math/rand). The
+// template is given .CharmPackage and .HookPackage (the import paths
+// to use) and .AutogenMessage. The result must still call
+// hook.NewRegistry, the charm's RegisterHooks and hook.RunMain, which
+// runs the hook and handles "runhook version" and the exit status;
+// gocharm refuses to build the charm otherwise. The generated main package (shown by
+// builder.GenerateMain) is a good starting point.
+//
+//	src/cmd
+//
+// Each subdirectory of src/cmd that holds a main package is built,
+// with the same flags and for the same platform as the runhook
+// executable, into $charmdir/bin under the name of the
+// subdirectory, so a charm can ship separate executables for its
+// agents or cron jobs alongside its hooks. The charm can find them
+// on the unit with hook.Context.BinaryPath; if it registers them
+// with hook.Registry.RegisterBinary, gocharm (and gocharm verify)
+// reports any that are missing. With -source, they are compiled on
+// the unit along with runhook.
 //
 // The charm binary will be installed into $charmdir/runhook.
+// It records the charm's name and revision, the time it was built and
+// the version control commit of the package source (with a "+"
+// suffix if there were uncommitted changes), which are returned by
+// hook.BuildInfo and printed by running "runhook version" on a unit.
 // A $charmdir/config.yaml file will be created containing
 // all registered charm configuration options.
 // A hooks directory will be created containing an entry
-// for each registered hook.
+// for each registered hook. The environment, working directory,
+// interpreter and setup commands of each hook stub can be
+// specified with hook.Registry.RegisterHookStub.
+//
+// If the -compress flag is specified, the runhook executable is
+// linked without its symbol table and debugging information (-ldflags
+// "-s -w") and, if the upx command is found in $PATH, compressed with
+// it. The size of the executable before and after is printed for each
+// charm. Stack traces from a stripped executable still include
+// function names, but it cannot be debugged with gdb or delve.
+//
+// If the -debug flag is specified, the runhook executable (and any
+// executables in src/cmd) is built with optimizations and inlining
+// disabled (-gcflags "all=-N -l", which needs Go 1.10 or later),
+// keeping its debugging information, and a bin/debug-hook script is
+// added to the charm. After deploying the charm, start a juju
+// debug-hooks session for the unit and, when a hook is trapped, run
+// bin/debug-hook there instead of the hook itself: it runs the
+// runhook executable for the hook under a headless delve server
+// listening on localhost:2345 (or $DELVE_PORT) on the unit, which can
+// be reached with "juju ssh unit -N -L 2345:localhost:2345" and then
+// "dlv connect localhost:2345". Delve must be installed on the unit.
+// The -debug flag cannot be used with -source or -compress.
+//
+// Whatever flags are used, running "bin/runhook shell" in a juju
+// debug-hooks session starts an interactive shell whose commands
+// (config-get, relation-ids, relation-get, relation-set and
+// status-set) call the same hook.Context methods as the charm's
+// hooks, with tab completion of command names, configuration options,
+// relation ids and units. No hook functions are run and the charm's
+// persistent state is left unchanged.
+//
+// If the -docker flag is specified, the runhook executable (and any
+// executables in src/cmd) is built by running go build in a container
+// created from the given Docker image, for example golang:1.4.2, so
+// the Go toolchain and C libraries used do not depend on the machine
+// building the charm. Pinning the image pins the toolchain, so builds
+// are reproducible across developer machines and CI. Each GOPATH entry
+// is mounted read-only at the same path in the container, which has
+// no network access, and only the output directory is writable.
+// gocharm still needs a local Go toolchain to inspect the charm's
+// hooks. The -docker flag cannot be used with -source.
+//
+// The charm's executables are built for linux/amd64 with cgo
+// disabled, so that they can be cross-compiled from any machine. If
+// the -cgo flag is specified, cgo is enabled instead (CGO_ENABLED=1),
+// so charms that need C libraries such as sqlite can be built. Because
+// cgo cannot cross-compile, the build machine must then be
+// linux/amd64, unless -docker is also given, in which case cgo is
+// enabled in the container whatever the build machine is. Other
+// variables that affect the build, such as $GOFLAGS and $GOCACHE, are
+// passed to the go tool unchanged. With the -v flag, the environment
+// each executable is built with (GOOS, GOARCH, CGO_ENABLED, GOFLAGS,
+// GOCACHE and GOPATH) is printed, to help explain builds that differ
+// between machines.
+//
+// If the -checksum flag is specified, the SHA-256 checksum of the
+// runhook executable is written to bin/runhook.sha256, and each hook
+// stub verifies it before running the executable, failing the hook
+// if the executable has been corrupted or tampered with. If the
+// -sign flag is also given, bin/runhook.sha256 is signed with the
+// given GPG key (using "gpg --detach-sign") and the signature written
+// to bin/runhook.sha256.asc, so that operators can check where the
+// charm came from. Neither can be used with -source or -dispatch.
+//
+// If the -dispatch flag is specified, each entry in the hooks
+// directory is instead a symbolic link to bin/runhook, which infers
+// the hook name from the name it was invoked with. Customized hook
+// stubs cannot be used in this mode, and neither can -source,
+// because the binary must be present when the charm is deployed.
+// When the runhook executable is run without a hook name, it also
+// looks for one in $JUJU_DISPATCH_PATH and $JUJU_HOOK_NAME, so it
+// can be run from the dispatch script of newer Juju charm layouts.
+//
+//	metrics.yaml
+//
+// If there is a metrics.yaml file, any metrics registered
+// with the hook registry are added to it, and it is installed in
+// $charmdir/metrics.yaml. If there is no metrics.yaml file,
+// one is created if any metrics have been registered.
+// It is an error to register a collect-metrics hook
+// without declaring any metrics.
+//
+//	lxd-profile.yaml
+//
+// If there is an lxd-profile.yaml file, any LXD profile settings
+// registered with the hook registry (see
+// hook.Registry.RegisterLXDProfileConfig and
+// RegisterLXDProfileDevice) are added to it, and it is installed in
+// $charmdir/lxd-profile.yaml. If there is no lxd-profile.yaml file,
+// one is created if any settings have been registered. It is an error
+// for the profile to contain configuration or devices that Juju does
+// not allow in a charm's profile.
+//
+//	gocharm.yaml
+//
+// If there is a gocharm.yaml file, it configures how the charm is
+// built. For example:
+//
+//	gopath:
+//	    - ../third_party
+//	tags: [netgo]
+//	ldflags: -X main.version=1.2
+//	go: "1.4"
+//	prebuild:
+//	    - protoc --go_out=. api.proto
+//	postbuild:
+//	    - make -C web OUT=$CHARM_DIR/assets
+//
+// The gopath entries (relative to the package directory) are placed
+// before $GOPATH when building the charm, so that packages pinned
+// in them take precedence. The tags and ldflags are passed to the go
+// tool when building the runhook executable. If go is specified, the
+// charm is built with the go$version executable if it is found in
+// $PATH (as installed by golang.org/dl), and otherwise it is an error
+// if the go executable is not of that version. Unknown fields,
+// nonexistent gopath entries and invalid tags are errors.
+//
+// The prebuild and postbuild entries are shell commands, each run
+// with "sh -c" in the package directory with the configured GOPATH.
+// The prebuild commands run before anything is compiled, so they can
+// generate Go source (protocol buffers, for example); the postbuild
+// commands run after the charm has been built but before it is
+// installed, with $CHARM_DIR set to the directory holding the built
+// charm, so they can add compiled assets to $CHARM_DIR/assets. Only
+// the files that gocharm installs (such as assets, bin and hooks) are
+// copied from $CHARM_DIR. If any command fails, the charm is not
+// installed.
+//
+// The hooks that gocharm generates are recorded in
+// $charmdir/.gocharm/hooks.json. On subsequent runs, generated hooks
+// that have not been changed are regenerated, or removed if they are no
+// longer registered. Any other hook in $charmdir/hooks, including a
+// generated hook that has been edited, is left alone; gocharm prints
+// a warning showing how an edited hook differs from the one it would
+// have generated.
+//
+// Gocharm exits with status 0 on success, 1 if a charm could not be
+// built, 2 if the command line is invalid, 3 if a charm failed
+// verification or the checks requested with -fmt, -vet or -race, 4 if
+// the environment is not set up to build charms (for example, the
+// package is not inside $GOPATH or $JUJU_REPOSITORY is not set) and 5
+// if there was nothing to build because a bundle holds no Go charms.
+// Wrapper scripts for repositories that mix Go charms with others may
+// treat status 5 as success.
+//
+// The work of building a charm is done by the
+// github.com/juju/gocharm/builder package, which may be used
+// directly by other tools that need to build charms.
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
 	"go/build"
-	"io"
-	"io/ioutil"
 	"log"
 	"os"
-	"path"
+	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 
-	"github.com/juju/utils/fs"
 	"gopkg.in/errgo.v1"
 	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/builder"
 )
 
 var (
@@ -79,6 +530,36 @@ var (
 	verbose = flag.Bool("v", false, "print information about charms being built")
 	source  = flag.Bool("source", false, "include source code instead of binary executable")
 	godeps  = flag.Bool("godeps", false, "include godeps output in $CHARM_DIR/dependencies.tsv")
+	watch   = flag.Bool("w", false, "with upgrade, show the service's log until upgrade-charm completes")
+	deploy  = flag.Bool("deploy", false, "with bundle, deploy the bundle after building it")
+
+	outputDir = flag.String("o", "", "write a minimal deployable charm to this directory instead of the charm repository")
+	strip     = flag.Bool("strip", false, "exclude the Go source from the charm when it is deployed")
+	dispatch  = flag.Bool("dispatch", false, "make each hook a symbolic link to the runhook executable instead of a stub script")
+	compress  = flag.Bool("compress", false, "strip debugging information from the runhook executable and compress it with upx if available")
+	debug     = flag.Bool("debug", false, "build the runhook executable for debugging with delve and add bin/debug-hook")
+	cgo       = flag.Bool("cgo", false, "build the charm's executables with cgo enabled (needs a linux/amd64 host or -docker)")
+	docker    = flag.String("docker", "", "build the charm's executables in a container created from this Docker image")
+	checksum  = flag.Bool("checksum", false, "write bin/runhook.sha256 and verify it in each hook before running the executable")
+	signKey   = flag.String("sign", "", "sign bin/runhook.sha256 with this GPG key (implies -checksum)")
+
+	testRun      = flag.String("run", "", "with test, run only the tests matching this regular expression")
+	testCount    = flag.Int("count", 0, "with test, run each test this many times")
+	coverProfile = flag.String("coverprofile", "", "with test, write the charm's coverage profile to this file")
+	testCover    = flag.Bool("cover", false, "with test, print the coverage of each package")
+	testRace     = flag.Bool("race", false, "run the charm's tests with the race detector before building it (with test, enable the race detector)")
+	vet          = flag.Bool("vet", false, "run go vet on the charm's source before building it")
+	checkFmt     = flag.Bool("fmt", false, "check that the charm's Go files are formatted with gofmt before building it")
+	noBuild      = flag.Bool("no-build", false, "with test, do not build the charm after the tests pass")
+	placeholders = flag.Bool("placeholders", false, "generate placeholder README.md, icon.svg and copyright files if they are missing")
+	jsonOutput   = flag.Bool("json", false, "with hooks, print the information as JSON")
+	syncHook     = flag.String("hook", "", "with sync, run this hook on the unit after syncing")
+	revisionFrom = flag.String("revision-from", builder.RevisionBump, "how to choose the charm revision: bump, git or git-tag")
+	dryRun       = flag.Bool("n", false, "print what would be done to install each charm without installing it")
+	strict       = flag.Bool("strict", false, "treat warnings as errors and do not install the charm")
+	maxDepth     = flag.Int("depth", builder.DefaultMaxDepth, "with list, the maximum depth of directories to search for charms")
+	allSeries    = flag.Bool("all-series", false, "build the charm for each series declared in metadata.yaml")
+	noColor      = flag.Bool("no-color", false, "do not color warnings and errors")
 )
 
 // TODO select current OS version by default
@@ -88,246 +569,425 @@ var exitCode = 0
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "usage: gocharm [flags] [package]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm upgrade [flags] service\n")
+		fmt.Fprintf(os.Stderr, "       gocharm bundle [flags] bundle.yaml\n")
+		fmt.Fprintf(os.Stderr, "       gocharm verify [flags] [package]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm doctor [flags]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm proof [flags] [package]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm test [flags] [package]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm list [flags]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm hooks [flags] [package]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm sync [flags] unit\n")
+		fmt.Fprintf(os.Stderr, "       gocharm run-hook [flags] unit hook\n")
+		fmt.Fprintf(os.Stderr, "       gocharm info [flags] charm [charm]\n")
+		fmt.Fprintf(os.Stderr, "       gocharm docs [flags] [charm]\n")
 		flag.PrintDefaults()
-		os.Exit(2)
+		fmt.Fprintf(os.Stderr, "\n%s", exitCodesUsage)
+		os.Exit(exitUsageError)
 	}
-	flag.Parse()
-	if *repo == "" {
-		if *repo = os.Getenv("JUJU_REPOSITORY"); *repo == "" {
-			fatalf("JUJU_REPOSITORY environment variable not set")
+	if len(os.Args) > 1 && os.Args[1] == "upgrade" {
+		parseFlags(os.Args[2:])
+		setRepo()
+		if *outputDir != "" {
+			fatalf("cannot use -o with upgrade")
+		}
+		if *dryRun {
+			fatalf("cannot use -n with upgrade")
 		}
+		if flag.NArg() != 1 {
+			flag.Usage()
+		}
+		if err := upgrade(flag.Arg(0)); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	var pkgPath string
-	switch flag.NArg() {
-	case 0:
-		pkgPath = "."
-	case 1:
-		pkgPath = flag.Arg(0)
-	default:
-		flag.Usage()
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		parseFlags(os.Args[2:])
+		setRepo()
+		if *outputDir != "" {
+			fatalf("cannot use -o with sync")
+		}
+		if *dryRun {
+			fatalf("cannot use -n with sync")
+		}
+		if *source {
+			fatalf("cannot use -source with sync")
+		}
+		if flag.NArg() != 1 {
+			flag.Usage()
+		}
+		if err := syncUnit(flag.Arg(0)); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	if err := main1(pkgPath); err != nil {
-		fatalf("%v", err)
+	if len(os.Args) > 1 && os.Args[1] == "run-hook" {
+		parseFlags(os.Args[2:])
+		if flag.NArg() != 2 {
+			flag.Usage()
+		}
+		if err := runHook(flag.Arg(0), flag.Arg(1)); err != nil {
+			fatal(err)
+		}
+		return
 	}
-}
-
-func main1(pkgPath string) error {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return errgo.Notef(err, "cannot get current directory")
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		parseFlags(os.Args[2:])
+		if *repo == "" {
+			*repo = os.Getenv("JUJU_REPOSITORY")
+		}
+		if flag.NArg() != 1 && flag.NArg() != 2 {
+			flag.Usage()
+		}
+		if err := info(flag.Args()...); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	// Ensure that the package and all its dependencies are
-	// installed before generating anything. This ensures
-	// that we can generate the binary quickly, and that
-	// it will be in sync with any package that have uninstalled
-	// changes.
-	if err := runCmd("", nil, "go", "install", pkgPath).Run(); err != nil {
-		return errgo.Notef(err, "cannot install %q", pkgPath)
+	if len(os.Args) > 1 && os.Args[1] == "docs" {
+		parseFlags(os.Args[2:])
+		if *repo == "" {
+			*repo = os.Getenv("JUJU_REPOSITORY")
+		}
+		if flag.NArg() > 1 {
+			flag.Usage()
+		}
+		if err := docs(flag.Arg(0)); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	pkg, err := build.Default.Import(pkgPath, cwd, 0)
-	if err != nil {
-		return errgo.Notef(err, "cannot import %q", pkgPath)
+	if len(os.Args) > 1 && os.Args[1] == "bundle" {
+		parseFlags(os.Args[2:])
+		setRepo()
+		if *outputDir != "" {
+			fatalf("cannot use -o with bundle")
+		}
+		if *dryRun {
+			fatalf("cannot use -n with bundle")
+		}
+		if flag.NArg() != 1 {
+			flag.Usage()
+		}
+		if _, err := bundle(flag.Arg(0)); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	charmName := path.Base(pkg.Dir)
-	dest := filepath.Join(*repo, *series, charmName)
-
-	if _, err := canClean(dest); err != nil {
-		return errgo.Notef(err, "cannot clean destination directory")
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		parseFlags(os.Args[2:])
+		if *repo == "" {
+			*repo = os.Getenv("JUJU_REPOSITORY")
+		}
+		pkgPath := "."
+		switch flag.NArg() {
+		case 0:
+		case 1:
+			pkgPath = flag.Arg(0)
+		default:
+			flag.Usage()
+		}
+		if err := verify(pkgPath); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	rev, err := readRevision(dest)
-	if err != nil {
-		return errgo.Notef(err, "cannot read revision")
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		parseFlags(os.Args[2:])
+		if *repo == "" {
+			*repo = os.Getenv("JUJU_REPOSITORY")
+		}
+		if flag.NArg() != 0 {
+			flag.Usage()
+		}
+		if err := doctor(); err != nil {
+			fatal(err)
+		}
+		return
 	}
-
-	// We put everything into a directory in /tmp first,
-	// so we have less chance of deleting everything from
-	// the destination without having something to replace
-	// it with.
-	tempDir, err := ioutil.TempDir("", "gocharm")
-	if err != nil {
-		return errgo.Notef(err, "cannot make temporary directory")
+	if len(os.Args) > 1 && os.Args[1] == "proof" {
+		parseFlags(os.Args[2:])
+		setRepo()
+		pkgPath := "."
+		switch flag.NArg() {
+		case 0:
+		case 1:
+			pkgPath = flag.Arg(0)
+		default:
+			flag.Usage()
+		}
+		if err := proof(pkgPath); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	defer os.RemoveAll(tempDir)
-
-	tempCharmDir := filepath.Join(tempDir, "charm")
-	if err := copyContents(pkg, tempCharmDir); err != nil {
-		return errgo.Notef(err, "cannot copy package contents")
+	if len(os.Args) > 1 && os.Args[1] == "list" {
+		parseFlags(os.Args[2:])
+		setRepo()
+		if flag.NArg() != 0 {
+			flag.Usage()
+		}
+		if err := list(); err != nil {
+			fatal(err)
+		}
+		return
 	}
-
-	if err := buildCharm(buildCharmParams{
-		pkg:      pkg,
-		charmDir: tempCharmDir,
-		tempDir:  tempDir,
-		source:   *source,
-		// TODO godeps
-	}); err != nil {
-		return errgo.Mask(err)
+	if len(os.Args) > 1 && os.Args[1] == "hooks" {
+		parseFlags(os.Args[2:])
+		pkgPath := "."
+		switch flag.NArg() {
+		case 0:
+		case 1:
+			pkgPath = flag.Arg(0)
+		default:
+			flag.Usage()
+		}
+		if err := hooks(pkgPath); err != nil {
+			fatal(err)
+		}
+		return
 	}
-
-	// The local revision number should not matter, but
-	// there is a bug in juju that means that the charm
-	// will not be correctly uploaded if it is not there, so we
-	// preserve the revision found in the destination directory.
-	if rev != -1 {
-		rev++
-		if err := writeRevision(tempCharmDir, rev); err != nil {
-			return errgo.Notef(err, "cannot write revision file")
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "test" {
+		args = args[1:]
+		parseFlags(args)
+		pkgPath := "."
+		switch flag.NArg() {
+		case 0:
+		case 1:
+			pkgPath = flag.Arg(0)
+		default:
+			flag.Usage()
 		}
+		if err := test(pkgPath); err != nil {
+			fatal(err)
+		}
+		if *noBuild {
+			return
+		}
+		// The tests have just been run, so there is
+		// no need to run them again before building.
+		*testRace = false
 	}
-	if err := cleanDestination(dest); err != nil {
-		return errgo.Mask(err)
+	parseFlags(args)
+	if *outputDir == "" {
+		setRepo()
+	} else if *source {
+		fatalf("cannot use -source with -o")
 	}
-	if err := os.MkdirAll(dest, 0777); err != nil {
-		return errgo.Mask(err)
+	if *strip && *source {
+		fatalf("cannot use -source with -strip")
 	}
-	for name := range allowed {
-		from := filepath.Join(tempCharmDir, name)
-		if _, err := os.Stat(from); err != nil {
-			if !os.IsNotExist(err) {
-				return errgo.Mask(err)
-			}
-			continue
-		}
-		if err := fs.Copy(from, filepath.Join(dest, name)); err != nil {
-			return errgo.Notef(err, "cannot copy to final destination")
-		}
+	if *dispatch && *source {
+		fatalf("cannot use -source with -dispatch")
 	}
-	curl := &charm.URL{
-		Schema:   "local",
-		Series:   *series,
-		Name:     charmName,
-		Revision: -1,
+	if *compress && *source {
+		fatalf("cannot use -source with -compress")
 	}
-	fmt.Println(curl)
-	return nil
-}
-
-func copyContents(pkg *build.Package, destDir string) error {
-	destPkgDir := filepath.Join(destDir, "src", filepath.FromSlash(pkg.ImportPath))
-	if err := os.MkdirAll(filepath.Dir(destPkgDir), 0777); err != nil {
-		return errgo.Mask(err)
+	if *debug && (*source || *compress) {
+		fatalf("cannot use -debug with -source or -compress")
 	}
-	if err := fs.Copy(pkg.Dir, destPkgDir); err != nil {
-		return errgo.Notef(err, "cannot copy package")
+	if *docker != "" && *source {
+		fatalf("cannot use -docker with -source")
 	}
-	if _, err := os.Stat(filepath.Join(destPkgDir, "assets")); err == nil {
-		// Make relative symlink from assets in charm root directory
-		// to where it lives in the charm package.
-		if err := os.Symlink(filepath.Join("src", filepath.FromSlash(pkg.ImportPath), "assets"), filepath.Join(destDir, "assets")); err != nil {
-			return errgo.Mask(err)
-		}
+	if (*checksum || *signKey != "") && (*source || *dispatch) {
+		fatalf("cannot use -checksum or -sign with -source or -dispatch")
 	}
-	if _, err := os.Stat(filepath.Join(destPkgDir, "README.md")); err == nil {
-		if err := fs.Copy(filepath.Join(destPkgDir, "README.md"), filepath.Join(destDir, "README.md")); err != nil {
-			return errgo.Mask(err)
-		}
+	if *allSeries && (*outputDir != "" || seriesSet()) {
+		fatalf("cannot use -all-series with -o or -series")
 	}
-	return nil
-}
-
-func cleanDestination(dir string) error {
-	needRemove, err := canClean(dir)
-	if err != nil {
-		return errgo.Mask(err)
+	var pkgPath string
+	switch flag.NArg() {
+	case 0:
+		pkgPath = "."
+	case 1:
+		pkgPath = flag.Arg(0)
+	default:
+		flag.Usage()
 	}
-	for _, p := range needRemove {
-		if *verbose {
-			log.Printf("removing %s", p)
-		}
-		if err := os.RemoveAll(p); err != nil {
-			return errgo.Mask(err)
+	if *allSeries {
+		if err := installAllSeries(pkgPath); err != nil {
+			fatal(err)
 		}
+		return
+	}
+	if _, err := main1(pkgPath); err != nil {
+		fatal(err)
 	}
-	return nil
 }
 
-var allowed = map[string]bool{
-	"assets":           true,
-	"bin":              true,
-	"compile":          true,
-	"config.yaml":      true,
-	"dependencies.tsv": true,
-	"hooks":            true,
-	"metadata.yaml":    true,
-	"pkg":              true, // This allows us to test the compile scripts in the charm dir.
-	"README.md":        true,
-	"revision":         true,
-	"src":              true,
+// parseFlags parses the given command line flags.
+func parseFlags(args []string) {
+	flag.CommandLine.Parse(args)
+	builder.Verbose = *verbose
+	setupOutput()
 }
 
-func canClean(dir string) (needRemove []string, err error) {
-	infos, err := ioutil.ReadDir(dir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+// setRepo sets *repo from $JUJU_REPOSITORY if
+// it has not been set explicitly.
+func setRepo() {
+	if *repo == "" {
+		if *repo = os.Getenv("JUJU_REPOSITORY"); *repo == "" {
+			fatal(errgo.WithCausef(nil, errEnvironment, "JUJU_REPOSITORY environment variable not set"))
 		}
-		return nil, errgo.Mask(err)
 	}
-	var toRemove []string
-	for _, info := range infos {
-		if info.Name()[0] == '.' {
-			continue
-		}
-		if !allowed[info.Name()] {
-			return nil, errgo.Newf("unexpected file %q found in %s", info.Name(), dir)
-		}
-		path := filepath.Join(dir, info.Name())
-		if strings.HasSuffix(path, ".yaml") && !autogenerated(path) {
-			return nil, errgo.Newf("non-autogenerated file %q", path)
-		}
-		toRemove = append(toRemove, path)
+}
+
+// main1 builds the charm in the given package, installs it
+// into the charm repository and returns its URL.
+func main1(pkgPath string) (*charm.URL, error) {
+	pkg, err := importCharmPackage(&build.Default, pkgPath)
+	if err != nil {
+		return nil, errgo.Mask(err, isCategorized)
+	}
+	charmSeries, err := builder.InferSeries(pkg.Dir, *series, seriesSet())
+	if err != nil {
+		return nil, errgo.Mask(err)
 	}
-	return toRemove, nil
+	return install(pkgPath, charmSeries)
 }
 
-func autogenerated(path string) bool {
-	f, err := os.Open(path)
+// importCharmPackage finds the charm package with the given path,
+// relative to the current directory, in ctxt. It returns an
+// errNothingToBuild error if the package does not define a
+// RegisterHooks function, so that running gocharm over a
+// directory that is not a Go charm is not treated as a build
+// failure.
+func importCharmPackage(ctxt *build.Context, pkgPath string) (*build.Package, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot get current directory")
+	}
+	pkg, err := ctxt.Import(pkgPath, cwd, build.FindOnly)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot import %q", pkgPath)
+	}
+	if build.IsLocalImport(pkg.ImportPath) || strings.HasPrefix(pkg.ImportPath, "_") {
+		return nil, errgo.WithCausef(nil, errEnvironment, "charm directory %q is not inside $GOPATH", pkg.Dir)
+	}
+	ok, err := builder.HasRegisterHooks(pkg.Dir)
 	if err != nil {
-		return false
+		return nil, errgo.Notef(err, "cannot read %q", pkg.Dir)
 	}
-	defer f.Close()
-	buf := make([]byte, len(yamlAutogenComment))
-	if _, err := io.ReadFull(f, buf); err != nil {
-		return false
+	if !ok {
+		return nil, errgo.WithCausef(nil, errNothingToBuild, "no RegisterHooks function found in %q", pkg.ImportPath)
 	}
-	return bytes.Equal(buf, []byte(yamlAutogenComment))
+	return pkg, nil
 }
 
-func readRevision(charmDir string) (int, error) {
-	path := revisionPath(charmDir)
-	data, err := ioutil.ReadFile(path)
-	if os.IsNotExist(err) {
-		// No revision file, nothing to increment.
-		return -1, nil
+// installAllSeries builds the charm in the given package for each
+// of the series declared in its metadata.yaml and installs them
+// into the charm repository.
+func installAllSeries(pkgPath string) error {
+	pkg, err := importCharmPackage(&build.Default, pkgPath)
+	if err != nil {
+		return errgo.Mask(err, isCategorized)
 	}
+	allSeries, err := builder.PackageSeries(pkg.Dir)
 	if err != nil {
-		return 0, errgo.Mask(err)
+		return errgo.Mask(err)
+	}
+	if len(allSeries) == 0 {
+		return errgo.WithCausef(nil, errValidation, "no series declared in metadata.yaml in %q", pkg.Dir)
 	}
-	rev, err := strconv.Atoi(strings.TrimSpace(string(data)))
-	if err != nil || rev < 0 {
-		return 0, fmt.Errorf("invalid number %q in %s", data, path)
+	for _, s := range allSeries {
+		err := withCharmOutput(s+"/"+filepath.Base(pkg.Dir), func() error {
+			_, err := install(pkgPath, s)
+			return err
+		})
+		if err != nil {
+			if isChecksError(errgo.Cause(err)) {
+				// The checks do not depend on the series.
+				return errgo.Mask(err, isCategorized)
+			}
+			return errgo.NoteMask(err, fmt.Sprintf("cannot build for series %q", s), isCategorized)
+		}
 	}
-	return rev, nil
+	return nil
 }
 
-func writeRevision(charmDir string, rev int) error {
-	return ioutil.WriteFile(revisionPath(charmDir), []byte(strconv.Itoa(rev)), 0666)
+// install builds the charm in the given package for the given
+// series as specified by the command line flags, installs it and
+// returns its URL.
+func install(pkgPath, charmSeries string) (*charm.URL, error) {
+	curl, err := builder.Install(builder.Params{
+		PkgPath:   pkgPath,
+		Repo:      *repo,
+		Series:    charmSeries,
+		OutputDir: *outputDir,
+		Source:    *source,
+		Strip:     *strip,
+		Dispatch:  *dispatch,
+		Compress:  *compress,
+		Debug:     *debug,
+		Docker:    *docker,
+		Cgo:       *cgo,
+		Checksum:  *checksum,
+		SignKey:   *signKey,
+
+		Placeholders: *placeholders,
+		RevisionFrom: *revisionFrom,
+		DryRun:       *dryRun,
+		Strict:       *strict,
+		Fmt:          *checkFmt,
+		Vet:          *vet,
+		Race:         *testRace,
+	})
+	if err != nil {
+		return nil, errgo.Mask(err, isCategorized)
+	}
+	if *dryRun {
+		return curl, nil
+	}
+	if *outputDir != "" {
+		fmt.Println(*outputDir)
+	} else {
+		fmt.Println(curl)
+	}
+	return curl, nil
 }
 
-func revisionPath(charmDir string) string {
-	return filepath.Join(charmDir, "revision")
+// seriesSet reports whether the -series flag
+// was given explicitly.
+func seriesSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "series" {
+			set = true
+		}
+	})
+	return set
 }
 
-func warningf(f string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, "gocharm: warning: %s\n", fmt.Sprintf(f, a...))
+// isChecksError reports whether err is a *builder.ChecksError,
+// returned when a charm fails the checks requested with
+// -fmt, -vet or -race.
+func isChecksError(err error) bool {
+	_, ok := err.(*builder.ChecksError)
+	return ok
 }
 
 func errorf(f string, a ...interface{}) {
 	exitCode = 1
-	fmt.Fprintf(os.Stderr, "gocharm: %s\n", fmt.Sprintf(f, a...))
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	fmt.Fprintf(os.Stderr, "gocharm: %s\n", colorize(colorRed, fmt.Sprintf(f, a...)))
 }
 
 func fatalf(f string, a ...interface{}) {
 	errorf(f, a...)
-	os.Exit(2)
+	os.Exit(exitUsageError)
+}
+
+func runCmd(dir string, env []string, cmd string, args ...string) *exec.Cmd {
+	if *verbose {
+		log.Printf("run %s %s", cmd, strings.Join(args, " "))
+	}
+	c := exec.Command(cmd, args...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = env
+	c.Dir = dir
+	return c
 }
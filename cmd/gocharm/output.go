@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// ANSI escape sequences used to color messages.
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// useColor holds whether warnings and errors are colored.
+// It is set by setupOutput.
+var useColor = false
+
+// outputMu is held while writing a line to the standard output or
+// standard error through a prefixWriter, so that lines from
+// different charms are never interleaved.
+var outputMu sync.Mutex
+
+// setupOutput decides whether to use color, which is disabled by the
+// -no-color flag, by $NO_COLOR being set (see https://no-color.org)
+// and when the standard error is not a terminal, and makes the
+// builder print warnings accordingly.
+func setupOutput() {
+	useColor = !*noColor && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && terminal.IsTerminal(int(os.Stderr.Fd()))
+	builder.Warningf = func(f string, a ...interface{}) {
+		fmt.Fprintf(builder.Stderr, "gocharm: %s %s\n", colorize(colorYellow, "warning:"), fmt.Sprintf(f, a...))
+	}
+}
+
+// colorize returns s in the given color,
+// if color is enabled.
+func colorize(color, s string) string {
+	if !useColor {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// withCharmOutput calls f with all the output of the builder,
+// including the output of the commands it runs and the verbose log,
+// written a line at a time with the given charm label as a prefix,
+// so that the output from building many charms can be told apart.
+func withCharmOutput(label string, f func() error) error {
+	oldStdout, oldStderr := builder.Stdout, builder.Stderr
+	stdout := newPrefixWriter(os.Stdout, label+": ")
+	stderr := newPrefixWriter(os.Stderr, label+": ")
+	builder.Stdout, builder.Stderr = stdout, stderr
+	log.SetOutput(stderr)
+	defer func() {
+		stdout.Flush()
+		stderr.Flush()
+		builder.Stdout, builder.Stderr = oldStdout, oldStderr
+		log.SetOutput(os.Stderr)
+	}()
+	return f()
+}
+
+// prefixWriter is an io.Writer that writes each line written to it
+// to an underlying writer with a prefix, holding outputMu while doing
+// so. Incomplete lines are buffered until they are completed or
+// Flush is called.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		w:      w,
+		prefix: prefix,
+	}
+}
+
+// Write implements io.Writer.Write.
+func (w *prefixWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, data...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i == -1 {
+		return len(data), nil
+	}
+	err := w.writeLines(w.buf[0 : i+1])
+	w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush writes any incomplete line, followed by a newline.
+func (w *prefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeLines(append(w.buf, '\n'))
+	w.buf = w.buf[:0]
+	return err
+}
+
+// writeLines writes the given newline-terminated lines
+// with the prefix.
+func (w *prefixWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) > 0 {
+			out.WriteString(w.prefix)
+			out.Write(line)
+		}
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	_, err := w.w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+type outputSuite struct{}
+
+var _ = gc.Suite(&outputSuite{})
+
+func (*outputSuite) TestPrefixWriter(c *gc.C) {
+	var buf bytes.Buffer
+	w := newPrefixWriter(&buf, "mycharm: ")
+	fmt.Fprint(w, "first line\nsecond ")
+	c.Assert(buf.String(), gc.Equals, "mycharm: first line\n")
+	fmt.Fprint(w, "line\n\nthird\nunfinished")
+	c.Assert(buf.String(), gc.Equals, "mycharm: first line\nmycharm: second line\nmycharm: \nmycharm: third\n")
+	expect := "mycharm: first line\nmycharm: second line\nmycharm: \nmycharm: third\nmycharm: unfinished\n"
+	err := w.Flush()
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.String(), gc.Equals, expect)
+
+	// Flushing again writes nothing.
+	err = w.Flush()
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.String(), gc.Equals, expect)
+}
+
+func (*outputSuite) TestColor(c *gc.C) {
+	oldNoColor, oldWarningf := *noColor, builder.Warningf
+	defer func() {
+		*noColor, builder.Warningf = oldNoColor, oldWarningf
+		setupOutput()
+	}()
+	oldNoColorEnv, hadNoColorEnv := os.LookupEnv("NO_COLOR")
+	defer func() {
+		if hadNoColorEnv {
+			os.Setenv("NO_COLOR", oldNoColorEnv)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}()
+
+	os.Unsetenv("NO_COLOR")
+	useColor = true
+	c.Assert(colorize(colorRed, "oops"), gc.Equals, "\x1b[31moops\x1b[0m")
+
+	// The standard error is not a terminal when testing,
+	// and -no-color and $NO_COLOR both disable color.
+	setupOutput()
+	c.Assert(useColor, gc.Equals, false)
+	c.Assert(colorize(colorRed, "oops"), gc.Equals, "oops")
+	*noColor = true
+	setupOutput()
+	c.Assert(useColor, gc.Equals, false)
+	*noColor = false
+	os.Setenv("NO_COLOR", "1")
+	setupOutput()
+	c.Assert(useColor, gc.Equals, false)
+}
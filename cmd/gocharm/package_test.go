@@ -9,3 +9,7 @@ import (
 func TestPackage(t *testing.T) {
 	gc.TestingT(t)
 }
+
+type suite struct{}
+
+var _ = gc.Suite(suite{})
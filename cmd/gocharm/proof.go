@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// proof checks the charm built from the given package in the charm
+// repository for problems that would cause the charm store to reject
+// it. Problems are printed as they are found; an error is returned
+// if there were any.
+func proof(pkgPath string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return errgo.Notef(err, "cannot get current directory")
+	}
+	pkg, err := build.Default.Import(pkgPath, cwd, build.FindOnly)
+	if err != nil {
+		return errgo.Notef(err, "cannot find %q", pkgPath)
+	}
+	charmSeries, err := builder.InferSeries(pkg.Dir, *series, seriesSet())
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	charmDir := filepath.Join(*repo, charmSeries, path.Base(pkg.Dir))
+	if _, err := os.Stat(charmDir); err != nil {
+		return errgo.Newf("charm not found in %s; run gocharm to build it first", charmDir)
+	}
+	problems := builder.Proof(charmDir)
+	for _, p := range problems {
+		errorf("%s", p)
+	}
+	if len(problems) > 0 {
+		return errgo.WithCausef(nil, errValidation, "%d problem(s) found in %s", len(problems), charmDir)
+	}
+	fmt.Printf("%s: ok\n", charmDir)
+	return nil
+}
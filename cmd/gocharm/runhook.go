@@ -0,0 +1,28 @@
+package main
+
+import (
+	"regexp"
+
+	"gopkg.in/errgo.v1"
+)
+
+// hookNamePattern matches the names of hooks
+// that can be run with run-hook.
+var hookNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// runHook runs the deployed runhook executable for the given hook
+// on the given unit with juju run, so that it runs in a hook context,
+// copying its output to standard output and standard error.
+func runHook(unit, hookName string) error {
+	if !unitPattern.MatchString(unit) {
+		return errgo.Newf("invalid unit name %q", unit)
+	}
+	if !hookNamePattern.MatchString(hookName) {
+		return errgo.Newf("invalid hook name %q", hookName)
+	}
+	// The command runs in the charm directory.
+	if err := runCmd("", nil, "juju", "run", "--unit", unit, "bin/runhook "+hookName).Run(); err != nil {
+		return errgo.Notef(err, "cannot run hook %q on %s", hookName, unit)
+	}
+	return nil
+}
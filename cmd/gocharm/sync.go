@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/juju/utils"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// syncTmpDir holds the directory on the unit that
+// files are copied to before being moved into place.
+const syncTmpDir = "/tmp/gocharm-sync"
+
+// unitPattern matches a unit name. The first submatch
+// holds the service name and the second the unit number.
+var unitPattern = regexp.MustCompile(`^([a-z][a-z0-9-]*)/([0-9]+)$`)
+
+// syncUnit builds the charm in the current directory and copies the
+// files built into its bin directory (see builder.OutputFiles), and
+// any regular hook files, that differ from those deployed directly
+// into the charm directory of the given unit.
+// If *syncHook is set, that hook is then run on the unit.
+func syncUnit(unit string) error {
+	charmDir, err := unitCharmDir(unit)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	curl, err := main1(".")
+	if err != nil {
+		return errgo.Mask(err, isCategorized)
+	}
+	localDir := filepath.Join(*repo, curl.Series, curl.Name)
+	local, err := syncFiles(localDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	remote, err := remoteChecksums(unit, charmDir, local)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	changed := changedFiles(local, remote)
+	if len(changed) == 0 {
+		fmt.Printf("%s is up to date\n", unit)
+	} else {
+		if err := copyToUnit(unit, charmDir, localDir, changed); err != nil {
+			return errgo.Mask(err)
+		}
+		for _, f := range changed {
+			fmt.Printf("%s: updated %s\n", unit, f)
+		}
+	}
+	if *syncHook == "" {
+		return nil
+	}
+	if err := runHook(unit, *syncHook); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// unitCharmDir returns the directory that the charm
+// of the given unit is deployed to.
+func unitCharmDir(unit string) (string, error) {
+	m := unitPattern.FindStringSubmatch(unit)
+	if m == nil {
+		return "", errgo.Newf("invalid unit name %q", unit)
+	}
+	return path.Join("/var/lib/juju/agents", "unit-"+m[1]+"-"+m[2], "charm"), nil
+}
+
+// syncFiles returns the SHA-256 checksum of each file in the built
+// charm in dir that is synced to the unit, keyed by its slash-separated
+// path relative to dir. Symbolic links in the hooks directory (as
+// written with -dispatch) are left out, because they always refer
+// to the runhook executable.
+func syncFiles(dir string) (map[string]string, error) {
+	files, err := builder.OutputFiles(dir)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "hooks"))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			files = append(files, "hooks/"+info.Name())
+		}
+	}
+	sums := make(map[string]string)
+	for _, f := range files {
+		sum, err := fileChecksum(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		sums[f] = sum
+	}
+	return sums, nil
+}
+
+// fileChecksum returns the hex-encoded SHA-256
+// checksum of the given file.
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// remoteChecksums returns the checksums of the given files in the
+// charm directory on the unit, keyed by their path relative to it.
+// Files that do not exist on the unit are omitted.
+func remoteChecksums(unit, charmDir string, files map[string]string) (map[string]string, error) {
+	args := []string{"ssh", unit, "sudo", "sha256sum"}
+	for _, f := range sortedKeys(files) {
+		args = append(args, utils.ShQuote(path.Join(charmDir, f)))
+	}
+	// sha256sum fails if any file is missing, but still
+	// prints the checksums of the others, so we ignore
+	// its exit status.
+	var out bytes.Buffer
+	c := runCmd("", nil, "juju", append(args, "2>/dev/null", "||", "true")...)
+	c.Stdout = &out
+	if err := c.Run(); err != nil {
+		return nil, errgo.Notef(err, "cannot get checksums from %s", unit)
+	}
+	return parseChecksums(&out, charmDir)
+}
+
+// parseChecksums parses the output of sha256sum, returning
+// the checksum of each file under dir keyed by its path
+// relative to dir.
+func parseChecksums(r io.Reader, dir string) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		file := strings.TrimPrefix(fields[1], "*")
+		if !strings.HasPrefix(file, dir+"/") {
+			continue
+		}
+		sums[strings.TrimPrefix(file, dir+"/")] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return sums, nil
+}
+
+// changedFiles returns the files in local whose checksums
+// differ from those in remote, sorted by name.
+func changedFiles(local, remote map[string]string) []string {
+	var changed []string
+	for _, f := range sortedKeys(local) {
+		if remote[f] != local[f] {
+			changed = append(changed, f)
+		}
+	}
+	return changed
+}
+
+// copyToUnit copies the given files from localDir to the
+// charm directory on the unit. The files are copied to a
+// temporary directory first and then installed with sudo,
+// because the charm directory is owned by root. Files keep
+// their directory in the temporary directory, because an
+// executable built from src/cmd may have the same name
+// as a hook.
+func copyToUnit(unit, charmDir, localDir string, files []string) error {
+	var dirs []string
+	byDir := make(map[string][]string)
+	for _, f := range files {
+		dir := path.Dir(f)
+		if byDir[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], f)
+	}
+	mkdirArgs := []string{"ssh", unit, "mkdir", "-p"}
+	for _, dir := range dirs {
+		mkdirArgs = append(mkdirArgs, utils.ShQuote(path.Join(syncTmpDir, dir)))
+	}
+	if err := runCmd("", nil, "juju", mkdirArgs...).Run(); err != nil {
+		return errgo.Notef(err, "cannot create %s on %s", syncTmpDir, unit)
+	}
+	for _, dir := range dirs {
+		args := []string{"scp"}
+		for _, f := range byDir[dir] {
+			args = append(args, filepath.Join(localDir, filepath.FromSlash(f)))
+		}
+		args = append(args, unit+":"+path.Join(syncTmpDir, dir)+"/")
+		if err := runCmd("", nil, "juju", args...).Run(); err != nil {
+			return errgo.Notef(err, "cannot copy files to %s", unit)
+		}
+	}
+	if err := runCmd("", nil, "juju", "ssh", unit, "sudo", "sh", "-c", utils.ShQuote(installScript(charmDir, files))).Run(); err != nil {
+		return errgo.Notef(err, "cannot install files on %s", unit)
+	}
+	return nil
+}
+
+// installScript returns a shell script that moves the given
+// files from syncTmpDir into place in the charm directory.
+// Each file is written under a temporary name and then renamed,
+// so that a hook starting at the same time never runs a
+// partially written executable.
+func installScript(charmDir string, files []string) string {
+	var buf bytes.Buffer
+	buf.WriteString("set -e\n")
+	for _, f := range files {
+		dest := path.Join(charmDir, f)
+		fmt.Fprintf(&buf, "install -m 0755 %s %s\n", utils.ShQuote(path.Join(syncTmpDir, f)), utils.ShQuote(dest+".new"))
+		fmt.Fprintf(&buf, "mv -f %s %s\n", utils.ShQuote(dest+".new"), utils.ShQuote(dest))
+	}
+	fmt.Fprintf(&buf, "rm -rf %s\n", syncTmpDir)
+	return buf.String()
+}
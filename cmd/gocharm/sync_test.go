@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type syncSuite struct{}
+
+var _ = gc.Suite(&syncSuite{})
+
+var unitCharmDirTests = []struct {
+	unit        string
+	expect      string
+	expectError string
+}{{
+	unit:   "foo/0",
+	expect: "/var/lib/juju/agents/unit-foo-0/charm",
+}, {
+	unit:   "my-service/12",
+	expect: "/var/lib/juju/agents/unit-my-service-12/charm",
+}, {
+	unit:        "foo",
+	expectError: `invalid unit name "foo"`,
+}, {
+	unit:        "foo/0; rm -rf /",
+	expectError: `invalid unit name "foo/0; rm -rf /"`,
+}}
+
+func (*syncSuite) TestUnitCharmDir(c *gc.C) {
+	for i, test := range unitCharmDirTests {
+		c.Logf("test %d: %s", i, test.unit)
+		dir, err := unitCharmDir(test.unit)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(dir, gc.Equals, test.expect)
+	}
+}
+
+func (*syncSuite) TestChangedFiles(c *gc.C) {
+	out := `
+aaaa  /var/lib/juju/agents/unit-foo-0/charm/bin/runhook
+bbbb  /var/lib/juju/agents/unit-foo-0/charm/hooks/install
+cccc *other/file
+`
+	remote, err := parseChecksums(strings.NewReader(out), "/var/lib/juju/agents/unit-foo-0/charm")
+	c.Assert(err, gc.IsNil)
+	c.Assert(remote, jc.DeepEquals, map[string]string{
+		"bin/runhook":   "aaaa",
+		"hooks/install": "bbbb",
+	})
+	local := map[string]string{
+		"bin/runhook":          "aaab",
+		"hooks/install":        "bbbb",
+		"hooks/config-changed": "dddd",
+	}
+	c.Assert(changedFiles(local, remote), jc.DeepEquals, []string{
+		"bin/runhook",
+		"hooks/config-changed",
+	})
+}
+
+func (*syncSuite) TestSyncFiles(c *gc.C) {
+	dir := c.MkDir()
+	files := map[string]string{
+		".gocharm/hooks.json":    `{"Hooks": {"install": ""}, "Outputs": ["bin/runhook", "bin/runhook.sha256", "bin/runhook.sha256.asc", "bin/agent"]}`,
+		"bin/runhook":            "runhook",
+		"bin/runhook.sha256":     "sum",
+		"bin/runhook.sha256.asc": "signature",
+		"bin/agent":              "agent",
+		"hooks/install":          "install",
+		"metadata.yaml":          "name: foo",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(path, []byte(content), 0666)
+		c.Assert(err, gc.IsNil)
+	}
+	err := os.Symlink("../bin/runhook", filepath.Join(dir, "hooks", "start"))
+	c.Assert(err, gc.IsNil)
+	sums, err := syncFiles(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(sortedKeys(sums), jc.DeepEquals, []string{
+		"bin/agent",
+		"bin/runhook",
+		"bin/runhook.sha256",
+		"bin/runhook.sha256.asc",
+		"hooks/install",
+	})
+	c.Assert(sums["bin/agent"], gc.Equals, "d4f0bc5a29de06b510f9aa428f1eedba926012b591fef7a518e776a7c9bd1824")
+}
+
+func (*syncSuite) TestInstallScript(c *gc.C) {
+	script := installScript("/var/lib/juju/agents/unit-foo-0/charm", []string{"bin/runhook", "hooks/install"})
+	c.Assert(script, gc.Equals, `set -e
+install -m 0755 '/tmp/gocharm-sync/bin/runhook' '/var/lib/juju/agents/unit-foo-0/charm/bin/runhook.new'
+mv -f '/var/lib/juju/agents/unit-foo-0/charm/bin/runhook.new' '/var/lib/juju/agents/unit-foo-0/charm/bin/runhook'
+install -m 0755 '/tmp/gocharm-sync/hooks/install' '/var/lib/juju/agents/unit-foo-0/charm/hooks/install.new'
+mv -f '/var/lib/juju/agents/unit-foo-0/charm/hooks/install.new' '/var/lib/juju/agents/unit-foo-0/charm/hooks/install'
+rm -rf /tmp/gocharm-sync
+`)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// test runs the tests of the charm in the given package,
+// passing through the -run, -count, -cover, -race and -v flags.
+func test(pkgPath string) error {
+	var args []string
+	if *verbose {
+		args = append(args, "-v")
+	}
+	if *testRun != "" {
+		args = append(args, "-run", *testRun)
+	}
+	if *testCount > 0 {
+		args = append(args, "-count", strconv.Itoa(*testCount))
+	}
+	if *testCover {
+		args = append(args, "-cover")
+	}
+	if *testRace {
+		args = append(args, "-race")
+	}
+	return builder.Test(builder.TestParams{
+		PkgPath:      pkgPath,
+		Args:         args,
+		CoverProfile: *coverProfile,
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// upgradeTimeout holds how long upgrade -w waits for all the units
+// of the service to complete the upgrade-charm hook.
+var upgradeTimeout = 10 * time.Minute
+
+// upgrade builds the charm in the current directory and upgrades
+// the given deployed service to use it. If *watch is set, it shows
+// the debug log for the service until all its units have run the
+// upgrade-charm hook.
+func upgrade(service string) error {
+	curl, err := main1(".")
+	if err != nil {
+		return errgo.Mask(err, isCategorized)
+	}
+	var w *logWatcher
+	if *watch {
+		units, err := serviceUnits(service)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		// Start watching the log before upgrading so that
+		// we can't miss any of the upgrade-charm hook output.
+		w, err = startLogWatcher(service, units)
+		if err != nil {
+			return errgo.Notef(err, "cannot watch debug log")
+		}
+		defer w.kill()
+	}
+	if err := runCmd("", nil, "juju", "upgrade-charm", "--repository", *repo, "--switch", curl.String(), service).Run(); err != nil {
+		return errgo.Notef(err, "cannot upgrade service %q", service)
+	}
+	if w == nil {
+		return nil
+	}
+	if err := w.wait(); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// logWatcher watches the juju debug log for a service,
+// printing all log lines to standard output.
+type logWatcher struct {
+	cmd  *exec.Cmd
+	done chan error
+}
+
+// startLogWatcher starts juju debug-log running for the given units
+// of the given service.
+func startLogWatcher(service string, units []string) (*logWatcher, error) {
+	c := runCmd("", nil, "juju", "debug-log", "--lines", "0", "--include", "unit-"+service+"-*")
+	c.Stdout = nil
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if err := c.Start(); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	w := &logWatcher{
+		cmd:  c,
+		done: make(chan error, 1),
+	}
+	go func() {
+		w.done <- watchUpgrade(stdout, os.Stdout, service, units)
+	}()
+	return w, nil
+}
+
+// wait waits until all the units being watched have completed
+// the upgrade-charm hook, or upgradeTimeout has passed.
+func (w *logWatcher) wait() error {
+	select {
+	case err := <-w.done:
+		return err
+	case <-time.After(upgradeTimeout):
+		return errgo.Newf("timed out after %v waiting for upgrade-charm to complete", upgradeTimeout)
+	}
+}
+
+// kill stops the juju debug-log process.
+func (w *logWatcher) kill() {
+	w.cmd.Process.Kill()
+	w.cmd.Wait()
+}
+
+// upgradeLogPattern matches the log lines produced by hook.Main
+// at the start and end of an upgrade-charm hook. The first
+// submatch holds the unit name and the second is non-empty
+// if it's the start of the hook.
+const upgradeLogPattern = `unit\.(%s/[0-9]+)\.juju-log.*(?:(running hook upgrade-charm \{)|\} upgrade-charm)`
+
+// watchUpgrade copies lines from r to w until each of the given units
+// of the service has been seen starting and then finishing the
+// upgrade-charm hook.
+func watchUpgrade(r io.Reader, w io.Writer, service string, units []string) error {
+	pat := regexp.MustCompile(fmt.Sprintf(upgradeLogPattern, regexp.QuoteMeta(service)))
+	pending := make(map[string]bool)
+	for _, unit := range units {
+		pending[unit] = true
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	running := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintln(w, line)
+		m := pat.FindStringSubmatch(line)
+		if m == nil || !pending[m[1]] {
+			continue
+		}
+		if m[2] != "" {
+			running[m[1]] = true
+			continue
+		}
+		if !running[m[1]] {
+			continue
+		}
+		delete(running, m[1])
+		delete(pending, m[1])
+		if len(pending) == 0 {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errgo.Mask(err)
+	}
+	return errgo.Newf("debug log terminated before upgrade-charm completed on %s", strings.Join(sortedSet(pending), ", "))
+}
+
+// serviceUnits returns the names of the units of the given service,
+// as reported by juju status.
+func serviceUnits(service string) ([]string, error) {
+	c := runCmd("", nil, "juju", "status", "--format", "json", service)
+	c.Stdout = nil
+	out, err := c.Output()
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot get status of service %q", service)
+	}
+	units, err := parseStatusUnits(out, service)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if len(units) == 0 {
+		return nil, errgo.Newf("service %q has no units", service)
+	}
+	return units, nil
+}
+
+// statusUnit holds the parts of a unit's status
+// used by parseStatusUnits.
+type statusUnit struct {
+	Subordinates map[string]statusUnit `json:"subordinates"`
+}
+
+// parseStatusUnits returns the sorted names of the units of the given
+// service in the JSON output of juju status. Services are called
+// applications by later versions of Juju, and the units of a
+// subordinate service are found under those of its principals.
+func parseStatusUnits(data []byte, service string) ([]string, error) {
+	type statusService struct {
+		Units map[string]statusUnit `json:"units"`
+	}
+	var status struct {
+		Services     map[string]statusService `json:"services"`
+		Applications map[string]statusService `json:"applications"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, errgo.Notef(err, "cannot parse juju status output")
+	}
+	found := make(map[string]bool)
+	var add func(units map[string]statusUnit)
+	add = func(units map[string]statusUnit) {
+		for name, u := range units {
+			if strings.HasPrefix(name, service+"/") {
+				found[name] = true
+			}
+			add(u.Subordinates)
+		}
+	}
+	for _, services := range []map[string]statusService{status.Services, status.Applications} {
+		for _, svc := range services {
+			add(svc.Units)
+		}
+	}
+	return sortedSet(found), nil
+}
+
+func sortedSet(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
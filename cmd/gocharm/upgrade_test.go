@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+var watchUpgradeTests = []struct {
+	about       string
+	units       []string
+	log         string
+	expectError string
+	expectLines int
+}{{
+	about: "single unit",
+	units: []string{"foo/0"},
+	log: `unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 running hook config-changed {
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 } config-changed
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 running hook upgrade-charm {
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 } upgrade-charm
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 running hook config-changed {
+`,
+	expectLines: 4,
+}, {
+	about: "several units",
+	units: []string{"foo/0", "foo/1"},
+	log: `unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 running hook upgrade-charm {
+unit-foo-1: 2015-04-01 INFO unit.foo/1.juju-log cmd.go:247 running hook upgrade-charm {
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 } upgrade-charm
+unit-foobar-1: 2015-04-01 INFO unit.foobar/1.juju-log cmd.go:247 } upgrade-charm
+unit-foo-1: 2015-04-01 INFO unit.foo/1.juju-log cmd.go:247 } upgrade-charm
+`,
+	expectLines: 5,
+}, {
+	about: "first unit finishes before the second starts",
+	units: []string{"foo/0", "foo/1"},
+	log: `unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 running hook upgrade-charm {
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 } upgrade-charm
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 running hook config-changed {
+unit-foo-1: 2015-04-01 INFO unit.foo/1.juju-log cmd.go:247 running hook upgrade-charm {
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 } config-changed
+unit-foo-1: 2015-04-01 INFO unit.foo/1.juju-log cmd.go:247 } upgrade-charm
+unit-foo-1: 2015-04-01 INFO unit.foo/1.juju-log cmd.go:247 running hook config-changed {
+`,
+	expectLines: 6,
+}, {
+	about: "second unit never runs upgrade-charm",
+	units: []string{"foo/0", "foo/1"},
+	log: `unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 running hook upgrade-charm {
+unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 } upgrade-charm
+`,
+	expectLines: 2,
+	expectError: "debug log terminated before upgrade-charm completed on foo/1",
+}, {
+	about: "end without start",
+	units: []string{"foo/0"},
+	log: `unit-foo-0: 2015-04-01 INFO unit.foo/0.juju-log cmd.go:247 } upgrade-charm
+`,
+	expectLines: 1,
+	expectError: "debug log terminated before upgrade-charm completed on foo/0",
+}}
+
+func (suite) TestWatchUpgrade(c *gc.C) {
+	for i, test := range watchUpgradeTests {
+		c.Logf("test %d: %s", i, test.about)
+		var out bytes.Buffer
+		err := watchUpgrade(strings.NewReader(test.log), &out, "foo", test.units)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+		} else {
+			c.Assert(err, gc.IsNil)
+		}
+		c.Assert(strings.Count(out.String(), "\n"), gc.Equals, test.expectLines)
+	}
+}
+
+var parseStatusUnitsTests = []struct {
+	about   string
+	service string
+	status  string
+	expect  []string
+}{{
+	about:   "services",
+	service: "foo",
+	status: `{
+	"services": {
+		"foo": {"units": {"foo/1": {}, "foo/0": {}}},
+		"foobar": {"units": {"foobar/0": {}}}
+	}
+}`,
+	expect: []string{"foo/0", "foo/1"},
+}, {
+	about:   "applications",
+	service: "foo",
+	status:  `{"applications": {"foo": {"units": {"foo/3": {}}}}}`,
+	expect:  []string{"foo/3"},
+}, {
+	about:   "subordinate",
+	service: "logger",
+	status: `{
+	"applications": {
+		"foo": {"units": {
+			"foo/0": {"subordinates": {"logger/0": {}}},
+			"foo/1": {"subordinates": {"logger/1": {}}}
+		}},
+		"logger": {}
+	}
+}`,
+	expect: []string{"logger/0", "logger/1"},
+}, {
+	about:   "no units",
+	service: "foo",
+	status:  `{"services": {"foo": {}}}`,
+	expect:  []string{},
+}}
+
+func (suite) TestParseStatusUnits(c *gc.C) {
+	for i, test := range parseStatusUnitsTests {
+		c.Logf("test %d: %s", i, test.about)
+		units, err := parseStatusUnits([]byte(test.status), test.service)
+		c.Assert(err, gc.IsNil)
+		c.Assert(units, jc.DeepEquals, test.expect)
+	}
+	_, err := parseStatusUnits([]byte("not json"), "foo")
+	c.Assert(err, gc.ErrorMatches, `cannot parse juju status output: .*`)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+)
+
+// verify checks the charm in the given package for problems. It
+// runs the charm's RegisterHooks function to find out what it
+// registers, but it does not build the charm binary or write
+// anything to the charm repository. Problems are printed as they are
+// found; an error is returned if there were any.
+func verify(pkgPath string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return errgo.Notef(err, "cannot get current directory")
+	}
+	pkg, err := build.Default.Import(pkgPath, cwd, 0)
+	if err != nil {
+		return errgo.Notef(err, "cannot import %q", pkgPath)
+	}
+	charmSeries, err := builder.InferSeries(pkg.Dir, *series, seriesSet())
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	tempDir, err := ioutil.TempDir("", "gocharm")
+	if err != nil {
+		return errgo.Notef(err, "cannot make temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	info, err := builder.Inspect(pkg, tempDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	// The charm repository is only needed to check for
+	// stale hooks, so we don't insist on it.
+	var charmDir string
+	if *repo != "" {
+		charmDir = filepath.Join(*repo, charmSeries, path.Base(pkg.Dir))
+	}
+	problems := builder.Verify(pkg.Dir, charmSeries, info, charmDir)
+	for _, p := range problems {
+		errorf("%s", p)
+	}
+	if len(problems) > 0 {
+		return errgo.WithCausef(nil, errValidation, "%d problem(s) found in %s", len(problems), pkg.ImportPath)
+	}
+	fmt.Printf("%s: ok\n", pkg.ImportPath)
+	return nil
+}
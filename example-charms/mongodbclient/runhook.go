@@ -13,8 +13,7 @@ import (
 func RegisterHooks(r *hook.Registry) {
 	var c charm
 	r.RegisterContext(c.setContext, nil)
-	c.mongodb.Register(r.Clone("mongodb"), "mongodb")
-	r.RegisterHook("*", c.changed)
+	c.mongodb.Register(r.Clone("mongodb"), "mongodb", c.changed)
 }
 
 type charm struct {
@@ -27,7 +26,11 @@ func (c *charm) setContext(ctxt *hook.Context) error {
 	return nil
 }
 
-func (c *charm) changed() error {
-	c.ctxt.Logf("mongo URL is now %q", c.mongodb.URL())
+func (c *charm) changed(servers *mongodbrelation.Servers) error {
+	if servers == nil {
+		c.ctxt.Logf("no mongo servers available")
+		return nil
+	}
+	c.ctxt.Logf("mongo URL is now %q", servers.URL())
 	return nil
 }
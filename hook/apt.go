@@ -0,0 +1,242 @@
+package hook
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/utils"
+	"gopkg.in/errgo.v1"
+)
+
+// aptGetArgs holds the arguments that make apt-get run
+// non-interactively without prompting about configuration
+// file changes. They are stolen from github.com/juju/utils/apt.
+var aptGetArgs = []string{
+	"--option=Dpkg::Options::=--force-confold",
+	"--option=Dpkg::options::=--force-unsafe-io",
+	"--assume-yes",
+	"--quiet",
+}
+
+// aptEnv holds environment variables set when running
+// apt commands.
+var aptEnv = []string{
+	"DEBIAN_FRONTEND=noninteractive",
+	"LANG=C",
+}
+
+// aptAttempt governs how we retry apt-get commands. They can fail
+// transiently, for example when another process holds the dpkg lock
+// or when a mirror is temporarily unavailable.
+var aptAttempt = utils.AttemptStrategy{
+	Total: 2 * time.Minute,
+	Delay: 10 * time.Second,
+}
+
+// runAptCommand runs the given command and returns its combined
+// output. It is a variable so that it can be replaced for testing.
+var runAptCommand = func(cmd string, args ...string) ([]byte, error) {
+	out, err := runCommand(Command{
+		Path: cmd,
+		Args: args,
+		Env:  append(append([]string{}, aptEnv...), proxySettingsFromEnvironment().Env()...),
+	}, nil)
+	return out.Combined, err
+}
+
+// aptSourcesDir holds the directory holding sources.list and
+// sources.list.d. It is a variable so that it can be changed
+// for testing.
+var aptSourcesDir = "/etc/apt"
+
+var aptState = struct {
+	mu sync.Mutex
+	// installed records packages known to be installed.
+	installed map[string]bool
+	// repositories records repositories known to have been added.
+	repositories map[string]bool
+	// indexStale records whether a repository has been added
+	// since the package index was last updated.
+	indexStale bool
+}{
+	installed:    make(map[string]bool),
+	repositories: make(map[string]bool),
+}
+
+// InstallPackages installs the given packages with apt-get, if they are
+// not already installed. Installation is retried for a while if it
+// fails. Packages found to be installed are remembered, so calling
+// InstallPackages more than once for the same packages is cheap.
+//
+// If a repository has been added with AddRepository since the package
+// index was last updated, UpdateIndex is called first.
+func InstallPackages(packages ...string) error {
+	aptState.mu.Lock()
+	defer aptState.mu.Unlock()
+	var needed []string
+	for _, pkg := range packages {
+		if aptState.installed[pkg] {
+			continue
+		}
+		if isInstalled(pkg) {
+			aptState.installed[pkg] = true
+			continue
+		}
+		needed = append(needed, pkg)
+	}
+	if len(needed) == 0 {
+		return nil
+	}
+	if aptState.indexStale {
+		if err := updateIndex(); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	args := append([]string{}, aptGetArgs...)
+	args = append(args, "install")
+	args = append(args, needed...)
+	if err := runApt("apt-get", args...); err != nil {
+		return errgo.Notef(err, "cannot install %s", strings.Join(needed, ", "))
+	}
+	for _, pkg := range needed {
+		aptState.installed[pkg] = true
+	}
+	return nil
+}
+
+// UpdateIndex updates the apt package index
+// (with apt-get update).
+func UpdateIndex() error {
+	aptState.mu.Lock()
+	defer aptState.mu.Unlock()
+	return updateIndex()
+}
+
+func updateIndex() error {
+	args := append([]string{}, aptGetArgs...)
+	args = append(args, "update")
+	if err := runApt("apt-get", args...); err != nil {
+		return errgo.Notef(err, "cannot update package index")
+	}
+	aptState.indexStale = false
+	return nil
+}
+
+// AddRepository adds the given apt repository (for example
+// "ppa:juju/stable" or "deb http://example.com/ubuntu xenial main")
+// using add-apt-repository. The package index will be updated before
+// the next call to InstallPackages that needs to install anything.
+//
+// It is a no-op if the repository has already been added, either
+// earlier in the same hook or, for PPAs and deb lines, by any
+// earlier hook, as found in the apt sources lists.
+func AddRepository(repo string) error {
+	aptState.mu.Lock()
+	defer aptState.mu.Unlock()
+	if aptState.repositories[repo] {
+		return nil
+	}
+	if !repositoryConfigured(repo) {
+		if err := runApt("add-apt-repository", "--yes", repo); err != nil {
+			return errgo.Notef(err, "cannot add repository %q", repo)
+		}
+		aptState.indexStale = true
+	}
+	aptState.repositories[repo] = true
+	return nil
+}
+
+// repositoryConfigured reports whether the given repository
+// is mentioned in the apt sources lists. Only PPAs and deb lines
+// are recognized; for any other kind of repository it returns false.
+func repositoryConfigured(repo string) bool {
+	var matches func(line string) bool
+	switch {
+	case strings.HasPrefix(repo, "ppa:"):
+		ppa := strings.TrimPrefix(repo, "ppa:")
+		if strings.Count(ppa, "/") != 1 {
+			return false
+		}
+		matches = func(line string) bool {
+			return strings.Contains(line, ".launchpad.net/"+ppa+"/") ||
+				strings.Contains(line, ".launchpadcontent.net/"+ppa+"/")
+		}
+	case strings.HasPrefix(repo, "deb ") || strings.HasPrefix(repo, "deb-src "):
+		fields := strings.Join(strings.Fields(repo), " ")
+		matches = func(line string) bool {
+			return strings.Join(strings.Fields(line), " ") == fields
+		}
+	default:
+		return false
+	}
+	for _, line := range aptSourceLines() {
+		if matches(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// aptSourceLines returns all the lines in the apt sources lists that
+// are not blank or comments. Files that cannot be read are ignored.
+func aptSourceLines() []string {
+	files := []string{filepath.Join(aptSourcesDir, "sources.list")}
+	for _, pattern := range []string{"*.list", "*.sources"} {
+		matches, _ := filepath.Glob(filepath.Join(aptSourcesDir, "sources.list.d", pattern))
+		files = append(files, matches...)
+	}
+	var lines []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// runApt runs the given apt command, retrying on failure.
+func runApt(cmd string, args ...string) error {
+	var err error
+	for a := aptAttempt.Start(); a.Next(); {
+		if _, err = runAptCommand(cmd, args...); err == nil {
+			return nil
+		}
+	}
+	return errgo.Mask(err)
+}
+
+// PackageInstalled reports whether the given package is
+// currently installed.
+func PackageInstalled(pkg string) bool {
+	aptState.mu.Lock()
+	defer aptState.mu.Unlock()
+	if aptState.installed[pkg] {
+		return true
+	}
+	if isInstalled(pkg) {
+		aptState.installed[pkg] = true
+		return true
+	}
+	return false
+}
+
+// isInstalled reports whether the given package is
+// currently installed.
+func isInstalled(pkg string) bool {
+	out, err := runAptCommand("dpkg-query", "--show", "--showformat=${Status}", pkg)
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(out, []byte("install ok installed"))
+}
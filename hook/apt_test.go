@@ -0,0 +1,192 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type aptSuite struct {
+	savedRunAptCommand func(string, ...string) ([]byte, error)
+	savedAptAttempt    utils.AttemptStrategy
+	savedAptSourcesDir string
+	calls              []string
+	installed          map[string]bool
+	failures           int
+}
+
+var _ = gc.Suite(&aptSuite{})
+
+func (s *aptSuite) SetUpTest(c *gc.C) {
+	s.savedRunAptCommand = *hook.RunAptCommand
+	s.savedAptAttempt = *hook.AptAttempt
+	*hook.RunAptCommand = s.runAptCommand
+	*hook.AptAttempt = utils.AttemptStrategy{Min: 3}
+	s.savedAptSourcesDir = *hook.AptSourcesDir
+	*hook.AptSourcesDir = c.MkDir()
+	hook.ResetAptState()
+	s.calls = nil
+	s.installed = make(map[string]bool)
+	s.failures = 0
+}
+
+func (s *aptSuite) TearDownTest(c *gc.C) {
+	*hook.RunAptCommand = s.savedRunAptCommand
+	*hook.AptAttempt = s.savedAptAttempt
+	*hook.AptSourcesDir = s.savedAptSourcesDir
+	hook.ResetAptState()
+}
+
+func (s *aptSuite) runAptCommand(cmd string, args ...string) ([]byte, error) {
+	if cmd == "dpkg-query" {
+		pkg := args[len(args)-1]
+		if s.installed[pkg] {
+			return []byte("install ok installed"), nil
+		}
+		return nil, errgo.New("not installed")
+	}
+	// Omit the standard apt-get flags for brevity.
+	var shortArgs []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--option") && arg != "--assume-yes" && arg != "--quiet" {
+			shortArgs = append(shortArgs, arg)
+		}
+	}
+	s.calls = append(s.calls, cmd+" "+strings.Join(shortArgs, " "))
+	if s.failures > 0 {
+		s.failures--
+		return nil, errgo.New("transient failure")
+	}
+	if cmd == "apt-get" && len(shortArgs) > 0 && shortArgs[0] == "install" {
+		for _, pkg := range shortArgs[1:] {
+			s.installed[pkg] = true
+		}
+	}
+	return nil, nil
+}
+
+func (s *aptSuite) TestInstallPackages(c *gc.C) {
+	s.installed["git"] = true
+	err := hook.InstallPackages("git", "mercurial", "bzr")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"apt-get install mercurial bzr",
+	})
+
+	// Installing again does nothing.
+	s.calls = nil
+	err = hook.InstallPackages("bzr", "git")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+}
+
+func (s *aptSuite) TestPackageInstalled(c *gc.C) {
+	s.installed["git"] = true
+	c.Assert(hook.PackageInstalled("git"), gc.Equals, true)
+	c.Assert(hook.PackageInstalled("bzr"), gc.Equals, false)
+	err := hook.InstallPackages("bzr")
+	c.Assert(err, gc.IsNil)
+	c.Assert(hook.PackageInstalled("bzr"), gc.Equals, true)
+}
+
+func (s *aptSuite) TestInstallPackagesRetries(c *gc.C) {
+	s.failures = 2
+	err := hook.InstallPackages("git")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"apt-get install git",
+		"apt-get install git",
+		"apt-get install git",
+	})
+}
+
+func (s *aptSuite) TestInstallPackagesFails(c *gc.C) {
+	s.failures = 3
+	err := hook.InstallPackages("git")
+	c.Assert(err, gc.ErrorMatches, `cannot install git: transient failure`)
+}
+
+func (s *aptSuite) TestAddRepository(c *gc.C) {
+	err := hook.AddRepository("ppa:foo/bar")
+	c.Assert(err, gc.IsNil)
+	err = hook.InstallPackages("foo")
+	c.Assert(err, gc.IsNil)
+	err = hook.InstallPackages("bar")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"add-apt-repository --yes ppa:foo/bar",
+		"apt-get update",
+		"apt-get install foo",
+		"apt-get install bar",
+	})
+}
+
+func (s *aptSuite) TestAddRepositoryTwice(c *gc.C) {
+	err := hook.AddRepository("ppa:foo/bar")
+	c.Assert(err, gc.IsNil)
+	err = hook.InstallPackages("foo")
+	c.Assert(err, gc.IsNil)
+	err = hook.AddRepository("ppa:foo/bar")
+	c.Assert(err, gc.IsNil)
+	err = hook.InstallPackages("bar")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"add-apt-repository --yes ppa:foo/bar",
+		"apt-get update",
+		"apt-get install foo",
+		"apt-get install bar",
+	})
+}
+
+func (s *aptSuite) TestAddRepositoryAlreadyConfigured(c *gc.C) {
+	dir := filepath.Join(*hook.AptSourcesDir, "sources.list.d")
+	err := os.MkdirAll(dir, 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "foo-ubuntu-bar-xenial.list"), []byte(`
+deb http://ppa.launchpad.net/foo/bar/ubuntu xenial main
+# deb-src http://ppa.launchpad.net/foo/bar/ubuntu xenial main
+`), 0644)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(*hook.AptSourcesDir, "sources.list"), []byte(`
+deb  [arch=amd64]  http://example.com/ubuntu xenial main
+# deb http://example.com/ubuntu xenial universe
+`), 0644)
+	c.Assert(err, gc.IsNil)
+
+	for _, repo := range []string{
+		"ppa:foo/bar",
+		"deb [arch=amd64] http://example.com/ubuntu xenial main",
+	} {
+		err := hook.AddRepository(repo)
+		c.Assert(err, gc.IsNil)
+	}
+	err = hook.InstallPackages("foo")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"apt-get install foo",
+	})
+
+	// Commented out entries and other PPAs must still be added.
+	s.calls = nil
+	for _, repo := range []string{
+		"deb http://example.com/ubuntu xenial universe",
+		"ppa:foo/bar-dev",
+		"cloud-archive:queens",
+	} {
+		err := hook.AddRepository(repo)
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"add-apt-repository --yes deb http://example.com/ubuntu xenial universe",
+		"add-apt-repository --yes ppa:foo/bar-dev",
+		"add-apt-repository --yes cloud-archive:queens",
+	})
+}
@@ -0,0 +1,120 @@
+package hook
+
+import (
+	"encoding/json"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+)
+
+// Batch allows a sequence of operations on a Context to be made
+// with as few hook tool invocations as possible. Each hook tool
+// invocation is a separate round trip to the Juju agent, so hooks
+// that read many configuration options or set many relation
+// settings can be made considerably faster by using a Batch.
+//
+// Configuration is read with a single config-get call the first
+// time it is needed. Relation settings are accumulated and sent with
+// a single relation-set call for each relation when Flush is called.
+//
+// A Batch should not be used concurrently.
+type Batch struct {
+	ctxt *Context
+
+	// config holds all the configuration values,
+	// or nil if they have not been read yet.
+	config map[string]json.RawMessage
+
+	// settings holds the pending relation settings
+	// for each relation.
+	settings map[RelationId]map[string]string
+}
+
+// Batch returns a new Batch that operates on ctxt.
+// Any relation settings made through the batch take
+// effect only when Flush is called.
+func (ctxt *Context) Batch() *Batch {
+	return &Batch{
+		ctxt:     ctxt,
+		settings: make(map[RelationId]map[string]string),
+	}
+}
+
+// GetConfig is like Context.GetConfig except that all configuration
+// values are read with a single config-get call the first time it is
+// called, and subsequent calls are satisfied from those values.
+func (b *Batch) GetConfig(key string, val interface{}) error {
+	if b.config == nil {
+		config := make(map[string]json.RawMessage)
+		if err := b.ctxt.GetAllConfig(&config); err != nil {
+			return errgo.Notef(err, "cannot get configuration")
+		}
+		b.config = config
+	}
+	data, ok := b.config[key]
+	if !ok {
+		// Mirror config-get, which prints null
+		// for an unset key.
+		return nil
+	}
+	if err := json.Unmarshal(data, val); err != nil {
+		return errgo.Notef(err, "cannot unmarshal configuration option %q", key)
+	}
+	return nil
+}
+
+// SetRelation is like Context.SetRelation except that the settings
+// are not made until Flush is called.
+func (b *Batch) SetRelation(keyvals ...string) error {
+	return errgo.Mask(b.SetRelationWithId(b.ctxt.RelationId, keyvals...))
+}
+
+// SetRelationWithId is like Context.SetRelationWithId except that
+// the settings are not made until Flush is called. If a key is set
+// more than once, the last value set is used.
+func (b *Batch) SetRelationWithId(relationId RelationId, keyvals ...string) error {
+	if len(keyvals)%2 != 0 {
+		return errgo.Newf("invalid key/value count")
+	}
+	if len(keyvals) == 0 {
+		return nil
+	}
+	settings := b.settings[relationId]
+	if settings == nil {
+		settings = make(map[string]string)
+		b.settings[relationId] = settings
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		settings[keyvals[i]] = keyvals[i+1]
+	}
+	return nil
+}
+
+// Flush makes all the pending relation settings, using a single
+// relation-set call for each relation, in order of relation id.
+// Settings for any relation that could not be set remain pending
+// and will be tried again on the next call to Flush.
+func (b *Batch) Flush() error {
+	ids := make([]string, 0, len(b.settings))
+	for id := range b.settings {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		settings := b.settings[RelationId(id)]
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		keyvals := make([]string, 0, 2*len(keys))
+		for _, key := range keys {
+			keyvals = append(keyvals, key, settings[key])
+		}
+		if err := b.ctxt.SetRelationWithId(RelationId(id), keyvals...); err != nil {
+			return errgo.Notef(err, "cannot set relation settings on %s", id)
+		}
+		delete(b.settings, RelationId(id))
+	}
+	return nil
+}
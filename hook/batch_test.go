@@ -0,0 +1,88 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type batchSuite struct{}
+
+var _ = gc.Suite(&batchSuite{})
+
+func (s *batchSuite) TestGetConfig(c *gc.C) {
+	runner := &recordingRunner{
+		output: map[string]string{
+			"config-get": `{"name": "foo", "port": 8080}`,
+		},
+	}
+	ctxt := &hook.Context{
+		Runner: runner,
+	}
+	b := ctxt.Batch()
+	var name string
+	err := b.GetConfig("name", &name)
+	c.Assert(err, gc.IsNil)
+	c.Assert(name, gc.Equals, "foo")
+	var port int
+	err = b.GetConfig("port", &port)
+	c.Assert(err, gc.IsNil)
+	c.Assert(port, gc.Equals, 8080)
+	var missing *string
+	err = b.GetConfig("missing", &missing)
+	c.Assert(err, gc.IsNil)
+	c.Assert(missing, gc.IsNil)
+	err = b.GetConfig("name", &port)
+	c.Assert(err, gc.ErrorMatches, `cannot unmarshal configuration option "name": .*`)
+
+	c.Assert(runner.record, jc.DeepEquals, [][]string{
+		{"config-get", "--format", "json"},
+	})
+}
+
+func (s *batchSuite) TestFlush(c *gc.C) {
+	runner := &recordingRunner{}
+	ctxt := &hook.Context{
+		Runner:     runner,
+		RelationId: "db:1",
+	}
+	b := ctxt.Batch()
+	err := b.SetRelation("a", "1", "b", "2")
+	c.Assert(err, gc.IsNil)
+	err = b.SetRelation("a", "3")
+	c.Assert(err, gc.IsNil)
+	err = b.SetRelationWithId("db:0", "c", "")
+	c.Assert(err, gc.IsNil)
+	err = b.SetRelation("odd")
+	c.Assert(err, gc.ErrorMatches, `invalid key/value count`)
+	c.Assert(runner.record, gc.HasLen, 0)
+
+	err = b.Flush()
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.record, jc.DeepEquals, [][]string{
+		{"relation-set", "-r", "db:0", "--", "c="},
+		{"relation-set", "-r", "db:1", "--", "a=3", "b=2"},
+	})
+
+	// Nothing is pending after a successful flush.
+	runner.record = nil
+	err = b.Flush()
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.record, gc.HasLen, 0)
+
+	// Settings remain pending after a failure.
+	err = b.SetRelation("x", "y")
+	c.Assert(err, gc.IsNil)
+	runner.err = errgo.New("oops")
+	err = b.Flush()
+	c.Assert(err, gc.ErrorMatches, `cannot set relation settings on db:1: oops`)
+	runner.err = nil
+	runner.record = nil
+	err = b.Flush()
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.record, jc.DeepEquals, [][]string{
+		{"relation-set", "-r", "db:1", "--", "x=y"},
+	})
+}
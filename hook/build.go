@@ -0,0 +1,86 @@
+package hook
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// These variables are set by gocharm, using the linker's -X flag,
+// when it builds the runhook executable.
+var (
+	buildCharmName string
+	buildRevision  string
+	buildTime      string
+	buildCommit    string
+	buildSeries    string
+)
+
+// Build holds information about the build of the
+// running charm executable.
+type Build struct {
+	// CharmName holds the name of the charm.
+	CharmName string
+
+	// Revision holds the revision of the charm,
+	// or -1 if it is not known.
+	Revision int
+
+	// Time holds the time that the charm was built,
+	// or the zero time if it is not known.
+	Time time.Time
+
+	// Commit holds the version control commit that
+	// the charm was built from, if known. If the charm
+	// source had uncommitted changes, the commit
+	// has a "+" suffix.
+	Commit string
+
+	// Series holds the series that the charm was built
+	// for, if known. A charm built with its source
+	// included does not know its series.
+	Series string
+}
+
+// BuildInfo returns information about the build of the
+// running charm executable, as recorded by gocharm.
+// The generated runhook executable prints it when
+// run as "runhook version".
+func BuildInfo() Build {
+	b := newBuild(buildCharmName, buildRevision, buildTime, buildCommit)
+	b.Series = buildSeries
+	return b
+}
+
+func newBuild(charmName, revision, buildTime, commit string) Build {
+	b := Build{
+		CharmName: charmName,
+		Revision:  -1,
+		Commit:    commit,
+	}
+	if rev, err := strconv.Atoi(revision); err == nil && rev >= 0 {
+		b.Revision = rev
+	}
+	if t, err := time.Parse(time.RFC3339, buildTime); err == nil {
+		b.Time = t
+	}
+	return b
+}
+
+// String returns a one-line description of the build.
+func (b Build) String() string {
+	name, rev, t, commit := b.CharmName, "unknown", "unknown", b.Commit
+	if name == "" {
+		name = "unknown"
+	}
+	if b.Revision >= 0 {
+		rev = strconv.Itoa(b.Revision)
+	}
+	if !b.Time.IsZero() {
+		t = b.Time.UTC().Format(time.RFC3339)
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	return fmt.Sprintf("charm %s revision %s built %s from commit %s", name, rev, t, commit)
+}
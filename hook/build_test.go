@@ -0,0 +1,61 @@
+package hook_test
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type buildSuite struct{}
+
+var _ = gc.Suite(&buildSuite{})
+
+var newBuildTests = []struct {
+	about        string
+	name         string
+	revision     string
+	time         string
+	commit       string
+	expect       hook.Build
+	expectString string
+}{{
+	about:        "nothing recorded",
+	expect:       hook.Build{Revision: -1},
+	expectString: "charm unknown revision unknown built unknown from commit unknown",
+}, {
+	about:    "everything recorded",
+	name:     "mycharm",
+	revision: "12",
+	time:     "2015-06-01T10:20:30Z",
+	commit:   "0123456789abcdef+",
+	expect: hook.Build{
+		CharmName: "mycharm",
+		Revision:  12,
+		Time:      time.Date(2015, 6, 1, 10, 20, 30, 0, time.UTC),
+		Commit:    "0123456789abcdef+",
+	},
+	expectString: "charm mycharm revision 12 built 2015-06-01T10:20:30Z from commit 0123456789abcdef+",
+}, {
+	about:        "invalid revision and time",
+	name:         "mycharm",
+	revision:     "-3",
+	time:         "yesterday",
+	expect:       hook.Build{CharmName: "mycharm", Revision: -1},
+	expectString: "charm mycharm revision unknown built unknown from commit unknown",
+}}
+
+func (*buildSuite) TestNewBuild(c *gc.C) {
+	for i, test := range newBuildTests {
+		c.Logf("test %d: %s", i, test.about)
+		b := hook.NewBuild(test.name, test.revision, test.time, test.commit)
+		c.Assert(b, jc.DeepEquals, test.expect)
+		c.Assert(b.String(), gc.Equals, test.expectString)
+	}
+}
+
+func (*buildSuite) TestBuildInfoNotStamped(c *gc.C) {
+	c.Assert(hook.BuildInfo(), jc.DeepEquals, hook.Build{Revision: -1})
+}
@@ -0,0 +1,84 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type cacheSuite struct{}
+
+var _ = gc.Suite(&cacheSuite{})
+
+func (s *cacheSuite) TestConfigCached(c *gc.C) {
+	runner := &recordingRunner{
+		output: map[string]string{
+			"config-get": `"foo"`,
+		},
+	}
+	ctxt := &hook.Context{
+		Runner: runner,
+	}
+	for i := 0; i < 3; i++ {
+		val, err := ctxt.GetConfigString("name")
+		c.Assert(err, gc.IsNil)
+		c.Assert(val, gc.Equals, "foo")
+	}
+	c.Assert(runner.record, jc.DeepEquals, [][]string{
+		{"config-get", "--format", "json", "--", "name"},
+	})
+
+	// Different keys are cached separately.
+	_, err := ctxt.GetConfigString("other")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.record, gc.HasLen, 2)
+
+	// After invalidation, the hook tool is called again.
+	runner.output["config-get"] = `"bar"`
+	ctxt.Invalidate()
+	val, err := ctxt.GetConfigString("name")
+	c.Assert(err, gc.IsNil)
+	c.Assert(val, gc.Equals, "bar")
+	c.Assert(runner.record, gc.HasLen, 3)
+}
+
+func (s *cacheSuite) TestErrorsNotCached(c *gc.C) {
+	runner := &recordingRunner{
+		output: map[string]string{
+			"config-get": `"foo"`,
+		},
+		err: errgo.New("oops"),
+	}
+	ctxt := &hook.Context{
+		Runner: runner,
+	}
+	_, err := ctxt.GetConfigString("name")
+	c.Assert(err, gc.ErrorMatches, `cannot get configuration option "name": oops`)
+	runner.err = nil
+	val, err := ctxt.GetConfigString("name")
+	c.Assert(err, gc.IsNil)
+	c.Assert(val, gc.Equals, "foo")
+	c.Assert(runner.record, gc.HasLen, 2)
+}
+
+func (s *cacheSuite) TestCachedValuesNotShared(c *gc.C) {
+	runner := &recordingRunner{
+		output: map[string]string{
+			"config-get": `{"a": 1}`,
+		},
+	}
+	ctxt := &hook.Context{
+		Runner: runner,
+	}
+	var m map[string]interface{}
+	err := ctxt.GetAllConfig(&m)
+	c.Assert(err, gc.IsNil)
+	m["a"] = 2.0
+	var m1 map[string]interface{}
+	err = ctxt.GetAllConfig(&m1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m1, jc.DeepEquals, map[string]interface{}{"a": 1.0})
+	c.Assert(runner.record, gc.HasLen, 1)
+}
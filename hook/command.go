@@ -0,0 +1,180 @@
+package hook
+
+import (
+	"bytes"
+	"io"
+	"os"
+	osexec "os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// ErrCommandTimeout is returned as the cause of the error from
+// Context.Run when a command is killed because its timeout or the
+// hook's deadline has passed.
+var ErrCommandTimeout = errgo.New("command timed out")
+
+// killWait holds how long runCommand waits, after killing a command,
+// for its output to be closed. A process that has left the command's
+// process group could otherwise hold the output open indefinitely.
+var killWait = time.Second
+
+// Command holds a command to be run with Context.Run.
+// The command is always run directly, never through
+// a shell, so its arguments need no quoting.
+type Command struct {
+	// Path holds the name of the program to run. If it
+	// contains no slash, it is searched for in $PATH.
+	Path string
+
+	// Args holds the arguments to the program,
+	// not including the program name itself.
+	Args []string
+
+	// Dir holds the working directory of the command.
+	// If it is empty, the command runs in the hook's
+	// current directory.
+	Dir string
+
+	// Env holds environment variables, in the form
+	// "key=value", to set when running the command. They
+	// are added to the hook's environment, with values
+	// here taking precedence, unless ClearEnv is true.
+	Env []string
+
+	// ClearEnv specifies that the command should be run
+	// with only the variables in Env, rather than
+	// inheriting the hook's environment.
+	ClearEnv bool
+
+	// Stdin holds the standard input of the command.
+	// If it is nil, the command reads from the null device.
+	Stdin io.Reader
+
+	// Timeout holds the longest that the command may run
+	// for before it is killed, along with any processes that
+	// it has started. If it is zero, there is no limit other
+	// than the hook's deadline, if any.
+	Timeout time.Duration
+}
+
+// CommandOutput holds the output of a command run
+// with Context.Run.
+type CommandOutput struct {
+	// Stdout and Stderr hold the command's
+	// standard output and standard error.
+	Stdout []byte
+	Stderr []byte
+
+	// Combined holds both the standard output and the
+	// standard error, interleaved roughly in the order
+	// that they were written. Output written to the two
+	// at almost the same time may appear in either order.
+	Combined []byte
+}
+
+// Run runs the given command, logging its command line at DEBUG
+// level, and returns its output. If the command fails, the returned
+// error includes its combined output and the output is returned too.
+// If the command is killed because its timeout or the hook's deadline
+// (see Context.Done) passes, the error will have an ErrCommandTimeout
+// cause.
+func (ctxt *Context) Run(cmd Command) (*CommandOutput, error) {
+	ctxt.Debugf("running %q", append([]string{cmd.Path}, cmd.Args...))
+	out, err := runCommand(cmd, ctxt.Done())
+	if err != nil {
+		return out, errgo.Mask(err, errgo.Is(ErrCommandTimeout))
+	}
+	return out, nil
+}
+
+// runCommand runs the given command. If done is closed before
+// the command completes, the command is killed.
+func runCommand(cmd Command, done <-chan struct{}) (*CommandOutput, error) {
+	c := osexec.Command(cmd.Path, cmd.Args...)
+	c.Dir = cmd.Dir
+	c.Stdin = cmd.Stdin
+	// Run the command in its own process group so that
+	// any processes it starts are killed with it.
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if cmd.ClearEnv {
+		c.Env = append([]string{}, cmd.Env...)
+	} else if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	// The buffers are locked because the output may still be
+	// being copied when a killed command is abandoned.
+	stdout, stderr, combined := &lockedBuffer{}, &lockedBuffer{}, &lockedBuffer{}
+	c.Stdout = io.MultiWriter(stdout, combined)
+	c.Stderr = io.MultiWriter(stderr, combined)
+	output := func() *CommandOutput {
+		return &CommandOutput{
+			Stdout:   stdout.Bytes(),
+			Stderr:   stderr.Bytes(),
+			Combined: combined.Bytes(),
+		}
+	}
+	if err := c.Start(); err != nil {
+		return output(), errgo.Newf("%s failed: %v", cmd.Path, err)
+	}
+	var timeout <-chan time.Time
+	if cmd.Timeout > 0 {
+		timer := time.NewTimer(cmd.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	waitc := make(chan error, 1)
+	go func() {
+		waitc <- c.Wait()
+	}()
+	var err error
+	select {
+	case err = <-waitc:
+	case <-timeout:
+		kill(c, waitc)
+		return output(), errgo.WithCausef(nil, ErrCommandTimeout, "%s timed out after %v (output %q)", cmd.Path, cmd.Timeout, bytes.TrimSpace(combined.Bytes()))
+	case <-done:
+		kill(c, waitc)
+		return output(), errgo.WithCausef(nil, ErrCommandTimeout, "%s killed at hook deadline (output %q)", cmd.Path, bytes.TrimSpace(combined.Bytes()))
+	}
+	if err != nil {
+		return output(), errgo.Newf("%s failed: %v (output %q)", cmd.Path, err, bytes.TrimSpace(combined.Bytes()))
+	}
+	return output(), nil
+}
+
+// kill kills the process group of the started command c and waits for
+// the result of c.Wait to be sent on waitc, for at most killWait.
+func kill(c *osexec.Cmd, waitc <-chan error) {
+	if err := syscall.Kill(-c.Process.Pid, syscall.SIGKILL); err != nil {
+		c.Process.Kill()
+	}
+	select {
+	case <-waitc:
+	case <-time.After(killWait):
+	}
+}
+
+// lockedBuffer is a buffer that can be written to and read
+// concurrently, used to hold the output of a command and to
+// interleave its standard output and standard error.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(data)
+}
+
+// Bytes returns a copy of the contents of the buffer.
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
@@ -0,0 +1,129 @@
+package hook_test
+
+import (
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type commandSuite struct{}
+
+var _ = gc.Suite(&commandSuite{})
+
+func (*commandSuite) TestRunOutput(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	out, err := t.Run(hook.Command{
+		Path: "sh",
+		Args: []string{"-c", "echo out; echo err >&2; echo more", "arg with spaces"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out.Stdout), gc.Equals, "out\nmore\n")
+	c.Assert(string(out.Stderr), gc.Equals, "err\n")
+	// The relative order of standard output and standard
+	// error in the combined output is not deterministic.
+	lines := strings.Split(strings.TrimSuffix(string(out.Combined), "\n"), "\n")
+	sort.Strings(lines)
+	c.Assert(lines, jc.DeepEquals, []string{"err", "more", "out"})
+	c.Assert(t.Logs, jc.DeepEquals, []string{
+		`DEBUG: running ["sh" "-c" "echo out; echo err >&2; echo more" "arg with spaces"]`,
+	})
+}
+
+func (*commandSuite) TestRunFailure(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	out, err := t.Run(hook.Command{
+		Path: "sh",
+		Args: []string{"-c", "echo oops >&2; exit 3"},
+	})
+	c.Assert(err, gc.ErrorMatches, `sh failed: exit status 3 \(output "oops"\)`)
+	c.Assert(string(out.Stderr), gc.Equals, "oops\n")
+}
+
+func (*commandSuite) TestRunNotFound(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	_, err := t.Run(hook.Command{
+		Path: "/nonexistent/command",
+	})
+	c.Assert(err, gc.ErrorMatches, `/nonexistent/command failed: .*no such file or directory`)
+}
+
+func (*commandSuite) TestRunEnvDirStdin(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	dir := c.MkDir()
+	out, err := t.Run(hook.Command{
+		Path:  "sh",
+		Args:  []string{"-c", `echo "$FOO"; pwd; cat`},
+		Env:   []string{"FOO=bar"},
+		Dir:   dir,
+		Stdin: strings.NewReader("input\n"),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out.Stdout), gc.Equals, "bar\n"+dir+"\ninput\n")
+}
+
+func (*commandSuite) TestRunClearEnv(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	out, err := t.Run(hook.Command{
+		Path:     "/usr/bin/env",
+		Env:      []string{"FOO=bar"},
+		ClearEnv: true,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out.Stdout), gc.Equals, "FOO=bar\n")
+}
+
+func (*commandSuite) TestRunTimeout(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	start := time.Now()
+	_, err := t.Run(hook.Command{
+		Path:    "sleep",
+		Args:    []string{"10"},
+		Timeout: 50 * time.Millisecond,
+	})
+	c.Assert(err, gc.ErrorMatches, `sleep timed out after 50ms \(output ""\)`)
+	c.Assert(errgo.Cause(err), gc.Equals, hook.ErrCommandTimeout)
+	c.Assert(time.Since(start) < 5*time.Second, gc.Equals, true)
+}
+
+func (*commandSuite) TestRunTimeoutKillsChildren(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	start := time.Now()
+	out, err := t.Run(hook.Command{
+		Path:    "sh",
+		Args:    []string{"-c", "echo started; sleep 10; echo finished"},
+		Timeout: 100 * time.Millisecond,
+	})
+	c.Assert(err, gc.ErrorMatches, `sh timed out after 100ms \(output "started"\)`)
+	c.Assert(errgo.Cause(err), gc.Equals, hook.ErrCommandTimeout)
+	c.Assert(string(out.Stdout), gc.Equals, "started\n")
+	c.Assert(time.Since(start) < 2*time.Second, gc.Equals, true, gc.Commentf("took %v", time.Since(start)))
+}
+
+func (*commandSuite) TestRunTimeoutEscapedProcess(c *gc.C) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		c.Skip("setsid not found")
+	}
+	// A process that leaves the process group keeps the
+	// output open, but Run does not wait for it for long.
+	oldKillWait := *hook.KillWait
+	defer func() {
+		*hook.KillWait = oldKillWait
+	}()
+	*hook.KillWait = 100 * time.Millisecond
+	t := hook.NewTestContext(hook.TestContextParams{})
+	start := time.Now()
+	_, err := t.Run(hook.Command{
+		Path:    "sh",
+		Args:    []string{"-c", "setsid sleep 3"},
+		Timeout: 100 * time.Millisecond,
+	})
+	c.Assert(errgo.Cause(err), gc.Equals, hook.ErrCommandTimeout)
+	c.Assert(time.Since(start) < 2*time.Second, gc.Equals, true, gc.Commentf("took %v", time.Since(start)))
+}
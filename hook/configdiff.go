@@ -0,0 +1,85 @@
+package hook
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+)
+
+// configStateKey holds the persistent state key used to record
+// the configuration seen by the last successful config-changed hook.
+const configStateKey = "gocharm:config"
+
+// PreviousConfig returns the charm configuration values as they were
+// when the config-changed hook last completed successfully, or nil
+// if it has never done so. The returned map should not be changed.
+//
+// The configuration is recorded whenever config-changed succeeds,
+// whether or not the hook itself read it.
+func (ctxt *Context) PreviousConfig() map[string]interface{} {
+	return ctxt.prevConfig
+}
+
+// ChangedKeys returns the names of the configuration options whose
+// values are different from those returned by PreviousConfig, in
+// alphabetical order, including options that have been set or unset
+// since then. This lets a config-changed hook do only the work needed
+// for the options that have actually changed. If config-changed has
+// never completed successfully, all the options that have values are
+// returned.
+func (ctxt *Context) ChangedKeys() ([]string, error) {
+	var current map[string]interface{}
+	if err := ctxt.GetAllConfig(&current); err != nil {
+		return nil, errgo.Notef(err, "cannot get configuration")
+	}
+	var changed []string
+	for key, val := range current {
+		if old, ok := ctxt.prevConfig[key]; !ok || !reflect.DeepEqual(old, val) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range ctxt.prevConfig {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// loadConfig records the configuration saved by saveConfig
+// in ctxt.prevConfig.
+func loadConfig(ctxt *Context, state PersistentState) error {
+	data, err := state.Load(configStateKey)
+	if err != nil || data == nil {
+		return errgo.Mask(err)
+	}
+	if err := json.Unmarshal(data, &ctxt.prevConfig); err != nil {
+		return errgo.Notef(err, "cannot unmarshal previous configuration")
+	}
+	return nil
+}
+
+// saveConfig records the current configuration in the given state.
+// The configuration as read during the hook is used if there is one,
+// so that exactly what the hook saw is recorded.
+func saveConfig(ctxt *Context, state PersistentState) error {
+	data, ok := ctxt.cachedOutput("config-get", "--format", "json")
+	if !ok {
+		var config map[string]interface{}
+		if err := ctxt.GetAllConfig(&config); err != nil {
+			return errgo.Notef(err, "cannot get configuration")
+		}
+		var err error
+		data, err = json.Marshal(config)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := state.Save(configStateKey, data); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type configDiffSuite struct{}
+
+var _ = gc.Suite(&configDiffSuite{})
+
+func (s *configDiffSuite) TestChangedKeys(c *gc.C) {
+	var (
+		changed  []string
+		previous map[string]interface{}
+		fail     bool
+	)
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			var ctxt *hook.Context
+			r.RegisterContext(func(c *hook.Context) error {
+				ctxt = c
+				return nil
+			}, nil)
+			r.RegisterHook("config-changed", func() error {
+				previous = ctxt.PreviousConfig()
+				var err error
+				changed, err = ctxt.ChangedKeys()
+				if err != nil {
+					return err
+				}
+				if fail {
+					return errgo.New("failed")
+				}
+				return nil
+			})
+		},
+		Config: map[string]interface{}{
+			"name": "foo",
+			"port": 80,
+		},
+		Logger: c,
+	}
+
+	// Initially everything has changed.
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(previous, gc.IsNil)
+	c.Assert(changed, jc.DeepEquals, []string{"name", "port"})
+
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(changed, gc.HasLen, 0)
+	c.Assert(previous, jc.DeepEquals, map[string]interface{}{
+		"name": "foo",
+		"port": 80.0,
+	})
+
+	runner.Config = map[string]interface{}{
+		"port":  8080,
+		"title": "x",
+	}
+	fail = true
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.ErrorMatches, `.*failed`)
+	c.Assert(changed, jc.DeepEquals, []string{"name", "port", "title"})
+
+	// The failed hook did not record the configuration,
+	// so the changes are seen again when it is retried.
+	fail = false
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(changed, jc.DeepEquals, []string{"name", "port", "title"})
+
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(changed, gc.HasLen, 0)
+}
+
+func (s *configDiffSuite) TestConfigSavedWhenNotRead(c *gc.C) {
+	var (
+		ctxt     *hook.Context
+		previous map[string]interface{}
+		read     bool
+	)
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterContext(func(c *hook.Context) error {
+				ctxt = c
+				return nil
+			}, nil)
+			r.RegisterHook("config-changed", func() error {
+				previous = ctxt.PreviousConfig()
+				if read {
+					_, err := ctxt.ChangedKeys()
+					return err
+				}
+				return nil
+			})
+		},
+		Config: map[string]interface{}{
+			"name": "foo",
+		},
+		Logger: c,
+	}
+	// A config-changed hook that does not look at the
+	// configuration still records it.
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(previous, gc.IsNil)
+
+	runner.Config["name"] = "bar"
+	read = true
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(previous, jc.DeepEquals, map[string]interface{}{
+		"name": "foo",
+	})
+
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(previous, jc.DeepEquals, map[string]interface{}{
+		"name": "bar",
+	})
+}
@@ -0,0 +1,65 @@
+package hook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// CrashFile returns the path of the file that details of
+// panics in hook functions are appended to.
+func (ctxt *Context) CrashFile() string {
+	return filepath.Join(ctxt.unitStateDir(), "crash.log")
+}
+
+// runHookFunc runs the given hook function. If the function
+// panics, the panic is recovered and reported (see reportPanic)
+// and an error is returned.
+func runHookFunc(ctxt *Context, f hookFunc) (err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		reportPanic(ctxt, f.registryName, v, debug.Stack())
+		err = errgo.Newf("panic: %v", v)
+	}()
+	return f.run()
+}
+
+// reportPanic reports a panic with the given value and stack trace
+// in a hook function registered by the given registry. The stack
+// trace is logged through juju-log and appended to the unit's crash
+// file, and the unit's status is set to blocked. Failures are
+// written to standard error, which Juju records in the unit log.
+func reportPanic(ctxt *Context, registryName string, v interface{}, stack []byte) {
+	msg := fmt.Sprintf("hook %s (registry %s) panicked: %v", ctxt.HookName, registryName, v)
+	if err := ctxt.Errorf("%s\n%s", msg, stack); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot log panic: %v\n%s\n%s", err, msg, stack)
+	}
+	if err := writeCrashFile(ctxt.CrashFile(), msg, stack); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write crash file: %v\n", err)
+	}
+	if err := ctxt.SetStatus(StatusBlocked, msg); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot set status: %v\n", err)
+	}
+}
+
+func writeCrashFile(path, msg string, stack []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errgo.Mask(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s %s\n%s\n", time.Now().UTC().Format(time.RFC3339), msg, stack); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type crashSuite struct {
+	savedHookStateDir string
+}
+
+var _ = gc.Suite(&crashSuite{})
+
+func (s *crashSuite) SetUpTest(c *gc.C) {
+	s.savedHookStateDir = *hook.HookStateDir
+	*hook.HookStateDir = c.MkDir()
+}
+
+func (s *crashSuite) TearDownTest(c *gc.C) {
+	*hook.HookStateDir = s.savedHookStateDir
+}
+
+func (s *crashSuite) TestPanicInHook(c *gc.C) {
+	r := hook.NewRegistry()
+	ran := false
+	r.Clone("sub").RegisterHook("install", func() error {
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	})
+	r.RegisterHook("install", func() error {
+		ran = true
+		return nil
+	})
+	runner := &recordingRunner{}
+	ctxt := &hook.Context{
+		UUID:     "fff",
+		Unit:     "foo/0",
+		HookName: "install",
+		Runner:   runner,
+	}
+	err := hook.Main(r, ctxt, memState{})
+	c.Assert(err, gc.ErrorMatches, `hook install \(registry root.sub\): panic: assignment to entry in nil map`)
+	// Hook functions after the panic are not run.
+	c.Assert(ran, gc.Equals, false)
+
+	msg := "hook install (registry root.sub) panicked: assignment to entry in nil map"
+	var logged, status []string
+	for _, rec := range runner.record {
+		switch rec[0] {
+		case "juju-log":
+			if strings.HasPrefix(rec[len(rec)-1], msg) {
+				logged = rec
+			}
+		case "status-set":
+			status = rec
+		}
+	}
+	c.Assert(logged, gc.HasLen, 4)
+	c.Assert(logged[1:3], gc.DeepEquals, []string{"--log-level", "ERROR"})
+	c.Assert(logged[3], gc.Matches, `(?s).*\ngoroutine .*crash_test.go.*`)
+	c.Assert(status, gc.DeepEquals, []string{"status-set", "blocked", msg})
+
+	data, err := ioutil.ReadFile(ctxt.CrashFile())
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, `(?s)[0-9TZ:-]+ `+regexp.QuoteMeta(msg)+`\ngoroutine .*crash_test.go.*`)
+}
@@ -0,0 +1,85 @@
+package hook
+
+import (
+	"encoding/json"
+
+	"gopkg.in/errgo.v1"
+)
+
+// relationsStateKey holds the persistent state key used to
+// record the remote units seen on each relation.
+const relationsStateKey = "gocharm:relations"
+
+// seenUnits maps from relation id to the remote units seen
+// on that relation, with their settings.
+type seenUnits map[RelationId]map[UnitId]map[string]string
+
+// DepartedUnits returns the remote units that have left the current
+// relation since the last hook was run, with their last known
+// settings. In a relation-departed hook, this will include the unit
+// that triggered the hook (ctxt.RemoteUnit); in a relation-broken hook,
+// it will include any units that were still in the relation when a hook
+// was last run.
+//
+// This is useful because relation-get cannot be used to retrieve the
+// settings of a unit once it has departed. Only the settings seen
+// when a hook last ran are known, so a change made by the remote unit
+// just before it departed may be missing.
+//
+// It panics if called in a non-relation hook.
+func (ctxt *Context) DepartedUnits() map[UnitId]map[string]string {
+	if ctxt.RelationId == "" {
+		panic(errgo.Newf("DepartedUnits called in non-relation hook %s", ctxt.HookName))
+	}
+	return ctxt.DepartedUnitsWithId(ctxt.RelationId)
+}
+
+// DepartedUnitsWithId is like DepartedUnits except that
+// it returns the units that have left the relation
+// with the given id.
+func (ctxt *Context) DepartedUnitsWithId(id RelationId) map[UnitId]map[string]string {
+	return ctxt.departed[id]
+}
+
+// loadDeparted finds which units have departed since the units
+// recorded in the given state were seen, and records them in
+// ctxt.departed.
+func loadDeparted(ctxt *Context, state PersistentState) error {
+	data, err := state.Load(relationsStateKey)
+	if err != nil || data == nil {
+		return errgo.Mask(err)
+	}
+	var seen seenUnits
+	if err := json.Unmarshal(data, &seen); err != nil {
+		return errgo.Notef(err, "cannot unmarshal seen relation units")
+	}
+	departed := make(seenUnits)
+	for id, units := range seen {
+		current := ctxt.Relations[id]
+		for unit, settings := range units {
+			if _, ok := current[unit]; ok {
+				continue
+			}
+			if departed[id] == nil {
+				departed[id] = make(map[UnitId]map[string]string)
+			}
+			departed[id][unit] = settings
+		}
+	}
+	ctxt.departed = departed
+	ctxt.seen = seen
+	return nil
+}
+
+// saveSeen records the remote units currently in
+// all the charm's relations in the given state.
+func saveSeen(ctxt *Context, state PersistentState) error {
+	data, err := json.Marshal(seenUnits(ctxt.Relations))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := state.Save(relationsStateKey, data); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type departedSuite struct{}
+
+var _ = gc.Suite(&departedSuite{})
+
+func (s *departedSuite) TestDepartedUnits(c *gc.C) {
+	var ctxt *hook.Context
+	departed := make(map[string]map[hook.UnitId]map[string]string)
+	record := func(hookName string) func() error {
+		return func() error {
+			departed[hookName] = ctxt.DepartedUnits()
+			return nil
+		}
+	}
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterRelation(charm.Relation{
+				Name:      "db",
+				Role:      charm.RoleRequirer,
+				Interface: "mysql",
+			})
+			r.RegisterContext(func(hctxt *hook.Context) error {
+				ctxt = hctxt
+				return nil
+			}, nil)
+			r.RegisterHook("db-relation-changed", record("db-relation-changed"))
+			r.RegisterHook("db-relation-departed", record("db-relation-departed"))
+			r.RegisterHook("db-relation-broken", record("db-relation-broken"))
+		},
+		Logger: c,
+	}
+	rel := runner.AddRelation("db", "db:0")
+	err := rel.Join("mysql/0", map[string]string{"host": "0.1.2.3"})
+	c.Assert(err, gc.IsNil)
+	err = rel.Join("mysql/1", map[string]string{"host": "0.1.2.4"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(departed["db-relation-changed"], gc.HasLen, 0)
+
+	err = rel.Change("mysql/1", map[string]string{"host": "0.1.2.5"})
+	c.Assert(err, gc.IsNil)
+	err = rel.Depart("mysql/1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(departed["db-relation-departed"], jc.DeepEquals, map[hook.UnitId]map[string]string{
+		"mysql/1": {"host": "0.1.2.5"},
+	})
+
+	err = rel.Break()
+	c.Assert(err, gc.IsNil)
+	c.Assert(departed["db-relation-departed"], jc.DeepEquals, map[hook.UnitId]map[string]string{
+		"mysql/0": {"host": "0.1.2.3"},
+	})
+	// The unit departed in the previous hook,
+	// so it isn't reported again.
+	c.Assert(departed["db-relation-broken"], gc.HasLen, 0)
+}
+
+func (s *departedSuite) TestDepartedUnitsWithoutDepartedHook(c *gc.C) {
+	var ctxt *hook.Context
+	var departed map[hook.UnitId]map[string]string
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterRelation(charm.Relation{
+				Name:      "db",
+				Role:      charm.RoleRequirer,
+				Interface: "mysql",
+			})
+			r.RegisterContext(func(hctxt *hook.Context) error {
+				ctxt = hctxt
+				return nil
+			}, nil)
+			r.RegisterHook("db-relation-joined", func() error { return nil })
+			r.RegisterHook("db-relation-broken", func() error {
+				departed = ctxt.DepartedUnits()
+				return nil
+			})
+		},
+		Logger: c,
+	}
+	rel := runner.AddRelation("db", "db:0")
+	err := rel.Join("mysql/0", map[string]string{"host": "0.1.2.3"})
+	c.Assert(err, gc.IsNil)
+	err = rel.Break()
+	c.Assert(err, gc.IsNil)
+	c.Assert(departed, jc.DeepEquals, map[hook.UnitId]map[string]string{
+		"mysql/0": {"host": "0.1.2.3"},
+	})
+}
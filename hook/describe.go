@@ -0,0 +1,116 @@
+package hook
+
+import (
+	"gopkg.in/juju/charm.v5"
+)
+
+// Description describes everything that has been registered with a
+// Registry, as returned by Registry.Describe. It holds only plain
+// data, so it can be marshaled (gocharm itself reads it as JSON), and
+// the lists of names in it are sorted, so the same registrations
+// always give the same description.
+type Description struct {
+	// Hooks holds the names of the registered hooks,
+	// excluding wildcard ("*") hooks.
+	Hooks []string
+
+	// HookStubs holds the stub details of each registered
+	// hook, as returned by Registry.HookStub.
+	HookStubs map[string]HookStub
+
+	// Relations holds the registered relations,
+	// keyed by relation name.
+	Relations map[string]charm.Relation
+
+	// Config holds the registered configuration
+	// options, keyed by name.
+	Config map[string]charm.Option
+
+	// Metrics holds the registered metrics, keyed by name.
+	Metrics map[string]charm.Metric
+
+	// Resources holds the registered resources, keyed by name.
+	Resources map[string]Resource
+
+	// Commands holds the names of the registries that
+	// have registered a command.
+	Commands []string
+
+	// Binaries holds the names of the binaries
+	// registered with RegisterBinary.
+	Binaries []string
+
+	// LXDProfile holds the registered LXD profile
+	// settings, or nil if there are none.
+	LXDProfile *LXDProfile
+
+	// Series holds the series supported by each feature
+	// registered with RegisterSeries, keyed by feature name.
+	Series map[string][]string
+}
+
+// Describe returns a description of everything registered with the
+// registry and any registries cloned from it. It is intended to be
+// called after the charm's RegisterHooks function (and
+// RegisterMainHooks) have run, by tools that need to know what a
+// charm does without running its hooks. The description is a copy,
+// so later registrations do not change it.
+func (r *Registry) Describe() *Description {
+	d := &Description{
+		Hooks:      r.RegisteredHooks(),
+		HookStubs:  make(map[string]HookStub),
+		Relations:  make(map[string]charm.Relation),
+		Config:     make(map[string]charm.Option),
+		Metrics:    make(map[string]charm.Metric),
+		Resources:  make(map[string]Resource),
+		Commands:   r.RegisteredCommands(),
+		Binaries:   r.RegisteredBinaries(),
+		LXDProfile: copyLXDProfile(r.RegisteredLXDProfile()),
+		Series:     make(map[string][]string),
+	}
+	for _, name := range d.Hooks {
+		d.HookStubs[name] = r.HookStub(name)
+	}
+	for name, rel := range r.relations {
+		d.Relations[name] = rel
+	}
+	for name, opt := range r.config {
+		d.Config[name] = opt
+	}
+	for name, m := range r.metrics {
+		d.Metrics[name] = m
+	}
+	for name, res := range r.resources {
+		d.Resources[name] = res
+	}
+	for feature, series := range r.series {
+		d.Series[feature] = append([]string(nil), series...)
+	}
+	return d
+}
+
+// copyLXDProfile returns a deep copy of p,
+// or nil if p is nil.
+func copyLXDProfile(p *LXDProfile) *LXDProfile {
+	if p == nil {
+		return nil
+	}
+	c := &LXDProfile{}
+	if p.Config != nil {
+		c.Config = make(map[string]string)
+		for key, val := range p.Config {
+			c.Config[key] = val
+		}
+	}
+	if p.Devices != nil {
+		c.Devices = make(map[string]map[string]string)
+		for name, device := range p.Devices {
+			settings := make(map[string]string)
+			for key, val := range device {
+				settings[key] = val
+			}
+			c.Devices[name] = settings
+		}
+	}
+	return c
+}
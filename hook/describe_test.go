@@ -0,0 +1,82 @@
+package hook_test
+
+import (
+	"encoding/json"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type describeSuite struct{}
+
+var _ = gc.Suite(&describeSuite{})
+
+func (*describeSuite) TestDescribe(c *gc.C) {
+	r := hook.NewRegistry()
+	nop := func() error { return nil }
+	r.RegisterHook("start", nop)
+	r.RegisterHook("install", nop)
+	r.RegisterHook("*", nop)
+	r.RegisterHookStub("*", hook.HookStub{Dir: "work"})
+	r.RegisterRelation(charm.Relation{
+		Name:      "db",
+		Role:      charm.RoleRequirer,
+		Interface: "mysql",
+	})
+	r.RegisterConfig("port", charm.Option{
+		Type:    "int",
+		Default: 8080,
+	})
+	other := r.Clone("other")
+	other.RegisterCommand(func([]string) {})
+	other.RegisterBinary("agent")
+	other.RegisterSeries("upstart service", "trusty", "precise")
+	other.RegisterLXDProfileConfig("security.nesting", "true")
+
+	d := r.Describe()
+	c.Assert(d, jc.DeepEquals, &hook.Description{
+		Hooks: []string{"install", "start"},
+		HookStubs: map[string]hook.HookStub{
+			"install": {Dir: "work"},
+			"start":   {Dir: "work"},
+		},
+		Relations: map[string]charm.Relation{
+			"db": {
+				Name:      "db",
+				Role:      charm.RoleRequirer,
+				Interface: "mysql",
+				Limit:     1,
+				Scope:     charm.ScopeGlobal,
+			},
+		},
+		Config: map[string]charm.Option{
+			"port": {
+				Type:    "int",
+				Default: 8080,
+			},
+		},
+		Metrics:   map[string]charm.Metric{},
+		Resources: map[string]hook.Resource{},
+		Commands:  []string{"root.other"},
+		Binaries:  []string{"agent"},
+		LXDProfile: &hook.LXDProfile{
+			Config: map[string]string{"security.nesting": "true"},
+		},
+		Series: map[string][]string{
+			"upstart service": {"precise", "trusty"},
+		},
+	})
+
+	// The description is not changed by later registrations.
+	r.RegisterConfig("name", charm.Option{Type: "string"})
+	other.RegisterLXDProfileConfig("security.privileged", "true")
+	c.Assert(d.Config, gc.HasLen, 1)
+	c.Assert(d.LXDProfile.Config, gc.HasLen, 1)
+
+	// The description can be marshaled.
+	_, err := json.Marshal(d)
+	c.Assert(err, gc.IsNil)
+}
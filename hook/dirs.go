@@ -0,0 +1,73 @@
+package hook
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/errgo.v1"
+)
+
+// ResourceDir returns the path to the directory where files derived
+// from the charm's resources (see GetResource), such as unpacked
+// archives, may be stored for the given context. Like StateDir, the
+// directory is relative to the registry through which the context was
+// created. It is not guaranteed to exist; see EnsureResourceDir.
+func (ctxt *Context) ResourceDir() string {
+	return filepath.Join(ctxt.unitStateDir(), ".resources", ctxt.registryName)
+}
+
+// EnsureCharmDir returns the absolute path of the directory that the
+// charm is running from, as held in ctxt.CharmDir, and checks that it
+// exists. Hooks should use it rather than relying on the current
+// directory or $CHARM_DIR, which differ between Juju agent layouts.
+func (ctxt *Context) EnsureCharmDir() (string, error) {
+	if ctxt.CharmDir == "" {
+		return "", errgo.New("charm directory not known")
+	}
+	dir, err := filepath.Abs(ctxt.CharmDir)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", errgo.Notef(err, "cannot find charm directory")
+	}
+	if !info.IsDir() {
+		return "", errgo.Newf("charm directory %q is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// EnsureStateDir returns the path of the directory returned by
+// StateDir, creating it if necessary. The directory is readable and
+// writable only by its owner, because the local state may hold
+// secrets.
+func (ctxt *Context) EnsureStateDir() (string, error) {
+	return ensurePrivateDir(ctxt.StateDir())
+}
+
+// EnsureResourceDir returns the path of the directory returned by
+// ResourceDir, creating it if necessary. As with EnsureStateDir, the
+// directory is accessible only by its owner.
+func (ctxt *Context) EnsureResourceDir() (string, error) {
+	return ensurePrivateDir(ctxt.ResourceDir())
+}
+
+// ensurePrivateDir creates the directory dir and any parents that do
+// not exist, and makes sure that dir is accessible only by its owner,
+// even if it already existed with different permissions.
+func ensurePrivateDir(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errgo.Notef(err, "cannot create directory")
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return "", errgo.Notef(err, "cannot set permissions of %q", dir)
+		}
+	}
+	return dir, nil
+}
@@ -0,0 +1,109 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type dirsSuite struct {
+	savedHookStateDir string
+}
+
+var _ = gc.Suite(&dirsSuite{})
+
+func (s *dirsSuite) SetUpTest(c *gc.C) {
+	s.savedHookStateDir = *hook.HookStateDir
+	*hook.HookStateDir = c.MkDir()
+}
+
+func (s *dirsSuite) TearDownTest(c *gc.C) {
+	*hook.HookStateDir = s.savedHookStateDir
+}
+
+func (s *dirsSuite) TestEnsureCharmDir(c *gc.C) {
+	charmDir := c.MkDir()
+	t := hook.NewTestContext(hook.TestContextParams{
+		CharmDir: charmDir,
+	})
+	defer t.Close()
+	dir, err := t.EnsureCharmDir()
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, charmDir)
+
+	// A relative charm directory is made absolute.
+	cwd, err := os.Getwd()
+	c.Assert(err, gc.IsNil)
+	rel, err := filepath.Rel(cwd, charmDir)
+	c.Assert(err, gc.IsNil)
+	t.CharmDir = rel
+	dir, err = t.EnsureCharmDir()
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, charmDir)
+
+	t.CharmDir = filepath.Join(charmDir, "nonexistent")
+	_, err = t.EnsureCharmDir()
+	c.Assert(err, gc.ErrorMatches, `cannot find charm directory: .*`)
+
+	file := filepath.Join(charmDir, "file")
+	err = ioutil.WriteFile(file, nil, 0666)
+	c.Assert(err, gc.IsNil)
+	t.CharmDir = file
+	_, err = t.EnsureCharmDir()
+	c.Assert(err, gc.ErrorMatches, `charm directory ".*/file" is not a directory`)
+
+	t.CharmDir = ""
+	_, err = t.EnsureCharmDir()
+	c.Assert(err, gc.ErrorMatches, `charm directory not known`)
+}
+
+func (s *dirsSuite) TestEnsureStateDir(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	defer t.Close()
+	c.Assert(t.StateDir(), gc.Matches, regexp.QuoteMeta(*hook.HookStateDir)+`/.*`)
+	_, err := os.Stat(t.StateDir())
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+
+	dir, err := t.EnsureStateDir()
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, t.StateDir())
+	assertMode(c, dir, 0700)
+
+	// The permissions are corrected if they are wrong.
+	err = os.Chmod(dir, 0755)
+	c.Assert(err, gc.IsNil)
+	dir, err = t.EnsureStateDir()
+	c.Assert(err, gc.IsNil)
+	assertMode(c, dir, 0700)
+}
+
+func (s *dirsSuite) TestEnsureResourceDir(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	defer t.Close()
+	c.Assert(t.ResourceDir(), gc.Not(gc.Equals), t.StateDir())
+
+	dir, err := t.EnsureResourceDir()
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, t.ResourceDir())
+	assertMode(c, dir, 0700)
+
+	// A file in the way is an error.
+	err = os.RemoveAll(dir)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(dir, nil, 0600)
+	c.Assert(err, gc.IsNil)
+	_, err = t.EnsureResourceDir()
+	c.Assert(err, gc.ErrorMatches, `cannot create directory: .*`)
+}
+
+func assertMode(c *gc.C, path string, mode os.FileMode) {
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.IsDir(), gc.Equals, true)
+	c.Assert(info.Mode().Perm(), gc.Equals, mode)
+}
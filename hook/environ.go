@@ -0,0 +1,138 @@
+package hook
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	envModelName        = "JUJU_MODEL_NAME"
+	envEnvName          = "JUJU_ENV_NAME"
+	envRemoteApp        = "JUJU_REMOTE_APP"
+	envActionUUID       = "JUJU_ACTION_UUID"
+	envActionName       = "JUJU_ACTION_NAME"
+	envAvailabilityZone = "JUJU_AVAILABILITY_ZONE"
+	envMachineId        = "JUJU_MACHINE_ID"
+)
+
+// Environ holds the environment that Juju provides to a hook. It is
+// read once when the hook starts (see NewContextFromEnvironment), so
+// hook code should use Context.Environ rather than looking up
+// environment variables itself; tests can then provide the values
+// with TestContextParams.Environ.
+type Environ struct {
+	// HookName holds the name of the running hook.
+	HookName string
+
+	// DispatchPath holds $JUJU_DISPATCH_PATH, set by Juju
+	// versions that run hooks through a dispatch script,
+	// for example "hooks/install" or "actions/backup".
+	DispatchPath string
+
+	// UnitName holds $JUJU_UNIT_NAME.
+	UnitName UnitId
+
+	// CharmDir holds $CHARM_DIR.
+	CharmDir string
+
+	// ContextId holds $JUJU_CONTEXT_ID, which identifies the
+	// hook context to the Juju agent.
+	ContextId string
+
+	// ModelUUID holds $JUJU_MODEL_UUID, or $JUJU_ENV_UUID
+	// with versions of Juju before 2.0.
+	ModelUUID string
+
+	// ModelName holds $JUJU_MODEL_NAME, or $JUJU_ENV_NAME
+	// with versions of Juju before 2.0.
+	ModelName string
+
+	// Version holds $JUJU_VERSION, the version of the
+	// Juju agent running the hook.
+	Version string
+
+	// RelationName, RelationId, RemoteUnit and RemoteApp
+	// hold $JUJU_RELATION, $JUJU_RELATION_ID,
+	// $JUJU_REMOTE_UNIT and $JUJU_REMOTE_APP, which are
+	// set only for relation hooks.
+	RelationName string
+	RelationId   RelationId
+	RemoteUnit   UnitId
+	RemoteApp    string
+
+	// ActionUUID and ActionName hold $JUJU_ACTION_UUID and
+	// $JUJU_ACTION_NAME, which are set only when an
+	// action is running.
+	ActionUUID string
+	ActionName string
+
+	// AvailabilityZone holds $JUJU_AVAILABILITY_ZONE,
+	// the availability zone of the unit's machine,
+	// if the cloud provides one.
+	AvailabilityZone string
+
+	// MachineId holds $JUJU_MACHINE_ID, the id of the
+	// machine that the unit is running on. It is not set
+	// for units running in Kubernetes pods.
+	MachineId string
+
+	// Vars holds every variable whose name starts with
+	// JUJU_, $CHARM_DIR and the proxy variables set by
+	// older versions of Juju (see Context.ProxySettings),
+	// keyed by name, including those that have no field
+	// of their own.
+	Vars map[string]string
+}
+
+// NewEnviron returns the Environ held in the given environment
+// variables, in the form returned by os.Environ.
+func NewEnviron(vars []string) Environ {
+	env := Environ{
+		Vars: make(map[string]string),
+	}
+	for _, v := range vars {
+		i := strings.Index(v, "=")
+		if i == -1 {
+			continue
+		}
+		name, val := v[0:i], v[i+1:]
+		if strings.HasPrefix(name, "JUJU_") || name == envCharmDir || legacyProxyVars[name] {
+			env.Vars[name] = val
+		}
+	}
+	get := func(names ...string) string {
+		for _, name := range names {
+			if val := env.Vars[name]; val != "" {
+				return val
+			}
+		}
+		return ""
+	}
+	env.DispatchPath = get(envDispatchPath)
+	if p := env.DispatchPath; p != "" && path.Dir(p) == "hooks" {
+		env.HookName = path.Base(p)
+	} else {
+		env.HookName = get(envHookName)
+	}
+	env.UnitName = UnitId(get(envUnitName))
+	env.CharmDir = get(envCharmDir)
+	env.ContextId = get(envJujuContextId)
+	env.ModelUUID = get(envUUID, envModelUUID)
+	env.ModelName = get(envModelName, envEnvName)
+	env.Version = get(envVersion)
+	env.RelationName = get(envRelationName)
+	env.RelationId = RelationId(get(envRelationId))
+	env.RemoteUnit = UnitId(get(envRemoteUnit))
+	env.RemoteApp = get(envRemoteApp)
+	env.ActionUUID = get(envActionUUID)
+	env.ActionName = get(envActionName)
+	env.AvailabilityZone = get(envAvailabilityZone)
+	env.MachineId = get(envMachineId)
+	return env
+}
+
+// Getenv returns the value of the named variable
+// in env.Vars, or the empty string if it is not set.
+func (env Environ) Getenv(name string) string {
+	return env.Vars[name]
+}
@@ -0,0 +1,116 @@
+package hook_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type environSuite struct{}
+
+var _ = gc.Suite(&environSuite{})
+
+func (*environSuite) TestNewEnviron(c *gc.C) {
+	env := hook.NewEnviron([]string{
+		"PATH=/usr/bin:/bin",
+		"CHARM_DIR=/var/lib/juju/agents/unit-wordpress-0/charm",
+		"JUJU_DISPATCH_PATH=hooks/db-relation-changed",
+		"JUJU_HOOK_NAME=other",
+		"JUJU_UNIT_NAME=wordpress/0",
+		"JUJU_CONTEXT_ID=wordpress/0-db-relation-changed-1234",
+		"JUJU_MODEL_UUID=eee.eee.eee",
+		"JUJU_MODEL_NAME=default",
+		"JUJU_VERSION=2.9.42",
+		"JUJU_RELATION=db",
+		"JUJU_RELATION_ID=db:2",
+		"JUJU_REMOTE_UNIT=mysql/1",
+		"JUJU_REMOTE_APP=mysql",
+		"JUJU_AVAILABILITY_ZONE=us-east-1a",
+		"JUJU_MACHINE_ID=0/lxd/3",
+		"JUJU_PRINCIPAL_UNIT=",
+		"JUJU_EQUALS=a=b",
+		"http_proxy=http://proxy:3128",
+		"malformed",
+	})
+	c.Assert(env, gc.DeepEquals, hook.Environ{
+		HookName:         "db-relation-changed",
+		DispatchPath:     "hooks/db-relation-changed",
+		UnitName:         "wordpress/0",
+		CharmDir:         "/var/lib/juju/agents/unit-wordpress-0/charm",
+		ContextId:        "wordpress/0-db-relation-changed-1234",
+		ModelUUID:        "eee.eee.eee",
+		ModelName:        "default",
+		Version:          "2.9.42",
+		RelationName:     "db",
+		RelationId:       "db:2",
+		RemoteUnit:       "mysql/1",
+		RemoteApp:        "mysql",
+		AvailabilityZone: "us-east-1a",
+		MachineId:        "0/lxd/3",
+		Vars: map[string]string{
+			"CHARM_DIR":              "/var/lib/juju/agents/unit-wordpress-0/charm",
+			"JUJU_DISPATCH_PATH":     "hooks/db-relation-changed",
+			"JUJU_HOOK_NAME":         "other",
+			"JUJU_UNIT_NAME":         "wordpress/0",
+			"JUJU_CONTEXT_ID":        "wordpress/0-db-relation-changed-1234",
+			"JUJU_MODEL_UUID":        "eee.eee.eee",
+			"JUJU_MODEL_NAME":        "default",
+			"JUJU_VERSION":           "2.9.42",
+			"JUJU_RELATION":          "db",
+			"JUJU_RELATION_ID":       "db:2",
+			"JUJU_REMOTE_UNIT":       "mysql/1",
+			"JUJU_REMOTE_APP":        "mysql",
+			"JUJU_AVAILABILITY_ZONE": "us-east-1a",
+			"JUJU_MACHINE_ID":        "0/lxd/3",
+			"JUJU_PRINCIPAL_UNIT":    "",
+			"JUJU_EQUALS":            "a=b",
+			"http_proxy":             "http://proxy:3128",
+		},
+	})
+	c.Assert(env.Getenv("JUJU_EQUALS"), gc.Equals, "a=b")
+	c.Assert(env.Getenv("PATH"), gc.Equals, "")
+}
+
+func (*environSuite) TestNewEnvironOldJuju(c *gc.C) {
+	env := hook.NewEnviron([]string{
+		"JUJU_ENV_UUID=fff.fff.fff",
+		"JUJU_ENV_NAME=local",
+		"JUJU_HOOK_NAME=backup",
+		"JUJU_DISPATCH_PATH=actions/backup",
+		"JUJU_ACTION_UUID=7a1d0a4e-2c6c-4d8a-8b55-1f4d6e0b3c21",
+		"JUJU_ACTION_NAME=backup",
+	})
+	c.Assert(env.ModelUUID, gc.Equals, "fff.fff.fff")
+	c.Assert(env.ModelName, gc.Equals, "local")
+	c.Assert(env.HookName, gc.Equals, "backup")
+	c.Assert(env.ActionUUID, gc.Equals, "7a1d0a4e-2c6c-4d8a-8b55-1f4d6e0b3c21")
+	c.Assert(env.ActionName, gc.Equals, "backup")
+}
+
+func (*environSuite) TestTestContextEnviron(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{
+		HookName:   "db-relation-joined",
+		CharmDir:   "/charm",
+		RelationId: "db:0",
+		RemoteUnit: "mysql/0",
+		RelationIds: map[string][]hook.RelationId{
+			"db": {"db:0"},
+		},
+		Environ: hook.Environ{
+			ModelName:        "testing",
+			AvailabilityZone: "zone-b",
+		},
+	})
+	defer t.Close()
+	c.Assert(t.Environ, gc.DeepEquals, hook.Environ{
+		HookName:         "db-relation-joined",
+		UnitName:         "someunit/0",
+		CharmDir:         "/charm",
+		ModelUUID:        t.UUID,
+		ModelName:        "testing",
+		RelationName:     "db",
+		RelationId:       "db:0",
+		RemoteUnit:       "mysql/0",
+		AvailabilityZone: "zone-b",
+	})
+}
@@ -0,0 +1,206 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/errgo.v1"
+)
+
+const (
+	// ExitRetry holds the exit status of the runhook executable
+	// when a hook fails with a RetryableError.
+	ExitRetry = 2
+
+	// retryStateKey holds the persistent state key used to
+	// record hooks that have been rescheduled.
+	retryStateKey = "gocharm:retry"
+)
+
+// RetryableError can be returned by a hook function to indicate that
+// it failed for a reason that is likely to go away if the hook is run
+// again later, for example because a service that it depends on is not
+// yet available.
+//
+// By default, the hook fails as usual, but the runhook executable
+// exits with status ExitRetry and the unit log suggests using
+// "juju resolved --retry".
+//
+// If Reschedule is true and the charm has registered an
+// update-status hook, the hook succeeds instead: the unit's status is
+// set to waiting, and the hook's functions are run again after the
+// functions for the next update-status hook, until they no longer
+// return a rescheduled RetryableError. Relation hooks are never
+// rescheduled, because their relation context is not available
+// later.
+type RetryableError struct {
+	// Err holds the underlying error.
+	Err error
+
+	// Reschedule specifies that the hook should be
+	// run again in a later update-status hook.
+	Reschedule bool
+}
+
+// Error implements error.Error.
+func (e *RetryableError) Error() string {
+	if e.Err == nil {
+		return "retryable error"
+	}
+	return e.Err.Error()
+}
+
+// BlockedError can be returned by a hook function to indicate that
+// the unit cannot proceed until the user takes some action, such as
+// changing the charm's configuration or adding a relation. The unit's
+// status is set to blocked with the given message, no further hook
+// functions are run, and the hook succeeds, so that the unit does not
+// go into an error state.
+type BlockedError struct {
+	// Message holds the message that will
+	// be shown with the blocked status.
+	Message string
+}
+
+// Error implements error.Error.
+func (e *BlockedError) Error() string {
+	return "blocked: " + e.Message
+}
+
+// ExitCode returns the exit status that the runhook executable
+// should use when Main returns the given error.
+func ExitCode(err error) int {
+	switch errgo.Cause(err).(type) {
+	case nil:
+		return 0
+	case *RetryableError:
+		return ExitRetry
+	}
+	return 1
+}
+
+func isRetryable(err error) bool {
+	_, ok := err.(*RetryableError)
+	return ok
+}
+
+// runHookFuncs runs all the given hook functions, stopping at the
+// first error. A BlockedError sets the unit's status to blocked, and
+// a RetryableError that can be rescheduled is recorded so that the
+// hook is run again later; in both these cases runHookFuncs returns
+// no error but reports that the hook was stopped, so that no further
+// hook functions should be run.
+func runHookFuncs(r *Registry, ctxt *Context, state PersistentState, funcs []hookFunc) (stopped bool, _ error) {
+	for _, f := range funcs {
+		err := runHookFunc(ctxt, f)
+		if err == nil {
+			continue
+		}
+		switch cause := errgo.Cause(err).(type) {
+		case *BlockedError:
+			ctxt.Logf("hook %s (registry %s) is blocked: %s", ctxt.HookName, f.registryName, cause.Message)
+			if err := ctxt.SetStatus(StatusBlocked, cause.Message); err != nil {
+				return true, errgo.Notef(err, "cannot set blocked status")
+			}
+			return true, nil
+		case *RetryableError:
+			if cause.Reschedule && canReschedule(r, ctxt) {
+				if err := reschedule(ctxt, state, cause); err != nil {
+					return true, errgo.Notef(err, "cannot reschedule hook %s", ctxt.HookName)
+				}
+				return true, nil
+			}
+			ctxt.Logf("hook %s failed with a retryable error; use \"juju resolved --retry %s\" to run it again", ctxt.HookName, ctxt.Unit)
+		}
+		return true, errgo.NoteMask(err, fmt.Sprintf("hook %s (registry %s)", ctxt.HookName, f.registryName), isRetryable)
+	}
+	return false, nil
+}
+
+// canReschedule reports whether the current hook
+// can be rescheduled to run in a later update-status hook.
+func canReschedule(r *Registry, ctxt *Context) bool {
+	return ctxt.RelationId == "" && len(r.hooks[string(UpdateStatus)]) > 0
+}
+
+func reschedule(ctxt *Context, state PersistentState, retryErr *RetryableError) error {
+	pending, err := rescheduledHooks(state)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	found := false
+	for _, name := range pending {
+		if name == ctxt.HookName {
+			found = true
+		}
+	}
+	if !found {
+		pending = append(pending, ctxt.HookName)
+	}
+	if err := saveRescheduledHooks(state, pending); err != nil {
+		return errgo.Mask(err)
+	}
+	ctxt.Logf("hook %s will be retried: %v", ctxt.HookName, retryErr)
+	if err := ctxt.SetStatus(StatusWaiting, retryErr.Error()); err != nil {
+		return errgo.Notef(err, "cannot set waiting status")
+	}
+	return nil
+}
+
+// runRescheduledHooks runs the functions for any hooks that were
+// rescheduled by earlier hooks. It is called in the update-status
+// hook. Like runHookFuncs, it reports whether any of the hooks
+// was stopped.
+func runRescheduledHooks(r *Registry, ctxt *Context, state PersistentState) (stopped bool, _ error) {
+	pending, err := rescheduledHooks(state)
+	if err != nil || len(pending) == 0 {
+		return false, errgo.Mask(err)
+	}
+	// Clear the pending hooks first; any that need
+	// to be retried again will be added back.
+	if err := saveRescheduledHooks(state, nil); err != nil {
+		return false, errgo.Mask(err)
+	}
+	hookName := ctxt.HookName
+	defer func() {
+		ctxt.HookName = hookName
+	}()
+	for i, name := range pending {
+		ctxt.HookName = name
+		ctxt.Logf("retrying hook %s", name)
+		s, err := runHookFuncs(r, ctxt, state, sortedHookFuncs(r.hooks[name]))
+		if err != nil {
+			// Keep the hooks that have not succeeded so that
+			// they are run again if update-status is retried.
+			if saveErr := saveRescheduledHooks(state, pending[i:]); saveErr != nil {
+				ctxt.Logf("cannot save rescheduled hooks: %v", saveErr)
+			}
+			return true, errgo.NoteMask(err, "rescheduled", isRetryable)
+		}
+		stopped = stopped || s
+	}
+	return stopped, nil
+}
+
+func rescheduledHooks(state PersistentState) ([]string, error) {
+	data, err := state.Load(retryStateKey)
+	if err != nil || data == nil {
+		return nil, errgo.Mask(err)
+	}
+	var pending []string
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, errgo.Notef(err, "cannot unmarshal rescheduled hooks")
+	}
+	return pending, nil
+}
+
+func saveRescheduledHooks(state PersistentState, pending []string) error {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := state.Save(retryStateKey, data); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
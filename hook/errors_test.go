@@ -0,0 +1,135 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type errorsSuite struct{}
+
+var _ = gc.Suite(&errorsSuite{})
+
+func (s *errorsSuite) TestBlockedError(c *gc.C) {
+	r := hook.NewRegistry()
+	var ran []string
+	r.RegisterHook("config-changed", func() error {
+		ran = append(ran, "config-changed")
+		return &hook.BlockedError{Message: "no password set"}
+	})
+	r.RegisterHook("*", func() error {
+		ran = append(ran, "*")
+		return nil
+	})
+	runner := &recordingRunner{
+		output: map[string]string{
+			"config-get": "{}",
+		},
+	}
+	err := hook.Main(r, newErrorsContext("config-changed", runner), memState{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(ran, jc.DeepEquals, []string{"config-changed"})
+	c.Assert(statusCalls(runner), jc.DeepEquals, [][]string{
+		{"status-set", "blocked", "no password set"},
+	})
+}
+
+func (s *errorsSuite) TestRetryableError(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterHook("start", func() error {
+		return errgo.Mask(&hook.RetryableError{
+			Err: errgo.New("database not ready"),
+		}, errgo.Any)
+	})
+	err := hook.Main(r, newErrorsContext("start", &recordingRunner{}), memState{})
+	c.Assert(err, gc.ErrorMatches, `hook start \(registry root\): database not ready`)
+	c.Assert(hook.ExitCode(err), gc.Equals, hook.ExitRetry)
+
+	c.Assert(hook.ExitCode(nil), gc.Equals, 0)
+	c.Assert(hook.ExitCode(errgo.New("other")), gc.Equals, 1)
+}
+
+func (s *errorsSuite) TestRetryableErrorRescheduleWithoutUpdateStatus(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterHook("start", func() error {
+		return &hook.RetryableError{
+			Err:        errgo.New("database not ready"),
+			Reschedule: true,
+		}
+	})
+	err := hook.Main(r, newErrorsContext("start", &recordingRunner{}), memState{})
+	c.Assert(err, gc.ErrorMatches, `hook start \(registry root\): database not ready`)
+	c.Assert(hook.ExitCode(err), gc.Equals, hook.ExitRetry)
+}
+
+func (s *errorsSuite) TestRetryableErrorReschedule(c *gc.C) {
+	r := hook.NewRegistry()
+	ready := false
+	var ran []string
+	r.RegisterHook("start", func() error {
+		ran = append(ran, "start")
+		if !ready {
+			return &hook.RetryableError{
+				Err:        errgo.New("database not ready"),
+				Reschedule: true,
+			}
+		}
+		return nil
+	})
+	r.RegisterHook("update-status", func() error {
+		ran = append(ran, "update-status")
+		return nil
+	})
+	r.RegisterHook("*", func() error {
+		ran = append(ran, "*")
+		return nil
+	})
+	state := memState{}
+	runner := &recordingRunner{}
+	err := hook.Main(r, newErrorsContext("start", runner), state)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ran, jc.DeepEquals, []string{"start"})
+	c.Assert(statusCalls(runner), jc.DeepEquals, [][]string{
+		{"status-set", "waiting", "database not ready"},
+	})
+
+	// The hook is retried in update-status, and
+	// rescheduled again when it fails.
+	ran = nil
+	err = hook.Main(r, newErrorsContext("update-status", &recordingRunner{}), state)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ran, jc.DeepEquals, []string{"update-status", "start"})
+
+	// When the hook succeeds, it is not run again.
+	ready = true
+	ran = nil
+	err = hook.Main(r, newErrorsContext("update-status", &recordingRunner{}), state)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ran, jc.DeepEquals, []string{"update-status", "start", "*"})
+
+	ran = nil
+	err = hook.Main(r, newErrorsContext("update-status", &recordingRunner{}), state)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ran, jc.DeepEquals, []string{"update-status", "*"})
+}
+
+func newErrorsContext(hookName string, runner hook.ToolRunner) *hook.Context {
+	return &hook.Context{
+		UUID:     "fff",
+		Unit:     "foo/0",
+		HookName: hookName,
+		Runner:   runner,
+	}
+}
+
+func statusCalls(runner *recordingRunner) [][]string {
+	var calls [][]string
+	for _, rec := range runner.record {
+		if rec[0] == "status-set" {
+			calls = append(calls, rec)
+		}
+	}
+	return calls
+}
@@ -1,5 +1,10 @@
 package hook
 
+import (
+	"io"
+	"time"
+)
+
 var HookStateDir = &hookStateDir
 
 var (
@@ -9,6 +14,55 @@ var (
 	ValidHookName          = validHookName
 	ExecHookTools          = &execHookTools
 	JujucSymlinks          = &jujucSymlinks
+	RunAptCommand          = &runAptCommand
+	AptAttempt             = &aptAttempt
+	AptSourcesDir          = &aptSourcesDir
+	RunSystemCommand       = &runSystemCommand
+	PasswdFile             = &passwdFile
+	GroupFile              = &groupFile
+	SudoersDir             = &sudoersDir
+	FetchAttempt           = &fetchAttempt
+	NoProxy                = noProxy
+	HookArgs               = hookArgs
+	LookPath               = &lookPath
+	KillWait               = &killWait
+	RunMainWithOutput      = runMain
+
+	NewToolRunnerFromEnvironment = newToolRunnerFromEnvironment
+	ConfigureDefaultTransport    = configureDefaultTransport
 )
 
+// ResetAptState forgets all cached apt state.
+func ResetAptState() {
+	aptState.installed = make(map[string]bool)
+	aptState.repositories = make(map[string]bool)
+	aptState.indexStale = false
+}
+
 type JujucRequest jujucRequest
+
+// SetSleep sets the function used to wait between retries
+// and returns a function that restores the original.
+func SetSleep(f func(time.Duration)) (restore func()) {
+	old := sleep
+	sleep = f
+	return func() {
+		sleep = old
+	}
+}
+
+var NewBuild = newBuild
+
+var PruneTraces = pruneTraces
+
+// ShellServe runs the shell on rw.
+func ShellServe(r *Registry, ctxt *Context, rw io.ReadWriter, interactive bool) error {
+	s := &shell{r: r, ctxt: ctxt}
+	return s.serve(rw, interactive)
+}
+
+// ShellComplete returns the shell's completion of the given line.
+func ShellComplete(r *Registry, ctxt *Context, line string) (string, []string) {
+	s := &shell{r: r, ctxt: ctxt}
+	return s.complete(line)
+}
@@ -0,0 +1,395 @@
+package hook
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/utils"
+	"gopkg.in/errgo.v1"
+)
+
+// fetchAttempt governs how often Fetch retries a download
+// that fails because of a network or server error.
+var fetchAttempt = utils.AttemptStrategy{
+	Total: 5 * time.Minute,
+	Delay: 5 * time.Second,
+	Min:   3,
+}
+
+// fetchClient holds the client used by Fetch. It is a variable
+// so that it can be replaced for testing.
+var fetchClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: proxyFromEnvironment,
+	},
+}
+
+// Fetch downloads the file at the given URL into destDir, which is
+// created if necessary, and checks that its SHA-256 checksum matches
+// sha256sum, which should be hex-encoded.
+//
+// If the URL names a .tar.gz, .tgz, .tar or .zip archive, the archive
+// is extracted into destDir; otherwise the file is written to destDir
+// with the last element of the URL path as its name. Fetch records the
+// checksum of what it has fetched in destDir, so calling it again
+// with the same checksum does nothing.
+//
+// If the download fails part way through or the server responds with
+// a 5xx status, it is retried for a while, resuming from where it
+// stopped if the server allows it. Other responses, such as 404 Not
+// Found, cause Fetch to fail immediately. The proxy settings returned
+// by Context.ProxySettings are honored.
+func Fetch(rawURL, sha256sum, destDir string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errgo.Notef(err, "cannot parse URL")
+	}
+	name := path.Base(u.Path)
+	if name == "" || name == "." || name == "/" {
+		return errgo.Newf("cannot determine file name from %q", rawURL)
+	}
+	sha256sum = strings.ToLower(sha256sum)
+	if len(sha256sum) != 2*sha256.Size {
+		return errgo.Newf("invalid SHA-256 checksum %q", sha256sum)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return errgo.Mask(err)
+	}
+	marker := filepath.Join(destDir, "."+name+".sha256")
+	if data, err := ioutil.ReadFile(marker); err == nil && strings.TrimSpace(string(data)) == sha256sum {
+		return nil
+	}
+	part := filepath.Join(destDir, "."+name+".part")
+	for a := fetchAttempt.Start(); a.Next(); {
+		err = download(rawURL, part)
+		if err == nil || !retryable(err) {
+			break
+		}
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot download %s", rawURL)
+	}
+	defer os.Remove(part)
+	sum, err := fileSHA256(part)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if sum != sha256sum {
+		return errgo.Newf("checksum mismatch for %s: got %s, want %s", rawURL, sum, sha256sum)
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		err = extractTar(part, destDir, true)
+	case strings.HasSuffix(name, ".tar"):
+		err = extractTar(part, destDir, false)
+	case strings.HasSuffix(name, ".zip"):
+		err = extractZip(part, destDir)
+	default:
+		err = os.Rename(part, filepath.Join(destDir, name))
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot extract %s", name)
+	}
+	if err := ioutil.WriteFile(marker, []byte(sha256sum+"\n"), 0644); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// statusError is the error returned by download when
+// the server responds with an unexpected status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response status %q", e.status)
+}
+
+// networkError is the error returned by download when
+// the request fails or the response body cannot be read.
+type networkError struct {
+	error
+}
+
+// networkReader wraps a response body so that errors
+// reading it can be told apart from errors writing
+// the downloaded file.
+type networkReader struct {
+	r io.Reader
+}
+
+func (r networkReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if err != nil && err != io.EOF {
+		err = &networkError{err}
+	}
+	return n, err
+}
+
+// retryable reports whether the given error from download
+// might go away if the download is tried again. Network errors
+// and server errors might; client errors such as 404 Not Found
+// and errors writing the local file will not.
+func retryable(err error) bool {
+	switch err := errgo.Cause(err).(type) {
+	case *networkError:
+		return true
+	case *statusError:
+		return err.code >= 500
+	}
+	return false
+}
+
+// download downloads the given URL to the given file. If the file
+// already holds the start of the download, only the rest is
+// requested.
+func download(rawURL, file string) error {
+	var offset int64
+	if info, err := os.Stat(file); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return errgo.Mask(&networkError{err}, errgo.Any)
+	}
+	defer resp.Body.Close()
+	flags := os.O_WRONLY | os.O_CREATE
+	switch resp.StatusCode {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// We already have the whole file.
+		return nil
+	default:
+		return errgo.Mask(&statusError{
+			code:   resp.StatusCode,
+			status: resp.Status,
+		}, errgo.Any)
+	}
+	f, err := os.OpenFile(file, flags, 0644)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	_, err = io.Copy(f, networkReader{resp.Body})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	return nil
+}
+
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// extractPath returns the path in destDir that the archive entry
+// with the given name should be extracted to, or an error if
+// the entry would be outside destDir.
+func extractPath(destDir, name string) (string, error) {
+	p := filepath.Join(destDir, name)
+	if !isWithin(destDir, p) {
+		return "", errgo.Newf("archive entry %q is outside the destination directory", name)
+	}
+	return p, nil
+}
+
+// isWithin reports whether the path p is dir or is inside it.
+// It does not follow symbolic links.
+func isWithin(dir, p string) bool {
+	dir = filepath.Clean(dir)
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// resolveDir returns the absolute path of dir with any symbolic
+// links followed. Elements of dir that do not exist yet are
+// left as they are, because they will be created as real
+// directories.
+func resolveDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", errgo.Mask(err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errgo.Mask(err)
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+}
+
+// checkTarEntry checks that extracting the tar entry with the given
+// header to the path p cannot write outside root, the resolved
+// destination directory, by following a symbolic link that was
+// extracted earlier, and that a symbolic link entry points inside
+// root.
+func checkTarEntry(root, p string, hdr *tar.Header) error {
+	parent, err := resolveDir(filepath.Dir(p))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if !isWithin(root, parent) {
+		return errgo.Newf("archive entry %q is outside the destination directory", hdr.Name)
+	}
+	if hdr.Typeflag != tar.TypeSymlink {
+		return nil
+	}
+	if filepath.IsAbs(hdr.Linkname) || !isWithin(root, filepath.Join(parent, hdr.Linkname)) {
+		return errgo.Newf("archive entry %q links to %q outside the destination directory", hdr.Name, hdr.Linkname)
+	}
+	return nil
+}
+
+func extractTar(file, destDir string, gzipped bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gzipped {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	root, err := resolveDir(destDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		p, err := extractPath(destDir, hdr.Name)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if err := checkTarEntry(root, p, hdr); err != nil {
+			return errgo.Mask(err)
+		}
+		mode := hdr.FileInfo().Mode()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, mode.Perm()|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			// Replace rather than write through any symbolic
+			// link already at p.
+			if info, lerr := os.Lstat(p); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+				os.Remove(p)
+			}
+			err = writeExtracted(p, tr, mode.Perm())
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(p), 0755); err == nil {
+				os.Remove(p)
+				err = os.Symlink(hdr.Linkname, p)
+			}
+		default:
+			// Ignore hard links, devices and the like,
+			// which release tarballs rarely contain.
+		}
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+}
+
+func extractZip(file, destDir string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		p, err := extractPath(destDir, zf.Name)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		mode := zf.Mode()
+		if mode.IsDir() {
+			if err := os.MkdirAll(p, mode.Perm()|0700); err != nil {
+				return errgo.Mask(err)
+			}
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		err = writeExtracted(p, r, mode.Perm())
+		r.Close()
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// writeExtracted writes the contents of r to the given
+// path with the given permissions, creating any
+// missing parent directories.
+func writeExtracted(p string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
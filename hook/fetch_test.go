@@ -0,0 +1,264 @@
+package hook_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type fetchSuite struct {
+	savedFetchAttempt utils.AttemptStrategy
+	files             map[string][]byte
+	failures          map[string]int
+	requests          []string
+	srv               *httptest.Server
+}
+
+var _ = gc.Suite(&fetchSuite{})
+
+func (s *fetchSuite) SetUpTest(c *gc.C) {
+	s.savedFetchAttempt = *hook.FetchAttempt
+	*hook.FetchAttempt = utils.AttemptStrategy{Min: 2}
+	s.files = make(map[string][]byte)
+	s.failures = make(map[string]int)
+	s.requests = nil
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.requests = append(s.requests, req.URL.Path+" "+req.Header.Get("Range"))
+		if s.failures[req.URL.Path] > 0 {
+			s.failures[req.URL.Path]--
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		data, ok := s.files[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		http.ServeContent(w, req, req.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func (s *fetchSuite) TearDownTest(c *gc.C) {
+	s.srv.Close()
+	*hook.FetchAttempt = s.savedFetchAttempt
+}
+
+func sha256hex(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+func (s *fetchSuite) TestFetchFile(c *gc.C) {
+	data := []byte("some binary")
+	s.files["/releases/tool"] = data
+	dir := filepath.Join(c.MkDir(), "dest")
+	err := hook.Fetch(s.srv.URL+"/releases/tool", sha256hex(data), dir)
+	c.Assert(err, gc.IsNil)
+	got, err := ioutil.ReadFile(filepath.Join(dir, "tool"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(got), gc.Equals, "some binary")
+	c.Assert(s.requests, gc.HasLen, 1)
+
+	// Fetching again does nothing.
+	err = hook.Fetch(s.srv.URL+"/releases/tool", sha256hex(data), dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.requests, gc.HasLen, 1)
+}
+
+func (s *fetchSuite) TestFetchResume(c *gc.C) {
+	data := []byte("0123456789")
+	s.files["/tool"] = data
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, ".tool.part"), data[0:4], 0644)
+	c.Assert(err, gc.IsNil)
+	err = hook.Fetch(s.srv.URL+"/tool", sha256hex(data), dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.requests, jc.DeepEquals, []string{"/tool bytes=4-"})
+	got, err := ioutil.ReadFile(filepath.Join(dir, "tool"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(got), gc.Equals, "0123456789")
+	_, err = os.Stat(filepath.Join(dir, ".tool.part"))
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *fetchSuite) TestFetchChecksumMismatch(c *gc.C) {
+	s.files["/tool"] = []byte("tampered")
+	dir := c.MkDir()
+	err := hook.Fetch(s.srv.URL+"/tool", sha256hex([]byte("original")), dir)
+	c.Assert(err, gc.ErrorMatches, `checksum mismatch for .*/tool: got [0-9a-f]+, want [0-9a-f]+`)
+	entries, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 0)
+}
+
+func (s *fetchSuite) TestFetchErrors(c *gc.C) {
+	dir := c.MkDir()
+	err := hook.Fetch(s.srv.URL+"/missing", strings.Repeat("0", 64), dir)
+	c.Assert(err, gc.ErrorMatches, `cannot download .*/missing: unexpected response status "404 Not Found"`)
+	// Client errors are not retried.
+	c.Assert(s.requests, gc.HasLen, 1)
+
+	s.requests = nil
+	s.failures["/down"] = 5
+	err = hook.Fetch(s.srv.URL+"/down", strings.Repeat("0", 64), dir)
+	c.Assert(err, gc.ErrorMatches, `cannot download .*/down: unexpected response status "503 Service Unavailable"`)
+	c.Assert(s.requests, gc.HasLen, 2)
+
+	err = hook.Fetch(s.srv.URL+"/tool", "1234", dir)
+	c.Assert(err, gc.ErrorMatches, `invalid SHA-256 checksum "1234"`)
+}
+
+func (s *fetchSuite) TestFetchTarGz(c *gc.C) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	writeTarEntry(c, tw, &tar.Header{Name: "tool-1.0/", Typeflag: tar.TypeDir, Mode: 0755}, "")
+	writeTarEntry(c, tw, &tar.Header{Name: "tool-1.0/bin/tool", Typeflag: tar.TypeReg, Mode: 0755}, "#!/bin/sh\n")
+	writeTarEntry(c, tw, &tar.Header{Name: "tool-1.0/current", Typeflag: tar.TypeSymlink, Linkname: "bin/tool"}, "")
+	c.Assert(tw.Close(), gc.IsNil)
+	c.Assert(zw.Close(), gc.IsNil)
+	s.files["/tool-1.0.tar.gz"] = buf.Bytes()
+
+	dir := c.MkDir()
+	err := hook.Fetch(s.srv.URL+"/tool-1.0.tar.gz", sha256hex(buf.Bytes()), dir)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(dir, "tool-1.0/bin/tool"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0755))
+	target, err := os.Readlink(filepath.Join(dir, "tool-1.0/current"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(target, gc.Equals, "bin/tool")
+	_, err = os.Stat(filepath.Join(dir, "tool-1.0.tar.gz"))
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *fetchSuite) TestFetchTarOutsideDest(c *gc.C) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	writeTarEntry(c, tw, &tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}, "x")
+	c.Assert(tw.Close(), gc.IsNil)
+	s.files["/evil.tar"] = buf.Bytes()
+
+	dir := filepath.Join(c.MkDir(), "dest")
+	err := hook.Fetch(s.srv.URL+"/evil.tar", sha256hex(buf.Bytes()), dir)
+	c.Assert(err, gc.ErrorMatches, `cannot extract evil.tar: archive entry "../evil" is outside the destination directory`)
+	_, err = os.Stat(filepath.Join(dir, "..", "evil"))
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *fetchSuite) TestFetchRetriesServerErrors(c *gc.C) {
+	data := []byte("some binary")
+	s.files["/tool"] = data
+	s.failures["/tool"] = 1
+	dir := c.MkDir()
+	err := hook.Fetch(s.srv.URL+"/tool", sha256hex(data), dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.requests, gc.HasLen, 2)
+	got, err := ioutil.ReadFile(filepath.Join(dir, "tool"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(got), gc.Equals, "some binary")
+}
+
+var fetchTarSymlinkTests = []struct {
+	about       string
+	entries     []*tar.Header
+	expectError string
+}{{
+	about: "absolute link",
+	entries: []*tar.Header{
+		{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+	},
+	expectError: `archive entry "etc" links to "/etc" outside the destination directory`,
+}, {
+	about: "relative link out of the destination",
+	entries: []*tar.Header{
+		{Name: "dir/out", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+		{Name: "dir/out/evil", Typeflag: tar.TypeReg, Mode: 0644},
+	},
+	expectError: `archive entry "dir/out" links to "../../outside" outside the destination directory`,
+}, {
+	about: "link that escapes through an earlier link",
+	entries: []*tar.Header{
+		{Name: "dir/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "dir/up/out", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+		{Name: "dir/up/out/evil", Typeflag: tar.TypeReg, Mode: 0644},
+	},
+	expectError: `archive entry "dir/up/out" links to "../outside" outside the destination directory`,
+}, {
+	about: "file written through an existing link",
+	entries: []*tar.Header{
+		{Name: "existing/evil", Typeflag: tar.TypeReg, Mode: 0644},
+	},
+	expectError: `archive entry "existing/evil" is outside the destination directory`,
+}}
+
+func (s *fetchSuite) TestFetchTarSymlinkOutsideDest(c *gc.C) {
+	for i, test := range fetchTarSymlinkTests {
+		c.Logf("test %d: %s", i, test.about)
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range test.entries {
+			writeTarEntry(c, tw, hdr, "")
+		}
+		c.Assert(tw.Close(), gc.IsNil)
+		name := fmt.Sprintf("/evil%d.tar", i)
+		s.files[name] = buf.Bytes()
+
+		base := c.MkDir()
+		outside := filepath.Join(base, "outside")
+		err := os.Mkdir(outside, 0755)
+		c.Assert(err, gc.IsNil)
+		dir := filepath.Join(base, "dest")
+		err = os.Mkdir(dir, 0755)
+		c.Assert(err, gc.IsNil)
+		err = os.Symlink(outside, filepath.Join(dir, "existing"))
+		c.Assert(err, gc.IsNil)
+
+		err = hook.Fetch(s.srv.URL+name, sha256hex(buf.Bytes()), dir)
+		c.Assert(err, gc.ErrorMatches, `cannot extract evil[0-9]+.tar: `+test.expectError)
+		entries, err := ioutil.ReadDir(outside)
+		c.Assert(err, gc.IsNil)
+		c.Assert(entries, gc.HasLen, 0)
+	}
+}
+
+func (s *fetchSuite) TestFetchZip(c *gc.C) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("tool/README")
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write([]byte("read me"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(zw.Close(), gc.IsNil)
+	s.files["/tool.zip"] = buf.Bytes()
+
+	dir := c.MkDir()
+	err = hook.Fetch(s.srv.URL+"/tool.zip", sha256hex(buf.Bytes()), dir)
+	c.Assert(err, gc.IsNil)
+	got, err := ioutil.ReadFile(filepath.Join(dir, "tool/README"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(got), gc.Equals, "read me")
+}
+
+func writeTarEntry(c *gc.C, tw *tar.Writer, hdr *tar.Header, data string) {
+	hdr.Size = int64(len(data))
+	err := tw.WriteHeader(hdr)
+	c.Assert(err, gc.IsNil)
+	_, err = tw.Write([]byte(data))
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,87 @@
+package hook
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// GoalState holds the state that Juju is working towards for the
+// local unit's service, as returned by Context.GoalState.
+type GoalState struct {
+	// Units holds the status of each unit that the service
+	// is expected to have, including the local unit.
+	Units map[UnitId]GoalStatus `json:"units"`
+
+	// Relations holds, for each relation name, the status of
+	// each remote service and unit expected to take part in the
+	// relation, keyed by service name or unit id.
+	Relations map[string]map[string]GoalStatus `json:"relations"`
+}
+
+// GoalStatus holds the status of a unit or service in a GoalState.
+type GoalStatus struct {
+	// Status holds the status, for example "waiting",
+	// "joining", "joined", "active" or "dying".
+	Status string `json:"status"`
+
+	// Since holds the time that the status was last
+	// changed, as formatted by Juju.
+	Since string `json:"since,omitempty"`
+}
+
+// GoalState returns the state that Juju is working towards for the
+// local unit's service, which can be used, for example, to wait for
+// all the expected peer units to join before bootstrapping a
+// cluster.
+//
+// If the Juju agent does not implement the goal-state hook tool
+// (versions before 2.4), the returned error will have an
+// ErrUnimplemented cause.
+func (ctxt *Context) GoalState() (*GoalState, error) {
+	var gs GoalState
+	if err := ctxt.runJSON(&gs, "goal-state", "--format", "json"); err != nil {
+		return nil, errgo.NoteMask(err, "cannot get goal state", errgo.Is(ErrUnimplemented))
+	}
+	return &gs, nil
+}
+
+// ServiceUnits returns the units that the service is expected to
+// have, including the local unit and excluding any that are dying,
+// sorted by unit id.
+func (gs *GoalState) ServiceUnits() []UnitId {
+	return liveUnits(gs.Units)
+}
+
+// RelationUnits returns the remote units expected to take part
+// in the relation with the given name, excluding any that are
+// dying, sorted by unit id.
+func (gs *GoalState) RelationUnits(relationName string) []UnitId {
+	units := make(map[UnitId]GoalStatus)
+	for name, st := range gs.Relations[relationName] {
+		// The entries for whole services are
+		// distinguished by having no unit number.
+		if strings.Contains(name, "/") {
+			units[UnitId(name)] = st
+		}
+	}
+	return liveUnits(units)
+}
+
+// liveUnits returns the units in the given map that
+// are not dying or dead, sorted by unit id.
+func liveUnits(m map[UnitId]GoalStatus) []UnitId {
+	ids := make([]string, 0, len(m))
+	for unit, st := range m {
+		if st.Status != "dying" && st.Status != "dead" {
+			ids = append(ids, string(unit))
+		}
+	}
+	sort.Strings(ids)
+	units := make([]UnitId, len(ids))
+	for i, id := range ids {
+		units[i] = UnitId(id)
+	}
+	return units
+}
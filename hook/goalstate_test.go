@@ -0,0 +1,47 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type goalStateSuite struct{}
+
+var _ = gc.Suite(&goalStateSuite{})
+
+func (*goalStateSuite) TestGoalState(c *gc.C) {
+	gs := &hook.GoalState{
+		Units: map[hook.UnitId]hook.GoalStatus{
+			"someunit/0": {Status: "active", Since: "2018-05-14 06:37:05Z"},
+			"someunit/2": {Status: "waiting"},
+			"someunit/1": {Status: "active"},
+			"someunit/3": {Status: "dying"},
+		},
+		Relations: map[string]map[string]hook.GoalStatus{
+			"db": {
+				"mysql":   {Status: "joined"},
+				"mysql/0": {Status: "joined"},
+				"mysql/1": {Status: "dead"},
+			},
+		},
+	}
+	t := hook.NewTestContext(hook.TestContextParams{
+		GoalState: gs,
+	})
+	got, err := t.GoalState()
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, jc.DeepEquals, gs)
+	c.Assert(got.ServiceUnits(), jc.DeepEquals, []hook.UnitId{"someunit/0", "someunit/1", "someunit/2"})
+	c.Assert(got.RelationUnits("db"), jc.DeepEquals, []hook.UnitId{"mysql/0"})
+	c.Assert(got.RelationUnits("other"), gc.HasLen, 0)
+}
+
+func (*goalStateSuite) TestGoalStateUnimplemented(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	_, err := t.GoalState()
+	c.Assert(err, gc.ErrorMatches, `cannot get goal state: .*unknown command "goal-state"`)
+	c.Assert(errgo.Cause(err), gc.Equals, hook.ErrUnimplemented)
+}
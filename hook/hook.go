@@ -38,7 +38,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/juju/names"
 	"gopkg.in/errgo.v1"
@@ -73,11 +76,25 @@ type Context struct {
 	Unit UnitId
 
 	// CharmDir holds the directory that the charm is running from.
+	// See also EnsureCharmDir.
 	CharmDir string
 
 	// HookName holds the name of the currently running hook.
 	HookName string
 
+	// AgentVersion holds the version of the Juju agent that is
+	// running the hook, if known. See also Context.JujuVersion.
+	AgentVersion string
+
+	// Kubernetes records whether the unit is running in a
+	// Kubernetes pod rather than on a machine.
+	// See also Context.IsMachineCharm.
+	Kubernetes bool
+
+	// Environ holds the environment that Juju provided
+	// to the hook.
+	Environ Environ
+
 	// Relations holds all the relation data available to the charm.
 	// For each relation id, it holds all the units that have joined
 	// that relation, and within that, all the relation settings for
@@ -122,6 +139,55 @@ type Context struct {
 	// RunCommandArgs holds any arguments that were passed to
 	// the above command.
 	RunCommandArgs []string
+
+	// shell is set when the runhook executable is run as
+	// "runhook shell", in which case Main runs an interactive
+	// shell instead of the hook functions.
+	shell bool
+
+	// done is closed when the hook's deadline has passed.
+	// It is nil if the hook has no deadline.
+	done <-chan struct{}
+
+	// deadline holds the hook's deadline, if done is non-nil.
+	deadline time.Time
+
+	// removeState is set when the teardown functions have
+	// all succeeded, so that the local state is removed
+	// instead of being saved when the hook completes.
+	removeState bool
+
+	// departed holds the units that have departed each relation
+	// since the last hook ran. See DepartedUnits.
+	departed map[RelationId]map[UnitId]map[string]string
+
+	// seen holds the remote units, with their settings,
+	// that were in each relation when a hook last completed
+	// successfully. See RelationChanges.
+	seen map[RelationId]map[UnitId]map[string]string
+
+	// prevConfig holds the configuration seen by the last
+	// successful config-changed hook. See PreviousConfig.
+	prevConfig map[string]interface{}
+
+	// cache holds values cached for the duration of the hook.
+	// It is shared by all contexts derived from the same
+	// original context.
+	cache *hookCache
+}
+
+// hookCache holds values that are cached for the
+// duration of a single hook execution.
+type hookCache struct {
+	mu sync.Mutex
+
+	// output maps from a hook tool command line
+	// to its output. See cachedRunJSON.
+	output map[string][]byte
+
+	// resources maps from resource name to the
+	// path returned by resource-get.
+	resources map[string]string
 }
 
 // Relation holds the current relation settings for the unit
@@ -145,11 +211,39 @@ func (ctxt *Context) Close() error {
 // withRegistryName returns a Context that's the same as
 // ctxt but is associated with the registry with the given name.
 func (ctxt *Context) withRegistryName(registryName string) *Context {
+	// Make sure that the cache exists before copying
+	// the context so that it's shared.
+	ctxt.hookCache()
 	ctxt1 := *ctxt
 	ctxt1.registryName = registryName
 	return &ctxt1
 }
 
+// Done returns a channel that is closed when the hook's deadline (see
+// Registry.RegisterTimeout) has passed. Long-running hook functions
+// can use it to stop work cleanly, saving any partial progress in
+// their local state so that it can be resumed when the hook is next
+// run. If there is no deadline, Done returns nil, which blocks
+// forever when received from.
+func (ctxt *Context) Done() <-chan struct{} {
+	return ctxt.done
+}
+
+// Deadline returns the time at which the hook's deadline will
+// pass. The ok result is false if there is no deadline.
+func (ctxt *Context) Deadline() (deadline time.Time, ok bool) {
+	return ctxt.deadline, ctxt.done != nil
+}
+
+// hookCache returns the cache associated with the context,
+// creating it if necessary.
+func (ctxt *Context) hookCache() *hookCache {
+	if ctxt.cache == nil {
+		ctxt.cache = new(hookCache)
+	}
+	return ctxt.cache
+}
+
 // hookStateDir is where hook local state will be stored.
 // TODO would /etc/init be a better place for this?
 var hookStateDir = "/var/lib/juju-localstate"
@@ -157,9 +251,15 @@ var hookStateDir = "/var/lib/juju-localstate"
 // StateDir returns the path to the directory where local state for the
 // given context will be stored. The directory is relative to the
 // registry through which the context was created. It is not guaranteed
-// to exist.
+// to exist; see EnsureStateDir.
 func (ctxt *Context) StateDir() string {
-	return filepath.Join(hookStateDir, ctxt.UUID+"-"+ctxt.UnitTag(), ctxt.registryName)
+	return filepath.Join(ctxt.unitStateDir(), ctxt.registryName)
+}
+
+// unitStateDir returns the directory holding all the
+// local state for the unit.
+func (ctxt *Context) unitStateDir() string {
+	return filepath.Join(hookStateDir, ctxt.UUID+"-"+ctxt.UnitTag())
 }
 
 // CommandName returns a value that can be used to make runhook run the
@@ -171,6 +271,12 @@ func (ctxt *Context) CommandName() string {
 	return "cmd-" + ctxt.registryName
 }
 
+// BinaryPath returns the path of the executable with the
+// given name, registered with Registry.RegisterBinary.
+func (ctxt *Context) BinaryPath(name string) string {
+	return filepath.Join(ctxt.CharmDir, "bin", name)
+}
+
 // IsRelationHook reports whether the current hook is executing
 // as a result of a relation change. If it returns true, then
 // ctxt.RelationName, ctxt.RelationId and possibly ctxt.RemoteUnit
@@ -188,15 +294,13 @@ func (ctxt *Context) UnitTag() string {
 // OpenPort opens the given port using the given protocol ("tcp" or "udp").
 // It if the port is already open, this is a no-op.
 func (ctxt *Context) OpenPort(proto string, port int) error {
-	_, err := ctxt.Runner.Run("open-port", fmt.Sprintf("%d/%s", port, proto))
-	return errgo.Mask(err)
+	return ctxt.OpenPortRange(proto, port, port)
 }
 
 // ClosePort closes the given port associated with the given protocol.
 // If the port is already closed, this is a no-op.
 func (ctxt *Context) ClosePort(proto string, port int) error {
-	_, err := ctxt.Runner.Run("close-port", fmt.Sprintf("%d/%s", port, proto))
-	return errgo.Mask(err)
+	return ctxt.ClosePortRange(proto, port, port)
 }
 
 // PublicAddress returns the public address of the local unit.
@@ -217,17 +321,124 @@ func (ctxt *Context) PrivateAddress() (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
-// Log logs a message through the juju logging facility.
-func (ctxt *Context) Logf(f string, a ...interface{}) error {
-	_, err := ctxt.Runner.Run("juju-log", fmt.Sprintf(f, a...))
+// NetworkInfo holds information about the network configuration
+// of the local unit for a particular binding, as returned by
+// Context.NetworkGet.
+type NetworkInfo struct {
+	// BindAddresses holds the addresses, grouped by network
+	// interface, that a service should bind to in order to
+	// serve on the binding's network.
+	BindAddresses []BindAddress `json:"bind-addresses"`
+
+	// IngressAddresses holds the addresses that remote units
+	// should use to connect to the local unit.
+	IngressAddresses []string `json:"ingress-addresses"`
+
+	// EgressSubnets holds the subnets (in CIDR notation) that
+	// connections from the local unit will originate from.
+	EgressSubnets []string `json:"egress-subnets"`
+}
+
+// BindAddress holds the addresses on a single network interface.
+type BindAddress struct {
+	MACAddress    string             `json:"macaddress"`
+	InterfaceName string             `json:"interfacename"`
+	Addresses     []InterfaceAddress `json:"addresses"`
+}
+
+// InterfaceAddress holds a single address on a network interface.
+type InterfaceAddress struct {
+	Address string `json:"address"`
+	CIDR    string `json:"cidr"`
+}
+
+// BindAddress returns the first address that a service should bind to,
+// or the empty string if there is none.
+func (info *NetworkInfo) BindAddress() string {
+	for _, b := range info.BindAddresses {
+		for _, addr := range b.Addresses {
+			if addr.Address != "" {
+				return addr.Address
+			}
+		}
+	}
+	return ""
+}
+
+// IngressAddress returns the address most suitable for remote
+// units to connect to, or the empty string if there is none.
+func (info *NetworkInfo) IngressAddress() string {
+	if len(info.IngressAddresses) == 0 {
+		return ""
+	}
+	return info.IngressAddresses[0]
+}
+
+// NetworkGet returns the network configuration of the local unit for
+// the given binding name, which is usually the name of a relation.
+//
+// If the Juju agent does not support network-get, the
+// private address of the unit is returned as both the bind
+// and the ingress address.
+func (ctxt *Context) NetworkGet(bindingName string) (*NetworkInfo, error) {
+	var info NetworkInfo
+	err := ctxt.runJSON(&info, "network-get", "--format", "json", "--", bindingName)
+	if err == nil {
+		return &info, nil
+	}
+	if errgo.Cause(err) != ErrUnimplemented {
+		return nil, errgo.Notef(err, "cannot get network information for %q", bindingName)
+	}
+	addr, err := ctxt.PrivateAddress()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return &NetworkInfo{
+		BindAddresses: []BindAddress{{
+			Addresses: []InterfaceAddress{{
+				Address: addr,
+			}},
+		}},
+		IngressAddresses: []string{addr},
+	}, nil
+}
+
+// AddMetric records a value for the metric with the given name.
+// The metric must have been declared, either in the charm's
+// metrics.yaml file or with Registry.RegisterMetric. Juju
+// only allows metrics to be added in the collect-metrics hook;
+// it records the time at which the value was added.
+func (ctxt *Context) AddMetric(key, value string) error {
+	_, err := ctxt.Runner.Run("add-metric", key+"="+value)
+	return errgo.Mask(err)
+}
+
+// Reboot requests that the machine hosting the local unit be
+// rebooted. If now is false, the reboot will happen when the
+// current hook has completed. If now is true, the hook is killed
+// immediately and the machine rebooted; the hook will be run again
+// when the machine has come back up, so it must be prepared for that.
+func (ctxt *Context) Reboot(now bool) error {
+	var args []string
+	if now {
+		args = append(args, "--now")
+	}
+	_, err := ctxt.Runner.Run("juju-reboot", args...)
 	return errgo.Mask(err)
 }
 
+// Logf logs a message through the juju logging facility
+// at the default level (INFO). See also Debugf, Infof, Warningf
+// and Errorf.
+func (ctxt *Context) Logf(f string, a ...interface{}) error {
+	return ctxt.log("", "", fmt.Sprintf(f, a...))
+}
+
 // getAllRelationUnit returns all the settings from the given unit associated
 // with the relation with the given id.
 func (ctxt *Context) getAllRelationUnit(relationId RelationId, unit UnitId) (map[string]string, error) {
 	var val map[string]string
-	if err := ctxt.runJSON(&val, "relation-get", "-r", string(relationId), "--format", "json", "--", "-", string(unit)); err != nil {
+	if err := ctxt.cachedRunJSON(&val, "relation-get", "-r", string(relationId), "--format", "json", "--", "-", string(unit)); err != nil {
 		return nil, errgo.Mask(err)
 	}
 	return val, nil
@@ -237,7 +448,7 @@ func (ctxt *Context) getAllRelationUnit(relationId RelationId, unit UnitId) (map
 // with the relation with the given name.
 func (ctxt *Context) relationIds(relationName string) ([]RelationId, error) {
 	var val []RelationId
-	if err := ctxt.runJSON(&val, "relation-ids", "--format", "json", "--", relationName); err != nil {
+	if err := ctxt.cachedRunJSON(&val, "relation-ids", "--format", "json", "--", relationName); err != nil {
 		return nil, errgo.Mask(err)
 	}
 	return val, nil
@@ -246,13 +457,17 @@ func (ctxt *Context) relationIds(relationName string) ([]RelationId, error) {
 // relationUnits returns all the units associated with the given relation id.
 func (ctxt *Context) relationUnits(relationId RelationId) ([]UnitId, error) {
 	var val []UnitId
-	if err := ctxt.runJSON(&val, "relation-list", "--format", "json", "-r", string(relationId)); err != nil {
+	if err := ctxt.cachedRunJSON(&val, "relation-list", "--format", "json", "-r", string(relationId)); err != nil {
 		return nil, errgo.Mask(err)
 	}
 	return val, nil
 }
 
 // SetRelation sets the given key-value pairs on the current relation instance.
+//
+// All values are set verbatim. To set values of other types, use
+// SetRelationValues rather than formatting them by hand, so that
+// they can be read back reliably with GetRelationValue.
 func (ctxt *Context) SetRelation(keyvals ...string) error {
 	err := ctxt.SetRelationWithId(ctxt.RelationId, keyvals...)
 	return errgo.Mask(err)
@@ -276,14 +491,87 @@ func (ctxt *Context) SetRelationWithId(relationId RelationId, keyvals ...string)
 	return errgo.Mask(err)
 }
 
+// SetRelationValues sets the given values on the current relation
+// instance. See SetRelationValuesWithId.
+func (ctxt *Context) SetRelationValues(vals map[string]interface{}) error {
+	return errgo.Mask(ctxt.SetRelationValuesWithId(ctxt.RelationId, vals))
+}
+
+// SetRelationValuesWithId sets the given values on the relation with
+// the given id. String values are set verbatim; a nil value removes the
+// setting; any other value is encoded as JSON. The values can be
+// decoded with GetRelationValue or UnmarshalRelationValue.
+func (ctxt *Context) SetRelationValuesWithId(relationId RelationId, vals map[string]interface{}) error {
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	keyvals := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		s, err := marshalRelationValue(vals[key])
+		if err != nil {
+			return errgo.Notef(err, "cannot marshal value for relation setting %q", key)
+		}
+		keyvals = append(keyvals, key, s)
+	}
+	return errgo.Mask(ctxt.SetRelationWithId(relationId, keyvals...))
+}
+
+func marshalRelationValue(val interface{}) (string, error) {
+	switch val := val.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return string(data), nil
+}
+
+// GetRelationValue decodes the value of the given setting of the
+// remote unit in the current relation hook into the value pointed to
+// by val. See UnmarshalRelationValue for details. It will panic if
+// the current hook is not a relation-related hook.
+func (ctxt *Context) GetRelationValue(key string, val interface{}) error {
+	if err := UnmarshalRelationValue(ctxt.Relation()[key], val); err != nil {
+		return errgo.Notef(err, "cannot get relation setting %q", key)
+	}
+	return nil
+}
+
+// UnmarshalRelationValue decodes a relation setting value, as set by
+// SetRelationValues, into the value pointed to by val. If val is a
+// *string, the setting is stored verbatim; otherwise it is decoded
+// as JSON. If the setting is empty (unset), val is left unchanged.
+func UnmarshalRelationValue(s string, val interface{}) error {
+	if s == "" {
+		return nil
+	}
+	if sp, ok := val.(*string); ok {
+		*sp = s
+		return nil
+	}
+	if err := json.Unmarshal([]byte(s), val); err != nil {
+		return errgo.Notef(err, "cannot unmarshal %q", s)
+	}
+	return nil
+}
+
 // GetConfig reads the charm configuration value for the given
 // key into the value pointed to by val, which should be
 // a pointer to one of the possible configuration option
 // types (string, int, float64 or boolean).
 // To find out whether a value has actually been set (is non-null)
 // pass a pointer to a pointer to the desired type.
+//
+// Configuration values are cached for the rest of the hook
+// (see Invalidate).
 func (ctxt *Context) GetConfig(key string, val interface{}) error {
-	if err := ctxt.runJSON(val, "config-get", "--format", "json", "--", key); err != nil {
+	if err := ctxt.cachedRunJSON(val, "config-get", "--format", "json", "--", key); err != nil {
 		return errgo.Notef(err, "cannot get configuration option %q", key)
 	}
 	return nil
@@ -337,9 +625,9 @@ func (ctxt *Context) GetConfigBool(key string) (bool, error) {
 // a JSON object into the given value, which should be a pointer
 // to a struct or a map. To get all values without knowing
 // what they might be, pass in a pointer to a map[string]interface{}
-// value,
+// value. As with GetConfig, the values are cached.
 func (ctxt *Context) GetAllConfig(val interface{}) error {
-	if err := ctxt.runJSON(&val, "config-get", "--format", "json"); err != nil {
+	if err := ctxt.cachedRunJSON(&val, "config-get", "--format", "json"); err != nil {
 		return errgo.Mask(err)
 	}
 	return nil
@@ -370,10 +658,64 @@ func (ctxt *Context) SetStatus(st Status, message string) error {
 func (ctxt *Context) runJSON(dst interface{}, cmd string, args ...string) error {
 	out, err := ctxt.Runner.Run(cmd, args...)
 	if err != nil {
-		return errgo.Mask(err)
+		return errgo.Mask(err, errgo.Is(ErrUnimplemented))
 	}
 	if err := json.Unmarshal(out, dst); err != nil {
 		return errgo.Notef(err, "cannot parse command output %q", out)
 	}
 	return nil
 }
+
+// cachedRunJSON is like runJSON except that the output of the
+// command is cached, so that running the same command with the same
+// arguments again in the same hook does not invoke the hook tool.
+// Errors are not cached.
+func (ctxt *Context) cachedRunJSON(dst interface{}, cmd string, args ...string) error {
+	cache := ctxt.hookCache()
+	key := strings.Join(append([]string{cmd}, args...), "\x00")
+	cache.mu.Lock()
+	out, ok := cache.output[key]
+	cache.mu.Unlock()
+	if !ok {
+		var err error
+		out, err = ctxt.Runner.Run(cmd, args...)
+		if err != nil {
+			return errgo.Mask(err, errgo.Is(ErrUnimplemented))
+		}
+		cache.mu.Lock()
+		if cache.output == nil {
+			cache.output = make(map[string][]byte)
+		}
+		cache.output[key] = out
+		cache.mu.Unlock()
+	}
+	if err := json.Unmarshal(out, dst); err != nil {
+		return errgo.Notef(err, "cannot parse command output %q", out)
+	}
+	return nil
+}
+
+// cachedOutput returns the cached output of the given hook tool
+// command line, and whether it was found in the cache.
+func (ctxt *Context) cachedOutput(cmd string, args ...string) ([]byte, bool) {
+	cache := ctxt.hookCache()
+	key := strings.Join(append([]string{cmd}, args...), "\x00")
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	out, ok := cache.output[key]
+	return out, ok
+}
+
+// Invalidate discards any values cached by the context. Values such
+// as configuration options and relation settings are cached for the
+// duration of a hook, because Juju presents a consistent view of
+// them while a hook is running. Invalidate is only needed in the rare
+// case that a value might have been changed by some other means, for
+// example by running a hook tool directly through ctxt.Runner.
+func (ctxt *Context) Invalidate() {
+	cache := ctxt.hookCache()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.output = nil
+	cache.resources = nil
+}
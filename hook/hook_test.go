@@ -1,9 +1,11 @@
 package hook_test
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/juju/cmd"
 	"github.com/juju/juju/worker/uniter/runner/jujuc"
@@ -13,6 +15,7 @@ import (
 	"gopkg.in/juju/charm.v5"
 
 	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
 )
 
 type HookSuite struct {
@@ -127,6 +130,13 @@ func (s *HookSuite) TestSimple(c *gc.C) {
 	c.Check(ctxt.RelationName, gc.Equals, "peer0")
 	c.Check(ctxt.RelationId, gc.Equals, hook.RelationId("peer0:0"))
 	c.Check(ctxt.RemoteUnit, gc.Equals, hook.UnitId("peer0/0"))
+	c.Check(ctxt.AgentVersion, gc.Equals, "")
+	c.Check(ctxt.Kubernetes, gc.Equals, false)
+	c.Check(ctxt.Environ.HookName, gc.Equals, "peer-relation-changed")
+	c.Check(ctxt.Environ.ModelUUID, gc.Equals, "fff.fff.fff")
+	c.Check(ctxt.Environ.UnitName, gc.Equals, hook.UnitId("local/55"))
+	c.Check(ctxt.Environ.RelationId, gc.Equals, hook.RelationId("peer0:0"))
+	c.Check(ctxt.Environ.Getenv("JUJU_UNIT_NAME"), gc.Equals, "local/55")
 
 	// should really check false but annoying to do
 	// and too trivial to be worth it.
@@ -154,6 +164,75 @@ func (s *HookSuite) TestSimple(c *gc.C) {
 	})
 }
 
+func (s *HookSuite) TestIdentityFromEnvironment(c *gc.C) {
+	s.StartServer(c, 0, "peer0/0")
+	s.setenv("JUJU_ENV_UUID", "")
+	s.setenv("JUJU_MODEL_UUID", "eee.eee.eee")
+	s.setenv("JUJU_VERSION", "2.0.1")
+	s.setenv("KUBERNETES_SERVICE_HOST", "10.1.1.1")
+	s.setenv("JUJU_AVAILABILITY_ZONE", "zone-a")
+	s.setenv("JUJU_MACHINE_ID", "2")
+	ctxt := s.newContext(c, "peer-relation-changed")
+	defer ctxt.Close()
+
+	c.Check(ctxt.AvailabilityZone(), gc.Equals, "zone-a")
+	c.Check(ctxt.MachineId(), gc.Equals, "2")
+
+	c.Check(ctxt.UUID, gc.Equals, "eee.eee.eee")
+	c.Check(ctxt.AgentVersion, gc.Equals, "2.0.1")
+	c.Check(ctxt.Kubernetes, gc.Equals, true)
+
+	s.setenv("JUJU_MODEL_UUID", "")
+	os.Args = []string{"runhook", "peer-relation-changed"}
+	_, _, err := hook.NewContextFromEnvironment(hook.NewRegistry())
+	c.Assert(err, gc.ErrorMatches, `required environment variable "JUJU_ENV_UUID" not set`)
+}
+
+func (s *HookSuite) TestNetworkGetFallback(c *gc.C) {
+	s.StartServer(c, 0, "peer0/0")
+	ctxt := s.newContext(c, "peer-relation-changed")
+	defer ctxt.Close()
+
+	info, err := ctxt.NetworkGet("peer0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.BindAddress(), gc.Equals, "192.168.0.99")
+	c.Assert(info.IngressAddress(), gc.Equals, "192.168.0.99")
+}
+
+func (s *HookSuite) TestNetworkGet(c *gc.C) {
+	networks := map[string]*hook.NetworkInfo{
+		"db": {
+			BindAddresses: []hook.BindAddress{{
+				MACAddress:    "00:16:3e:00:00:01",
+				InterfaceName: "eth1",
+				Addresses: []hook.InterfaceAddress{{
+					Address: "10.0.1.5",
+					CIDR:    "10.0.1.0/24",
+				}},
+			}},
+			IngressAddresses: []string{"10.0.1.5"},
+			EgressSubnets:    []string{"10.0.1.5/32"},
+		},
+	}
+	var info *hook.NetworkInfo
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			registerSimpleHook(r, "install", func(ctxt *hook.Context) error {
+				var err error
+				info, err = ctxt.NetworkGet("db")
+				return err
+			})
+		},
+		Networks: networks,
+		Logger:   c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(info, jc.DeepEquals, networks["db"])
+	c.Assert(info.BindAddress(), gc.Equals, "10.0.1.5")
+	c.Assert(info.IngressAddress(), gc.Equals, "10.0.1.5")
+}
+
 // TODO(rog) test methods that make changes!
 // TestOpenPort
 // TestClosePort
@@ -565,6 +644,97 @@ func (s *HookSuite) TestRegisterConfig(c *gc.C) {
 	})
 }
 
+func (s *HookSuite) TestRegisterMetric(c *gc.C) {
+	r := hook.NewRegistry()
+	m0 := charm.Metric{
+		Type:        charm.MetricTypeGauge,
+		Description: "d",
+	}
+	r.RegisterMetric("m0", m0)
+	// Check that it's OK to register again with the same metric.
+	r.RegisterMetric("m0", m0)
+
+	m1 := m0
+	m1.Type = charm.MetricTypeAbsolute
+	c.Assert(func() {
+		r.RegisterMetric("m0", m1)
+	}, gc.PanicMatches, `metric "m0" is already registered with different details .*`)
+
+	r.RegisterMetric("m1", m1)
+
+	c.Assert(r.RegisteredMetrics(), jc.DeepEquals, map[string]charm.Metric{
+		"m0": m0,
+		"m1": m1,
+	})
+}
+
+func (s *HookSuite) TestSetRelationValues(c *gc.C) {
+	runner := &recordingRunner{}
+	ctxt := &hook.Context{
+		Runner:     runner,
+		RelationId: "db:0",
+	}
+	err := ctxt.SetRelationValues(map[string]interface{}{
+		"host":    "example.com",
+		"port":    5432,
+		"ready":   true,
+		"removed": nil,
+		"users":   []string{"a", "b"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.record, jc.DeepEquals, [][]string{{
+		"relation-set", "-r", "db:0", "--",
+		"host=example.com",
+		"port=5432",
+		"ready=true",
+		"removed=",
+		`users=["a","b"]`,
+	}})
+
+	err = ctxt.SetRelationValues(map[string]interface{}{
+		"bad": func() {},
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot marshal value for relation setting "bad": .*`)
+}
+
+func (s *HookSuite) TestGetRelationValue(c *gc.C) {
+	ctxt := &hook.Context{
+		RelationId: "db:0",
+		RemoteUnit: "db/0",
+		Relations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"db:0": {
+				"db/0": {
+					"host":  "example.com",
+					"port":  "5432",
+					"users": `["a","b"]`,
+				},
+			},
+		},
+	}
+	var host string
+	err := ctxt.GetRelationValue("host", &host)
+	c.Assert(err, gc.IsNil)
+	c.Assert(host, gc.Equals, "example.com")
+
+	var port int
+	err = ctxt.GetRelationValue("port", &port)
+	c.Assert(err, gc.IsNil)
+	c.Assert(port, gc.Equals, 5432)
+
+	var users []string
+	err = ctxt.GetRelationValue("users", &users)
+	c.Assert(err, gc.IsNil)
+	c.Assert(users, jc.DeepEquals, []string{"a", "b"})
+
+	missing := 99
+	err = ctxt.GetRelationValue("missing", &missing)
+	c.Assert(err, gc.IsNil)
+	c.Assert(missing, gc.Equals, 99)
+
+	err = ctxt.GetRelationValue("host", &port)
+	c.Assert(err, gc.ErrorMatches, `cannot get relation setting "host": cannot unmarshal "example.com": .*`)
+}
+
 func (s *HookSuite) TestMain(c *gc.C) {
 	s.StartServer(c, 0, "peer0/0")
 	r0 := hook.NewRegistry()
@@ -634,6 +804,34 @@ func (s *HookSuite) TestWildcardHook(c *gc.C) {
 	c.Assert(called, jc.DeepEquals, []string{"peer0-relation-changed", "*"})
 }
 
+func (s *HookSuite) TestRunMain(c *gc.C) {
+	var stdout, stderr bytes.Buffer
+	os.Args = []string{"runhook", "version"}
+	code := hook.RunMainWithOutput(hook.NewRegistry(), &stdout, &stderr)
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(stdout.String(), gc.Equals, hook.BuildInfo().String()+"\n")
+
+	stdout.Reset()
+	os.Args = []string{"runhook"}
+	code = hook.RunMainWithOutput(hook.NewRegistry(), &stdout, &stderr)
+	c.Assert(code, gc.Equals, 1)
+	c.Assert(stderr.String(), gc.Matches, `runhook: cannot create context: usage: runhook (.|\n)*`)
+
+	s.StartServer(c, 0, "peer0/0")
+	r := hook.NewRegistry()
+	r.RegisterHook("config-changed", func() error {
+		return &hook.RetryableError{
+			Err: errgo.New("database not ready"),
+		}
+	})
+	stderr.Reset()
+	os.Args = []string{"runhook", "config-changed"}
+	code = hook.RunMainWithOutput(r, &stdout, &stderr)
+	c.Assert(code, gc.Equals, hook.ExitRetry)
+	c.Assert(stderr.String(), gc.Equals, "runhook: hook config-changed (registry root): database not ready\n")
+	c.Assert(stdout.String(), gc.Equals, "")
+}
+
 func (s *HookSuite) TestMainFailsWhenCannotSaveState(c *gc.C) {
 	s.StartServer(c, 0, "peer0/0")
 	r := hook.NewRegistry()
@@ -672,6 +870,30 @@ func (s *HookSuite) TestContextFromEnvironmentUsage(c *gc.C) {
 	\| runhook peer-relation-changed`)
 }
 
+func (s *HookSuite) TestRegisteredCommands(c *gc.C) {
+	r := hook.NewRegistry()
+	c.Assert(r.RegisteredCommands(), gc.HasLen, 0)
+	r.Clone("client").RegisterCommand(func([]string) {})
+	r.RegisterCommand(func([]string) {})
+	c.Assert(r.RegisteredCommands(), jc.DeepEquals, []string{"root", "root.client"})
+}
+
+func (s *HookSuite) TestRegisterBinary(c *gc.C) {
+	r := hook.NewRegistry()
+	c.Assert(r.RegisteredBinaries(), gc.HasLen, 0)
+	r.RegisterBinary("agent")
+	r.Clone("foo").RegisterBinary("cron")
+	r.RegisterBinary("agent")
+	c.Assert(r.RegisteredBinaries(), jc.DeepEquals, []string{"agent", "cron"})
+	for _, name := range []string{"", "runhook", "a/b", "a.b"} {
+		c.Assert(func() {
+			r.RegisterBinary(name)
+		}, gc.PanicMatches, `invalid binary name ".*"`)
+	}
+	ctxt := &hook.Context{CharmDir: "/var/lib/juju/charm"}
+	c.Assert(ctxt.BinaryPath("agent"), gc.Equals, "/var/lib/juju/charm/bin/agent")
+}
+
 func (s *HookSuite) TestRegisterCommandTwice(c *gc.C) {
 	r := hook.NewRegistry()
 	r.RegisterCommand(func([]string) {})
@@ -771,6 +993,186 @@ var validHookNameTests = map[string]bool{
 	"foo-xrelation-changed": false,
 	"foo-relation-changedx": false,
 	"foo-relation-departed": true,
+	"data-storage-attached": true,
+	"data-storage-detached": true,
+	"storage-attached":      false,
+	"data-storage-foo":      false,
+}
+
+func (s *HookSuite) TestCloneName(c *gc.C) {
+	r := hook.NewRegistry()
+	c.Assert(r.Name(), gc.Equals, "root")
+	r1 := r.Clone("foo")
+	c.Assert(r1.Name(), gc.Equals, "root.foo")
+	c.Assert(r1.Clone("bar").Name(), gc.Equals, "root.foo.bar")
+	c.Assert(func() {
+		r.Clone("foo")
+	}, gc.PanicMatches, `registry name "foo" registered twice`)
+	// The same name can be used in a different parent.
+	c.Assert(r1.Clone("foo").Name(), gc.Equals, "root.foo.foo")
+}
+
+func (s *HookSuite) TestNamespace(c *gc.C) {
+	r := hook.NewRegistry()
+	db := r.Namespace("db")
+	c.Assert(db.Name(), gc.Equals, "root.db")
+	c.Assert(db.ConfigName("user"), gc.Equals, "db-user")
+	c.Assert(db.RelationName("mysql"), gc.Equals, "db-mysql")
+	c.Assert(r.ConfigName("user"), gc.Equals, "user")
+
+	rel := charm.Relation{
+		Name:      "mysql",
+		Interface: "mysql",
+		Role:      charm.RoleRequirer,
+	}
+	db.RegisterRelation(rel)
+	r.RegisterRelation(rel)
+	opt := charm.Option{
+		Type:        "string",
+		Description: "d",
+	}
+	db.RegisterConfig("user", opt)
+	r.RegisterConfig("user", opt)
+	nop := func() error { return nil }
+	db.RegisterHook("mysql-relation-changed", nop)
+	db.RegisterHook("config-changed", nop)
+	db.RegisterHook("*", nop)
+
+	// Clones inherit the namespace and namespaces nest.
+	db.Clone("sub").RegisterConfig("password", opt)
+	db.Namespace("cache").RegisterConfig("size", opt)
+
+	rel.Scope = charm.ScopeGlobal
+	rel.Limit = 1
+	dbRel := rel
+	dbRel.Name = "db-mysql"
+	c.Assert(r.RegisteredRelations(), jc.DeepEquals, map[string]charm.Relation{
+		"mysql":    rel,
+		"db-mysql": dbRel,
+	})
+	c.Assert(r.RegisteredConfig(), jc.DeepEquals, map[string]charm.Option{
+		"user":          opt,
+		"db-user":       opt,
+		"db-password":   opt,
+		"db-cache-size": opt,
+	})
+	c.Assert(r.RegisteredHooks(), jc.DeepEquals, []string{
+		"config-changed",
+		"db-mysql-relation-changed",
+	})
+
+	c.Assert(func() {
+		r.Namespace("Bad")
+	}, gc.PanicMatches, `invalid namespace "Bad"`)
+	c.Assert(func() {
+		r.Namespace("db")
+	}, gc.PanicMatches, `registry name "db" registered twice`)
+}
+
+func (s *HookSuite) TestHookOrderAcrossClones(c *gc.C) {
+	var called []string
+	record := func(name string) func() error {
+		return func() error {
+			called = append(called, name)
+			return nil
+		}
+	}
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterHook("*", record("root-wildcard"))
+			r.Clone("a").RegisterHook("config-changed", record("a"))
+			r.RegisterHook("config-changed", record("root"))
+			b := r.Clone("b")
+			b.RegisterHook("*", record("b-wildcard"))
+			b.RegisterHook("config-changed", record("b"))
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(called, jc.DeepEquals, []string{"a", "root", "b", "root-wildcard", "b-wildcard"})
+}
+
+func (s *HookSuite) TestHookPriority(c *gc.C) {
+	var called []string
+	record := func(name string) func() error {
+		return func() error {
+			called = append(called, name)
+			if name == "fail" {
+				return errgo.New("failure")
+			}
+			return nil
+		}
+	}
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterHookWithPriority("*", -10, record("wildcard-early"))
+			r.RegisterHook("config-changed", record("a"))
+			r.RegisterHookWithPriority("config-changed", 10, record("late"))
+			r.RegisterHookWithPriority("config-changed", -1, record("early"))
+			r.RegisterHook("config-changed", record("b"))
+			r.RegisterHook("*", record("wildcard"))
+			r.Clone("sub").RegisterHookWithPriority("install", 5, record("fail"))
+			r.RegisterHookWithPriority("install", 6, record("not-called"))
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(called, jc.DeepEquals, []string{"early", "a", "b", "late", "wildcard-early", "wildcard"})
+
+	called = nil
+	err = runner.RunHook("install", "", "")
+	c.Assert(err, gc.ErrorMatches, `hook install \(registry root.sub\): failure`)
+	c.Assert(called, jc.DeepEquals, []string{"fail"})
+}
+
+func (s *HookSuite) TestTimeout(c *gc.C) {
+	var ctxt *hook.Context
+	var state struct {
+		Done int
+	}
+	const total = 5
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterTimeout(time.Hour)
+			r.RegisterTimeout(50 * time.Millisecond)
+			r.RegisterContext(func(c *hook.Context) error {
+				ctxt = c
+				return nil
+			}, &state)
+			r.RegisterHook("install", func() error {
+				// Do one piece of work each time
+				// we're run, then wait for the deadline.
+				if state.Done < total {
+					state.Done++
+				}
+				<-ctxt.Done()
+				return nil
+			})
+		},
+		Logger: c,
+	}
+	t0 := time.Now()
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(time.Since(t0) >= 50*time.Millisecond, gc.Equals, true)
+	deadline, ok := ctxt.Deadline()
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(deadline.Sub(t0) >= 50*time.Millisecond, gc.Equals, true)
+
+	// The partial progress was saved.
+	state.Done = 0
+	err = runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(state.Done, gc.Equals, 2)
+}
+
+func (s *HookSuite) TestNoTimeout(c *gc.C) {
+	ctxt := &hook.Context{}
+	c.Assert(ctxt.Done(), gc.IsNil)
+	_, ok := ctxt.Deadline()
+	c.Assert(ok, gc.Equals, false)
 }
 
 func (s *HookSuite) TestValidHookName(c *gc.C) {
@@ -882,12 +1284,29 @@ func (s *HookSuite) TestHookNotFound(c *gc.C) {
 	r := hook.NewRegistry()
 	r.RegisterHook("install", func() error { return nil })
 	r.RegisterHook("stop", func() error { return nil })
-	os.Args = []string{"exe", "peer-relation-changed"}
+	os.Args = []string{"exe", "no-such-hook"}
 	err := s.runMain(c, r)
 	c.Assert(err, gc.ErrorMatches, `usage: runhook install
 	\| runhook stop`)
 }
 
+func (s *HookSuite) TestUnregisteredHook(c *gc.C) {
+	// A hook that the builder found only by static analysis
+	// has a stub, but may not be registered when it runs.
+	s.StartServer(c, 0, "peer0/0")
+	r := hook.NewRegistry()
+	r.RegisterHook("install", func() error { return nil })
+	wildcard := false
+	r.RegisterHook("*", func() error {
+		wildcard = true
+		return nil
+	})
+	os.Args = []string{"exe", "peer-relation-changed"}
+	err := s.runMain(c, r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(wildcard, gc.Equals, true)
+}
+
 func (s *HookSuite) BenchmarkHook(c *gc.C) {
 	s.StartServer(c, 0, "peer0/0")
 	for i := 0; i < 200; i++ {
@@ -934,3 +1353,54 @@ func (nopRunner) Run(cmd string, args ...string) (stdout []byte, err error) {
 func (nopRunner) Close() error {
 	return nil
 }
+
+var hookArgsTests = []struct {
+	args   []string
+	env    map[string]string
+	expect []string
+}{{
+	args:   []string{"/var/lib/juju/charm/bin/runhook", "install"},
+	expect: []string{"/var/lib/juju/charm/bin/runhook", "install"},
+}, {
+	args:   []string{"/var/lib/juju/charm/hooks/config-changed"},
+	expect: []string{"/var/lib/juju/charm/hooks/config-changed", "config-changed"},
+}, {
+	args:   []string{"hooks/start"},
+	expect: []string{"hooks/start", "start"},
+}, {
+	args:   []string{"runhook"},
+	expect: []string{"runhook"},
+}, {
+	args:   []string{"/var/lib/juju/charm/hooks/install", "extra"},
+	expect: []string{"/var/lib/juju/charm/hooks/install", "extra"},
+}, {
+	args:   []string{"/var/lib/juju/charm/bin/runhook"},
+	env:    map[string]string{"JUJU_DISPATCH_PATH": "hooks/db-relation-joined", "JUJU_HOOK_NAME": "other"},
+	expect: []string{"/var/lib/juju/charm/bin/runhook", "db-relation-joined"},
+}, {
+	args:   []string{"/var/lib/juju/charm/hooks/start"},
+	env:    map[string]string{"JUJU_DISPATCH_PATH": "hooks/install"},
+	expect: []string{"/var/lib/juju/charm/hooks/start", "install"},
+}, {
+	args:   []string{"/var/lib/juju/charm/bin/runhook"},
+	env:    map[string]string{"JUJU_DISPATCH_PATH": "actions/backup"},
+	expect: []string{"/var/lib/juju/charm/bin/runhook"},
+}, {
+	args:   []string{"/var/lib/juju/charm/dispatch"},
+	env:    map[string]string{"JUJU_HOOK_NAME": "stop"},
+	expect: []string{"/var/lib/juju/charm/dispatch", "stop"},
+}, {
+	args:   []string{"/var/lib/juju/charm/bin/runhook", "cmd-root", "x"},
+	env:    map[string]string{"JUJU_DISPATCH_PATH": "hooks/install"},
+	expect: []string{"/var/lib/juju/charm/bin/runhook", "cmd-root", "x"},
+}}
+
+func (s *HookSuite) TestHookArgs(c *gc.C) {
+	for i, test := range hookArgsTests {
+		c.Logf("test %d: %q %v", i, test.args, test.env)
+		getenv := func(key string) string {
+			return test.env[key]
+		}
+		c.Assert(hook.HookArgs(test.args, getenv), jc.DeepEquals, test.expect)
+	}
+}
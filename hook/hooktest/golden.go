@@ -0,0 +1,145 @@
+package hooktest
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/builder"
+	"github.com/juju/gocharm/hook"
+)
+
+// UpdateGoldenEnv holds the name of the environment variable
+// that causes CheckGolden to update the golden files instead
+// of comparing against them.
+const UpdateGoldenEnv = "GOCHARM_UPDATE_GOLDEN"
+
+// GeneratedFiles returns the hook stubs and main package that
+// gocharm would generate for the given charm package, whose hooks are
+// registered by registerHooks, keyed by path relative to the charm
+// directory (see builder.GenerateFiles). In the charm package's own
+// tests, pkg can be found with build.ImportDir(".", 0). If the package
+// provides builder.MainTemplateFile, the main package is generated
+// from it, as gocharm does.
+//
+// Unlike gocharm itself, it runs registerHooks in the current
+// process, so hooks that are only registered conditionally will
+// not be included unless they are registered when it is called.
+func GeneratedFiles(pkg *build.Package, registerHooks func(r *hook.Registry), opts builder.StubOptions) (map[string][]byte, error) {
+	r := hook.NewRegistry()
+	registerHooks(r)
+	hook.RegisterMainHooks(r)
+	d := r.Describe()
+	info := &builder.CharmInfo{
+		Hooks:     d.Hooks,
+		HookStubs: make(map[string]builder.HookStub),
+	}
+	for name, stub := range d.HookStubs {
+		info.HookStubs[name] = builder.HookStub{
+			Interpreter: stub.Interpreter,
+			Env:         stub.Env,
+			Dir:         stub.Dir,
+			Setup:       stub.Setup,
+		}
+	}
+	files, err := builder.GenerateFiles(pkg, info, opts)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return files, nil
+}
+
+// CheckGolden compares the given files, keyed by slash-separated
+// relative path, against the golden files of the same names in
+// dir, and returns an error describing any differences, including
+// golden files for which there is no corresponding file.
+//
+// If the $GOCHARM_UPDATE_GOLDEN environment variable is
+// non-empty, the golden files are updated to match instead, and
+// stale golden files are removed.
+func CheckGolden(dir string, files map[string][]byte) error {
+	update := os.Getenv(UpdateGoldenEnv) != ""
+	var problems []string
+	for _, name := range sortedNames(files) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if update {
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				return errgo.Mask(err)
+			}
+			if err := ioutil.WriteFile(path, files[name], 0666); err != nil {
+				return errgo.Mask(err)
+			}
+			continue
+		}
+		golden, err := ioutil.ReadFile(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot read golden file: %v", err))
+			continue
+		}
+		if diff := firstDiff(files[name], golden); diff != "" {
+			problems = append(problems, fmt.Sprintf("%s differs from %s %s", name, path, diff))
+		}
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := files[filepath.ToSlash(rel)]; ok {
+			return nil
+		}
+		if update {
+			return os.Remove(path)
+		}
+		problems = append(problems, fmt.Sprintf("golden file %s is no longer generated", path))
+		return nil
+	})
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if len(problems) > 0 {
+		return errgo.Newf("generated files do not match golden files (set $%s to update them):\n%s", UpdateGoldenEnv, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// firstDiff returns a description of the first line that
+// differs between got and want, or the empty string
+// if they are the same.
+func firstDiff(got, want []byte) string {
+	if string(got) == string(want) {
+		return ""
+	}
+	gotLines := strings.SplitAfter(string(got), "\n")
+	wantLines := strings.SplitAfter(string(want), "\n")
+	for i := 0; ; i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Sprintf("at line %d:\n\tgot  %q\n\twant %q", i+1, g, w)
+		}
+	}
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,126 @@
+package hooktest_test
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/builder"
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type goldenSuite struct{}
+
+var _ = gc.Suite(&goldenSuite{})
+
+func registerGoldenHooks(r *hook.Registry) {
+	r.RegisterHook("install", func() error { return nil })
+	r.RegisterHook("upgrade-charm", func() error { return nil })
+	r.RegisterHookStub("upgrade-charm", hook.HookStub{
+		Setup: []string{"ulimit -n 4096"},
+	})
+}
+
+func goldenPackage(c *gc.C) *build.Package {
+	return &build.Package{
+		Dir:        c.MkDir(),
+		Name:       "mycharm",
+		ImportPath: "example.com/mycharm",
+	}
+}
+
+func (*goldenSuite) TestGeneratedFiles(c *gc.C) {
+	files, err := hooktest.GeneratedFiles(goldenPackage(c), registerGoldenHooks, builder.StubOptions{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(files["hooks/install"]), gc.Equals, `#!/bin/sh
+set -ex
+
+$CHARM_DIR/bin/runhook install
+`)
+	c.Assert(string(files["hooks/upgrade-charm"]), gc.Equals, `#!/bin/sh
+set -ex
+ulimit -n 4096
+
+$CHARM_DIR/bin/runhook upgrade-charm
+`)
+	c.Assert(string(files["src/runhook/runhook.go"]), gc.Matches, `(?s).*\n\tcharm "example.com/mycharm"\n.*`)
+}
+
+func (*goldenSuite) TestGeneratedFilesWithMainTemplate(c *gc.C) {
+	pkg := goldenPackage(c)
+	tmplFile := filepath.Join(pkg.Dir, filepath.FromSlash(builder.MainTemplateFile))
+	err := os.MkdirAll(filepath.Dir(tmplFile), 0777)
+	c.Assert(err, gc.IsNil)
+	tmpl := `package main
+
+import (
+	"log"
+
+	mycharm {{.CharmPackage | printf "%q"}}
+	{{.HookPackage | printf "%q"}}
+)
+
+func main() {
+	log.SetFlags(0)
+	r := hook.NewRegistry()
+	mycharm.RegisterHooks(r)
+	hook.RunMain(r)
+}
+`
+	err = ioutil.WriteFile(tmplFile, []byte(tmpl), 0666)
+	c.Assert(err, gc.IsNil)
+	files, err := hooktest.GeneratedFiles(pkg, registerGoldenHooks, builder.StubOptions{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(files["src/runhook/runhook.go"]), gc.Matches, `(?s).*\tlog.SetFlags\(0\)\n.*`)
+
+	// An invalid template is reported.
+	err = ioutil.WriteFile(tmplFile, []byte("package main\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	_, err = hooktest.GeneratedFiles(pkg, registerGoldenHooks, builder.StubOptions{})
+	c.Assert(err, gc.ErrorMatches, `invalid src/runhook/main.go.tmpl: charm package "example.com/mycharm" is not imported`)
+}
+
+func (*goldenSuite) TestCheckGolden(c *gc.C) {
+	defer os.Setenv(hooktest.UpdateGoldenEnv, os.Getenv(hooktest.UpdateGoldenEnv))
+	dir := c.MkDir()
+	pkg := goldenPackage(c)
+	files, err := hooktest.GeneratedFiles(pkg, registerGoldenHooks, builder.StubOptions{})
+	c.Assert(err, gc.IsNil)
+
+	os.Setenv(hooktest.UpdateGoldenEnv, "")
+	err = hooktest.CheckGolden(dir, files)
+	c.Assert(err, gc.ErrorMatches, `(?s)generated files do not match golden files \(set \$GOCHARM_UPDATE_GOLDEN to update them\):\ncannot read golden file: .*`)
+
+	os.Setenv(hooktest.UpdateGoldenEnv, "1")
+	err = ioutil.WriteFile(filepath.Join(dir, "stale"), nil, 0666)
+	c.Assert(err, gc.IsNil)
+	err = hooktest.CheckGolden(dir, files)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(filepath.Join(dir, "stale"))
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+
+	os.Setenv(hooktest.UpdateGoldenEnv, "")
+	err = hooktest.CheckGolden(dir, files)
+	c.Assert(err, gc.IsNil)
+
+	// A template change is reported.
+	files, err = hooktest.GeneratedFiles(pkg, registerGoldenHooks, builder.StubOptions{Checksum: true})
+	c.Assert(err, gc.IsNil)
+	err = hooktest.CheckGolden(dir, files)
+	c.Assert(err, gc.NotNil)
+	c.Assert(strings.Count(err.Error(), "differs from"), gc.Equals, 4)
+	c.Assert(err, gc.ErrorMatches, `(?s).*hooks/install differs from .*/hooks/install at line 3:\n\tgot  "if ! .*\n\twant "\\n".*`)
+
+	// As is a hook that is no longer registered.
+	files, err = hooktest.GeneratedFiles(pkg, func(r *hook.Registry) {
+		r.RegisterHook("install", func() error { return nil })
+	}, builder.StubOptions{})
+	c.Assert(err, gc.IsNil)
+	err = hooktest.CheckGolden(dir, files)
+	c.Assert(err, gc.ErrorMatches, `(?s).*golden file .*/hooks/upgrade-charm is no longer generated`)
+}
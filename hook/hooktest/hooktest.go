@@ -3,6 +3,9 @@ package hooktest
 
 import (
 	"encoding/json"
+	"sort"
+
+	"gopkg.in/errgo.v1"
 
 	"github.com/juju/gocharm/hook"
 )
@@ -15,9 +18,12 @@ import (
 // exception of the calls mentioned below.
 //
 // Any calls to juju-log are logged using Logger, but otherwise ignored.
+// Messages logged at an explicit level are prefixed with the level.
 // Calls to config-get from the Config field and not invoked through RunFunc.
 // Likewise, calls to unit-get will be satisfied from the PublicAddress
-// and PrivateAddress fields.
+// and PrivateAddress fields, calls to network-get from
+// the Networks field, and calls to opened-ports from
+// the OpenedPorts field.
 type Runner struct {
 	RegisterHooks func(r *hook.Registry)
 	// The following fields hold information that will
@@ -29,6 +35,24 @@ type Runner struct {
 	PublicAddress  string
 	PrivateAddress string
 
+	// Networks holds the network information returned by
+	// network-get, keyed by binding name. If it is nil,
+	// network-get will behave as if running on an older Juju
+	// agent that does not implement it.
+	Networks map[string]*hook.NetworkInfo
+
+	// OpenedPorts holds the ports currently opened by the
+	// charm, in the form used by open-port (for example
+	// "80/tcp" or "8000-8080/udp"). It is updated whenever
+	// open-port or close-port is called.
+	OpenedPorts map[string]bool
+
+	// Leader holds whether the local unit is the leader, and
+	// LeaderSettings holds the leader settings. LeaderSettings
+	// is updated whenever leader-set is called.
+	Leader         bool
+	LeaderSettings map[string]string
+
 	// State holds the persistent state.
 	// If it is nil, it will be set to a hooktest.MemState
 	// instance.
@@ -43,6 +67,11 @@ type Runner struct {
 		Logf(string, ...interface{})
 	}
 
+	// LocalSettings holds the relation settings set by the
+	// charm for the local unit, keyed by relation id.
+	// It is updated whenever relation-set is called.
+	LocalSettings map[hook.RelationId]map[string]string
+
 	// Close records whether the Close method has been called.
 	Closed bool
 }
@@ -56,9 +85,7 @@ func (runner *Runner) RunHook(hookName string, relId hook.RelationId, relUnit ho
 	if runner.State == nil {
 		runner.State = make(MemState)
 	}
-	r := hook.NewRegistry()
-	runner.RegisterHooks(r)
-	hook.RegisterMainHooks(r)
+	r := runner.registry()
 	hctxt := &hook.Context{
 		UUID:        UUID,
 		Unit:        "someunit/0",
@@ -87,13 +114,26 @@ func (runner *Runner) RunHook(hookName string, relId hook.RelationId, relUnit ho
 	return hook.Main(r, hctxt, runner.State)
 }
 
+// registry returns a new registry with all the charm's
+// hooks registered.
+func (runner *Runner) registry() *hook.Registry {
+	r := hook.NewRegistry()
+	runner.RegisterHooks(r)
+	hook.RegisterMainHooks(r)
+	return r
+}
+
 // Run implements hook.Runner.Run.
 func (r *Runner) Run(cmd string, args ...string) ([]byte, error) {
 	if cmd == "juju-log" {
-		if len(args) != 1 {
-			panic("expected exactly one argument to juju-log")
+		switch {
+		case len(args) == 1:
+			r.Logger.Logf("%s", args[0])
+		case len(args) == 3 && args[0] == "--log-level":
+			r.Logger.Logf("%s: %s", args[1], args[2])
+		default:
+			panic("unexpected arguments to juju-log")
 		}
-		r.Logger.Logf("%s", args[0])
 		return nil, nil
 	}
 	switch cmd {
@@ -124,10 +164,53 @@ func (r *Runner) Run(cmd string, args ...string) ([]byte, error) {
 		default:
 			panic("unexpected argument to unit-get")
 		}
+	case "network-get":
+		if r.Networks == nil {
+			return nil, errgo.WithCausef(nil, hook.ErrUnimplemented, "bad request: unknown command: network-get")
+		}
+		// network-get --format json -- binding
+		info, ok := r.Networks[args[len(args)-1]]
+		if !ok {
+			return nil, errgo.Newf("no network information for binding %q", args[len(args)-1])
+		}
+		data, err := json.Marshal(info)
+		if err != nil {
+			panic(err)
+		}
+		return data, nil
+	case "is-leader", "leader-get":
+		return hook.RunLeaderTool(r.Leader, r.LeaderSettings, cmd, args...)
+	case "opened-ports":
+		ports := make([]string, 0, len(r.OpenedPorts))
+		for p := range r.OpenedPorts {
+			ports = append(ports, p)
+		}
+		sort.Strings(ports)
+		data, err := json.Marshal(ports)
+		if err != nil {
+			panic(err)
+		}
+		return data, nil
 	}
 	rec := []string{cmd}
 	rec = append(rec, args...)
 	r.Record = append(r.Record, rec)
+	switch cmd {
+	case "relation-set":
+		r.relationSet(args)
+	case "open-port":
+		if r.OpenedPorts == nil {
+			r.OpenedPorts = make(map[string]bool)
+		}
+		r.OpenedPorts[args[0]] = true
+	case "close-port":
+		delete(r.OpenedPorts, args[0])
+	case "leader-set":
+		if r.LeaderSettings == nil {
+			r.LeaderSettings = make(map[string]string)
+		}
+		return hook.RunLeaderTool(r.Leader, r.LeaderSettings, cmd, args...)
+	}
 	if r.RunFunc != nil {
 		return r.RunFunc(cmd, args...)
 	}
@@ -0,0 +1,241 @@
+package hooktest
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// Relation simulates a single instance of a relation between the charm
+// under test and some remote service. It can be used to drive a
+// relation through its lifecycle (units joining, changing their
+// settings and departing, and finally the relation being broken),
+// running the appropriate hooks on the associated Runner at each step.
+//
+// Only hooks that the charm has actually registered are run, mirroring
+// the real charm, where no hook stub is generated for unregistered
+// hooks.
+//
+// Any relation-set calls made by the charm are recorded in
+// Runner.Record as usual, and their effect can be seen
+// with the LocalSettings method.
+type Relation struct {
+	runner *Runner
+	name   string
+	id     hook.RelationId
+}
+
+// AddRelation adds a new relation instance with the given relation
+// name (as registered by the charm) and id, and returns a Relation
+// that can be used to simulate events on it. No hooks are run until
+// a unit joins the relation.
+//
+// It panics if a relation with the given id already exists.
+func (runner *Runner) AddRelation(name string, id hook.RelationId) *Relation {
+	if runner.RelationIds == nil {
+		runner.RelationIds = make(map[string][]hook.RelationId)
+	}
+	if runner.Relations == nil {
+		runner.Relations = make(map[hook.RelationId]map[hook.UnitId]map[string]string)
+	}
+	if _, ok := runner.Relations[id]; ok {
+		panic(errgo.Newf("relation %q added twice", id))
+	}
+	runner.RelationIds[name] = append(runner.RelationIds[name], id)
+	runner.Relations[id] = make(map[hook.UnitId]map[string]string)
+	return &Relation{
+		runner: runner,
+		name:   name,
+		id:     id,
+	}
+}
+
+// Id returns the id of the relation.
+func (rel *Relation) Id() hook.RelationId {
+	return rel.id
+}
+
+// Join simulates the given remote unit joining the relation with the
+// given initial settings. It runs the relation-joined hook followed by
+// the relation-changed hook, as Juju does.
+func (rel *Relation) Join(unit hook.UnitId, settings map[string]string) error {
+	units := rel.units()
+	if _, ok := units[unit]; ok {
+		return errgo.Newf("unit %s has already joined relation %s", unit, rel.id)
+	}
+	units[unit] = copySettings(settings)
+	if err := rel.runHook("relation-joined", unit); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := rel.runHook("relation-changed", unit); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// Change simulates the given remote unit changing its settings. The
+// given settings are merged into the existing settings for the unit;
+// a setting with an empty value is removed. It runs the
+// relation-changed hook.
+func (rel *Relation) Change(unit hook.UnitId, settings map[string]string) error {
+	old, ok := rel.units()[unit]
+	if !ok {
+		return errgo.Newf("unit %s has not joined relation %s", unit, rel.id)
+	}
+	for key, val := range settings {
+		if val == "" {
+			delete(old, key)
+		} else {
+			old[key] = val
+		}
+	}
+	if err := rel.runHook("relation-changed", unit); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// Depart simulates the given remote unit leaving the relation. As with
+// Juju, the unit's settings are no longer visible when the
+// relation-departed hook runs.
+func (rel *Relation) Depart(unit hook.UnitId) error {
+	units := rel.units()
+	if _, ok := units[unit]; !ok {
+		return errgo.Newf("unit %s has not joined relation %s", unit, rel.id)
+	}
+	delete(units, unit)
+	if err := rel.runHook("relation-departed", unit); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// Break simulates the relation being removed. Any units that
+// are still in the relation depart first, in order of unit id. Then the
+// relation-broken hook is run, after which the relation is removed from
+// the Runner entirely.
+func (rel *Relation) Break() error {
+	for _, unit := range sortedUnits(rel.units()) {
+		if err := rel.Depart(unit); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := rel.runHook("relation-broken", ""); err != nil {
+		return errgo.Mask(err)
+	}
+	runner := rel.runner
+	ids := runner.RelationIds[rel.name]
+	for i, id := range ids {
+		if id == rel.id {
+			runner.RelationIds[rel.name] = append(ids[0:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	delete(runner.Relations, rel.id)
+	delete(runner.LocalSettings, rel.id)
+	return nil
+}
+
+// Units returns the settings of all remote units currently
+// in the relation, keyed by unit id.
+func (rel *Relation) Units() map[hook.UnitId]map[string]string {
+	return rel.units()
+}
+
+// LocalSettings returns the settings that the charm has
+// set for the local unit on the relation.
+func (rel *Relation) LocalSettings() map[string]string {
+	return rel.runner.LocalSettings[rel.id]
+}
+
+func (rel *Relation) units() map[hook.UnitId]map[string]string {
+	units, ok := rel.runner.Relations[rel.id]
+	if !ok {
+		panic(errgo.Newf("relation %q has been removed", rel.id))
+	}
+	return units
+}
+
+// runHook runs the relation hook of the given kind
+// (for example "relation-joined") if the charm has
+// registered it.
+func (rel *Relation) runHook(kind string, unit hook.UnitId) error {
+	hookName := rel.name + "-" + kind
+	if !rel.runner.isRegistered(hookName) {
+		return nil
+	}
+	if err := rel.runner.RunHook(hookName, rel.id, unit); err != nil {
+		return errgo.Notef(err, "hook %s failed", hookName)
+	}
+	return nil
+}
+
+// isRegistered reports whether the charm has registered
+// the hook with the given name.
+func (runner *Runner) isRegistered(hookName string) bool {
+	for _, name := range runner.registry().RegisteredHooks() {
+		if name == hookName {
+			return true
+		}
+	}
+	return false
+}
+
+// relationSet records the effect of a relation-set
+// call with the given arguments in r.LocalSettings.
+func (r *Runner) relationSet(args []string) {
+	var id hook.RelationId
+	for len(args) > 0 && args[0] != "--" {
+		if args[0] == "-r" && len(args) > 1 {
+			id = hook.RelationId(args[1])
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	if r.LocalSettings == nil {
+		r.LocalSettings = make(map[hook.RelationId]map[string]string)
+	}
+	settings := r.LocalSettings[id]
+	if settings == nil {
+		settings = make(map[string]string)
+		r.LocalSettings[id] = settings
+	}
+	for _, kv := range args {
+		i := strings.Index(kv, "=")
+		if i == -1 {
+			panic(errgo.Newf("invalid relation-set argument %q", kv))
+		}
+		if key, val := kv[0:i], kv[i+1:]; val == "" {
+			delete(settings, key)
+		} else {
+			settings[key] = val
+		}
+	}
+}
+
+func copySettings(settings map[string]string) map[string]string {
+	m := make(map[string]string)
+	for key, val := range settings {
+		m[key] = val
+	}
+	return m
+}
+
+func sortedUnits(units map[hook.UnitId]map[string]string) []hook.UnitId {
+	ids := make([]string, 0, len(units))
+	for id := range units {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	unitIds := make([]hook.UnitId, len(ids))
+	for i, id := range ids {
+		unitIds[i] = hook.UnitId(id)
+	}
+	return unitIds
+}
@@ -0,0 +1,119 @@
+package hooktest_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+type relationSuite struct{}
+
+var _ = gc.Suite(&relationSuite{})
+
+// joiner is a trivial charm that publishes the names of all the
+// remote units it can see on the "peers" relation, and
+// records the hooks it has run.
+type joiner struct {
+	ctxt  *hook.Context
+	hooks []string
+}
+
+func (j *joiner) register(r *hook.Registry) {
+	r.RegisterRelation(charm.Relation{
+		Name:      "peers",
+		Interface: "joiner",
+		Role:      charm.RoleProvider,
+	})
+	r.RegisterContext(func(ctxt *hook.Context) error {
+		j.ctxt = ctxt
+		return nil
+	}, nil)
+	r.RegisterHook("peers-relation-joined", j.changed)
+	r.RegisterHook("peers-relation-changed", j.changed)
+	r.RegisterHook("peers-relation-departed", j.changed)
+}
+
+func (j *joiner) changed() error {
+	var names []string
+	for unit, settings := range j.ctxt.Relations[j.ctxt.RelationId] {
+		names = append(names, string(unit)+"="+settings["val"])
+	}
+	sort.Strings(names)
+	j.hooks = append(j.hooks, j.ctxt.HookName+" "+string(j.ctxt.RemoteUnit))
+	return j.ctxt.SetRelation("units", strings.Join(names, ","))
+}
+
+func (s *relationSuite) TestRelationLifecycle(c *gc.C) {
+	var j joiner
+	runner := &hooktest.Runner{
+		RegisterHooks: j.register,
+		Logger:        c,
+	}
+	rel := runner.AddRelation("peers", "peers:0")
+
+	err := rel.Join("other/0", map[string]string{"val": "a"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"units": "other/0=a",
+	})
+
+	err = rel.Join("other/1", map[string]string{"val": "b"})
+	c.Assert(err, gc.IsNil)
+	err = rel.Change("other/0", map[string]string{"val": "c"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"units": "other/0=c,other/1=b",
+	})
+	c.Assert(rel.Units(), jc.DeepEquals, map[hook.UnitId]map[string]string{
+		"other/0": {"val": "c"},
+		"other/1": {"val": "b"},
+	})
+
+	err = rel.Depart("other/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(rel.LocalSettings(), jc.DeepEquals, map[string]string{
+		"units": "other/1=b",
+	})
+
+	err = rel.Break()
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.RelationIds["peers"], gc.HasLen, 0)
+
+	c.Assert(j.hooks, jc.DeepEquals, []string{
+		"peers-relation-joined other/0",
+		"peers-relation-changed other/0",
+		"peers-relation-joined other/1",
+		"peers-relation-changed other/1",
+		"peers-relation-changed other/0",
+		"peers-relation-departed other/0",
+		"peers-relation-departed other/1",
+	})
+	c.Assert(runner.Record, gc.HasLen, 7)
+	c.Assert(runner.Record[0], jc.DeepEquals, []string{"relation-set", "-r", "peers:0", "--", "units=other/0=a"})
+}
+
+func (s *relationSuite) TestJoinTwice(c *gc.C) {
+	var j joiner
+	runner := &hooktest.Runner{
+		RegisterHooks: j.register,
+		Logger:        c,
+	}
+	rel := runner.AddRelation("peers", "peers:0")
+	err := rel.Join("other/0", nil)
+	c.Assert(err, gc.IsNil)
+	err = rel.Join("other/0", nil)
+	c.Assert(err, gc.ErrorMatches, `unit other/0 has already joined relation peers:0`)
+	err = rel.Change("other/1", nil)
+	c.Assert(err, gc.ErrorMatches, `unit other/1 has not joined relation peers:0`)
+}
@@ -0,0 +1,64 @@
+package hook
+
+import (
+	"strings"
+)
+
+// UnitName returns the name of the charm's unit,
+// for example "wordpress/0".
+func (ctxt *Context) UnitName() string {
+	return string(ctxt.Unit)
+}
+
+// ServiceName returns the name of the service that
+// the charm's unit belongs to, for example "wordpress".
+func (ctxt *Context) ServiceName() string {
+	name := string(ctxt.Unit)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[0:i]
+	}
+	return name
+}
+
+// EnvUUID returns the globally unique id of the
+// environment that the unit is running in.
+func (ctxt *Context) EnvUUID() string {
+	return ctxt.UUID
+}
+
+// ModelUUID is a synonym for EnvUUID, using the
+// terminology of later versions of Juju.
+func (ctxt *Context) ModelUUID() string {
+	return ctxt.UUID
+}
+
+// JujuVersion returns the version of the Juju agent that is running
+// the hook, as reported by $JUJU_VERSION. Older versions of Juju do
+// not report their version, in which case it returns the empty string.
+func (ctxt *Context) JujuVersion() string {
+	return ctxt.AgentVersion
+}
+
+// AvailabilityZone returns the availability zone of the machine that
+// the unit is running on, as reported by $JUJU_AVAILABILITY_ZONE (see
+// Context.Environ). The unit-get hook tool does not provide it. It
+// returns the empty string if the cloud has no availability zones or
+// the version of Juju does not report them.
+func (ctxt *Context) AvailabilityZone() string {
+	return ctxt.Environ.AvailabilityZone
+}
+
+// MachineId returns the id of the machine that the unit is running on,
+// for example "3" or "0/lxd/1", as reported by $JUJU_MACHINE_ID (see
+// Context.Environ). It returns the empty string if the unit is not
+// running on a machine (see IsMachineCharm) or the version of Juju
+// does not report it.
+func (ctxt *Context) MachineId() string {
+	return ctxt.Environ.MachineId
+}
+
+// IsMachineCharm reports whether the unit is running
+// on a machine, rather than in a Kubernetes pod.
+func (ctxt *Context) IsMachineCharm() bool {
+	return !ctxt.Kubernetes
+}
@@ -0,0 +1,37 @@
+package hook_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type identitySuite struct{}
+
+var _ = gc.Suite(&identitySuite{})
+
+func (s *identitySuite) TestIdentity(c *gc.C) {
+	ctxt := &hook.Context{
+		UUID:         "fff",
+		Unit:         "wordpress/3",
+		AgentVersion: "2.0.1",
+	}
+	c.Assert(ctxt.UnitName(), gc.Equals, "wordpress/3")
+	c.Assert(ctxt.ServiceName(), gc.Equals, "wordpress")
+	c.Assert(ctxt.EnvUUID(), gc.Equals, "fff")
+	c.Assert(ctxt.ModelUUID(), gc.Equals, "fff")
+	c.Assert(ctxt.JujuVersion(), gc.Equals, "2.0.1")
+	c.Assert(ctxt.IsMachineCharm(), gc.Equals, true)
+	c.Assert(ctxt.AvailabilityZone(), gc.Equals, "")
+	c.Assert(ctxt.MachineId(), gc.Equals, "")
+
+	ctxt.Environ = hook.Environ{
+		AvailabilityZone: "us-east-1c",
+		MachineId:        "4",
+	}
+	c.Assert(ctxt.AvailabilityZone(), gc.Equals, "us-east-1c")
+	c.Assert(ctxt.MachineId(), gc.Equals, "4")
+
+	ctxt.Kubernetes = true
+	c.Assert(ctxt.IsMachineCharm(), gc.Equals, false)
+}
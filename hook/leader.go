@@ -0,0 +1,59 @@
+package hook
+
+import (
+	"fmt"
+
+	"gopkg.in/errgo.v1"
+)
+
+// IsLeader reports whether the local unit is currently
+// the leader of its service. Juju guarantees that a unit
+// that is told it is the leader remains so for at least
+// 30 seconds.
+func (ctxt *Context) IsLeader() (bool, error) {
+	var leader bool
+	if err := ctxt.runJSON(&leader, "is-leader", "--format", "json"); err != nil {
+		return false, errgo.Mask(err, errgo.Is(ErrUnimplemented))
+	}
+	return leader, nil
+}
+
+// GetLeaderSettings returns all the settings that have been
+// set by the service leader.
+func (ctxt *Context) GetLeaderSettings() (map[string]string, error) {
+	var val map[string]string
+	if err := ctxt.runJSON(&val, "leader-get", "--format", "json"); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(ErrUnimplemented))
+	}
+	return val, nil
+}
+
+// GetLeaderSetting returns the value of the leader setting
+// with the given key, or the empty string if it is not set.
+func (ctxt *Context) GetLeaderSetting(key string) (string, error) {
+	var val string
+	if err := ctxt.runJSON(&val, "leader-get", "--format", "json", "--", key); err != nil {
+		return "", errgo.Mask(err, errgo.Is(ErrUnimplemented))
+	}
+	return val, nil
+}
+
+// SetLeaderSettings sets the given key-value pairs in the leader
+// settings, which are visible to all units of the service. Setting
+// a value to the empty string removes it. Only the leader may
+// change the leader settings.
+func (ctxt *Context) SetLeaderSettings(keyvals ...string) error {
+	if len(keyvals)%2 != 0 {
+		return errgo.Newf("invalid key/value count")
+	}
+	if len(keyvals) == 0 {
+		return nil
+	}
+	args := make([]string, 0, 1+len(keyvals)/2)
+	args = append(args, "--")
+	for i := 0; i < len(keyvals); i += 2 {
+		args = append(args, fmt.Sprintf("%s=%s", keyvals[i], keyvals[i+1]))
+	}
+	_, err := ctxt.Runner.Run("leader-set", args...)
+	return errgo.Mask(err)
+}
@@ -0,0 +1,172 @@
+package hook
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// LogLevel holds the severity of a log message,
+// as understood by juju-log.
+type LogLevel string
+
+const (
+	LogDebug   LogLevel = "DEBUG"
+	LogInfo    LogLevel = "INFO"
+	LogWarning LogLevel = "WARNING"
+	LogError   LogLevel = "ERROR"
+)
+
+// Debugf logs a message at DEBUG level through
+// the juju logging facility.
+func (ctxt *Context) Debugf(f string, a ...interface{}) error {
+	return ctxt.log(LogDebug, "", fmt.Sprintf(f, a...))
+}
+
+// Infof logs a message at INFO level through
+// the juju logging facility.
+func (ctxt *Context) Infof(f string, a ...interface{}) error {
+	return ctxt.log(LogInfo, "", fmt.Sprintf(f, a...))
+}
+
+// Warningf logs a message at WARNING level through
+// the juju logging facility.
+func (ctxt *Context) Warningf(f string, a ...interface{}) error {
+	return ctxt.log(LogWarning, "", fmt.Sprintf(f, a...))
+}
+
+// Errorf logs a message at ERROR level through
+// the juju logging facility.
+func (ctxt *Context) Errorf(f string, a ...interface{}) error {
+	return ctxt.log(LogError, "", fmt.Sprintf(f, a...))
+}
+
+// log logs the given message at the given level. If name is non-empty,
+// the message is prefixed with it. If no level is given, none is
+// passed to juju-log, which logs at INFO level.
+func (ctxt *Context) log(level LogLevel, name, msg string) error {
+	if name != "" {
+		msg = name + ": " + msg
+	}
+	logFile.write(ctxt, level, msg)
+	var args []string
+	if level != "" {
+		args = append(args, "--log-level", string(level))
+	}
+	args = append(args, msg)
+	_, err := ctxt.Runner.Run("juju-log", args...)
+	return errgo.Mask(err)
+}
+
+// Logger returns a Logger that logs messages prefixed with the given
+// name through the juju logging facility. It is intended to be used
+// for wiring up libraries used by the charm; Context.Debugf and
+// friends are usually more convenient in charm code.
+func (ctxt *Context) Logger(name string) *Logger {
+	return &Logger{
+		ctxt: ctxt,
+		name: name,
+	}
+}
+
+// Logger logs messages through juju-log. Unlike the Context logging
+// methods, its methods do not return errors, so that it can satisfy
+// the logging interfaces commonly used by third party packages. If
+// a message cannot be logged through juju-log, it is written to
+// standard error instead, which Juju also records.
+//
+// A Logger is also an io.Writer that logs each write at INFO level,
+// so it can be used as the output of a standard library log.Logger.
+type Logger struct {
+	ctxt *Context
+	name string
+}
+
+// Debugf logs a message at DEBUG level.
+func (l *Logger) Debugf(f string, a ...interface{}) {
+	l.log(LogDebug, fmt.Sprintf(f, a...))
+}
+
+// Infof logs a message at INFO level.
+func (l *Logger) Infof(f string, a ...interface{}) {
+	l.log(LogInfo, fmt.Sprintf(f, a...))
+}
+
+// Warningf logs a message at WARNING level.
+func (l *Logger) Warningf(f string, a ...interface{}) {
+	l.log(LogWarning, fmt.Sprintf(f, a...))
+}
+
+// Errorf logs a message at ERROR level.
+func (l *Logger) Errorf(f string, a ...interface{}) {
+	l.log(LogError, fmt.Sprintf(f, a...))
+}
+
+// Printf logs a message at INFO level.
+func (l *Logger) Printf(f string, a ...interface{}) {
+	l.log(LogInfo, fmt.Sprintf(f, a...))
+}
+
+// Write implements io.Writer by logging the given
+// data at INFO level. A trailing newline is
+// removed.
+func (l *Logger) Write(data []byte) (int, error) {
+	l.log(LogInfo, strings.TrimSuffix(string(data), "\n"))
+	return len(data), nil
+}
+
+func (l *Logger) log(level LogLevel, msg string) {
+	if err := l.ctxt.log(level, l.name, msg); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot log message: %v\n%s %s: %s\n", err, level, l.name, msg)
+	}
+}
+
+// logFile holds the file that log messages are
+// copied to, if LogToFile has been called.
+var logFile teeFile
+
+type teeFile struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// LogToFile arranges that all messages logged through a Context
+// (including those logged with Logf) are also appended to the given
+// file, which is created if necessary. This can be useful when
+// debugging a charm on a unit, as the messages are then available
+// without needing access to the Juju log.
+//
+// If path is empty, copying to any earlier file is stopped.
+func LogToFile(path string) error {
+	logFile.mu.Lock()
+	defer logFile.mu.Unlock()
+	if logFile.f != nil {
+		logFile.f.Close()
+		logFile.f = nil
+	}
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	logFile.f = f
+	return nil
+}
+
+func (t *teeFile) write(ctxt *Context, level LogLevel, msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil {
+		return
+	}
+	if level == "" {
+		level = LogInfo
+	}
+	fmt.Fprintf(t.f, "%s %s %s %s: %s\n", time.Now().UTC().Format("2006-01-02 15:04:05"), level, ctxt.Unit, ctxt.HookName, msg)
+}
@@ -0,0 +1,103 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type logSuite struct{}
+
+var _ = gc.Suite(&logSuite{})
+
+// recordingRunner is a hook.ToolRunner that records
+// all the commands run. The output of each command
+// is taken from the output field, keyed by command name.
+type recordingRunner struct {
+	record [][]string
+	output map[string]string
+	err    error
+}
+
+func (r *recordingRunner) Run(cmd string, args ...string) ([]byte, error) {
+	r.record = append(r.record, append([]string{cmd}, args...))
+	if r.err != nil {
+		return nil, r.err
+	}
+	return []byte(r.output[cmd]), nil
+}
+
+func (r *recordingRunner) Close() error {
+	return nil
+}
+
+func (s *logSuite) TestLevels(c *gc.C) {
+	runner := &recordingRunner{}
+	ctxt := &hook.Context{
+		Runner: runner,
+	}
+	ctxt.Logf("plain %d", 1)
+	ctxt.Debugf("debug %d", 2)
+	ctxt.Infof("info %d", 3)
+	ctxt.Warningf("warning %d", 4)
+	ctxt.Errorf("error %d", 5)
+	c.Assert(runner.record, jc.DeepEquals, [][]string{
+		{"juju-log", "plain 1"},
+		{"juju-log", "--log-level", "DEBUG", "debug 2"},
+		{"juju-log", "--log-level", "INFO", "info 3"},
+		{"juju-log", "--log-level", "WARNING", "warning 4"},
+		{"juju-log", "--log-level", "ERROR", "error 5"},
+	})
+}
+
+func (s *logSuite) TestLogger(c *gc.C) {
+	runner := &recordingRunner{}
+	ctxt := &hook.Context{
+		Runner: runner,
+	}
+	logger := ctxt.Logger("mylib")
+	logger.Debugf("hello %s", "world")
+	logger.Printf("printf")
+	stdLogger := log.New(logger, "", 0)
+	stdLogger.Printf("from log")
+	c.Assert(runner.record, jc.DeepEquals, [][]string{
+		{"juju-log", "--log-level", "DEBUG", "mylib: hello world"},
+		{"juju-log", "--log-level", "INFO", "mylib: printf"},
+		{"juju-log", "--log-level", "INFO", "mylib: from log"},
+	})
+
+	// Failures don't cause the logger to fail.
+	runner.err = errgo.New("no logging today")
+	logger.Errorf("ignored")
+}
+
+func (s *logSuite) TestLogToFile(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "log")
+	err := hook.LogToFile(path)
+	c.Assert(err, gc.IsNil)
+	defer hook.LogToFile("")
+	ctxt := &hook.Context{
+		Unit:     "foo/0",
+		HookName: "install",
+		Runner:   &recordingRunner{},
+	}
+	ctxt.Logf("one")
+	ctxt.Warningf("two")
+	err = hook.LogToFile("")
+	c.Assert(err, gc.IsNil)
+	ctxt.Logf("three")
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	c.Assert(lines, gc.HasLen, 2)
+	c.Assert(lines[0], gc.Matches, `[0-9-]+ [0-9:]+ INFO foo/0 install: one`)
+	c.Assert(lines[1], gc.Matches, `[0-9-]+ [0-9:]+ WARNING foo/0 install: two`)
+}
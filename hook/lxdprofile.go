@@ -0,0 +1,110 @@
+package hook
+
+import (
+	"reflect"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// LXDProfile holds the LXD profile settings that the charm needs
+// when it is deployed in an LXD container, as declared in the
+// charm's lxd-profile.yaml.
+type LXDProfile struct {
+	// Config holds the LXD configuration settings,
+	// for example "security.nesting".
+	Config map[string]string
+
+	// Devices holds the settings of each device,
+	// keyed by device name. Each device must have
+	// its "type" setting set.
+	Devices map[string]map[string]string
+}
+
+// lxdDeviceTypes holds the device types that Juju
+// allows in a charm's LXD profile.
+var lxdDeviceTypes = map[string]bool{
+	"gpu":        true,
+	"unix-block": true,
+	"unix-char":  true,
+	"usb":        true,
+}
+
+// RegisterLXDProfileConfig registers an LXD configuration setting
+// to be included in the charm's lxd-profile.yaml. It panics if the
+// key is not allowed in a charm's profile (Juju does not allow the
+// boot, limits or migration settings), or if the key is already
+// registered with a different value.
+func (r *Registry) RegisterLXDProfileConfig(key, value string) {
+	if err := ValidateLXDProfileConfig(key); err != nil {
+		panic(err)
+	}
+	if old, ok := r.lxdProfile.Config[key]; ok && old != value {
+		panic(errgo.Newf("LXD profile config %q is already registered with a different value (%q)", key, old))
+	}
+	if r.lxdProfile.Config == nil {
+		r.lxdProfile.Config = make(map[string]string)
+	}
+	r.lxdProfile.Config[key] = value
+}
+
+// RegisterLXDProfileDevice registers an LXD device to be included in
+// the charm's lxd-profile.yaml. It panics if the device's type is not
+// allowed in a charm's profile, or if a device with the same name is
+// already registered with different settings.
+func (r *Registry) RegisterLXDProfileDevice(name string, device map[string]string) {
+	if err := ValidateLXDProfileDevice(name, device); err != nil {
+		panic(err)
+	}
+	if old, ok := r.lxdProfile.Devices[name]; ok && !reflect.DeepEqual(old, device) {
+		panic(errgo.Newf("LXD profile device %q is already registered with different settings (%v)", name, old))
+	}
+	if r.lxdProfile.Devices == nil {
+		r.lxdProfile.Devices = make(map[string]map[string]string)
+	}
+	settings := make(map[string]string)
+	for key, val := range device {
+		settings[key] = val
+	}
+	r.lxdProfile.Devices[name] = settings
+}
+
+// RegisteredLXDProfile returns the LXD profile settings that have
+// been registered with RegisterLXDProfileConfig and
+// RegisterLXDProfileDevice, or nil if there are none.
+func (r *Registry) RegisteredLXDProfile() *LXDProfile {
+	if len(r.lxdProfile.Config) == 0 && len(r.lxdProfile.Devices) == 0 {
+		return nil
+	}
+	return &r.lxdProfile
+}
+
+// ValidateLXDProfileConfig returns an error if the given LXD
+// configuration key is not allowed in a charm's LXD profile.
+func ValidateLXDProfileConfig(key string) error {
+	if key == "" {
+		return errgo.New("empty LXD profile config key")
+	}
+	for _, prefix := range []string{"boot", "limits", "migration"} {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return errgo.Newf("LXD profile config %q not allowed in a charm", key)
+		}
+	}
+	return nil
+}
+
+// ValidateLXDProfileDevice returns an error if the given LXD device
+// is not allowed in a charm's LXD profile.
+func ValidateLXDProfileDevice(name string, device map[string]string) error {
+	if name == "" {
+		return errgo.New("empty LXD profile device name")
+	}
+	devType := device["type"]
+	if devType == "" {
+		return errgo.Newf("no type given for LXD profile device %q", name)
+	}
+	if !lxdDeviceTypes[devType] {
+		return errgo.Newf("LXD profile device %q has type %q, which is not allowed in a charm", name, devType)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type lxdProfileSuite struct{}
+
+var _ = gc.Suite(&lxdProfileSuite{})
+
+func (*lxdProfileSuite) TestRegisterLXDProfile(c *gc.C) {
+	r := hook.NewRegistry()
+	c.Assert(r.RegisteredLXDProfile(), gc.IsNil)
+	r.RegisterLXDProfileConfig("security.nesting", "true")
+	r.Clone("other").RegisterLXDProfileConfig("security.nesting", "true")
+	device := map[string]string{"type": "unix-char", "path": "/dev/net/tun"}
+	r.RegisterLXDProfileDevice("tun", device)
+	// Changing the map after registration makes no difference.
+	device["path"] = "/dev/other"
+	c.Assert(r.RegisteredLXDProfile(), jc.DeepEquals, &hook.LXDProfile{
+		Config: map[string]string{
+			"security.nesting": "true",
+		},
+		Devices: map[string]map[string]string{
+			"tun": {"type": "unix-char", "path": "/dev/net/tun"},
+		},
+	})
+}
+
+var registerLXDProfilePanicTests = []struct {
+	about       string
+	register    func(r *hook.Registry)
+	expectPanic string
+}{{
+	about: "forbidden config",
+	register: func(r *hook.Registry) {
+		r.RegisterLXDProfileConfig("limits.cpu", "2")
+	},
+	expectPanic: `LXD profile config "limits.cpu" not allowed in a charm`,
+}, {
+	about: "conflicting config",
+	register: func(r *hook.Registry) {
+		r.RegisterLXDProfileConfig("security.nesting", "true")
+		r.RegisterLXDProfileConfig("security.nesting", "false")
+	},
+	expectPanic: `LXD profile config "security.nesting" is already registered with a different value \("true"\)`,
+}, {
+	about: "forbidden device",
+	register: func(r *hook.Registry) {
+		r.RegisterLXDProfileDevice("root", map[string]string{"type": "disk", "path": "/"})
+	},
+	expectPanic: `LXD profile device "root" has type "disk", which is not allowed in a charm`,
+}, {
+	about: "unknown device type",
+	register: func(r *hook.Registry) {
+		r.RegisterLXDProfileDevice("data", map[string]string{"type": "unix-disk"})
+	},
+	expectPanic: `LXD profile device "data" has type "unix-disk", which is not allowed in a charm`,
+}, {
+	about: "conflicting device",
+	register: func(r *hook.Registry) {
+		r.RegisterLXDProfileDevice("gpu0", map[string]string{"type": "gpu"})
+		r.RegisterLXDProfileDevice("gpu0", map[string]string{"type": "gpu", "id": "1"})
+	},
+	expectPanic: `LXD profile device "gpu0" is already registered with different settings .*`,
+}}
+
+func (*lxdProfileSuite) TestRegisterLXDProfilePanics(c *gc.C) {
+	for i, test := range registerLXDProfilePanicTests {
+		c.Logf("test %d: %s", i, test.about)
+		r := hook.NewRegistry()
+		c.Assert(func() {
+			test.register(r)
+		}, gc.PanicMatches, test.expectPanic)
+	}
+}
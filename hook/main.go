@@ -2,16 +2,24 @@ package hook
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/errgo.v1"
 )
 
 const (
 	envUUID          = "JUJU_ENV_UUID"
+	envModelUUID     = "JUJU_MODEL_UUID"
+	envVersion       = "JUJU_VERSION"
+	envKubernetes    = "KUBERNETES_SERVICE_HOST"
 	envUnitName      = "JUJU_UNIT_NAME"
 	envCharmDir      = "CHARM_DIR"
 	envJujuContextId = "JUJU_CONTEXT_ID"
@@ -19,14 +27,22 @@ const (
 	envRelationId    = "JUJU_RELATION_ID"
 	envRemoteUnit    = "JUJU_REMOTE_UNIT"
 	envSocketPath    = "JUJU_AGENT_SOCKET"
+	envSocketAddress = "JUJU_AGENT_SOCKET_ADDRESS"
+	envSocketNetwork = "JUJU_AGENT_SOCKET_NETWORK"
+	envToolTransport = "GOCHARM_HOOK_TOOLS"
+	envDispatchPath  = "JUJU_DISPATCH_PATH"
+	envHookName      = "JUJU_HOOK_NAME"
 )
 
+// mustEnvVars holds the environment variables that must be set
+// when running a hook. Either $JUJU_ENV_UUID or $JUJU_MODEL_UUID (set
+// by later versions of Juju) must also be set. The agent socket
+// is not required, because the hook tools can be run from $PATH
+// instead (see NewExecToolRunner).
 var mustEnvVars = []string{
-	envUUID,
 	envUnitName,
 	envCharmDir,
 	envJujuContextId,
-	envSocketPath,
 }
 
 var relationEnvVars = []string{
@@ -43,9 +59,34 @@ var relationEnvVars = []string{
 // to the hooks; the state value is used to retrieve
 // and save persistent state.
 //
+// A hook that has no functions registered is not an error, because
+// gocharm also generates hooks that are registered only under some
+// conditions; only the wildcard hook functions run. Main returns a
+// usage error if the hook name is not one that Juju can run.
+//
+// If a hook function panics, the panic is recovered, its stack trace
+// is logged through juju-log and appended to ctxt.CrashFile(), the
+// unit's status is set to blocked, and Main returns an error
+// describing the panic.
+//
+// A hook function can return a BlockedError or a RetryableError
+// to change how the failure is reported; see their documentation
+// for details. The cause of an error returned by Main is a
+// *RetryableError if a hook function failed with one, so ExitCode
+// can be used to find the appropriate exit status.
+//
+// When the runhook executable is run as "runhook shell" (for example
+// from a juju debug-hooks session), Main runs an interactive shell
+// that can call Context methods such as GetConfig, SetRelation
+// and SetStatus, instead of running any hook functions. Persistent
+// state is neither loaded nor saved.
+//
 // This function is designed to be called by gocharm
 // generated code only.
 func Main(r *Registry, ctxt *Context, state PersistentState) (err error) {
+	if ctxt.shell {
+		return runShell(r, ctxt)
+	}
 	if ctxt.RunCommandName != "" {
 		log.Printf("running command %q %q", ctxt.RunCommandName, ctxt.RunCommandArgs)
 		cmd := r.commands[ctxt.RunCommandName]
@@ -57,11 +98,41 @@ func Main(r *Registry, ctxt *Context, state PersistentState) (err error) {
 	}
 	ctxt.Logf("running hook %s {", ctxt.HookName)
 	defer ctxt.Logf("} %s", ctxt.HookName)
+	if tracingEnabled(r, ctxt) {
+		finish, traceErr := startTrace(ctxt)
+		if traceErr != nil {
+			ctxt.Logf("cannot start trace: %v", traceErr)
+		} else {
+			defer func() {
+				finish(err)
+			}()
+		}
+	}
 	// Retrieve all persistent state.
 	// TODO read all of the state in one operation from a single file?
 	if err := loadState(r, state); err != nil {
 		return errgo.Mask(err)
 	}
+	if r.timeout > 0 {
+		done := make(chan struct{})
+		ctxt.done = done
+		ctxt.deadline = time.Now().Add(r.timeout)
+		t := time.AfterFunc(r.timeout, func() {
+			close(done)
+		})
+		defer t.Stop()
+	}
+	trackUnits := len(r.relations) > 0
+	if trackUnits {
+		if err := loadDeparted(ctxt, state); err != nil {
+			return errgo.Notef(err, "cannot load departed units")
+		}
+	}
+	if state != nil {
+		if err := loadConfig(ctxt, state); err != nil {
+			return errgo.Notef(err, "cannot load previous configuration")
+		}
+	}
 	// Notify everyone about the context.
 	for _, setter := range r.contexts {
 		if err := setter(ctxt); err != nil {
@@ -69,8 +140,33 @@ func Main(r *Registry, ctxt *Context, state PersistentState) (err error) {
 		}
 	}
 	defer func() {
+		if ctxt.removeState && err == nil {
+			// The unit has been torn down, so there
+			// is no state left to save.
+			if remover, ok := state.(stateRemover); ok {
+				if removeErr := remover.removeAll(); removeErr != nil {
+					err = errgo.Notef(removeErr, "cannot remove local state")
+				}
+			}
+			return
+		}
 		// All the hooks have now run; save the state.
 		saveErr := saveState(r, state)
+		if saveErr == nil && err == nil && trackUnits {
+			// Record the units seen only when the hook succeeds,
+			// so that if it is retried, it sees the same departed
+			// units.
+			if seenErr := saveSeen(ctxt, state); seenErr != nil {
+				saveErr = errgo.Notef(seenErr, "cannot save relation units")
+			}
+		}
+		if saveErr == nil && err == nil && ctxt.HookName == "config-changed" {
+			// Similarly, the configuration becomes the previous
+			// configuration only when config-changed succeeds.
+			if configErr := saveConfig(ctxt, state); configErr != nil {
+				saveErr = errgo.Notef(configErr, "cannot save configuration")
+			}
+		}
 		if saveErr == nil {
 			return
 		}
@@ -81,25 +177,58 @@ func Main(r *Registry, ctxt *Context, state PersistentState) (err error) {
 		ctxt.Logf("cannot save local state: %v", saveErr)
 	}()
 
+	if ctxt.HookName == "install" || ctxt.HookName == "upgrade-charm" {
+		if err := runMigrations(r, ctxt, state); err != nil {
+			return errgo.Mask(err, isRetryable)
+		}
+	}
+
 	// The wildcard hook always runs after any other
 	// registered hooks.
 	hookFuncs := r.hooks[ctxt.HookName]
 
 	if len(hookFuncs) == 0 {
-		ctxt.Logf("hook %q not registered", ctxt.HookName)
-		return usageError(r)
+		if !validHookName(ctxt.HookName) {
+			ctxt.Logf("hook %q not registered", ctxt.HookName)
+			return usageError(r)
+		}
+		// gocharm generates hooks that are registered only
+		// conditionally (see the builder's static discovery),
+		// so Juju may run a hook that has not been
+		// registered this time. That is not an error.
+		ctxt.Logf("no functions registered for hook %q", ctxt.HookName)
+	}
+	stopped, err := runHookFuncs(r, ctxt, state, sortedHookFuncs(hookFuncs))
+	if err != nil || stopped {
+		return errgo.Mask(err, isRetryable)
 	}
-	hookFuncs = append(hookFuncs, r.hooks["*"]...)
-	for _, f := range hookFuncs {
-		if err := f.run(); err != nil {
-			// TODO better error context here, perhaps
-			// including local state name, hook name, etc.
-			return errgo.Mask(err)
+	if ctxt.HookName == string(UpdateStatus) {
+		stopped, err := runRescheduledHooks(r, ctxt, state)
+		if err != nil || stopped {
+			return errgo.Mask(err, isRetryable)
 		}
 	}
+	if _, err := runHookFuncs(r, ctxt, state, sortedHookFuncs(r.hooks["*"])); err != nil {
+		return errgo.Mask(err, isRetryable)
+	}
 	return nil
 }
 
+// sortedHookFuncs returns a copy of the given functions
+// sorted by priority, preserving registration order
+// for functions with equal priority.
+func sortedHookFuncs(funcs []hookFunc) []hookFunc {
+	funcs = append([]hookFunc(nil), funcs...)
+	sort.Stable(byPriority(funcs))
+	return funcs
+}
+
+type byPriority []hookFunc
+
+func (f byPriority) Len() int           { return len(f) }
+func (f byPriority) Less(i, j int) bool { return f[i].priority < f[j].priority }
+func (f byPriority) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
 func loadState(r *Registry, state PersistentState) error {
 	for _, val := range r.state {
 		data, err := state.Load(val.registryName)
@@ -156,10 +285,69 @@ func RegisterMainHooks(r *Registry) {
 	// We always need install and start hooks.
 	r.RegisterHook("install", nop)
 	r.RegisterHook("start", nop)
-	// TODO Perhaps... ensure that we have a stop hook, and make
-	// it clean up our persistent state. But that may not be
-	// right if "stop" is considered something we can start
-	// from again.
+	registerPortsHook(r)
+	// The stop hook runs the teardown functions and
+	// cleans up the persistent state.
+	registerTeardownHook(r)
+}
+
+// RunMain runs the runhook executable for the given registry, on
+// which the charm's hooks must already have been registered, and
+// exits. It registers the hooks needed by every charm (see
+// RegisterMainHooks), creates the context from the environment and
+// calls Main, exiting with the status returned by ExitCode so that
+// a RetryableError is reported to Juju as such. When the executable
+// is run as "runhook version", it prints BuildInfo instead.
+//
+// The generated main package, and any custom template for it
+// (see gocharm's documentation), must call RunMain.
+func RunMain(r *Registry) {
+	os.Exit(runMain(r, os.Stdout, os.Stderr))
+}
+
+// runMain implements RunMain, returning the exit status.
+func runMain(r *Registry, stdout, stderr io.Writer) int {
+	if len(os.Args) == 2 && os.Args[1] == "version" {
+		fmt.Fprintln(stdout, BuildInfo())
+		return 0
+	}
+	RegisterMainHooks(r)
+	ctxt, state, err := NewContextFromEnvironment(r)
+	if err != nil {
+		fmt.Fprintf(stderr, "runhook: cannot create context: %v\n", err)
+		return 1
+	}
+	err = Main(r, ctxt, state)
+	ctxt.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "runhook: %v\n", err)
+	}
+	return ExitCode(err)
+}
+
+// hookArgs returns the command line arguments with the hook name
+// as the first argument, using getenv to look up environment
+// variables. If the hook name is not given as an argument, as when
+// the charm binary is run by the dispatch script of a newer Juju
+// charm layout, it is taken from $JUJU_DISPATCH_PATH (for example
+// "hooks/install") or $JUJU_HOOK_NAME if either is set. Otherwise,
+// when the binary is invoked through a symbolic link in the charm's
+// hooks directory (as generated by gocharm -dispatch), the hook name
+// is taken from the name of the link.
+func hookArgs(args []string, getenv func(string) string) []string {
+	if len(args) != 1 {
+		return args
+	}
+	if p := getenv(envDispatchPath); p != "" && path.Dir(p) == "hooks" {
+		return []string{args[0], path.Base(p)}
+	}
+	if name := getenv(envHookName); name != "" {
+		return []string{args[0], name}
+	}
+	if filepath.Base(filepath.Dir(args[0])) == "hooks" {
+		return []string{args[0], filepath.Base(args[0])}
+	}
+	return args
 }
 
 // NewContextFromEnvironment creates a hook context from the current
@@ -170,44 +358,65 @@ func RegisterMainHooks(r *Registry) {
 // It also returns the persistent state associated with the context
 // unless called in a command-running context.
 //
+// If the hook name is "shell", the context is for the hook that is
+// currently running, as found from $JUJU_DISPATCH_PATH or
+// $JUJU_HOOK_NAME, and Main will run an interactive shell; see Main.
+//
 // The caller is responsible for calling Close on the returned
 // context.
 func NewContextFromEnvironment(r *Registry) (*Context, PersistentState, error) {
-	if len(os.Args) < 2 {
+	env := NewEnviron(os.Environ())
+	args := hookArgs(os.Args, env.Getenv)
+	if len(args) < 2 {
 		return nil, nil, usageError(r)
 	}
-	hookName := os.Args[1]
+	hookName := args[1]
 	if strings.HasPrefix(hookName, "cmd-") {
 		return &Context{
 			RunCommandName: strings.TrimPrefix(hookName, "cmd-"),
-			RunCommandArgs: os.Args[2:],
+			RunCommandArgs: args[2:],
 		}, nil, nil
 	}
 	vars := mustEnvVars
-	if os.Getenv(envRelationName) != "" {
+	if env.RelationName != "" {
 		vars = append(vars, relationEnvVars...)
 	}
 	for _, v := range vars {
-		if os.Getenv(v) == "" {
+		if env.Getenv(v) == "" {
 			return nil, nil, errgo.Newf("required environment variable %q not set", v)
 		}
 	}
-	if len(os.Args) != 2 {
+	if env.ModelUUID == "" {
+		return nil, nil, errgo.Newf("required environment variable %q not set", envUUID)
+	}
+	if len(args) != 2 {
 		return nil, nil, errgo.New("one argument required")
 	}
 	runner, err := newToolRunnerFromEnvironment()
 	if err != nil {
 		return nil, nil, errgo.Notef(err, "cannot make runner")
 	}
+	configureDefaultTransport()
+	shell := hookName == shellCommand
+	if shell {
+		if current := hookArgs(args[:1], env.Getenv); len(current) == 2 {
+			hookName = current[1]
+		}
+	}
+	env.HookName = hookName
 	ctxt := &Context{
-		UUID:         os.Getenv(envUUID),
-		Unit:         UnitId(os.Getenv(envUnitName)),
-		CharmDir:     os.Getenv(envCharmDir),
-		RelationName: os.Getenv(envRelationName),
-		RelationId:   RelationId(os.Getenv(envRelationId)),
-		RemoteUnit:   UnitId(os.Getenv(envRemoteUnit)),
+		UUID:         env.ModelUUID,
+		Unit:         env.UnitName,
+		CharmDir:     env.CharmDir,
+		RelationName: env.RelationName,
+		RelationId:   env.RelationId,
+		RemoteUnit:   env.RemoteUnit,
 		HookName:     hookName,
+		AgentVersion: env.Version,
+		Kubernetes:   os.Getenv(envKubernetes) != "",
+		Environ:      env,
 		Runner:       runner,
+		shell:        shell,
 	}
 
 	// Populate the relation fields of the ContextInfo
@@ -0,0 +1,125 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+)
+
+// migrationStateKey holds the persistent state key used to
+// record the version of the last migration that was applied.
+const migrationStateKey = "gocharm:migrations"
+
+// migration holds a function registered with RegisterMigration.
+type migration struct {
+	registryName string
+	version      int
+	run          func() error
+}
+
+// RegisterMigration registers a function that migrates the unit
+// from an earlier version of the charm to the given version. The
+// version may be a schema version that is increased whenever the
+// charm's local state or installed files change incompatibly, or
+// the charm revision that introduced the change; all that matters
+// is that later changes have higher versions. It panics if a
+// migration is already registered with the same version.
+//
+// When the upgrade-charm hook runs, the migrations with versions
+// higher than the last one applied to the unit are called in order
+// of version, before any functions registered for upgrade-charm
+// itself. The local state of all registries is loaded before the
+// migrations are called, and it is saved after each one succeeds,
+// along with its version. If a migration fails, the hook fails, and
+// when it is retried the migrations start again from the one that
+// failed.
+//
+// A unit that is installed with a charm that has migrations
+// starts at the highest registered version; none of the migrations
+// are run for it.
+func (r *Registry) RegisterMigration(version int, f func() error) {
+	for _, m := range r.migrations {
+		if m.version == version {
+			panic(errgo.Newf("migration %d registered twice", version))
+		}
+	}
+	r.migrations = append(r.migrations, migration{
+		registryName: r.name,
+		version:      version,
+		run:          f,
+	})
+	// Make sure that there is an upgrade-charm hook
+	// to run the migrations in.
+	r.RegisterHook("upgrade-charm", nop)
+}
+
+// runMigrations runs any migrations that have not yet been applied
+// to the unit, in version order, saving the state after each one.
+// In the install hook, it just records the latest version.
+func runMigrations(r *Registry, ctxt *Context, state PersistentState) error {
+	if len(r.migrations) == 0 {
+		return nil
+	}
+	migrations := append([]migration(nil), r.migrations...)
+	sort.Sort(byVersion(migrations))
+	latest := migrations[len(migrations)-1].version
+	current, ok, err := migrationVersion(state)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if ctxt.HookName == "install" {
+		if ok {
+			return nil
+		}
+		return saveMigrationVersion(state, latest)
+	}
+	for _, m := range migrations {
+		if ok && m.version <= current {
+			continue
+		}
+		ctxt.Logf("running migration %d (registry %s)", m.version, m.registryName)
+		if err := m.run(); err != nil {
+			return errgo.NoteMask(err, fmt.Sprintf("migration %d (registry %s)", m.version, m.registryName), isRetryable)
+		}
+		if err := saveState(r, state); err != nil {
+			return errgo.Notef(err, "cannot save local state after migration %d", m.version)
+		}
+		if err := saveMigrationVersion(state, m.version); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// migrationVersion returns the version of the last migration applied
+// to the unit, and whether any version has been recorded.
+func migrationVersion(state PersistentState) (int, bool, error) {
+	data, err := state.Load(migrationStateKey)
+	if err != nil || data == nil {
+		return 0, false, errgo.Mask(err)
+	}
+	var version int
+	if err := json.Unmarshal(data, &version); err != nil {
+		return 0, false, errgo.Notef(err, "cannot unmarshal migration version")
+	}
+	return version, true, nil
+}
+
+func saveMigrationVersion(state PersistentState, version int) error {
+	data, err := json.Marshal(version)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := state.Save(migrationStateKey, data); err != nil {
+		return errgo.Notef(err, "cannot save migration version")
+	}
+	return nil
+}
+
+type byVersion []migration
+
+func (m byVersion) Len() int           { return len(m) }
+func (m byVersion) Less(i, j int) bool { return m[i].version < m[j].version }
+func (m byVersion) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
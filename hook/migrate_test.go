@@ -0,0 +1,113 @@
+package hook_test
+
+import (
+	"fmt"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type migrateSuite struct{}
+
+var _ = gc.Suite(&migrateSuite{})
+
+type migrateState struct {
+	Applied []int
+}
+
+func (s *migrateSuite) TestMigrations(c *gc.C) {
+	var (
+		versions []int
+		fail     = make(map[int]bool)
+		calls    []string
+		state    migrateState
+	)
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			state = migrateState{}
+			r.RegisterContext(func(*hook.Context) error { return nil }, &state)
+			for _, v := range versions {
+				v := v
+				r.Clone(fmt.Sprintf("v%d", v)).RegisterMigration(v, func() error {
+					calls = append(calls, fmt.Sprintf("v%d", v))
+					if fail[v] {
+						return errgo.Newf("cannot migrate to %d", v)
+					}
+					state.Applied = append(state.Applied, v)
+					return nil
+				})
+			}
+			r.RegisterHook("upgrade-charm", func() error {
+				calls = append(calls, "upgrade-charm")
+				return nil
+			})
+		},
+		Logger: c,
+	}
+
+	// A newly installed unit is already at the latest version.
+	versions = []int{1, 2}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(calls, jc.DeepEquals, []string{"upgrade-charm"})
+
+	// New migrations are run in version order before
+	// the upgrade-charm hook functions.
+	calls = nil
+	versions = []int{5, 1, 4, 2, 3}
+	fail[4] = true
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.ErrorMatches, `migration 4 \(registry root\.v4\): cannot migrate to 4`)
+	c.Assert(calls, jc.DeepEquals, []string{"v3", "v4"})
+	c.Assert(state.Applied, jc.DeepEquals, []int{3})
+
+	// When the hook is retried, migration starts from
+	// the one that failed, with the state saved by the
+	// ones before it.
+	calls = nil
+	delete(fail, 4)
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(calls, jc.DeepEquals, []string{"v4", "v5", "upgrade-charm"})
+	c.Assert(state.Applied, jc.DeepEquals, []int{3, 4, 5})
+
+	calls = nil
+	err = runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(calls, jc.DeepEquals, []string{"upgrade-charm"})
+}
+
+func (s *migrateSuite) TestUnrecordedVersionRunsAllMigrations(c *gc.C) {
+	var calls []int
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			for _, v := range []int{20, 10} {
+				v := v
+				r.RegisterMigration(v, func() error {
+					calls = append(calls, v)
+					return nil
+				})
+			}
+		},
+		Logger: c,
+	}
+	// The unit was installed with a charm that had
+	// no migrations.
+	err := runner.RunHook("upgrade-charm", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(calls, jc.DeepEquals, []int{10, 20})
+}
+
+func (s *migrateSuite) TestRegisterMigrationTwice(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterMigration(1, func() error { return nil })
+	c.Assert(func() {
+		r.Clone("foo").RegisterMigration(1, func() error { return nil })
+	}, gc.PanicMatches, `migration 1 registered twice`)
+}
@@ -0,0 +1,196 @@
+package hook
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// PortRange represents a range of ports opened with a
+// given protocol. A single port is represented by
+// a range with equal FromPort and ToPort.
+type PortRange struct {
+	FromPort int
+	ToPort   int
+	Protocol string
+}
+
+// String returns the range in the form used by
+// the open-port and opened-ports hook tools,
+// for example "80/tcp" or "8000-8080/udp".
+func (p PortRange) String() string {
+	if p.FromPort == p.ToPort {
+		return fmt.Sprintf("%d/%s", p.FromPort, p.Protocol)
+	}
+	return fmt.Sprintf("%d-%d/%s", p.FromPort, p.ToPort, p.Protocol)
+}
+
+// ParsePortRange parses a port range in the form
+// returned by PortRange.String.
+func ParsePortRange(s string) (PortRange, error) {
+	i := strings.Index(s, "/")
+	if i == -1 {
+		return PortRange{}, errgo.Newf("invalid port range %q: no protocol", s)
+	}
+	p := PortRange{
+		Protocol: s[i+1:],
+	}
+	from, to := s[0:i], s[0:i]
+	if j := strings.Index(from, "-"); j != -1 {
+		from, to = from[0:j], from[j+1:]
+	}
+	var err error
+	if p.FromPort, err = strconv.Atoi(from); err != nil {
+		return PortRange{}, errgo.Newf("invalid port range %q", s)
+	}
+	if p.ToPort, err = strconv.Atoi(to); err != nil {
+		return PortRange{}, errgo.Newf("invalid port range %q", s)
+	}
+	if p.FromPort > p.ToPort {
+		return PortRange{}, errgo.Newf("invalid port range %q: start port greater than end port", s)
+	}
+	return p, nil
+}
+
+// OpenPortRange opens all the ports from the given
+// start port to the given end port, inclusive,
+// using the given protocol.
+func (ctxt *Context) OpenPortRange(proto string, from, to int) error {
+	_, err := ctxt.Runner.Run("open-port", PortRange{from, to, proto}.String())
+	return errgo.Mask(err)
+}
+
+// ClosePortRange closes a range of ports previously
+// opened with OpenPortRange.
+func (ctxt *Context) ClosePortRange(proto string, from, to int) error {
+	_, err := ctxt.Runner.Run("close-port", PortRange{from, to, proto}.String())
+	return errgo.Mask(err)
+}
+
+// OpenedPorts returns all the ports currently opened
+// by the local unit.
+//
+// If the Juju agent does not implement the opened-ports
+// hook tool, the returned error will have an ErrUnimplemented
+// cause.
+func (ctxt *Context) OpenedPorts() ([]PortRange, error) {
+	var ports []string
+	if err := ctxt.runJSON(&ports, "opened-ports", "--format", "json"); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(ErrUnimplemented))
+	}
+	ranges := make([]PortRange, len(ports))
+	for i, s := range ports {
+		p, err := ParsePortRange(s)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		ranges[i] = p
+	}
+	return ranges, nil
+}
+
+// RegisterPorts registers a function that returns ports that the
+// charm requires to be open. Whenever the config-changed hook
+// runs, all the functions registered with RegisterPorts are called
+// and the ports they return are opened. Any ports that were
+// previously returned but are not returned any longer are
+// closed.
+//
+// Ports opened directly with OpenPort or OpenPortRange are left
+// alone.
+func (r *Registry) RegisterPorts(f func() ([]PortRange, error)) {
+	r.ports = append(r.ports, f)
+}
+
+// portsStateName holds the name under which the
+// state for declared ports is saved. It does not start
+// with "root", so it cannot clash with any registry name.
+const portsStateName = "ports"
+
+// portsState holds the persistent state for declared ports.
+type portsState struct {
+	// Declared holds all the ports that were declared
+	// when the ports were last reconciled.
+	Declared []string
+}
+
+// registerPortsHook registers the hook that reconciles
+// the ports declared with RegisterPorts.
+func registerPortsHook(r *Registry) {
+	if len(r.ports) == 0 {
+		return
+	}
+	var (
+		ctxt  *Context
+		state portsState
+	)
+	r.contexts = append(r.contexts, func(c *Context) error {
+		ctxt = c
+		return nil
+	})
+	r.state = append(r.state, localState{
+		registryName: portsStateName,
+		val:          &state,
+	})
+	r.RegisterHook("config-changed", func() error {
+		return reconcilePorts(ctxt, r.ports, &state)
+	})
+}
+
+// reconcilePorts opens all the ports returned by the given
+// functions and closes any that were previously declared
+// but are no longer.
+func reconcilePorts(ctxt *Context, funcs []func() ([]PortRange, error), state *portsState) error {
+	wanted := make(map[string]bool)
+	for _, f := range funcs {
+		ports, err := f()
+		if err != nil {
+			return errgo.Notef(err, "cannot get declared ports")
+		}
+		for _, p := range ports {
+			wanted[p.String()] = true
+		}
+	}
+	opened := make(map[string]bool)
+	ports, err := ctxt.OpenedPorts()
+	switch {
+	case err == nil:
+		for _, p := range ports {
+			opened[p.String()] = true
+		}
+	case errgo.Cause(err) == ErrUnimplemented:
+		// We can't find out what's open, so assume
+		// that the ports we opened last time still are.
+		for _, p := range state.Declared {
+			opened[p] = true
+		}
+	default:
+		return errgo.Mask(err)
+	}
+	for _, p := range state.Declared {
+		if wanted[p] || !opened[p] {
+			continue
+		}
+		if _, err := ctxt.Runner.Run("close-port", p); err != nil {
+			return errgo.Notef(err, "cannot close port %s", p)
+		}
+	}
+	declared := make([]string, 0, len(wanted))
+	for p := range wanted {
+		declared = append(declared, p)
+	}
+	sort.Strings(declared)
+	for _, p := range declared {
+		if opened[p] {
+			continue
+		}
+		if _, err := ctxt.Runner.Run("open-port", p); err != nil {
+			return errgo.Notef(err, "cannot open port %s", p)
+		}
+	}
+	state.Declared = declared
+	return nil
+}
@@ -0,0 +1,148 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type portsSuite struct{}
+
+var _ = gc.Suite(&portsSuite{})
+
+var parsePortRangeTests = []struct {
+	about       string
+	s           string
+	expect      hook.PortRange
+	expectError string
+}{{
+	about:  "single port",
+	s:      "80/tcp",
+	expect: hook.PortRange{80, 80, "tcp"},
+}, {
+	about:  "port range",
+	s:      "8000-8080/udp",
+	expect: hook.PortRange{8000, 8080, "udp"},
+}, {
+	about:       "no protocol",
+	s:           "80",
+	expectError: `invalid port range "80": no protocol`,
+}, {
+	about:       "bad port",
+	s:           "http/tcp",
+	expectError: `invalid port range "http/tcp"`,
+}, {
+	about:       "bad end port",
+	s:           "80-x/tcp",
+	expectError: `invalid port range "80-x/tcp"`,
+}, {
+	about:       "reversed range",
+	s:           "90-80/tcp",
+	expectError: `invalid port range "90-80/tcp": start port greater than end port`,
+}}
+
+func (s *portsSuite) TestParsePortRange(c *gc.C) {
+	for i, test := range parsePortRangeTests {
+		c.Logf("test %d: %s", i, test.about)
+		p, err := hook.ParsePortRange(test.s)
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(p, jc.DeepEquals, test.expect)
+		c.Assert(p.String(), gc.Equals, test.s)
+	}
+}
+
+func (s *portsSuite) TestOpenedPorts(c *gc.C) {
+	var ctxt *hook.Context
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterContext(func(c *hook.Context) error {
+				ctxt = c
+				return nil
+			}, nil)
+			r.RegisterHook("install", func() error {
+				if err := ctxt.OpenPort("tcp", 80); err != nil {
+					return err
+				}
+				return ctxt.OpenPortRange("udp", 1000, 2000)
+			})
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, jc.DeepEquals, [][]string{
+		{"open-port", "80/tcp"},
+		{"open-port", "1000-2000/udp"},
+	})
+	ports, err := ctxt.OpenedPorts()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ports, jc.DeepEquals, []hook.PortRange{
+		{1000, 2000, "udp"},
+		{80, 80, "tcp"},
+	})
+}
+
+func (s *portsSuite) TestRegisterPorts(c *gc.C) {
+	var ctxt *hook.Context
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterConfig("port", charm.Option{
+				Type: "int",
+			})
+			r.RegisterContext(func(c *hook.Context) error {
+				ctxt = c
+				return nil
+			}, nil)
+			r.RegisterPorts(func() ([]hook.PortRange, error) {
+				port, err := ctxt.GetConfigInt("port")
+				if err != nil {
+					return nil, err
+				}
+				return []hook.PortRange{{port, port, "tcp"}}, nil
+			})
+			r.RegisterHook("install", func() error {
+				// This port is opened directly, so it
+				// should be left alone.
+				return ctxt.OpenPort("tcp", 22)
+			})
+		},
+		Config: map[string]interface{}{
+			"port": 80,
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.OpenedPorts, jc.DeepEquals, map[string]bool{
+		"22/tcp": true,
+		"80/tcp": true,
+	})
+
+	// Running the hook again with the same
+	// config should do nothing.
+	runner.Record = nil
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, gc.HasLen, 0)
+
+	runner.Config["port"] = 8080
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.Record, jc.DeepEquals, [][]string{
+		{"close-port", "80/tcp"},
+		{"open-port", "8080/tcp"},
+	})
+	c.Assert(runner.OpenedPorts, jc.DeepEquals, map[string]bool{
+		"22/tcp":   true,
+		"8080/tcp": true,
+	})
+}
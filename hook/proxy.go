@@ -0,0 +1,159 @@
+package hook
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// ProxySettings holds the proxy settings for the model
+// that a unit is running in.
+type ProxySettings struct {
+	HTTP    string
+	HTTPS   string
+	FTP     string
+	NoProxy string
+}
+
+// ProxySettings returns the proxy settings that Juju provides to the
+// hook. The settings that Juju provides specifically for charms
+// ($JUJU_CHARM_HTTP_PROXY, $JUJU_CHARM_HTTPS_PROXY,
+// $JUJU_CHARM_FTP_PROXY and $JUJU_CHARM_NO_PROXY) take precedence
+// over those in the usual $http_proxy, $https_proxy, $ftp_proxy and
+// $no_proxy variables, which older versions of Juju set instead.
+//
+// The settings are read from ctxt.Environ. The package-level helpers
+// that have no context, such as InstallPackages and the other apt
+// helpers, Fetch and http.DefaultTransport when a hook runs, read the
+// same variables from the process environment instead.
+func (ctxt *Context) ProxySettings() ProxySettings {
+	return proxySettings(ctxt.Environ.Getenv)
+}
+
+// legacyProxyVars holds the proxy variables set by older versions
+// of Juju. They are kept in Environ.Vars alongside the $JUJU_
+// variables so that Context.ProxySettings can fall back to them.
+var legacyProxyVars = map[string]bool{
+	"http_proxy":  true,
+	"HTTP_PROXY":  true,
+	"https_proxy": true,
+	"HTTPS_PROXY": true,
+	"ftp_proxy":   true,
+	"FTP_PROXY":   true,
+	"no_proxy":    true,
+	"NO_PROXY":    true,
+}
+
+// proxySettings returns the proxy settings found by looking up
+// variables with the given function.
+func proxySettings(getenv func(string) string) ProxySettings {
+	get := func(names ...string) string {
+		for _, name := range names {
+			if val := getenv(name); val != "" {
+				return val
+			}
+		}
+		return ""
+	}
+	return ProxySettings{
+		HTTP:    get("JUJU_CHARM_HTTP_PROXY", "http_proxy", "HTTP_PROXY"),
+		HTTPS:   get("JUJU_CHARM_HTTPS_PROXY", "https_proxy", "HTTPS_PROXY"),
+		FTP:     get("JUJU_CHARM_FTP_PROXY", "ftp_proxy", "FTP_PROXY"),
+		NoProxy: get("JUJU_CHARM_NO_PROXY", "no_proxy", "NO_PROXY"),
+	}
+}
+
+// proxySettingsFromEnvironment returns the proxy settings held
+// in the process environment.
+func proxySettingsFromEnvironment() ProxySettings {
+	return proxySettings(os.Getenv)
+}
+
+// Env returns the settings as environment variables in the
+// form understood by most commands, such as apt-get and curl.
+// Both lower and upper case variables are included, because
+// different commands look for different ones.
+func (s ProxySettings) Env() []string {
+	var env []string
+	for _, v := range []struct {
+		name, val string
+	}{
+		{"http_proxy", s.HTTP},
+		{"https_proxy", s.HTTPS},
+		{"ftp_proxy", s.FTP},
+		{"no_proxy", s.NoProxy},
+	} {
+		if v.val != "" {
+			env = append(env, v.name+"="+v.val, strings.ToUpper(v.name)+"="+v.val)
+		}
+	}
+	return env
+}
+
+// Proxy returns the proxy to use for the given request, or nil if
+// no proxy should be used. Its signature matches the Proxy field of
+// http.Transport.
+func (s ProxySettings) Proxy(req *http.Request) (*url.URL, error) {
+	var proxy string
+	switch req.URL.Scheme {
+	case "http":
+		proxy = s.HTTP
+	case "https":
+		proxy = s.HTTPS
+	}
+	if proxy == "" || noProxy(s.NoProxy, req.URL.Host) {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		// Allow proxies given without a scheme, as curl does.
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid proxy address %q", proxy)
+	}
+	return u, nil
+}
+
+// proxyFromEnvironment returns the proxy to use for the given
+// request according to the current proxy settings.
+func proxyFromEnvironment(req *http.Request) (*url.URL, error) {
+	return proxySettingsFromEnvironment().Proxy(req)
+}
+
+// configureDefaultTransport makes http.DefaultTransport
+// use the current proxy settings.
+func configureDefaultTransport() {
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.Proxy = proxyFromEnvironment
+	}
+}
+
+// noProxy reports whether the given host (which may include a port)
+// matches the given comma-separated list of hosts and domains in
+// $no_proxy format.
+func noProxy(list, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		switch {
+		case entry == "":
+		case entry == "*":
+			return true
+		case host == strings.TrimPrefix(entry, "."):
+			return true
+		case strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")):
+			return true
+		}
+	}
+	return false
+}
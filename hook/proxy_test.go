@@ -0,0 +1,144 @@
+package hook_test
+
+import (
+	"net/http"
+	"os"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type proxySuite struct {
+	saved map[string]string
+}
+
+var _ = gc.Suite(&proxySuite{})
+
+var proxyVars = []string{
+	"http_proxy", "HTTP_PROXY",
+	"https_proxy", "HTTPS_PROXY",
+	"ftp_proxy", "FTP_PROXY",
+	"no_proxy", "NO_PROXY",
+	"JUJU_CHARM_HTTP_PROXY",
+	"JUJU_CHARM_HTTPS_PROXY",
+	"JUJU_CHARM_FTP_PROXY",
+	"JUJU_CHARM_NO_PROXY",
+}
+
+func (s *proxySuite) SetUpTest(c *gc.C) {
+	s.saved = make(map[string]string)
+	for _, v := range proxyVars {
+		s.saved[v] = os.Getenv(v)
+		os.Setenv(v, "")
+	}
+}
+
+func (s *proxySuite) TearDownTest(c *gc.C) {
+	for v, val := range s.saved {
+		os.Setenv(v, val)
+	}
+}
+
+func (s *proxySuite) TestProxySettings(c *gc.C) {
+	// The process environment is ignored.
+	os.Setenv("JUJU_CHARM_HTTP_PROXY", "http://ignored:3128")
+	os.Setenv("https_proxy", "http://ignored:3129")
+	ctxt := hook.Context{
+		Environ: hook.NewEnviron([]string{
+			"http_proxy=http://old:3128",
+			"HTTPS_PROXY=http://old:3129",
+			"JUJU_CHARM_HTTP_PROXY=http://proxy:3128",
+			"JUJU_CHARM_FTP_PROXY=http://proxy:2121",
+			"JUJU_CHARM_NO_PROXY=localhost",
+			"ftp_proxy=http://old:2121",
+		}),
+	}
+	settings := ctxt.ProxySettings()
+	c.Assert(settings, jc.DeepEquals, hook.ProxySettings{
+		HTTP:    "http://proxy:3128",
+		HTTPS:   "http://old:3129",
+		FTP:     "http://proxy:2121",
+		NoProxy: "localhost",
+	})
+	c.Assert(settings.Env(), jc.DeepEquals, []string{
+		"http_proxy=http://proxy:3128",
+		"HTTP_PROXY=http://proxy:3128",
+		"https_proxy=http://old:3129",
+		"HTTPS_PROXY=http://old:3129",
+		"ftp_proxy=http://proxy:2121",
+		"FTP_PROXY=http://proxy:2121",
+		"no_proxy=localhost",
+		"NO_PROXY=localhost",
+	})
+	c.Assert(hook.ProxySettings{}.Env(), gc.HasLen, 0)
+}
+
+var proxyTests = []struct {
+	about    string
+	settings hook.ProxySettings
+	url      string
+	expect   string
+}{{
+	about: "no proxy",
+	url:   "http://example.com/",
+}, {
+	about:    "http",
+	settings: hook.ProxySettings{HTTP: "http://proxy:3128"},
+	url:      "http://example.com/",
+	expect:   "http://proxy:3128",
+}, {
+	about:    "https without scheme",
+	settings: hook.ProxySettings{HTTP: "http://proxy:3128", HTTPS: "proxy:8080"},
+	url:      "https://example.com/",
+	expect:   "http://proxy:8080",
+}, {
+	about: "no_proxy",
+	settings: hook.ProxySettings{
+		HTTP:    "http://proxy:3128",
+		NoProxy: "localhost,.internal",
+	},
+	url: "http://archive.internal:80/",
+}}
+
+func (s *proxySuite) TestProxy(c *gc.C) {
+	for i, test := range proxyTests {
+		c.Logf("test %d: %s", i, test.about)
+		req, err := http.NewRequest("GET", test.url, nil)
+		c.Assert(err, gc.IsNil)
+		u, err := test.settings.Proxy(req)
+		c.Assert(err, gc.IsNil)
+		if test.expect == "" {
+			c.Assert(u, gc.IsNil)
+		} else {
+			c.Assert(u, gc.NotNil)
+			c.Assert(u.String(), gc.Equals, test.expect)
+		}
+	}
+}
+
+func (s *proxySuite) TestConfigureDefaultTransport(c *gc.C) {
+	t := http.DefaultTransport.(*http.Transport)
+	oldProxy := t.Proxy
+	defer func() {
+		t.Proxy = oldProxy
+	}()
+	hook.ConfigureDefaultTransport()
+	os.Setenv("JUJU_CHARM_HTTPS_PROXY", "http://proxy:3128")
+	req, err := http.NewRequest("GET", "https://example.com", nil)
+	c.Assert(err, gc.IsNil)
+	u, err := t.Proxy(req)
+	c.Assert(err, gc.IsNil)
+	c.Assert(u.String(), gc.Equals, "http://proxy:3128")
+}
+
+func (s *proxySuite) TestNoProxy(c *gc.C) {
+	c.Assert(hook.NoProxy("", "example.com"), jc.IsFalse)
+	c.Assert(hook.NoProxy("*", "example.com"), jc.IsTrue)
+	c.Assert(hook.NoProxy("example.com", "example.com:443"), jc.IsTrue)
+	c.Assert(hook.NoProxy(".example.com", "www.example.com"), jc.IsTrue)
+	c.Assert(hook.NoProxy("example.com", "www.example.com"), jc.IsTrue)
+	c.Assert(hook.NoProxy("example.com", "notexample.com"), jc.IsFalse)
+	c.Assert(hook.NoProxy("10.0.0.1, localhost", "10.0.0.1:8080"), jc.IsTrue)
+}
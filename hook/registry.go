@@ -5,7 +5,9 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/juju/names"
 	"gopkg.in/errgo.v1"
@@ -19,9 +21,33 @@ import (
 type ContextSetter func(ctxt *Context) error
 
 // Registry allows the registration of hook functions.
+//
+// Reusable charm components should be registered with a
+// sub-registry created with Clone, so that they can be composed
+// without colliding with the main charm or with each other. Each
+// sub-registry has its own name space for local state (see
+// RegisterContext) and commands (see RegisterCommand). Hooks,
+// relations and configuration options are shared by all
+// registries created with Clone, because Juju has only one name
+// space for them; registering a relation or configuration option
+// twice with conflicting details causes a panic rather than silently
+// overriding the earlier registration. A sub-registry created with
+// Namespace also prefixes the names of the relations and
+// configuration options registered through it, so that a component
+// can be used more than once in the same charm.
+//
+// When a hook runs, the functions registered for it through any of
+// the registries are called in the order that they were
+// registered, followed by any wildcard ("*") hook functions, also in
+// registration order.
 type Registry struct {
 	name string
 
+	// namespace holds the prefix added to the names of
+	// relations and configuration options registered
+	// through the registry. See Namespace.
+	namespace string
+
 	// hasContext and hasCommand record whether the
 	// RegisterContext and/or RegisterCommand have
 	// been called for this context.
@@ -37,16 +63,27 @@ type Registry struct {
 // sharedRegistry holds registry values that
 // are shared across all clones of a Registry.
 type sharedRegistry struct {
-	hooks     map[string][]hookFunc
-	commands  map[string]func([]string)
-	relations map[string]charm.Relation
-	config    map[string]charm.Option
-	contexts  []ContextSetter
-	state     []localState
+	hooks      map[string][]hookFunc
+	commands   map[string]func([]string)
+	relations  map[string]charm.Relation
+	config     map[string]charm.Option
+	metrics    map[string]charm.Metric
+	binaries   map[string]bool
+	resources  map[string]Resource
+	lxdProfile LXDProfile
+	series     map[string][]string
+	stubs      map[string]HookStub
+	contexts   []ContextSetter
+	state      []localState
+	ports      []func() ([]PortRange, error)
+	teardowns  []teardown
+	migrations []migration
+	timeout    time.Duration
 }
 
 type hookFunc struct {
 	registryName string
+	priority     int
 	run          func() error
 }
 
@@ -66,6 +103,11 @@ func NewRegistry() *Registry {
 			commands:  make(map[string]func([]string)),
 			relations: make(map[string]charm.Relation),
 			config:    make(map[string]charm.Option),
+			metrics:   make(map[string]charm.Metric),
+			binaries:  make(map[string]bool),
+			resources: make(map[string]Resource),
+			stubs:     make(map[string]HookStub),
+			series:    make(map[string][]string),
 		},
 	}
 }
@@ -89,31 +131,135 @@ func (r *Registry) Clone(name string) *Registry {
 	r.clones[name] = true
 	return &Registry{
 		name:           r.name + "." + name,
+		namespace:      r.namespace,
 		clones:         make(map[string]bool),
 		sharedRegistry: r.sharedRegistry,
 	}
 }
 
+var namespacePattern = regexp.MustCompile("^[a-z][a-z0-9]*$")
+
+// Namespace is like Clone, except that the returned registry, and
+// any registries cloned from it, also add the given prefix followed
+// by a hyphen to the names of the relations and configuration
+// options registered through them, and to the relation names in
+// relation hooks registered through them. For example, after
+//
+//	db := r.Namespace("db")
+//	db.RegisterRelation(charm.Relation{Name: "mysql", ...})
+//	db.RegisterConfig("user", ...)
+//	db.RegisterHook("mysql-relation-changed", f)
+//
+// the charm has a relation named "db-mysql" with a
+// db-mysql-relation-changed hook, and a configuration option
+// named "db-user". Within an enclosing namespace the prefixes
+// accumulate, so r.Namespace("a").Namespace("b") uses "a-b-".
+//
+// Code using the context must use the full names, as returned by
+// ConfigName and RelationName, for example when calling
+// Context.GetConfig or looking in Context.RelationIds.
+//
+// The prefix must start with a lower case letter and hold only lower
+// case letters and digits; Namespace panics if it does not, and in
+// the same cases as Clone.
+func (r *Registry) Namespace(prefix string) *Registry {
+	if !namespacePattern.MatchString(prefix) {
+		panic(errgo.Newf("invalid namespace %q", prefix))
+	}
+	r1 := r.Clone(prefix)
+	r1.namespace = r.namespace + prefix + "-"
+	return r1
+}
+
+// ConfigName returns the name of the configuration option that is
+// registered when RegisterConfig is called with the given name.
+// It returns name unchanged unless r was created with Namespace.
+func (r *Registry) ConfigName(name string) string {
+	return r.namespace + name
+}
+
+// RelationName returns the name of the relation that is registered
+// when RegisterRelation is called with a relation of the given name.
+// It returns name unchanged unless r was created with Namespace.
+func (r *Registry) RelationName(name string) string {
+	return r.namespace + name
+}
+
+// hookName returns the name of the hook that is registered when
+// RegisterHook is called with the given name, adding the
+// namespace to the relation name of a relation hook.
+func (r *Registry) hookName(name string) string {
+	if r.namespace == "" {
+		return name
+	}
+	if m := relationHookPattern.FindStringSubmatch(name); m != nil && m[1] != "" {
+		return r.RelationName(m[1]) + "-" + m[2]
+	}
+	return name
+}
+
+// Name returns the name of the registry. The root
+// registry is named "root"; a registry created with Clone
+// is named by appending a dot and the clone name to
+// the name of its parent.
+func (r *Registry) Name() string {
+	return r.name
+}
+
 // RegisterHook registers the given function to be called when the
 // charm hook with the given name is invoked.
 //
 // If the name is "*", the function will always be invoked, after
 // any functions registered specifically for the current hook.
+// The relation name in a relation hook is prefixed as described
+// in Namespace.
 //
-// If more than one function is registered for a given hook,
-// each function will be called in order of registration until
-// one returns an error.
+// Any number of functions may be registered for a given hook.
+// They are called in order of registration until one returns an
+// error, at which point the hook fails; the error returned from Main
+// says which hook and registry the failing function belongs to.
+// Use RegisterHookWithPriority to change the order.
 func (r *Registry) RegisterHook(name string, f func() error) {
-	// TODO(rog) implement validHookName
+	r.RegisterHookWithPriority(name, 0, f)
+}
+
+// RegisterHookWithPriority is like RegisterHook except that the
+// function is given an explicit priority. Functions with a lower
+// priority value are called before those with a higher one;
+// functions with the same priority are called in order of
+// registration. Functions registered with RegisterHook have priority
+// zero.
+//
+// Wildcard functions are always called after all the functions
+// registered for the specific hook, whatever their priority.
+func (r *Registry) RegisterHookWithPriority(name string, priority int, f func() error) {
 	if name != "*" && !validHookName(name) {
 		panic(fmt.Errorf("invalid hook name %q", name))
 	}
+	name = r.hookName(name)
 	r.hooks[name] = append(r.hooks[name], hookFunc{
 		run:          f,
 		registryName: r.name,
+		priority:     priority,
 	})
 }
 
+// RegisterTimeout registers a deadline for the running of each hook:
+// when the given duration has elapsed since the hook started, the
+// channel returned by Context.Done is closed. Hook functions are not
+// interrupted; it is up to them to check for the deadline.
+//
+// If RegisterTimeout is called more than once, from any
+// registry, the shortest duration is used.
+func (r *Registry) RegisterTimeout(d time.Duration) {
+	if d <= 0 {
+		panic(errgo.Newf("invalid hook timeout %v", d))
+	}
+	if r.timeout == 0 || d < r.timeout {
+		r.timeout = d
+	}
+}
+
 // RegisterContext registers a function that will be called
 // to set up a context before any hook function execution.
 //
@@ -164,7 +310,8 @@ func (r *Registry) RegisterCommand(f func(args []string)) {
 }
 
 // RegisterRelation registers a relation to be included in the charm's
-// metadata.yaml. If a relation is registered twice with the same
+// metadata.yaml, with its name prefixed as described in Namespace.
+// If a relation is registered twice with the same
 // name, all of the details must also match.
 // If the relation's scope is empty, charm.ScopeGlobal
 // is assumed. If rel.Limit is zero, it is assumed to be 1
@@ -185,6 +332,7 @@ func (r *Registry) RegisterRelation(rel charm.Relation) {
 	if rel.Scope == "" {
 		rel.Scope = charm.ScopeGlobal
 	}
+	rel.Name = r.RelationName(rel.Name)
 	old, ok := r.relations[rel.Name]
 	if ok {
 		if old != rel {
@@ -196,9 +344,11 @@ func (r *Registry) RegisterRelation(rel charm.Relation) {
 }
 
 // RegisterConfig registers a configuration option to be included in
-// the charm's config.yaml. If an option is registered twice with the
-// same name, all of the details must also match.
+// the charm's config.yaml, with its name prefixed as described in
+// Namespace. If an option is registered twice with the same name,
+// all of the details must also match.
 func (r *Registry) RegisterConfig(name string, opt charm.Option) {
+	name = r.ConfigName(name)
 	old, ok := r.config[name]
 	if !ok {
 		r.config[name] = opt
@@ -209,8 +359,38 @@ func (r *Registry) RegisterConfig(name string, opt charm.Option) {
 	}
 }
 
-// RegisteredHooks returns the names of all currently
-// registered hooks, excluding wildcard ("*") hooks.
+// RegisterMetric registers a metric to be included in the charm's
+// metrics.yaml. If a metric is registered twice with the same name,
+// all of the details must also match. Values for the metric
+// can be added with Context.AddMetric in the collect-metrics hook.
+func (r *Registry) RegisterMetric(name string, m charm.Metric) {
+	old, ok := r.metrics[name]
+	if !ok {
+		r.metrics[name] = m
+		return
+	}
+	if old != m {
+		panic(errgo.Newf("metric %q is already registered with different details (%#v)", name, old))
+	}
+}
+
+// RegisterBinary registers that the charm uses the executable with
+// the given name. Gocharm builds an executable in the charm's bin
+// directory from each main package in the src/cmd directory of the
+// charm package (for example src/cmd/agent is built as bin/agent),
+// and will not build the charm if a registered binary has no such
+// package. The path of the executable on the unit is returned by
+// Context.BinaryPath. The name must not contain a slash or a dot and
+// must not be "runhook".
+func (r *Registry) RegisterBinary(name string) {
+	if name == "" || name == "runhook" || strings.ContainsAny(name, "/.") {
+		panic(errgo.Newf("invalid binary name %q", name))
+	}
+	r.binaries[name] = true
+}
+
+// RegisteredHooks returns the names of all currently registered
+// hooks, excluding wildcard ("*") hooks, in alphabetical order.
 func (r *Registry) RegisteredHooks() []string {
 	var names []string
 	for name := range r.hooks {
@@ -218,6 +398,7 @@ func (r *Registry) RegisteredHooks() []string {
 			names = append(names, name)
 		}
 	}
+	sort.Strings(names)
 	return names
 }
 
@@ -233,7 +414,53 @@ func (r *Registry) RegisteredConfig() map[string]charm.Option {
 	return r.config
 }
 
-var relationHookPattern = regexp.MustCompile("^(?:(" + names.RelationSnippet + ")-)?(relation-[a-z]+)$")
+// RegisteredMetrics returns the metrics that have
+// been registered with RegisterMetric.
+func (r *Registry) RegisteredMetrics() map[string]charm.Metric {
+	return r.metrics
+}
+
+// RegisteredBinaries returns the names of the binaries that
+// have been registered with RegisterBinary, in alphabetical order.
+func (r *Registry) RegisteredBinaries() []string {
+	names := make([]string, 0, len(r.binaries))
+	for name := range r.binaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisteredCommands returns the names of the registries that have
+// registered a command with RegisterCommand, in alphabetical order.
+// The command for a registry named "root.foo" is invoked as "cmd-root.foo".
+func (r *Registry) RegisteredCommands() []string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	relationHookPattern = regexp.MustCompile("^(?:(" + names.RelationSnippet + ")-)?(relation-[a-z]+)$")
+	storageHookPattern  = regexp.MustCompile("^(?:(" + names.StorageNameSnippet + ")-)?(storage-[a-z]+)$")
+)
+
+// UpdateStatus holds the kind of the update-status hook, which Juju
+// runs periodically so that the charm can update its status. It is
+// not defined by the version of the charm package used by gocharm.
+const UpdateStatus hooks.Kind = "update-status"
+
+// The leadership hooks are not defined by the version of the charm
+// package used by gocharm either. LeaderElected runs on a unit when
+// it becomes the service leader; LeaderSettingsChanged runs on the
+// other units when the leader changes the leader settings.
+const (
+	LeaderElected         hooks.Kind = "leader-elected"
+	LeaderSettingsChanged hooks.Kind = "leader-settings-changed"
+)
 
 var hookNames = map[hooks.Kind]bool{
 	hooks.Install:            true,
@@ -249,16 +476,24 @@ var hookNames = map[hooks.Kind]bool{
 	hooks.RelationChanged:    true,
 	hooks.RelationDeparted:   true,
 	hooks.RelationBroken:     true,
+	hooks.StorageAttached:    true,
+	hooks.StorageDetached:    true,
+	UpdateStatus:             true,
+	LeaderElected:            true,
+	LeaderSettingsChanged:    true,
 }
 
 func validHookName(s string) bool {
-	if m := relationHookPattern.FindStringSubmatch(s); m != nil {
-		if m[1] == "" {
-			// The user has specified a relation hook name with
-			// no relation.
-			return false
+	for _, pat := range []*regexp.Regexp{relationHookPattern, storageHookPattern} {
+		if m := pat.FindStringSubmatch(s); m != nil {
+			if m[1] == "" {
+				// The user has specified a relation or storage
+				// hook name with no relation or storage name.
+				return false
+			}
+			s = m[2]
+			break
 		}
-		s = m[2]
 	}
 	return hookNames[hooks.Kind(s)]
 }
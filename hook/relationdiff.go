@@ -0,0 +1,70 @@
+package hook
+
+import (
+	"sort"
+
+	"gopkg.in/errgo.v1"
+)
+
+// SettingChange describes a change to a relation setting.
+// An empty value means that the setting was not set.
+type SettingChange struct {
+	Key string
+	Old string
+	New string
+}
+
+// RelationChanges returns the settings of the remote unit that
+// triggered the current hook (ctxt.RemoteUnit) that are different
+// from when a hook last completed successfully, with their old and
+// new values, in alphabetical order of key. If the unit had not been
+// seen before, all its settings are returned. This lets a
+// relation-changed hook reconfigure only what is needed, for
+// example avoiding a service restart when only an unrelated
+// setting has changed.
+//
+// As with DepartedUnits, the old values are those seen when a hook
+// last ran, so a change made and reverted by the remote unit in the
+// meantime is not reported.
+//
+// It panics if called in a hook that has no remote unit.
+func (ctxt *Context) RelationChanges() []SettingChange {
+	if ctxt.RemoteUnit == "" || ctxt.RelationId == "" {
+		panic(errgo.Newf("RelationChanges called in non-relation hook %s", ctxt.HookName))
+	}
+	return ctxt.RelationChangesWithUnit(ctxt.RelationId, ctxt.RemoteUnit)
+}
+
+// RelationChangesWithUnit is like RelationChanges except that
+// it returns the changes to the settings of the given unit in
+// the relation with the given id.
+func (ctxt *Context) RelationChangesWithUnit(id RelationId, unit UnitId) []SettingChange {
+	old := ctxt.seen[id][unit]
+	current := ctxt.Relations[id][unit]
+	var changes []SettingChange
+	for key, val := range current {
+		if old[key] != val {
+			changes = append(changes, SettingChange{
+				Key: key,
+				Old: old[key],
+				New: val,
+			})
+		}
+	}
+	for key, val := range old {
+		if _, ok := current[key]; !ok && val != "" {
+			changes = append(changes, SettingChange{
+				Key: key,
+				Old: val,
+			})
+		}
+	}
+	sort.Sort(changesByKey(changes))
+	return changes
+}
+
+type changesByKey []SettingChange
+
+func (c changesByKey) Len() int           { return len(c) }
+func (c changesByKey) Less(i, j int) bool { return c[i].Key < c[j].Key }
+func (c changesByKey) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
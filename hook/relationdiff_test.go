@@ -0,0 +1,101 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type relationDiffSuite struct{}
+
+var _ = gc.Suite(&relationDiffSuite{})
+
+func (s *relationDiffSuite) TestRelationChanges(c *gc.C) {
+	var (
+		changes []hook.SettingChange
+		fail    bool
+	)
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			var ctxt *hook.Context
+			r.RegisterContext(func(c *hook.Context) error {
+				ctxt = c
+				return nil
+			}, nil)
+			r.RegisterRelation(charm.Relation{
+				Name:      "db",
+				Interface: "mysql",
+				Role:      charm.RoleRequirer,
+			})
+			hookFunc := func() error {
+				changes = ctxt.RelationChanges()
+				if fail {
+					return errgo.New("failed")
+				}
+				return nil
+			}
+			r.RegisterHook("db-relation-changed", hookFunc)
+			r.RegisterHook("db-relation-departed", hookFunc)
+		},
+		RelationIds: map[string][]hook.RelationId{
+			"db": {"db:0"},
+		},
+		Relations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"db:0": {
+				"mysql/0": {"host": "10.0.0.1", "password": "x"},
+			},
+		},
+		Logger: c,
+	}
+
+	// A new unit's settings have all changed.
+	err := runner.RunHook("db-relation-changed", "db:0", "mysql/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, jc.DeepEquals, []hook.SettingChange{
+		{Key: "host", New: "10.0.0.1"},
+		{Key: "password", New: "x"},
+	})
+
+	err = runner.RunHook("db-relation-changed", "db:0", "mysql/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, gc.HasLen, 0)
+
+	runner.Relations["db:0"]["mysql/0"] = map[string]string{
+		"host": "10.0.0.1",
+		"port": "3306",
+	}
+	fail = true
+	err = runner.RunHook("db-relation-changed", "db:0", "mysql/0")
+	c.Assert(err, gc.ErrorMatches, `.*failed`)
+	expect := []hook.SettingChange{
+		{Key: "password", Old: "x"},
+		{Key: "port", New: "3306"},
+	}
+	c.Assert(changes, jc.DeepEquals, expect)
+
+	// The changes are still reported when the hook is retried.
+	fail = false
+	err = runner.RunHook("db-relation-changed", "db:0", "mysql/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, jc.DeepEquals, expect)
+
+	// All the settings of a departed unit have gone.
+	delete(runner.Relations["db:0"], "mysql/0")
+	err = runner.RunHook("db-relation-departed", "db:0", "mysql/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, jc.DeepEquals, []hook.SettingChange{
+		{Key: "host", Old: "10.0.0.1"},
+		{Key: "port", Old: "3306"},
+	})
+}
+
+func (s *relationDiffSuite) TestRelationChangesPanicsOutsideRelationHook(c *gc.C) {
+	ctxt := &hook.Context{HookName: "install"}
+	c.Assert(func() {
+		ctxt.RelationChanges()
+	}, gc.PanicMatches, `RelationChanges called in non-relation hook install`)
+}
@@ -0,0 +1,86 @@
+package hook
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// Resource describes a resource used by the charm, as declared in
+// the resources section of metadata.yaml. Resources allow large
+// payloads to be supplied to the charm separately, rather than being
+// embedded in the charm itself.
+type Resource struct {
+	// Type holds the type of the resource.
+	// Currently only "file" is supported.
+	Type string
+
+	// Filename holds the name that the resource file
+	// will be given when it is fetched.
+	Filename string
+
+	// Description holds a human readable description
+	// of the resource.
+	Description string
+}
+
+// RegisterResource registers a resource to be included in the
+// charm's metadata.yaml. If a resource is registered twice with the
+// same name, all of the details must also match. If res.Type is
+// empty, "file" is assumed; the resource's file name must be
+// specified.
+func (r *Registry) RegisterResource(name string, res Resource) {
+	if name == "" {
+		panic(errgo.Newf("no resource name given in %#v", res))
+	}
+	if res.Type == "" {
+		res.Type = "file"
+	}
+	if res.Type != "file" {
+		panic(errgo.Newf("resource %q has unsupported type %q", name, res.Type))
+	}
+	if res.Filename == "" {
+		panic(errgo.Newf("no file name given for resource %q", name))
+	}
+	old, ok := r.resources[name]
+	if !ok {
+		r.resources[name] = res
+		return
+	}
+	if old != res {
+		panic(errgo.Newf("resource %q is already registered with different details (%#v)", name, old))
+	}
+}
+
+// RegisteredResources returns the resources that have
+// been registered with RegisterResource.
+func (r *Registry) RegisteredResources() map[string]Resource {
+	return r.resources
+}
+
+// GetResource returns the path to the file for the resource with the
+// given name, fetching it from the controller if necessary. The path
+// is cached for the rest of the hook, so calling GetResource more
+// than once for the same resource is cheap.
+//
+// If the Juju agent does not implement the resource-get hook tool,
+// the returned error will have an ErrUnimplemented cause.
+func (ctxt *Context) GetResource(name string) (string, error) {
+	cache := ctxt.hookCache()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if path, ok := cache.resources[name]; ok {
+		return path, nil
+	}
+	out, err := ctxt.Runner.Run("resource-get", name)
+	if err != nil {
+		return "", errgo.NoteMask(err, fmt.Sprintf("cannot get resource %q", name), errgo.Is(ErrUnimplemented))
+	}
+	path := strings.TrimSpace(string(out))
+	if cache.resources == nil {
+		cache.resources = make(map[string]string)
+	}
+	cache.resources[name] = path
+	return path, nil
+}
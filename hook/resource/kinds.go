@@ -0,0 +1,197 @@
+package resource
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// File is a Resource that ensures that a file
+// exists with the given contents and permissions.
+// When it is no longer declared, the file is removed.
+type File struct {
+	// Path holds the absolute path of the file.
+	Path string
+
+	// Content holds the contents of the file.
+	Content []byte
+
+	// Perm holds the permissions of the file.
+	// If it is zero, 0644 is used.
+	Perm os.FileMode
+}
+
+// Key implements Resource.Key.
+func (f File) Key() string {
+	return "file:" + f.Path
+}
+
+func (f File) perm() os.FileMode {
+	if f.Perm == 0 {
+		return 0644
+	}
+	return f.Perm
+}
+
+// Check implements Resource.Check.
+func (f File) Check(*hook.Context) (bool, error) {
+	if !filepath.IsAbs(f.Path) {
+		return false, errgo.Newf("file path %q is not absolute", f.Path)
+	}
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errgo.Mask(err)
+	}
+	if info.Mode().Perm() != f.perm() {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	return bytes.Equal(data, f.Content), nil
+}
+
+// Apply implements Resource.Apply. The file is written to a
+// temporary file first and then renamed, so that the change
+// is atomic.
+func (f File) Apply(*hook.Context) error {
+	dir := filepath.Dir(f.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errgo.Mask(err)
+	}
+	tmp, err := ioutil.TempFile(dir, ".gocharm")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(f.Content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Chmod(tmp.Name(), f.perm()); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func removeFile(ctxt *hook.Context, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// Package is a Resource that ensures that an apt
+// package is installed. Packages are not removed when
+// they are no longer declared.
+type Package struct {
+	Name string
+}
+
+// Key implements Resource.Key.
+func (p Package) Key() string {
+	return "package:" + p.Name
+}
+
+// Check implements Resource.Check.
+func (p Package) Check(*hook.Context) (bool, error) {
+	return hook.PackageInstalled(p.Name), nil
+}
+
+// Apply implements Resource.Apply.
+func (p Package) Apply(*hook.Context) error {
+	return errgo.Mask(hook.InstallPackages(p.Name))
+}
+
+// Port is a Resource that ensures that a range of ports is
+// open. When it is no longer declared, the ports are closed.
+type Port struct {
+	hook.PortRange
+}
+
+// Key implements Resource.Key.
+func (p Port) Key() string {
+	return "port:" + p.PortRange.String()
+}
+
+// Check implements Resource.Check. If the Juju agent
+// cannot report the ports that are open, ports are always
+// opened, as opening a port that is already open is harmless.
+func (p Port) Check(ctxt *hook.Context) (bool, error) {
+	ports, err := ctxt.OpenedPorts()
+	if err != nil {
+		if errgo.Cause(err) == hook.ErrUnimplemented {
+			return false, nil
+		}
+		return false, errgo.Mask(err)
+	}
+	for _, open := range ports {
+		if open == p.PortRange {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Apply implements Resource.Apply.
+func (p Port) Apply(ctxt *hook.Context) error {
+	return errgo.Mask(ctxt.OpenPortRange(p.Protocol, p.FromPort, p.ToPort))
+}
+
+func closePort(ctxt *hook.Context, id string) error {
+	p, err := hook.ParsePortRange(id)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return errgo.Mask(ctxt.ClosePortRange(p.Protocol, p.FromPort, p.ToPort))
+}
+
+// OSService represents an operating system service. It is
+// implemented by *upstart.Service (from
+// github.com/juju/juju/service/upstart), and any
+// service.OSService (from github.com/juju/gocharm/charmbits/service)
+// also implements it.
+type OSService interface {
+	Running() bool
+	Start() error
+}
+
+// Service is a Resource that ensures that a service is running.
+// Services are not stopped when they are no longer declared.
+type Service struct {
+	// Name holds the name of the service.
+	Name string
+
+	// Service holds the service itself.
+	Service OSService
+}
+
+// Key implements Resource.Key.
+func (s Service) Key() string {
+	return "service:" + s.Name
+}
+
+// Check implements Resource.Check.
+func (s Service) Check(*hook.Context) (bool, error) {
+	return s.Service.Running(), nil
+}
+
+// Apply implements Resource.Apply.
+func (s Service) Apply(*hook.Context) error {
+	return errgo.Mask(s.Service.Start())
+}
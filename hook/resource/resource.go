@@ -0,0 +1,176 @@
+// The resource package provides a way for a charm to declare the
+// state that it wants the unit to be in - files with given contents,
+// packages installed, services running and ports open - rather than
+// making the changes imperatively in each hook. After each hook, the
+// declared resources are compared with the actual state of the unit
+// and only the necessary changes are made.
+//
+// Note that this is unrelated to the charm resources declared
+// with hook.Registry.RegisterResource.
+package resource
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// Resource represents some desired state of the unit.
+type Resource interface {
+	// Key returns a key that uniquely identifies the resource,
+	// of the form kind:id, for example "file:/etc/foo.conf".
+	Key() string
+
+	// Check reports whether the resource is already
+	// in the desired state.
+	Check(ctxt *hook.Context) (bool, error)
+
+	// Apply changes the unit so that the resource
+	// is in the desired state.
+	Apply(ctxt *hook.Context) error
+}
+
+// removers holds a function for each kind of resource that
+// should be undone when it is no longer declared. The function
+// is called with the id part of the resource's key. Resources of
+// other kinds (for example packages) are left as they are.
+var removers = map[string]func(ctxt *hook.Context, id string) error{
+	"file": removeFile,
+	"port": closePort,
+}
+
+// Change describes a change made by Reconciler.Reconcile.
+type Change struct {
+	// Key holds the key of the resource that was changed.
+	Key string
+
+	// Removed records whether the resource was removed
+	// because it is no longer declared, rather than applied.
+	Removed bool
+}
+
+// String returns a description of the change.
+func (c Change) String() string {
+	if c.Removed {
+		return "removed " + c.Key
+	}
+	return "applied " + c.Key
+}
+
+// Reconciler reconciles the resources declared by a charm
+// with the actual state of the unit.
+type Reconciler struct {
+	ctxt    *hook.Context
+	state   localState
+	declare func(ctxt *hook.Context) ([]Resource, error)
+}
+
+type localState struct {
+	// Declared holds the keys of all the resources declared
+	// when the resources were last reconciled.
+	Declared []string
+}
+
+// Register registers the reconciler with the given registry. After
+// every hook, the declare function is called to find out what
+// resources the charm requires, and Reconcile is called to make
+// the unit's state match. The changes made are logged.
+func (rec *Reconciler) Register(r *hook.Registry, declare func(ctxt *hook.Context) ([]Resource, error)) {
+	if declare == nil {
+		panic("nil declare function passed to Reconciler.Register")
+	}
+	rec.declare = declare
+	r.RegisterContext(rec.setContext, &rec.state)
+	r.RegisterHook("*", rec.reconcile)
+}
+
+func (rec *Reconciler) setContext(ctxt *hook.Context) error {
+	rec.ctxt = ctxt
+	return nil
+}
+
+func (rec *Reconciler) reconcile() error {
+	changes, err := rec.Reconcile()
+	for _, c := range changes {
+		rec.ctxt.Logf("%s", c)
+	}
+	return errgo.Mask(err)
+}
+
+// Reconcile calls the registered declare function and applies any
+// declared resources that are not in their desired state. Any
+// resources that were declared when Reconcile was last called but
+// are not declared now are removed if that is possible: files are
+// removed and ports are closed.
+//
+// It returns the changes that were made, which may be non-empty
+// even if an error is returned.
+func (rec *Reconciler) Reconcile() ([]Change, error) {
+	resources, err := rec.declare(rec.ctxt)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot get declared resources")
+	}
+	declared := make(map[string]bool)
+	for _, res := range resources {
+		key := res.Key()
+		if _, _, err := splitKey(key); err != nil {
+			return nil, errgo.Mask(err)
+		}
+		if declared[key] {
+			return nil, errgo.Newf("resource %q declared more than once", key)
+		}
+		declared[key] = true
+	}
+	var changes []Change
+	for _, key := range rec.state.Declared {
+		if declared[key] {
+			continue
+		}
+		kind, id, _ := splitKey(key)
+		if remove := removers[kind]; remove != nil {
+			if err := remove(rec.ctxt, id); err != nil {
+				return changes, errgo.Notef(err, "cannot remove %s", key)
+			}
+			changes = append(changes, Change{
+				Key:     key,
+				Removed: true,
+			})
+		}
+	}
+	// Record what was declared now, so that the resources
+	// that were previously declared are not removed again,
+	// and the newly declared ones will be removed if
+	// necessary, even if we can't apply them all.
+	rec.state.Declared = make([]string, 0, len(declared))
+	for key := range declared {
+		rec.state.Declared = append(rec.state.Declared, key)
+	}
+	sort.Strings(rec.state.Declared)
+	for _, res := range resources {
+		ok, err := res.Check(rec.ctxt)
+		if err != nil {
+			return changes, errgo.Notef(err, "cannot check %s", res.Key())
+		}
+		if ok {
+			continue
+		}
+		if err := res.Apply(rec.ctxt); err != nil {
+			return changes, errgo.Notef(err, "cannot apply %s", res.Key())
+		}
+		changes = append(changes, Change{
+			Key: res.Key(),
+		})
+	}
+	return changes, nil
+}
+
+func splitKey(key string) (kind, id string, err error) {
+	i := strings.Index(key, ":")
+	if i <= 0 || i == len(key)-1 {
+		return "", "", errgo.Newf("invalid resource key %q", key)
+	}
+	return key[0:i], key[i+1:], nil
+}
@@ -0,0 +1,214 @@
+package resource_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/resource"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+type suite struct{}
+
+var _ = gc.Suite(suite{})
+
+// fakeRunner is a hook.ToolRunner that keeps track
+// of the ports opened with open-port and close-port.
+type fakeRunner struct {
+	ports  []string
+	record [][]string
+}
+
+func (r *fakeRunner) Run(cmd string, args ...string) ([]byte, error) {
+	r.record = append(r.record, append([]string{cmd}, args...))
+	switch cmd {
+	case "opened-ports":
+		return json.Marshal(r.ports)
+	case "config-get":
+		return []byte("{}"), nil
+	case "open-port":
+		r.ports = append(r.ports, args[0])
+	case "close-port":
+		for i, p := range r.ports {
+			if p == args[0] {
+				r.ports = append(r.ports[0:i], r.ports[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeRunner) Close() error {
+	return nil
+}
+
+type memState map[string][]byte
+
+func (s memState) Save(name string, data []byte) error {
+	s[name] = data
+	return nil
+}
+
+func (s memState) Load(name string) ([]byte, error) {
+	return s[name], nil
+}
+
+type fakeService struct {
+	running bool
+	starts  int
+}
+
+func (s *fakeService) Running() bool {
+	return s.running
+}
+
+func (s *fakeService) Start() error {
+	s.running = true
+	s.starts++
+	return nil
+}
+
+// runHook runs the given hook with a reconciler that declares the
+// resources returned by declare, and returns the changes logged.
+func runHook(c *gc.C, hookName string, runner *fakeRunner, state memState, declare func() []resource.Resource) []string {
+	r := hook.NewRegistry()
+	r.RegisterHook(hookName, func() error { return nil })
+	var rec resource.Reconciler
+	rec.Register(r.Clone("resource"), func(ctxt *hook.Context) ([]resource.Resource, error) {
+		return declare(), nil
+	})
+	runner.record = nil
+	err := hook.Main(r, &hook.Context{
+		HookName: hookName,
+		Runner:   runner,
+	}, state)
+	c.Assert(err, gc.IsNil)
+	var logged []string
+	for _, rec := range runner.record {
+		if rec[0] == "juju-log" && rec[1] != "running hook "+hookName+" {" && rec[1] != "} "+hookName {
+			logged = append(logged, rec[1])
+		}
+	}
+	return logged
+}
+
+func (suite) TestReconcile(c *gc.C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "etc", "foo.conf")
+	svc := &fakeService{}
+	runner := &fakeRunner{}
+	state := make(memState)
+	resources := []resource.Resource{
+		resource.File{
+			Path:    path,
+			Content: []byte("hello"),
+			Perm:    0600,
+		},
+		resource.Port{hook.PortRange{80, 80, "tcp"}},
+		resource.Service{
+			Name:    "foo",
+			Service: svc,
+		},
+	}
+	declare := func() []resource.Resource {
+		return resources
+	}
+
+	logged := runHook(c, "install", runner, state, declare)
+	c.Assert(logged, jc.DeepEquals, []string{
+		"applied file:" + path,
+		"applied port:80/tcp",
+		"applied service:foo",
+	})
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "hello")
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+	c.Assert(runner.ports, jc.DeepEquals, []string{"80/tcp"})
+	c.Assert(svc.starts, gc.Equals, 1)
+
+	// Nothing changes when everything is in the desired state.
+	logged = runHook(c, "config-changed", runner, state, declare)
+	c.Assert(logged, gc.HasLen, 0)
+
+	// Only the resources that are out of date are changed.
+	svc.running = false
+	resources[0] = resource.File{
+		Path:    path,
+		Content: []byte("goodbye"),
+		Perm:    0600,
+	}
+	logged = runHook(c, "config-changed", runner, state, declare)
+	c.Assert(logged, jc.DeepEquals, []string{
+		"applied file:" + path,
+		"applied service:foo",
+	})
+	data, err = ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "goodbye")
+	c.Assert(svc.starts, gc.Equals, 2)
+
+	// Resources that are no longer declared are removed
+	// if possible.
+	resources = []resource.Resource{
+		resource.Port{hook.PortRange{8000, 8080, "udp"}},
+	}
+	logged = runHook(c, "config-changed", runner, state, declare)
+	c.Assert(logged, jc.DeepEquals, []string{
+		"removed file:" + path,
+		"removed port:80/tcp",
+		"applied port:8000-8080/udp",
+	})
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+	c.Assert(runner.ports, jc.DeepEquals, []string{"8000-8080/udp"})
+	c.Assert(svc.running, gc.Equals, true)
+}
+
+func (suite) TestReconcileDuplicateResource(c *gc.C) {
+	var rec resource.Reconciler
+	r := hook.NewRegistry()
+	r.RegisterHook("install", func() error { return nil })
+	rec.Register(r, func(ctxt *hook.Context) ([]resource.Resource, error) {
+		return []resource.Resource{
+			resource.Package{"git"},
+			resource.Package{"git"},
+		}, nil
+	})
+	err := hook.Main(r, &hook.Context{
+		HookName: "install",
+		Runner:   &fakeRunner{},
+	}, make(memState))
+	c.Assert(err, gc.ErrorMatches, `hook install \(registry root\): resource "package:git" declared more than once`)
+}
+
+func (suite) TestReconcileDeclareError(c *gc.C) {
+	var rec resource.Reconciler
+	r := hook.NewRegistry()
+	rec.Register(r, func(ctxt *hook.Context) ([]resource.Resource, error) {
+		return nil, errgo.New("no idea")
+	})
+	changes, err := rec.Reconcile()
+	c.Assert(err, gc.ErrorMatches, `cannot get declared resources: no idea`)
+	c.Assert(changes, gc.HasLen, 0)
+}
+
+func (suite) TestFileRelativePath(c *gc.C) {
+	ok, err := resource.File{Path: "foo"}.Check(nil)
+	c.Assert(err, gc.ErrorMatches, `file path "foo" is not absolute`)
+	c.Assert(ok, gc.Equals, false)
+}
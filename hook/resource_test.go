@@ -0,0 +1,87 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type resourceSuite struct{}
+
+var _ = gc.Suite(&resourceSuite{})
+
+func (s *resourceSuite) TestRegisterResource(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterResource("payload", hook.Resource{
+		Filename: "payload.tgz",
+	})
+	// Registering again with the same details is OK.
+	r.RegisterResource("payload", hook.Resource{
+		Type:     "file",
+		Filename: "payload.tgz",
+	})
+	c.Assert(func() {
+		r.RegisterResource("payload", hook.Resource{
+			Filename: "other.tgz",
+		})
+	}, gc.PanicMatches, `resource "payload" is already registered with different details .*`)
+	c.Assert(func() {
+		r.RegisterResource("image", hook.Resource{
+			Type:     "oci-image",
+			Filename: "x",
+		})
+	}, gc.PanicMatches, `resource "image" has unsupported type "oci-image"`)
+	c.Assert(func() {
+		r.RegisterResource("nofile", hook.Resource{})
+	}, gc.PanicMatches, `no file name given for resource "nofile"`)
+	c.Assert(r.RegisteredResources(), jc.DeepEquals, map[string]hook.Resource{
+		"payload": {
+			Type:     "file",
+			Filename: "payload.tgz",
+		},
+	})
+}
+
+func (s *resourceSuite) TestGetResource(c *gc.C) {
+	var ctxt *hook.Context
+	var paths []string
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterContext(func(c *hook.Context) error {
+				ctxt = c
+				return nil
+			}, nil)
+			r.RegisterHook("install", func() error {
+				for _, name := range []string{"payload", "payload", "missing"} {
+					path, err := ctxt.GetResource(name)
+					if err != nil {
+						return err
+					}
+					paths = append(paths, path)
+				}
+				return nil
+			})
+		},
+		RunFunc: func(cmd string, args ...string) ([]byte, error) {
+			if args[0] == "missing" {
+				return nil, errgo.New("resource not found")
+			}
+			return []byte("/var/lib/juju/resources/" + args[0] + "/payload.tgz\n"), nil
+		},
+		Logger: c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.ErrorMatches, `hook install \(registry root\): cannot get resource "missing": resource not found`)
+	c.Assert(paths, jc.DeepEquals, []string{
+		"/var/lib/juju/resources/payload/payload.tgz",
+		"/var/lib/juju/resources/payload/payload.tgz",
+	})
+	// The second call for the same resource was cached.
+	c.Assert(runner.Record, jc.DeepEquals, [][]string{
+		{"resource-get", "payload"},
+		{"resource-get", "missing"},
+	})
+}
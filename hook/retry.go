@@ -0,0 +1,133 @@
+package hook
+
+import (
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// ErrTransient is used as the cause of errors that are likely to
+// be temporary, such as failing to connect to the unit agent
+// while it is restarting.
+var ErrTransient = errgo.New("transient failure")
+
+// transientErrors holds fragments of error messages
+// that indicate a transient problem.
+var transientErrors = []string{
+	"cannot connect",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"connection is shut down",
+}
+
+// IsTransient reports whether the given error looks like a transient
+// failure that might succeed if retried. That is, whether its cause is
+// ErrTransient or its message indicates a temporary network or
+// socket problem.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errgo.Cause(err) == ErrTransient {
+		return true
+	}
+	msg := err.Error()
+	for _, s := range transientErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryStrategy specifies how operations are retried.
+type RetryStrategy struct {
+	// Attempts holds the maximum number of times the
+	// operation will be tried.
+	Attempts int
+
+	// Delay holds the time to wait before the first retry.
+	// The delay doubles after each retry.
+	Delay time.Duration
+
+	// MaxDelay holds the maximum time to wait between retries.
+	// If it is zero, there is no maximum.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryStrategy holds a retry strategy suitable for
+// riding out a restart of the unit agent.
+var DefaultRetryStrategy = RetryStrategy{
+	Attempts: 6,
+	Delay:    250 * time.Millisecond,
+	MaxDelay: 5 * time.Second,
+}
+
+// sleep is used to wait between retries.
+// It is a variable so that it can be replaced for testing.
+var sleep = time.Sleep
+
+// Retry calls f until it succeeds, it returns an error that
+// is not transient (see IsTransient), or the attempts allowed
+// by the given strategy run out. It returns the last error
+// returned by f.
+func Retry(strategy RetryStrategy, f func() error) error {
+	delay := strategy.Delay
+	var err error
+	for i := 0; ; i++ {
+		err = f()
+		if err == nil || !IsTransient(err) || i+1 >= strategy.Attempts {
+			break
+		}
+		sleep(delay)
+		delay *= 2
+		if strategy.MaxDelay > 0 && delay > strategy.MaxDelay {
+			delay = strategy.MaxDelay
+		}
+	}
+	return errgo.Mask(err, errgo.Any)
+}
+
+// WithRetry returns a copy of ctxt that retries hook tool invocations
+// that fail with a transient error, using the given strategy. It can
+// be used for a single call, for example:
+//
+//	ctxt.WithRetry(hook.DefaultRetryStrategy).SetRelation("ready", "true")
+//
+// or it can be stored and used for all calls.
+func (ctxt *Context) WithRetry(strategy RetryStrategy) *Context {
+	ctxt.hookCache()
+	ctxt1 := *ctxt
+	ctxt1.Runner = retryingToolRunner{
+		runner:   ctxt.Runner,
+		strategy: strategy,
+	}
+	return &ctxt1
+}
+
+// retryingToolRunner is a ToolRunner that retries
+// commands that fail with transient errors.
+type retryingToolRunner struct {
+	runner   ToolRunner
+	strategy RetryStrategy
+}
+
+func (r retryingToolRunner) Run(cmd string, args ...string) ([]byte, error) {
+	var out []byte
+	err := Retry(r.strategy, func() error {
+		var err error
+		out, err = r.runner.Run(cmd, args...)
+		return err
+	})
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return out, nil
+}
+
+func (r retryingToolRunner) Close() error {
+	return r.runner.Close()
+}
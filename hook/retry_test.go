@@ -0,0 +1,137 @@
+package hook_test
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type retrySuite struct{}
+
+var _ = gc.Suite(&retrySuite{})
+
+var isTransientTests = []struct {
+	about  string
+	err    error
+	expect bool
+}{{
+	about: "nil error",
+}, {
+	about:  "transient cause",
+	err:    errgo.WithCausef(nil, hook.ErrTransient, "something"),
+	expect: true,
+}, {
+	about:  "masked transient cause",
+	err:    errgo.Mask(errgo.WithCausef(nil, hook.ErrTransient, "something"), errgo.Any),
+	expect: true,
+}, {
+	about:  "cannot connect",
+	err:    errgo.New("cannot connect to agent"),
+	expect: true,
+}, {
+	about:  "connection refused",
+	err:    errgo.New("dial unix /var/lib/juju/agent.socket: connection refused"),
+	expect: true,
+}, {
+	about: "permanent error",
+	err:   errgo.New("invalid setting"),
+}}
+
+func (s *retrySuite) TestIsTransient(c *gc.C) {
+	for i, test := range isTransientTests {
+		c.Logf("test %d: %s", i, test.about)
+		c.Assert(hook.IsTransient(test.err), gc.Equals, test.expect)
+	}
+}
+
+func (s *retrySuite) TestRetryBackoff(c *gc.C) {
+	var delays []time.Duration
+	defer hook.SetSleep(func(d time.Duration) {
+		delays = append(delays, d)
+	})()
+	strategy := hook.RetryStrategy{
+		Attempts: 5,
+		Delay:    time.Second,
+		MaxDelay: 3 * time.Second,
+	}
+	n := 0
+	err := hook.Retry(strategy, func() error {
+		n++
+		return errgo.New("connection refused")
+	})
+	c.Assert(err, gc.ErrorMatches, "connection refused")
+	c.Assert(n, gc.Equals, 5)
+	c.Assert(delays, jc.DeepEquals, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		3 * time.Second,
+		3 * time.Second,
+	})
+}
+
+func (s *retrySuite) TestRetrySucceeds(c *gc.C) {
+	defer hook.SetSleep(func(time.Duration) {})()
+	n := 0
+	err := hook.Retry(hook.DefaultRetryStrategy, func() error {
+		n++
+		if n < 3 {
+			return errgo.WithCausef(nil, hook.ErrTransient, "temporary")
+		}
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 3)
+}
+
+func (s *retrySuite) TestRetryPermanentError(c *gc.C) {
+	defer hook.SetSleep(func(time.Duration) {
+		c.Errorf("unexpected sleep")
+	})()
+	n := 0
+	err := hook.Retry(hook.DefaultRetryStrategy, func() error {
+		n++
+		return errgo.New("bad request")
+	})
+	c.Assert(err, gc.ErrorMatches, "bad request")
+	c.Assert(n, gc.Equals, 1)
+}
+
+// flakyRunner is a hook.ToolRunner that fails
+// with a transient error a given number of times.
+type flakyRunner struct {
+	recordingRunner
+	failures int
+}
+
+func (r *flakyRunner) Run(cmd string, args ...string) ([]byte, error) {
+	if r.failures > 0 {
+		r.failures--
+		return nil, errgo.New("cannot connect to uniter")
+	}
+	return r.recordingRunner.Run(cmd, args...)
+}
+
+func (s *retrySuite) TestWithRetry(c *gc.C) {
+	defer hook.SetSleep(func(time.Duration) {})()
+	runner := &flakyRunner{
+		failures: 2,
+	}
+	ctxt := &hook.Context{
+		Runner:     runner,
+		RelationId: "db:0",
+	}
+	err := ctxt.WithRetry(hook.DefaultRetryStrategy).SetRelation("ready", "true")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.record, jc.DeepEquals, [][]string{
+		{"relation-set", "-r", "db:0", "--", "ready=true"},
+	})
+
+	// The original context does not retry.
+	runner.failures = 1
+	err = ctxt.SetRelation("ready", "true")
+	c.Assert(err, gc.ErrorMatches, "cannot connect to uniter")
+}
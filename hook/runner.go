@@ -38,31 +38,88 @@ var (
 	jujucSymlinks = true
 )
 
-type socketToolRunner struct {
-	contextId   string
-	jujucClient *rpc.Client
-}
+// Hook tool transports, as selected by the $GOCHARM_HOOK_TOOLS
+// environment variable.
+const (
+	// TransportSocket runs hook tools by calling the unit agent
+	// directly over its socket. See NewSocketToolRunner.
+	TransportSocket = "socket"
+
+	// TransportExec runs hook tools by executing them from
+	// $PATH. See NewExecToolRunner.
+	TransportExec = "exec"
+)
 
 // newToolRunnerFromEnvironment returns an implementation of ToolRunner
-// that uses a direct connection to the unit agent's socket to
-// run the tools.
+// chosen by the $GOCHARM_HOOK_TOOLS environment variable, which may
+// be TransportSocket or TransportExec. If it is not set, the unit agent's
+// socket is used when the environment names one, and the hook tools
+// in $PATH otherwise.
 func newToolRunnerFromEnvironment() (ToolRunner, error) {
+	transport := os.Getenv(envToolTransport)
 	if execHookTools {
-		return execToolRunner{}, nil
+		transport = TransportExec
 	}
-	path := os.Getenv(envSocketPath)
-	if path == "" {
-		return nil, errgo.New("no juju socket found")
+	network, addr := socketFromEnvironment()
+	switch transport {
+	case TransportExec:
+		return NewExecToolRunner(), nil
+	case TransportSocket:
+		if addr == "" {
+			return nil, errgo.New("no juju socket found")
+		}
+		return NewSocketToolRunner(network, addr, os.Getenv(envJujuContextId))
+	case "":
+		if addr != "" {
+			return NewSocketToolRunner(network, addr, os.Getenv(envJujuContextId))
+		}
+		if _, err := osexec.LookPath("juju-log"); err == nil {
+			return NewExecToolRunner(), nil
+		}
+		return nil, errgo.New("no juju socket found and no hook tools found in $PATH")
+	}
+	return nil, errgo.Newf("unknown hook tool transport %q in $%s", transport, envToolTransport)
+}
+
+// socketFromEnvironment returns the network and address of the
+// unit agent's socket. Later versions of Juju name the socket
+// with $JUJU_AGENT_SOCKET_ADDRESS and $JUJU_AGENT_SOCKET_NETWORK;
+// earlier ones use $JUJU_AGENT_SOCKET, which is always a
+// unix-domain socket.
+func socketFromEnvironment() (network, addr string) {
+	if addr := os.Getenv(envSocketAddress); addr != "" {
+		network := os.Getenv(envSocketNetwork)
+		if network == "" {
+			network = "unix"
+		}
+		return network, addr
 	}
-	contextId := os.Getenv(envJujuContextId)
+	return "unix", os.Getenv(envSocketPath)
+}
+
+type socketToolRunner struct {
+	network     string
+	addr        string
+	contextId   string
+	jujucClient *rpc.Client
+}
+
+// NewSocketToolRunner returns a ToolRunner that runs hook tools in
+// the hook context with the given id by calling the unit agent
+// directly at the given network address. This bypasses the hook tool
+// executables, which is much faster, but relies on the agent's
+// internal RPC protocol.
+func NewSocketToolRunner(network, addr, contextId string) (ToolRunner, error) {
 	if contextId == "" {
 		return nil, errgo.New("no context id found")
 	}
-	client, err := rpc.Dial("unix", os.Getenv(envSocketPath))
+	client, err := rpc.Dial(network, addr)
 	if err != nil {
-		return nil, errgo.Newf("cannot dial uniter: %v", err)
+		return nil, errgo.WithCausef(nil, ErrTransient, "cannot dial uniter: %v", err)
 	}
 	return &socketToolRunner{
+		network:     network,
+		addr:        addr,
 		contextId:   contextId,
 		jujucClient: client,
 	}, nil
@@ -95,13 +152,28 @@ func (r *socketToolRunner) Run(cmd string, args ...string) (stdout []byte, err e
 		CommandName: cmd,
 		Args:        args,
 	}
+	if r.jujucClient == nil {
+		// A previous call lost the connection, so try to
+		// dial again - the unit agent may have restarted.
+		client, err := rpc.Dial(r.network, r.addr)
+		if err != nil {
+			return nil, errgo.WithCausef(nil, ErrTransient, "cannot dial uniter: %v", err)
+		}
+		r.jujucClient = client
+	}
 	var resp exec.ExecResponse
 	err = r.jujucClient.Call("Jujuc.Main", req, &resp)
 	if err != nil {
 		if isUnimplemented(err.Error()) {
 			return nil, errgo.WithCausef(err, ErrUnimplemented, "")
 		}
-		return nil, errgo.Newf("cannot call jujuc.Main: %v", err)
+		if _, ok := err.(rpc.ServerError); ok {
+			return nil, errgo.Newf("cannot call jujuc.Main: %v", err)
+		}
+		// The connection itself failed.
+		r.jujucClient.Close()
+		r.jujucClient = nil
+		return nil, errgo.WithCausef(nil, ErrTransient, "cannot call jujuc.Main: %v", err)
 	}
 	if resp.Code == 0 {
 		return resp.Stdout, nil
@@ -112,11 +184,23 @@ func (r *socketToolRunner) Run(cmd string, args ...string) (stdout []byte, err e
 }
 
 func (r *socketToolRunner) Close() error {
+	if r.jujucClient == nil {
+		return nil
+	}
 	return errgo.Mask(r.jujucClient.Close())
 }
 
 type execToolRunner struct{}
 
+// NewExecToolRunner returns a ToolRunner that runs hook tools by
+// executing the commands of the same name (relation-get, config-get
+// and so on) found in $PATH, as other charm frameworks do. It is
+// slower than a socket runner but works with any version of Juju
+// and with fake hook tools in tests.
+func NewExecToolRunner() ToolRunner {
+	return execToolRunner{}
+}
+
 func (execToolRunner) Run(cmd string, args ...string) ([]byte, error) {
 	execCmd := cmd
 	if !jujucSymlinks {
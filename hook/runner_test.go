@@ -0,0 +1,138 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type runnerSuite struct {
+	savedVars map[string]string
+	binDir    string
+}
+
+var _ = gc.Suite(&runnerSuite{})
+
+// fakeTool is a hook tool that prints its name and arguments,
+// fails with the message in $FAKE_TOOL_ERROR if set, and
+// reports itself unknown if $FAKE_TOOL_UNKNOWN is set.
+const fakeTool = `#!/bin/sh
+if test -n "$FAKE_TOOL_UNKNOWN"; then
+	echo "error: bad request: unknown command \"$(basename $0)\"" >&2
+	exit 2
+fi
+if test -n "$FAKE_TOOL_ERROR"; then
+	echo "error: $FAKE_TOOL_ERROR" >&2
+	exit 1
+fi
+echo $(basename $0) "$@"
+`
+
+func (s *runnerSuite) SetUpTest(c *gc.C) {
+	s.savedVars = make(map[string]string)
+	s.binDir = c.MkDir()
+	for _, name := range []string{"juju-log", "unit-get"} {
+		err := ioutil.WriteFile(filepath.Join(s.binDir, name), []byte(fakeTool), 0755)
+		c.Assert(err, gc.IsNil)
+	}
+	s.setenv("PATH", s.binDir+":"+os.Getenv("PATH"))
+	for _, name := range []string{"JUJU_AGENT_SOCKET", "JUJU_AGENT_SOCKET_ADDRESS", "JUJU_AGENT_SOCKET_NETWORK", "GOCHARM_HOOK_TOOLS", "JUJU_CONTEXT_ID"} {
+		s.setenv(name, "")
+	}
+}
+
+func (s *runnerSuite) TearDownTest(c *gc.C) {
+	for key, val := range s.savedVars {
+		os.Setenv(key, val)
+	}
+}
+
+func (s *runnerSuite) setenv(key, val string) {
+	if _, ok := s.savedVars[key]; !ok {
+		s.savedVars[key] = os.Getenv(key)
+	}
+	os.Setenv(key, val)
+}
+
+func (s *runnerSuite) TestExecToolRunner(c *gc.C) {
+	runner := hook.NewExecToolRunner()
+	defer runner.Close()
+	out, err := runner.Run("unit-get", "private-address")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out), gc.Equals, "unit-get private-address\n")
+
+	s.setenv("FAKE_TOOL_ERROR", "no such setting")
+	_, err = runner.Run("unit-get", "foo")
+	c.Assert(err, gc.ErrorMatches, "no such setting")
+
+	s.setenv("FAKE_TOOL_UNKNOWN", "1")
+	_, err = runner.Run("unit-get", "foo")
+	c.Assert(errgo.Cause(err), gc.Equals, hook.ErrUnimplemented)
+}
+
+func (s *runnerSuite) TestTransportFallsBackToExec(c *gc.C) {
+	// With no socket, the tools in $PATH are used.
+	runner, err := hook.NewToolRunnerFromEnvironment()
+	c.Assert(err, gc.IsNil)
+	out, err := runner.Run("juju-log", "hello")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out), gc.Equals, "juju-log hello\n")
+
+	s.setenv("PATH", c.MkDir())
+	_, err = hook.NewToolRunnerFromEnvironment()
+	c.Assert(err, gc.ErrorMatches, `no juju socket found and no hook tools found in \$PATH`)
+}
+
+func (s *runnerSuite) TestTransportSocket(c *gc.C) {
+	sockPath := filepath.Join(c.MkDir(), "nowhere.sock")
+	s.setenv("JUJU_CONTEXT_ID", "ctxt")
+	for _, vars := range []map[string]string{{
+		"JUJU_AGENT_SOCKET": sockPath,
+	}, {
+		"JUJU_AGENT_SOCKET_ADDRESS": sockPath,
+	}, {
+		"JUJU_AGENT_SOCKET_ADDRESS": sockPath,
+		"JUJU_AGENT_SOCKET_NETWORK": "unix",
+	}} {
+		for key, val := range vars {
+			s.setenv(key, val)
+		}
+		// The socket is preferred even though the
+		// tools are available in $PATH.
+		_, err := hook.NewToolRunnerFromEnvironment()
+		c.Assert(err, gc.ErrorMatches, "cannot dial uniter: .*")
+		c.Assert(errgo.Cause(err), gc.Equals, hook.ErrTransient)
+		for key := range vars {
+			s.setenv(key, "")
+		}
+	}
+}
+
+func (s *runnerSuite) TestTransportFromEnvironment(c *gc.C) {
+	s.setenv("JUJU_AGENT_SOCKET", filepath.Join(c.MkDir(), "nowhere.sock"))
+	s.setenv("JUJU_CONTEXT_ID", "ctxt")
+
+	s.setenv("GOCHARM_HOOK_TOOLS", "exec")
+	runner, err := hook.NewToolRunnerFromEnvironment()
+	c.Assert(err, gc.IsNil)
+	out, err := runner.Run("unit-get", "public-address")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out), gc.Equals, "unit-get public-address\n")
+
+	s.setenv("GOCHARM_HOOK_TOOLS", "socket")
+	_, err = hook.NewToolRunnerFromEnvironment()
+	c.Assert(err, gc.ErrorMatches, "cannot dial uniter: .*")
+
+	s.setenv("JUJU_AGENT_SOCKET", "")
+	_, err = hook.NewToolRunnerFromEnvironment()
+	c.Assert(err, gc.ErrorMatches, "no juju socket found")
+
+	s.setenv("GOCHARM_HOOK_TOOLS", "carrier-pigeon")
+	_, err = hook.NewToolRunnerFromEnvironment()
+	c.Assert(err, gc.ErrorMatches, `unknown hook tool transport "carrier-pigeon" in \$GOCHARM_HOOK_TOOLS`)
+}
@@ -0,0 +1,40 @@
+package hook
+
+import (
+	"reflect"
+	"sort"
+
+	"gopkg.in/errgo.v1"
+)
+
+// RegisterSeries registers that a feature used by the charm, described
+// by the given name (for example "upstart service"), works only on
+// the given series. Gocharm will not build the charm for any other
+// series, and gocharm verify reports an error if the charm's
+// metadata.yaml declares any other series. It panics if no series
+// are given, or if the feature is already registered with different
+// series.
+//
+// A charm that needs to behave differently on different series can
+// find the series that it was built for with BuildInfo.
+func (r *Registry) RegisterSeries(feature string, series ...string) {
+	if len(series) == 0 {
+		panic(errgo.Newf("no series given for feature %q", feature))
+	}
+	series = append([]string(nil), series...)
+	sort.Strings(series)
+	old, ok := r.series[feature]
+	if !ok {
+		r.series[feature] = series
+		return
+	}
+	if !reflect.DeepEqual(old, series) {
+		panic(errgo.Newf("feature %q is already registered with different series (%v)", feature, old))
+	}
+}
+
+// RegisteredSeries returns the series supported by each feature
+// registered with RegisterSeries, keyed by feature name.
+func (r *Registry) RegisteredSeries() map[string][]string {
+	return r.series
+}
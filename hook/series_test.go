@@ -0,0 +1,29 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type seriesSuite struct{}
+
+var _ = gc.Suite(&seriesSuite{})
+
+func (*seriesSuite) TestRegisterSeries(c *gc.C) {
+	r := hook.NewRegistry()
+	c.Assert(r.RegisteredSeries(), gc.HasLen, 0)
+	r.RegisterSeries("upstart service", "trusty", "precise")
+	// Registering the same series again, in any order, is allowed.
+	r.Clone("other").RegisterSeries("upstart service", "precise", "trusty")
+	c.Assert(r.RegisteredSeries(), jc.DeepEquals, map[string][]string{
+		"upstart service": {"precise", "trusty"},
+	})
+	c.Assert(func() {
+		r.RegisterSeries("upstart service", "trusty")
+	}, gc.PanicMatches, `feature "upstart service" is already registered with different series \(\[precise trusty\]\)`)
+	c.Assert(func() {
+		r.RegisterSeries("snap")
+	}, gc.PanicMatches, `no series given for feature "snap"`)
+}
@@ -0,0 +1,456 @@
+package hook
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/errgo.v1"
+)
+
+// shellCommand holds the argument that runs the interactive
+// shell instead of a hook: "runhook shell".
+const shellCommand = "shell"
+
+// shellPrompt holds the prompt printed by the interactive shell.
+const shellPrompt = "runhook> "
+
+// shellStatuses holds the statuses that can be set from the shell.
+var shellStatuses = []string{
+	string(StatusActive),
+	string(StatusBlocked),
+	string(StatusMaintenance),
+	string(StatusWaiting),
+}
+
+// shellCmd describes a command understood by the shell.
+type shellCmd struct {
+	// args describes the command's arguments, for help.
+	args string
+
+	// help holds a one-line description of the command.
+	help string
+
+	// run runs the command with the given arguments.
+	run func(s *shell, args []string) error
+
+	// complete, if non-nil, returns the possible values
+	// of the argument following the given arguments.
+	complete func(s *shell, args []string) []string
+}
+
+var shellCmds map[string]*shellCmd
+
+func init() {
+	// shellCmds is initialized here because the help
+	// command refers to it.
+	shellCmds = map[string]*shellCmd{
+		"config-get": {
+			args:     "[key]",
+			help:     "print a configuration option, or all of them",
+			run:      (*shell).configGet,
+			complete: (*shell).completeConfig,
+		},
+		"relation-ids": {
+			args:     "[relation-name]",
+			help:     "print the ids of a relation, or of all relations",
+			run:      (*shell).relationIds,
+			complete: (*shell).completeRelationName,
+		},
+		"relation-get": {
+			args:     "relation-id unit [key]",
+			help:     "print the relation settings of a unit",
+			run:      (*shell).relationGet,
+			complete: (*shell).completeRelationUnit,
+		},
+		"relation-set": {
+			args:     "relation-id key=value...",
+			help:     "set relation settings of the local unit",
+			run:      (*shell).relationSet,
+			complete: (*shell).completeRelationId,
+		},
+		"status-set": {
+			args:     "status [message]",
+			help:     "set the unit's status",
+			run:      (*shell).statusSet,
+			complete: (*shell).completeStatus,
+		},
+		"help": {
+			args:     "[command]",
+			help:     "describe the available commands",
+			run:      (*shell).help,
+			complete: (*shell).completeCommand,
+		},
+		"exit": {
+			help: "leave the shell",
+		},
+	}
+}
+
+// shell implements the interactive shell run by "runhook shell".
+// Its commands call the same Context methods that are available to
+// the charm's hooks, so that someone debugging a hook (for example
+// with juju debug-hooks) can look at and change the hook's state
+// as the charm would.
+type shell struct {
+	r    *Registry
+	ctxt *Context
+	out  io.Writer
+}
+
+// runShell runs the shell on the standard input and output, reading
+// commands until "exit" is entered or the input ends. If the input is
+// a terminal, it is put into raw mode so that commands can be edited
+// and completed with the tab key.
+func runShell(r *Registry, ctxt *Context) error {
+	s := &shell{
+		r:    r,
+		ctxt: ctxt,
+	}
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return s.serve(rw, false)
+	}
+	oldState, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return errgo.Notef(err, "cannot put terminal into raw mode")
+	}
+	defer terminal.Restore(fd, oldState)
+	return s.serve(rw, true)
+}
+
+// serve reads and runs commands from rw, writing their output to rw.
+// If interactive is true, rw is treated as a terminal in raw mode.
+func (s *shell) serve(rw io.ReadWriter, interactive bool) error {
+	var readLine func() (string, error)
+	if interactive {
+		t := terminal.NewTerminal(rw, shellPrompt)
+		t.AutoCompleteCallback = s.autoComplete
+		s.out = t
+		readLine = t.ReadLine
+		fmt.Fprintf(s.out, "gocharm shell for %s in hook %s; type \"help\" for help\n", s.ctxt.Unit, s.ctxt.HookName)
+	} else {
+		scanner := bufio.NewScanner(rw)
+		s.out = rw
+		readLine = func() (string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		}
+	}
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errgo.Notef(err, "cannot read command")
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" {
+			return nil
+		}
+		if err := s.run(args); err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
+
+// run runs the shell command with the given arguments, the first
+// of which is the command name.
+func (s *shell) run(args []string) error {
+	cmd := shellCmds[args[0]]
+	if cmd == nil || cmd.run == nil {
+		return errgo.Newf("unknown command %q; type \"help\" for help", args[0])
+	}
+	// Each command sees the current state, not the
+	// state when the shell started.
+	s.ctxt.Invalidate()
+	return cmd.run(s, args[1:])
+}
+
+// autoComplete implements terminal.Terminal.AutoCompleteCallback by
+// completing the word before the cursor when tab is pressed.
+func (s *shell) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	completed, candidates := s.complete(line[:pos])
+	if len(candidates) > 1 && completed == line[:pos] {
+		fmt.Fprintf(s.out, "%s\n", strings.Join(candidates, "  "))
+	}
+	return completed + line[pos:], len(completed), true
+}
+
+// complete completes the last word of the given partial command line.
+// It returns the completed line and the possible completions of the
+// word. If there is only one, it is completed in full and followed by
+// a space; otherwise the word is extended by the prefix that all the
+// completions share.
+func (s *shell) complete(line string) (string, []string) {
+	args := strings.Fields(line)
+	word := ""
+	if len(args) > 0 && !strings.HasSuffix(line, " ") {
+		word, args = args[len(args)-1], args[:len(args)-1]
+	}
+	var possible []string
+	if len(args) == 0 {
+		possible = s.completeCommand(nil)
+	} else if cmd := shellCmds[args[0]]; cmd != nil && cmd.complete != nil {
+		possible = cmd.complete(s, args[1:])
+	}
+	var candidates []string
+	for _, p := range possible {
+		if strings.HasPrefix(p, word) {
+			candidates = append(candidates, p)
+		}
+	}
+	sort.Strings(candidates)
+	switch len(candidates) {
+	case 0:
+		return line, nil
+	case 1:
+		return line + strings.TrimPrefix(candidates[0], word) + " ", candidates
+	}
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[0 : len(prefix)-1]
+		}
+	}
+	return line + strings.TrimPrefix(prefix, word), candidates
+}
+
+func (s *shell) configGet(args []string) error {
+	switch len(args) {
+	case 0:
+		var val map[string]interface{}
+		if err := s.ctxt.GetAllConfig(&val); err != nil {
+			return errgo.Mask(err)
+		}
+		for _, key := range sortedMapKeys(val) {
+			s.printJSON(key+"=", val[key])
+		}
+	case 1:
+		var val interface{}
+		if err := s.ctxt.GetConfig(args[0], &val); err != nil {
+			return errgo.Mask(err)
+		}
+		s.printJSON("", val)
+	default:
+		return s.usage("config-get")
+	}
+	return nil
+}
+
+func (s *shell) relationIds(args []string) error {
+	switch len(args) {
+	case 0:
+		names := s.completeRelationName(nil)
+		sort.Strings(names)
+		for _, name := range names {
+			ids, err := s.ctxt.relationIds(name)
+			if err != nil {
+				return errgo.Mask(err)
+			}
+			fmt.Fprintf(s.out, "%s: %s\n", name, joinRelationIds(ids))
+		}
+	case 1:
+		ids, err := s.ctxt.relationIds(args[0])
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		fmt.Fprintf(s.out, "%s\n", joinRelationIds(ids))
+	default:
+		return s.usage("relation-ids")
+	}
+	return nil
+}
+
+func (s *shell) relationGet(args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return s.usage("relation-get")
+	}
+	settings, err := s.ctxt.getAllRelationUnit(RelationId(args[0]), UnitId(args[1]))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if len(args) == 3 {
+		fmt.Fprintf(s.out, "%s\n", settings[args[2]])
+		return nil
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(s.out, "%s=%s\n", key, settings[key])
+	}
+	return nil
+}
+
+func (s *shell) relationSet(args []string) error {
+	if len(args) < 2 {
+		return s.usage("relation-set")
+	}
+	var keyvals []string
+	for _, kv := range args[1:] {
+		i := strings.Index(kv, "=")
+		if i == -1 {
+			return errgo.Newf("expected key=value, got %q", kv)
+		}
+		keyvals = append(keyvals, kv[0:i], kv[i+1:])
+	}
+	return errgo.Mask(s.ctxt.SetRelationWithId(RelationId(args[0]), keyvals...))
+}
+
+func (s *shell) statusSet(args []string) error {
+	if len(args) == 0 {
+		return s.usage("status-set")
+	}
+	found := false
+	for _, st := range shellStatuses {
+		found = found || st == args[0]
+	}
+	if !found {
+		return errgo.Newf("invalid status %q; must be one of %s", args[0], strings.Join(shellStatuses, ", "))
+	}
+	return errgo.Mask(s.ctxt.SetStatus(Status(args[0]), strings.Join(args[1:], " ")))
+}
+
+func (s *shell) help(args []string) error {
+	names := args
+	if len(names) == 0 {
+		names = s.completeCommand(nil)
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		cmd := shellCmds[name]
+		if cmd == nil {
+			return errgo.Newf("unknown command %q", name)
+		}
+		fmt.Fprintf(s.out, "%s\n\t%s\n", strings.TrimSpace(name+" "+cmd.args), cmd.help)
+	}
+	return nil
+}
+
+func (s *shell) usage(name string) error {
+	return errgo.Newf("usage: %s %s", name, shellCmds[name].args)
+}
+
+// printJSON prints the given value in JSON format,
+// preceded by prefix.
+func (s *shell) printJSON(prefix string, val interface{}) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		data = []byte(fmt.Sprint(val))
+	}
+	fmt.Fprintf(s.out, "%s%s\n", prefix, data)
+}
+
+func (s *shell) completeCommand(args []string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	names := make([]string, 0, len(shellCmds))
+	for name := range shellCmds {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s *shell) completeConfig(args []string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	var keys []string
+	for key := range s.r.RegisteredConfig() {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *shell) completeRelationName(args []string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	var names []string
+	for name := range s.r.RegisteredRelations() {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s *shell) completeRelationId(args []string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	var ids []string
+	for _, relIds := range s.ctxt.RelationIds {
+		for _, id := range relIds {
+			ids = append(ids, string(id))
+		}
+	}
+	return ids
+}
+
+func (s *shell) completeRelationUnit(args []string) []string {
+	switch len(args) {
+	case 0:
+		return s.completeRelationId(nil)
+	case 1:
+		units := []string{string(s.ctxt.Unit)}
+		for unit := range s.ctxt.Relations[RelationId(args[0])] {
+			units = append(units, string(unit))
+		}
+		return units
+	case 2:
+		var keys []string
+		for key := range s.ctxt.Relations[RelationId(args[0])][UnitId(args[1])] {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	return nil
+}
+
+func (s *shell) completeStatus(args []string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	return shellStatuses
+}
+
+func joinRelationIds(ids []RelationId) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = string(id)
+	}
+	return strings.Join(s, " ")
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
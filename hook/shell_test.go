@@ -0,0 +1,158 @@
+package hook_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type shellSuite struct{}
+
+var _ = gc.Suite(&shellSuite{})
+
+func newShellContext() (*hook.Registry, *hook.TestContext) {
+	r := hook.NewRegistry()
+	r.RegisterConfig("port", charm.Option{Type: "int"})
+	r.RegisterConfig("name", charm.Option{Type: "string"})
+	r.RegisterRelation(charm.Relation{
+		Name:      "db",
+		Role:      charm.RoleRequirer,
+		Interface: "mysql",
+	})
+	t := hook.NewTestContext(hook.TestContextParams{
+		HookName: "config-changed",
+		Config: map[string]interface{}{
+			"port": 8080,
+			"name": "foo",
+		},
+		RelationIds: map[string][]hook.RelationId{
+			"db": {"db:0"},
+		},
+		Relations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"db:0": {
+				"mysql/0": {"host": "10.0.0.1", "port": "3306"},
+			},
+		},
+	})
+	return r, t
+}
+
+func (*shellSuite) TestCommands(c *gc.C) {
+	r, t := newShellContext()
+	var out bytes.Buffer
+	in := strings.NewReader(`
+config-get port
+config-get
+relation-ids
+relation-get db:0 mysql/0
+relation-get db:0 mysql/0 host
+relation-set db:0 user=admin
+status-set active all  good
+status-set happy
+relation-get db:0
+frobnicate
+exit
+status-set blocked
+`)
+	err := hook.ShellServe(r, t.Context, struct {
+		io.Reader
+		io.Writer
+	}{in, &out}, false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(out.String(), gc.Equals, `8080
+name="foo"
+port=8080
+db: db:0
+host=10.0.0.1
+port=3306
+10.0.0.1
+error: invalid status "happy"; must be one of active, blocked, maintenance, waiting
+error: usage: relation-get relation-id unit [key]
+error: unknown command "frobnicate"; type "help" for help
+`)
+	c.Assert(t.Ops, jc.DeepEquals, [][]string{
+		{"relation-set", "-r", "db:0", "--", "user=admin"},
+		{"status-set", "active", "all good"},
+	})
+}
+
+func (*shellSuite) TestInteractive(c *gc.C) {
+	r, t := newShellContext()
+	var out bytes.Buffer
+	// The tab completes the command name; control-D ends the session.
+	in := strings.NewReader("conf\tname\r\x04")
+	err := hook.ShellServe(r, t.Context, struct {
+		io.Reader
+		io.Writer
+	}{in, &out}, true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(out.String(), gc.Matches, `(?s)gocharm shell for someunit/0 in hook config-changed.*config-get name.*"foo"\n.*`)
+}
+
+var shellCompleteTests = []struct {
+	line       string
+	expect     string
+	candidates []string
+}{{
+	line:       "",
+	expect:     "",
+	candidates: []string{"config-get", "exit", "help", "relation-get", "relation-ids", "relation-set", "status-set"},
+}, {
+	line:       "conf",
+	expect:     "config-get ",
+	candidates: []string{"config-get"},
+}, {
+	line:       "relation-",
+	expect:     "relation-",
+	candidates: []string{"relation-get", "relation-ids", "relation-set"},
+}, {
+	line:       "relation-i",
+	expect:     "relation-ids ",
+	candidates: []string{"relation-ids"},
+}, {
+	line:       "config-get ",
+	expect:     "config-get ",
+	candidates: []string{"name", "port"},
+}, {
+	line:       "config-get p",
+	expect:     "config-get port ",
+	candidates: []string{"port"},
+}, {
+	line:   "config-get port ",
+	expect: "config-get port ",
+}, {
+	line:       "relation-get d",
+	expect:     "relation-get db:0 ",
+	candidates: []string{"db:0"},
+}, {
+	line:       "relation-get db:0 ",
+	expect:     "relation-get db:0 ",
+	candidates: []string{"mysql/0", "someunit/0"},
+}, {
+	line:       "relation-get db:0 mysql/0 h",
+	expect:     "relation-get db:0 mysql/0 host ",
+	candidates: []string{"host"},
+}, {
+	line:       "status-set m",
+	expect:     "status-set maintenance ",
+	candidates: []string{"maintenance"},
+}, {
+	line:   "unknown x",
+	expect: "unknown x",
+}}
+
+func (*shellSuite) TestComplete(c *gc.C) {
+	r, t := newShellContext()
+	for i, test := range shellCompleteTests {
+		c.Logf("test %d: %q", i, test.line)
+		line, candidates := hook.ShellComplete(r, t.Context, test.line)
+		c.Assert(line, gc.Equals, test.expect)
+		c.Assert(candidates, jc.DeepEquals, test.candidates)
+	}
+}
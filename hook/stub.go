@@ -0,0 +1,111 @@
+package hook
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/errgo.v1"
+)
+
+// HookStub specifies how the hook stub generated by gocharm
+// runs the charm binary. The stub is a script that is run by Juju
+// and which in turn runs the charm's binary to run the hook
+// functions.
+type HookStub struct {
+	// Interpreter holds the path of the interpreter used to run
+	// the stub, written to its "#!" line. If it is empty, /bin/sh is
+	// used. The stub is written in POSIX shell syntax, so the
+	// interpreter must accept that.
+	Interpreter string
+
+	// Env holds environment variables to set before running the
+	// hook. The values are subject to shell parameter expansion,
+	// so, for example, "$CHARM_DIR/bin:$PATH" may be used to add
+	// to $PATH.
+	Env map[string]string
+
+	// Dir holds the working directory to run the hook in.
+	// If it is relative, it is interpreted relative to $CHARM_DIR.
+	Dir string
+
+	// Setup holds shell commands that are run, in order, before
+	// the hook, for example "ulimit -n 65536". If any command fails,
+	// the hook fails.
+	Setup []string
+}
+
+var envVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RegisterHookStub registers details of the stub to be generated for
+// the hook with the given name. If the name is "*", the details apply
+// to all hooks.
+//
+// Registrations for the same hook, and those for "*", are merged:
+// setup commands are run in order of registration (with those for
+// "*" first), and environment variables, the working directory and the
+// interpreter may be registered more than once only if the values
+// are the same.
+func (r *Registry) RegisterHookStub(name string, stub HookStub) {
+	if name != "*" && !validHookName(name) {
+		panic(fmt.Errorf("invalid hook name %q", name))
+	}
+	name = r.hookName(name)
+	for key := range stub.Env {
+		if !envVarPattern.MatchString(key) {
+			panic(errgo.Newf("invalid environment variable name %q in stub for hook %q", key, name))
+		}
+	}
+	merged, err := mergeHookStubs(r.stubs[name], stub)
+	if err != nil {
+		panic(errgo.Notef(err, "cannot register stub for hook %q", name))
+	}
+	r.stubs[name] = merged
+}
+
+// HookStub returns the details of the stub for the hook with the
+// given name, combining those registered for the hook with those
+// registered for "*".
+func (r *Registry) HookStub(name string) HookStub {
+	stub, err := mergeHookStubs(r.stubs["*"], r.stubs[name])
+	if err != nil {
+		// RegisterHookStub checks for conflicts only within
+		// a single name, so we might find one here.
+		panic(errgo.Notef(err, "conflicting stubs registered for hook %q", name))
+	}
+	return stub
+}
+
+// mergeHookStubs returns the combination of the two stubs.
+func mergeHookStubs(s0, s1 HookStub) (HookStub, error) {
+	var s HookStub
+	var err error
+	if s.Interpreter, err = mergeString("interpreter", s0.Interpreter, s1.Interpreter); err != nil {
+		return HookStub{}, err
+	}
+	if s.Dir, err = mergeString("working directory", s0.Dir, s1.Dir); err != nil {
+		return HookStub{}, err
+	}
+	if len(s0.Env) > 0 || len(s1.Env) > 0 {
+		s.Env = make(map[string]string)
+		for _, env := range []map[string]string{s0.Env, s1.Env} {
+			for key, val := range env {
+				if old, ok := s.Env[key]; ok && old != val {
+					return HookStub{}, errgo.Newf("environment variable %s set to both %q and %q", key, old, val)
+				}
+				s.Env[key] = val
+			}
+		}
+	}
+	s.Setup = append(append(s.Setup, s0.Setup...), s1.Setup...)
+	return s, nil
+}
+
+func mergeString(what, s0, s1 string) (string, error) {
+	switch {
+	case s0 == "":
+		return s1, nil
+	case s1 == "" || s0 == s1:
+		return s0, nil
+	}
+	return "", errgo.Newf("%s set to both %q and %q", what, s0, s1)
+}
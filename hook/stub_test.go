@@ -0,0 +1,87 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type stubSuite struct{}
+
+var _ = gc.Suite(&stubSuite{})
+
+func (s *stubSuite) TestRegisterHookStub(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterHookStub("*", hook.HookStub{
+		Env: map[string]string{
+			"PATH": "$CHARM_DIR/bin:$PATH",
+		},
+		Setup: []string{"ulimit -n 4096"},
+	})
+	r.RegisterHookStub("install", hook.HookStub{
+		Interpreter: "/bin/bash",
+		Dir:         "assets",
+		Setup:       []string{"mkdir -p /var/lib/foo"},
+	})
+	r.Clone("sub").RegisterHookStub("install", hook.HookStub{
+		Env: map[string]string{
+			"FOO": "bar",
+		},
+		Dir: "assets",
+	})
+	c.Assert(r.HookStub("install"), jc.DeepEquals, hook.HookStub{
+		Interpreter: "/bin/bash",
+		Env: map[string]string{
+			"PATH": "$CHARM_DIR/bin:$PATH",
+			"FOO":  "bar",
+		},
+		Dir:   "assets",
+		Setup: []string{"ulimit -n 4096", "mkdir -p /var/lib/foo"},
+	})
+	c.Assert(r.HookStub("start"), jc.DeepEquals, hook.HookStub{
+		Env: map[string]string{
+			"PATH": "$CHARM_DIR/bin:$PATH",
+		},
+		Setup: []string{"ulimit -n 4096"},
+	})
+}
+
+func (s *stubSuite) TestRegisterHookStubConflicts(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterHookStub("install", hook.HookStub{
+		Dir: "a",
+		Env: map[string]string{
+			"FOO": "bar",
+		},
+	})
+	c.Assert(func() {
+		r.RegisterHookStub("install", hook.HookStub{
+			Dir: "b",
+		})
+	}, gc.PanicMatches, `cannot register stub for hook "install": working directory set to both "a" and "b"`)
+	c.Assert(func() {
+		r.RegisterHookStub("install", hook.HookStub{
+			Env: map[string]string{
+				"FOO": "baz",
+			},
+		})
+	}, gc.PanicMatches, `cannot register stub for hook "install": environment variable FOO set to both "bar" and "baz"`)
+	c.Assert(func() {
+		r.RegisterHookStub("install", hook.HookStub{
+			Env: map[string]string{
+				"FOO BAR": "baz",
+			},
+		})
+	}, gc.PanicMatches, `invalid environment variable name "FOO BAR" in stub for hook "install"`)
+	c.Assert(func() {
+		r.RegisterHookStub("bad-hook", hook.HookStub{})
+	}, gc.PanicMatches, `invalid hook name "bad-hook"`)
+
+	r.RegisterHookStub("*", hook.HookStub{
+		Dir: "b",
+	})
+	c.Assert(func() {
+		r.HookStub("install")
+	}, gc.PanicMatches, `conflicting stubs registered for hook "install": working directory set to both "b" and "a"`)
+}
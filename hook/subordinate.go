@@ -0,0 +1,50 @@
+package hook
+
+import (
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+// JujuInfoInterface holds the name of the interface that every
+// charm implicitly provides through a relation named "juju-info".
+// A subordinate charm can use it to relate to any principal.
+const JujuInfoInterface = "juju-info"
+
+// RegisterPrincipalRelation registers a container-scoped requirer
+// relation with the given name and interface. A subordinate charm
+// (one with "subordinate: true" in its metadata.yaml) must have at
+// least one such relation, through which it is deployed alongside
+// its principal unit. If interfaceName is empty, JujuInfoInterface is
+// used, which allows the subordinate to relate to any charm.
+func (r *Registry) RegisterPrincipalRelation(name, interfaceName string) {
+	if interfaceName == "" {
+		interfaceName = JujuInfoInterface
+	}
+	r.RegisterRelation(charm.Relation{
+		Name:      name,
+		Interface: interfaceName,
+		Role:      charm.RoleRequirer,
+		Scope:     charm.ScopeContainer,
+	})
+}
+
+// PrincipalUnit returns the principal unit that the local unit is
+// related to through the container-scoped relation with the given
+// name, as registered with RegisterPrincipalRelation. It returns the
+// empty string if the relation has not yet been joined.
+//
+// A subordinate service may be related to several principal
+// services, but only the units in the same container take part in a
+// container-scoped relation, so there is at most one principal unit.
+func (ctxt *Context) PrincipalUnit(relationName string) (UnitId, error) {
+	var principal UnitId
+	for _, id := range ctxt.RelationIds[relationName] {
+		for unit := range ctxt.Relations[id] {
+			if principal != "" && unit != principal {
+				return "", errgo.Newf("more than one unit found in container-scoped relation %q", relationName)
+			}
+			principal = unit
+		}
+	}
+	return principal, nil
+}
@@ -0,0 +1,87 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type subordinateSuite struct{}
+
+var _ = gc.Suite(&subordinateSuite{})
+
+func (*subordinateSuite) TestRegisterPrincipalRelation(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterPrincipalRelation("host", "")
+	r.RegisterPrincipalRelation("logs", "syslog")
+	c.Assert(r.RegisteredRelations(), jc.DeepEquals, map[string]charm.Relation{
+		"host": {
+			Name:      "host",
+			Interface: "juju-info",
+			Role:      charm.RoleRequirer,
+			Scope:     charm.ScopeContainer,
+			Limit:     1,
+		},
+		"logs": {
+			Name:      "logs",
+			Interface: "syslog",
+			Role:      charm.RoleRequirer,
+			Scope:     charm.ScopeContainer,
+			Limit:     1,
+		},
+	})
+}
+
+var principalUnitTests = []struct {
+	about       string
+	ctxt        hook.Context
+	expect      hook.UnitId
+	expectError string
+}{{
+	about: "not related",
+}, {
+	about: "relation not joined",
+	ctxt: hook.Context{
+		RelationIds: map[string][]hook.RelationId{
+			"host": {"host:0"},
+		},
+	},
+}, {
+	about: "joined, with other principal services",
+	ctxt: hook.Context{
+		RelationIds: map[string][]hook.RelationId{
+			"host": {"host:0", "host:1"},
+		},
+		Relations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"host:0": {},
+			"host:1": {"wordpress/2": {}},
+		},
+	},
+	expect: "wordpress/2",
+}, {
+	about: "more than one unit",
+	ctxt: hook.Context{
+		RelationIds: map[string][]hook.RelationId{
+			"host": {"host:0"},
+		},
+		Relations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"host:0": {"wordpress/2": {}, "wordpress/3": {}},
+		},
+	},
+	expectError: `more than one unit found in container-scoped relation "host"`,
+}}
+
+func (*subordinateSuite) TestPrincipalUnit(c *gc.C) {
+	for i, test := range principalUnitTests {
+		c.Logf("test %d: %s", i, test.about)
+		unit, err := test.ctxt.PrincipalUnit("host")
+		if test.expectError != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectError)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(unit, gc.Equals, test.expect)
+	}
+}
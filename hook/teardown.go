@@ -0,0 +1,104 @@
+package hook
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// teardownPriority holds the priority of the stop hook function that
+// runs the teardown functions, so that it runs after any functions
+// registered for the stop hook with the default priority.
+const teardownPriority = 1000
+
+// teardown holds a function registered with RegisterTeardown.
+type teardown struct {
+	registryName string
+	run          func() error
+}
+
+// RegisterTeardown registers a function to be called when the unit
+// is stopped, before it is removed. Teardown functions are called in
+// the stop hook after any functions registered for the stop hook
+// itself, in reverse order of registration, so that something set up
+// after something else is torn down first. They are all called even
+// if some of them fail, and the stop hook fails with all of their
+// errors if so.
+//
+// After the teardown functions have been called, any ports that the
+// unit has open are closed, and if everything succeeded the unit's
+// local state is removed.
+func (r *Registry) RegisterTeardown(f func() error) {
+	r.teardowns = append(r.teardowns, teardown{
+		registryName: r.name,
+		run:          f,
+	})
+}
+
+// registerTeardownHook registers the stop hook function
+// that runs the teardown functions.
+func registerTeardownHook(r *Registry) {
+	var ctxt *Context
+	r.contexts = append(r.contexts, func(c *Context) error {
+		ctxt = c
+		return nil
+	})
+	r.RegisterHookWithPriority("stop", teardownPriority, func() error {
+		return runTeardowns(ctxt, r.teardowns)
+	})
+}
+
+// runTeardowns calls the given teardown functions in reverse order,
+// then closes all the open ports. If nothing failed, it arranges for
+// the unit's local state to be removed when the hook completes.
+func runTeardowns(ctxt *Context, teardowns []teardown) error {
+	var failed []string
+	for i := len(teardowns) - 1; i >= 0; i-- {
+		t := teardowns[i]
+		if err := t.run(); err != nil {
+			ctxt.Logf("teardown for %s failed: %v", t.registryName, err)
+			failed = append(failed, t.registryName+": "+err.Error())
+		}
+	}
+	if err := closeAllPorts(ctxt); err != nil {
+		failed = append(failed, err.Error())
+	}
+	if len(failed) > 0 {
+		return errgo.Newf("teardown failed: %s", strings.Join(failed, "; "))
+	}
+	ctxt.removeState = true
+	return nil
+}
+
+// closeAllPorts closes all the ports opened by the unit.
+func closeAllPorts(ctxt *Context) error {
+	ports, err := ctxt.OpenedPorts()
+	if errgo.Cause(err) == ErrUnimplemented {
+		ctxt.Logf("cannot find opened ports; leaving them alone")
+		return nil
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot get opened ports")
+	}
+	for _, p := range ports {
+		if _, err := ctxt.Runner.Run("close-port", p.String()); err != nil {
+			return errgo.Notef(err, "cannot close port %s", p)
+		}
+	}
+	return nil
+}
+
+// stateRemover is implemented by PersistentState
+// implementations that can remove all their state.
+type stateRemover interface {
+	removeAll() error
+}
+
+// removeAll implements stateRemover.removeAll.
+func (s *diskState) removeAll() error {
+	if err := os.RemoveAll(s.dir); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package hook_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+)
+
+type teardownSuite struct{}
+
+var _ = gc.Suite(&teardownSuite{})
+
+type teardownState struct {
+	Value string
+}
+
+func (s *teardownSuite) TestTeardown(c *gc.C) {
+	stateDir := filepath.Join(c.MkDir(), "state")
+	var calls []string
+	failures := make(map[string]error)
+	var state teardownState
+	runner := &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			r.RegisterContext(func(*hook.Context) error { return nil }, &state)
+			r.RegisterHook("stop", func() error {
+				calls = append(calls, "stop")
+				return nil
+			})
+			for _, name := range []string{"a", "b", "c"} {
+				name := name
+				r.Clone(name).RegisterTeardown(func() error {
+					calls = append(calls, name)
+					return failures[name]
+				})
+			}
+			r.RegisterHook("install", func() error {
+				state.Value = "installed"
+				return nil
+			})
+		},
+		OpenedPorts: map[string]bool{
+			"80/tcp":        true,
+			"1000-2000/udp": true,
+		},
+		State:  hook.NewDiskState(stateDir),
+		Logger: c,
+	}
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(stateDir)
+	c.Assert(err, gc.IsNil)
+
+	// All the teardowns run, even when some fail, and the
+	// state is kept so that the hook can be retried.
+	failures["a"] = errgo.New("a failed")
+	failures["c"] = errgo.New("c failed")
+	err = runner.RunHook("stop", "", "")
+	c.Assert(err, gc.ErrorMatches, `.*teardown failed: root\.c: c failed; root\.a: a failed`)
+	c.Assert(calls, jc.DeepEquals, []string{"stop", "c", "b", "a"})
+	c.Assert(runner.OpenedPorts, gc.HasLen, 0)
+	_, err = os.Stat(stateDir)
+	c.Assert(err, gc.IsNil)
+
+	calls = nil
+	runner.Record = nil
+	runner.OpenedPorts = map[string]bool{"80/tcp": true}
+	failures = make(map[string]error)
+	err = runner.RunHook("stop", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(calls, jc.DeepEquals, []string{"stop", "c", "b", "a"})
+	c.Assert(runner.Record, jc.DeepEquals, [][]string{{"close-port", "80/tcp"}})
+	_, err = os.Stat(stateDir)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *teardownSuite) TestStopHookAlwaysRegistered(c *gc.C) {
+	r := hook.NewRegistry()
+	hook.RegisterMainHooks(r)
+	hooks := r.RegisteredHooks()
+	sort.Strings(hooks)
+	c.Assert(hooks, jc.DeepEquals, []string{"install", "start", "stop"})
+}
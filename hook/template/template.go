@@ -0,0 +1,139 @@
+// The template package provides a way for a charm to write
+// files, typically configuration files generated from
+// charm configuration and relation data, so that it can
+// tell whether the file has actually changed (and hence
+// whether any service using it needs to be restarted).
+//
+// Files are written atomically, so a running service
+// will never see a partially written file.
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	gotemplate "text/template"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+// File describes a file to be written.
+type File struct {
+	// Path holds the path of the file.
+	Path string
+
+	// Perm holds the permissions of the file.
+	Perm os.FileMode
+
+	// Owner and Group hold the names of the user
+	// and group that should own the file. If either is
+	// empty, the respective ownership will be that of the
+	// current process.
+	Owner string
+	Group string
+}
+
+// WriteTemplate writes the result of executing tmpl with the given data
+// to the file at the given path with the given permissions. It reports
+// whether the contents of the file have changed.
+func WriteTemplate(path string, tmpl *gotemplate.Template, data interface{}, perm os.FileMode) (changed bool, err error) {
+	return File{
+		Path: path,
+		Perm: perm,
+	}.WriteTemplate(tmpl, data)
+}
+
+// WriteTemplate writes the result of executing tmpl with the given
+// data to the file. See File.Write for details.
+func (f File) WriteTemplate(tmpl *gotemplate.Template, data interface{}) (changed bool, err error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return false, errgo.Notef(err, "cannot execute template for %s", f.Path)
+	}
+	return f.Write(buf.Bytes())
+}
+
+// Write writes the given data to the file and reports whether the
+// contents of the file have changed. It returns true if the file did
+// not previously exist.
+//
+// The file permissions and ownership are always set, regardless of
+// whether the contents have changed, but a change only to the
+// permissions or ownership is not reported.
+func (f File) Write(data []byte) (changed bool, err error) {
+	uid, gid, err := f.owner()
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	old, err := ioutil.ReadFile(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, errgo.Mask(err)
+	}
+	if err == nil && bytes.Equal(old, data) {
+		if err := os.Chmod(f.Path, f.Perm); err != nil {
+			return false, errgo.Mask(err)
+		}
+		if err := os.Lchown(f.Path, uid, gid); err != nil {
+			return false, errgo.Mask(err)
+		}
+		return false, nil
+	}
+	if err := atomicWrite(f.Path, data, f.Perm, uid, gid); err != nil {
+		return false, errgo.Notef(err, "cannot write %s", f.Path)
+	}
+	return true, nil
+}
+
+// atomicWrite writes a file by writing it to a temporary file in
+// the same directory and renaming it into place.
+func atomicWrite(path string, data []byte, perm os.FileMode, uid, gid int) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Lchown(tmp.Name(), uid, gid); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// owner returns the user and group ids that should own the file.
+// An id of -1 signifies that it should not be changed.
+func (f File) owner() (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if f.Owner != "" {
+		if uid, err = hook.LookupUserId(f.Owner); err != nil {
+			return 0, 0, errgo.Notef(err, "cannot find user %q", f.Owner)
+		}
+	}
+	if f.Group != "" {
+		if gid, err = hook.LookupGroupId(f.Group); err != nil {
+			return 0, 0, errgo.Notef(err, "cannot find group %q", f.Group)
+		}
+	}
+	return uid, gid, nil
+}
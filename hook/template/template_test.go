@@ -0,0 +1,83 @@
+package template_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	gotemplate "text/template"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook/template"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+type templateSuite struct{}
+
+var _ = gc.Suite(&templateSuite{})
+
+var testTemplate = gotemplate.Must(gotemplate.New("").Parse("port = {{.Port}}\n"))
+
+func (s *templateSuite) TestWriteTemplate(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "conf")
+
+	changed, err := template.WriteTemplate(path, testTemplate, struct{ Port int }{8080}, 0640)
+	c.Assert(err, gc.IsNil)
+	c.Assert(changed, gc.Equals, true)
+	assertFile(c, path, "port = 8080\n", 0640)
+
+	changed, err = template.WriteTemplate(path, testTemplate, struct{ Port int }{8080}, 0600)
+	c.Assert(err, gc.IsNil)
+	c.Assert(changed, gc.Equals, false)
+	assertFile(c, path, "port = 8080\n", 0600)
+
+	changed, err = template.WriteTemplate(path, testTemplate, struct{ Port int }{9090}, 0600)
+	c.Assert(err, gc.IsNil)
+	c.Assert(changed, gc.Equals, true)
+	assertFile(c, path, "port = 9090\n", 0600)
+
+	// Check that no temporary files have been left around.
+	infos, err := ioutil.ReadDir(filepath.Dir(path))
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+}
+
+func (s *templateSuite) TestWriteTemplateError(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "conf")
+	tmpl := gotemplate.Must(gotemplate.New("").Parse("{{.Foo}}"))
+	_, err := template.WriteTemplate(path, tmpl, struct{}{}, 0600)
+	c.Assert(err, gc.ErrorMatches, `cannot execute template for .*/conf: .*`)
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *templateSuite) TestWriteUnknownOwner(c *gc.C) {
+	// The ids are looked up with hook.LookupUserId and
+	// hook.LookupGroupId, which are tested in the hook
+	// package, so use names that will not be found.
+	f := template.File{
+		Path:  filepath.Join(c.MkDir(), "conf"),
+		Perm:  0600,
+		Owner: "gocharm-nouser",
+	}
+	_, err := f.Write([]byte("x"))
+	c.Assert(err, gc.ErrorMatches, `cannot find user "gocharm-nouser": "gocharm-nouser" not found in .*/passwd`)
+
+	f.Owner = ""
+	f.Group = "gocharm-nogroup"
+	_, err = f.Write([]byte("x"))
+	c.Assert(err, gc.ErrorMatches, `cannot find group "gocharm-nogroup": "gocharm-nogroup" not found in .*/group`)
+}
+
+func assertFile(c *gc.C, path, content string, perm os.FileMode) {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, content)
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, perm)
+}
@@ -0,0 +1,382 @@
+package hook
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// TestContextParams holds the parameters for NewTestContext.
+type TestContextParams struct {
+	// HookName holds the name of the hook that the context
+	// is for. If it is empty, "install" is used.
+	HookName string
+
+	// Unit holds the name of the local unit.
+	// If it is empty, "someunit/0" is used.
+	Unit UnitId
+
+	// CharmDir holds the charm directory.
+	CharmDir string
+
+	// RelationId and RemoteUnit hold the relation and
+	// remote unit that a relation hook is running for.
+	// The relation name is found from RelationIds.
+	RelationId RelationId
+	RemoteUnit UnitId
+
+	// Config holds the charm's configuration settings.
+	Config map[string]interface{}
+
+	// PreviousConfig holds the configuration settings
+	// returned by Context.PreviousConfig.
+	PreviousConfig map[string]interface{}
+
+	// RelationIds holds the relation ids for each relation,
+	// and Relations holds the settings of each remote unit
+	// in each relation, as in Context.
+	RelationIds map[string][]RelationId
+	Relations   map[RelationId]map[UnitId]map[string]string
+
+	// PreviousRelations holds the settings of each remote
+	// unit when a hook last ran, as used by RelationChanges.
+	PreviousRelations map[RelationId]map[UnitId]map[string]string
+
+	// OpenedPorts holds the ports that are open, in the form
+	// used by open-port (for example "80/tcp").
+	OpenedPorts []string
+
+	// Leader holds whether the local unit is the leader
+	// and LeaderSettings holds the leader settings.
+	Leader         bool
+	LeaderSettings map[string]string
+
+	// PublicAddress and PrivateAddress hold the
+	// addresses of the local unit.
+	PublicAddress  string
+	PrivateAddress string
+
+	// GoalState holds the goal state returned by
+	// Context.GoalState. If it is nil, goal-state will
+	// behave as if running on an older Juju agent that
+	// does not implement it.
+	GoalState *GoalState
+
+	// Environ holds the environment returned in
+	// Context.Environ. Its HookName, UnitName, CharmDir,
+	// ModelUUID and relation fields are filled in from
+	// the other parameters if they are empty.
+	Environ Environ
+}
+
+// TestContext holds a Context whose hook tools are implemented in
+// memory, so that hook functions can be tested without Juju or a
+// fake hook tool server. Changes made through the context are
+// applied to the fields of the TestContext and recorded in Ops.
+//
+// The Context caches configuration and relation settings as usual,
+// so if a test changes them after they have been read, it should
+// call Invalidate.
+type TestContext struct {
+	// Context holds the context to pass to the code under test.
+	*Context
+
+	// Ops records each operation that changed something, in
+	// order, as the hook tool name followed by its arguments,
+	// for example []string{"open-port", "80/tcp"}.
+	Ops [][]string
+
+	// Logs holds all the messages logged through the context,
+	// prefixed with their level if one was given.
+	Logs []string
+
+	// Config holds the charm's configuration settings.
+	Config map[string]interface{}
+
+	// Ports holds the ports that are currently open,
+	// as returned by Context.OpenedPorts.
+	Ports map[string]bool
+
+	// Leader holds whether the local unit is the leader.
+	Leader bool
+
+	// LeaderSettings holds the current leader settings.
+	LeaderSettings map[string]string
+
+	// LocalSettings holds the relation settings of the local
+	// unit, keyed by relation id.
+	LocalSettings map[RelationId]map[string]string
+
+	// Status and StatusMessage hold the most recently set status.
+	Status        Status
+	StatusMessage string
+
+	// Metrics holds the most recently added value of each metric.
+	Metrics map[string]string
+}
+
+// testUUID holds the environment UUID of a TestContext.
+const testUUID = "373b309b-4a86-4f13-88e2-c213d97075b8"
+
+// NewTestContext returns a new TestContext initialized from
+// the given parameters.
+func NewTestContext(p TestContextParams) *TestContext {
+	t := &TestContext{
+		Config:         p.Config,
+		Ports:          make(map[string]bool),
+		Leader:         p.Leader,
+		LeaderSettings: make(map[string]string),
+		LocalSettings:  make(map[RelationId]map[string]string),
+		Metrics:        make(map[string]string),
+	}
+	if t.Config == nil {
+		t.Config = make(map[string]interface{})
+	}
+	for _, port := range p.OpenedPorts {
+		t.Ports[port] = true
+	}
+	for key, val := range p.LeaderSettings {
+		t.LeaderSettings[key] = val
+	}
+	if p.HookName == "" {
+		p.HookName = "install"
+	}
+	if p.Unit == "" {
+		p.Unit = "someunit/0"
+	}
+	if p.RelationIds == nil {
+		p.RelationIds = make(map[string][]RelationId)
+	}
+	if p.Relations == nil {
+		p.Relations = make(map[RelationId]map[UnitId]map[string]string)
+	}
+	t.Context = &Context{
+		UUID:        testUUID,
+		Unit:        p.Unit,
+		CharmDir:    p.CharmDir,
+		HookName:    p.HookName,
+		RelationIds: p.RelationIds,
+		Relations:   p.Relations,
+		RelationId:  p.RelationId,
+		RemoteUnit:  p.RemoteUnit,
+		prevConfig:  p.PreviousConfig,
+		seen:        p.PreviousRelations,
+		Environ:     p.Environ,
+		Runner: &testRunner{
+			t:              t,
+			publicAddress:  p.PublicAddress,
+			privateAddress: p.PrivateAddress,
+			goalState:      p.GoalState,
+		},
+	}
+	for name, ids := range p.RelationIds {
+		for _, id := range ids {
+			if id == p.RelationId {
+				t.RelationName = name
+			}
+		}
+	}
+	setDefault := func(s *string, val string) {
+		if *s == "" {
+			*s = val
+		}
+	}
+	env := &t.Context.Environ
+	setDefault(&env.HookName, p.HookName)
+	setDefault((*string)(&env.UnitName), string(p.Unit))
+	setDefault(&env.CharmDir, p.CharmDir)
+	setDefault(&env.ModelUUID, testUUID)
+	setDefault(&env.RelationName, t.RelationName)
+	setDefault((*string)(&env.RelationId), string(p.RelationId))
+	setDefault((*string)(&env.RemoteUnit), string(p.RemoteUnit))
+	return t
+}
+
+// testRunner implements ToolRunner for a TestContext.
+type testRunner struct {
+	t              *TestContext
+	publicAddress  string
+	privateAddress string
+	goalState      *GoalState
+}
+
+// mutators holds the hook tools that change something.
+var mutators = map[string]bool{
+	"add-metric":   true,
+	"close-port":   true,
+	"juju-reboot":  true,
+	"leader-set":   true,
+	"open-port":    true,
+	"relation-set": true,
+	"status-set":   true,
+}
+
+// Run implements ToolRunner.Run.
+func (r *testRunner) Run(cmd string, args ...string) ([]byte, error) {
+	t := r.t
+	if mutators[cmd] {
+		t.Ops = append(t.Ops, append([]string{cmd}, args...))
+	}
+	// Most commands put their positional arguments after "--".
+	pos := positionalArgs(args)
+	switch cmd {
+	case "juju-log":
+		msg := args[len(args)-1]
+		if len(args) == 3 && args[0] == "--log-level" {
+			msg = args[1] + ": " + msg
+		}
+		t.Logs = append(t.Logs, msg)
+		return nil, nil
+	case "config-get":
+		if len(pos) == 0 {
+			return toJSON(t.Config)
+		}
+		return toJSON(t.Config[pos[0]])
+	case "unit-get":
+		switch args[0] {
+		case "public-address":
+			return []byte(r.publicAddress), nil
+		case "private-address":
+			return []byte(r.privateAddress), nil
+		}
+	case "relation-ids":
+		ids := t.RelationIds[pos[0]]
+		if ids == nil {
+			ids = []RelationId{}
+		}
+		return toJSON(ids)
+	case "relation-list":
+		units := []string{}
+		for unit := range t.Relations[RelationId(flagValue(args, "-r"))] {
+			units = append(units, string(unit))
+		}
+		sort.Strings(units)
+		return toJSON(units)
+	case "relation-get":
+		id := RelationId(flagValue(args, "-r"))
+		unit := UnitId(pos[len(pos)-1])
+		if unit == t.Unit {
+			return toJSON(t.LocalSettings[id])
+		}
+		settings, ok := t.Relations[id][unit]
+		if !ok {
+			return nil, errgo.Newf("cannot read settings for unit %q in relation %q: settings not found", unit, id)
+		}
+		return toJSON(settings)
+	case "relation-set":
+		id := RelationId(flagValue(args, "-r"))
+		if t.LocalSettings[id] == nil {
+			t.LocalSettings[id] = make(map[string]string)
+		}
+		return nil, setKeyVals(t.LocalSettings[id], pos)
+	case "open-port":
+		t.Ports[args[0]] = true
+		return nil, nil
+	case "close-port":
+		delete(t.Ports, args[0])
+		return nil, nil
+	case "opened-ports":
+		ports := []string{}
+		for port := range t.Ports {
+			ports = append(ports, port)
+		}
+		sort.Strings(ports)
+		return toJSON(ports)
+	case "is-leader", "leader-get", "leader-set":
+		return RunLeaderTool(t.Leader, t.LeaderSettings, cmd, args...)
+	case "status-set":
+		t.Status, t.StatusMessage = Status(args[0]), args[1]
+		return nil, nil
+	case "add-metric":
+		return nil, setKeyVals(t.Metrics, args)
+	case "juju-reboot":
+		return nil, nil
+	case "goal-state":
+		if r.goalState != nil {
+			return toJSON(r.goalState)
+		}
+	}
+	return nil, errgo.WithCausef(nil, ErrUnimplemented, "bad request: unknown command %q", cmd)
+}
+
+// Close implements ToolRunner.Close.
+func (r *testRunner) Close() error {
+	return nil
+}
+
+// RunLeaderTool implements the leadership hook tools, is-leader,
+// leader-get and leader-set, in memory, for test runners other than
+// TestContext. The leader parameter holds whether the local unit is
+// the leader and settings holds the leader settings, which are
+// changed by leader-set; as with Juju, leader-set fails if the unit
+// is not the leader, and setting an empty value removes the key.
+func RunLeaderTool(leader bool, settings map[string]string, cmd string, args ...string) ([]byte, error) {
+	pos := positionalArgs(args)
+	switch cmd {
+	case "is-leader":
+		return toJSON(leader)
+	case "leader-get":
+		if len(pos) == 0 {
+			return toJSON(settings)
+		}
+		return toJSON(settings[pos[0]])
+	case "leader-set":
+		if !leader {
+			return nil, errgo.New("cannot write leadership settings: cannot write settings: not the leader")
+		}
+		return nil, setKeyVals(settings, pos)
+	}
+	return nil, errgo.WithCausef(nil, ErrUnimplemented, "bad request: unknown command %q", cmd)
+}
+
+// positionalArgs returns the arguments after "--",
+// or nil if there is no "--".
+func positionalArgs(args []string) []string {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[i+1:]
+		}
+	}
+	return nil
+}
+
+// flagValue returns the argument following the given flag,
+// or the empty string if it is not found.
+func flagValue(args []string, flag string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "--" {
+			break
+		}
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// setKeyVals sets the key=value pairs in keyvals in m.
+// An empty value removes the key.
+func setKeyVals(m map[string]string, keyvals []string) error {
+	for _, kv := range keyvals {
+		i := strings.Index(kv, "=")
+		if i == -1 {
+			return errgo.Newf("expected key=value, got %q", kv)
+		}
+		if key, val := kv[0:i], kv[i+1:]; val == "" {
+			delete(m, key)
+		} else {
+			m[key] = val
+		}
+	}
+	return nil
+}
+
+func toJSON(val interface{}) ([]byte, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return data, nil
+}
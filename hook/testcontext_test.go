@@ -0,0 +1,189 @@
+package hook_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type testContextSuite struct{}
+
+var _ = gc.Suite(&testContextSuite{})
+
+func (*testContextSuite) TestDefaults(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	c.Assert(t.HookName, gc.Equals, "install")
+	c.Assert(t.Unit, gc.Equals, hook.UnitId("someunit/0"))
+	c.Assert(t.IsRelationHook(), gc.Equals, false)
+	c.Assert(t.Close(), gc.IsNil)
+}
+
+func (*testContextSuite) TestConfigAndAddresses(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{
+		HookName: "config-changed",
+		Config: map[string]interface{}{
+			"port": 8080,
+			"name": "foo",
+		},
+		PrivateAddress: "10.0.0.1",
+	})
+	port, err := t.GetConfigInt("port")
+	c.Assert(err, gc.IsNil)
+	c.Assert(port, gc.Equals, 8080)
+	name, err := t.GetConfigString("name")
+	c.Assert(err, gc.IsNil)
+	c.Assert(name, gc.Equals, "foo")
+	var all map[string]interface{}
+	err = t.GetAllConfig(&all)
+	c.Assert(err, gc.IsNil)
+	c.Assert(all, jc.DeepEquals, map[string]interface{}{
+		"port": 8080.0,
+		"name": "foo",
+	})
+	addr, err := t.PrivateAddress()
+	c.Assert(err, gc.IsNil)
+	c.Assert(addr, gc.Equals, "10.0.0.1")
+	// Reading does not count as an operation.
+	c.Assert(t.Ops, gc.HasLen, 0)
+}
+
+func (*testContextSuite) TestChangedKeys(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{
+		HookName: "config-changed",
+		Config: map[string]interface{}{
+			"port": 8080,
+			"name": "foo",
+		},
+		PreviousConfig: map[string]interface{}{
+			"port":  80.0,
+			"name":  "foo",
+			"title": "bar",
+		},
+	})
+	changed, err := t.ChangedKeys()
+	c.Assert(err, gc.IsNil)
+	c.Assert(changed, jc.DeepEquals, []string{"port", "title"})
+	c.Assert(t.PreviousConfig()["port"], gc.Equals, 80.0)
+}
+
+func (*testContextSuite) TestRelationChanges(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{
+		HookName:   "db-relation-changed",
+		RelationId: "db:0",
+		RemoteUnit: "mysql/0",
+		RelationIds: map[string][]hook.RelationId{
+			"db": {"db:0"},
+		},
+		Relations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"db:0": {"mysql/0": {"host": "10.0.0.2"}},
+		},
+		PreviousRelations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"db:0": {"mysql/0": {"host": "10.0.0.1"}},
+		},
+	})
+	c.Assert(t.RelationChanges(), jc.DeepEquals, []hook.SettingChange{
+		{Key: "host", Old: "10.0.0.1", New: "10.0.0.2"},
+	})
+}
+
+func (*testContextSuite) TestRelations(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{
+		HookName:   "db-relation-changed",
+		RelationId: "db:1",
+		RemoteUnit: "mysql/0",
+		RelationIds: map[string][]hook.RelationId{
+			"db": {"db:1"},
+		},
+		Relations: map[hook.RelationId]map[hook.UnitId]map[string]string{
+			"db:1": {
+				"mysql/0": {"host": "10.0.0.2"},
+			},
+		},
+	})
+	c.Assert(t.RelationName, gc.Equals, "db")
+	c.Assert(t.Relation(), jc.DeepEquals, map[string]string{"host": "10.0.0.2"})
+	units, err := hook.CtxtRelationUnits(t.Context, "db:1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(units, jc.DeepEquals, []hook.UnitId{"mysql/0"})
+
+	err = t.SetRelation("user", "admin", "password", "secret")
+	c.Assert(err, gc.IsNil)
+	err = t.SetRelation("password", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(t.LocalSettings, jc.DeepEquals, map[hook.RelationId]map[string]string{
+		"db:1": {"user": "admin"},
+	})
+	c.Assert(t.Ops, jc.DeepEquals, [][]string{
+		{"relation-set", "-r", "db:1", "--", "user=admin", "password=secret"},
+		{"relation-set", "-r", "db:1", "--", "password="},
+	})
+}
+
+func (*testContextSuite) TestPorts(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{
+		OpenedPorts: []string{"22/tcp"},
+	})
+	err := t.OpenPort("tcp", 80)
+	c.Assert(err, gc.IsNil)
+	err = t.ClosePort("tcp", 22)
+	c.Assert(err, gc.IsNil)
+	c.Assert(t.Ports, jc.DeepEquals, map[string]bool{"80/tcp": true})
+	ports, err := t.OpenedPorts()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ports, jc.DeepEquals, []hook.PortRange{{FromPort: 80, ToPort: 80, Protocol: "tcp"}})
+	c.Assert(t.Ops, jc.DeepEquals, [][]string{
+		{"open-port", "80/tcp"},
+		{"close-port", "22/tcp"},
+	})
+}
+
+func (*testContextSuite) TestLeadership(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{
+		LeaderSettings: map[string]string{"password": "secret"},
+	})
+	leader, err := t.IsLeader()
+	c.Assert(err, gc.IsNil)
+	c.Assert(leader, gc.Equals, false)
+	password, err := t.GetLeaderSetting("password")
+	c.Assert(err, gc.IsNil)
+	c.Assert(password, gc.Equals, "secret")
+	missing, err := t.GetLeaderSetting("missing")
+	c.Assert(err, gc.IsNil)
+	c.Assert(missing, gc.Equals, "")
+	err = t.SetLeaderSettings("password", "other")
+	c.Assert(err, gc.ErrorMatches, ".*not the leader")
+
+	t.Leader = true
+	err = t.SetLeaderSettings("password", "other", "user", "admin")
+	c.Assert(err, gc.IsNil)
+	settings, err := t.GetLeaderSettings()
+	c.Assert(err, gc.IsNil)
+	c.Assert(settings, jc.DeepEquals, map[string]string{
+		"password": "other",
+		"user":     "admin",
+	})
+	err = t.SetLeaderSettings("odd")
+	c.Assert(err, gc.ErrorMatches, "invalid key/value count")
+}
+
+func (*testContextSuite) TestStatusLogsAndMetrics(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	err := t.SetStatus(hook.StatusBlocked, "need db")
+	c.Assert(err, gc.IsNil)
+	c.Assert(t.Status, gc.Equals, hook.StatusBlocked)
+	c.Assert(t.StatusMessage, gc.Equals, "need db")
+	err = t.AddMetric("users", "3")
+	c.Assert(err, gc.IsNil)
+	c.Assert(t.Metrics, jc.DeepEquals, map[string]string{"users": "3"})
+	t.Logf("hello %d", 1)
+	t.Errorf("bad")
+	c.Assert(t.Logs, jc.DeepEquals, []string{"hello 1", "ERROR: bad"})
+}
+
+func (*testContextSuite) TestUnknownTool(c *gc.C) {
+	t := hook.NewTestContext(hook.TestContextParams{})
+	_, err := t.GetResource("data")
+	c.Assert(errgo.Cause(err), gc.Equals, hook.ErrUnimplemented)
+}
@@ -0,0 +1,6 @@
+package tls
+
+var (
+	Now                = &now
+	GenerateSelfSigned = generateSelfSigned
+)
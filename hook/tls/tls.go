@@ -0,0 +1,398 @@
+// The tls package manages a TLS certificate for a charm's service.
+//
+// By default, a self-signed certificate is generated for the unit's
+// addresses when the charm is installed, and renewed by the
+// update-status hook before it expires. If a relation name is given,
+// the charm also requests a certificate from a CA charm through a
+// relation with interface "tls-certificates", and uses that instead
+// when it is provided.
+//
+// The certificate and key are kept in the charm's persistent state,
+// which is only readable by root, and written to files in a
+// directory chosen by the charm, the key being readable only
+// by its owner.
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/template"
+)
+
+const (
+	defaultValidity    = 365 * 24 * time.Hour
+	defaultRenewBefore = 30 * 24 * time.Hour
+)
+
+// now returns the current time. It is defined as a variable
+// so that it can be changed for testing.
+var now = time.Now
+
+// Params holds the parameters for Manager.Register.
+type Params struct {
+	// Dir holds the directory that the certificate files are
+	// written to: cert.pem, key.pem and, when the certificate was
+	// issued by a CA, ca.pem.
+	Dir string
+
+	// Owner and Group hold the names of the user and group that
+	// should own the files. If either is empty, the respective
+	// ownership will be that of the hook process.
+	Owner string
+	Group string
+
+	// Validity holds how long a self-signed certificate is
+	// valid for. If it is zero, one year is used.
+	Validity time.Duration
+
+	// RenewBefore holds how long before a self-signed certificate
+	// expires it is renewed. If it is zero, 30 days is used.
+	RenewBefore time.Duration
+
+	// RelationName, if non-empty, holds the name of a
+	// tls-certificates relation to request a certificate
+	// through.
+	RelationName string
+
+	// Changed, if not nil, is called whenever the
+	// certificate changes.
+	Changed func(*Certificate) error
+}
+
+// Certificate holds a certificate and its key.
+type Certificate struct {
+	// CertPEM and KeyPEM hold the certificate and
+	// its private key in PEM format.
+	CertPEM string
+	KeyPEM  string
+
+	// CAPEM holds the certificate of the CA that issued
+	// the certificate, or is empty if it is self-signed.
+	CAPEM string
+
+	// Hosts holds the host names and addresses that
+	// the certificate is valid for.
+	Hosts []string
+
+	// Expiry holds when the certificate expires.
+	Expiry time.Time
+}
+
+// SelfSigned reports whether the certificate is self-signed.
+func (cert *Certificate) SelfSigned() bool {
+	return cert.CAPEM == ""
+}
+
+// Manager manages the certificate of a charm.
+type Manager struct {
+	ctxt  *hook.Context
+	p     Params
+	state managerState
+
+	// relationName holds the name of the tls-certificates
+	// relation as registered, including any namespace
+	// prefix.
+	relationName string
+}
+
+type managerState struct {
+	// Cert holds the current certificate.
+	Cert *Certificate
+}
+
+// Register registers the manager with the given registry.
+func (m *Manager) Register(r *hook.Registry, p Params) {
+	if p.Validity == 0 {
+		p.Validity = defaultValidity
+	}
+	if p.RenewBefore == 0 {
+		p.RenewBefore = defaultRenewBefore
+	}
+	m.p = p
+	for _, h := range []string{"install", "config-changed", "upgrade-charm", "update-status"} {
+		r.RegisterHook(h, m.refresh)
+	}
+	if p.RelationName != "" {
+		m.relationName = r.RelationName(p.RelationName)
+		r.RegisterRelation(charm.Relation{
+			Name:      p.RelationName,
+			Interface: "tls-certificates",
+			Role:      charm.RoleRequirer,
+			Optional:  true,
+		})
+		r.RegisterHook(p.RelationName+"-relation-joined", m.request)
+		r.RegisterHook(p.RelationName+"-relation-changed", m.refresh)
+		r.RegisterHook(p.RelationName+"-relation-broken", m.refresh)
+	}
+	r.RegisterContext(m.setContext, &m.state)
+}
+
+func (m *Manager) setContext(ctxt *hook.Context) error {
+	m.ctxt = ctxt
+	return nil
+}
+
+// Certificate returns the current certificate, or nil
+// if there is none yet.
+func (m *Manager) Certificate() *Certificate {
+	return m.state.Cert
+}
+
+// CertFile returns the path of the certificate file.
+func (m *Manager) CertFile() string {
+	return filepath.Join(m.p.Dir, "cert.pem")
+}
+
+// KeyFile returns the path of the private key file.
+func (m *Manager) KeyFile() string {
+	return filepath.Join(m.p.Dir, "key.pem")
+}
+
+// request requests a certificate for the unit's addresses
+// on the tls-certificates relation.
+func (m *Manager) request() error {
+	hosts, err := m.hosts()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	sans, err := json.Marshal(hosts)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	commonName := m.ctxt.ServiceName()
+	if len(hosts) > 0 {
+		commonName = hosts[0]
+	}
+	if err := m.ctxt.SetRelation(
+		"common_name", commonName,
+		"sans", string(sans),
+		"certificate_name", unitKey(m.ctxt.Unit),
+	); err != nil {
+		return errgo.Mask(err)
+	}
+	return m.refresh()
+}
+
+// refresh makes sure that the current certificate is
+// valid, up to date and written to its files.
+func (m *Manager) refresh() error {
+	cert, err := m.issuedCert()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if cert == nil {
+		cert, err = m.selfSignedCert()
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := m.write(cert); err != nil {
+		return errgo.Notef(err, "cannot write certificate")
+	}
+	old := m.state.Cert
+	m.state.Cert = cert
+	if old != nil && old.CertPEM == cert.CertPEM {
+		return nil
+	}
+	m.ctxt.Logf("new certificate for %s, expiring %s", strings.Join(cert.Hosts, ", "), cert.Expiry.Format(time.RFC3339))
+	if m.p.Changed != nil {
+		if err := m.p.Changed(cert); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// issuedCert returns the certificate issued to the unit
+// on the tls-certificates relation, or nil if there is none.
+func (m *Manager) issuedCert() (*Certificate, error) {
+	if m.relationName == "" {
+		return nil, nil
+	}
+	key := unitKey(m.ctxt.Unit)
+	for _, id := range m.ctxt.RelationIds[m.relationName] {
+		for _, settings := range m.ctxt.Relations[id] {
+			certPEM, keyPEM := settings[key+".server.cert"], settings[key+".server.key"]
+			if certPEM == "" || keyPEM == "" {
+				continue
+			}
+			x509Cert, err := parseCert(certPEM)
+			if err != nil {
+				return nil, errgo.Notef(err, "bad certificate from relation %s", id)
+			}
+			return &Certificate{
+				CertPEM: certPEM,
+				KeyPEM:  keyPEM,
+				CAPEM:   settings["ca"],
+				Hosts:   certHosts(x509Cert),
+				Expiry:  x509Cert.NotAfter,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// selfSignedCert returns the current self-signed certificate,
+// generating a new one if it is missing, expiring soon or does
+// not cover the unit's addresses.
+func (m *Manager) selfSignedCert() (*Certificate, error) {
+	hosts, err := m.hosts()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if cert := m.state.Cert; cert != nil && cert.SelfSigned() &&
+		now().Add(m.p.RenewBefore).Before(cert.Expiry) &&
+		equalStrings(cert.Hosts, hosts) {
+		return cert, nil
+	}
+	cert, err := generateSelfSigned(m.ctxt.ServiceName(), hosts, m.p.Validity)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot generate certificate")
+	}
+	return cert, nil
+}
+
+// write writes the certificate files.
+func (m *Manager) write(cert *Certificate) error {
+	if err := os.MkdirAll(m.p.Dir, 0755); err != nil {
+		return errgo.Mask(err)
+	}
+	files := []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{"cert.pem", cert.CertPEM, 0644},
+		{"key.pem", cert.KeyPEM, 0600},
+		{"ca.pem", cert.CAPEM, 0644},
+	}
+	for _, f := range files {
+		if f.data == "" {
+			continue
+		}
+		file := template.File{
+			Path:  filepath.Join(m.p.Dir, f.name),
+			Perm:  f.perm,
+			Owner: m.p.Owner,
+			Group: m.p.Group,
+		}
+		if _, err := file.Write([]byte(f.data)); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// hosts returns the addresses of the local unit.
+func (m *Manager) hosts() ([]string, error) {
+	var hosts []string
+	for _, get := range []func() (string, error){m.ctxt.PublicAddress, m.ctxt.PrivateAddress} {
+		addr, err := get()
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		if addr != "" && (len(hosts) == 0 || hosts[0] != addr) {
+			hosts = append(hosts, addr)
+		}
+	}
+	return hosts, nil
+}
+
+// generateSelfSigned generates a self-signed certificate
+// with the given common name, valid for the given hosts
+// for the given duration.
+func generateSelfSigned(commonName string, hosts []string, validity time.Duration) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	// Certificates record times to the second.
+	notBefore := now().Add(-5 * time.Minute).Truncate(time.Second)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validity),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return &Certificate{
+		CertPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		KeyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		Hosts:   hosts,
+		Expiry:  tmpl.NotAfter,
+	}, nil
+}
+
+func parseCert(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errgo.New("no certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// certHosts returns the host names and addresses
+// that the given certificate is valid for.
+func certHosts(cert *x509.Certificate) []string {
+	hosts := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
+
+// unitKey returns the name used for the given unit
+// in tls-certificates relation settings.
+func unitKey(unit hook.UnitId) string {
+	return strings.Replace(string(unit), "/", "_", -1)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package tls_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/gocharm/hook"
+	"github.com/juju/gocharm/hook/hooktest"
+	"github.com/juju/gocharm/hook/tls"
+)
+
+func TestPackage(t *testing.T) {
+	gc.TestingT(t)
+}
+
+var _ = gc.Suite(&tlsSuite{})
+
+type tlsSuite struct {
+	oldNow func() time.Time
+}
+
+func (s *tlsSuite) SetUpTest(c *gc.C) {
+	s.oldNow = *tls.Now
+}
+
+func (s *tlsSuite) TearDownTest(c *gc.C) {
+	*tls.Now = s.oldNow
+}
+
+type tlsCharm struct {
+	m         *tls.Manager
+	namespace string
+	changed   []*tls.Certificate
+}
+
+func newRunner(c *gc.C, ch *tlsCharm, p tls.Params) *hooktest.Runner {
+	return &hooktest.Runner{
+		RegisterHooks: func(r *hook.Registry) {
+			ch.m = new(tls.Manager)
+			p.Changed = func(cert *tls.Certificate) error {
+				ch.changed = append(ch.changed, cert)
+				return nil
+			}
+			if ch.namespace != "" {
+				r = r.Namespace(ch.namespace)
+			}
+			ch.m.Register(r.Clone("tls"), p)
+		},
+		PublicAddress:  "example.com",
+		PrivateAddress: "10.0.0.1",
+		Logger:         c,
+	}
+}
+
+func (s *tlsSuite) TestSelfSigned(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "tls")
+	var ch tlsCharm
+	runner := newRunner(c, &ch, tls.Params{
+		Dir: dir,
+	})
+	err := runner.RunHook("install", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.changed, gc.HasLen, 1)
+	cert := ch.m.Certificate()
+	c.Assert(cert.SelfSigned(), jc.IsTrue)
+	c.Assert(cert.Hosts, jc.DeepEquals, []string{"example.com", "10.0.0.1"})
+
+	data, err := ioutil.ReadFile(ch.m.CertFile())
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, cert.CertPEM)
+	info, err := os.Stat(ch.m.KeyFile())
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+	_, err = os.Stat(filepath.Join(dir, "ca.pem"))
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+
+	// The certificate is kept while it is valid.
+	err = runner.RunHook("update-status", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.changed, gc.HasLen, 1)
+	c.Assert(ch.m.Certificate().CertPEM, gc.Equals, cert.CertPEM)
+
+	// It is renewed shortly before it expires.
+	*tls.Now = func() time.Time {
+		return cert.Expiry.Add(-24 * time.Hour)
+	}
+	err = runner.RunHook("update-status", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.changed, gc.HasLen, 2)
+	c.Assert(ch.m.Certificate().Expiry.After(cert.Expiry), jc.IsTrue)
+
+	// It is regenerated when an address changes.
+	runner.PrivateAddress = "10.0.0.2"
+	err = runner.RunHook("config-changed", "", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.changed, gc.HasLen, 3)
+	c.Assert(ch.m.Certificate().Hosts, jc.DeepEquals, []string{"example.com", "10.0.0.2"})
+}
+
+func (s *tlsSuite) TestRelation(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "tls")
+	var ch tlsCharm
+	runner := newRunner(c, &ch, tls.Params{
+		Dir:          dir,
+		RelationName: "certificates",
+	})
+	runner.RelationIds = map[string][]hook.RelationId{
+		"certificates": {"certificates:0"},
+	}
+	runner.Relations = map[hook.RelationId]map[hook.UnitId]map[string]string{
+		"certificates:0": {
+			"easyrsa/0": {},
+		},
+	}
+	err := runner.RunHook("certificates-relation-joined", "certificates:0", "easyrsa/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(runner.LocalSettings["certificates:0"], jc.DeepEquals, map[string]string{
+		"common_name":      "example.com",
+		"sans":             `["example.com","10.0.0.1"]`,
+		"certificate_name": "someunit_0",
+	})
+	// Until the CA responds, a self-signed certificate is used.
+	c.Assert(ch.m.Certificate().SelfSigned(), jc.IsTrue)
+
+	issued, err := tls.GenerateSelfSigned("example.com", []string{"example.com"}, time.Hour)
+	c.Assert(err, gc.IsNil)
+	runner.Relations["certificates:0"]["easyrsa/0"] = map[string]string{
+		"ca":                     "ca certificate",
+		"someunit_0.server.cert": issued.CertPEM,
+		"someunit_0.server.key":  issued.KeyPEM,
+	}
+	err = runner.RunHook("certificates-relation-changed", "certificates:0", "easyrsa/0")
+	c.Assert(err, gc.IsNil)
+	cert := ch.m.Certificate()
+	c.Assert(cert.SelfSigned(), jc.IsFalse)
+	c.Assert(cert.CertPEM, gc.Equals, issued.CertPEM)
+	c.Assert(cert.Hosts, jc.DeepEquals, []string{"example.com"})
+	c.Assert(cert.Expiry.Equal(issued.Expiry), jc.IsTrue)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "ca.pem"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "ca certificate")
+	c.Assert(ch.changed, gc.HasLen, 2)
+}
+
+func (s *tlsSuite) TestRelationNamespace(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "tls")
+	ch := tlsCharm{
+		namespace: "admin",
+	}
+	runner := newRunner(c, &ch, tls.Params{
+		Dir:          dir,
+		RelationName: "certificates",
+	})
+	issued, err := tls.GenerateSelfSigned("example.com", []string{"example.com"}, time.Hour)
+	c.Assert(err, gc.IsNil)
+	runner.RelationIds = map[string][]hook.RelationId{
+		"admin-certificates": {"admin-certificates:0"},
+	}
+	runner.Relations = map[hook.RelationId]map[hook.UnitId]map[string]string{
+		"admin-certificates:0": {
+			"easyrsa/0": {
+				"ca":                     "ca certificate",
+				"someunit_0.server.cert": issued.CertPEM,
+				"someunit_0.server.key":  issued.KeyPEM,
+			},
+		},
+	}
+	err = runner.RunHook("admin-certificates-relation-changed", "admin-certificates:0", "easyrsa/0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.m.Certificate().SelfSigned(), jc.IsFalse)
+	c.Assert(ch.m.Certificate().CertPEM, gc.Equals, issued.CertPEM)
+}
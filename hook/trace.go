@@ -0,0 +1,186 @@
+package hook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5"
+)
+
+const (
+	// TraceConfigOption holds the name of the configuration
+	// option registered by RegisterTracing.
+	TraceConfigOption = "gocharm-trace"
+
+	// envTrace holds the environment variable that
+	// enables tracing when it is non-empty.
+	envTrace = "GOCHARM_TRACE"
+
+	// maxTraceFiles holds the number of trace files
+	// that are kept for a unit; older ones are removed.
+	maxTraceFiles = 50
+)
+
+// RegisterTracing registers a boolean configuration option, named
+// by TraceConfigOption, that enables tracing of hook tool calls when
+// set. Tracing can also be enabled without changing the charm's
+// configuration by setting $GOCHARM_TRACE to a non-empty value in
+// the hook's environment (see RegisterHookStub).
+//
+// When tracing is enabled, Main records every hook tool call made
+// while running the hook, with its arguments, duration and result,
+// in a new file in the unit's trace directory (see
+// Context.TraceDir). A summary is logged through juju-log when the hook
+// completes.
+func (r *Registry) RegisterTracing() {
+	r.RegisterConfig(TraceConfigOption, charm.Option{
+		Type:        "boolean",
+		Description: "Record a trace of the hook tool calls made by each hook.",
+		Default:     false,
+	})
+}
+
+// TraceDir returns the directory that trace files
+// for the unit are written to.
+func (ctxt *Context) TraceDir() string {
+	return filepath.Join(ctxt.unitStateDir(), ".traces")
+}
+
+// tracingEnabled reports whether hook tool calls
+// should be traced.
+func tracingEnabled(r *Registry, ctxt *Context) bool {
+	if os.Getenv(envTrace) != "" {
+		return true
+	}
+	if _, ok := r.config[TraceConfigOption]; !ok {
+		return false
+	}
+	var enabled bool
+	if err := ctxt.GetConfig(TraceConfigOption, &enabled); err != nil {
+		ctxt.Logf("cannot determine whether tracing is enabled: %v", err)
+		return false
+	}
+	return enabled
+}
+
+// startTrace arranges for all hook tool calls made through
+// ctxt to be recorded in a new trace file. It returns a function
+// that should be called when the hook has completed, which logs a
+// summary of the trace and restores the original runner.
+func startTrace(ctxt *Context) (finish func(hookErr error), err error) {
+	dir := ctxt.TraceDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s.trace", start.UTC().Format("20060102-150405.000000000"), ctxt.HookName)
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	pruneTraces(dir, maxTraceFiles)
+	fmt.Fprintf(f, "hook %s unit %s started %s\n", ctxt.HookName, ctxt.Unit, start.UTC().Format(time.RFC3339Nano))
+	runner := ctxt.Runner
+	tracer := &tracingToolRunner{
+		runner: runner,
+		f:      f,
+	}
+	ctxt.Runner = tracer
+	return func(hookErr error) {
+		ctxt.Runner = runner
+		total := time.Since(start)
+		result := "ok"
+		if hookErr != nil {
+			result = "error: " + hookErr.Error()
+		}
+		fmt.Fprintf(f, "hook %s finished after %v: %s\n", ctxt.HookName, total, result)
+		f.Close()
+		ctxt.Logf("trace: %s; written to %s", tracer.summary(total), f.Name())
+	}, nil
+}
+
+// pruneTraces removes all but the newest max trace
+// files from dir. Trace file names start with the time
+// they were created, so they sort in age order.
+func pruneTraces(dir string, max int) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".trace") {
+			names = append(names, info.Name())
+		}
+	}
+	if len(names) <= max {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[0 : len(names)-max] {
+		os.Remove(filepath.Join(dir, name))
+	}
+}
+
+// tracingToolRunner is a ToolRunner that records
+// each command run in a trace file.
+type tracingToolRunner struct {
+	runner ToolRunner
+
+	mu       sync.Mutex
+	f        *os.File
+	calls    int
+	failures int
+	elapsed  time.Duration
+	slowest  string
+	slowTime time.Duration
+}
+
+func (r *tracingToolRunner) Run(cmd string, args ...string) ([]byte, error) {
+	start := time.Now()
+	out, err := r.runner.Run(cmd, args...)
+	d := time.Since(start)
+	call := cmd
+	for _, arg := range args {
+		call += " " + fmt.Sprintf("%q", arg)
+	}
+	result := "ok"
+	if err != nil {
+		result = "error: " + err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if err != nil {
+		r.failures++
+	}
+	r.elapsed += d
+	if d >= r.slowTime {
+		r.slowest, r.slowTime = cmd, d
+	}
+	fmt.Fprintf(r.f, "%s %v %s: %s\n", start.UTC().Format("15:04:05.000"), d, call, result)
+	return out, errgo.Mask(err, errgo.Any)
+}
+
+func (r *tracingToolRunner) Close() error {
+	return r.runner.Close()
+}
+
+// summary returns a summary of the calls recorded so far
+// in a hook that took the given total time.
+func (r *tracingToolRunner) summary(total time.Duration) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := fmt.Sprintf("%d hook tool calls (%d failed) took %v of %v", r.calls, r.failures, r.elapsed, total)
+	if r.calls > 0 {
+		s += fmt.Sprintf("; slowest %s took %v", r.slowest, r.slowTime)
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type traceSuite struct {
+	savedHookStateDir string
+	savedTrace        string
+}
+
+var _ = gc.Suite(&traceSuite{})
+
+func (s *traceSuite) SetUpTest(c *gc.C) {
+	s.savedHookStateDir = *hook.HookStateDir
+	*hook.HookStateDir = c.MkDir()
+	s.savedTrace = os.Getenv("GOCHARM_TRACE")
+	os.Setenv("GOCHARM_TRACE", "")
+}
+
+func (s *traceSuite) TearDownTest(c *gc.C) {
+	*hook.HookStateDir = s.savedHookStateDir
+	os.Setenv("GOCHARM_TRACE", s.savedTrace)
+}
+
+// runTracedHook runs an install hook that makes a hook tool
+// call and then fails, and returns the error from hook.Main.
+func runTracedHook(c *gc.C, r *hook.Registry, runner *recordingRunner) error {
+	var ctxt *hook.Context
+	r.RegisterContext(func(c *hook.Context) error {
+		ctxt = c
+		return nil
+	}, nil)
+	r.RegisterHook("install", func() error {
+		if _, err := ctxt.Runner.Run("unit-get", "private-address"); err != nil {
+			return err
+		}
+		return errgo.New("install failed")
+	})
+	return hook.Main(r, &hook.Context{
+		UUID:     "fff",
+		Unit:     "foo/0",
+		HookName: "install",
+		Runner:   runner,
+	}, memState{})
+}
+
+func (s *traceSuite) TestTraceFromEnvironment(c *gc.C) {
+	os.Setenv("GOCHARM_TRACE", "1")
+	runner := &recordingRunner{}
+	err := runTracedHook(c, hook.NewRegistry(), runner)
+	c.Assert(err, gc.ErrorMatches, `hook install \(registry root\): install failed`)
+
+	dir := (&hook.Context{UUID: "fff", Unit: "foo/0"}).TraceDir()
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+	c.Assert(infos[0].Name(), gc.Matches, `[0-9]{8}-[0-9.]+-install\.trace`)
+	data, err := ioutil.ReadFile(filepath.Join(dir, infos[0].Name()))
+	c.Assert(err, gc.IsNil)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	c.Assert(lines, gc.HasLen, 3)
+	c.Check(lines[0], gc.Matches, `hook install unit foo/0 started .*`)
+	c.Check(lines[1], gc.Matches, `[0-9:.]+ [^ ]+ unit-get "private-address": ok`)
+	c.Check(lines[2], gc.Matches, `hook install finished after [^ ]+: error: hook install \(registry root\): install failed`)
+
+	// The summary is logged at the end of the hook.
+	var summary string
+	for _, rec := range runner.record {
+		if rec[0] == "juju-log" && strings.HasPrefix(rec[len(rec)-1], "trace: ") {
+			summary = rec[len(rec)-1]
+		}
+	}
+	c.Assert(summary, gc.Matches, `trace: 1 hook tool calls \(0 failed\) took [^ ]+ of [^ ]+; slowest unit-get took [^ ]+; written to `+dir+`/.*\.trace`)
+}
+
+func (s *traceSuite) TestTraceFromConfig(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterTracing()
+	c.Assert(r.RegisteredConfig()[hook.TraceConfigOption].Type, gc.Equals, "boolean")
+
+	runner := &recordingRunner{
+		output: map[string]string{
+			"config-get": "true",
+		},
+	}
+	runTracedHook(c, r, runner)
+	dir := (&hook.Context{UUID: "fff", Unit: "foo/0"}).TraceDir()
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+}
+
+func (s *traceSuite) TestNoTrace(c *gc.C) {
+	r := hook.NewRegistry()
+	r.RegisterTracing()
+	runner := &recordingRunner{
+		output: map[string]string{
+			"config-get": "false",
+		},
+	}
+	runTracedHook(c, r, runner)
+	dir := (&hook.Context{UUID: "fff", Unit: "foo/0"}).TraceDir()
+	_, err := os.Stat(dir)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *traceSuite) TestPruneTraces(c *gc.C) {
+	dir := c.MkDir()
+	for _, name := range []string{"1-a.trace", "2-b.trace", "3-c.trace", "other"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0666)
+		c.Assert(err, gc.IsNil)
+	}
+	hook.PruneTraces(dir, 2)
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	c.Assert(names, jc.DeepEquals, []string{"2-b.trace", "3-c.trace", "other"})
+}
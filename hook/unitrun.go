@@ -0,0 +1,106 @@
+package hook
+
+import (
+	osexec "os/exec"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// jujuRunCommands holds the names of the programs that Juju provides
+// for running commands on a unit, in order of preference: juju-exec
+// replaces juju-run in later versions of Juju.
+var jujuRunCommands = []string{"juju-exec", "juju-run"}
+
+// lookPath is used to find the programs in jujuRunCommands.
+var lookPath = osexec.LookPath
+
+// UnitCommand holds commands to be run with Context.RunOnUnit.
+type UnitCommand struct {
+	// Commands holds the commands to run. Unlike Command,
+	// they are interpreted by the shell on the unit.
+	Commands string
+
+	// Unit holds the unit whose hook context the commands
+	// run in. It must be on the same machine as the local
+	// unit (for example its principal or one of its
+	// subordinates). It is ignored when NoContext is true.
+	Unit UnitId
+
+	// NoContext specifies that the commands run outside any
+	// hook context, so hook tools are not available to them.
+	NoContext bool
+
+	// RelationId and RemoteUnit, if set, specify the
+	// relation and remote unit of the hook context that
+	// the commands run in.
+	RelationId RelationId
+	RemoteUnit UnitId
+
+	// Timeout holds the longest that the commands may run
+	// for, as for Command.Timeout.
+	Timeout time.Duration
+}
+
+// RunOnUnit runs commands with juju-exec (or juju-run with versions
+// of Juju before 2.8), either in the hook context of another unit on
+// the same machine or, if cmd.NoContext is set, outside any hook
+// context, and returns their output. As with Context.Run, the returned
+// error includes the combined output if the commands fail, and will
+// have an ErrCommandTimeout cause if they are killed at their timeout
+// or the hook's deadline.
+//
+// A unit runs only one hook at a time, so the commands cannot run
+// in a hook context of the local unit: Juju would wait for the current
+// hook to finish first. RunOnUnit returns an error in that case.
+//
+// If neither juju-exec nor juju-run can be found, the returned
+// error will have an ErrUnimplemented cause.
+func (ctxt *Context) RunOnUnit(cmd UnitCommand) (*CommandOutput, error) {
+	if cmd.Commands == "" {
+		return nil, errgo.New("no commands to run")
+	}
+	var args []string
+	if cmd.NoContext {
+		args = append(args, "--no-context")
+	} else {
+		if cmd.Unit == "" {
+			return nil, errgo.New("no unit specified")
+		}
+		if cmd.Unit == ctxt.Unit {
+			return nil, errgo.Newf("cannot run commands in a hook context of the local unit %s while a hook is running", cmd.Unit)
+		}
+		if cmd.RelationId != "" {
+			args = append(args, "--relation", string(cmd.RelationId))
+		}
+		if cmd.RemoteUnit != "" {
+			args = append(args, "--remote-unit", string(cmd.RemoteUnit))
+		}
+		args = append(args, string(cmd.Unit))
+	}
+	args = append(args, cmd.Commands)
+	path, err := jujuRunPath()
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(ErrUnimplemented))
+	}
+	out, err := ctxt.Run(Command{
+		Path:    path,
+		Args:    args,
+		Timeout: cmd.Timeout,
+	})
+	if err != nil {
+		return out, errgo.Mask(err, errgo.Is(ErrCommandTimeout))
+	}
+	return out, nil
+}
+
+// jujuRunPath returns the path of the first of jujuRunCommands
+// that can be found.
+func jujuRunPath() (string, error) {
+	for _, name := range jujuRunCommands {
+		if path, err := lookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errgo.WithCausef(nil, ErrUnimplemented, "cannot find juju-exec or juju-run")
+}
@@ -0,0 +1,130 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type unitRunSuite struct{}
+
+var _ = gc.Suite(&unitRunSuite{})
+
+// fakeJujuRun installs a juju-run program that runs the given
+// script, and returns a function that restores the original
+// lookPath. Because there is no juju-exec, RunOnUnit falls back
+// to juju-run.
+func fakeJujuRun(c *gc.C, script string) func() {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "juju-run"), []byte("#!/bin/sh\n"+script), 0755)
+	c.Assert(err, gc.IsNil)
+	old := *hook.LookPath
+	*hook.LookPath = func(name string) (string, error) {
+		path := filepath.Join(dir, name)
+		if _, err := exec.LookPath(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	return func() {
+		*hook.LookPath = old
+	}
+}
+
+var runOnUnitTests = []struct {
+	about     string
+	cmd       hook.UnitCommand
+	expectOut string
+	expectErr string
+}{{
+	about: "other unit",
+	cmd: hook.UnitCommand{
+		Unit:     "principal/0",
+		Commands: "echo hello",
+	},
+	expectOut: "principal/0\necho hello\n",
+}, {
+	about: "relation context",
+	cmd: hook.UnitCommand{
+		Unit:       "principal/0",
+		Commands:   "relation-get",
+		RelationId: "db:1",
+		RemoteUnit: "mysql/0",
+	},
+	expectOut: "--relation\ndb:1\n--remote-unit\nmysql/0\nprincipal/0\nrelation-get\n",
+}, {
+	about: "no context",
+	cmd: hook.UnitCommand{
+		Unit:      "someunit/0",
+		NoContext: true,
+		Commands:  "uptime",
+	},
+	expectOut: "--no-context\nuptime\n",
+}, {
+	about: "local unit",
+	cmd: hook.UnitCommand{
+		Unit:     "someunit/0",
+		Commands: "uptime",
+	},
+	expectErr: `cannot run commands in a hook context of the local unit someunit/0 while a hook is running`,
+}, {
+	about: "no unit",
+	cmd: hook.UnitCommand{
+		Commands: "uptime",
+	},
+	expectErr: `no unit specified`,
+}, {
+	about: "no commands",
+	cmd: hook.UnitCommand{
+		Unit: "principal/0",
+	},
+	expectErr: `no commands to run`,
+}}
+
+func (*unitRunSuite) TestRunOnUnit(c *gc.C) {
+	defer fakeJujuRun(c, `for arg; do echo "$arg"; done`)()
+	for i, test := range runOnUnitTests {
+		c.Logf("test %d: %s", i, test.about)
+		t := hook.NewTestContext(hook.TestContextParams{})
+		out, err := t.RunOnUnit(test.cmd)
+		if test.expectErr != "" {
+			c.Assert(err, gc.ErrorMatches, test.expectErr)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(out.Stdout), gc.Equals, test.expectOut)
+	}
+}
+
+func (*unitRunSuite) TestRunOnUnitFailure(c *gc.C) {
+	defer fakeJujuRun(c, "echo oops >&2; exit 2")()
+	t := hook.NewTestContext(hook.TestContextParams{})
+	out, err := t.RunOnUnit(hook.UnitCommand{
+		Unit:     "principal/0",
+		Commands: "false",
+	})
+	c.Assert(err, gc.ErrorMatches, `.*/juju-run failed: exit status 2 \(output "oops"\)`)
+	c.Assert(string(out.Stderr), gc.Equals, "oops\n")
+}
+
+func (*unitRunSuite) TestRunOnUnitNotFound(c *gc.C) {
+	old := *hook.LookPath
+	defer func() {
+		*hook.LookPath = old
+	}()
+	*hook.LookPath = func(name string) (string, error) {
+		return "", errgo.New("not found")
+	}
+	t := hook.NewTestContext(hook.TestContextParams{})
+	_, err := t.RunOnUnit(hook.UnitCommand{
+		NoContext: true,
+		Commands:  "true",
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot find juju-exec or juju-run`)
+	c.Assert(errgo.Cause(err), gc.Equals, hook.ErrUnimplemented)
+}
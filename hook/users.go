@@ -0,0 +1,283 @@
+package hook
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// These are variables so that they can be changed for testing.
+var (
+	passwdFile = "/etc/passwd"
+	groupFile  = "/etc/group"
+	sudoersDir = "/etc/sudoers.d"
+)
+
+// runSystemCommand runs the given command and returns its combined
+// output. It is a variable so that it can be replaced for testing.
+var runSystemCommand = func(cmd string, args ...string) ([]byte, error) {
+	out, err := runCommand(Command{
+		Path: cmd,
+		Args: args,
+	}, nil)
+	return out.Combined, err
+}
+
+// UserParams holds the parameters for EnsureUser.
+type UserParams struct {
+	// Name holds the name of the user.
+	Name string
+
+	// Group holds the name of the user's primary group.
+	// If it is empty, useradd chooses one.
+	Group string
+
+	// Groups holds the names of any supplementary
+	// groups the user should be a member of.
+	Groups []string
+
+	// Home holds the user's home directory, which is
+	// created if the user is created. If it is empty,
+	// the user has no home directory.
+	Home string
+
+	// Shell holds the user's login shell. If it is
+	// empty, useradd chooses one.
+	Shell string
+
+	// System specifies that a system account
+	// should be created.
+	System bool
+}
+
+// EnsureGroup creates the group with the given name,
+// as a system group if system is true, unless it
+// already exists.
+func EnsureGroup(name string, system bool) error {
+	if _, err := lookupEntry(groupFile, name); err == nil {
+		return nil
+	} else if errgo.Cause(err) != errEntryNotFound {
+		return errgo.Mask(err)
+	}
+	args := []string{name}
+	if system {
+		args = []string{"--system", name}
+	}
+	if _, err := runSystemCommand("groupadd", args...); err != nil {
+		return errgo.Notef(err, "cannot create group %q", name)
+	}
+	return nil
+}
+
+// EnsureUser creates the user described by p unless it already
+// exists. If the user does exist, it is added to any of p.Groups
+// that it is not already a member of, but is otherwise left
+// unchanged.
+func EnsureUser(p UserParams) error {
+	if _, err := lookupEntry(passwdFile, p.Name); err == nil {
+		return ensureMember(p.Name, p.Groups)
+	} else if errgo.Cause(err) != errEntryNotFound {
+		return errgo.Mask(err)
+	}
+	var args []string
+	if p.System {
+		args = append(args, "--system")
+	}
+	if p.Group != "" {
+		args = append(args, "--gid", p.Group)
+	}
+	if len(p.Groups) > 0 {
+		args = append(args, "--groups", strings.Join(p.Groups, ","))
+	}
+	if p.Home != "" {
+		args = append(args, "--home-dir", p.Home, "--create-home")
+	} else {
+		args = append(args, "--no-create-home")
+	}
+	if p.Shell != "" {
+		args = append(args, "--shell", p.Shell)
+	}
+	args = append(args, p.Name)
+	if _, err := runSystemCommand("useradd", args...); err != nil {
+		return errgo.Notef(err, "cannot create user %q", p.Name)
+	}
+	return nil
+}
+
+// ensureMember adds the given user to any of the
+// given groups that it is not a member of.
+func ensureMember(user string, groups []string) error {
+	var missing []string
+	for _, group := range groups {
+		fields, err := lookupEntry(groupFile, group)
+		if err != nil {
+			return errgo.Notef(err, "cannot find group %q", group)
+		}
+		member := false
+		if len(fields) > 3 {
+			for _, m := range strings.Split(fields[3], ",") {
+				member = member || m == user
+			}
+		}
+		if !member {
+			missing = append(missing, group)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if _, err := runSystemCommand("usermod", "--append", "--groups", strings.Join(missing, ","), user); err != nil {
+		return errgo.Notef(err, "cannot add user %q to groups", user)
+	}
+	return nil
+}
+
+// EnsureDir creates the given directory and any missing parents,
+// and sets its permissions and ownership. If owner or group is
+// empty, the respective ownership is left unchanged. Permissions
+// are set even if the directory already exists, regardless of the
+// umask.
+func EnsureDir(path string, perm os.FileMode, owner, group string) error {
+	uid, gid, err := lookupOwner(owner, group)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.MkdirAll(path, perm); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Lchown(path, uid, gid); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// ChownTree changes the ownership of path and everything under it,
+// without following symbolic links. If owner or group is empty,
+// the respective ownership is left unchanged.
+func ChownTree(path, owner, group string) error {
+	uid, gid, err := lookupOwner(owner, group)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// InstallSudoers installs the given sudoers rules in
+// /etc/sudoers.d/$name, after checking them with visudo. Because
+// sudo ignores files in /etc/sudoers.d whose names contain a "."
+// or end with "~", such names are rejected.
+func InstallSudoers(name, rules string) error {
+	if name == "" || strings.ContainsAny(name, "./") || strings.HasSuffix(name, "~") {
+		return errgo.Newf("invalid sudoers file name %q", name)
+	}
+	if !strings.HasSuffix(rules, "\n") {
+		rules += "\n"
+	}
+	// Write the rules to a temporary file in the same directory
+	// first, so that we can check them and then rename them into
+	// place. The "." in the name means sudo ignores the file if
+	// we fail part way through.
+	tmp, err := ioutil.TempFile(sudoersDir, "."+name+".tmp")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(rules)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := os.Chmod(tmp.Name(), 0440); err != nil {
+		return errgo.Mask(err)
+	}
+	if _, err := runSystemCommand("visudo", "-c", "-f", tmp.Name()); err != nil {
+		return errgo.Notef(err, "invalid sudoers rules")
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(sudoersDir, name)); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// lookupOwner returns the user and group ids for the given user
+// and group names. An empty name results in an id of -1.
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = LookupUserId(owner); err != nil {
+			return 0, 0, errgo.Notef(err, "cannot find user %q", owner)
+		}
+	}
+	if group != "" {
+		if gid, err = LookupGroupId(group); err != nil {
+			return 0, 0, errgo.Notef(err, "cannot find group %q", group)
+		}
+	}
+	return uid, gid, nil
+}
+
+// LookupUserId returns the numeric id of the user with the given
+// name, as found in /etc/passwd.
+func LookupUserId(name string) (int, error) {
+	return lookupId(passwdFile, name)
+}
+
+// LookupGroupId returns the numeric id of the group with the given
+// name, as found in /etc/group.
+func LookupGroupId(name string) (int, error) {
+	return lookupId(groupFile, name)
+}
+
+// lookupId returns the numeric id of the given
+// name in the given /etc/passwd or /etc/group file.
+func lookupId(file, name string) (int, error) {
+	fields, err := lookupEntry(file, name)
+	if err != nil {
+		return 0, errgo.Mask(err, errgo.Is(errEntryNotFound))
+	}
+	id, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, errgo.Newf("invalid id %q in %s", fields[2], file)
+	}
+	return id, nil
+}
+
+var errEntryNotFound = errgo.New("entry not found")
+
+// lookupEntry returns the fields of the entry for the given name
+// in the given file, which should be in /etc/passwd or /etc/group
+// format. We parse the file directly rather than using os/user
+// because charm binaries are built without cgo.
+func lookupEntry(file, name string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) >= 3 && fields[0] == name {
+			return fields, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return nil, errgo.WithCausef(nil, errEntryNotFound, "%q not found in %s", name, file)
+}
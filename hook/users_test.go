@@ -0,0 +1,202 @@
+package hook_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+
+	"github.com/juju/gocharm/hook"
+)
+
+type usersSuite struct {
+	savedRunSystemCommand func(string, ...string) ([]byte, error)
+	savedPasswdFile       string
+	savedGroupFile        string
+	savedSudoersDir       string
+	calls                 []string
+	fail                  bool
+}
+
+var _ = gc.Suite(&usersSuite{})
+
+func (s *usersSuite) SetUpTest(c *gc.C) {
+	s.savedRunSystemCommand = *hook.RunSystemCommand
+	s.savedPasswdFile = *hook.PasswdFile
+	s.savedGroupFile = *hook.GroupFile
+	s.savedSudoersDir = *hook.SudoersDir
+	*hook.RunSystemCommand = func(cmd string, args ...string) ([]byte, error) {
+		s.calls = append(s.calls, cmd+" "+strings.Join(args, " "))
+		if s.fail {
+			return nil, errgo.Newf("%s failed", cmd)
+		}
+		return nil, nil
+	}
+	dir := c.MkDir()
+	uid, gid := os.Getuid(), os.Getgid()
+	*hook.PasswdFile = writeFile(c, dir, "passwd", fmt.Sprintf("root:x:0:0::/root:/bin/sh\nme:x:%d:%d::/home/me:/bin/sh\n", uid, gid))
+	*hook.GroupFile = writeFile(c, dir, "group", fmt.Sprintf("root:x:0:\nmine:x:%d:\nadm:x:4:syslog,me\nwww:x:33:\n", gid))
+	*hook.SudoersDir = c.MkDir()
+	s.calls = nil
+	s.fail = false
+}
+
+func (s *usersSuite) TearDownTest(c *gc.C) {
+	*hook.RunSystemCommand = s.savedRunSystemCommand
+	*hook.PasswdFile = s.savedPasswdFile
+	*hook.GroupFile = s.savedGroupFile
+	*hook.SudoersDir = s.savedSudoersDir
+}
+
+func (s *usersSuite) TestEnsureGroup(c *gc.C) {
+	err := hook.EnsureGroup("adm", true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+
+	err = hook.EnsureGroup("myservice", true)
+	c.Assert(err, gc.IsNil)
+	err = hook.EnsureGroup("other", false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"groupadd --system myservice",
+		"groupadd other",
+	})
+
+	s.fail = true
+	err = hook.EnsureGroup("another", false)
+	c.Assert(err, gc.ErrorMatches, `cannot create group "another": groupadd failed`)
+}
+
+func (s *usersSuite) TestEnsureUser(c *gc.C) {
+	err := hook.EnsureUser(hook.UserParams{
+		Name:   "myservice",
+		Group:  "mine",
+		Groups: []string{"adm", "www"},
+		Home:   "/var/lib/myservice",
+		Shell:  "/bin/false",
+		System: true,
+	})
+	c.Assert(err, gc.IsNil)
+	err = hook.EnsureUser(hook.UserParams{
+		Name: "plain",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"useradd --system --gid mine --groups adm,www --home-dir /var/lib/myservice --create-home --shell /bin/false myservice",
+		"useradd --no-create-home plain",
+	})
+}
+
+func (s *usersSuite) TestEnsureUserExists(c *gc.C) {
+	// The user is already in adm, so is only added to www.
+	err := hook.EnsureUser(hook.UserParams{
+		Name:   "me",
+		Groups: []string{"adm", "www"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, jc.DeepEquals, []string{
+		"usermod --append --groups www me",
+	})
+
+	s.calls = nil
+	err = hook.EnsureUser(hook.UserParams{
+		Name:   "me",
+		Groups: []string{"adm"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.calls, gc.HasLen, 0)
+
+	err = hook.EnsureUser(hook.UserParams{
+		Name:   "me",
+		Groups: []string{"nonexistent"},
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot find group "nonexistent": "nonexistent" not found in .*`)
+}
+
+func (s *usersSuite) TestLookupIds(c *gc.C) {
+	uid, err := hook.LookupUserId("me")
+	c.Assert(err, gc.IsNil)
+	c.Assert(uid, gc.Equals, os.Getuid())
+	gid, err := hook.LookupGroupId("www")
+	c.Assert(err, gc.IsNil)
+	c.Assert(gid, gc.Equals, 33)
+
+	_, err = hook.LookupUserId("nobody")
+	c.Assert(err, gc.ErrorMatches, `"nobody" not found in .*/passwd`)
+	_, err = hook.LookupGroupId("wheel")
+	c.Assert(err, gc.ErrorMatches, `"wheel" not found in .*/group`)
+}
+
+func (s *usersSuite) TestEnsureDir(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "a", "run")
+	err := hook.EnsureDir(path, 0750, "me", "mine")
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.IsDir(), jc.IsTrue)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0750))
+	c.Assert(int(info.Sys().(*syscall.Stat_t).Uid), gc.Equals, os.Getuid())
+
+	// The permissions are changed if the directory exists.
+	err = hook.EnsureDir(path, 0700, "", "")
+	c.Assert(err, gc.IsNil)
+	info, err = os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0700))
+
+	err = hook.EnsureDir(path, 0700, "nobody", "")
+	c.Assert(err, gc.ErrorMatches, `cannot find user "nobody": "nobody" not found in .*`)
+}
+
+func (s *usersSuite) TestChownTree(c *gc.C) {
+	dir := c.MkDir()
+	writeFile(c, dir, "file", "data")
+	err := os.Mkdir(filepath.Join(dir, "sub"), 0777)
+	c.Assert(err, gc.IsNil)
+	writeFile(c, filepath.Join(dir, "sub"), "file", "data")
+	err = os.Symlink("/nowhere", filepath.Join(dir, "link"))
+	c.Assert(err, gc.IsNil)
+
+	err = hook.ChownTree(dir, "me", "mine")
+	c.Assert(err, gc.IsNil)
+	err = hook.ChownTree(dir, "", "nogroup")
+	c.Assert(err, gc.ErrorMatches, `cannot find group "nogroup": .*`)
+}
+
+func (s *usersSuite) TestInstallSudoers(c *gc.C) {
+	err := hook.InstallSudoers("myservice", "myservice ALL=(root) NOPASSWD: /usr/sbin/service myservice *")
+	c.Assert(err, gc.IsNil)
+	path := filepath.Join(*hook.SudoersDir, "myservice")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "myservice ALL=(root) NOPASSWD: /usr/sbin/service myservice *\n")
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0440))
+	c.Assert(s.calls, gc.HasLen, 1)
+	c.Assert(s.calls[0], gc.Matches, `visudo -c -f .*/\.myservice\.tmp[0-9]+`)
+
+	// Invalid rules are not installed.
+	s.fail = true
+	err = hook.InstallSudoers("other", "bad rules")
+	c.Assert(err, gc.ErrorMatches, `invalid sudoers rules: visudo failed`)
+	entries, err := ioutil.ReadDir(*hook.SudoersDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+
+	err = hook.InstallSudoers("my.service", "")
+	c.Assert(err, gc.ErrorMatches, `invalid sudoers file name "my.service"`)
+}
+
+func writeFile(c *gc.C, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(data), 0666)
+	c.Assert(err, gc.IsNil)
+	return path
+}